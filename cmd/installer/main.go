@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"nginx-mgr/internal/service"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// envFlags 可重复指定的 --env KEY=VALUE
+type envFlags []string
+
+func (e *envFlags) String() string { return strings.Join(*e, ",") }
+
+func (e *envFlags) Set(value string) error {
+	*e = append(*e, value)
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  installer [--binary /opt/nginx-mgr/nginx-mgr] [--workdir /opt/nginx-mgr] [--user root]
+            [--env KEY=VALUE]... [--restart on-failure] [--unit %s] [--print]
+
+把 nginx-mgr 注册为 systemd 服务：写入单元、设为开机启动并立即（重新）启动，最后输出服务状态。
+重复执行会覆盖原单元并重启面板。
+
+Options:
+`, service.PanelUnitPath)
+	flag.PrintDefaults()
+}
+
+// defaultBinary 默认使用与 installer 同目录的 nginx-mgr
+func defaultBinary() string {
+	if exe, err := os.Executable(); err == nil {
+		return filepath.Join(filepath.Dir(exe), "nginx-mgr")
+	}
+	return "/opt/nginx-mgr/nginx-mgr"
+}
+
+func main() {
+	var env envFlags
+	var (
+		binary    = flag.String("binary", defaultBinary(), "nginx-mgr 程序的绝对路径")
+		workDir   = flag.String("workdir", "", "工作目录，auth_token.json 等文件保存在此，默认为程序所在目录；--user 非 root 时必须指定")
+		user      = flag.String("user", "root", "运行面板的账号；非 root 账号不存在时自动创建，但安装 Nginx、防火墙等功能需要 root")
+		restart   = flag.String("restart", "on-failure", "重启策略: always、on-failure 或 on-abnormal")
+		unit      = flag.String("unit", service.PanelUnitPath, "systemd 单元文件路径")
+		printOnly = flag.Bool("print", false, "只输出单元内容，不写入也不启动")
+	)
+	flag.Var(&env, "env", "传给面板的环境变量 KEY=VALUE，可重复指定，例如 --env NGINX_MGR_READ_ONLY=true")
+	flag.Usage = usage
+	flag.Parse()
+
+	bin, err := filepath.Abs(*binary)
+	if err != nil {
+		log.Fatalf("解析程序路径失败: %v", err)
+	}
+	dir := *workDir
+	if dir == "" {
+		// 非 root 账号会接管整个工作目录，不能默认使用程序所在目录
+		if *user != "root" {
+			log.Fatalf("--user 为 %s 时需用 --workdir 指定面板专用的工作目录，安装时会把该目录的所有者改为 %s", *user, *user)
+		}
+		dir = filepath.Dir(bin)
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		log.Fatalf("解析工作目录失败: %v", err)
+	}
+	opts := service.PanelUnitOptions{
+		Binary:  bin,
+		WorkDir: dir,
+		User:    *user,
+		Env:     append([]string{"GIN_MODE=release"}, env...),
+		Restart: *restart,
+	}
+
+	if *printOnly {
+		content, err := service.RenderPanelUnit(opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(content)
+		return
+	}
+	if os.Geteuid() != 0 {
+		log.Fatalf("需要以 root 身份运行才能写入 %s", *unit)
+	}
+	if opts.User != "root" {
+		fmt.Printf("提示: 面板将以 %s 运行，安装/卸载 Nginx、防火墙、fail2ban 以及 /root 下的设置文件需要 root 权限，相关功能将不可用\n", opts.User)
+	}
+	status, err := service.InstallPanelUnit(opts, *unit)
+	if status != "" {
+		fmt.Println(status)
+	}
+	if err != nil {
+		log.Fatalf("注册面板服务失败: %v", err)
+	}
+	fmt.Printf("面板服务已启用并运行: %s（工作目录 %s，账号 %s）\n", filepath.Base(*unit), opts.WorkDir, opts.User)
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"nginx-mgr/internal/model"
 	"nginx-mgr/internal/service"
 	"os"
 	"path/filepath"
@@ -12,6 +14,8 @@ import (
 func usage() {
 	fmt.Fprintf(flag.CommandLine.Output(), `Usage:
   tokenctl --set <token> [--file auth_token.json]
+  tokenctl --user <name> --password <password> [--file auth_token.json]
+  tokenctl --user <name> --reset-totp [--file auth_token.json]
 
 Options:
 `)
@@ -48,10 +52,21 @@ func main() {
 	var (
 		token = flag.String("set", "", "要写入的登录令牌")
 		path  = flag.String("file", defaultTokenPath(), "令牌存储文件路径")
+		user  = flag.String("user", "", "创建账号或重置其密码，账号保存在令牌文件同目录的 users.json")
+		pass  = flag.String("password", "", "账号密码，配合 --user 使用")
+		reset = flag.Bool("reset-totp", false, "关闭指定账号的两步验证，用于验证器丢失且恢复码用尽时")
 	)
 	flag.Usage = usage
 	flag.Parse()
 
+	if *user != "" && *reset {
+		resetTOTP(filepath.Join(filepath.Dir(filepath.Clean(*path)), "users.json"), *user)
+		return
+	}
+	if *user != "" {
+		setUserPassword(filepath.Join(filepath.Dir(filepath.Clean(*path)), "users.json"), *user, *pass)
+		return
+	}
 	if *token == "" {
 		usage()
 		os.Exit(1)
@@ -69,3 +84,36 @@ func main() {
 
 	fmt.Printf("登录令牌已更新，当前会话有效期至: %s\n", expire.Format("2006-01-02 15:04:05"))
 }
+
+func setUserPassword(path, user, password string) {
+	if password == "" {
+		log.Fatalf("请通过 --password 指定密码")
+	}
+	store, err := service.NewUserStore(path)
+	if err != nil {
+		log.Fatalf("加载账号文件失败: %v", err)
+	}
+	err = store.SetPassword(user, password)
+	if errors.Is(err, service.ErrUserNotFound) {
+		_, err = store.CreateUser(user, password, model.RoleAdmin)
+		if err == nil {
+			fmt.Printf("管理员账号 %s 已创建\n", user)
+			return
+		}
+	}
+	if err != nil {
+		log.Fatalf("设置账号失败: %v", err)
+	}
+	fmt.Printf("账号 %s 的密码已重置，原有会话已注销\n", user)
+}
+
+func resetTOTP(path, user string) {
+	store, err := service.NewUserStore(path)
+	if err != nil {
+		log.Fatalf("加载账号文件失败: %v", err)
+	}
+	if err := store.DisableTOTP(user); err != nil {
+		log.Fatalf("重置两步验证失败: %v", err)
+	}
+	fmt.Printf("账号 %s 的两步验证已关闭\n", user)
+}
@@ -0,0 +1,26 @@
+package model
+
+// AbuseSettings 按访问日志自动封禁异常 IP 的规则。统计窗口内请求数超过 MaxRequests，
+// 或请求数不少于 MinRequests 且 4xx 占比达到 ClientErrorPercent 时封禁 BanMinutes 分钟
+type AbuseSettings struct {
+	Enabled             bool     `json:"enabled"`
+	WindowSeconds       int      `json:"window_seconds"`
+	MaxRequests         int      `json:"max_requests"`
+	ClientErrorPercent  int      `json:"client_error_percent"` // 0 表示不按 4xx 占比封禁
+	MinRequests         int      `json:"min_requests"`
+	BanMinutes          int      `json:"ban_minutes"`
+	Backend             string   `json:"backend"`   // nginx（http 级别 deny 列表）或 nftables
+	Whitelist           []string `json:"whitelist"` // 永不封禁的 IP 或 CIDR
+	LastUpdatedUnixTime int64    `json:"last_updated_unix_time"`
+}
+
+// AbuseBan 一条封禁记录，ExpiresUnixTime 为 0 表示手动封禁且不自动解除
+type AbuseBan struct {
+	IP              string `json:"ip"`
+	Reason          string `json:"reason"`
+	Requests        int64  `json:"requests,omitempty"`
+	ClientErrors    int64  `json:"client_errors,omitempty"`
+	Manual          bool   `json:"manual"`
+	CreatedUnixTime int64  `json:"created_unix_time"`
+	ExpiresUnixTime int64  `json:"expires_unix_time"`
+}
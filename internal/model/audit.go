@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// AuditEntry 一次写操作的审计记录
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	User       string    `json:"user"` // 账号名，旧的单一令牌记为 token
+	Role       string    `json:"role,omitempty"`
+	ClientIP   string    `json:"client_ip"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Route      string    `json:"route"`             // 路由模板，如 /api/v1/sites/:domain
+	Payload    string    `json:"payload,omitempty"` // 敏感字段已脱敏，超长时截断
+	Status     int       `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Reload     string    `json:"reload,omitempty"` // ok, failed
+	RolledBack bool      `json:"rolled_back,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// AuditQuery 审计日志过滤条件，零值字段不参与过滤
+type AuditQuery struct {
+	User   string
+	Method string
+	Path   string // 按前缀匹配
+	Failed bool   // 只返回状态码 >= 400 的记录
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
@@ -0,0 +1,85 @@
+package model
+
+// S3 兼容存储服务商
+const (
+	S3ProviderCloudflare = "cloudflare"
+	S3ProviderAWS        = "aws"
+	S3ProviderMinio      = "minio"
+	S3ProviderB2         = "b2"
+	S3ProviderOther      = "other" // 其他任意 S3 兼容服务
+)
+
+// 远程备份目标类型
+const (
+	BackupTargetS3     = "s3"
+	BackupTargetSFTP   = "sftp"
+	BackupTargetWebDAV = "webdav"
+	BackupTargetRclone = "rclone" // 引用 rclone.conf 中已有的任意 remote，如 Google Drive、OneDrive、FTP
+)
+
+// WebDAV 服务类型，决定 rclone 对修改时间、校验和等扩展的处理方式
+const (
+	WebDAVVendorNextcloud  = "nextcloud"
+	WebDAVVendorOwncloud   = "owncloud"
+	WebDAVVendorJianguoyun = "jianguoyun" // 坚果云，按通用 WebDAV 处理
+	WebDAVVendorOther      = "other"
+)
+
+// BackupSettings 远程备份目标，面板据此生成 rclone 配置，不再解析手工编辑的 rclone.conf
+type BackupSettings struct {
+	Type                string             `json:"type"`
+	S3                  S3BackupTarget     `json:"s3"`
+	SFTP                SFTPBackupTarget   `json:"sftp"`
+	WebDAV              WebDAVBackupTarget `json:"webdav"`
+	Remote              string             `json:"remote,omitempty"` // Type 为 rclone 时使用的 remote 名称
+	LastUpdatedUnixTime int64              `json:"last_updated_unix_time"`
+}
+
+// S3BackupTarget S3 兼容存储的连接参数
+type S3BackupTarget struct {
+	Provider  string `json:"provider"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key,omitempty"`
+	Endpoint  string `json:"endpoint,omitempty"` // AWS 可留空
+	Region    string `json:"region,omitempty"`
+	PathStyle *bool  `json:"path_style,omitempty"` // 为空时由 rclone 按服务商决定
+}
+
+// SFTPBackupTarget 普通 Linux 服务器作为备份目标，密码与私钥二选一
+type SFTPBackupTarget struct {
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	User       string `json:"user"`
+	Password   string `json:"password,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"` // PEM 内容，由面板写入权限为 0600 的密钥文件
+	KeyFile    string `json:"key_file,omitempty"`    // 或使用服务器上已有的私钥文件
+}
+
+// WebDAVBackupTarget Nextcloud、坚果云等 WebDAV 网盘作为备份目标
+type WebDAVBackupTarget struct {
+	Vendor   string `json:"vendor"`
+	URL      string `json:"url"`
+	User     string `json:"user"`
+	Password string `json:"password,omitempty"` // 坚果云需使用应用密码
+}
+
+// RcloneRemote rclone.conf 中的一个 remote。查询时不返回敏感参数的值，只在 Secrets 中列出已设置的参数名
+type RcloneRemote struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`
+	Options map[string]string `json:"options"`
+	Secrets []string          `json:"secrets,omitempty"`
+	Managed bool              `json:"managed"` // 由备份存储设置生成，不能通过通用接口修改
+}
+
+// BackupSchedule 面板内置定时备份的状态，持久化后面板重启也能补上错过的任务
+type BackupSchedule struct {
+	Enabled         bool   `json:"enabled"`
+	Preset          string `json:"preset,omitempty"` // hourly、daily、weekly、custom，供界面回显
+	Cron            string `json:"cron"`             // 标准 5 段 cron 表达式，按服务器本地时区计算
+	NextRunUnixTime int64  `json:"next_run_unix_time"`
+	LastRunUnixTime int64  `json:"last_run_unix_time"`
+	LastDurationMs  int64  `json:"last_duration_ms"`
+	LastSuccess     bool   `json:"last_success"`
+	LastError       string `json:"last_error,omitempty"`
+}
@@ -0,0 +1,7 @@
+package model
+
+// BotBlockSettings 全局 User-Agent 拦截名单，站点开启 BlockBots 后生效
+type BotBlockSettings struct {
+	UserAgents          []string `json:"user_agents"` // 大小写不敏感的正则，如 sqlmap、AhrefsBot
+	LastUpdatedUnixTime int64    `json:"last_updated_unix_time"`
+}
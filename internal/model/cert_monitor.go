@@ -0,0 +1,38 @@
+package model
+
+// CertMonitorSettings 外部域名证书监测，每天连接各主机检查证书链与到期时间
+type CertMonitorSettings struct {
+	Enabled             bool              `json:"enabled"`
+	WarnDays            int               `json:"warn_days"` // 剩余天数不超过该值时告警
+	Hosts               []CertMonitorHost `json:"hosts"`
+	LastUpdatedUnixTime int64             `json:"last_updated_unix_time"`
+}
+
+type CertMonitorHost struct {
+	Host       string `json:"host"`                  // 域名或 IP
+	Port       int    `json:"port"`                  // 默认 443
+	ServerName string `json:"server_name,omitempty"` // SNI 与校验证书时使用的域名，默认为 Host
+}
+
+// CertCheckResult 一台主机最近一次的检查结果。Valid 表示证书链可信、域名匹配且未过期
+type CertCheckResult struct {
+	Host              string   `json:"host"`
+	Port              int      `json:"port"`
+	ServerName        string   `json:"server_name"`
+	CheckedUnixTime   int64    `json:"checked_unix_time"`
+	Valid             bool     `json:"valid"`
+	Error             string   `json:"error,omitempty"`
+	Subject           string   `json:"subject,omitempty"`
+	Issuer            string   `json:"issuer,omitempty"`
+	DNSNames          []string `json:"dns_names,omitempty"`
+	NotBeforeUnixTime int64    `json:"not_before_unix_time,omitempty"`
+	NotAfterUnixTime  int64    `json:"not_after_unix_time,omitempty"`
+	DaysLeft          int      `json:"days_left"`
+}
+
+// CertMonitorStatus 定时检查的时间与各主机最近一次的结果
+type CertMonitorStatus struct {
+	LastRunUnixTime int64             `json:"last_run_unix_time"`
+	NextRunUnixTime int64             `json:"next_run_unix_time,omitempty"`
+	Results         []CertCheckResult `json:"results"`
+}
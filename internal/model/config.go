@@ -1,5 +1,13 @@
 package model
 
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
 const (
 	NginxPrefix      = "/usr/local/nginx"
 	BuildDir         = "/usr/local/src/nginx-build"
@@ -14,16 +22,237 @@ const (
 )
 
 type SiteConfig struct {
-	Domain      string   `json:"domain"`
-	Type        string   `json:"type"` // proxy, static, lb, redirect
-	BackendIP   string   `json:"backend_ip"`
-	BackendPort int      `json:"backend_port"`
-	Backends    []string `json:"backends"`   // For LB
-	TargetURL   string   `json:"target_url"` // For redirect
+	Domain         string            `json:"domain"`
+	Type           string            `json:"type"` // proxy, static, lb, redirect, uwsgi, fastcgi
+	BackendIP      string            `json:"backend_ip"`
+	BackendPort    int               `json:"backend_port"`
+	Backends       []Backend         `json:"backends"`                // For LB
+	LBMethod       string            `json:"lb_method,omitempty"`     // round_robin, least_conn, ip_hash, hash
+	LBHashKey      string            `json:"lb_hash_key,omitempty"`   // e.g. $request_uri, used by hash
+	Sticky         string            `json:"sticky,omitempty"`        // ip_hash, cookie
+	StickyCookie   string            `json:"sticky_cookie,omitempty"` // cookie name, used by cookie
+	TargetURL      string            `json:"target_url"`              // For redirect
+	Upstream       string            `json:"upstream,omitempty"`      // 引用共享 upstream，proxy/lb 可用
+	AppTarget      string            `json:"app_target,omitempty"`    // uwsgi/fastcgi 后端，如 unix:/run/app.sock 或 127.0.0.1:9000
+	RedirectRules  []RedirectRule    `json:"redirect_rules,omitempty"`
+	Hotlink        *HotlinkConfig    `json:"hotlink,omitempty"`
+	BlockedAgents  []string          `json:"blocked_agents,omitempty"` // 站点级 UA 拦截，大小写不敏感的正则
+	BlockBots      bool              `json:"block_bots,omitempty"`     // 同时应用全局 UA 拦截名单
+	ProxyHeaders   map[string]string `json:"proxy_headers,omitempty"`
+	TLSPolicy      string            `json:"tls_policy,omitempty"`  // modern, intermediate, compat
+	Compression    string            `json:"compression,omitempty"` // both, gzip, brotli, off
+	LogFormat      string            `json:"log_format,omitempty"`
+	LimitRate      string            `json:"limit_rate,omitempty"`       // e.g. 512k, 1m
+	LimitRateAfter string            `json:"limit_rate_after,omitempty"` // e.g. 10m
+}
+
+// HotlinkConfig 防盗链：Referer 不在白名单内的媒体文件请求返回 403
+type HotlinkConfig struct {
+	Enabled         bool     `json:"enabled"`
+	AllowedReferers []string `json:"allowed_referers"`      // 额外允许的域名，支持 *.example.com 与 ~正则
+	BlockEmpty      bool     `json:"block_empty,omitempty"` // 同时拒绝无 Referer 的请求
+	Extensions      []string `json:"extensions,omitempty"`  // 为空时使用默认的图片/视频扩展名
+}
+
+// SiteDefaults 新建站点时未显式指定的字段将使用此处的面板级默认值
+type SiteDefaults struct {
+	ProxyHeaders        map[string]string `json:"proxy_headers"`
+	TLSPolicy           string            `json:"tls_policy"`
+	Compression         string            `json:"compression"`
+	LogFormat           string            `json:"log_format"`
+	LastUpdatedUnixTime int64             `json:"last_updated_unix_time"`
+}
+
+// UpstreamConfig 可被多个站点引用的共享 upstream
+type UpstreamConfig struct {
+	Name      string    `json:"name"`
+	Backends  []Backend `json:"backends"`
+	LBMethod  string    `json:"lb_method,omitempty"`
+	LBHashKey string    `json:"lb_hash_key,omitempty"`
+	Keepalive int       `json:"keepalive,omitempty"`
 }
 
 type StreamConfig struct {
-	Name       string `json:"name"`
-	ListenPort int    `json:"listen_port"`
-	Target     string `json:"target"` // IP:PORT
+	Name       string    `json:"name"`
+	ListenPort int       `json:"listen_port"`
+	ListenAddr string    `json:"listen_addr,omitempty"` // 绑定的本机 IP，为空时监听所有地址
+	Target     string    `json:"target"`                // IP:PORT，Targets 为空时使用
+	Targets    []Backend `json:"targets,omitempty"`     // 多个目标，支持 weight/max_fails/fail_timeout/backup
+	LBMethod   string    `json:"lb_method,omitempty"`   // round_robin, least_conn, hash（按客户端 IP）
+	Protocol   string    `json:"protocol,omitempty"`    // tcp, udp, both
+	// 连接数与带宽限制，0 或空表示不限制
+	MaxConns      int    `json:"max_conns,omitempty"`        // 该端口的总并发连接数
+	MaxConnsPerIP int    `json:"max_conns_per_ip,omitempty"` // 单个客户端 IP 的并发连接数
+	UploadRate    string `json:"upload_rate,omitempty"`      // 客户端上传速率，如 1m
+	DownloadRate  string `json:"download_rate,omitempty"`    // 客户端下载速率，如 1m
+	Enabled       bool   `json:"enabled"`                    // 只读，由 streams-enabled 中的软链接决定
+}
+
+// Listen 返回 listen 指令的地址部分，如 3306、10.0.0.5:3306 或 [::1]:3306
+func (c StreamConfig) Listen() string {
+	port := strconv.Itoa(c.ListenPort)
+	if c.ListenAddr == "" {
+		return port
+	}
+	return net.JoinHostPort(c.ListenAddr, port)
+}
+
+// Backend 负载均衡节点；JSON 中也可直接使用 "IP:PORT weight=2 backup" 形式的字符串
+type Backend struct {
+	Address     string `json:"address"`
+	Weight      int    `json:"weight,omitempty"`
+	Backup      bool   `json:"backup,omitempty"`
+	MaxFails    int    `json:"max_fails,omitempty"`
+	FailTimeout string `json:"fail_timeout,omitempty"`
+	Down        bool   `json:"down,omitempty"`
+}
+
+func (b *Backend) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		parsed, err := ParseBackend(strings.Fields(text))
+		if err != nil {
+			return err
+		}
+		*b = parsed
+		return nil
+	}
+	type plain Backend
+	var value plain
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*b = Backend(value)
+	b.Address = strings.TrimSpace(b.Address)
+	return nil
+}
+
+// String 渲染为 upstream 中 server 指令的参数
+func (b Backend) String() string {
+	parts := []string{b.Address}
+	if b.Weight > 0 {
+		parts = append(parts, fmt.Sprintf("weight=%d", b.Weight))
+	}
+	if b.MaxFails > 0 {
+		parts = append(parts, fmt.Sprintf("max_fails=%d", b.MaxFails))
+	}
+	if b.FailTimeout != "" {
+		parts = append(parts, "fail_timeout="+b.FailTimeout)
+	}
+	if b.Backup {
+		parts = append(parts, "backup")
+	}
+	if b.Down {
+		parts = append(parts, "down")
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseBackend 从 server 指令参数中解析节点，未识别的参数返回错误
+func ParseBackend(fields []string) (Backend, error) {
+	if len(fields) == 0 {
+		return Backend{}, fmt.Errorf("节点地址不能为空")
+	}
+	b := Backend{Address: fields[0]}
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "weight":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return Backend{}, fmt.Errorf("节点 %s 的 weight 无效: %s", b.Address, value)
+			}
+			b.Weight = n
+		case "max_fails":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return Backend{}, fmt.Errorf("节点 %s 的 max_fails 无效: %s", b.Address, value)
+			}
+			b.MaxFails = n
+		case "fail_timeout":
+			b.FailTimeout = value
+		case "backup":
+			b.Backup = true
+		case "down":
+			b.Down = true
+		default:
+			return Backend{}, fmt.Errorf("节点 %s 包含不支持的参数: %s", b.Address, field)
+		}
+	}
+	return b, nil
+}
+
+// RedirectRule 按路径匹配的重定向规则；JSON 中也可使用 "= /old.html /new.html 301" 形式的字符串
+type RedirectRule struct {
+	Match  string `json:"match"` // exact, prefix, regex
+	Path   string `json:"path"`
+	Target string `json:"target"`
+	Code   int    `json:"code,omitempty"` // 301, 302, 307, 308
+}
+
+var redirectModifiers = map[string]string{
+	"=":  "exact",
+	"^~": "prefix",
+	"~":  "regex",
+}
+
+func (r *RedirectRule) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		parsed, err := ParseRedirectRule(strings.Fields(text))
+		if err != nil {
+			return err
+		}
+		*r = parsed
+		return nil
+	}
+	type plain RedirectRule
+	var value plain
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*r = RedirectRule(value)
+	return nil
+}
+
+// Modifier 返回规则对应的 location 修饰符
+func (r RedirectRule) Modifier() string {
+	for modifier, match := range redirectModifiers {
+		if match == r.Match {
+			return modifier
+		}
+	}
+	return "="
+}
+
+// String 渲染为 "修饰符 路径 目标 状态码" 形式
+func (r RedirectRule) String() string {
+	parts := []string{r.Modifier(), r.Path, r.Target}
+	if r.Code != 0 {
+		parts = append(parts, strconv.Itoa(r.Code))
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseRedirectRule 解析 "[修饰符] 路径 目标 [状态码]"，省略修饰符时为精确匹配
+func ParseRedirectRule(fields []string) (RedirectRule, error) {
+	r := RedirectRule{Match: "exact"}
+	if len(fields) > 0 {
+		if match, ok := redirectModifiers[fields[0]]; ok {
+			r.Match = match
+			fields = fields[1:]
+		}
+	}
+	if len(fields) < 2 || len(fields) > 3 {
+		return RedirectRule{}, fmt.Errorf("重定向规则格式应为 \"[= | ^~ | ~] 路径 目标 [状态码]\"")
+	}
+	r.Path, r.Target = fields[0], fields[1]
+	if len(fields) == 3 {
+		code, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return RedirectRule{}, fmt.Errorf("重定向规则 %s 的状态码无效: %s", r.Path, fields[2])
+		}
+		r.Code = code
+	}
+	return r, nil
 }
@@ -0,0 +1,74 @@
+package model
+
+// Dashboard 仪表盘首页的汇总数据，某一部分读取失败时保留零值并在 Warnings 中说明
+type Dashboard struct {
+	GeneratedUnixTime int64             `json:"generated_unix_time"`
+	Nginx             DashboardNginx    `json:"nginx"`
+	Sites             DashboardSites    `json:"sites"`
+	Streams           DashboardStreams  `json:"streams"`
+	Certs             DashboardCerts    `json:"certs"`
+	Traffic           *DashboardTraffic `json:"traffic"` // 未启用流量统计时为 null
+	Errors            DashboardErrors   `json:"errors"`
+	Backup            DashboardBackup   `json:"backup"`
+	Warnings          []string          `json:"warnings"`
+}
+
+type DashboardNginx struct {
+	Active  bool   `json:"active"`
+	Version string `json:"version"`
+}
+
+type DashboardSites struct {
+	Total   int            `json:"total"`
+	Enabled int            `json:"enabled"`
+	Types   map[string]int `json:"types"` // 按站点类型（proxy、static、lb、redirect）计数
+}
+
+type DashboardStreams struct {
+	Total   int `json:"total"`
+	Enabled int `json:"enabled"`
+}
+
+type DashboardCert struct {
+	Domain           string `json:"domain"`
+	NotAfterUnixTime int64  `json:"not_after_unix_time"`
+	DaysLeft         int    `json:"days_left"`
+}
+
+// DashboardCerts ACME 证书的到期情况，Soonest 为最早到期的几张
+type DashboardCerts struct {
+	Total    int             `json:"total"`
+	Expiring int             `json:"expiring"` // 剩余天数不超过 ExpiringDays
+	Expired  int             `json:"expired"`
+	Soonest  []DashboardCert `json:"soonest"`
+
+	ExpiringDays int `json:"expiring_days"`
+}
+
+type DashboardTraffic struct {
+	UsedBytes          uint64 `json:"used_bytes"`
+	LimitBytes         uint64 `json:"limit_bytes"`
+	CycleStartUnixTime int64  `json:"cycle_start_unix_time"`
+	NextResetUnixTime  int64  `json:"next_reset_unix_time"`
+}
+
+// DashboardError 带站点域名的错误日志记录
+type DashboardError struct {
+	Domain string `json:"domain"`
+	SiteErrorEntry
+}
+
+// DashboardErrors 近 24 小时各站点 error 及以上级别的错误数与最近几条记录
+type DashboardErrors struct {
+	Total  int64            `json:"total"`
+	Recent []DashboardError `json:"recent"`
+}
+
+type DashboardBackup struct {
+	Configured      bool   `json:"configured"`
+	ScheduleEnabled bool   `json:"schedule_enabled"`
+	LastRunUnixTime int64  `json:"last_run_unix_time"`
+	LastRunSuccess  bool   `json:"last_run_success"`
+	LastRunError    string `json:"last_run_error,omitempty"`
+	NextRunUnixTime int64  `json:"next_run_unix_time"`
+}
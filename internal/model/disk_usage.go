@@ -0,0 +1,28 @@
+package model
+
+// DiskUsage 面板关注的各目录占用与所在文件系统的容量
+type DiskUsage struct {
+	Paths       []DiskPathUsage `json:"paths"`
+	LargestLogs []DiskLogFile   `json:"largest_logs"` // 日志目录中最大的若干文件，按大小降序
+}
+
+type DiskPathUsage struct {
+	Name   string `json:"name"` // root、nginx_logs、web_root、backups、nginx_cache
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+	// SizeBytes 目录内文件合计大小，根目录不统计，为 0
+	SizeBytes  uint64 `json:"size_bytes"`
+	TotalBytes uint64 `json:"total_bytes"` // 所在文件系统容量
+	UsedBytes  uint64 `json:"used_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	// UsedPercent 所在文件系统已用百分比，与 df 的 Use% 一致
+	UsedPercent float64 `json:"used_percent"`
+	Error       string  `json:"error,omitempty"`
+}
+
+type DiskLogFile struct {
+	Path       string `json:"path"`
+	SizeBytes  uint64 `json:"size_bytes"`
+	ModifiedAt int64  `json:"modified_at"`
+	Rotated    bool   `json:"rotated"` // 已轮转的旧日志（.1、.gz 等），可直接删除
+}
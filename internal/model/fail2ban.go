@@ -0,0 +1,34 @@
+package model
+
+// Fail2banSettings 面板维护的 fail2ban jail，保存后写入 /etc/fail2ban/jail.d/nginx-mgr.local
+type Fail2banSettings struct {
+	Jails               []Fail2banJail `json:"jails"`
+	LastUpdatedUnixTime int64          `json:"last_updated_unix_time"`
+}
+
+// Fail2banJail 单个 jail 的开关与阈值：FindTimeSeconds 内失败 MaxRetry 次即封禁 BanTimeSeconds 秒
+type Fail2banJail struct {
+	Name            string `json:"name"` // nginx-mgr-auth、nginx-mgr-badbots 或 nginx-mgr-limit-req
+	Enabled         bool   `json:"enabled"`
+	MaxRetry        int    `json:"max_retry"`
+	FindTimeSeconds int    `json:"find_time_seconds"`
+	BanTimeSeconds  int    `json:"ban_time_seconds"`
+}
+
+// Fail2banStatus fail2ban 的安装与运行情况以及各 jail 的当前封禁
+type Fail2banStatus struct {
+	Installed bool                 `json:"installed"`
+	Running   bool                 `json:"running"`
+	JailPath  string               `json:"jail_path"`
+	Jails     []Fail2banJailStatus `json:"jails"`
+}
+
+// Fail2banJailStatus jail 的设置与 fail2ban-client status 的输出，Active 表示 fail2ban 已加载该 jail
+type Fail2banJailStatus struct {
+	Fail2banJail
+	Description     string   `json:"description"`
+	Active          bool     `json:"active"`
+	CurrentlyFailed int      `json:"currently_failed"`
+	TotalBanned     int      `json:"total_banned"`
+	BannedIPs       []string `json:"banned_ips"`
+}
@@ -0,0 +1,34 @@
+package model
+
+// FirewallSettings 站点与四层转发端口的防火墙联动。开启后每次新增、删除、启停站点或转发规则，
+// 面板都会放行仍在使用的端口并关闭不再使用的端口；关闭联动时保留已放行的规则
+type FirewallSettings struct {
+	Enabled             bool   `json:"enabled"`
+	Backend             string `json:"backend"` // auto、ufw、firewalld 或 nftables
+	LastUpdatedUnixTime int64  `json:"last_updated_unix_time"`
+}
+
+// FirewallPort 一个端口与协议（tcp 或 udp）
+type FirewallPort struct {
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// FirewallRule 面板放行的端口。Owners 为使用该端口的站点（site:<domain>）或转发规则（stream:<name>），
+// Preexisting 表示放行前防火墙已允许该端口，不再使用时也不会关闭
+type FirewallRule struct {
+	FirewallPort
+	Backend         string   `json:"backend"`
+	Owners          []string `json:"owners"`
+	Preexisting     bool     `json:"preexisting"`
+	CreatedUnixTime int64    `json:"created_unix_time"`
+}
+
+// FirewallStatus 联动设置、检测到的防火墙与面板维护的规则
+type FirewallStatus struct {
+	FirewallSettings
+	Active           string         `json:"active"` // 当前生效的防火墙，未检测到时为空
+	Rules            []FirewallRule `json:"rules"`
+	LastSyncUnixTime int64          `json:"last_sync_unix_time"`
+	LastError        string         `json:"last_error,omitempty"`
+}
@@ -0,0 +1,10 @@
+package model
+
+// GeoIPStatus 当前使用的 GeoIP 数据库，Available 为 false 时访问统计不做地区归属
+type GeoIPStatus struct {
+	Available     bool   `json:"available"`
+	Path          string `json:"path"`
+	DatabaseType  string `json:"database_type"` // 如 GeoLite2-Country、GeoLite2-City
+	BuildUnixTime int64  `json:"build_unix_time"`
+	Error         string `json:"error,omitempty"`
+}
@@ -0,0 +1,20 @@
+package model
+
+// GlobalTuning nginx.conf 中常用的全局参数，保存后写入面板维护的 include 文件
+type GlobalTuning struct {
+	WorkerProcesses           string   `json:"worker_processes"` // auto 或进程数
+	WorkerConnections         int      `json:"worker_connections"`
+	KeepaliveTimeout          int      `json:"keepalive_timeout"`             // 秒，0 表示关闭长连接
+	ServerNamesHashBucketSize int      `json:"server_names_hash_bucket_size"` // 2 的幂，域名较长时需要调大
+	Gzip                      bool     `json:"gzip"`
+	GzipCompLevel             int      `json:"gzip_comp_level"` // 1-9
+	GzipMinLength             int      `json:"gzip_min_length"` // 字节
+	GzipTypes                 []string `json:"gzip_types"`
+	LastUpdatedUnixTime       int64    `json:"last_updated_unix_time"`
+}
+
+// GlobalTuningStatus 当前参数以及面板是否已经接管 nginx.conf 中的对应指令
+type GlobalTuningStatus struct {
+	GlobalTuning
+	Managed bool `json:"managed"`
+}
@@ -0,0 +1,24 @@
+package model
+
+type HealthCheckSettings struct {
+	Enabled         bool   `json:"enabled"`
+	IntervalSeconds int    `json:"interval_seconds"`
+	TimeoutSeconds  int    `json:"timeout_seconds"`
+	Mode            string `json:"mode"`      // tcp, http
+	HTTPPath        string `json:"http_path"` // For http mode
+	FailThreshold   int    `json:"fail_threshold"`
+	RiseThreshold   int    `json:"rise_threshold"`
+	AutoEject       bool   `json:"auto_eject"`
+}
+
+type UpstreamHealth struct {
+	Site             string `json:"site"`
+	Address          string `json:"address"`
+	Healthy          bool   `json:"healthy"`
+	Ejected          bool   `json:"ejected"`
+	ConsecutiveFails int    `json:"consecutive_fails"`
+	ConsecutiveOKs   int    `json:"consecutive_oks"`
+	LatencyMs        int64  `json:"latency_ms"`
+	LastError        string `json:"last_error,omitempty"`
+	LastCheck        string `json:"last_check"`
+}
@@ -0,0 +1,19 @@
+package model
+
+// HostInfo 面板所在主机的基本信息
+type HostInfo struct {
+	Hostname         string `json:"hostname"`
+	OS               string `json:"os"` // /etc/os-release 的 PRETTY_NAME，如 Ubuntu 24.04 LTS
+	OSID             string `json:"os_id"`
+	OSVersion        string `json:"os_version"`
+	Kernel           string `json:"kernel"`
+	Arch             string `json:"arch"`
+	UptimeSeconds    int64  `json:"uptime_seconds"`
+	BootUnixTime     int64  `json:"boot_unix_time"`
+	CPUModel         string `json:"cpu_model"`
+	CPUCores         int    `json:"cpu_cores"` // 逻辑 CPU 数
+	MemoryTotalBytes uint64 `json:"memory_total_bytes"`
+	SwapTotalBytes   uint64 `json:"swap_total_bytes"`
+	// Virtualization 虚拟化或容器类型，如 kvm、vmware、lxc、docker，物理机为 none，无法判断时为空
+	Virtualization string `json:"virtualization"`
+}
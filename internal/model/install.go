@@ -0,0 +1,43 @@
+package model
+
+const (
+	InstallMethodSource  = "source"  // 下载源码编译安装
+	InstallMethodPackage = "package" // 通过 apt/dnf/yum 安装软件包
+
+	InstallSourceDistro   = "distro"    // 发行版自带的软件源
+	InstallSourceNginxOrg = "nginx.org" // nginx.org 官方软件源，包含 ACME 模块
+)
+
+// InstallRequest 安装 Nginx 的方式，均为空时编译安装面板内置的版本
+type InstallRequest struct {
+	Method string `json:"method"`           // source 或 package，旧版的 script 视为 source
+	Source string `json:"source,omitempty"` // 仅 package 方式使用，默认 distro
+	// Offline 离线安装：只使用 ArtifactDir 中预先下载的源码包或软件包，不访问外网
+	Offline     bool   `json:"offline,omitempty"`
+	ArtifactDir string `json:"artifact_dir,omitempty"` // 默认 /root/nginx-mgr-offline，指定时视为离线安装
+	// Version 与 Modules 仅 source 方式使用，ACME 模块始终包含
+	Version string   `json:"version,omitempty"`
+	Modules []string `json:"modules,omitempty"`
+}
+
+// InstallManifest 面板安装 Nginx 时记录的安装方式、软件包与额外写入的文件，卸载时据此清理
+type InstallManifest struct {
+	Method            string   `json:"method"`
+	Source            string   `json:"source,omitempty"`
+	Version           string   `json:"version,omitempty"`
+	Packages          []string `json:"packages,omitempty"`
+	Files             []string `json:"files,omitempty"` // 软件源配置、签名密钥等
+	InstalledUnixTime int64    `json:"installed_unix_time"`
+}
+
+// UninstallPlan 卸载时将停止的服务、移除的软件包与删除的文件，Kept 为保留不动的目录
+type UninstallPlan struct {
+	Method   string   `json:"method"` // source、package，没有安装记录时为 unknown
+	Services []string `json:"services"`
+	Packages []string `json:"packages"`
+	Files    []string `json:"files"`
+	Kept     []string `json:"kept"`
+	// ConfirmToken 仅预览时返回，执行卸载时需原样提交；过期或计划变化后需重新预览
+	ConfirmToken           string `json:"confirm_token,omitempty"`
+	ConfirmExpiresUnixTime int64  `json:"confirm_expires_unix_time,omitempty"`
+}
@@ -0,0 +1,42 @@
+package model
+
+// LogShippingSettings 把站点访问日志与错误日志转发到远程 syslog 或 Grafana Loki
+type LogShippingSettings struct {
+	Enabled       bool              `json:"enabled"`
+	Target        string            `json:"target"` // syslog 或 loki
+	IncludeAccess bool              `json:"include_access"`
+	IncludeError  bool              `json:"include_error"`
+	Syslog        SyslogShipping    `json:"syslog"`
+	Loki          LokiShipping      `json:"loki"`
+	Labels        map[string]string `json:"labels"` // 附加的标签，syslog 写入结构化数据
+	// Hostname 日志来源主机名，留空时使用系统主机名
+	Hostname            string `json:"hostname,omitempty"`
+	LastUpdatedUnixTime int64  `json:"last_updated_unix_time"`
+}
+
+// SyslogShipping RFC 5424 格式的 syslog 目标，TCP 按换行分隔消息
+type SyslogShipping struct {
+	Address  string `json:"address"`  // host:port
+	Protocol string `json:"protocol"` // udp 或 tcp
+	Facility int    `json:"facility"` // 默认 16（local0）
+}
+
+// LokiShipping Loki push API，URL 为服务地址（如 https://loki.example.com），推送到 /loki/api/v1/push
+type LokiShipping struct {
+	URL         string `json:"url"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"` // 查询时不返回，保存时留空表示不修改
+	HasPassword bool   `json:"has_password"`
+	TenantID    string `json:"tenant_id,omitempty"` // 多租户时写入 X-Scope-OrgID
+}
+
+// LogShippingStatus 转发配置与最近一次推送的结果
+type LogShippingStatus struct {
+	LogShippingSettings
+	ShippedLines      int64  `json:"shipped_lines"`
+	DroppedLines      int64  `json:"dropped_lines"` // 推送失败且积压超过上限后丢弃的行数
+	PendingLines      int    `json:"pending_lines"` // 等待重试的行数
+	LastShipUnixTime  int64  `json:"last_ship_unix_time"`
+	LastErrorUnixTime int64  `json:"last_error_unix_time,omitempty"`
+	LastError         string `json:"last_error,omitempty"`
+}
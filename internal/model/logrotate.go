@@ -0,0 +1,19 @@
+package model
+
+// LogRotateSettings 站点访问日志与错误日志的轮转规则，写入 logrotate 配置后由系统的 logrotate 定时执行
+type LogRotateSettings struct {
+	Enabled             bool   `json:"enabled"`
+	Frequency           string `json:"frequency"`    // daily、weekly 或 monthly
+	MaxSizeMB           int    `json:"max_size_mb"`  // 超过该大小时不等周期到达即轮转，0 表示不按大小
+	Rotate              int    `json:"rotate"`       // 保留的历史日志份数
+	MaxAgeDays          int    `json:"max_age_days"` // 删除早于该天数的历史日志，0 表示只按份数保留
+	Compress            bool   `json:"compress"`
+	LastUpdatedUnixTime int64  `json:"last_updated_unix_time"`
+}
+
+// LogRotateStatus 轮转规则与 logrotate 的安装情况
+type LogRotateStatus struct {
+	LogRotateSettings
+	Installed  bool   `json:"installed"`
+	ConfigPath string `json:"config_path"`
+}
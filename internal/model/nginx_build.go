@@ -0,0 +1,11 @@
+package model
+
+// NginxBuildModules 编译安装时可选的动态模块，acme 为站点自动申请证书所需，编译安装时始终包含
+var NginxBuildModules = []string{"stream", "acme", "brotli", "headers-more", "njs", "geoip2"}
+
+// NginxBuildProfile 编译安装使用的 Nginx 版本与动态模块，之后升级时按同样的模块重新编译
+type NginxBuildProfile struct {
+	Version             string   `json:"version"`
+	Modules             []string `json:"modules"`
+	LastUpdatedUnixTime int64    `json:"last_updated_unix_time,omitempty"`
+}
@@ -0,0 +1,36 @@
+package model
+
+// NginxConfigDump nginx -T 的输出，按文件拆分。Raw 为完整输出，Messages 为 nginx 输出到 stderr 的测试信息
+type NginxConfigDump struct {
+	Files    []NginxConfigFile `json:"files"`
+	Raw      string            `json:"raw"`
+	Messages string            `json:"messages"`
+}
+
+// NginxConfigFile nginx 实际加载的一个配置文件
+type NginxConfigFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// NginxConfigTest nginx -t 的结果，Issues 为从输出中解析出的错误与警告
+type NginxConfigTest struct {
+	OK     bool               `json:"ok"`
+	Issues []NginxConfigIssue `json:"issues"`
+	Output string             `json:"output"`
+}
+
+// NginxConfigIssue nginx -t 输出的一条问题，File 与 Line 在 nginx 未给出位置时为空
+type NginxConfigIssue struct {
+	Level   string `json:"level"` // emerg、alert、crit、error、warn 等
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// NginxConfEntry 可在面板中编辑的全局配置文件，Path 相对于 Nginx 配置目录
+type NginxConfEntry struct {
+	Path         string `json:"path"`
+	Size         int64  `json:"size"`
+	ModifiedUnix int64  `json:"modified_unix"`
+}
@@ -0,0 +1,23 @@
+package model
+
+// NginxProcesses nginx 主进程与工作进程的运行情况
+type NginxProcesses struct {
+	MasterPID        int                `json:"master_pid"` // 取自 pid 文件，读取失败时为 0
+	Processes        []NginxProcessInfo `json:"processes"`
+	TotalConnections int                `json:"total_connections"`
+	SampledUnixTime  int64              `json:"sampled_unix_time"`
+}
+
+// NginxProcessInfo 单个 nginx 进程。CPUPercent 为采样间隔内的占用（单核 100%），
+// Connections 为该进程持有的 ESTABLISHED TCP 连接数
+type NginxProcessInfo struct {
+	PID           int     `json:"pid"`
+	PPID          int     `json:"ppid"`
+	Role          string  `json:"role"`  // master、worker、cache manager、cache loader
+	State         string  `json:"state"` // /proc/<pid>/stat 中的进程状态，如 R、S、D、Z
+	ShuttingDown  bool    `json:"shutting_down"`
+	CPUPercent    float64 `json:"cpu_percent"`
+	RSSBytes      uint64  `json:"rss_bytes"`
+	UptimeSeconds int64   `json:"uptime_seconds"`
+	Connections   int     `json:"connections"`
+}
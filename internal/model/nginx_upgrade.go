@@ -0,0 +1,16 @@
+package model
+
+// NginxUpgradeStatus 最近一次 Nginx 升级任务的进度与结果
+type NginxUpgradeStatus struct {
+	Running          bool     `json:"running"`
+	Success          bool     `json:"success"`
+	Mode             string   `json:"mode,omitempty"` // hot（USR2/WINCH 平滑切换）或 restart
+	FromVersion      string   `json:"from_version,omitempty"`
+	ToVersion        string   `json:"to_version,omitempty"`
+	Modules          []string `json:"modules,omitempty"` // 本次编译的动态模块
+	RolledBack       bool     `json:"rolled_back"`
+	Error            string   `json:"error,omitempty"`
+	StartedUnixTime  int64    `json:"started_unix_time,omitempty"`
+	FinishedUnixTime int64    `json:"finished_unix_time,omitempty"`
+	Logs             []string `json:"logs"`
+}
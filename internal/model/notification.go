@@ -1,26 +1,146 @@
 package model
 
+// 以下渠道设置中的 Has* 字段只用于查询：密钥与含令牌的地址不返回，仅标记是否已保存，
+// 保存时留空表示沿用原值
+
 type DingTalkSettings struct {
-	Enabled bool   `json:"enabled"`
-	Webhook string `json:"webhook"`
-	Secret  string `json:"secret"`
+	Enabled    bool   `json:"enabled"`
+	Webhook    string `json:"webhook"`
+	Secret     string `json:"secret"`
+	HasWebhook bool   `json:"has_webhook,omitempty"`
+	HasSecret  bool   `json:"has_secret,omitempty"`
 }
 
 type TelegramSettings struct {
-	Enabled  bool   `json:"enabled"`
-	BotToken string `json:"bot_token"`
-	ChatID   string `json:"chat_id"`
+	Enabled     bool   `json:"enabled"`
+	BotToken    string `json:"bot_token"`
+	ChatID      string `json:"chat_id"`
+	HasBotToken bool   `json:"has_bot_token,omitempty"`
+}
+
+// WeComSettings 企业微信群机器人 Webhook
+type WeComSettings struct {
+	Enabled    bool   `json:"enabled"`
+	Webhook    string `json:"webhook"`
+	HasWebhook bool   `json:"has_webhook,omitempty"`
+}
+
+// SlackSettings Slack Incoming Webhook
+type SlackSettings struct {
+	Enabled    bool   `json:"enabled"`
+	Webhook    string `json:"webhook"`
+	HasWebhook bool   `json:"has_webhook,omitempty"`
+}
+
+// DiscordSettings Discord 频道 Webhook
+type DiscordSettings struct {
+	Enabled    bool   `json:"enabled"`
+	Webhook    string `json:"webhook"`
+	HasWebhook bool   `json:"has_webhook,omitempty"`
+}
+
+// BarkSettings Bark iOS 推送，Server 可填写自建服务地址
+type BarkSettings struct {
+	Enabled      bool   `json:"enabled"`
+	Server       string `json:"server"`
+	DeviceKey    string `json:"device_key"`
+	HasDeviceKey bool   `json:"has_device_key,omitempty"`
+}
+
+// ServerChanSettings Server酱推送，支持 Turbo 版与 Server酱³ 的 SendKey
+type ServerChanSettings struct {
+	Enabled    bool   `json:"enabled"`
+	SendKey    string `json:"send_key"`
+	HasSendKey bool   `json:"has_send_key,omitempty"`
+}
+
+// WebhookSettings 通用 Webhook，以 JSON 推送告警；配置 Secret 时附带 HMAC-SHA256 签名。
+// 查询时请求头只返回名称，值为空
+type WebhookSettings struct {
+	Enabled   bool              `json:"enabled"`
+	URL       string            `json:"url"`
+	Method    string            `json:"method"` // POST 或 PUT，默认 POST
+	Secret    string            `json:"secret"`
+	Headers   map[string]string `json:"headers"`
+	HasSecret bool              `json:"has_secret,omitempty"`
+}
+
+// NginxWatchdogSettings Nginx 停止告警，AutoRestart 时对异常退出的 Nginx 自动执行重启
+type NginxWatchdogSettings struct {
+	Enabled     bool `json:"enabled"`
+	AutoRestart bool `json:"auto_restart"`
+}
+
+// ErrorRateAlertSettings 站点 5xx 错误率告警，在 WindowMinutes 分钟内请求数不少于 MinRequests 且
+// 5xx 比例达到 Threshold（%）时告警
+type ErrorRateAlertSettings struct {
+	Enabled       bool `json:"enabled"`
+	Threshold     int  `json:"threshold"`
+	WindowMinutes int  `json:"window_minutes"`
+	MinRequests   int  `json:"min_requests"`
+}
+
+// LatencyAlertSettings 站点延迟告警，在 WindowMinutes 分钟内带耗时的请求数不少于 MinRequests 且
+// 第 Percentile 百分位的请求耗时达到 ThresholdMs 毫秒时告警，需站点使用 main_timing 或 main_json 日志格式
+type LatencyAlertSettings struct {
+	Enabled       bool `json:"enabled"`
+	Percentile    int  `json:"percentile"` // 50, 95, 99
+	ThresholdMs   int  `json:"threshold_ms"`
+	WindowMinutes int  `json:"window_minutes"`
+	MinRequests   int  `json:"min_requests"`
+}
+
+// TrafficLimitActionSettings 周期流量超过月流量上限后执行的动作：
+// limit_rate 全局限速、stop_nginx 停止 Nginx、disable_sites 停用 Sites 中的站点，留空只发送告警
+type TrafficLimitActionSettings struct {
+	Action    string   `json:"action"`
+	LimitRate string   `json:"limit_rate"`
+	Sites     []string `json:"sites"`
+}
+
+// DailyDigestSettings 每日运行日报，Time 为服务器本地时间 HH:MM
+type DailyDigestSettings struct {
+	Enabled bool   `json:"enabled"`
+	Time    string `json:"time"`
+}
+
+// NotificationProxySettings 发送通知使用的出站代理，支持 http、https、socks5 与 socks5h；
+// Channels 为空时所有渠道都走代理，否则只有列出的渠道走代理
+type NotificationProxySettings struct {
+	URL      string   `json:"url"`
+	Channels []string `json:"channels"`
+}
+
+// BackupNotifySettings 定时备份结果通知，成功与失败分别开关
+type BackupNotifySettings struct {
+	OnSuccess bool `json:"on_success"`
+	OnFailure bool `json:"on_failure"`
 }
 
 type NotificationSettings struct {
-	TrafficThreshold    int              `json:"traffic_threshold"`
-	ServerExpiryDate    string           `json:"server_expiry_date"`
-	ExpiryNotifyDays    int              `json:"expiry_notify_days"`
-	DingTalk            DingTalkSettings `json:"dingtalk"`
-	Telegram            TelegramSettings `json:"telegram"`
-	ServerLabel         string           `json:"server_label"`
-	MonthlyTrafficLimit float64          `json:"traffic_monthly_limit_gb"`
-	LastUpdatedUnixTime int64            `json:"last_updated_unix_time"`
+	TrafficThreshold    int                        `json:"traffic_threshold"`
+	DiskThreshold       int                        `json:"disk_threshold"` // 磁盘使用率告警阈值（%），0 表示关闭
+	ServerExpiryDate    string                     `json:"server_expiry_date"`
+	ExpiryNotifyDays    int                        `json:"expiry_notify_days"`
+	DingTalk            DingTalkSettings           `json:"dingtalk"`
+	Telegram            TelegramSettings           `json:"telegram"`
+	WeCom               WeComSettings              `json:"wecom"`
+	Slack               SlackSettings              `json:"slack"`
+	Discord             DiscordSettings            `json:"discord"`
+	Bark                BarkSettings               `json:"bark"`
+	ServerChan          ServerChanSettings         `json:"serverchan"`
+	Webhook             WebhookSettings            `json:"webhook"`
+	Backup              BackupNotifySettings       `json:"backup"`
+	NginxWatchdog       NginxWatchdogSettings      `json:"nginx_watchdog"`
+	ErrorRate           ErrorRateAlertSettings     `json:"error_rate"`
+	Latency             LatencyAlertSettings       `json:"latency"`
+	DailyDigest         DailyDigestSettings        `json:"daily_digest"`
+	Proxy               NotificationProxySettings  `json:"proxy"`
+	Routes              map[string][]string        `json:"routes"` // 事件类型 → 渠道列表，未配置的事件发送到全部已启用渠道
+	ServerLabel         string                     `json:"server_label"`
+	MonthlyTrafficLimit float64                    `json:"traffic_monthly_limit_gb"`
+	TrafficLimitAction  TrafficLimitActionSettings `json:"traffic_limit_action"`
+	LastUpdatedUnixTime int64                      `json:"last_updated_unix_time"`
 }
 
 type NetworkTraffic struct {
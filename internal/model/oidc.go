@@ -0,0 +1,18 @@
+package model
+
+// OIDCSettings 外部 OIDC 身份提供方（Keycloak、Authentik、Google 等）的单点登录配置
+type OIDCSettings struct {
+	Enabled             bool              `json:"enabled"`
+	DisplayName         string            `json:"display_name,omitempty"` // 登录页按钮上显示的名称
+	Issuer              string            `json:"issuer"`
+	ClientID            string            `json:"client_id"`
+	ClientSecret        string            `json:"client_secret,omitempty"` // 查询时不返回，保存时留空表示不修改
+	HasClientSecret     bool              `json:"has_client_secret"`
+	RedirectURL         string            `json:"redirect_url,omitempty"` // 留空时按请求地址生成 /api/v1/auth/oidc/callback
+	Scopes              []string          `json:"scopes"`
+	UsernameClaim       string            `json:"username_claim"`
+	GroupsClaim         string            `json:"groups_claim"`
+	GroupRoles          map[string]string `json:"group_roles"`            // 提供方分组 -> 面板角色，匹配多个时取权限最高者
+	DefaultRole         string            `json:"default_role,omitempty"` // 没有匹配分组时的角色，留空则拒绝登录
+	LastUpdatedUnixTime int64             `json:"last_updated_unix_time"`
+}
@@ -0,0 +1,7 @@
+package model
+
+// PanelAccessSettings 管理面板的来源 IP 白名单，为空时不限制
+type PanelAccessSettings struct {
+	AllowedCIDRs        []string `json:"allowed_cidrs"` // 如 10.8.0.0/24、203.0.113.7
+	LastUpdatedUnixTime int64    `json:"last_updated_unix_time"`
+}
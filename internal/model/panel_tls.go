@@ -0,0 +1,11 @@
+package model
+
+// PanelTLSSettings 管理面板自身的 HTTPS 配置，修改后需重启面板生效
+type PanelTLSSettings struct {
+	Mode                string `json:"mode"`                // off, custom, self_signed, acme
+	CertFile            string `json:"cert_file,omitempty"` // custom 模式使用的证书与私钥
+	KeyFile             string `json:"key_file,omitempty"`
+	Domain              string `json:"domain,omitempty"`         // acme 模式下证书需覆盖的面板域名
+	ACMEStateDir        string `json:"acme_state_dir,omitempty"` // nginx-acme 保存证书的目录
+	LastUpdatedUnixTime int64  `json:"last_updated_unix_time"`
+}
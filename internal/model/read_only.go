@@ -0,0 +1,10 @@
+package model
+
+// ReadOnlySettings 面板只读（维护）锁，开启后拒绝所有写操作
+type ReadOnlySettings struct {
+	Enabled             bool   `json:"enabled"`
+	Reason              string `json:"reason,omitempty"`
+	EnabledBy           string `json:"enabled_by,omitempty"`
+	ForcedByEnv         bool   `json:"forced_by_env"` // 由环境变量 NGINX_MGR_READ_ONLY 开启，无法通过接口关闭
+	LastUpdatedUnixTime int64  `json:"last_updated_unix_time"`
+}
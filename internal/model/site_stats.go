@@ -0,0 +1,118 @@
+package model
+
+// SiteStatsPoint 站点在一个小时或一天内的访问汇总
+type SiteStatsPoint struct {
+	StartUnixTime int64 `json:"start_unix_time"`
+	Requests      int64 `json:"requests"`
+	Bytes         int64 `json:"bytes"`
+	UniqueIPs     int   `json:"unique_ips"`
+	// Countries 按国家代码的请求数，只在有 GeoIP 数据库时记录，"-" 表示无法归属
+	Countries map[string]int64 `json:"countries,omitempty"`
+}
+
+type SiteStats struct {
+	Domain      string               `json:"domain"`
+	Granularity string               `json:"granularity"` // hour, day
+	Points      []SiteStatsPoint     `json:"points"`
+	Requests    int64                `json:"requests"`
+	Bytes       int64                `json:"bytes"`
+	Countries   []SiteAnalyticsEntry `json:"countries"`
+	GeoIP       bool                 `json:"geoip"` // 是否有可用的 GeoIP 数据库
+}
+
+type SiteAnalyticsEntry struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// SiteAnalytics 一段时间内按 IP、URI、状态码与 UA 的请求排行
+type SiteAnalytics struct {
+	Domain       string               `json:"domain"`
+	FromUnixTime int64                `json:"from_unix_time"`
+	ToUnixTime   int64                `json:"to_unix_time"`
+	Requests     int64                `json:"requests"`
+	IPs          []SiteAnalyticsEntry `json:"ips"`
+	URIs         []SiteAnalyticsEntry `json:"uris"`
+	StatusCodes  []SiteAnalyticsEntry `json:"status_codes"`
+	UserAgents   []SiteAnalyticsEntry `json:"user_agents"`
+	Countries    []SiteAnalyticsEntry `json:"countries"`
+	Regions      []SiteAnalyticsEntry `json:"regions"` // 国家代码-省份代码，需 City 数据库
+	GeoIP        bool                 `json:"geoip"`
+	Approximate  []string             `json:"approximate"` // 这些维度在部分小时内只保留了排名靠前的取值，排行为近似值
+	Latency      []SiteLatency        `json:"latency"`     // 最近 1h/24h/7d 的延迟分位数，与 from/to 无关
+}
+
+// SiteLatency 一个时间窗口内的请求耗时与后端响应耗时分位数（毫秒），需站点使用 main_timing 或 main_json 日志格式
+type SiteLatency struct {
+	Window          string  `json:"window"`
+	Samples         int64   `json:"samples"`
+	P50Ms           float64 `json:"p50_ms"`
+	P95Ms           float64 `json:"p95_ms"`
+	P99Ms           float64 `json:"p99_ms"`
+	UpstreamSamples int64   `json:"upstream_samples"`
+	UpstreamP50Ms   float64 `json:"upstream_p50_ms"`
+	UpstreamP95Ms   float64 `json:"upstream_p95_ms"`
+	UpstreamP99Ms   float64 `json:"upstream_p99_ms"`
+}
+
+// SiteTrafficUsage 站点在当前流量周期内的请求数与响应流量（$body_bytes_sent）
+type SiteTrafficUsage struct {
+	Domain   string  `json:"domain"`
+	Requests int64   `json:"requests"`
+	Bytes    int64   `json:"bytes"`
+	Percent  float64 `json:"percent"` // 占周期网卡总用量的百分比
+}
+
+// TrafficSiteBreakdown 按站点拆分的流量周期用量
+type TrafficSiteBreakdown struct {
+	CycleStartUnixTime int64              `json:"cycle_start_unix_time"`
+	NextResetUnixTime  int64              `json:"next_reset_unix_time"`
+	UsedBytes          uint64             `json:"used_bytes"`
+	LimitBytes         uint64             `json:"limit_bytes"`
+	SiteBytes          int64              `json:"site_bytes"`
+	OtherBytes         int64              `json:"other_bytes"` // 无法归属到站点的部分，如入站流量、端口转发与其他程序
+	Sites              []SiteTrafficUsage `json:"sites"`
+}
+
+// GoAccessReport 由 GoAccess 生成的站点访问报告
+type GoAccessReport struct {
+	Domain            string   `json:"domain"`
+	GeneratedUnixTime int64    `json:"generated_unix_time"`
+	SizeBytes         int64    `json:"size_bytes"`
+	Logs              []string `json:"logs"` // 参与分析的日志文件
+}
+
+// SiteErrorEntry 解析后的一条 nginx 错误日志，Client 等字段来自消息末尾的上下文
+type SiteErrorEntry struct {
+	UnixTime   int64  `json:"unix_time"`
+	Level      string `json:"level"`
+	PID        int    `json:"pid"`
+	Connection int64  `json:"connection,omitempty"`
+	Message    string `json:"message"`
+	Client     string `json:"client,omitempty"`
+	Server     string `json:"server,omitempty"`
+	Request    string `json:"request,omitempty"`
+	Upstream   string `json:"upstream,omitempty"`
+	Host       string `json:"host,omitempty"`
+}
+
+// SiteErrorGroup 级别、消息模式与后端都相同的一组错误，Sample 为最近的一条
+type SiteErrorGroup struct {
+	Level         string         `json:"level"`
+	Pattern       string         `json:"pattern"`
+	Upstream      string         `json:"upstream,omitempty"`
+	Count         int64          `json:"count"`
+	FirstUnixTime int64          `json:"first_unix_time"`
+	LastUnixTime  int64          `json:"last_unix_time"`
+	Sample        SiteErrorEntry `json:"sample"`
+}
+
+type SiteErrorSummary struct {
+	Domain       string           `json:"domain"`
+	FromUnixTime int64            `json:"from_unix_time"`
+	ToUnixTime   int64            `json:"to_unix_time"`
+	Total        int64            `json:"total"`
+	Levels       map[string]int64 `json:"levels"`
+	Groups       []SiteErrorGroup `json:"groups"`
+	Truncated    bool             `json:"truncated"` // 日志过大，只分析了末尾部分
+}
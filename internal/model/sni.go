@@ -0,0 +1,15 @@
+package model
+
+// SNIRoute 按 TLS ClientHello 中的 SNI 主机名转发到指定后端
+type SNIRoute struct {
+	Hostname string `json:"hostname"` // 支持 *.example.com 与 .example.com
+	Target   string `json:"target"`   // IP:PORT
+}
+
+// SNIConfig 基于 ssl_preread 的 TLS 透传路由，多个 TLS 服务可共享同一端口而不终止 TLS
+type SNIConfig struct {
+	Name       string     `json:"name"`
+	ListenPort int        `json:"listen_port"`
+	Routes     []SNIRoute `json:"routes"`
+	Default    string     `json:"default,omitempty"` // 未匹配时的后端，为空则直接断开
+}
@@ -0,0 +1,16 @@
+package model
+
+// StreamStatsWindow 某个时间窗口内的转发统计
+type StreamStatsWindow struct {
+	Window        string  `json:"window"` // 5m, 1h, 24h
+	Connections   int     `json:"connections"`
+	Failed        int     `json:"failed"` // 状态码非 200 的会话
+	BytesSent     int64   `json:"bytes_sent"`
+	BytesReceived int64   `json:"bytes_received"`
+	AvgSessionSec float64 `json:"avg_session_sec"`
+}
+
+type StreamStats struct {
+	Name    string              `json:"name"`
+	Windows []StreamStatsWindow `json:"windows"`
+}
@@ -0,0 +1,12 @@
+package model
+
+// StubStatus ngx_http_stub_status_module 输出的连接与请求计数
+type StubStatus struct {
+	ActiveConnections int64 `json:"active_connections"`
+	Accepts           int64 `json:"accepts"`
+	Handled           int64 `json:"handled"`
+	Requests          int64 `json:"requests"`
+	Reading           int64 `json:"reading"`
+	Writing           int64 `json:"writing"`
+	Waiting           int64 `json:"waiting"`
+}
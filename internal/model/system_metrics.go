@@ -0,0 +1,45 @@
+package model
+
+// SystemMetricsPoint 一个采样周期内的系统负载，网络速率为周期内的平均值
+type SystemMetricsPoint struct {
+	UnixTime      int64   `json:"unix_time"`
+	CPUPercent    float64 `json:"cpu_percent"`
+	MemUsedBytes  uint64  `json:"mem_used_bytes"`
+	MemTotalBytes uint64  `json:"mem_total_bytes"`
+	Load1         float64 `json:"load1"`
+	Load5         float64 `json:"load5"`
+	Load15        float64 `json:"load15"`
+	RXBytesPerSec float64 `json:"rx_bytes_per_sec"`
+	TXBytesPerSec float64 `json:"tx_bytes_per_sec"`
+	// stub_status 计数：活动连接为采样时的值，其余为相邻两次采样间的每秒增量；未配置 stub_status 时为 0
+	NginxActiveConnections float64 `json:"nginx_active_connections"`
+	NginxAcceptsPerSec     float64 `json:"nginx_accepts_per_sec"`
+	NginxHandledPerSec     float64 `json:"nginx_handled_per_sec"`
+	NginxRequestsPerSec    float64 `json:"nginx_requests_per_sec"`
+}
+
+type SystemMetrics struct {
+	RangeSeconds int64                `json:"range_seconds"`
+	StepSeconds  int64                `json:"step_seconds"`
+	StubStatus   bool                 `json:"stub_status"` // 是否已配置 stub_status，未配置时采样中不含 Nginx 连接与请求数
+	Points       []SystemMetricsPoint `json:"points"`
+}
+
+// InterfaceTrafficEntry 网卡在一天（2006-01-02）或一个月（2006-01）内的收发字节数
+type InterfaceTrafficEntry struct {
+	Period     string `json:"period"`
+	RXBytes    uint64 `json:"rx_bytes"`
+	TXBytes    uint64 `json:"tx_bytes"`
+	TotalBytes uint64 `json:"total_bytes"`
+}
+
+type InterfaceTrafficHistory struct {
+	Interface string                  `json:"interface"`
+	Days      []InterfaceTrafficEntry `json:"days"`
+	Months    []InterfaceTrafficEntry `json:"months"`
+}
+
+type TrafficHistory struct {
+	UpdatedUnixTime int64                     `json:"updated_unix_time"`
+	Interfaces      []InterfaceTrafficHistory `json:"interfaces"`
+}
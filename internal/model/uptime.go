@@ -0,0 +1,41 @@
+package model
+
+// UptimeSettings 站点可用性监测，定期请求各启用站点的 https://域名/路径
+type UptimeSettings struct {
+	Enabled             bool                          `json:"enabled"`
+	IntervalSeconds     int                           `json:"interval_seconds"`
+	TimeoutSeconds      int                           `json:"timeout_seconds"`
+	FailThreshold       int                           `json:"fail_threshold"` // 连续失败达到该次数时告警
+	Sites               map[string]UptimeSiteSettings `json:"sites"`          // 按域名覆盖默认的探测路径与期望状态码
+	LastUpdatedUnixTime int64                         `json:"last_updated_unix_time"`
+}
+
+type UptimeSiteSettings struct {
+	Disabled       bool   `json:"disabled"`
+	Path           string `json:"path"`            // 默认为 /
+	ExpectedStatus int    `json:"expected_status"` // 0 表示 2xx 与 3xx 均视为正常
+}
+
+// UptimeCheck 一次探测的结果
+type UptimeCheck struct {
+	UnixTime  int64  `json:"unix_time"`
+	Up        bool   `json:"up"`
+	Status    int    `json:"status,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// UptimeSiteStatus 站点的当前状态与可用率，可用率为探测成功次数占比（%），没有探测记录时为 -1
+type UptimeSiteStatus struct {
+	Domain            string        `json:"domain"`
+	URL               string        `json:"url"`
+	Monitored         bool          `json:"monitored"`
+	Up                bool          `json:"up"`
+	ConsecutiveFails  int           `json:"consecutive_fails"`
+	DownSinceUnixTime int64         `json:"down_since_unix_time,omitempty"`
+	LastCheck         *UptimeCheck  `json:"last_check,omitempty"`
+	Availability24h   float64       `json:"availability_24h"`
+	Availability7d    float64       `json:"availability_7d"`
+	AvgLatencyMs24h   int64         `json:"avg_latency_ms_24h"`
+	Recent            []UptimeCheck `json:"recent"`
+}
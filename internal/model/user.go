@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// 面板角色：admin 拥有全部权限；operator 可管理站点与转发，但不能安装、卸载、恢复备份或管理账号；viewer 只读
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+)
+
+// Session 账号的一个登录会话，不包含令牌本身
+type Session struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Current   bool      `json:"current"` // 是否为发起查询的会话
+}
+
+// User 面板登录账号，不包含密码哈希等敏感字段
+type User struct {
+	Username    string    `json:"username"`
+	Role        string    `json:"role"`
+	TOTPEnabled bool      `json:"totp_enabled"`
+	Source      string    `json:"source,omitempty"` // 单点登录创建的账号为 oidc，本地账号为空
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at,omitempty"`
+}
@@ -0,0 +1,195 @@
+package nginxconf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Directive 表示 nginx 配置中的一条指令；Name 为 "#" 时表示注释
+type Directive struct {
+	Name    string       `json:"directive"`
+	Args    []string     `json:"args"`
+	Line    int          `json:"line"`
+	Comment string       `json:"comment,omitempty"`
+	Block   []*Directive `json:"block,omitempty"`
+	IsBlock bool         `json:"-"`
+}
+
+// ParseError 携带出错行号的解析错误
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("第 %d 行: %s", e.Line, e.Msg)
+}
+
+type token struct {
+	value   string
+	line    int
+	quoted  bool
+	comment bool
+}
+
+// Parse 将配置文本解析为指令树
+func Parse(content string) ([]*Directive, error) {
+	tokens, err := tokenize(content)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	directives, err := p.parseBlock(false)
+	if err != nil {
+		return nil, err
+	}
+	return directives, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) parseBlock(nested bool) ([]*Directive, error) {
+	var directives []*Directive
+	for p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		p.pos++
+
+		if tok.comment {
+			directives = append(directives, &Directive{Name: "#", Line: tok.line, Comment: tok.value, Args: []string{}})
+			continue
+		}
+		if !tok.quoted && tok.value == "}" {
+			if !nested {
+				return nil, &ParseError{Line: tok.line, Msg: "多余的 \"}\""}
+			}
+			return directives, nil
+		}
+		if !tok.quoted && (tok.value == ";" || tok.value == "{") {
+			return nil, &ParseError{Line: tok.line, Msg: fmt.Sprintf("意外的 %q", tok.value)}
+		}
+
+		d := &Directive{Name: tok.value, Line: tok.line, Args: []string{}}
+		terminated := false
+		for p.pos < len(p.tokens) {
+			arg := p.tokens[p.pos]
+			p.pos++
+			if arg.comment {
+				// 指令中间的注释保留为独立节点
+				directives = append(directives, &Directive{Name: "#", Line: arg.line, Comment: arg.value, Args: []string{}})
+				continue
+			}
+			if !arg.quoted && arg.value == ";" {
+				terminated = true
+				break
+			}
+			if !arg.quoted && arg.value == "{" {
+				block, err := p.parseBlock(true)
+				if err != nil {
+					return nil, err
+				}
+				d.Block = block
+				d.IsBlock = true
+				terminated = true
+				break
+			}
+			if !arg.quoted && arg.value == "}" {
+				return nil, &ParseError{Line: arg.line, Msg: fmt.Sprintf("指令 %q 缺少结尾的 \";\"", d.Name)}
+			}
+			d.Args = append(d.Args, arg.value)
+		}
+		if !terminated {
+			return nil, &ParseError{Line: d.Line, Msg: fmt.Sprintf("指令 %q 缺少结尾的 \";\"", d.Name)}
+		}
+		directives = append(directives, d)
+	}
+	if nested {
+		line := 0
+		if len(p.tokens) > 0 {
+			line = p.tokens[len(p.tokens)-1].line
+		}
+		return nil, &ParseError{Line: line, Msg: "缺少 \"}\""}
+	}
+	return directives, nil
+}
+
+func tokenize(content string) ([]token, error) {
+	var (
+		tokens []token
+		buf    strings.Builder
+		line   = 1
+	)
+	flush := func() {
+		if buf.Len() > 0 {
+			tokens = append(tokens, token{value: buf.String(), line: line})
+			buf.Reset()
+		}
+	}
+
+	runes := []rune(content)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch {
+		case ch == '\n':
+			flush()
+			line++
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			flush()
+		case ch == '#' && buf.Len() == 0:
+			start := i + 1
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+			tokens = append(tokens, token{value: strings.TrimSpace(string(runes[start : i+1])), line: line, comment: true})
+		case ch == '"' || ch == '\'':
+			flush()
+			quote := ch
+			startLine := line
+			var value strings.Builder
+			closed := false
+			for i+1 < len(runes) {
+				i++
+				c := runes[i]
+				if c == '\\' && i+1 < len(runes) && (runes[i+1] == quote || runes[i+1] == '\\') {
+					i++
+					value.WriteRune(runes[i])
+					continue
+				}
+				if c == quote {
+					closed = true
+					break
+				}
+				if c == '\n' {
+					line++
+				}
+				value.WriteRune(c)
+			}
+			if !closed {
+				return nil, &ParseError{Line: startLine, Msg: "引号未闭合"}
+			}
+			tokens = append(tokens, token{value: value.String(), line: startLine, quoted: true})
+		case ch == ';' || ch == '{' || ch == '}':
+			// ${var} 形式的变量中的大括号属于参数本身
+			if ch == '{' && buf.Len() > 0 && strings.HasSuffix(buf.String(), "$") {
+				buf.WriteRune(ch)
+				continue
+			}
+			if ch == '}' && strings.Contains(buf.String(), "${") && !strings.Contains(buf.String()[strings.LastIndex(buf.String(), "${"):], "}") {
+				buf.WriteRune(ch)
+				continue
+			}
+			flush()
+			tokens = append(tokens, token{value: string(ch), line: line})
+		case ch == '\\' && i+1 < len(runes):
+			buf.WriteRune(ch)
+			i++
+			buf.WriteRune(runes[i])
+		default:
+			buf.WriteRune(ch)
+		}
+	}
+	flush()
+	return tokens, nil
+}
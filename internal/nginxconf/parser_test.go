@@ -0,0 +1,91 @@
+package nginxconf
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const sample = `# site_type: proxy
+map $http_upgrade $connection_upgrade {
+    default      "";
+    websocket    "upgrade";
+}
+
+server {
+    listen 443 ssl;
+    server_name example.com; # inline
+    location ~* \.(js|css)$ {
+        proxy_set_header Connection "";
+        proxy_cache_key "$scheme$host$request_uri";
+    }
+    location / {
+        proxy_pass http://127.0.0.1:8080;
+        add_header X-Frame-Options 'SAMEORIGIN' always;
+        set $target ${host}_x;
+    }
+}
+`
+
+func TestParseTree(t *testing.T) {
+	tree, err := Parse(sample)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if tree[0].Name != "#" || tree[0].Comment != "site_type: proxy" {
+		t.Fatalf("expected leading comment, got %+v", tree[0])
+	}
+	m := First(tree, "map")
+	if m == nil || !reflect.DeepEqual(m.Args, []string{"$http_upgrade", "$connection_upgrade"}) {
+		t.Fatalf("unexpected map directive: %+v", m)
+	}
+	if got := First(m.Block, "default").Arg(0); got != "" {
+		t.Fatalf("quoted empty arg lost: %q", got)
+	}
+
+	server := First(tree, "server")
+	if server == nil || server.Line != 7 {
+		t.Fatalf("unexpected server directive: %+v", server)
+	}
+	locations := Find(server.Block, "location")
+	if len(locations) != 2 || locations[0].Arg(1) != `\.(js|css)$` {
+		t.Fatalf("unexpected locations: %+v", locations)
+	}
+	root := locations[1]
+	if got := First(root.Block, "add_header").Args; !reflect.DeepEqual(got, []string{"X-Frame-Options", "SAMEORIGIN", "always"}) {
+		t.Fatalf("unexpected add_header args: %v", got)
+	}
+	if got := First(root.Block, "set").Arg(1); got != "${host}_x" {
+		t.Fatalf("variable braces should stay in arg, got %q", got)
+	}
+
+	again, err := Parse(Dump(tree))
+	if err != nil {
+		t.Fatalf("reparse dump: %v", err)
+	}
+	var names, againNames []string
+	Walk(tree, func(d *Directive, _ []*Directive) { names = append(names, d.Name+" "+d.Arg(0)) })
+	Walk(again, func(d *Directive, _ []*Directive) { againNames = append(againNames, d.Name+" "+d.Arg(0)) })
+	if !reflect.DeepEqual(names, againNames) {
+		t.Fatalf("round trip mismatch:\n%v\n%v", names, againNames)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]int{
+		"server {\n    listen 80;\n":      2,
+		"server {\n    listen 80\n}\n":    3,
+		"listen 80;\n}\n":                 2,
+		"server_name \"example.com;\n}\n": 1,
+	}
+	for input, line := range cases {
+		_, err := Parse(input)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Fatalf("expected parse error for %q, got %v", input, err)
+		}
+		if perr.Line != line {
+			t.Fatalf("expected error on line %d for %q, got %d", line, input, perr.Line)
+		}
+	}
+}
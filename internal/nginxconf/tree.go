@@ -0,0 +1,94 @@
+package nginxconf
+
+import (
+	"strings"
+)
+
+// Find 返回当前层级中名称匹配的指令
+func Find(directives []*Directive, name string) []*Directive {
+	var found []*Directive
+	for _, d := range directives {
+		if d.Name == name {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+// First 返回当前层级中第一个名称匹配的指令
+func First(directives []*Directive, name string) *Directive {
+	for _, d := range directives {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// Walk 深度优先遍历所有指令，parents 为从根到当前节点父级的路径
+func Walk(directives []*Directive, fn func(d *Directive, parents []*Directive)) {
+	walk(directives, nil, fn)
+}
+
+func walk(directives []*Directive, parents []*Directive, fn func(d *Directive, parents []*Directive)) {
+	for _, d := range directives {
+		fn(d, parents)
+		if len(d.Block) > 0 {
+			walk(d.Block, append(parents[:len(parents):len(parents)], d), fn)
+		}
+	}
+}
+
+// Arg 返回指定位置的参数，不存在时返回空串
+func (d *Directive) Arg(i int) string {
+	if d == nil || i < 0 || i >= len(d.Args) {
+		return ""
+	}
+	return d.Args[i]
+}
+
+// Dump 将指令树重新渲染为配置文本
+func Dump(directives []*Directive) string {
+	var b strings.Builder
+	dump(&b, directives, 0)
+	return b.String()
+}
+
+func dump(b *strings.Builder, directives []*Directive, depth int) {
+	indent := strings.Repeat("    ", depth)
+	for _, d := range directives {
+		b.WriteString(indent)
+		if d.Name == "#" {
+			b.WriteString("# ")
+			b.WriteString(d.Comment)
+			b.WriteString("\n")
+			continue
+		}
+		b.WriteString(d.Name)
+		for _, arg := range d.Args {
+			b.WriteString(" ")
+			b.WriteString(quoteArg(arg))
+		}
+		if d.IsBlock {
+			b.WriteString(" {\n")
+			dump(b, d.Block, depth+1)
+			b.WriteString(indent)
+			b.WriteString("}\n")
+			continue
+		}
+		b.WriteString(";\n")
+	}
+}
+
+func quoteArg(arg string) string {
+	if arg == "" {
+		return `""`
+	}
+	if !strings.ContainsAny(arg, " \t\r\n;{}#\"'") {
+		return arg
+	}
+	if strings.HasPrefix(arg, "${") && !strings.ContainsAny(arg, " \t\r\n;\"'") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
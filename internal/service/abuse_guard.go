@@ -0,0 +1,603 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+)
+
+const (
+	abuseSettingsPath = "/root/abuse_settings.json"
+	abuseInterval     = 10 * time.Second
+	abuseBackendNginx = "nginx"
+	abuseBackendNft   = "nftables"
+	// abuseNftTable 面板维护的 nftables 表，只丢弃发往 80/443 的流量
+	abuseNftTable  = "inet nginx_mgr_abuse"
+	abuseMaxWindow = 3600
+)
+
+var (
+	ErrInvalidAbuseSettings = errors.New("封禁规则无效")
+	ErrBanNotFound          = errors.New("封禁记录不存在")
+)
+
+// abuseCounter 一个 IP 在统计窗口内的请求数与 4xx 数
+type abuseCounter struct {
+	requests     int64
+	clientErrors int64
+}
+
+type abuseBucket struct {
+	at     time.Time
+	counts map[string]abuseCounter
+}
+
+// AbuseGuard 每 10 秒增量读取各站点的访问日志，按 IP 统计滑动窗口内的请求数与 4xx 占比，
+// 超过阈值的 IP 写入封禁列表并在到期后自动解除。封禁通过 http 级别的 deny 列表或 nftables 生效
+type AbuseGuard struct {
+	ConfDir string
+	LogDir  string
+
+	settingsPath string
+	store        *StateStore
+	nftScript    string
+	run          func(name string, args ...string) (string, error)
+
+	mu      sync.Mutex
+	offsets map[string]int64
+	buckets []abuseBucket
+	totals  map[string]abuseCounter
+	// applied 上次生效的封禁后端与 IP 列表，未变化时不重载
+	applied string
+}
+
+func NewAbuseGuard() *AbuseGuard {
+	return &AbuseGuard{
+		ConfDir:      model.NginxConfDir,
+		LogDir:       model.NginxLogDir,
+		settingsPath: abuseSettingsPath,
+		store:        openStateStore(""),
+		nftScript:    "/var/lib/nginx-mgr/abuse.nft",
+		run:          executor.ExecuteSimple,
+		offsets:      make(map[string]int64),
+		totals:       make(map[string]abuseCounter),
+	}
+}
+
+// DenyPath 返回 nginx 后端使用的 deny 列表路径
+func (g *AbuseGuard) DenyPath() string {
+	return filepath.Join(g.ConfDir, "abuse_deny.conf")
+}
+
+func (g *AbuseGuard) defaultSettings() model.AbuseSettings {
+	return model.AbuseSettings{
+		Enabled:            false,
+		WindowSeconds:      60,
+		MaxRequests:        600,
+		ClientErrorPercent: 80,
+		MinRequests:        50,
+		BanMinutes:         60,
+		Backend:            abuseBackendNginx,
+		Whitelist:          []string{},
+	}
+}
+
+func (g *AbuseGuard) sanitize(input model.AbuseSettings) (model.AbuseSettings, error) {
+	output := g.defaultSettings()
+	output.Enabled = input.Enabled
+	output.LastUpdatedUnixTime = input.LastUpdatedUnixTime
+	if input.WindowSeconds > 0 {
+		if input.WindowSeconds < int(abuseInterval/time.Second) || input.WindowSeconds > abuseMaxWindow {
+			return model.AbuseSettings{}, fmt.Errorf("%w: 统计窗口需在 %d 到 %d 秒之间", ErrInvalidAbuseSettings, int(abuseInterval/time.Second), abuseMaxWindow)
+		}
+		output.WindowSeconds = input.WindowSeconds
+	}
+	if input.MaxRequests > 0 {
+		output.MaxRequests = input.MaxRequests
+	}
+	if input.ClientErrorPercent < 0 || input.ClientErrorPercent > 100 {
+		return model.AbuseSettings{}, fmt.Errorf("%w: 4xx 占比需在 0 到 100 之间", ErrInvalidAbuseSettings)
+	}
+	output.ClientErrorPercent = input.ClientErrorPercent
+	if input.MinRequests > 0 {
+		output.MinRequests = input.MinRequests
+	}
+	if input.BanMinutes > 0 {
+		output.BanMinutes = input.BanMinutes
+	}
+	switch input.Backend {
+	case "", abuseBackendNginx:
+	case abuseBackendNft:
+		output.Backend = abuseBackendNft
+	default:
+		return model.AbuseSettings{}, fmt.Errorf("%w: 不支持的封禁方式 %s", ErrInvalidAbuseSettings, input.Backend)
+	}
+	for _, item := range input.Whitelist {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if _, err := parseAbusePrefix(item); err != nil {
+			return model.AbuseSettings{}, fmt.Errorf("%w: 白名单 %q 不是合法的 IP 或 CIDR", ErrInvalidAbuseSettings, item)
+		}
+		output.Whitelist = append(output.Whitelist, item)
+	}
+	return output, nil
+}
+
+func parseAbusePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// normalizeBanIP 校验并规范化 IP，IPv4 映射的 IPv6 地址按 IPv4 处理
+func normalizeBanIP(value string) (string, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(value))
+	if err != nil || addr.Zone() != "" {
+		return "", fmt.Errorf("%w: %q 不是合法的 IP", ErrInvalidAbuseSettings, value)
+	}
+	return addr.Unmap().String(), nil
+}
+
+func (g *AbuseGuard) GetSettings() (model.AbuseSettings, error) {
+	content, err := os.ReadFile(g.settingsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return g.defaultSettings(), nil
+		}
+		return model.AbuseSettings{}, err
+	}
+	var settings model.AbuseSettings
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return model.AbuseSettings{}, err
+	}
+	normalized, err := g.sanitize(settings)
+	if err != nil {
+		return g.defaultSettings(), nil
+	}
+	return normalized, nil
+}
+
+// SaveSettings 保存规则并按新的封禁方式立即同步封禁列表，切换方式时清除旧方式下的规则
+func (g *AbuseGuard) SaveSettings(input model.AbuseSettings) (model.AbuseSettings, error) {
+	settings, err := g.sanitize(input)
+	if err != nil {
+		return model.AbuseSettings{}, err
+	}
+	settings.LastUpdatedUnixTime = time.Now().Unix()
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.AbuseSettings{}, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	previous, err := g.GetSettings()
+	if err != nil {
+		return model.AbuseSettings{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(g.settingsPath), 0700); err != nil {
+		return model.AbuseSettings{}, err
+	}
+	if err := os.WriteFile(g.settingsPath, data, 0600); err != nil {
+		return model.AbuseSettings{}, err
+	}
+	if previous.Backend != settings.Backend {
+		if err := g.clearBackend(previous.Backend); err != nil {
+			log.Printf("[abuse] 清除 %s 封禁规则失败: %v", previous.Backend, err)
+		}
+		g.applied = ""
+	}
+	bans, err := g.loadBans()
+	if err != nil {
+		return settings, err
+	}
+	return settings, g.applyLocked(settings, bans)
+}
+
+func (g *AbuseGuard) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ticker := time.NewTicker(abuseInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			settings, err := g.GetSettings()
+			if err != nil {
+				log.Printf("[abuse] 获取配置失败: %v", err)
+				continue
+			}
+			if err := g.Check(settings, time.Now()); err != nil {
+				log.Printf("[abuse] %v", err)
+			}
+		}
+	}
+}
+
+// Check 读取新增的访问日志、封禁超过阈值的 IP 并解除到期的封禁。未启用自动封禁时只处理到期与手动封禁
+func (g *AbuseGuard) Check(settings model.AbuseSettings, now time.Time) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	bans, err := g.loadBans()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for ip, ban := range bans {
+		if ban.ExpiresUnixTime > 0 && ban.ExpiresUnixTime <= now.Unix() {
+			delete(bans, ip)
+			changed = true
+		}
+	}
+
+	if settings.Enabled {
+		g.ingest(settings, now)
+		whitelist := abuseWhitelist(settings.Whitelist)
+		for ip, counter := range g.totals {
+			if _, banned := bans[ip]; banned || abuseWhitelisted(whitelist, ip) {
+				continue
+			}
+			reason := abuseReason(settings, counter)
+			if reason == "" {
+				continue
+			}
+			bans[ip] = model.AbuseBan{
+				IP:              ip,
+				Reason:          reason,
+				Requests:        counter.requests,
+				ClientErrors:    counter.clientErrors,
+				CreatedUnixTime: now.Unix(),
+				ExpiresUnixTime: now.Add(time.Duration(settings.BanMinutes) * time.Minute).Unix(),
+			}
+			log.Printf("[abuse] 封禁 %s: %s", ip, reason)
+			changed = true
+		}
+	} else {
+		g.offsets = make(map[string]int64)
+		g.buckets = nil
+		g.totals = make(map[string]abuseCounter)
+	}
+
+	if changed {
+		if err := g.saveBans(bans); err != nil {
+			return err
+		}
+	}
+	return g.applyLocked(settings, bans)
+}
+
+// ingest 把新增的日志行计入当前周期，并移出统计窗口之外的周期
+func (g *AbuseGuard) ingest(settings model.AbuseSettings, now time.Time) {
+	bucket := abuseBucket{at: now, counts: make(map[string]abuseCounter)}
+	paths, _ := filepath.Glob(filepath.Join(g.LogDir, "*-access.log"))
+	for _, path := range paths {
+		data, err := readNewLogLines(g.offsets, path)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			entry, ok := parseAccessLine(line)
+			if !ok {
+				continue
+			}
+			ip, err := normalizeBanIP(entry.IP)
+			if err != nil {
+				continue
+			}
+			counter := bucket.counts[ip]
+			counter.requests++
+			if entry.Status >= 400 && entry.Status <= 499 {
+				counter.clientErrors++
+			}
+			bucket.counts[ip] = counter
+		}
+	}
+
+	g.buckets = append(g.buckets, bucket)
+	g.addCounts(bucket.counts, 1)
+	window := time.Duration(settings.WindowSeconds) * time.Second
+	for len(g.buckets) > 0 && now.Sub(g.buckets[0].at) >= window {
+		g.addCounts(g.buckets[0].counts, -1)
+		g.buckets = g.buckets[1:]
+	}
+}
+
+func (g *AbuseGuard) addCounts(counts map[string]abuseCounter, sign int64) {
+	for ip, counter := range counts {
+		total := g.totals[ip]
+		total.requests += sign * counter.requests
+		total.clientErrors += sign * counter.clientErrors
+		if total.requests <= 0 {
+			delete(g.totals, ip)
+			continue
+		}
+		g.totals[ip] = total
+	}
+}
+
+// abuseReason 返回触发封禁的原因，未超过阈值时返回空字符串
+func abuseReason(settings model.AbuseSettings, counter abuseCounter) string {
+	if counter.requests > int64(settings.MaxRequests) {
+		return fmt.Sprintf("%d 秒内 %d 个请求，超过上限 %d", settings.WindowSeconds, counter.requests, settings.MaxRequests)
+	}
+	if settings.ClientErrorPercent > 0 && counter.requests >= int64(settings.MinRequests) &&
+		counter.clientErrors*100 >= counter.requests*int64(settings.ClientErrorPercent) {
+		return fmt.Sprintf("%d 秒内 %d 个请求中 %d 个 4xx，占比达到 %d%%", settings.WindowSeconds, counter.requests, counter.clientErrors, settings.ClientErrorPercent)
+	}
+	return ""
+}
+
+// abuseWhitelist 解析白名单，本机地址始终不封禁
+func abuseWhitelist(items []string) []netip.Prefix {
+	prefixes := []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+	for _, item := range items {
+		if prefix, err := parseAbusePrefix(item); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+func abuseWhitelisted(whitelist []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range whitelist {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *AbuseGuard) loadBans() (map[string]model.AbuseBan, error) {
+	bans := make(map[string]model.AbuseBan)
+	if err := g.store.Get(stateKeyAbuseBans, &bans); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return bans, nil
+}
+
+func (g *AbuseGuard) saveBans(bans map[string]model.AbuseBan) error {
+	return g.store.Put(stateKeyAbuseBans, bans)
+}
+
+// Bans 返回当前的封禁记录，最新的在前
+func (g *AbuseGuard) Bans() ([]model.AbuseBan, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	bans, err := g.loadBans()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]model.AbuseBan, 0, len(bans))
+	now := time.Now().Unix()
+	for _, ban := range bans {
+		if ban.ExpiresUnixTime == 0 || ban.ExpiresUnixTime > now {
+			list = append(list, ban)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedUnixTime != list[j].CreatedUnixTime {
+			return list[i].CreatedUnixTime > list[j].CreatedUnixTime
+		}
+		return list[i].IP < list[j].IP
+	})
+	return list, nil
+}
+
+// Ban 手动封禁 IP，minutes 为 0 时不自动解除；已封禁的 IP 更新原因与到期时间
+func (g *AbuseGuard) Ban(ip string, minutes int, reason string) (model.AbuseBan, error) {
+	ip, err := normalizeBanIP(ip)
+	if err != nil {
+		return model.AbuseBan{}, err
+	}
+	if minutes < 0 {
+		return model.AbuseBan{}, fmt.Errorf("%w: 封禁时长不能为负数", ErrInvalidAbuseSettings)
+	}
+	settings, err := g.GetSettings()
+	if err != nil {
+		return model.AbuseBan{}, err
+	}
+	if abuseWhitelisted(abuseWhitelist(settings.Whitelist), ip) {
+		return model.AbuseBan{}, fmt.Errorf("%w: %s 在白名单中", ErrInvalidAbuseSettings, ip)
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		reason = "手动封禁"
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	bans, err := g.loadBans()
+	if err != nil {
+		return model.AbuseBan{}, err
+	}
+	now := time.Now()
+	ban := model.AbuseBan{IP: ip, Reason: reason, Manual: true, CreatedUnixTime: now.Unix()}
+	if minutes > 0 {
+		ban.ExpiresUnixTime = now.Add(time.Duration(minutes) * time.Minute).Unix()
+	}
+	bans[ip] = ban
+	if err := g.saveBans(bans); err != nil {
+		return model.AbuseBan{}, err
+	}
+	return ban, g.applyLocked(settings, bans)
+}
+
+// Unban 解除封禁。被自动封禁的 IP 解除后清零统计，避免下个周期立即再次封禁
+func (g *AbuseGuard) Unban(ip string) error {
+	ip, err := normalizeBanIP(ip)
+	if err != nil {
+		return err
+	}
+	settings, err := g.GetSettings()
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	bans, err := g.loadBans()
+	if err != nil {
+		return err
+	}
+	if _, ok := bans[ip]; !ok {
+		return ErrBanNotFound
+	}
+	delete(bans, ip)
+	delete(g.totals, ip)
+	for _, bucket := range g.buckets {
+		delete(bucket.counts, ip)
+	}
+	if err := g.saveBans(bans); err != nil {
+		return err
+	}
+	return g.applyLocked(settings, bans)
+}
+
+// applyLocked 把封禁列表同步到所选的封禁方式，列表未变化时跳过
+func (g *AbuseGuard) applyLocked(settings model.AbuseSettings, bans map[string]model.AbuseBan) error {
+	ips := make([]string, 0, len(bans))
+	for ip := range bans {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	signature := settings.Backend + "\n" + strings.Join(ips, "\n")
+	if signature == g.applied {
+		return nil
+	}
+
+	var err error
+	if settings.Backend == abuseBackendNft {
+		err = g.applyNft(ips)
+	} else {
+		err = g.applyNginx(ips)
+	}
+	if err != nil {
+		return err
+	}
+	g.applied = signature
+	return nil
+}
+
+func renderAbuseDeny(ips []string) string {
+	var b strings.Builder
+	b.WriteString("# 由面板自动维护的封禁列表，请勿手动修改\n")
+	for _, ip := range ips {
+		fmt.Fprintf(&b, "deny %s;\n", ip)
+	}
+	return b.String()
+}
+
+// applyNginx 写入 http 级别的 deny 列表并重载，配置测试失败时恢复原文件。
+// 站点或 location 自带 allow/deny 时 nginx 不继承 http 级别的规则，这类站点请使用 nftables
+func (g *AbuseGuard) applyNginx(ips []string) error {
+	path := g.DenyPath()
+	content := renderAbuseDeny(ips)
+	prev, prevErr := os.ReadFile(path)
+	if (prevErr == nil && string(prev) == content) || (errors.Is(prevErr, os.ErrNotExist) && len(ips) == 0) {
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return err
+	}
+	restore := func() {
+		if prevErr != nil {
+			os.WriteFile(path, []byte(renderAbuseDeny(nil)), 0644)
+			return
+		}
+		os.WriteFile(path, prev, 0644)
+	}
+	if err := ensureHTTPInclude(g.ConfDir, path); err != nil {
+		restore()
+		return err
+	}
+	if out, err := g.run(model.NginxSbinPath, "-t"); err != nil {
+		restore()
+		return fmt.Errorf("配置验证失败: %s", strings.TrimSpace(out))
+	}
+	if _, err := g.run("systemctl", "reload", "nginx"); err != nil {
+		return fmt.Errorf("重载 Nginx 失败: %w", err)
+	}
+	return nil
+}
+
+// renderAbuseNft 生成替换整张表的 nftables 脚本，先声明再删除以保证表不存在时也能执行
+func renderAbuseNft(ips []string) string {
+	var v4, v6 []string
+	for _, ip := range ips {
+		if addr, err := netip.ParseAddr(ip); err == nil && addr.Is4() {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	elements := func(list []string) string {
+		if len(list) == 0 {
+			return ""
+		}
+		return "; elements = { " + strings.Join(list, ", ") + " }"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "table %s\ndelete table %s\n", abuseNftTable, abuseNftTable)
+	fmt.Fprintf(&b, "table %s {\n", abuseNftTable)
+	fmt.Fprintf(&b, "    set banned_v4 { type ipv4_addr%s; }\n", elements(v4))
+	fmt.Fprintf(&b, "    set banned_v6 { type ipv6_addr%s; }\n", elements(v6))
+	b.WriteString("    chain input {\n")
+	b.WriteString("        type filter hook input priority -10; policy accept;\n")
+	b.WriteString("        ip saddr @banned_v4 tcp dport { 80, 443 } drop\n")
+	b.WriteString("        ip6 saddr @banned_v6 tcp dport { 80, 443 } drop\n")
+	b.WriteString("    }\n}\n")
+	return b.String()
+}
+
+func (g *AbuseGuard) applyNft(ips []string) error {
+	if err := os.WriteFile(g.nftScript, []byte(renderAbuseNft(ips)), 0600); err != nil {
+		return err
+	}
+	if out, err := g.run("nft", "-f", g.nftScript); err != nil {
+		return fmt.Errorf("应用 nftables 规则失败: %s", strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// clearBackend 清除切换前的封禁方式留下的规则
+func (g *AbuseGuard) clearBackend(backend string) error {
+	if backend == abuseBackendNft {
+		if out, err := g.run("nft", append([]string{"delete", "table"}, strings.Fields(abuseNftTable)...)...); err != nil && !strings.Contains(out, "No such file") {
+			return fmt.Errorf("删除 nftables 表失败: %s", strings.TrimSpace(out))
+		}
+		return nil
+	}
+	if _, err := os.Stat(g.DenyPath()); err != nil {
+		return nil
+	}
+	return g.applyNginx(nil)
+}
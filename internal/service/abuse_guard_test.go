@@ -0,0 +1,126 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+func TestAbuseGuard(t *testing.T) {
+	dir := t.TempDir()
+	logDir := filepath.Join(dir, "logs")
+	os.MkdirAll(logDir, 0755)
+	os.WriteFile(filepath.Join(dir, "nginx.conf"), []byte("http {\n    include sites-enabled/*;\n}\n"), 0644)
+	logPath := filepath.Join(logDir, "a.com-access.log")
+	os.WriteFile(logPath, nil, 0644)
+
+	var commands []string
+	guard := NewAbuseGuard()
+	guard.ConfDir = dir
+	guard.LogDir = logDir
+	guard.settingsPath = filepath.Join(dir, "abuse_settings.json")
+	guard.store = openStateStore(filepath.Join(dir, "state.json"))
+	guard.nftScript = filepath.Join(dir, "abuse.nft")
+	guard.run = func(name string, args ...string) (string, error) {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return "", nil
+	}
+
+	if _, err := guard.SaveSettings(model.AbuseSettings{Whitelist: []string{"10.0.0.0/8", "bad"}}); err == nil {
+		t.Fatal("expected invalid whitelist to be rejected")
+	}
+	settings, err := guard.SaveSettings(model.AbuseSettings{
+		Enabled: true, WindowSeconds: 60, MaxRequests: 20, ClientErrorPercent: 50, MinRequests: 10, BanMinutes: 30,
+		Whitelist: []string{"10.0.0.0/8"},
+	})
+	if err != nil {
+		t.Fatalf("save settings: %v", err)
+	}
+
+	now := time.Now()
+	// 首次读取只记录日志末尾
+	if err := guard.Check(settings, now); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	var lines []string
+	line := func(ip string, status int) string {
+		return fmt.Sprintf(`%s - - [14/Nov/2023:22:13:20 +0000] "GET / HTTP/1.1" %d 12 "-" "curl"`, ip, status)
+	}
+	for i := 0; i < 25; i++ {
+		lines = append(lines, line("1.2.3.4", 200), line("10.1.1.1", 200))
+	}
+	for i := 0; i < 12; i++ {
+		lines = append(lines, line("5.6.7.8", 404))
+	}
+	lines = append(lines, line("9.9.9.9", 404))
+	os.WriteFile(logPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+
+	if err := guard.Check(settings, now.Add(10*time.Second)); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	bans, err := guard.Bans()
+	if err != nil {
+		t.Fatalf("bans: %v", err)
+	}
+	banned := map[string]model.AbuseBan{}
+	for _, ban := range bans {
+		banned[ban.IP] = ban
+	}
+	if len(banned) != 2 || banned["1.2.3.4"].Requests != 25 || banned["5.6.7.8"].ClientErrors != 12 {
+		t.Fatalf("unexpected bans: %+v", bans)
+	}
+	deny, _ := os.ReadFile(guard.DenyPath())
+	if !strings.Contains(string(deny), "deny 1.2.3.4;") || !strings.Contains(string(deny), "deny 5.6.7.8;") || strings.Contains(string(deny), "10.1.1.1") {
+		t.Fatalf("unexpected deny list: %s", deny)
+	}
+	conf, _ := os.ReadFile(filepath.Join(dir, "nginx.conf"))
+	if !strings.Contains(string(conf), "include "+guard.DenyPath()+";") {
+		t.Fatalf("deny list not included: %s", conf)
+	}
+
+	// 解除封禁后清零统计，不会在下个周期立即再次封禁
+	if err := guard.Unban("1.2.3.4"); err != nil {
+		t.Fatalf("unban: %v", err)
+	}
+	if err := guard.Unban("1.2.3.4"); err != ErrBanNotFound {
+		t.Fatalf("expected ErrBanNotFound, got %v", err)
+	}
+	if _, err := guard.Ban("10.2.2.2", 0, ""); err == nil {
+		t.Fatal("expected whitelisted ip to be rejected")
+	}
+	if _, err := guard.Ban("2001:db8::1", 0, "扫描"); err != nil {
+		t.Fatalf("manual ban: %v", err)
+	}
+
+	// 自动封禁到期解除，手动封禁保留
+	commands = nil
+	if err := guard.Check(settings, now.Add(31*time.Minute)); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	bans, _ = guard.Bans()
+	if len(bans) != 1 || bans[0].IP != "2001:db8::1" || !bans[0].Manual || bans[0].ExpiresUnixTime != 0 {
+		t.Fatalf("unexpected bans after expiry: %+v", bans)
+	}
+	if len(commands) != 2 {
+		t.Fatalf("expected nginx -t and reload, got %v", commands)
+	}
+
+	// 切换到 nftables 后清空 deny 列表并生成 nft 脚本
+	settings.Backend = "nftables"
+	if _, err := guard.SaveSettings(settings); err != nil {
+		t.Fatalf("switch backend: %v", err)
+	}
+	deny, _ = os.ReadFile(guard.DenyPath())
+	if strings.Contains(string(deny), "deny ") {
+		t.Fatalf("deny list not cleared: %s", deny)
+	}
+	script, _ := os.ReadFile(guard.nftScript)
+	if !strings.Contains(string(script), "elements = { 2001:db8::1 }") || !strings.Contains(string(script), "set banned_v4 { type ipv4_addr; }") {
+		t.Fatalf("unexpected nft script: %s", script)
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jsonLogFormat 面板维护的 JSON 日志格式，escape=json 保证请求与 UA 中的引号、控制字符都被转义，
+// 解析时不再依赖 combined 格式的正则
+const jsonLogFormat = "main_json"
+
+const accessTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+func renderJSONLogFormat() string {
+	return "log_format " + jsonLogFormat + " escape=json '{'\n" +
+		"    '\"time_local\":\"$time_local\",\"remote_addr\":\"$remote_addr\",\"remote_user\":\"$remote_user\",'\n" +
+		"    '\"request\":\"$request\",\"status\":$status,\"body_bytes_sent\":$body_bytes_sent,'\n" +
+		"    '\"http_referer\":\"$http_referer\",\"http_user_agent\":\"$http_user_agent\",\"host\":\"$host\",'\n" +
+		"    '\"request_time\":$request_time,\"upstream_response_time\":\"$upstream_response_time\"'\n" +
+		"    '}';\n"
+}
+
+// accessEntry 一条访问日志中分析用到的字段
+type accessEntry struct {
+	IP        string
+	Time      time.Time
+	Request   string // "GET /path HTTP/1.1"
+	Status    int
+	Bytes     int64
+	UserAgent string
+
+	// RequestTime 与 UpstreamTime 为秒，仅 main_timing 与 main_json 格式有值
+	RequestTime  float64
+	HasTiming    bool
+	UpstreamTime float64
+	HasUpstream  bool
+}
+
+// URI 返回请求路径，不含查询参数，无法解析时返回空字符串
+func (e accessEntry) URI() string {
+	fields := strings.Fields(e.Request)
+	if len(fields) < 2 {
+		return ""
+	}
+	uri, _, _ := strings.Cut(fields[1], "?")
+	return uri
+}
+
+// parseAccessLine 解析 main_json 或 main/combined（含 main_timing）格式的访问日志行
+func parseAccessLine(line string) (accessEntry, bool) {
+	if strings.HasPrefix(line, "{") {
+		return parseJSONAccessLine(line)
+	}
+	match := accessLinePattern.FindStringSubmatch(line)
+	if match == nil {
+		return accessEntry{}, false
+	}
+	at, err := time.Parse(accessTimeLayout, match[2])
+	if err != nil {
+		return accessEntry{}, false
+	}
+	entry := accessEntry{IP: match[1], Time: at, Request: match[3], UserAgent: match[6]}
+	entry.Status, _ = strconv.Atoi(match[4])
+	entry.Bytes, _ = strconv.ParseInt(match[5], 10, 64)
+	entry.RequestTime, entry.UpstreamTime, entry.HasTiming, entry.HasUpstream = parseAccessTiming(line)
+	return entry, true
+}
+
+func parseJSONAccessLine(line string) (accessEntry, bool) {
+	var record struct {
+		TimeLocal    string   `json:"time_local"`
+		RemoteAddr   string   `json:"remote_addr"`
+		Request      string   `json:"request"`
+		Status       int      `json:"status"`
+		Bytes        int64    `json:"body_bytes_sent"`
+		UserAgent    string   `json:"http_user_agent"`
+		RequestTime  *float64 `json:"request_time"`
+		UpstreamTime string   `json:"upstream_response_time"`
+	}
+	if err := json.Unmarshal([]byte(line), &record); err != nil || record.RemoteAddr == "" || record.Status == 0 {
+		return accessEntry{}, false
+	}
+	at, err := time.Parse(accessTimeLayout, record.TimeLocal)
+	if err != nil {
+		return accessEntry{}, false
+	}
+	entry := accessEntry{
+		IP:        record.RemoteAddr,
+		Time:      at,
+		Request:   record.Request,
+		Status:    record.Status,
+		Bytes:     record.Bytes,
+		UserAgent: record.UserAgent,
+	}
+	if record.RequestTime != nil {
+		entry.RequestTime, entry.HasTiming = *record.RequestTime, true
+	}
+	entry.UpstreamTime, entry.HasUpstream = sumUpstreamTimes(record.UpstreamTime)
+	return entry, true
+}
+
+// sumUpstreamTimes 累加 $upstream_response_time 中逗号或冒号分隔的多个耗时，没有后端时为 "" 或 "-"
+func sumUpstreamTimes(value string) (total float64, ok bool) {
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ':' || r == ' ' }) {
+		if seconds, err := strconv.ParseFloat(field, 64); err == nil {
+			total += seconds
+			ok = true
+		}
+	}
+	return total, ok
+}
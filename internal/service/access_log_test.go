@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestParseAccessLine(t *testing.T) {
+	// escape=json 转义后的 UA 中带有引号，combined 格式的正则无法正确切分
+	jsonLine := `{"time_local":"14/Nov/2023:22:13:20 +0800","remote_addr":"2001:db8::1","remote_user":"","request":"GET /a?x=1 HTTP/1.1","status":404,"body_bytes_sent":153,"http_referer":"","http_user_agent":"bot \"x\" 1.0","host":"a.com","request_time":0.012,"upstream_response_time":"0.004, 0.006"}`
+	entry, ok := parseAccessLine(jsonLine)
+	if !ok || entry.IP != "2001:db8::1" || entry.Status != 404 || entry.Bytes != 153 || entry.URI() != "/a" ||
+		entry.UserAgent != `bot "x" 1.0` || entry.Time.Unix() != 1699971200 {
+		t.Fatalf("unexpected json entry: %+v", entry)
+	}
+	if !entry.HasTiming || entry.RequestTime != 0.012 || !entry.HasUpstream || entry.UpstreamTime < 0.0099 || entry.UpstreamTime > 0.0101 {
+		t.Fatalf("unexpected json timing: %+v", entry)
+	}
+
+	entry, ok = parseAccessLine(`{"time_local":"14/Nov/2023:22:13:20 +0800","remote_addr":"1.2.3.4","request":"GET / HTTP/1.1","status":200,"body_bytes_sent":0,"request_time":0.001,"upstream_response_time":""}`)
+	if !ok || entry.HasUpstream || !entry.HasTiming {
+		t.Fatalf("unexpected static json entry: %+v", entry)
+	}
+
+	entry, ok = parseAccessLine(`1.2.3.4 - - [14/Nov/2023:22:13:20 +0800] "POST /login HTTP/1.1" 500 12 "-" "curl/8.0" rt=1.500 urt="1.498"`)
+	if !ok || entry.IP != "1.2.3.4" || entry.Status != 500 || entry.UserAgent != "curl/8.0" || entry.RequestTime != 1.5 || entry.UpstreamTime != 1.498 {
+		t.Fatalf("unexpected timing entry: %+v", entry)
+	}
+	entry, ok = parseAccessLine(`1.2.3.4 - - [14/Nov/2023:22:13:20 +0800] "GET / HTTP/1.1" 200 -`)
+	if !ok || entry.HasTiming || entry.Bytes != 0 {
+		t.Fatalf("unexpected main entry: %+v", entry)
+	}
+
+	for _, line := range []string{"", "{not json", `{"remote_addr":"1.2.3.4","status":200}`, "garbage line"} {
+		if _, ok := parseAccessLine(line); ok {
+			t.Fatalf("expected %q to be rejected", line)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const auditLogPath = "/root/audit_log.jsonl"
+
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+	auditPayloadLimit = 2048
+)
+
+// auditSensitivePatterns 字段名（小写）包含任一片段即脱敏，覆盖 client_secret、private_key 等
+var auditSensitivePatterns = []string{"secret", "pass", "token", "key"}
+
+// auditSensitiveKeys 名称不含上述片段但同样需要脱敏的字段（小写比较）
+var auditSensitiveKeys = map[string]bool{
+	"otp":     true,
+	"code":    true,
+	"webhook": true,
+}
+
+// auditSensitiveKey 判断请求体字段是否需要脱敏，rclone remote 的敏感参数与查询时隐藏的一致
+func auditSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if auditSensitiveKeys[key] || rcloneSecretOptions[key] {
+		return true
+	}
+	for _, pattern := range auditSensitivePatterns {
+		if strings.Contains(key, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditLog 以 JSON Lines 追加写入审计记录，只追加不修改
+type AuditLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewAuditLog(path string) *AuditLog {
+	if path == "" {
+		path = auditLogPath
+	}
+	return &AuditLog{path: path}
+}
+
+func (l *AuditLog) Append(entry model.AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Query 按条件过滤，返回最新的记录在前
+func (l *AuditLog) Query(q model.AuditQuery) ([]model.AuditEntry, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = auditDefaultLimit
+	}
+	if limit > auditMaxLimit {
+		limit = auditMaxLimit
+	}
+
+	l.mu.Lock()
+	f, err := os.Open(l.path)
+	if err != nil {
+		l.mu.Unlock()
+		if errors.Is(err, os.ErrNotExist) {
+			return []model.AuditEntry{}, nil
+		}
+		return nil, err
+	}
+	var matched []model.AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry model.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if auditMatches(q, entry) {
+			matched = append(matched, entry)
+		}
+	}
+	err = scanner.Err()
+	f.Close()
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]model.AuditEntry, 0, min(limit, len(matched)))
+	for i := len(matched) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, matched[i])
+	}
+	return result, nil
+}
+
+func auditMatches(q model.AuditQuery, entry model.AuditEntry) bool {
+	switch {
+	case q.User != "" && entry.User != q.User:
+		return false
+	case q.Method != "" && !strings.EqualFold(entry.Method, q.Method):
+		return false
+	case q.Path != "" && !strings.HasPrefix(entry.Path, q.Path):
+		return false
+	case q.Failed && entry.Status < 400:
+		return false
+	case !q.Since.IsZero() && entry.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && entry.Time.After(q.Until):
+		return false
+	}
+	return true
+}
+
+// AuditPayloadSummary 生成请求体摘要：JSON 中的敏感字段替换为 ***，其他类型只记录类型与长度
+func AuditPayloadSummary(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if !strings.Contains(contentType, "json") {
+		return fmt.Sprintf("<%s, %d bytes>", strings.TrimSpace(strings.Split(contentType, ";")[0]), len(body))
+	}
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Sprintf("<invalid json, %d bytes>", len(body))
+	}
+	data, err := json.Marshal(redactAuditValue(value))
+	if err != nil {
+		return ""
+	}
+	if len(data) > auditPayloadLimit {
+		return string(data[:auditPayloadLimit]) + "...(truncated)"
+	}
+	return string(data)
+}
+
+func redactAuditValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if auditSensitiveKey(key) {
+				// 布尔与数值（如 has_client_secret）不含机密，保留原值
+				switch item.(type) {
+				case nil, bool, float64:
+				default:
+					if item != "" {
+						v[key] = "***"
+					}
+				}
+				continue
+			}
+			// 自定义请求头（如 Webhook 的 Authorization）名称不固定，值一律脱敏
+			if headers, ok := item.(map[string]any); ok && strings.EqualFold(key, "headers") {
+				for name := range headers {
+					headers[name] = "***"
+				}
+				continue
+			}
+			v[key] = redactAuditValue(item)
+		}
+	case []any:
+		for i := range v {
+			v[i] = redactAuditValue(v[i])
+		}
+	}
+	return value
+}
@@ -2,13 +2,17 @@ package service
 
 import (
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -29,6 +33,11 @@ type AuthManager struct {
 	tokenHash string
 	expiresAt time.Time
 	mu        sync.RWMutex
+
+	// bcrypt is deliberately slow, so remember the digest of the last token that
+	// matched tokenHash and skip the comparison for subsequent requests.
+	verifiedHash   string
+	verifiedDigest string
 }
 
 func NewAuthManager(path string) (*AuthManager, error) {
@@ -87,11 +96,44 @@ func (m *AuthManager) refreshFromDisk() error {
 	return nil
 }
 
-func (m *AuthManager) hash(token string) string {
+// digest pre-hashes the token so that tokens longer than bcrypt's 72-byte limit
+// are not truncated. Older versions stored this value directly as the token hash.
+func (m *AuthManager) digest(token string) string {
 	sum := sha256.Sum256([]byte(token))
 	return hex.EncodeToString(sum[:])
 }
 
+// hash returns a salted bcrypt hash of the token.
+func (m *AuthManager) hash(token string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(m.digest(token)), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func isLegacyTokenHash(hash string) bool {
+	return !strings.HasPrefix(hash, "$2")
+}
+
+// matchLocked reports whether token matches the stored hash. Both bcrypt hashes
+// and legacy unsalted SHA-256 hashes are accepted.
+func (m *AuthManager) matchLocked(token string) bool {
+	digest := m.digest(token)
+	if isLegacyTokenHash(m.tokenHash) {
+		return subtle.ConstantTimeCompare([]byte(digest), []byte(m.tokenHash)) == 1
+	}
+	if m.verifiedHash == m.tokenHash && subtle.ConstantTimeCompare([]byte(digest), []byte(m.verifiedDigest)) == 1 {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(m.tokenHash), []byte(digest)) != nil {
+		return false
+	}
+	m.verifiedHash = m.tokenHash
+	m.verifiedDigest = digest
+	return true
+}
+
 func (m *AuthManager) IsSet() bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -105,7 +147,7 @@ func (m *AuthManager) ExpiresAt() time.Time {
 }
 
 // Login will create the token if it's not set. If a token already exists, it must match.
-// On success the session expiry is refreshed.
+// On success the session expiry is refreshed, and a legacy SHA-256 hash is upgraded to bcrypt.
 func (m *AuthManager) Login(token string) (time.Time, bool, error) {
 	if err := m.refreshFromDisk(); err != nil {
 		return time.Time{}, false, err
@@ -115,13 +157,19 @@ func (m *AuthManager) Login(token string) (time.Time, bool, error) {
 	defer m.mu.Unlock()
 
 	now := time.Now()
-	targetHash := m.hash(token)
 
 	created := false
-	if m.tokenHash == "" {
-		m.tokenHash = targetHash
-		created = true
-	} else if targetHash != m.tokenHash {
+	if m.tokenHash == "" || isLegacyTokenHash(m.tokenHash) {
+		if m.tokenHash != "" && !m.matchLocked(token) {
+			return time.Time{}, false, ErrTokenMismatch
+		}
+		hashed, err := m.hash(token)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		created = m.tokenHash == ""
+		m.tokenHash = hashed
+	} else if !m.matchLocked(token) {
 		return time.Time{}, false, ErrTokenMismatch
 	}
 
@@ -134,9 +182,14 @@ func (m *AuthManager) Login(token string) (time.Time, bool, error) {
 
 // ResetToken forcibly replaces the stored token hash. Intended for terminal tooling.
 func (m *AuthManager) ResetToken(token string) (time.Time, error) {
+	hashed, err := m.hash(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.tokenHash = m.hash(token)
+	m.tokenHash = hashed
 	m.expiresAt = time.Now().Add(tokenTTL)
 	if err := m.saveLocked(); err != nil {
 		return time.Time{}, err
@@ -144,13 +197,29 @@ func (m *AuthManager) ResetToken(token string) (time.Time, error) {
 	return m.expiresAt, nil
 }
 
+// Revoke expires the current token immediately; logging in again with the same token issues a new session.
+func (m *AuthManager) Revoke() error {
+	if err := m.refreshFromDisk(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tokenHash == "" {
+		return nil
+	}
+	m.expiresAt = time.Now()
+	return m.saveLocked()
+}
+
 func (m *AuthManager) Validate(token string) error {
 	if err := m.refreshFromDisk(); err != nil {
 		return err
 	}
 
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	// matchLocked updates the verification cache, so a write lock is needed
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	if m.tokenHash == "" {
 		return ErrTokenNotSet
@@ -160,7 +229,7 @@ func (m *AuthManager) Validate(token string) error {
 		return ErrTokenExpired
 	}
 
-	if m.hash(token) != m.tokenHash {
+	if !m.matchLocked(token) {
 		return ErrTokenMismatch
 	}
 	return nil
@@ -1,8 +1,15 @@
 package service
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestAuthManagerSync(t *testing.T) {
@@ -35,3 +42,61 @@ func TestAuthManagerSync(t *testing.T) {
 		t.Fatalf("old token should fail after reset")
 	}
 }
+
+func TestAuthManagerRevoke(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth_token.json")
+	mgr, err := NewAuthManager(path)
+	if err != nil {
+		t.Fatalf("new auth manager: %v", err)
+	}
+	if _, _, err := mgr.Login("first"); err != nil {
+		t.Fatalf("login first: %v", err)
+	}
+
+	// 另一个进程注销后，本进程看到的令牌随即失效
+	cli, err := NewAuthManager(path)
+	if err != nil {
+		t.Fatalf("new cli mgr: %v", err)
+	}
+	if err := cli.Revoke(); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if err := mgr.Validate("first"); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("revoked token should be expired, got %v", err)
+	}
+}
+
+func TestAuthManagerLegacyHashMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth_token.json")
+	sum := sha256.Sum256([]byte("legacy"))
+	legacy := fmt.Sprintf(`{"token_hash": %q, "expires_at": %q}`,
+		hex.EncodeToString(sum[:]), time.Now().Add(time.Hour).Format(time.RFC3339))
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatalf("write legacy state: %v", err)
+	}
+
+	mgr, err := NewAuthManager(path)
+	if err != nil {
+		t.Fatalf("new auth manager: %v", err)
+	}
+	if err := mgr.Validate("legacy"); err != nil {
+		t.Fatalf("legacy hash should still validate: %v", err)
+	}
+	if _, _, err := mgr.Login("wrong"); !errors.Is(err, ErrTokenMismatch) {
+		t.Fatalf("expected mismatch, got %v", err)
+	}
+	if _, created, err := mgr.Login("legacy"); err != nil || created {
+		t.Fatalf("login legacy: %v, created=%v", err, created)
+	}
+
+	content, _ := os.ReadFile(path)
+	if !strings.Contains(string(content), "$2") || strings.Contains(string(content), hex.EncodeToString(sum[:])) {
+		t.Fatalf("token hash should be migrated to bcrypt: %s", content)
+	}
+	if err := mgr.Validate("legacy"); err != nil {
+		t.Fatalf("validate after migration: %v", err)
+	}
+	if err := mgr.Validate("wrong"); !errors.Is(err, ErrTokenMismatch) {
+		t.Fatalf("expected mismatch after migration, got %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	BackupJobRunning   = "running"
+	BackupJobSucceeded = "succeeded"
+	BackupJobFailed    = "failed"
+
+	// maxBackupJobs 内存中保留的最近任务数
+	maxBackupJobs = 20
+)
+
+var ErrBackupJobNotFound = errors.New("备份任务不存在")
+
+// BackupJob 一次备份任务的进度。打包占前 50%，上传占 45%，远程校验完成后为 100%
+type BackupJob struct {
+	ID               string   `json:"id"`
+	Status           string   `json:"status"`
+	Stage            string   `json:"stage"`
+	Progress         int      `json:"progress"`
+	BytesDone        int64    `json:"bytes_done"`
+	BytesTotal       int64    `json:"bytes_total"`
+	Archive          string   `json:"archive,omitempty"`
+	Size             int64    `json:"size,omitempty"`
+	Destination      string   `json:"destination,omitempty"`
+	Logs             []string `json:"logs,omitempty"`
+	Error            string   `json:"error,omitempty"`
+	StartedUnixTime  int64    `json:"started_unix_time"`
+	FinishedUnixTime int64    `json:"finished_unix_time,omitempty"`
+}
+
+// backupJob 后台任务持有的可变状态，对外只返回 BackupJob 副本
+type backupJob struct {
+	mu    sync.Mutex
+	state BackupJob
+}
+
+func (j *backupJob) log(format string, args ...interface{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.state.Logs = append(j.state.Logs, time.Now().Format("15:04:05")+" "+fmt.Sprintf(format, args...))
+}
+
+func (j *backupJob) setArchive(name string, size int64, destination string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.state.Archive = name
+	j.state.Size = size
+	j.state.Destination = destination
+}
+
+// setStage 进入新阶段，bytesTotal 为该阶段需要处理的字节数
+func (j *backupJob) setStage(stage string, bytesTotal int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.state.Stage = stage
+	j.state.BytesDone = 0
+	j.state.BytesTotal = bytesTotal
+}
+
+// advance 记录当前阶段已处理的字节数，并换算为 [from, to] 区间内的总进度
+func (j *backupJob) advance(done int64, from, to int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.state.BytesTotal > 0 && done > j.state.BytesTotal {
+		done = j.state.BytesTotal
+	}
+	j.state.BytesDone = done
+	progress := from
+	if j.state.BytesTotal > 0 {
+		progress = from + int(int64(to-from)*done/j.state.BytesTotal)
+	}
+	if progress > j.state.Progress {
+		j.state.Progress = progress
+	}
+}
+
+// completeStage 当前阶段处理完毕，总进度推进到 to
+func (j *backupJob) completeStage(to int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.state.BytesDone = j.state.BytesTotal
+	if to > j.state.Progress {
+		j.state.Progress = to
+	}
+}
+
+func (j *backupJob) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.state.FinishedUnixTime = now.Unix()
+	if err != nil {
+		j.state.Status = BackupJobFailed
+		j.state.Error = err.Error()
+		j.state.Logs = append(j.state.Logs, now.Format("15:04:05")+" 备份失败: "+err.Error())
+		return
+	}
+	j.state.Status = BackupJobSucceeded
+	j.state.Progress = 100
+	j.state.Logs = append(j.state.Logs, now.Format("15:04:05")+" 备份完成")
+}
+
+// snapshot 返回任务的副本，避免调用方与后台任务并发读写
+func (j *backupJob) snapshot(withLogs bool) BackupJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job := j.state
+	job.Logs = nil
+	if withLogs {
+		job.Logs = append([]string(nil), j.state.Logs...)
+	}
+	return job
+}
+
+func newBackupJobID() string {
+	buf := make([]byte, 6)
+	rand.Read(buf)
+	return time.Now().Format("20060102150405") + "-" + hex.EncodeToString(buf)
+}
+
+// newJob 登记一个新任务，超出上限时丢弃最早的已结束任务
+func (s *BackupService) newJob() *backupJob {
+	job := &backupJob{state: BackupJob{ID: newBackupJobID(), Status: BackupJobRunning, Stage: "pending", StartedUnixTime: time.Now().Unix()}}
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	s.jobs = append(s.jobs, job)
+	if len(s.jobs) > maxBackupJobs {
+		s.jobs = append([]*backupJob(nil), s.jobs[len(s.jobs)-maxBackupJobs:]...)
+	}
+	return job
+}
+
+// StartBackup 在后台执行备份并立即返回任务，进度通过 Job 查询
+func (s *BackupService) StartBackup() (BackupJob, error) {
+	if !s.runMu.TryLock() {
+		return BackupJob{}, ErrBackupRunning
+	}
+	job := s.newJob()
+	go func() {
+		defer s.runMu.Unlock()
+		_, _ = s.executeJob(job)
+	}()
+	return job.snapshot(true), nil
+}
+
+func (s *BackupService) executeJob(job *backupJob) (BackupJob, error) {
+	started := time.Now()
+	err := s.runBackup(job)
+	s.recordRun(started, err)
+	job.finish(err)
+	return job.snapshot(false), err
+}
+
+// Job 返回指定任务的当前状态
+func (s *BackupService) Job(id string) (BackupJob, error) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	for _, job := range s.jobs {
+		if job.state.ID == id {
+			return job.snapshot(true), nil
+		}
+	}
+	return BackupJob{}, ErrBackupJobNotFound
+}
+
+// Jobs 返回最近的任务，最新的在前，不含日志
+func (s *BackupService) Jobs() []BackupJob {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	jobs := make([]BackupJob, 0, len(s.jobs))
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, s.jobs[i].snapshot(false))
+	}
+	return jobs
+}
+
+// estimateArchiveSize 统计待打包文件的总大小，用于估算打包进度
+func estimateArchiveSize(include, exclude []string) int64 {
+	var total int64
+	for _, root := range include {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			for _, item := range exclude {
+				if path == item || strings.HasPrefix(path, item+"/") {
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+			}
+			if info.Mode().IsRegular() {
+				total += info.Size()
+			}
+			return nil
+		})
+	}
+	return total
+}
+
+// rcloneCopyWithProgress 上传文件并解析 rclone 的 JSON 统计日志，按已传输字节回调
+func rcloneCopyWithProgress(src, dest string, progress func(done int64), logf func(format string, args ...interface{})) error {
+	cmd := exec.Command("rclone", "copyto", src, dest, "--stats", "1s", "--stats-log-level", "NOTICE", "--use-json-log")
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	var lastError string
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		var entry struct {
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+			Stats *struct {
+				Bytes int64 `json:"bytes"`
+			} `json:"stats"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			logf("%s", scanner.Text())
+			continue
+		}
+		if entry.Stats != nil {
+			progress(entry.Stats.Bytes)
+			continue
+		}
+		if entry.Level == "error" {
+			lastError = strings.TrimSpace(entry.Msg)
+		}
+		logf("%s", strings.TrimSpace(entry.Msg))
+	}
+	if err := cmd.Wait(); err != nil {
+		if lastError != "" {
+			return fmt.Errorf("%v: %s", err, lastError)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"nginx-mgr/internal/executor"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupManifestName 清单在归档根目录下的文件名，恢复时不会被复制到系统目录
+const backupManifestName = "nginx_backup_manifest.json"
+
+// BackupManifest 备份包内的文件清单，记录每个普通文件的大小与 SHA-256
+type BackupManifest struct {
+	Version         int                  `json:"version"`
+	CreatedUnixTime int64                `json:"created_unix_time"`
+	Files           []BackupManifestFile `json:"files"`
+}
+
+type BackupManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// BackupVerifyResult 备份包校验结果。旧版备份没有清单时只检查归档能否完整读取
+type BackupVerifyResult struct {
+	Archive     string   `json:"archive"`
+	HasManifest bool     `json:"has_manifest"`
+	Files       int      `json:"files"`
+	Missing     []string `json:"missing,omitempty"`
+	Mismatched  []string `json:"mismatched,omitempty"`
+	Unexpected  []string `json:"unexpected,omitempty"`
+	Valid       bool     `json:"valid"`
+}
+
+// summary 返回校验失败的简要说明
+func (r BackupVerifyResult) summary() string {
+	var parts []string
+	if len(r.Missing) > 0 {
+		parts = append(parts, fmt.Sprintf("缺少 %d 个文件", len(r.Missing)))
+	}
+	if len(r.Mismatched) > 0 {
+		parts = append(parts, fmt.Sprintf("%d 个文件校验和不一致", len(r.Mismatched)))
+	}
+	if len(r.Unexpected) > 0 {
+		parts = append(parts, fmt.Sprintf("%d 个文件不在清单中", len(r.Unexpected)))
+	}
+	return strings.Join(parts, "，")
+}
+
+// hashTarEntries 读取 tar 流并计算每个普通文件的 SHA-256，同时取出清单内容
+func hashTarEntries(r io.Reader) (map[string]BackupManifestFile, []byte, error) {
+	files := make(map[string]BackupManifestFile)
+	var manifest []byte
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return files, manifest, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(header.Name, "./")
+		if name == backupManifestName {
+			if manifest, err = io.ReadAll(io.LimitReader(reader, 64<<20)); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		hash := sha256.New()
+		size, err := io.Copy(hash, reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[name] = BackupManifestFile{Path: name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	}
+}
+
+// appendBackupManifest 为未压缩的 tar 生成清单并追加到归档末尾
+func appendBackupManifest(tarPath string) error {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	files, _, err := hashTarEntries(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("生成备份清单失败: %w", err)
+	}
+	manifest := BackupManifest{Version: 1, CreatedUnixTime: time.Now().Unix()}
+	for _, item := range files {
+		manifest.Files = append(manifest.Files, item)
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "backup_manifest")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, backupManifestName), data, 0600); err != nil {
+		return err
+	}
+	if out, err := executor.ExecuteSimple("tar", "-r", "-f", tarPath, "-C", dir, backupManifestName); err != nil {
+		if msg := strings.TrimSpace(out); msg != "" {
+			return fmt.Errorf("写入备份清单失败: %v: %s", err, msg)
+		}
+		return fmt.Errorf("写入备份清单失败: %w", err)
+	}
+	return nil
+}
+
+// verifyBackupArchive 逐个文件比对清单中的 SHA-256，归档损坏时返回 ErrInvalidBackupArchive
+func verifyBackupArchive(path string) (BackupVerifyResult, error) {
+	result := BackupVerifyResult{Archive: filepath.Base(path)}
+	file, err := os.Open(path)
+	if err != nil {
+		return result, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return result, fmt.Errorf("%w: 不是有效的 gzip 文件", ErrInvalidBackupArchive)
+	}
+	defer gz.Close()
+	files, manifestData, err := hashTarEntries(gz)
+	if err != nil {
+		return result, fmt.Errorf("%w: 读取归档失败: %v", ErrInvalidBackupArchive, err)
+	}
+	result.Files = len(files)
+	if manifestData == nil {
+		result.Valid = true
+		return result, nil
+	}
+
+	var manifest BackupManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return result, fmt.Errorf("%w: 清单格式错误: %v", ErrInvalidBackupArchive, err)
+	}
+	result.HasManifest = true
+	listed := make(map[string]bool, len(manifest.Files))
+	for _, expected := range manifest.Files {
+		listed[expected.Path] = true
+		actual, ok := files[expected.Path]
+		switch {
+		case !ok:
+			result.Missing = append(result.Missing, expected.Path)
+		case actual.Size != expected.Size || actual.SHA256 != expected.SHA256:
+			result.Mismatched = append(result.Mismatched, expected.Path)
+		}
+	}
+	for name := range files {
+		if !listed[name] {
+			result.Unexpected = append(result.Unexpected, name)
+		}
+	}
+	sort.Strings(result.Unexpected)
+	result.Valid = len(result.Missing) == 0 && len(result.Mismatched) == 0 && len(result.Unexpected) == 0
+	return result, nil
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultWebRoot = "/var/www/html"
+
+// BackupPathsSettings 备份打包范围。PanelState 时同时打包面板自身的账号、通知等状态，
+// SkipSecrets 时跳过其中含有密码、令牌和私钥的文件
+type BackupPathsSettings struct {
+	Include     []string `json:"include_paths"`
+	Exclude     []string `json:"exclude_paths"`
+	PanelState  bool     `json:"include_panel_state"`
+	SkipSecrets bool     `json:"skip_secrets"`
+}
+
+func defaultBackupIncludes(sourceDir string) []string {
+	if sourceDir == defaultWebRoot {
+		return []string{sourceDir}
+	}
+	return []string{sourceDir, defaultWebRoot}
+}
+
+func splitBackupPaths(value string) []string {
+	var paths []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			paths = append(paths, item)
+		}
+	}
+	return paths
+}
+
+// sanitizeBackupPaths 路径需为绝对路径，去重后按填写顺序返回
+func sanitizeBackupPaths(paths []string) ([]string, error) {
+	var result []string
+	seen := make(map[string]bool)
+	for _, item := range paths {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.ContainsAny(item, ",\r\n") {
+			return nil, fmt.Errorf("%w: 路径不能包含逗号或换行: %s", ErrInvalidBackupSettings, item)
+		}
+		if !filepath.IsAbs(item) {
+			return nil, fmt.Errorf("%w: 需使用绝对路径: %s", ErrInvalidBackupSettings, item)
+		}
+		item = filepath.Clean(item)
+		if item == "/" {
+			return nil, fmt.Errorf("%w: 不能备份整个根目录", ErrInvalidBackupSettings)
+		}
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// BackupPaths 返回本地与远程备份的打包范围
+func (s *BackupService) BackupPaths() (BackupPathsSettings, error) {
+	cfg, err := s.loadBackupConfig()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return BackupPathsSettings{Include: defaultBackupIncludes(model.NginxConfDir), PanelState: true}, nil
+		}
+		return BackupPathsSettings{}, err
+	}
+	return BackupPathsSettings{Include: cfg.Include, Exclude: cfg.Exclude, PanelState: cfg.PanelState, SkipSecrets: cfg.SkipSecrets}, nil
+}
+
+// archivePaths 返回实际打包的路径，包含面板状态文件
+func (s *BackupService) archivePaths() (include, exclude []string, err error) {
+	settings, err := s.BackupPaths()
+	if err != nil {
+		return nil, nil, err
+	}
+	include = settings.Include
+	if settings.PanelState {
+		include = append(append([]string{}, include...), panelStatePaths(settings.SkipSecrets)...)
+	}
+	return include, settings.Exclude, nil
+}
+
+// SaveBackupPaths 保存打包范围。恢复依赖 Nginx 配置，因此包含列表必须覆盖 /etc/nginx
+func (s *BackupService) SaveBackupPaths(settings BackupPathsSettings) (BackupPathsSettings, error) {
+	include, err := sanitizeBackupPaths(settings.Include)
+	if err != nil {
+		return BackupPathsSettings{}, err
+	}
+	exclude, err := sanitizeBackupPaths(settings.Exclude)
+	if err != nil {
+		return BackupPathsSettings{}, err
+	}
+	if len(include) == 0 {
+		include = defaultBackupIncludes(model.NginxConfDir)
+	}
+	coversNginx := false
+	for _, item := range include {
+		if item == model.NginxConfDir || strings.HasPrefix(model.NginxConfDir, item+"/") {
+			coversNginx = true
+		}
+	}
+	if !coversNginx {
+		return BackupPathsSettings{}, fmt.Errorf("%w: 包含目录必须包括 %s", ErrInvalidBackupSettings, model.NginxConfDir)
+	}
+	for _, item := range exclude {
+		if item == model.NginxConfDir || strings.HasPrefix(model.NginxConfDir, item+"/") {
+			return BackupPathsSettings{}, fmt.Errorf("%w: 不能排除 %s", ErrInvalidBackupSettings, model.NginxConfDir)
+		}
+	}
+	if err := s.writeBackupConfig([][2]string{
+		{"include_paths", strings.Join(include, ",")},
+		{"exclude_paths", strings.Join(exclude, ",")},
+		{"panel_state", strconv.FormatBool(settings.PanelState)},
+		{"skip_secrets", strconv.FormatBool(settings.SkipSecrets)},
+	}); err != nil {
+		return BackupPathsSettings{}, err
+	}
+	return BackupPathsSettings{Include: include, Exclude: exclude, PanelState: settings.PanelState, SkipSecrets: settings.SkipSecrets}, nil
+}
+
+// createBackupArchive 以根目录为基准打包 include 中存在的目录，恢复时按原位置还原。
+// 先生成未压缩的 tar 并追加文件清单，再整体压缩
+func createBackupArchive(dest string, include, exclude []string) error {
+	return writeBackupArchive(dest, include, exclude, nil)
+}
+
+// writeBackupArchive 同 createBackupArchive，progress 非空时每秒回调一次已写入 tar 的字节数
+func writeBackupArchive(dest string, include, exclude []string, progress func(done int64)) error {
+	compressor := "gzip"
+	if _, err := exec.LookPath("pigz"); err == nil {
+		compressor = "pigz"
+	}
+	tarPath := dest + ".tar"
+	args := []string{"-c", "-f", tarPath, "-C", "/"}
+	for _, item := range exclude {
+		args = append(args, "--exclude="+strings.TrimPrefix(filepath.Clean(item), "/"))
+	}
+	members := 0
+	for _, item := range include {
+		if _, err := os.Stat(item); err != nil {
+			continue
+		}
+		args = append(args, strings.TrimPrefix(filepath.Clean(item), "/"))
+		members++
+	}
+	if members == 0 {
+		return errors.New("没有可备份的目录")
+	}
+	defer os.Remove(tarPath)
+	if progress != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if info, err := os.Stat(tarPath); err == nil {
+						progress(info.Size())
+					}
+				}
+			}
+		}()
+	}
+	if out, err := executor.ExecuteSimple("tar", args...); err != nil {
+		if msg := strings.TrimSpace(out); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	if err := appendBackupManifest(tarPath); err != nil {
+		return err
+	}
+	if out, err := executor.ExecuteSimple(compressor, "-f", tarPath); err != nil {
+		os.Remove(tarPath + ".gz")
+		if msg := strings.TrimSpace(out); msg != "" {
+			return fmt.Errorf("压缩备份失败: %v: %s", err, msg)
+		}
+		return fmt.Errorf("压缩备份失败: %w", err)
+	}
+	return os.Rename(tarPath+".gz", dest)
+}
@@ -0,0 +1,433 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/bits"
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBackupCron      = "0 2 * * *"
+	backupSchedulerTick    = 30 * time.Second
+	legacyBackupCronMarker = "website_backup.py"
+)
+
+// cronSchedule 解析后的 5 段 cron 表达式：分 时 日 月 周
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron 表达式需为 5 段（分 时 日 月 周）: %q", expr)
+	}
+	schedule := &cronSchedule{}
+	var err error
+	if schedule.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if schedule.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if schedule.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// 周日可写作 0 或 7
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow |= 1
+	}
+	// 取值覆盖整个范围（如 1-31、0-7、*/1）的日或周字段等同于 *，不参与“满足其一”的判断
+	schedule.domAny = schedule.dom == cronFullRange(1, 31)
+	schedule.dowAny = schedule.dow&cronFullRange(0, 6) == cronFullRange(0, 6)
+	return schedule, nil
+}
+
+// cronFullRange 返回 min 到 max 全部取值的位集合
+func cronFullRange(min, max int) uint64 {
+	return (1<<uint(max+1) - 1) &^ (1<<uint(min) - 1)
+}
+
+// parseCronField 支持 *、列表、范围与步长，如 "*/15"、"1-5"、"0,30"
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			value, err := strconv.Atoi(part[idx+1:])
+			if err != nil || value <= 0 {
+				return 0, fmt.Errorf("cron 步长无效: %q", part)
+			}
+			step = value
+			part = part[:idx]
+		}
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("cron 范围无效: %q", part)
+			}
+		default:
+			value, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("cron 取值无效: %q", part)
+			}
+			lo, hi = value, value
+			if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("cron 取值超出范围 %d-%d: %q", min, max, part)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	// 与 crontab 一致：日和周同时限定时满足其一即可
+	if !c.domAny && !c.dowAny {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// Next 返回晚于 after 的下一个触发时间，表达式永远无法触发（如 2 月 30 日）时返回零值
+func (c *cronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			// 跳到本小时内下一个匹配的分钟
+			rest := c.minute >> uint(t.Minute())
+			if rest == 0 {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			} else {
+				t = t.Add(time.Duration(bits.TrailingZeros64(rest)) * time.Minute)
+			}
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *BackupService) loadScheduleLocked() (model.BackupSchedule, error) {
+	return loadBackupSchedule(s.schedulePath)
+}
+
+// loadBackupSchedule 读取定时备份状态文件，文件不存在时返回零值
+func loadBackupSchedule(path string) (model.BackupSchedule, error) {
+	var schedule model.BackupSchedule
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return schedule, nil
+		}
+		return schedule, err
+	}
+	if err := json.Unmarshal(content, &schedule); err != nil {
+		return schedule, fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+	return schedule, nil
+}
+
+func (s *BackupService) saveScheduleLocked(schedule model.BackupSchedule) error {
+	data, err := json.MarshalIndent(schedule, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.schedulePath, data, 0600)
+}
+
+// Schedule 返回定时备份状态
+func (s *BackupService) Schedule() (model.BackupSchedule, error) {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+	return s.loadScheduleLocked()
+}
+
+// 定时备份预设
+const (
+	BackupSchedulePresetHourly = "hourly"
+	BackupSchedulePresetDaily  = "daily"
+	BackupSchedulePresetWeekly = "weekly"
+	BackupSchedulePresetCustom = "custom"
+	BackupSchedulePresetOff    = "off"
+)
+
+// BackupScheduleRequest 定时备份设置：custom 直接使用 Cron，其余预设按时间生成表达式
+type BackupScheduleRequest struct {
+	Preset  string `json:"preset"`
+	Time    string `json:"time"`    // HH:MM，hourly 只使用分钟
+	Weekday int    `json:"weekday"` // weekly 使用，0 为周日
+	Cron    string `json:"cron"`
+}
+
+// cronExpr 生成并校验 cron 表达式，关闭定时备份时返回空字符串
+func (r BackupScheduleRequest) cronExpr() (string, error) {
+	preset := strings.ToLower(strings.TrimSpace(r.Preset))
+	if preset == BackupSchedulePresetOff {
+		return "", nil
+	}
+	if preset == BackupSchedulePresetCustom {
+		expr := strings.Join(strings.Fields(r.Cron), " ")
+		if _, err := parseCron(expr); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidBackupSettings, err)
+		}
+		return expr, nil
+	}
+	hour, minute := 2, 0
+	if value := strings.TrimSpace(r.Time); value != "" {
+		parsed, err := time.Parse("15:04", value)
+		if err != nil {
+			return "", fmt.Errorf("%w: 时间格式应为 HH:MM", ErrInvalidBackupSettings)
+		}
+		hour, minute = parsed.Hour(), parsed.Minute()
+	}
+	switch preset {
+	case BackupSchedulePresetHourly:
+		return fmt.Sprintf("%d * * * *", minute), nil
+	case "", BackupSchedulePresetDaily:
+		return fmt.Sprintf("%d %d * * *", minute, hour), nil
+	case BackupSchedulePresetWeekly:
+		if r.Weekday < 0 || r.Weekday > 6 {
+			return "", fmt.Errorf("%w: 星期需在 0-6 之间", ErrInvalidBackupSettings)
+		}
+		return fmt.Sprintf("%d %d * * %d", minute, hour, r.Weekday), nil
+	}
+	return "", fmt.Errorf("%w: 不支持的定时方式 %s", ErrInvalidBackupSettings, r.Preset)
+}
+
+// enableSchedule 完成备份配置后更新定时备份。req 为空时沿用已保存的设置（包括已关闭的状态），
+// 尚未设置时默认每天 02:00；表达式变化后重新计算下次执行时间
+func (s *BackupService) enableSchedule(req *BackupScheduleRequest) (model.BackupSchedule, error) {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+	schedule, err := s.loadScheduleLocked()
+	if err != nil {
+		return schedule, err
+	}
+	if req != nil {
+		expr, err := req.cronExpr()
+		if err != nil {
+			return schedule, err
+		}
+		if expr == "" {
+			schedule.Enabled = false
+			schedule.NextRunUnixTime = 0
+			return schedule, s.saveScheduleLocked(schedule)
+		}
+		schedule.Preset = strings.ToLower(strings.TrimSpace(req.Preset))
+		if schedule.Preset == "" {
+			schedule.Preset = BackupSchedulePresetDaily
+		}
+		if expr != schedule.Cron {
+			schedule.Cron = expr
+			schedule.NextRunUnixTime = 0
+		}
+		schedule.Enabled = true
+	}
+	if schedule.Cron == "" {
+		schedule.Cron = defaultBackupCron
+		schedule.Preset = BackupSchedulePresetDaily
+		schedule.Enabled = true
+	}
+	if !schedule.Enabled {
+		return schedule, nil
+	}
+	cron, err := parseCron(schedule.Cron)
+	if err != nil {
+		return schedule, err
+	}
+	if schedule.NextRunUnixTime == 0 {
+		schedule.NextRunUnixTime = cron.Next(time.Now()).Unix()
+	}
+	return schedule, s.saveScheduleLocked(schedule)
+}
+
+// recordRun 记录一次备份结果，手动与定时执行都会更新
+func (s *BackupService) recordRun(started time.Time, runErr error) {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+	schedule, err := s.loadScheduleLocked()
+	if err != nil {
+		log.Printf("[backup] 读取定时备份状态失败: %v", err)
+		return
+	}
+	schedule.LastRunUnixTime = started.Unix()
+	schedule.LastDurationMs = time.Since(started).Milliseconds()
+	schedule.LastSuccess = runErr == nil
+	schedule.LastError = ""
+	if runErr != nil {
+		schedule.LastError = runErr.Error()
+	}
+	if err := s.saveScheduleLocked(schedule); err != nil {
+		log.Printf("[backup] 保存定时备份状态失败: %v", err)
+	}
+}
+
+// claimDueRun 到期时先写入下一次执行时间再执行备份，避免备份途中重启导致重复执行
+func (s *BackupService) claimDueRun(now time.Time) (bool, error) {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+	schedule, err := s.loadScheduleLocked()
+	if err != nil || !schedule.Enabled {
+		return false, err
+	}
+	cron, err := parseCron(schedule.Cron)
+	if err != nil {
+		return false, err
+	}
+	due := schedule.NextRunUnixTime != 0 && now.Unix() >= schedule.NextRunUnixTime
+	next := cron.Next(now)
+	if next.IsZero() {
+		return false, fmt.Errorf("cron 表达式 %q 不会触发", schedule.Cron)
+	}
+	if !due && schedule.NextRunUnixTime != 0 {
+		return false, nil
+	}
+	schedule.NextRunUnixTime = next.Unix()
+	return due, s.saveScheduleLocked(schedule)
+}
+
+// migrateLegacyCron 旧版本把备份写进了 crontab，迁移到内置定时任务并删除原有条目，避免重复备份
+func (s *BackupService) migrateLegacyCron() error {
+	current, err := executor.ExecuteSimple("bash", "-c", "crontab -l 2>/dev/null || true")
+	if err != nil || !strings.Contains(current, legacyBackupCronMarker) {
+		return err
+	}
+	var kept []string
+	for _, line := range strings.Split(strings.TrimRight(current, "\n"), "\n") {
+		if !strings.Contains(line, legacyBackupCronMarker) {
+			kept = append(kept, line)
+		}
+	}
+	tempFile, err := os.CreateTemp("", "cron")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+	content := strings.Join(kept, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	if _, err := tempFile.WriteString(content); err != nil {
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	if _, err := executor.ExecuteSimple("crontab", tempFile.Name()); err != nil {
+		return fmt.Errorf("移除旧的备份定时任务失败: %w", err)
+	}
+	_, err = s.enableSchedule(nil)
+	return err
+}
+
+// BackupScheduler 按 cron 表达式在面板进程内执行远程备份，取代 crontab
+type BackupScheduler struct {
+	backup   *BackupService
+	notifier *NotificationDispatcher
+}
+
+// NewBackupScheduler backupSvc 为空时使用默认配置，notifier 为空时不发送备份结果通知
+func NewBackupScheduler(backupSvc *BackupService, notifier *NotificationDispatcher) *BackupScheduler {
+	if backupSvc == nil {
+		backupSvc = NewBackupService()
+	}
+	return &BackupScheduler{backup: backupSvc, notifier: notifier}
+}
+
+func (s *BackupScheduler) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := s.backup.migrateLegacyCron(); err != nil {
+		log.Printf("[backup] 迁移旧的定时任务失败: %v", err)
+	}
+	ticker := time.NewTicker(backupSchedulerTick)
+	defer ticker.Stop()
+
+	s.runDue()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runDue()
+		}
+	}
+}
+
+func (s *BackupScheduler) runDue() {
+	due, err := s.backup.claimDueRun(time.Now())
+	if err != nil {
+		log.Printf("[backup] 定时备份调度失败: %v", err)
+		return
+	}
+	if !due {
+		return
+	}
+	job, err := s.backup.RunBackup()
+	if err != nil {
+		log.Printf("[backup] 定时备份失败: %v", err)
+		if errors.Is(err, ErrBackupRunning) {
+			return
+		}
+	}
+	if s.notifier != nil {
+		s.notifier.NotifyBackup(job)
+	}
+}
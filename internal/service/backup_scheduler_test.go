@@ -0,0 +1,179 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	loc := time.UTC
+	base := time.Date(2026, 1, 30, 1, 59, 30, 0, loc) // 周五
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 2 * * *", time.Date(2026, 1, 30, 2, 0, 0, 0, loc)},
+		{"*/15 * * * *", time.Date(2026, 1, 30, 2, 0, 0, 0, loc)},
+		{"30 3 * * 1-5", time.Date(2026, 1, 30, 3, 30, 0, 0, loc)},
+		{"0 0 * * 7", time.Date(2026, 2, 1, 0, 0, 0, 0, loc)},
+		{"0 4 31 * *", time.Date(2026, 1, 31, 4, 0, 0, 0, loc)},
+		{"0 4 15 * 1", time.Date(2026, 2, 2, 4, 0, 0, 0, loc)}, // 日和周满足其一
+		// 覆盖整个范围的字段等同于 *，只按另一字段匹配
+		{"0 4 1-31 * 1", time.Date(2026, 2, 2, 4, 0, 0, 0, loc)},
+		{"0 4 */1 * 1", time.Date(2026, 2, 2, 4, 0, 0, 0, loc)},
+		{"0 4 15 * 0-6", time.Date(2026, 2, 15, 4, 0, 0, 0, loc)},
+		{"0 4 15 * 0-7", time.Date(2026, 2, 15, 4, 0, 0, 0, loc)},
+		{"0 4 15 * 1-5,0,6", time.Date(2026, 2, 15, 4, 0, 0, 0, loc)},
+		{"0 4 */2 * 1", time.Date(2026, 1, 31, 4, 0, 0, 0, loc)}, // 奇数日不是整个范围，仍与周满足其一
+		{"@monthly", time.Date(2026, 2, 1, 0, 0, 0, 0, loc)},
+	}
+	for _, tc := range cases {
+		schedule, err := parseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.expr, err)
+		}
+		if got := schedule.Next(base); !got.Equal(tc.want) {
+			t.Fatalf("%q: next = %s, want %s", tc.expr, got, tc.want)
+		}
+	}
+	for _, expr := range []string{"", "0 2 * *", "60 * * * *", "0 2 * * 8", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Fatalf("%q should be rejected", expr)
+		}
+	}
+	impossible, _ := parseCron("0 0 30 2 *")
+	if !impossible.Next(base).IsZero() {
+		t.Fatal("february 30th should never fire")
+	}
+}
+
+func TestBackupScheduleClaim(t *testing.T) {
+	svc := NewBackupService()
+	svc.schedulePath = filepath.Join(t.TempDir(), "backup_schedule.json")
+
+	if due, err := svc.claimDueRun(time.Now()); err != nil || due {
+		t.Fatalf("disabled schedule should not run: %v, %v", due, err)
+	}
+	schedule, err := svc.enableSchedule(nil)
+	if err != nil || schedule.Cron != defaultBackupCron || schedule.NextRunUnixTime == 0 {
+		t.Fatalf("enable schedule: %+v, %v", schedule, err)
+	}
+
+	next := time.Unix(schedule.NextRunUnixTime, 0)
+	if due, _ := svc.claimDueRun(next.Add(-time.Minute)); due {
+		t.Fatal("should not run before the next run time")
+	}
+	// 面板停机错过的任务在启动后补执行一次，并推到下一个周期
+	if due, err := svc.claimDueRun(next.Add(3 * time.Hour)); err != nil || !due {
+		t.Fatalf("missed run should be due: %v, %v", due, err)
+	}
+	if due, _ := svc.claimDueRun(next.Add(3 * time.Hour)); due {
+		t.Fatal("a claimed run must not be executed twice")
+	}
+	saved, _ := svc.Schedule()
+	if saved.NextRunUnixTime <= next.Unix() {
+		t.Fatalf("next run should move forward, got %d", saved.NextRunUnixTime)
+	}
+
+	svc.recordRun(time.Now(), ErrBackupRunning)
+	if saved, _ := svc.Schedule(); saved.LastSuccess || saved.LastError == "" || saved.LastRunUnixTime == 0 {
+		t.Fatalf("failed run should be recorded: %+v", saved)
+	}
+}
+
+func TestBackupScheduleRequest(t *testing.T) {
+	cases := []struct {
+		req  BackupScheduleRequest
+		want string
+	}{
+		{BackupScheduleRequest{}, "0 2 * * *"},
+		{BackupScheduleRequest{Preset: "daily", Time: "03:30"}, "30 3 * * *"},
+		{BackupScheduleRequest{Preset: "hourly", Time: "00:15"}, "15 * * * *"},
+		{BackupScheduleRequest{Preset: "weekly", Time: "04:00", Weekday: 0}, "0 4 * * 0"},
+		{BackupScheduleRequest{Preset: "custom", Cron: " */30  1-5 * * * "}, "*/30 1-5 * * *"},
+		{BackupScheduleRequest{Preset: "off"}, ""},
+	}
+	for _, tc := range cases {
+		got, err := tc.req.cronExpr()
+		if err != nil || got != tc.want {
+			t.Fatalf("%+v: got %q, %v; want %q", tc.req, got, err, tc.want)
+		}
+	}
+	for _, req := range []BackupScheduleRequest{
+		{Preset: "daily", Time: "25:00"},
+		{Preset: "weekly", Weekday: 7},
+		{Preset: "custom", Cron: "every day"},
+		{Preset: "monthly"},
+	} {
+		if _, err := req.cronExpr(); !errors.Is(err, ErrInvalidBackupSettings) {
+			t.Fatalf("%+v should be rejected, got %v", req, err)
+		}
+	}
+
+	svc := NewBackupService()
+	svc.schedulePath = filepath.Join(t.TempDir(), "backup_schedule.json")
+	first, _ := svc.enableSchedule(nil)
+	changed, err := svc.enableSchedule(&BackupScheduleRequest{Preset: "hourly", Time: "00:05"})
+	if err != nil || changed.Cron != "5 * * * *" || changed.NextRunUnixTime == first.NextRunUnixTime {
+		t.Fatalf("changing the schedule should reschedule: %+v, %v", changed, err)
+	}
+	if off, _ := svc.enableSchedule(&BackupScheduleRequest{Preset: "off"}); off.Enabled || off.Cron != "5 * * * *" {
+		t.Fatalf("turning off should keep the expression: %+v", off)
+	}
+	if due, _ := svc.claimDueRun(time.Now().Add(48 * time.Hour)); due {
+		t.Fatal("disabled schedule must not run")
+	}
+	if kept, _ := svc.enableSchedule(nil); kept.Enabled {
+		t.Fatal("saving without a schedule must not re-enable it")
+	}
+}
+
+func TestBackupJobs(t *testing.T) {
+	svc := NewBackupService()
+	dir := t.TempDir()
+	svc.schedulePath = filepath.Join(dir, "backup_schedule.json")
+	svc.backupConfigPath = filepath.Join(dir, "backup_config.conf")
+
+	// 未完成配置时任务失败，并记录错误与日志
+	job, err := svc.StartBackup()
+	if err != nil || job.Status != BackupJobRunning {
+		t.Fatalf("start backup: %+v, %v", job, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		current, err := svc.Job(job.ID)
+		if err != nil {
+			t.Fatalf("job: %v", err)
+		}
+		if current.Status != BackupJobRunning {
+			if current.Status != BackupJobFailed || current.Error == "" || len(current.Logs) == 0 || current.FinishedUnixTime == 0 {
+				t.Fatalf("unexpected finished job %+v", current)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := svc.RunBackup(); err == nil {
+		t.Fatal("run backup without config should fail")
+	}
+	jobs := svc.Jobs()
+	if len(jobs) != 2 || jobs[1].ID != job.ID || jobs[0].Logs != nil {
+		t.Fatalf("jobs should be listed newest first without logs: %+v", jobs)
+	}
+	if _, err := svc.Job("missing"); !errors.Is(err, ErrBackupJobNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	probe := &backupJob{state: BackupJob{Status: BackupJobRunning}}
+	probe.setStage("upload", 200)
+	probe.advance(100, 50, 95)
+	if state := probe.snapshot(false); state.Progress != 72 || state.BytesDone != 100 {
+		t.Fatalf("unexpected progress %+v", state)
+	}
+}
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"nginx-mgr/internal/model"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrInvalidBackupSettings = errors.New("备份存储配置无效")
+
+// rclone 中各服务商对应的 provider 取值；Backblaze B2 的 S3 接口按通用服务处理
+var rcloneS3Providers = map[string]string{
+	model.S3ProviderCloudflare: "Cloudflare",
+	model.S3ProviderAWS:        "AWS",
+	model.S3ProviderMinio:      "Minio",
+	model.S3ProviderB2:         "Other",
+	model.S3ProviderOther:      "Other",
+}
+
+// rclone 中各 WebDAV 服务对应的 vendor 取值
+var rcloneWebDAVVendors = map[string]string{
+	model.WebDAVVendorNextcloud:  "nextcloud",
+	model.WebDAVVendorOwncloud:   "owncloud",
+	model.WebDAVVendorJianguoyun: "other",
+	model.WebDAVVendorOther:      "other",
+}
+
+// sanitizeBackupSettings 只校验当前启用的目标类型，其余类型的参数原样保留，便于来回切换
+func sanitizeBackupSettings(input model.BackupSettings) (model.BackupSettings, error) {
+	output := input
+	if output.Type == "" {
+		output.Type = model.BackupTargetS3
+	}
+	var err error
+	switch output.Type {
+	case model.BackupTargetS3:
+		output.S3, err = sanitizeS3Target(input.S3)
+	case model.BackupTargetSFTP:
+		output.SFTP, err = sanitizeSFTPTarget(input.SFTP)
+	case model.BackupTargetWebDAV:
+		output.WebDAV, err = sanitizeWebDAVTarget(input.WebDAV)
+	case model.BackupTargetRclone:
+		output.Remote = strings.TrimSpace(input.Remote)
+		if !rcloneRemoteNamePattern.MatchString(output.Remote) {
+			err = fmt.Errorf("%w: 请选择有效的 rclone remote", ErrInvalidBackupSettings)
+		}
+	default:
+		return model.BackupSettings{}, fmt.Errorf("%w: 不支持的存储类型 %s", ErrInvalidBackupSettings, input.Type)
+	}
+	if err != nil {
+		return model.BackupSettings{}, err
+	}
+	return output, nil
+}
+
+func sanitizeS3Target(target model.S3BackupTarget) (model.S3BackupTarget, error) {
+	target.Provider = strings.ToLower(strings.TrimSpace(target.Provider))
+	if target.Provider == "" {
+		target.Provider = model.S3ProviderCloudflare
+	}
+	if _, ok := rcloneS3Providers[target.Provider]; !ok {
+		return model.S3BackupTarget{}, fmt.Errorf("%w: 不支持的服务商 %s", ErrInvalidBackupSettings, target.Provider)
+	}
+	target.AccessKey = strings.TrimSpace(target.AccessKey)
+	target.SecretKey = strings.TrimSpace(target.SecretKey)
+	target.Endpoint = strings.TrimRight(strings.TrimSpace(target.Endpoint), "/")
+	target.Region = strings.TrimSpace(target.Region)
+	for _, value := range []string{target.AccessKey, target.SecretKey, target.Endpoint, target.Region} {
+		// 写入 rclone.conf 的值不能包含换行，否则可注入任意配置项
+		if strings.ContainsAny(value, "\r\n") {
+			return model.S3BackupTarget{}, fmt.Errorf("%w: 参数不能包含换行", ErrInvalidBackupSettings)
+		}
+	}
+	if target.AccessKey == "" || target.SecretKey == "" {
+		return model.S3BackupTarget{}, fmt.Errorf("%w: Access Key 与 Secret Key 不能为空", ErrInvalidBackupSettings)
+	}
+
+	if target.Endpoint != "" {
+		if !strings.Contains(target.Endpoint, "://") {
+			target.Endpoint = "https://" + target.Endpoint
+		}
+		parsed, err := url.Parse(target.Endpoint)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return model.S3BackupTarget{}, fmt.Errorf("%w: Endpoint 格式不正确", ErrInvalidBackupSettings)
+		}
+	}
+	switch target.Provider {
+	case model.S3ProviderAWS:
+		if target.Region == "" {
+			target.Region = "us-east-1"
+		}
+	case model.S3ProviderCloudflare:
+		if target.Region == "" {
+			target.Region = "auto"
+		}
+		fallthrough
+	default:
+		if target.Endpoint == "" {
+			return model.S3BackupTarget{}, fmt.Errorf("%w: 该服务商需要填写 Endpoint", ErrInvalidBackupSettings)
+		}
+	}
+	return target, nil
+}
+
+func sanitizeSFTPTarget(target model.SFTPBackupTarget) (model.SFTPBackupTarget, error) {
+	target.Host = strings.TrimSpace(target.Host)
+	target.User = strings.TrimSpace(target.User)
+	target.KeyFile = strings.TrimSpace(target.KeyFile)
+	target.PrivateKey = strings.TrimSpace(target.PrivateKey)
+	for _, value := range []string{target.Host, target.User, target.Password, target.KeyFile} {
+		if strings.ContainsAny(value, "\r\n") {
+			return model.SFTPBackupTarget{}, fmt.Errorf("%w: 参数不能包含换行", ErrInvalidBackupSettings)
+		}
+	}
+	if target.Host == "" || strings.ContainsAny(target.Host, " /") {
+		return model.SFTPBackupTarget{}, fmt.Errorf("%w: 主机地址不正确", ErrInvalidBackupSettings)
+	}
+	if target.Port == 0 {
+		target.Port = 22
+	}
+	if target.Port < 1 || target.Port > 65535 {
+		return model.SFTPBackupTarget{}, fmt.Errorf("%w: 端口需在 1-65535 之间", ErrInvalidBackupSettings)
+	}
+	if target.User == "" {
+		return model.SFTPBackupTarget{}, fmt.Errorf("%w: 用户名不能为空", ErrInvalidBackupSettings)
+	}
+	if target.KeyFile != "" && !filepath.IsAbs(target.KeyFile) {
+		return model.SFTPBackupTarget{}, fmt.Errorf("%w: 私钥文件需使用绝对路径", ErrInvalidBackupSettings)
+	}
+	if target.PrivateKey != "" && !strings.Contains(target.PrivateKey, "PRIVATE KEY") {
+		return model.SFTPBackupTarget{}, fmt.Errorf("%w: 私钥需为 PEM 格式", ErrInvalidBackupSettings)
+	}
+	if target.Password == "" && target.PrivateKey == "" && target.KeyFile == "" {
+		return model.SFTPBackupTarget{}, fmt.Errorf("%w: 需填写密码或私钥", ErrInvalidBackupSettings)
+	}
+	return target, nil
+}
+
+func sanitizeWebDAVTarget(target model.WebDAVBackupTarget) (model.WebDAVBackupTarget, error) {
+	target.Vendor = strings.ToLower(strings.TrimSpace(target.Vendor))
+	if target.Vendor == "" {
+		target.Vendor = model.WebDAVVendorOther
+	}
+	if _, ok := rcloneWebDAVVendors[target.Vendor]; !ok {
+		return model.WebDAVBackupTarget{}, fmt.Errorf("%w: 不支持的 WebDAV 服务 %s", ErrInvalidBackupSettings, target.Vendor)
+	}
+	target.URL = strings.TrimSpace(target.URL)
+	target.User = strings.TrimSpace(target.User)
+	if target.URL == "" && target.Vendor == model.WebDAVVendorJianguoyun {
+		target.URL = "https://dav.jianguoyun.com/dav/"
+	}
+	for _, value := range []string{target.URL, target.User, target.Password} {
+		if strings.ContainsAny(value, "\r\n") {
+			return model.WebDAVBackupTarget{}, fmt.Errorf("%w: 参数不能包含换行", ErrInvalidBackupSettings)
+		}
+	}
+	parsed, err := url.Parse(target.URL)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return model.WebDAVBackupTarget{}, fmt.Errorf("%w: WebDAV 地址格式不正确", ErrInvalidBackupSettings)
+	}
+	if target.User == "" || target.Password == "" {
+		return model.WebDAVBackupTarget{}, fmt.Errorf("%w: 用户名与密码不能为空", ErrInvalidBackupSettings)
+	}
+	return target, nil
+}
+
+// loadBackupSettings 读取备份存储配置；旧版本只写了 rclone.conf 时从中导入 Cloudflare R2 配置
+func (s *BackupService) loadBackupSettings() (model.BackupSettings, error) {
+	content, err := os.ReadFile(s.settingsPath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return model.BackupSettings{}, err
+		}
+		legacy, lerr := s.loadRcloneConfig()
+		if lerr != nil {
+			if errors.Is(lerr, os.ErrNotExist) {
+				return model.BackupSettings{}, ErrRcloneRemoteNotConfigured
+			}
+			return model.BackupSettings{}, lerr
+		}
+		return model.BackupSettings{
+			Type: model.BackupTargetS3,
+			S3: model.S3BackupTarget{
+				Provider:  model.S3ProviderCloudflare,
+				AccessKey: legacy.AccessKey,
+				SecretKey: legacy.SecretKey,
+				Endpoint:  legacy.Endpoint,
+				Region:    "auto",
+			},
+		}, nil
+	}
+	var settings model.BackupSettings
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return model.BackupSettings{}, fmt.Errorf("解析 %s 失败: %w", s.settingsPath, err)
+	}
+	return settings, nil
+}
+
+func (s *BackupService) saveBackupSettings(settings model.BackupSettings) error {
+	settings.LastUpdatedUnixTime = time.Now().Unix()
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.settingsPath), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.settingsPath, data, 0600)
+}
+
+// rcloneObscure 按 rclone 的要求混淆 SFTP、WebDAV 密码，通过标准输入传递以免出现在进程参数中
+var rcloneObscure = func(password string) (string, error) {
+	cmd := exec.Command("rclone", "obscure", "-")
+	cmd.Stdin = strings.NewReader(password)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("rclone obscure 失败: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// sftpKeyPath 面板保存的 SFTP 私钥文件，与 rclone.conf 放在同一目录
+func (s *BackupService) sftpKeyPath() string {
+	return filepath.Join(filepath.Dir(s.rcloneConfigPath), "backup_sftp.key")
+}
+
+// normalizeRemotePath S3 路径以 bucket 开头，去掉首尾斜杠；SFTP 与自定义 remote 保留开头的斜杠以支持绝对路径
+func normalizeRemotePath(targetType, remotePath string) string {
+	remotePath = strings.TrimRight(strings.TrimSpace(remotePath), "/")
+	if targetType != model.BackupTargetSFTP && targetType != model.BackupTargetRclone {
+		remotePath = strings.TrimLeft(remotePath, "/")
+	}
+	return remotePath
+}
+
+// rcloneRemoteSection 生成备份存储对应的 rclone 配置段
+func (s *BackupService) rcloneRemoteSection(settings model.BackupSettings) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s]\n", s.rcloneRemote)
+	if settings.Type == model.BackupTargetSFTP {
+		target := settings.SFTP
+		b.WriteString("type = sftp\n")
+		fmt.Fprintf(&b, "host = %s\n", target.Host)
+		fmt.Fprintf(&b, "user = %s\n", target.User)
+		fmt.Fprintf(&b, "port = %d\n", target.Port)
+		if target.Password != "" {
+			obscured, err := rcloneObscure(target.Password)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, "pass = %s\n", obscured)
+		}
+		switch {
+		case target.PrivateKey != "":
+			fmt.Fprintf(&b, "key_file = %s\n", s.sftpKeyPath())
+		case target.KeyFile != "":
+			fmt.Fprintf(&b, "key_file = %s\n", target.KeyFile)
+		}
+		return b.String(), nil
+	}
+	if settings.Type == model.BackupTargetWebDAV {
+		target := settings.WebDAV
+		obscured, err := rcloneObscure(target.Password)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("type = webdav\n")
+		fmt.Fprintf(&b, "url = %s\n", target.URL)
+		fmt.Fprintf(&b, "vendor = %s\n", rcloneWebDAVVendors[target.Vendor])
+		fmt.Fprintf(&b, "user = %s\n", target.User)
+		fmt.Fprintf(&b, "pass = %s\n", obscured)
+		return b.String(), nil
+	}
+
+	target := settings.S3
+	b.WriteString("type = s3\n")
+	fmt.Fprintf(&b, "provider = %s\n", rcloneS3Providers[target.Provider])
+	fmt.Fprintf(&b, "access_key_id = %s\n", target.AccessKey)
+	fmt.Fprintf(&b, "secret_access_key = %s\n", target.SecretKey)
+	if target.Region != "" {
+		fmt.Fprintf(&b, "region = %s\n", target.Region)
+	}
+	if target.Endpoint != "" {
+		fmt.Fprintf(&b, "endpoint = %s\n", target.Endpoint)
+	}
+	if target.PathStyle != nil {
+		fmt.Fprintf(&b, "force_path_style = %t\n", *target.PathStyle)
+	}
+	return b.String(), nil
+}
@@ -1,52 +1,114 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"nginx-mgr/internal/executor"
 	"nginx-mgr/internal/model"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type BackupService struct {
+	settingsPath     string
 	rcloneConfigPath string
 	backupConfigPath string
-	backupScriptPath string
 	backupDir        string
 	rcloneRemote     string
+	schedulePath     string
+
+	scheduleMu sync.Mutex
+	runMu      sync.Mutex // 手动与定时备份不能同时执行
+	jobsMu     sync.Mutex
+	jobs       []*backupJob
 }
 
-var ErrRcloneRemoteNotConfigured = errors.New("Cloudflare R2 未配置")
+// localBackupDir 本地备份文件目录
+const localBackupDir = "/root/nginx_backups"
+
+// backupSchedulePath 定时备份状态文件，通知日报也从这里读取最近一次备份结果
+const backupSchedulePath = "/root/backup_schedule.json"
+
+var (
+	ErrRcloneRemoteNotConfigured = errors.New("远程备份存储未配置")
+	ErrBackupRunning             = errors.New("已有备份任务正在执行，请稍后再试")
+	ErrBackupArchiveNotFound     = errors.New("备份文件不存在")
+)
 
-type R2SetupRequest struct {
-	AccessKey  string `json:"access_key"`
-	SecretKey  string `json:"secret_key"`
-	Endpoint   string `json:"endpoint"`
-	SourceDir  string `json:"source_dir"`
-	RemotePath string `json:"remote_path"`
-	SkipBackup bool   `json:"skip_initial_backup"`
+// BackupSetupRequest 留空的存储参数沿用已保存的值；更换服务商时不沿用 Endpoint、Region 等服务商相关参数。
+// Type 为空时沿用当前的存储类型，S3 参数平铺以兼容旧版本的请求。
+type BackupSetupRequest struct {
+	Type       string                   `json:"type"`
+	SFTP       model.SFTPBackupTarget   `json:"sftp"`
+	WebDAV     model.WebDAVBackupTarget `json:"webdav"`
+	Remote     string                   `json:"remote"` // Type 为 rclone 时引用的 remote 名称
+	Provider   string                   `json:"provider"`
+	AccessKey  string                   `json:"access_key"`
+	SecretKey  string                   `json:"secret_key"`
+	Endpoint   string                   `json:"endpoint"`
+	Region     string                   `json:"region"`
+	PathStyle  *bool                    `json:"path_style"`
+	SourceDir  string                   `json:"source_dir"`
+	RemotePath string                   `json:"remote_path"`
+	SkipBackup bool                     `json:"skip_initial_backup"`
+	Schedule   *BackupScheduleRequest   `json:"schedule,omitempty"` // 为空时沿用已保存的定时设置
 }
 
 type BackupStatus struct {
-	RcloneConfigured bool   `json:"rclone_configured"`
-	BackupConfigured bool   `json:"backup_configured"`
-	SourceDir        string `json:"source_dir"`
-	RemotePath       string `json:"remote_path"`
-	AccessKey        string `json:"access_key"`
-	Endpoint         string `json:"endpoint"`
-	HasSecret        bool   `json:"has_secret"`
+	RcloneConfigured bool     `json:"rclone_configured"`
+	BackupConfigured bool     `json:"backup_configured"`
+	SourceDir        string   `json:"source_dir"`
+	RemotePath       string   `json:"remote_path"`
+	Type             string   `json:"type"`
+	Provider         string   `json:"provider"`
+	AccessKey        string   `json:"access_key"`
+	Endpoint         string   `json:"endpoint"`
+	Region           string   `json:"region"`
+	PathStyle        *bool    `json:"path_style,omitempty"`
+	HasSecret        bool     `json:"has_secret"`
+	SFTPHost         string   `json:"sftp_host,omitempty"`
+	SFTPPort         int      `json:"sftp_port,omitempty"`
+	SFTPUser         string   `json:"sftp_user,omitempty"`
+	SFTPKeyFile      string   `json:"sftp_key_file,omitempty"`
+	SFTPHasPassword  bool     `json:"sftp_has_password"`
+	SFTPHasKey       bool     `json:"sftp_has_key"`
+	WebDAVVendor     string   `json:"webdav_vendor,omitempty"`
+	WebDAVURL        string   `json:"webdav_url,omitempty"`
+	WebDAVUser       string   `json:"webdav_user,omitempty"`
+	WebDAVHasPass    bool     `json:"webdav_has_password"`
+	Remote           string   `json:"remote,omitempty"`
+	ScheduleEnabled  bool     `json:"schedule_enabled"`
+	SchedulePreset   string   `json:"schedule_preset,omitempty"`
+	ScheduleCron     string   `json:"schedule_cron,omitempty"`
+	NextRunUnixTime  int64    `json:"next_run_unix_time,omitempty"`
+	LastRunUnixTime  int64    `json:"last_run_unix_time,omitempty"`
+	LastRunSuccess   bool     `json:"last_run_success"`
+	LastRunError     string   `json:"last_run_error,omitempty"`
+	IncludePaths     []string `json:"include_paths"`
+	ExcludePaths     []string `json:"exclude_paths"`
+	PanelState       bool     `json:"include_panel_state"`
+	SkipSecrets      bool     `json:"skip_secrets"`
 }
 
 type backupConfig struct {
-	SourceDir  string
-	RemotePath string
+	SourceDir   string
+	RemotePath  string
+	Include     []string // 需要打包的目录，未配置时为 SourceDir 与 /var/www/html
+	Exclude     []string
+	PanelState  bool // 默认打包面板状态
+	SkipSecrets bool
 }
 
+// rcloneConfig 旧版本直接写入 rclone.conf 的 R2 凭证，仅用于迁移
 type rcloneConfig struct {
 	AccessKey string
 	SecretKey string
@@ -101,37 +163,150 @@ func (s *BackupService) loadRcloneConfig() (*rcloneConfig, error) {
 
 func NewBackupService() *BackupService {
 	return &BackupService{
+		settingsPath:     "/root/backup_settings.json",
 		rcloneConfigPath: "/root/.config/rclone/rclone.conf",
 		backupConfigPath: "/root/backup_config.conf",
-		backupScriptPath: "/root/website_backup.py",
-		backupDir:        "/root/nginx_backups",
-		rcloneRemote:     "r2",
+		backupDir:        localBackupDir,
+		rcloneRemote:     "r2", // 备份脚本使用该 remote 名称，更换服务商后保持不变
+		schedulePath:     backupSchedulePath,
 	}
 }
 
-func (s *BackupService) SetupR2(req R2SetupRequest) (time.Time, bool, error) {
-	if err := s.ensureTools(); err != nil {
-		return time.Time{}, false, err
+// mergeSetupRequest 将请求中填写的存储参数合并到已保存的配置上
+func mergeSetupRequest(current model.BackupSettings, req BackupSetupRequest) model.BackupSettings {
+	merged := current
+	merged.Type = strings.ToLower(strings.TrimSpace(req.Type))
+	if merged.Type == "" {
+		merged.Type = current.Type
 	}
-	accessKey := strings.TrimSpace(req.AccessKey)
-	secret := strings.TrimSpace(req.SecretKey)
-	endpoint := strings.TrimSpace(req.Endpoint)
-	shouldConfigure := accessKey != "" || secret != "" || endpoint != ""
-	if shouldConfigure {
-		if accessKey == "" || secret == "" || endpoint == "" {
-			return time.Time{}, false, errors.New("Cloudflare R2 凭证不能为空")
+	if merged.Type == "" {
+		merged.Type = model.BackupTargetS3
+	}
+	if merged.Type == model.BackupTargetSFTP {
+		merged.SFTP = mergeSFTPTarget(current.SFTP, req.SFTP)
+		return merged
+	}
+	if merged.Type == model.BackupTargetWebDAV {
+		merged.WebDAV = mergeWebDAVTarget(current.WebDAV, req.WebDAV)
+		return merged
+	}
+	if merged.Type == model.BackupTargetRclone {
+		if value := strings.TrimSpace(req.Remote); value != "" {
+			merged.Remote = value
 		}
-		if err := s.configureRclone(accessKey, secret, endpoint); err != nil {
-			return time.Time{}, false, err
+		return merged
+	}
+	provider := strings.ToLower(strings.TrimSpace(req.Provider))
+	if provider != "" && provider != current.S3.Provider {
+		merged.S3 = model.S3BackupTarget{
+			Provider:  provider,
+			AccessKey: current.S3.AccessKey,
+			SecretKey: current.S3.SecretKey,
 		}
-	} else {
-		if _, err := s.loadRcloneConfig(); err != nil {
-			if errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrRcloneRemoteNotConfigured) {
-				return time.Time{}, false, errors.New("尚未配置 Cloudflare R2 凭证，请填写后保存")
-			}
+	}
+	if value := strings.TrimSpace(req.AccessKey); value != "" {
+		merged.S3.AccessKey = value
+	}
+	if value := strings.TrimSpace(req.SecretKey); value != "" {
+		merged.S3.SecretKey = value
+	}
+	if value := strings.TrimSpace(req.Endpoint); value != "" {
+		merged.S3.Endpoint = value
+	}
+	if value := strings.TrimSpace(req.Region); value != "" {
+		merged.S3.Region = value
+	}
+	if req.PathStyle != nil {
+		merged.S3.PathStyle = req.PathStyle
+	}
+	return merged
+}
+
+// mergeSFTPTarget 密码与私钥二选一：填写新密码时清除已保存的私钥，反之亦然
+func mergeSFTPTarget(current, req model.SFTPBackupTarget) model.SFTPBackupTarget {
+	merged := current
+	if value := strings.TrimSpace(req.Host); value != "" {
+		merged.Host = value
+	}
+	if req.Port != 0 {
+		merged.Port = req.Port
+	}
+	if value := strings.TrimSpace(req.User); value != "" {
+		merged.User = value
+	}
+	switch {
+	case req.Password != "":
+		merged.Password = req.Password
+		merged.PrivateKey = ""
+		merged.KeyFile = ""
+	case strings.TrimSpace(req.PrivateKey) != "":
+		merged.PrivateKey = req.PrivateKey
+		merged.KeyFile = ""
+		merged.Password = ""
+	case strings.TrimSpace(req.KeyFile) != "":
+		merged.KeyFile = req.KeyFile
+		merged.PrivateKey = ""
+		merged.Password = ""
+	}
+	return merged
+}
+
+// mergeWebDAVTarget 更换 WebDAV 服务时不沿用原地址
+func mergeWebDAVTarget(current, req model.WebDAVBackupTarget) model.WebDAVBackupTarget {
+	merged := current
+	if vendor := strings.ToLower(strings.TrimSpace(req.Vendor)); vendor != "" && vendor != current.Vendor {
+		merged.Vendor = vendor
+		merged.URL = ""
+	}
+	if value := strings.TrimSpace(req.URL); value != "" {
+		merged.URL = value
+	}
+	if value := strings.TrimSpace(req.User); value != "" {
+		merged.User = value
+	}
+	if req.Password != "" {
+		merged.Password = req.Password
+	}
+	return merged
+}
+
+// remoteTargetType 返回当前备份目标类型，未配置时按 S3 处理
+func (s *BackupService) remoteTargetType() string {
+	settings, err := s.loadBackupSettings()
+	if err != nil || settings.Type == "" {
+		return model.BackupTargetS3
+	}
+	return settings.Type
+}
+
+func (s *BackupService) Setup(req BackupSetupRequest) (time.Time, bool, error) {
+	if req.Schedule != nil {
+		// 先校验定时设置，避免写入存储配置后才报错
+		if _, err := req.Schedule.cronExpr(); err != nil {
 			return time.Time{}, false, err
 		}
 	}
+	if err := s.ensureTools(); err != nil {
+		return time.Time{}, false, err
+	}
+	current, err := s.loadBackupSettings()
+	if err != nil && !errors.Is(err, ErrRcloneRemoteNotConfigured) {
+		return time.Time{}, false, err
+	}
+	merged := mergeSetupRequest(current, req)
+	if merged.Type == model.BackupTargetS3 && merged.S3.AccessKey == "" && merged.S3.SecretKey == "" {
+		return time.Time{}, false, errors.New("尚未配置备份存储凭证，请填写后保存")
+	}
+	settings, err := sanitizeBackupSettings(merged)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if err := s.configureRclone(settings); err != nil {
+		return time.Time{}, false, err
+	}
+	if err := s.saveBackupSettings(settings); err != nil {
+		return time.Time{}, false, err
+	}
 	if err := s.testRclone(); err != nil {
 		return time.Time{}, false, err
 	}
@@ -141,13 +316,14 @@ func (s *BackupService) SetupR2(req R2SetupRequest) (time.Time, bool, error) {
 
 	var firstBackup bool
 	if !req.SkipBackup {
-		if err := s.RunBackup(); err != nil {
+		if _, err := s.RunBackup(); err != nil {
 			return time.Time{}, false, fmt.Errorf("执行首次备份失败: %w", err)
 		}
 		firstBackup = true
 	}
 
-	if err := s.ensureCron(); err != nil {
+	schedule, err := s.enableSchedule(req.Schedule)
+	if err != nil {
 		return time.Time{}, firstBackup, err
 	}
 
@@ -160,50 +336,113 @@ func (s *BackupService) SetupR2(req R2SetupRequest) (time.Time, bool, error) {
 		return time.Time{}, firstBackup, err
 	}
 
-	return time.Now().Add(24 * time.Hour), firstBackup, nil
+	if !schedule.Enabled {
+		return time.Time{}, firstBackup, nil
+	}
+	return time.Unix(schedule.NextRunUnixTime, 0), firstBackup, nil
 }
 
-func (s *BackupService) RunBackup() error {
-	if _, err := os.Stat(s.backupScriptPath); err != nil {
-		return errors.New("备份脚本不存在，请先完成 R2 配置")
+// RunBackup 同步执行备份，供定时任务与首次配置使用，同样会登记为备份任务
+func (s *BackupService) RunBackup() (BackupJob, error) {
+	if !s.runMu.TryLock() {
+		return BackupJob{}, ErrBackupRunning
 	}
+	defer s.runMu.Unlock()
+	return s.executeJob(s.newJob())
+}
+
+// runBackup 按备份配置中的目录打包并上传到远程存储
+func (s *BackupService) runBackup(job *backupJob) error {
 	cfg, err := s.loadBackupConfig()
 	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return errors.New("请先完成备份配置")
+		}
 		return err
 	}
 	if cfg.RemotePath == "" {
 		return errors.New("未配置远程存储路径")
 	}
-	cmd := fmt.Sprintf("cd %s && /usr/bin/python3 %s", filepath.Dir(s.backupScriptPath), s.backupScriptPath)
-	out, err := executor.ExecuteSimple("bash", "-c", cmd)
+	if err := os.MkdirAll(s.backupDir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("nginx_backup_%s.tar.gz", time.Now().Format("20060102_150405"))
+	localFile := filepath.Join(s.backupDir, name)
+	include, exclude, err := s.archivePaths()
 	if err != nil {
-		msg := strings.TrimSpace(out)
-		if msg == "" {
-			msg = err.Error()
-		}
-		return fmt.Errorf("备份脚本执行失败: %s", msg)
+		return err
+	}
+
+	job.setStage("archive", estimateArchiveSize(include, exclude))
+	job.log("开始打包 %s", strings.Join(include, ", "))
+	if err := writeBackupArchive(localFile, include, exclude, func(done int64) { job.advance(done, 0, 50) }); err != nil {
+		return fmt.Errorf("打包备份失败: %w", err)
+	}
+	// 上传后删除本地副本，本地备份由 /system/backup 单独生成
+	defer os.Remove(localFile)
+	info, err := os.Stat(localFile)
+	if err != nil {
+		return err
+	}
+	job.completeStage(50)
+	job.log("打包完成 %s，共 %d 字节", name, info.Size())
+
+	remoteFile := fmt.Sprintf("%s:%s/%s", s.activeRemote(), normalizeRemotePath(s.remoteTargetType(), cfg.RemotePath), name)
+	job.setArchive(name, info.Size(), remoteFile)
+	job.setStage("upload", info.Size())
+	job.log("开始上传到 %s", remoteFile)
+	if err := rcloneCopyWithProgress(localFile, remoteFile, func(done int64) { job.advance(done, 50, 95) }, job.log); err != nil {
+		return fmt.Errorf("上传备份失败: %w", err)
 	}
-	return s.verifyRemote(cfg)
+	job.completeStage(95)
+	job.log("上传完成")
+
+	job.setStage("verify", 0)
+	if err := s.verifyRemote(cfg); err != nil {
+		return err
+	}
+	job.log("远程存储校验通过")
+	return nil
 }
 
-func (s *BackupService) RestoreLatest(remote string) error {
+// BackupArchive 远程存储中的一个备份包
+type BackupArchive struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// resolveRemote 将用户填写的远程路径转换为 rclone 路径，留空时使用备份配置中的路径
+func (s *BackupService) resolveRemote(remote string) (string, error) {
 	cfg, err := s.loadBackupConfig()
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		return err
+		return "", err
 	}
 
 	remotePath := strings.TrimSpace(remote)
-	if remotePath == "" && cfg.RemotePath != "" {
-		remotePath = fmt.Sprintf("%s:%s", s.rcloneRemote, strings.Trim(cfg.RemotePath, "/"))
+	if remotePath == "" && cfg != nil && cfg.RemotePath != "" {
+		remotePath = fmt.Sprintf("%s:%s", s.activeRemote(), normalizeRemotePath(s.remoteTargetType(), cfg.RemotePath))
 	} else if remotePath == "" {
-		return errors.New("请提供 R2 存储路径")
+		return "", errors.New("请提供远程存储路径")
 	} else if !strings.Contains(remotePath, ":") {
-		remotePath = fmt.Sprintf("%s:%s", s.rcloneRemote, strings.Trim(remotePath, "/"))
+		remotePath = fmt.Sprintf("%s:%s", s.activeRemote(), normalizeRemotePath(s.remoteTargetType(), remotePath))
 	}
+	return remotePath, nil
+}
 
+// ListArchives 列出远程路径下的 .tar.gz 备份包，按时间倒序
+func (s *BackupService) ListArchives(remote string) ([]BackupArchive, error) {
+	remotePath, err := s.resolveRemote(remote)
+	if err != nil {
+		return nil, err
+	}
+	return s.listArchives(remotePath)
+}
+
+func (s *BackupService) listArchives(remotePath string) ([]BackupArchive, error) {
 	listJSON, err := executor.ExecuteSimple("rclone", "lsjson", remotePath)
 	if err != nil {
-		return fmt.Errorf("获取备份列表失败: %w", err)
+		return nil, fmt.Errorf("获取备份列表失败: %w", err)
 	}
 
 	type entry struct {
@@ -214,53 +453,192 @@ func (s *BackupService) RestoreLatest(remote string) error {
 	}
 	var entries []entry
 	if err := json.Unmarshal([]byte(listJSON), &entries); err != nil {
-		return fmt.Errorf("解析备份列表失败: %w", err)
+		return nil, fmt.Errorf("解析备份列表失败: %w", err)
 	}
 
-	var latest entry
+	archives := make([]BackupArchive, 0, len(entries))
 	for _, e := range entries {
 		if e.IsDir || !strings.HasSuffix(e.Name, ".tar.gz") {
 			continue
 		}
-		if latest.Name == "" || e.ModTime.After(latest.ModTime) {
-			latest = e
+		archives = append(archives, BackupArchive{Name: e.Name, Size: e.Size, ModTime: e.ModTime})
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].ModTime.After(archives[j].ModTime)
+	})
+	return archives, nil
+}
+
+// findArchive 只允许访问远程列表中存在的备份包，避免通过名称拼接访问其他路径
+func (s *BackupService) findArchive(remotePath, name string) (BackupArchive, error) {
+	archives, err := s.listArchives(remotePath)
+	if err != nil {
+		return BackupArchive{}, err
+	}
+	for _, a := range archives {
+		if a.Name == name {
+			return a, nil
 		}
 	}
-	if latest.Name == "" {
-		return errors.New("未找到 .tar.gz 备份文件")
+	return BackupArchive{}, fmt.Errorf("%w: %s", ErrBackupArchiveNotFound, name)
+}
+
+// OpenArchive 以流的方式读取远程备份包，调用方读取完毕后需关闭
+func (s *BackupService) OpenArchive(ctx context.Context, remote, name string) (io.ReadCloser, BackupArchive, error) {
+	remotePath, err := s.resolveRemote(remote)
+	if err != nil {
+		return nil, BackupArchive{}, err
+	}
+	archive, err := s.findArchive(remotePath, strings.TrimSpace(name))
+	if err != nil {
+		return nil, BackupArchive{}, err
+	}
+	cmd := exec.CommandContext(ctx, "rclone", "cat", fmt.Sprintf("%s/%s", strings.TrimRight(remotePath, "/"), archive.Name))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, BackupArchive{}, err
 	}
+	if err := cmd.Start(); err != nil {
+		return nil, BackupArchive{}, fmt.Errorf("读取备份文件失败: %w", err)
+	}
+	return &commandReader{ReadCloser: stdout, cmd: cmd}, archive, nil
+}
+
+// commandReader 关闭时等待子进程退出
+type commandReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *commandReader) Close() error {
+	r.ReadCloser.Close()
+	return r.cmd.Wait()
+}
 
-	tempDir, err := os.MkdirTemp("", "r2_restore")
+// Verify 下载远程备份包并校验清单中的 SHA-256，archive 留空时校验最新的备份
+func (s *BackupService) Verify(remote, archive string) (BackupVerifyResult, error) {
+	tempDir, err := os.MkdirTemp("", "backup_verify")
 	if err != nil {
-		return err
+		return BackupVerifyResult{}, err
 	}
 	defer os.RemoveAll(tempDir)
+	localFile, err := s.downloadArchive(remote, archive, tempDir)
+	if err != nil {
+		return BackupVerifyResult{}, err
+	}
+	return verifyBackupArchive(localFile)
+}
+
+// downloadArchive 将远程备份下载到 dir，archive 为空时下载最新的备份
+func (s *BackupService) downloadArchive(remote, archive, dir string) (string, error) {
+	remotePath, err := s.resolveRemote(remote)
+	if err != nil {
+		return "", err
+	}
+	selected, err := s.selectArchive(remotePath, archive)
+	if err != nil {
+		return "", err
+	}
+	localFile := filepath.Join(dir, selected.Name)
+	if _, err := executor.ExecuteSimple("rclone", "copyto", fmt.Sprintf("%s/%s", strings.TrimRight(remotePath, "/"), selected.Name), localFile); err != nil {
+		return "", fmt.Errorf("下载备份文件失败: %w", err)
+	}
+	return localFile, nil
+}
 
-	remoteFile := fmt.Sprintf("%s/%s", strings.TrimRight(remotePath, "/"), latest.Name)
-	localFile := filepath.Join(tempDir, latest.Name)
-	if _, err := executor.ExecuteSimple("rclone", "copyto", remoteFile, localFile); err != nil {
-		return fmt.Errorf("下载备份文件失败: %w", err)
+// selectArchive 返回指定名称的备份，name 为空时返回最新的备份
+func (s *BackupService) selectArchive(remotePath, name string) (BackupArchive, error) {
+	if name = strings.TrimSpace(name); name != "" {
+		return s.findArchive(remotePath, name)
+	}
+	archives, err := s.listArchives(remotePath)
+	if err != nil {
+		return BackupArchive{}, err
+	}
+	if len(archives) == 0 {
+		return BackupArchive{}, errors.New("未找到 .tar.gz 备份文件")
+	}
+	return archives[0], nil
+}
+
+// Restore 下载并恢复指定的备份包，archive 留空时恢复最新的备份
+func (s *BackupService) Restore(remote, archive string, scope RestoreScope) error {
+	scope, err := scope.normalize()
+	if err != nil {
+		return err
+	}
+	tempDir, err := os.MkdirTemp("", "backup_restore")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+	localFile, err := s.downloadArchive(remote, archive, tempDir)
+	if err != nil {
+		return err
 	}
 
 	systemSvc := NewSystemService(nil, nil)
-	return systemSvc.Restore(localFile)
+	return systemSvc.Restore(localFile, scope)
 }
 
 func (s *BackupService) Status() (*BackupStatus, error) {
 	status := &BackupStatus{}
-	if rcloneCfg, err := s.loadRcloneConfig(); err == nil {
-		if rcloneCfg.AccessKey != "" || rcloneCfg.Endpoint != "" || rcloneCfg.SecretKey != "" {
-			status.RcloneConfigured = true
+	if settings, err := s.loadBackupSettings(); err == nil {
+		target := settings.S3
+		status.RcloneConfigured = target.AccessKey != "" || target.Endpoint != "" || target.SecretKey != ""
+		status.Type = settings.Type
+		if status.Type == "" {
+			status.Type = model.BackupTargetS3
+		}
+		sftp := settings.SFTP
+		webdav := settings.WebDAV
+		switch settings.Type {
+		case model.BackupTargetSFTP:
+			status.RcloneConfigured = sftp.Host != ""
+		case model.BackupTargetWebDAV:
+			status.RcloneConfigured = webdav.URL != ""
+		case model.BackupTargetRclone:
+			status.RcloneConfigured = settings.Remote != ""
 		}
-		status.AccessKey = rcloneCfg.AccessKey
-		status.Endpoint = rcloneCfg.Endpoint
-		status.HasSecret = rcloneCfg.SecretKey != ""
+		status.Remote = settings.Remote
+		status.WebDAVVendor = webdav.Vendor
+		status.WebDAVURL = webdav.URL
+		status.WebDAVUser = webdav.User
+		status.WebDAVHasPass = webdav.Password != ""
+		status.SFTPHost = sftp.Host
+		status.SFTPPort = sftp.Port
+		status.SFTPUser = sftp.User
+		status.SFTPKeyFile = sftp.KeyFile
+		status.SFTPHasPassword = sftp.Password != ""
+		status.SFTPHasKey = sftp.PrivateKey != "" || sftp.KeyFile != ""
+		status.Provider = target.Provider
+		status.AccessKey = target.AccessKey
+		status.Endpoint = target.Endpoint
+		status.Region = target.Region
+		status.PathStyle = target.PathStyle
+		status.HasSecret = target.SecretKey != ""
+	}
+	if schedule, err := s.Schedule(); err == nil {
+		status.ScheduleEnabled = schedule.Enabled
+		status.SchedulePreset = schedule.Preset
+		status.ScheduleCron = schedule.Cron
+		status.NextRunUnixTime = schedule.NextRunUnixTime
+		status.LastRunUnixTime = schedule.LastRunUnixTime
+		status.LastRunSuccess = schedule.LastSuccess
+		status.LastRunError = schedule.LastError
 	}
 	cfg, err := s.loadBackupConfig()
 	if err == nil {
-		status.BackupConfigured = true
+		status.BackupConfigured = cfg.RemotePath != ""
 		status.SourceDir = cfg.SourceDir
 		status.RemotePath = cfg.RemotePath
+		status.IncludePaths = cfg.Include
+		status.ExcludePaths = cfg.Exclude
+		status.PanelState = cfg.PanelState
+		status.SkipSecrets = cfg.SkipSecrets
+	} else {
+		status.IncludePaths = defaultBackupIncludes(model.NginxConfDir)
+		status.PanelState = true
 	}
 	return status, nil
 }
@@ -270,9 +648,6 @@ func (s *BackupService) ensureTools() error {
 	if _, err := exec.LookPath("pigz"); err != nil {
 		missing = append(missing, "pigz")
 	}
-	if _, err := exec.LookPath("python3"); err != nil {
-		missing = append(missing, "python3")
-	}
 	if len(missing) > 0 {
 		pkgs := strings.Join(missing, " ")
 		if _, err := executor.ExecuteSimple("bash", "-c", fmt.Sprintf("apt-get update >/dev/null 2>&1 && apt-get install -y %s >/dev/null 2>&1", pkgs)); err != nil {
@@ -280,6 +655,13 @@ func (s *BackupService) ensureTools() error {
 		}
 	}
 	if _, err := exec.LookPath("rclone"); err != nil {
+		// 离线目录中有 rclone 二进制时直接复制，不访问 rclone.org
+		if local := offlineFile(offlineArtifactDir, "rclone"); local != "" {
+			if err := copyFileMode(local, "/usr/bin/rclone", 0755); err != nil {
+				return fmt.Errorf("安装 rclone 失败: %w", err)
+			}
+			return nil
+		}
 		if _, err := executor.ExecuteSimple("bash", "-c", "curl -fsSL https://rclone.org/install.sh | bash >/dev/null 2>&1"); err != nil {
 			return fmt.Errorf("安装 rclone 失败: %w", err)
 		}
@@ -287,39 +669,37 @@ func (s *BackupService) ensureTools() error {
 	return nil
 }
 
-func (s *BackupService) configureRclone(accessKey, secret, endpoint string) error {
-	if accessKey == "" || secret == "" || endpoint == "" {
-		return errors.New("Cloudflare R2 凭证不能为空")
-	}
-	configDir := filepath.Dir(s.rcloneConfigPath)
-	if err := os.MkdirAll(configDir, 0700); err != nil {
+// configureRclone 只更新备份存储对应的配置段，rclone.conf 中的其他 remote 保持不变；
+// 引用已有 remote 时只检查其是否存在
+func (s *BackupService) configureRclone(settings model.BackupSettings) error {
+	if settings.Type == model.BackupTargetRclone {
+		_, err := s.findRcloneSection(settings.Remote)
 		return err
 	}
-	content := fmt.Sprintf(`[r2]
-type = s3
-provider = Cloudflare
-access_key_id = %s
-secret_access_key = %s
-region = auto
-endpoint = %s
-`, accessKey, secret, endpoint)
-	if err := os.WriteFile(s.rcloneConfigPath, []byte(content), 0600); err != nil {
+	content, err := s.rcloneRemoteSection(settings)
+	if err != nil {
 		return err
 	}
-	return nil
+	if settings.Type == model.BackupTargetSFTP && settings.SFTP.PrivateKey != "" {
+		key := strings.ReplaceAll(settings.SFTP.PrivateKey, "\r\n", "\n") + "\n"
+		if err := os.WriteFile(s.sftpKeyPath(), []byte(key), 0600); err != nil {
+			return err
+		}
+	} else {
+		// 不再使用面板保存的私钥时一并删除
+		_ = os.Remove(s.sftpKeyPath())
+	}
+	return s.upsertRcloneSection(parseRcloneConf(content)[0])
 }
 
 func (s *BackupService) testRclone() error {
-	if _, err := executor.ExecuteSimple("bash", "-c", fmt.Sprintf("timeout 10 rclone lsjson %s: >/dev/null 2>&1", s.rcloneRemote)); err != nil {
-		return fmt.Errorf("rclone 连接测试失败: %w", err)
-	}
-	return nil
+	return testRcloneRemote(s.activeRemote())
 }
 
 func (s *BackupService) TestConnection() error {
-	if _, err := s.loadRcloneConfig(); err != nil {
-		if errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrRcloneRemoteNotConfigured) {
-			return errors.New("尚未配置 Cloudflare R2 凭证")
+	if _, err := s.loadBackupSettings(); err != nil {
+		if errors.Is(err, ErrRcloneRemoteNotConfigured) {
+			return errors.New("尚未配置备份存储凭证")
 		}
 		return err
 	}
@@ -330,22 +710,6 @@ func (s *BackupService) ensureBackupAssets(sourceDir, remotePath string) error {
 	if err := os.MkdirAll(s.backupDir, 0755); err != nil {
 		return err
 	}
-	scriptDir := filepath.Dir(s.backupScriptPath)
-	if err := os.MkdirAll(scriptDir, 0755); err != nil {
-		return err
-	}
-	if _, err := os.Stat(s.backupScriptPath); os.IsNotExist(err) {
-		if _, err := executor.ExecuteSimple("wget", "-q", "-O", s.backupScriptPath, "https://raw.githubusercontent.com/woniu336/open_shell/main/website_backup.py"); err != nil {
-			return fmt.Errorf("下载备份脚本失败: %w", err)
-		}
-	}
-	if _, err := os.Stat(s.backupConfigPath); os.IsNotExist(err) {
-		if _, err := executor.ExecuteSimple("wget", "-q", "-O", s.backupConfigPath, "https://raw.githubusercontent.com/woniu336/open_shell/main/backup_config.conf"); err != nil {
-			return fmt.Errorf("下载备份配置失败: %w", err)
-		}
-	}
-	_ = os.Chmod(s.backupScriptPath, 0755)
-	_ = os.Chmod(s.backupConfigPath, 0644)
 	return s.updateBackupConfig(sourceDir, remotePath)
 }
 
@@ -354,73 +718,44 @@ func (s *BackupService) updateBackupConfig(sourceDir, remotePath string) error {
 	if sourceDir == "" {
 		sourceDir = model.NginxConfDir
 	}
-	remotePath = strings.Trim(strings.TrimSpace(remotePath), "/")
+	remotePath = normalizeRemotePath(s.remoteTargetType(), remotePath)
 	if remotePath == "" {
-		return errors.New("R2 存储路径不能为空")
-	}
-	data, err := os.ReadFile(s.backupConfigPath)
-	if err != nil {
-		return err
+		return errors.New("远程存储路径不能为空")
 	}
-	lines := strings.Split(string(data), "\n")
-	var (
-		hasSource bool
-		hasRemote bool
-	)
-	for i, line := range lines {
-		trim := strings.TrimSpace(line)
-		if strings.HasPrefix(trim, "source_dir") {
-			lines[i] = fmt.Sprintf("source_dir = %s", sourceDir)
-			hasSource = true
-		}
-		if strings.HasPrefix(trim, "remote_path") {
-			lines[i] = fmt.Sprintf("remote_path = %s", remotePath)
-			hasRemote = true
-		}
-	}
-	if !hasSource {
-		lines = append(lines, fmt.Sprintf("source_dir = %s", sourceDir))
-	}
-	if !hasRemote {
-		lines = append(lines, fmt.Sprintf("remote_path = %s", remotePath))
-	}
-	content := strings.Join(lines, "\n")
-	return os.WriteFile(s.backupConfigPath, []byte(content), 0644)
+	return s.writeBackupConfig([][2]string{
+		{"source_dir", sourceDir},
+		{"remote_path", remotePath},
+	})
 }
 
-func (s *BackupService) ensureCron() error {
-	current, err := executor.ExecuteSimple("bash", "-c", "crontab -l 2>/dev/null || true")
-	if err != nil {
-		return err
-	}
-	if strings.Contains(current, "website_backup.py") {
-		return nil
-	}
-	newContent := strings.TrimSpace(current)
-	if newContent != "" && !strings.HasSuffix(newContent, "\n") {
-		newContent += "\n"
-	}
-	newContent += "0 2 * * * /usr/bin/python3 /root/website_backup.py\n"
-
-	tempFile, err := os.CreateTemp("", "cron")
-	if err != nil {
-		return err
-	}
-	defer os.Remove(tempFile.Name())
-	if _, err := tempFile.WriteString(newContent); err != nil {
+// writeBackupConfig 更新备份配置中的若干项，保留其余内容；配置文件不存在时新建
+func (s *BackupService) writeBackupConfig(values [][2]string) error {
+	data, err := os.ReadFile(s.backupConfigPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
-	if err := tempFile.Close(); err != nil {
-		return err
+	var lines []string
+	if content := strings.TrimRight(string(data), "\n"); content != "" {
+		lines = strings.Split(content, "\n")
 	}
-	if _, err := executor.ExecuteSimple("crontab", tempFile.Name()); err != nil {
-		return fmt.Errorf("设置定时任务失败: %w", err)
+	for _, kv := range values {
+		line := fmt.Sprintf("%s = %s", kv[0], kv[1])
+		found := false
+		for i, existing := range lines {
+			if key, _, ok := strings.Cut(strings.TrimSpace(existing), "="); ok && strings.TrimSpace(key) == kv[0] {
+				lines[i] = line
+				found = true
+			}
+		}
+		if !found {
+			lines = append(lines, line)
+		}
 	}
-	return nil
+	return os.WriteFile(s.backupConfigPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
 }
 
 func (s *BackupService) verifyRemote(cfg *backupConfig) error {
-	remote := fmt.Sprintf("%s:%s", s.rcloneRemote, strings.Trim(cfg.RemotePath, "/"))
+	remote := fmt.Sprintf("%s:%s", s.activeRemote(), normalizeRemotePath(s.remoteTargetType(), cfg.RemotePath))
 	if _, err := executor.ExecuteSimple("bash", "-c", fmt.Sprintf("rclone ls %s 2>/dev/null | head -5", escapePath(remote))); err != nil {
 		return fmt.Errorf("验证备份文件失败: %w", err)
 	}
@@ -432,7 +767,7 @@ func (s *BackupService) loadBackupConfig() (*backupConfig, error) {
 	if err != nil {
 		return nil, err
 	}
-	cfg := &backupConfig{}
+	cfg := &backupConfig{PanelState: true}
 	lines := strings.Split(string(data), "\n")
 	for _, line := range lines {
 		trim := strings.TrimSpace(line)
@@ -442,10 +777,25 @@ func (s *BackupService) loadBackupConfig() (*backupConfig, error) {
 		if strings.HasPrefix(trim, "remote_path") {
 			cfg.RemotePath = strings.TrimSpace(strings.TrimPrefix(trim, "remote_path ="))
 		}
+		if strings.HasPrefix(trim, "include_paths") {
+			cfg.Include = splitBackupPaths(strings.TrimPrefix(trim, "include_paths ="))
+		}
+		if strings.HasPrefix(trim, "exclude_paths") {
+			cfg.Exclude = splitBackupPaths(strings.TrimPrefix(trim, "exclude_paths ="))
+		}
+		if strings.HasPrefix(trim, "panel_state") {
+			cfg.PanelState, _ = strconv.ParseBool(strings.TrimSpace(strings.TrimPrefix(trim, "panel_state =")))
+		}
+		if strings.HasPrefix(trim, "skip_secrets") {
+			cfg.SkipSecrets, _ = strconv.ParseBool(strings.TrimSpace(strings.TrimPrefix(trim, "skip_secrets =")))
+		}
 	}
 	if cfg.SourceDir == "" {
 		cfg.SourceDir = model.NginxConfDir
 	}
+	if len(cfg.Include) == 0 {
+		cfg.Include = defaultBackupIncludes(cfg.SourceDir)
+	}
 	return cfg, nil
 }
 
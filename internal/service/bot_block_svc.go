@@ -0,0 +1,142 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const botBlockSettingsPath = "/root/bot_block_settings.json"
+
+var defaultBlockedAgents = []string{
+	"sqlmap", "nikto", "masscan", "zgrab", "nmap", "nuclei",
+	"AhrefsBot", "SemrushBot", "MJ12bot", "DotBot", "PetalBot",
+}
+
+// BotBlockService 维护全局 UA 拦截名单，并渲染为 http 级别的 map $blocked_agent
+type BotBlockService struct {
+	ConfDir string
+	path    string
+	mu      sync.Mutex
+}
+
+func NewBotBlockService() *BotBlockService {
+	return &BotBlockService{
+		ConfDir: model.NginxConfDir,
+		path:    botBlockSettingsPath,
+	}
+}
+
+func (s *BotBlockService) defaultSettings() model.BotBlockSettings {
+	return model.BotBlockSettings{
+		UserAgents: append([]string(nil), defaultBlockedAgents...),
+	}
+}
+
+// MapPath 返回全局 map 配置文件路径
+func (s *BotBlockService) MapPath() string {
+	return filepath.Join(s.ConfDir, "bot_block.conf")
+}
+
+func (s *BotBlockService) Get() (model.BotBlockSettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s.defaultSettings(), nil
+		}
+		return model.BotBlockSettings{}, err
+	}
+
+	var settings model.BotBlockSettings
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return model.BotBlockSettings{}, err
+	}
+	agents, err := sanitizeUserAgents(settings.UserAgents)
+	if err != nil {
+		return s.defaultSettings(), nil
+	}
+	settings.UserAgents = agents
+	return settings, nil
+}
+
+// Save 保存名单并重写 map 文件，返回写入前的 map 内容以便重载失败时回滚
+func (s *BotBlockService) Save(input model.BotBlockSettings) (model.BotBlockSettings, string, error) {
+	agents, err := sanitizeUserAgents(input.UserAgents)
+	if err != nil {
+		return model.BotBlockSettings{}, "", err
+	}
+	settings := model.BotBlockSettings{
+		UserAgents:          agents,
+		LastUpdatedUnixTime: time.Now().Unix(),
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.BotBlockSettings{}, "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, _ := os.ReadFile(s.MapPath())
+	if err := ensureHTTPInclude(s.ConfDir, s.MapPath()); err != nil {
+		return model.BotBlockSettings{}, "", err
+	}
+	if err := os.WriteFile(s.MapPath(), []byte(renderAgentMap("$blocked_agent", agents)), 0644); err != nil {
+		return model.BotBlockSettings{}, "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return model.BotBlockSettings{}, "", err
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return model.BotBlockSettings{}, "", err
+	}
+	return settings, string(prev), nil
+}
+
+// RestoreMap 回滚 map 文件；prev 为空表示此前不存在，写入空名单以保持站点引用的变量有效
+func (s *BotBlockService) RestoreMap(prev string) error {
+	if prev == "" {
+		prev = renderAgentMap("$blocked_agent", nil)
+	}
+	return os.WriteFile(s.MapPath(), []byte(prev), 0644)
+}
+
+func renderAgentMap(variable string, agents []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "map $http_user_agent %s {\n    default 0;\n", variable)
+	for _, agent := range agents {
+		fmt.Fprintf(&b, "    \"~*%s\" 1;\n", agent)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func sanitizeUserAgents(input []string) ([]string, error) {
+	output := make([]string, 0, len(input))
+	seen := make(map[string]bool, len(input))
+	for _, agent := range input {
+		agent = strings.TrimSpace(agent)
+		if agent == "" || seen[agent] {
+			continue
+		}
+		if strings.ContainsAny(agent, "\"';\r\n") || strings.HasSuffix(agent, `\`) {
+			return nil, fmt.Errorf("%w: UA 规则包含非法字符 %q", ErrInvalidSiteOption, agent)
+		}
+		if _, err := regexp.Compile("(?i)" + agent); err != nil {
+			return nil, fmt.Errorf("%w: UA 规则不是合法的正则 %q", ErrInvalidSiteOption, agent)
+		}
+		seen[agent] = true
+		output = append(output, agent)
+	}
+	return output, nil
+}
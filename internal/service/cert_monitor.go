@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+const (
+	certMonitorSettingsPath = "/root/cert_monitor_settings.json"
+	certMonitorInterval     = 24 * time.Hour
+	certMonitorTimeout      = 10 * time.Second
+	certMonitorConcurrency  = 8
+	certMonitorMaxHosts     = 200
+)
+
+var ErrInvalidCertMonitorSettings = errors.New("证书监测配置无效")
+
+// certMonitorState 保存在状态库中，重启后不会提前重复检查
+type certMonitorState struct {
+	LastRunUnixTime int64                            `json:"last_run_unix_time"`
+	Results         map[string]model.CertCheckResult `json:"results"`
+}
+
+// CertMonitor 每天连接登记的外部主机，检查证书链是否可信、域名是否匹配以及剩余天数，
+// 有问题的主机汇总成一条告警。适合监测回源站点与第三方域名，本机 ACME 证书见仪表盘
+type CertMonitor struct {
+	Notifier *NotificationDispatcher
+
+	settingsPath string
+	store        *StateStore
+	// roots 校验证书链使用的根证书，nil 表示系统根证书，测试中替换
+	roots *x509.CertPool
+	mu    sync.Mutex
+}
+
+func NewCertMonitor() *CertMonitor {
+	return &CertMonitor{
+		settingsPath: certMonitorSettingsPath,
+		store:        openStateStore(""),
+	}
+}
+
+func (m *CertMonitor) defaultSettings() model.CertMonitorSettings {
+	return model.CertMonitorSettings{
+		Enabled:  false,
+		WarnDays: 14,
+		Hosts:    []model.CertMonitorHost{},
+	}
+}
+
+func (m *CertMonitor) sanitize(input model.CertMonitorSettings) (model.CertMonitorSettings, error) {
+	output := m.defaultSettings()
+	output.Enabled = input.Enabled
+	output.LastUpdatedUnixTime = input.LastUpdatedUnixTime
+	if input.WarnDays < 0 || input.WarnDays > 365 {
+		return model.CertMonitorSettings{}, fmt.Errorf("%w: 提前告警天数需在 1 到 365 之间", ErrInvalidCertMonitorSettings)
+	}
+	if input.WarnDays > 0 {
+		output.WarnDays = input.WarnDays
+	}
+	if len(input.Hosts) > certMonitorMaxHosts {
+		return model.CertMonitorSettings{}, fmt.Errorf("%w: 最多监测 %d 个主机", ErrInvalidCertMonitorSettings, certMonitorMaxHosts)
+	}
+
+	seen := make(map[string]bool)
+	for _, host := range input.Hosts {
+		host.Host = strings.ToLower(strings.TrimSpace(host.Host))
+		host.ServerName = strings.ToLower(strings.TrimSpace(host.ServerName))
+		if host.Port == 0 {
+			host.Port = 443
+		}
+		if !validCertHost(host.Host) {
+			return model.CertMonitorSettings{}, fmt.Errorf("%w: 主机 %q 不是合法的域名或 IP", ErrInvalidCertMonitorSettings, host.Host)
+		}
+		if host.ServerName != "" && !validCertHost(host.ServerName) {
+			return model.CertMonitorSettings{}, fmt.Errorf("%w: SNI %q 不是合法的域名", ErrInvalidCertMonitorSettings, host.ServerName)
+		}
+		if host.ServerName == host.Host {
+			host.ServerName = ""
+		}
+		if host.Port < 1 || host.Port > 65535 {
+			return model.CertMonitorSettings{}, fmt.Errorf("%w: %s 的端口 %d 无效", ErrInvalidCertMonitorSettings, host.Host, host.Port)
+		}
+		key := certHostKey(host)
+		if seen[key] {
+			return model.CertMonitorSettings{}, fmt.Errorf("%w: %s 重复", ErrInvalidCertMonitorSettings, key)
+		}
+		seen[key] = true
+		output.Hosts = append(output.Hosts, host)
+	}
+	return output, nil
+}
+
+// validCertHost 校验域名（允许通配符以外的常规主机名）或 IP
+func validCertHost(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func certHostKey(host model.CertMonitorHost) string {
+	key := net.JoinHostPort(host.Host, strconv.Itoa(host.Port))
+	if host.ServerName != "" {
+		key += "/" + host.ServerName
+	}
+	return key
+}
+
+func (m *CertMonitor) GetSettings() (model.CertMonitorSettings, error) {
+	content, err := os.ReadFile(m.settingsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return m.defaultSettings(), nil
+		}
+		return model.CertMonitorSettings{}, err
+	}
+	var settings model.CertMonitorSettings
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return model.CertMonitorSettings{}, err
+	}
+	normalized, err := m.sanitize(settings)
+	if err != nil {
+		return m.defaultSettings(), nil
+	}
+	return normalized, nil
+}
+
+func (m *CertMonitor) SaveSettings(input model.CertMonitorSettings) (model.CertMonitorSettings, error) {
+	settings, err := m.sanitize(input)
+	if err != nil {
+		return model.CertMonitorSettings{}, err
+	}
+	settings.LastUpdatedUnixTime = time.Now().Unix()
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.CertMonitorSettings{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.settingsPath), 0700); err != nil {
+		return model.CertMonitorSettings{}, err
+	}
+	if err := os.WriteFile(m.settingsPath, data, 0600); err != nil {
+		return model.CertMonitorSettings{}, err
+	}
+	return settings, nil
+}
+
+func (m *CertMonitor) loadState() certMonitorState {
+	state := certMonitorState{Results: map[string]model.CertCheckResult{}}
+	if err := m.store.Get(stateKeyCertMonitor, &state); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("[cert-monitor] 读取状态失败: %v", err)
+	}
+	if state.Results == nil {
+		state.Results = map[string]model.CertCheckResult{}
+	}
+	return state
+}
+
+// Status 按配置顺序返回各主机最近一次的检查结果，尚未检查的主机只有主机信息
+func (m *CertMonitor) Status() (*model.CertMonitorStatus, error) {
+	settings, err := m.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	state := m.loadState()
+	m.mu.Unlock()
+
+	status := &model.CertMonitorStatus{LastRunUnixTime: state.LastRunUnixTime, Results: []model.CertCheckResult{}}
+	if settings.Enabled {
+		next := time.Now()
+		if state.LastRunUnixTime > 0 {
+			next = time.Unix(state.LastRunUnixTime, 0).Add(certMonitorInterval)
+		}
+		status.NextRunUnixTime = next.Unix()
+	}
+	for _, host := range settings.Hosts {
+		result, ok := state.Results[certHostKey(host)]
+		if !ok {
+			result = model.CertCheckResult{Host: host.Host, Port: host.Port, ServerName: certServerName(host)}
+		}
+		status.Results = append(status.Results, result)
+	}
+	return status, nil
+}
+
+func certServerName(host model.CertMonitorHost) string {
+	if host.ServerName != "" {
+		return host.ServerName
+	}
+	return host.Host
+}
+
+func (m *CertMonitor) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			settings, err := m.GetSettings()
+			if err != nil {
+				log.Printf("[cert-monitor] 获取配置失败: %v", err)
+				continue
+			}
+			if !settings.Enabled || len(settings.Hosts) == 0 {
+				continue
+			}
+			m.mu.Lock()
+			state := m.loadState()
+			m.mu.Unlock()
+			if time.Since(time.Unix(state.LastRunUnixTime, 0)) >= certMonitorInterval {
+				m.RunChecks(settings, time.Now(), true)
+			}
+		}
+	}
+}
+
+// RunChecks 并发检查所有主机并保存结果。scheduled 为 true 时记为定时检查并对有问题的主机发送告警，
+// 手动检查只刷新结果
+func (m *CertMonitor) RunChecks(settings model.CertMonitorSettings, now time.Time, scheduled bool) []model.CertCheckResult {
+	results := make([]model.CertCheckResult, len(settings.Hosts))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, certMonitorConcurrency)
+	for i, host := range settings.Hosts {
+		wg.Add(1)
+		go func(i int, host model.CertMonitorHost) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = checkCertificate(host, m.roots, now)
+		}(i, host)
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	err := m.store.Update(stateKeyCertMonitor, func(current json.RawMessage) (any, error) {
+		state := certMonitorState{}
+		if current != nil {
+			json.Unmarshal(current, &state)
+		}
+		state.Results = make(map[string]model.CertCheckResult, len(results))
+		for i, host := range settings.Hosts {
+			state.Results[certHostKey(host)] = results[i]
+		}
+		if scheduled {
+			state.LastRunUnixTime = now.Unix()
+		}
+		return state, nil
+	})
+	m.mu.Unlock()
+	if err != nil {
+		log.Printf("[cert-monitor] 保存状态失败: %v", err)
+	}
+
+	if scheduled && m.Notifier != nil {
+		var problems []model.CertCheckResult
+		for _, result := range results {
+			if !result.Valid || result.DaysLeft <= settings.WarnDays {
+				problems = append(problems, result)
+			}
+		}
+		if len(problems) > 0 {
+			sort.SliceStable(problems, func(i, j int) bool { return problems[i].DaysLeft < problems[j].DaysLeft })
+			m.Notifier.NotifyCertMonitor(problems, settings.WarnDays)
+		}
+	}
+	return results
+}
+
+// checkCertificate 建立 TLS 连接取得对端证书链，再按 now 与 SNI 域名自行校验，
+// 这样证书不可信时仍能读到证书的到期时间与颁发者
+func checkCertificate(host model.CertMonitorHost, roots *x509.CertPool, now time.Time) model.CertCheckResult {
+	serverName := certServerName(host)
+	result := model.CertCheckResult{Host: host.Host, Port: host.Port, ServerName: serverName, CheckedUnixTime: now.Unix()}
+
+	dialer := &net.Dialer{Timeout: certMonitorTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host.Host, strconv.Itoa(host.Port)), &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		result.Error = fmt.Sprintf("TLS 连接失败: %v", err)
+		return result
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	conn.Close()
+	if len(certs) == 0 {
+		result.Error = "对端没有返回证书"
+		return result
+	}
+
+	leaf := certs[0]
+	result.Subject = leaf.Subject.CommonName
+	result.Issuer = leaf.Issuer.CommonName
+	if result.Issuer == "" && len(leaf.Issuer.Organization) > 0 {
+		result.Issuer = leaf.Issuer.Organization[0]
+	}
+	result.DNSNames = leaf.DNSNames
+	result.NotBeforeUnixTime = leaf.NotBefore.Unix()
+	result.NotAfterUnixTime = leaf.NotAfter.Unix()
+	result.DaysLeft = int(leaf.NotAfter.Sub(now).Hours() / 24)
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Intermediates: intermediates,
+		Roots:         roots,
+		CurrentTime:   now,
+	})
+	if err != nil {
+		result.Error = describeCertError(err, serverName)
+		return result
+	}
+	result.Valid = true
+	return result
+}
+
+func describeCertError(err error, serverName string) string {
+	var invalid x509.CertificateInvalidError
+	var unknown x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	switch {
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		return "证书已过期或尚未生效"
+	case errors.As(err, &unknown):
+		return "证书链不受信任，可能缺少中间证书或为自签名证书"
+	case errors.As(err, &hostname):
+		return fmt.Sprintf("证书不包含域名 %s", serverName)
+	}
+	return fmt.Sprintf("证书校验失败: %v", err)
+}
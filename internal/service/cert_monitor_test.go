@@ -0,0 +1,98 @@
+package service
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+func TestCertMonitor(t *testing.T) {
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer origin.Close()
+	host, portStr, _ := net.SplitHostPort(origin.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	leaf := origin.Certificate()
+
+	var received []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Title   string `json:"title"`
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload.Title+"\n"+payload.Content)
+	}))
+	defer webhook.Close()
+
+	dir := t.TempDir()
+	notifySvc := NewNotificationService()
+	notifySvc.store = openStateStore(filepath.Join(dir, "state.json"))
+	notifySettings, _ := notifySvc.Get()
+	notifySettings.Webhook = model.WebhookSettings{Enabled: true, URL: webhook.URL, Method: http.MethodPost}
+	if _, err := notifySvc.Save(notifySettings); err != nil {
+		t.Fatalf("save notification settings: %v", err)
+	}
+
+	monitor := NewCertMonitor()
+	monitor.settingsPath = filepath.Join(dir, "cert_monitor_settings.json")
+	monitor.store = openStateStore(filepath.Join(dir, "state.json"))
+	monitor.roots = x509.NewCertPool()
+	monitor.roots.AddCert(leaf)
+	monitor.Notifier = NewNotificationDispatcher(notifySvc, nil)
+
+	if _, err := monitor.SaveSettings(model.CertMonitorSettings{Hosts: []model.CertMonitorHost{{Host: "bad host"}}}); !errors.Is(err, ErrInvalidCertMonitorSettings) {
+		t.Fatalf("expected invalid host, got %v", err)
+	}
+	settings, err := monitor.SaveSettings(model.CertMonitorSettings{
+		Enabled:  true,
+		WarnDays: 30,
+		Hosts: []model.CertMonitorHost{
+			{Host: host, Port: port, ServerName: "example.com"},
+			{Host: host, Port: port, ServerName: "other.test"},
+			{Host: "127.0.0.1", Port: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	// 手动检查只刷新结果
+	results := monitor.RunChecks(settings, time.Now(), false)
+	if !results[0].Valid || results[0].DaysLeft <= 30 || results[0].NotAfterUnixTime != leaf.NotAfter.Unix() {
+		t.Fatalf("unexpected valid result: %+v", results[0])
+	}
+	if results[1].Valid || !strings.Contains(results[1].Error, "other.test") || results[1].NotAfterUnixTime == 0 {
+		t.Fatalf("unexpected hostname mismatch result: %+v", results[1])
+	}
+	if results[2].Valid || !strings.Contains(results[2].Error, "TLS 连接失败") {
+		t.Fatalf("unexpected unreachable result: %+v", results[2])
+	}
+	if len(received) != 0 {
+		t.Fatalf("manual check should not notify: %v", received)
+	}
+
+	// 定时检查时临近到期的证书也会告警
+	now := leaf.NotAfter.Add(-10 * 24 * time.Hour)
+	monitor.RunChecks(settings, now, true)
+	if len(received) != 1 || !strings.Contains(received[0], "3 个主机") || !strings.Contains(received[0], "example.com（"+origin.Listener.Addr().String()+"）**: 将于") {
+		t.Fatalf("unexpected alerts: %v", received)
+	}
+
+	status, err := monitor.Status()
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if status.LastRunUnixTime != now.Unix() || len(status.Results) != 3 || status.Results[0].ServerName != "example.com" || status.Results[0].CheckedUnixTime != now.Unix() {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+}
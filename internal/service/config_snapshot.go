@@ -0,0 +1,204 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxConfigSnapshots 保留的快照数，超出后删除最早的快照
+const maxConfigSnapshots = 50
+
+var ErrConfigSnapshotNotFound = errors.New("配置快照不存在")
+
+// ConfigSnapshot 修改站点或转发规则前自动生成的 Nginx 配置快照，只包含配置目录，用于撤销最近的改动
+type ConfigSnapshot struct {
+	ID              string `json:"id"`
+	Reason          string `json:"reason"`
+	User            string `json:"user,omitempty"`
+	Size            int64  `json:"size"`
+	CreatedUnixTime int64  `json:"created_unix_time"`
+}
+
+type ConfigSnapshotService struct {
+	mu      sync.Mutex
+	dir     string
+	confDir string
+	keep    int
+}
+
+func NewConfigSnapshotService() *ConfigSnapshotService {
+	return &ConfigSnapshotService{
+		dir:     "/root/nginx_snapshots",
+		confDir: model.NginxConfDir,
+		keep:    maxConfigSnapshots,
+	}
+}
+
+func (s *ConfigSnapshotService) indexPath() string {
+	return filepath.Join(s.dir, "snapshots.json")
+}
+
+func (s *ConfigSnapshotService) archivePath(id string) string {
+	return filepath.Join(s.dir, id+".tar.gz")
+}
+
+// load 读取快照索引，按生成时间从旧到新排列
+func (s *ConfigSnapshotService) load() ([]ConfigSnapshot, error) {
+	data, err := os.ReadFile(s.indexPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var snapshots []ConfigSnapshot
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", s.indexPath(), err)
+	}
+	return snapshots, nil
+}
+
+func (s *ConfigSnapshotService) save(snapshots []ConfigSnapshot) error {
+	data, err := json.MarshalIndent(snapshots, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.indexPath(), data, 0600)
+}
+
+// List 返回全部快照，最新的在前
+func (s *ConfigSnapshotService) List() ([]ConfigSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshots, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]ConfigSnapshot, 0, len(snapshots))
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		list = append(list, snapshots[i])
+	}
+	return list, nil
+}
+
+// Take 打包当前的 Nginx 配置目录，超出保留数量时删除最早的快照
+func (s *ConfigSnapshotService) Take(reason, user string) (ConfigSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.take(reason, user)
+}
+
+func (s *ConfigSnapshotService) take(reason, user string) (ConfigSnapshot, error) {
+	if !dirExists(s.confDir) {
+		return ConfigSnapshot{}, fmt.Errorf("配置目录不存在: %s", s.confDir)
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return ConfigSnapshot{}, err
+	}
+	snapshots, err := s.load()
+	if err != nil {
+		return ConfigSnapshot{}, err
+	}
+	snapshot := ConfigSnapshot{ID: newBackupJobID(), Reason: reason, User: user, CreatedUnixTime: time.Now().Unix()}
+	path := s.archivePath(snapshot.ID)
+	if _, err := executor.ExecuteSimple("tar", "-czf", path, "-C", filepath.Dir(s.confDir), filepath.Base(s.confDir)); err != nil {
+		os.Remove(path)
+		return ConfigSnapshot{}, fmt.Errorf("生成配置快照失败: %w", err)
+	}
+	if info, err := os.Stat(path); err == nil {
+		snapshot.Size = info.Size()
+	}
+	snapshots = append(snapshots, snapshot)
+	for len(snapshots) > s.keep {
+		os.Remove(s.archivePath(snapshots[0].ID))
+		snapshots = snapshots[1:]
+	}
+	if err := s.save(snapshots); err != nil {
+		os.Remove(path)
+		return ConfigSnapshot{}, err
+	}
+	return snapshot, nil
+}
+
+// Discard 删除指定快照，请求失败、配置未改动时使用
+func (s *ConfigSnapshotService) Discard(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshots, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i, snapshot := range snapshots {
+		if snapshot.ID == id {
+			os.Remove(s.archivePath(id))
+			return s.save(append(snapshots[:i], snapshots[i+1:]...))
+		}
+	}
+	return ErrConfigSnapshotNotFound
+}
+
+func (s *ConfigSnapshotService) find(id string) (ConfigSnapshot, error) {
+	snapshots, err := s.load()
+	if err != nil {
+		return ConfigSnapshot{}, err
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.ID == id {
+			return snapshot, nil
+		}
+	}
+	return ConfigSnapshot{}, ErrConfigSnapshotNotFound
+}
+
+// apply 用快照整体替换配置目录，快照生成后新增的文件会被删除
+func (s *ConfigSnapshotService) apply(snapshot ConfigSnapshot) error {
+	tmpDir, err := os.MkdirTemp("", "nginx_snapshot")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if _, err := executor.ExecuteSimple("tar", "-xzf", s.archivePath(snapshot.ID), "-C", tmpDir); err != nil {
+		return fmt.Errorf("解压快照失败: %w", err)
+	}
+	return applyRestoreTargets([]restoreTarget{{src: filepath.Join(tmpDir, filepath.Base(s.confDir)), dest: s.confDir}})
+}
+
+// Restore 恢复到指定快照。恢复前先为当前配置生成快照，nginx -t 或重载失败时自动还原
+func (s *ConfigSnapshotService) Restore(id, user string) (ConfigSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	target, err := s.find(id)
+	if err != nil {
+		return ConfigSnapshot{}, err
+	}
+	current, err := s.take("恢复快照 "+id+" 前", user)
+	if err != nil {
+		return ConfigSnapshot{}, err
+	}
+
+	rollback := func(stage string, cause error) error {
+		if rollbackErr := s.apply(current); rollbackErr != nil {
+			return fmt.Errorf("%s: %v；尝试恢复原配置时出错: %v", stage, cause, rollbackErr)
+		}
+		return fmt.Errorf("%s: %w", stage, cause)
+	}
+	if err := s.apply(target); err != nil {
+		return ConfigSnapshot{}, rollback("恢复快照失败", err)
+	}
+	if _, err := executor.ExecuteSimple(model.NginxSbinPath, "-t"); err != nil {
+		return ConfigSnapshot{}, rollback("配置验证失败", err)
+	}
+	if _, err := executor.ExecuteSimple("systemctl", "reload", "nginx"); err != nil {
+		err = rollback("重载 Nginx 失败", err)
+		_, _ = executor.ExecuteSimple("systemctl", "reload", "nginx")
+		return ConfigSnapshot{}, err
+	}
+	return current, nil
+}
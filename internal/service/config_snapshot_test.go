@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigSnapshots(t *testing.T) {
+	root := t.TempDir()
+	svc := NewConfigSnapshotService()
+	svc.dir = filepath.Join(root, "snapshots")
+	svc.confDir = filepath.Join(root, "nginx")
+	svc.keep = 2
+
+	site := filepath.Join(svc.confDir, "sites-available", "a.com")
+	os.MkdirAll(filepath.Dir(site), 0755)
+	os.WriteFile(site, []byte("v1"), 0644)
+
+	first, err := svc.Take("PUT /api/v1/sites/a.com", "admin")
+	if err != nil {
+		t.Fatalf("take: %v", err)
+	}
+	os.WriteFile(site, []byte("v2"), 0644)
+	added := filepath.Join(svc.confDir, "sites-available", "b.com")
+	os.WriteFile(added, []byte("b"), 0644)
+
+	if err := svc.apply(first); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if data, _ := os.ReadFile(site); string(data) != "v1" {
+		t.Fatalf("site not restored: %q", data)
+	}
+	if _, err := os.Stat(added); !os.IsNotExist(err) {
+		t.Fatal("files created after the snapshot should be removed")
+	}
+
+	second, _ := svc.Take("second", "")
+	third, _ := svc.Take("third", "")
+	list, err := svc.List()
+	if err != nil || len(list) != 2 || list[0].ID != third.ID || list[1].ID != second.ID {
+		t.Fatalf("expected the two newest snapshots, got %+v, %v", list, err)
+	}
+	if _, err := os.Stat(svc.archivePath(first.ID)); !os.IsNotExist(err) {
+		t.Fatal("pruned snapshot archive should be deleted")
+	}
+
+	if err := svc.Discard(third.ID); err != nil {
+		t.Fatalf("discard: %v", err)
+	}
+	if err := svc.Discard(third.ID); !errors.Is(err, ErrConfigSnapshotNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if _, err := svc.Restore(first.ID, ""); !errors.Is(err, ErrConfigSnapshotNotFound) {
+		t.Fatalf("restoring a pruned snapshot should fail, got %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+const (
+	dashboardSoonestCerts = 5
+	dashboardRecentErrors = 5
+	// dashboardErrorRead 每个站点只读取错误日志末尾的这部分内容
+	dashboardErrorRead = 256 << 10
+)
+
+// DashboardService 汇总仪表盘首页需要的站点、转发、证书、流量、错误与备份状态，
+// 首页只需请求一次。各部分互不影响，读取失败的部分记入 Warnings
+type DashboardService struct {
+	siteSvc   *SiteService
+	streamSvc *StreamService
+	systemSvc *SystemService
+	backupSvc *BackupService
+
+	logDir  string
+	acmeDir string
+}
+
+func NewDashboardService(siteSvc *SiteService, streamSvc *StreamService, systemSvc *SystemService, backupSvc *BackupService) *DashboardService {
+	return &DashboardService{
+		siteSvc:   siteSvc,
+		streamSvc: streamSvc,
+		systemSvc: systemSvc,
+		backupSvc: backupSvc,
+		logDir:    model.NginxLogDir,
+		acmeDir:   filepath.Join(model.NginxPrefix, "acme_letsencrypt"),
+	}
+}
+
+func (s *DashboardService) Summary(now time.Time) *model.Dashboard {
+	dashboard := &model.Dashboard{GeneratedUnixTime: now.Unix(), Warnings: []string{}}
+	warn := func(section string, err error) {
+		dashboard.Warnings = append(dashboard.Warnings, section+": "+err.Error())
+	}
+
+	if s.systemSvc != nil {
+		dashboard.Nginx.Active, dashboard.Nginx.Version = s.systemSvc.NginxState()
+		if cycle, err := s.systemSvc.TrafficCycle(); err == nil {
+			dashboard.Traffic = &model.DashboardTraffic{UsedBytes: cycle.UsedBytes, LimitBytes: cycle.LimitBytes}
+			if !cycle.CycleStart.IsZero() {
+				dashboard.Traffic.CycleStartUnixTime = cycle.CycleStart.Unix()
+			}
+			if !cycle.NextReset.IsZero() {
+				dashboard.Traffic.NextResetUnixTime = cycle.NextReset.Unix()
+			}
+		}
+	}
+
+	if sites, err := s.collectSites(); err != nil {
+		warn("站点", err)
+	} else {
+		dashboard.Sites = sites
+	}
+	if streams, err := s.collectStreams(); err != nil {
+		warn("端口转发", err)
+	} else {
+		dashboard.Streams = streams
+	}
+	dashboard.Certs = summarizeCerts(collectACMECerts(s.acmeDir), now)
+	dashboard.Errors = collectRecentErrors(s.logDir, now.Add(-24*time.Hour), now)
+
+	if s.backupSvc != nil {
+		if status, err := s.backupSvc.Status(); err != nil {
+			warn("备份", err)
+		} else {
+			dashboard.Backup = model.DashboardBackup{
+				Configured:      status.BackupConfigured && status.RcloneConfigured,
+				ScheduleEnabled: status.ScheduleEnabled,
+				LastRunUnixTime: status.LastRunUnixTime,
+				LastRunSuccess:  status.LastRunSuccess,
+				LastRunError:    status.LastRunError,
+				NextRunUnixTime: status.NextRunUnixTime,
+			}
+		}
+	}
+	return dashboard
+}
+
+// collectSites 统计站点总数、启用数与各类型数量，解析失败的站点只计入总数
+func (s *DashboardService) collectSites() (model.DashboardSites, error) {
+	result := model.DashboardSites{Types: map[string]int{}}
+	domains, err := s.siteSvc.ListSites()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return result, nil
+		}
+		return result, err
+	}
+	result.Total = len(domains)
+	for _, domain := range domains {
+		if cfg, err := s.siteSvc.GetSite(domain); err == nil && cfg.Type != "" {
+			result.Types[cfg.Type]++
+		}
+	}
+	enabled, err := s.siteSvc.ListEnabledSites()
+	if err != nil {
+		return result, err
+	}
+	result.Enabled = len(enabled)
+	return result, nil
+}
+
+func (s *DashboardService) collectStreams() (model.DashboardStreams, error) {
+	var result model.DashboardStreams
+	names, err := s.streamSvc.ListStreams()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return result, nil
+		}
+		return result, err
+	}
+	result.Total = len(names)
+	for _, name := range names {
+		if s.streamSvc.IsEnabled(name) {
+			result.Enabled++
+		}
+	}
+	return result, nil
+}
+
+// summarizeCerts 按剩余天数统计即将到期与已过期的证书，certs 已按到期时间升序排列
+func summarizeCerts(certs []certExpiry, now time.Time) model.DashboardCerts {
+	result := model.DashboardCerts{Total: len(certs), Soonest: []model.DashboardCert{}, ExpiringDays: digestCertAlert}
+	for _, cert := range certs {
+		days := int(cert.notAfter.Sub(now).Hours() / 24)
+		switch {
+		case cert.notAfter.Before(now):
+			result.Expired++
+		case days <= digestCertAlert:
+			result.Expiring++
+		}
+		if len(result.Soonest) < dashboardSoonestCerts {
+			result.Soonest = append(result.Soonest, model.DashboardCert{Domain: cert.name, NotAfterUnixTime: cert.notAfter.Unix(), DaysLeft: days})
+		}
+	}
+	return result
+}
+
+// collectRecentErrors 统计 [since, until] 内各站点 error 及以上级别的错误，返回总数与最近的几条
+func collectRecentErrors(logDir string, since, until time.Time) model.DashboardErrors {
+	result := model.DashboardErrors{Recent: []model.DashboardError{}}
+	paths, _ := filepath.Glob(filepath.Join(logDir, "*-error.log"))
+	minRank := errorLevelRank("error")
+	for _, path := range paths {
+		data, err := readLogTail(path, dashboardErrorRead)
+		if err != nil {
+			continue
+		}
+		domain := strings.TrimSuffix(filepath.Base(path), "-error.log")
+		for _, line := range strings.Split(string(data), "\n") {
+			entry, ok := parseErrorLine(line)
+			if !ok || entry.UnixTime < since.Unix() || entry.UnixTime > until.Unix() || errorLevelRank(entry.Level) < minRank {
+				continue
+			}
+			result.Total++
+			result.Recent = append(result.Recent, model.DashboardError{Domain: domain, SiteErrorEntry: entry})
+		}
+	}
+	sort.SliceStable(result.Recent, func(i, j int) bool { return result.Recent[i].UnixTime > result.Recent[j].UnixTime })
+	if len(result.Recent) > dashboardRecentErrors {
+		result.Recent = result.Recent[:dashboardRecentErrors]
+	}
+	return result
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+func TestDashboardSummary(t *testing.T) {
+	siteSvc := newTestSiteService(t)
+	for _, cfg := range []model.SiteConfig{
+		{Domain: "a.com", Type: "proxy", BackendIP: "10.0.0.2", BackendPort: 8080},
+		{Domain: "b.com", Type: "redirect", TargetURL: "https://example.org"},
+	} {
+		if err := siteSvc.CreateSite(cfg); err != nil {
+			t.Fatalf("create %s: %v", cfg.Domain, err)
+		}
+	}
+	os.Remove(filepath.Join(siteSvc.ConfDir, "sites-enabled", "b.com"))
+
+	streamSvc := &StreamService{ConfDir: t.TempDir()}
+	os.MkdirAll(filepath.Join(streamSvc.ConfDir, "streams-available"), 0755)
+	os.MkdirAll(filepath.Join(streamSvc.ConfDir, "streams-enabled"), 0755)
+	os.WriteFile(filepath.Join(streamSvc.ConfDir, "streams-available", "ssh"), nil, 0644)
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local)
+	acmeDir := t.TempDir()
+	writeTestCert(t, acmeDir, "a", "a.com", now.AddDate(0, 0, 60))
+	writeTestCert(t, acmeDir, "b", "b.com", now.AddDate(0, 0, 7))
+	writeTestCert(t, acmeDir, "c", "c.com", now.AddDate(0, 0, -1))
+
+	logDir := t.TempDir()
+	os.WriteFile(filepath.Join(logDir, "a.com-error.log"), []byte(
+		now.Add(-48*time.Hour).Format("2006/01/02 15:04:05")+" [error] 12#12: *1 old failure\n"+
+			now.Add(-2*time.Hour).Format("2006/01/02 15:04:05")+" [warn] 12#12: *2 ignored warning\n"+
+			now.Add(-time.Hour).Format("2006/01/02 15:04:05")+" [error] 12#12: *3 connect() failed (111: Connection refused), client: 1.2.3.4, server: a.com\n"), 0644)
+	os.WriteFile(filepath.Join(logDir, "b.com-error.log"), []byte(
+		now.Add(-30*time.Minute).Format("2006/01/02 15:04:05")+" [crit] 12#12: *4 SSL_do_handshake() failed\n"), 0644)
+
+	svc := NewDashboardService(siteSvc, streamSvc, nil, nil)
+	svc.logDir, svc.acmeDir = logDir, acmeDir
+	dashboard := svc.Summary(now)
+
+	if len(dashboard.Warnings) != 0 {
+		t.Fatalf("unexpected warnings: %v", dashboard.Warnings)
+	}
+	if dashboard.Sites.Total != 2 || dashboard.Sites.Enabled != 1 || dashboard.Sites.Types["proxy"] != 1 || dashboard.Sites.Types["redirect"] != 1 {
+		t.Fatalf("unexpected sites: %+v", dashboard.Sites)
+	}
+	if dashboard.Streams.Total != 1 || dashboard.Streams.Enabled != 0 {
+		t.Fatalf("unexpected streams: %+v", dashboard.Streams)
+	}
+	certs := dashboard.Certs
+	if certs.Total != 3 || certs.Expired != 1 || certs.Expiring != 1 || certs.Soonest[0].Domain != "c.com" || certs.Soonest[1].DaysLeft != 7 {
+		t.Fatalf("unexpected certs: %+v", certs)
+	}
+	errs := dashboard.Errors
+	if errs.Total != 2 || len(errs.Recent) != 2 || errs.Recent[0].Domain != "b.com" || errs.Recent[1].Client != "1.2.3.4" {
+		t.Fatalf("unexpected errors: %+v", errs)
+	}
+	if dashboard.Traffic != nil {
+		t.Fatalf("expected no traffic without system service: %+v", dashboard.Traffic)
+	}
+}
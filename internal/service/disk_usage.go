@@ -0,0 +1,135 @@
+package service
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"nginx-mgr/internal/model"
+)
+
+// diskLargestLogs 返回的最大日志文件数
+const diskLargestLogs = 10
+
+type diskTarget struct {
+	Name string
+	Path string
+	Walk bool // 是否统计目录内文件合计大小
+}
+
+// DiskUsageService 统计根目录、nginx 日志、网站根目录、本地备份与缓存目录的磁盘占用
+type DiskUsageService struct {
+	Targets []diskTarget
+	LogDir  string
+	stat    func(path string) (diskStat, error)
+}
+
+func NewDiskUsageService() *DiskUsageService {
+	return &DiskUsageService{
+		Targets: []diskTarget{
+			{Name: "root", Path: "/"},
+			{Name: "nginx_logs", Path: model.NginxLogDir, Walk: true},
+			{Name: "web_root", Path: defaultWebRoot, Walk: true},
+			{Name: "backups", Path: localBackupDir, Walk: true},
+			{Name: "nginx_cache", Path: model.NginxCacheDir, Walk: true},
+		},
+		LogDir: model.NginxLogDir,
+		stat:   statDisk,
+	}
+}
+
+func (s *DiskUsageService) Usage() *model.DiskUsage {
+	usage := &model.DiskUsage{Paths: []model.DiskPathUsage{}, LargestLogs: []model.DiskLogFile{}}
+	for _, target := range s.Targets {
+		entry := model.DiskPathUsage{Name: target.Name, Path: target.Path}
+		if _, err := os.Stat(target.Path); err != nil {
+			// 备份目录在首次备份前、缓存目录在未启用缓存时不存在
+			if !os.IsNotExist(err) {
+				entry.Error = err.Error()
+			}
+			usage.Paths = append(usage.Paths, entry)
+			continue
+		}
+		entry.Exists = true
+		if stat, err := s.stat(target.Path); err != nil {
+			entry.Error = err.Error()
+		} else if stat.Total > 0 {
+			entry.TotalBytes = stat.Total
+			entry.UsedBytes = stat.Used
+			entry.FreeBytes = stat.Total - stat.Used
+			entry.UsedPercent = float64(stat.Used) / float64(stat.Total) * 100
+		}
+		if target.Walk {
+			entry.SizeBytes = dirSize(target.Path)
+		}
+		usage.Paths = append(usage.Paths, entry)
+	}
+	usage.LargestLogs = largestLogs(s.LogDir, diskLargestLogs)
+	return usage
+}
+
+// dirSize 累加目录内普通文件的大小，不跟随符号链接，无权限的子目录跳过
+func dirSize(root string) uint64 {
+	var total uint64
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() && path != root {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += uint64(info.Size())
+		}
+		return nil
+	})
+	return total
+}
+
+func largestLogs(dir string, limit int) []model.DiskLogFile {
+	files := []model.DiskLogFile{}
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() == 0 {
+			return nil
+		}
+		files = append(files, model.DiskLogFile{
+			Path:       path,
+			SizeBytes:  uint64(info.Size()),
+			ModifiedAt: info.ModTime().Unix(),
+			Rotated:    isRotatedLog(d.Name()),
+		})
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].SizeBytes != files[j].SizeBytes {
+			return files[i].SizeBytes > files[j].SizeBytes
+		}
+		return files[i].Path < files[j].Path
+	})
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	return files
+}
+
+// isRotatedLog 判断 logrotate 产生的旧日志：access.log.1、access.log.2.gz、access.log-20240101 等
+func isRotatedLog(name string) bool {
+	if strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".xz") || strings.HasSuffix(name, ".zst") || strings.HasSuffix(name, ".bz2") {
+		return true
+	}
+	idx := strings.Index(name, ".log")
+	if idx < 0 {
+		return false
+	}
+	rest := name[idx+len(".log"):]
+	return rest != ""
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiskUsage(t *testing.T) {
+	dir := t.TempDir()
+	logDir := filepath.Join(dir, "log")
+	webRoot := filepath.Join(dir, "www")
+	os.MkdirAll(filepath.Join(webRoot, "a.com"), 0755)
+	os.MkdirAll(logDir, 0755)
+	os.WriteFile(filepath.Join(webRoot, "a.com", "index.html"), []byte(strings.Repeat("x", 100)), 0644)
+	os.WriteFile(filepath.Join(webRoot, "index.html"), []byte(strings.Repeat("x", 50)), 0644)
+	os.Symlink(filepath.Join(webRoot, "index.html"), filepath.Join(webRoot, "link.html"))
+	logs := map[string]int{
+		"a.com-access.log":      300,
+		"a.com-access.log.1":    500,
+		"a.com-access.log.2.gz": 200,
+		"error.log":             10,
+		"empty.log":             0,
+	}
+	for name, size := range logs {
+		os.WriteFile(filepath.Join(logDir, name), []byte(strings.Repeat("x", size)), 0644)
+	}
+
+	svc := NewDiskUsageService()
+	svc.Targets = []diskTarget{
+		{Name: "root", Path: dir},
+		{Name: "nginx_logs", Path: logDir, Walk: true},
+		{Name: "web_root", Path: webRoot, Walk: true},
+		{Name: "backups", Path: filepath.Join(dir, "missing"), Walk: true},
+	}
+	svc.LogDir = logDir
+	svc.stat = func(path string) (diskStat, error) {
+		return diskStat{Total: 1000, Used: 250}, nil
+	}
+
+	usage := svc.Usage()
+	if len(usage.Paths) != 4 {
+		t.Fatalf("expected 4 paths, got %+v", usage.Paths)
+	}
+	root, logsUsage, web, backups := usage.Paths[0], usage.Paths[1], usage.Paths[2], usage.Paths[3]
+	if !root.Exists || root.SizeBytes != 0 || root.FreeBytes != 750 || root.UsedPercent != 25 {
+		t.Fatalf("unexpected root usage: %+v", root)
+	}
+	if logsUsage.SizeBytes != 1010 {
+		t.Fatalf("unexpected log dir size: %+v", logsUsage)
+	}
+	if web.SizeBytes != 150 {
+		t.Fatalf("symlinks should not be counted: %+v", web)
+	}
+	if backups.Exists || backups.Error != "" || backups.TotalBytes != 0 {
+		t.Fatalf("missing dir should be reported as absent: %+v", backups)
+	}
+
+	if len(usage.LargestLogs) != 4 {
+		t.Fatalf("empty logs should be skipped: %+v", usage.LargestLogs)
+	}
+	first := usage.LargestLogs[0]
+	if filepath.Base(first.Path) != "a.com-access.log.1" || first.SizeBytes != 500 || !first.Rotated {
+		t.Fatalf("unexpected largest log: %+v", first)
+	}
+	if second := usage.LargestLogs[1]; filepath.Base(second.Path) != "a.com-access.log" || second.Rotated {
+		t.Fatalf("active log should not be marked rotated: %+v", second)
+	}
+	if !usage.LargestLogs[2].Rotated {
+		t.Fatalf("gz log should be marked rotated: %+v", usage.LargestLogs[2])
+	}
+}
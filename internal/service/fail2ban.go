@@ -0,0 +1,384 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+)
+
+const (
+	fail2banSettingsPath = "/root/fail2ban_settings.json"
+	fail2banConfDir      = "/etc/fail2ban"
+)
+
+var (
+	ErrInvalidFail2banSettings = errors.New("fail2ban 设置无效")
+	ErrFail2banJailNotFound    = errors.New("jail 不存在")
+)
+
+// fail2banJailSpec 面板提供的 jail。auth 与 limit-req 使用 fail2ban 自带的过滤器，
+// badbots 使用面板按 UA 拦截名单生成的过滤器
+type fail2banJailSpec struct {
+	name        string
+	description string
+	filter      string
+	logSuffix   string // 匹配站点日志 <domain>-access.log 或 <domain>-error.log
+	defaults    model.Fail2banJail
+}
+
+var fail2banJails = []fail2banJailSpec{
+	{
+		name:        "nginx-mgr-auth",
+		description: "HTTP Basic 认证失败（用户不存在或密码错误）",
+		filter:      "nginx-http-auth",
+		logSuffix:   "-error.log",
+		defaults:    model.Fail2banJail{MaxRetry: 5, FindTimeSeconds: 600, BanTimeSeconds: 3600},
+	},
+	{
+		name:        "nginx-mgr-badbots",
+		description: "命中 UA 拦截名单的扫描器与爬虫",
+		filter:      "nginx-mgr-badbots",
+		logSuffix:   "-access.log",
+		defaults:    model.Fail2banJail{MaxRetry: 1, FindTimeSeconds: 600, BanTimeSeconds: 86400},
+	},
+	{
+		name:        "nginx-mgr-limit-req",
+		description: "多次触发 limit_req 请求限速",
+		filter:      "nginx-limit-req",
+		logSuffix:   "-error.log",
+		defaults:    model.Fail2banJail{MaxRetry: 10, FindTimeSeconds: 600, BanTimeSeconds: 3600},
+	},
+}
+
+// Fail2banService 安装 fail2ban 并维护面板的 nginx jail，可查看与解除各 jail 的封禁
+type Fail2banService struct {
+	ConfDir string
+	LogDir  string
+	Binary  string
+
+	settingsPath string
+	botBlockSvc  *BotBlockService
+	run          func(name string, args ...string) (string, error)
+	mu           sync.Mutex
+}
+
+func NewFail2banService(botBlockSvc *BotBlockService) *Fail2banService {
+	return &Fail2banService{
+		ConfDir:      fail2banConfDir,
+		LogDir:       model.NginxLogDir,
+		Binary:       "fail2ban-client",
+		settingsPath: fail2banSettingsPath,
+		botBlockSvc:  botBlockSvc,
+		run:          executor.ExecuteSimple,
+	}
+}
+
+// JailPath 返回面板写入的 jail 配置路径
+func (s *Fail2banService) JailPath() string {
+	return filepath.Join(s.ConfDir, "jail.d", "nginx-mgr.local")
+}
+
+func (s *Fail2banService) botFilterPath() string {
+	return filepath.Join(s.ConfDir, "filter.d", "nginx-mgr-badbots.conf")
+}
+
+func (s *Fail2banService) defaultSettings() model.Fail2banSettings {
+	settings := model.Fail2banSettings{Jails: []model.Fail2banJail{}}
+	for _, spec := range fail2banJails {
+		jail := spec.defaults
+		jail.Name = spec.name
+		settings.Jails = append(settings.Jails, jail)
+	}
+	return settings
+}
+
+// sanitize 按面板提供的 jail 补全设置，未提交的 jail 保持默认且不启用
+func (s *Fail2banService) sanitize(input model.Fail2banSettings) (model.Fail2banSettings, error) {
+	output := s.defaultSettings()
+	output.LastUpdatedUnixTime = input.LastUpdatedUnixTime
+	for _, jail := range input.Jails {
+		index := -1
+		for i, spec := range fail2banJails {
+			if spec.name == jail.Name {
+				index = i
+			}
+		}
+		if index < 0 {
+			return model.Fail2banSettings{}, fmt.Errorf("%w: 未知的 jail %s", ErrInvalidFail2banSettings, jail.Name)
+		}
+		if jail.MaxRetry < 0 || jail.FindTimeSeconds < 0 || jail.BanTimeSeconds < 0 {
+			return model.Fail2banSettings{}, fmt.Errorf("%w: %s 的阈值不能为负数", ErrInvalidFail2banSettings, jail.Name)
+		}
+		merged := output.Jails[index]
+		merged.Enabled = jail.Enabled
+		if jail.MaxRetry > 0 {
+			merged.MaxRetry = jail.MaxRetry
+		}
+		if jail.FindTimeSeconds > 0 {
+			merged.FindTimeSeconds = jail.FindTimeSeconds
+		}
+		if jail.BanTimeSeconds > 0 {
+			merged.BanTimeSeconds = jail.BanTimeSeconds
+		}
+		output.Jails[index] = merged
+	}
+	return output, nil
+}
+
+func (s *Fail2banService) Get() (model.Fail2banSettings, error) {
+	content, err := os.ReadFile(s.settingsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s.defaultSettings(), nil
+		}
+		return model.Fail2banSettings{}, err
+	}
+	var settings model.Fail2banSettings
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return model.Fail2banSettings{}, err
+	}
+	normalized, err := s.sanitize(settings)
+	if err != nil {
+		return s.defaultSettings(), nil
+	}
+	return normalized, nil
+}
+
+func (s *Fail2banService) installed() bool {
+	_, err := exec.LookPath(s.Binary)
+	return err == nil
+}
+
+func (s *Fail2banService) running() bool {
+	_, err := s.run(s.Binary, "ping")
+	return err == nil
+}
+
+func (s *Fail2banService) ensureInstalled() error {
+	if s.installed() {
+		return nil
+	}
+	if _, err := s.run("bash", "-c", "apt-get update >/dev/null 2>&1 && apt-get install -y fail2ban >/dev/null 2>&1"); err != nil {
+		return fmt.Errorf("安装 fail2ban 失败: %w", err)
+	}
+	if !s.installed() {
+		return fmt.Errorf("安装 fail2ban 失败: 未找到 %s", s.Binary)
+	}
+	return nil
+}
+
+// Status 返回安装情况与各 jail 的封禁列表，fail2ban 未运行时只返回设置
+func (s *Fail2banService) Status() (*model.Fail2banStatus, error) {
+	settings, err := s.Get()
+	if err != nil {
+		return nil, err
+	}
+	status := &model.Fail2banStatus{Installed: s.installed(), JailPath: s.JailPath(), Jails: []model.Fail2banJailStatus{}}
+	status.Running = status.Installed && s.running()
+	for i, jail := range settings.Jails {
+		item := model.Fail2banJailStatus{Fail2banJail: jail, Description: fail2banJails[i].description, BannedIPs: []string{}}
+		if status.Running && jail.Enabled {
+			if out, err := s.run(s.Binary, "status", jail.Name); err == nil {
+				item.Active = true
+				item.CurrentlyFailed, item.TotalBanned, item.BannedIPs = parseFail2banJailStatus(out)
+			}
+		}
+		status.Jails = append(status.Jails, item)
+	}
+	return status, nil
+}
+
+// parseFail2banJailStatus 解析 fail2ban-client status <jail> 的输出：
+//
+//	|- Filter
+//	|  |- Currently failed:	2
+//	`- Actions
+//	   |- Total banned:	3
+//	   `- Banned IP list:	1.2.3.4 5.6.7.8
+func parseFail2banJailStatus(output string) (failed, total int, banned []string) {
+	banned = []string{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.TrimLeft(key, " |`-")
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Currently failed":
+			failed, _ = strconv.Atoi(value)
+		case "Total banned":
+			total, _ = strconv.Atoi(value)
+		case "Banned IP list":
+			banned = append(banned, strings.Fields(value)...)
+		}
+	}
+	return failed, total, banned
+}
+
+// Save 保存设置并写入 jail 与过滤器，首次启用时安装 fail2ban。配置测试失败时恢复原文件
+func (s *Fail2banService) Save(input model.Fail2banSettings) (model.Fail2banSettings, error) {
+	settings, err := s.sanitize(input)
+	if err != nil {
+		return model.Fail2banSettings{}, err
+	}
+	settings.LastUpdatedUnixTime = time.Now().Unix()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.apply(settings); err != nil {
+		return model.Fail2banSettings{}, err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.Fail2banSettings{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.settingsPath), 0700); err != nil {
+		return model.Fail2banSettings{}, err
+	}
+	if err := os.WriteFile(s.settingsPath, data, 0600); err != nil {
+		return model.Fail2banSettings{}, err
+	}
+	return settings, nil
+}
+
+func (s *Fail2banService) apply(settings model.Fail2banSettings) error {
+	enabled := false
+	for _, jail := range settings.Jails {
+		enabled = enabled || jail.Enabled
+	}
+	if !enabled && !s.installed() {
+		return nil
+	}
+	if err := s.ensureInstalled(); err != nil {
+		return err
+	}
+
+	agents := defaultBlockedAgents
+	if s.botBlockSvc != nil {
+		if botSettings, err := s.botBlockSvc.Get(); err == nil && len(botSettings.UserAgents) > 0 {
+			agents = botSettings.UserAgents
+		}
+	}
+	files := map[string]string{
+		s.JailPath():      s.renderJails(settings),
+		s.botFilterPath(): renderBadBotFilter(agents),
+	}
+	previous := map[string][]byte{}
+	for path := range files {
+		if data, err := os.ReadFile(path); err == nil {
+			previous[path] = data
+		}
+	}
+	restore := func() {
+		for path := range files {
+			if data, ok := previous[path]; ok {
+				os.WriteFile(path, data, 0644)
+			} else {
+				os.Remove(path)
+			}
+		}
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			restore()
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			restore()
+			return err
+		}
+	}
+	if out, err := s.run(s.Binary, "-t"); err != nil {
+		restore()
+		return fmt.Errorf("fail2ban 配置测试失败: %s", strings.TrimSpace(out))
+	}
+	if s.running() {
+		if out, err := s.run(s.Binary, "reload"); err != nil {
+			return fmt.Errorf("重载 fail2ban 失败: %s", strings.TrimSpace(out))
+		}
+		return nil
+	}
+	if enabled {
+		if out, err := s.run("systemctl", "enable", "--now", "fail2ban"); err != nil {
+			return fmt.Errorf("启动 fail2ban 失败: %s", strings.TrimSpace(out))
+		}
+	}
+	return nil
+}
+
+// renderJails 生成 jail 配置，关闭的 jail 也写入并标记 enabled = false，便于手动查看
+func (s *Fail2banService) renderJails(settings model.Fail2banSettings) string {
+	var b strings.Builder
+	b.WriteString("# 由面板自动生成，请勿手动修改\n")
+	for i, jail := range settings.Jails {
+		spec := fail2banJails[i]
+		fmt.Fprintf(&b, "\n[%s]\n", jail.Name)
+		fmt.Fprintf(&b, "# %s\n", spec.description)
+		fmt.Fprintf(&b, "enabled  = %t\n", jail.Enabled)
+		b.WriteString("port     = http,https\n")
+		fmt.Fprintf(&b, "filter   = %s\n", spec.filter)
+		fmt.Fprintf(&b, "logpath  = %s\n", filepath.Join(s.LogDir, "*"+spec.logSuffix))
+		fmt.Fprintf(&b, "maxretry = %d\n", jail.MaxRetry)
+		fmt.Fprintf(&b, "findtime = %d\n", jail.FindTimeSeconds)
+		fmt.Fprintf(&b, "bantime  = %d\n", jail.BanTimeSeconds)
+	}
+	return b.String()
+}
+
+// renderBadBotFilter 按 UA 拦截名单生成过滤器，同时匹配 combined/main_timing 与 main_json 格式的访问日志。
+// fail2ban 的配置会做 % 插值，规则中的 % 需要写成 %%
+func renderBadBotFilter(agents []string) string {
+	pattern := strings.ReplaceAll("(?i:"+strings.Join(agents, "|")+")", "%", "%%")
+	var b strings.Builder
+	b.WriteString("# 由面板自动生成，请勿手动修改\n[Definition]\n")
+	fmt.Fprintf(&b, "failregex = ^<HOST> \\S+ \\S+ \\[[^\\]]+\\] \"[^\"]*\" \\d+ \\d+ \"[^\"]*\" \"[^\"]*%s[^\"]*\"\n", pattern)
+	fmt.Fprintf(&b, "            ^\\{\"time_local\":\"[^\"]*\",\"remote_addr\":\"<HOST>\".*\"http_user_agent\":\"[^\"]*%s[^\"]*\"\n", pattern)
+	b.WriteString("ignoreregex =\n")
+	return b.String()
+}
+
+// RefreshBotFilter UA 拦截名单变化后重新生成 badbots 过滤器，该 jail 未启用时不做改动
+func (s *Fail2banService) RefreshBotFilter() error {
+	settings, err := s.Get()
+	if err != nil {
+		return err
+	}
+	for _, jail := range settings.Jails {
+		if jail.Name == "nginx-mgr-badbots" && jail.Enabled {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return s.apply(settings)
+		}
+	}
+	return nil
+}
+
+// Unban 从指定 jail 中解除 IP 的封禁
+func (s *Fail2banService) Unban(jail, ip string) error {
+	found := false
+	for _, spec := range fail2banJails {
+		found = found || spec.name == jail
+	}
+	if !found {
+		return ErrFail2banJailNotFound
+	}
+	addr, err := normalizeBanIP(ip)
+	if err != nil {
+		return fmt.Errorf("%w: %q 不是合法的 IP", ErrInvalidFail2banSettings, ip)
+	}
+	if out, err := s.run(s.Binary, "set", jail, "unbanip", addr); err != nil {
+		return fmt.Errorf("解除封禁失败: %s", strings.TrimSpace(out))
+	}
+	return nil
+}
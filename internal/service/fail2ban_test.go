@@ -0,0 +1,117 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"nginx-mgr/internal/model"
+)
+
+func TestFail2banSave(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "fail2ban-client")
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	testErr := error(nil)
+	var calls []string
+	svc := &Fail2banService{
+		ConfDir:      filepath.Join(dir, "fail2ban"),
+		LogDir:       "/var/log/nginx",
+		Binary:       binary,
+		settingsPath: filepath.Join(dir, "fail2ban.json"),
+		run: func(name string, args ...string) (string, error) {
+			call := filepath.Base(name) + " " + strings.Join(args, " ")
+			calls = append(calls, call)
+			switch call {
+			case "fail2ban-client -t":
+				if testErr != nil {
+					return "ERROR  Failed during configuration", testErr
+				}
+			case "fail2ban-client status nginx-mgr-auth":
+				return "Status for the jail: nginx-mgr-auth\n|- Filter\n|  |- Currently failed:\t2\n|  `- File list:\t/var/log/nginx/a.com-error.log\n`- Actions\n   |- Currently banned:\t2\n   |- Total banned:\t3\n   `- Banned IP list:\t203.0.113.5 2001:db8::1\n", nil
+			}
+			return "", nil
+		},
+	}
+
+	if _, err := svc.Save(model.Fail2banSettings{Jails: []model.Fail2banJail{{Name: "sshd", Enabled: true}}}); !errors.Is(err, ErrInvalidFail2banSettings) {
+		t.Fatalf("expected unknown jail to be rejected, got %v", err)
+	}
+	saved, err := svc.Save(model.Fail2banSettings{Jails: []model.Fail2banJail{{Name: "nginx-mgr-auth", Enabled: true, MaxRetry: 3}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Jails) != 3 || saved.Jails[0].MaxRetry != 3 || saved.Jails[0].BanTimeSeconds != 3600 || saved.Jails[1].Enabled {
+		t.Fatalf("unexpected saved settings: %+v", saved)
+	}
+	jail, _ := os.ReadFile(svc.JailPath())
+	for _, want := range []string{"[nginx-mgr-auth]\n", "enabled  = true\n", "maxretry = 3\n", "logpath  = /var/log/nginx/*-error.log\n", "[nginx-mgr-badbots]\n# 命中 UA 拦截名单的扫描器与爬虫\nenabled  = false\n"} {
+		if !strings.Contains(string(jail), want) {
+			t.Fatalf("jail config missing %q:\n%s", want, jail)
+		}
+	}
+
+	status, err := svc.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := status.Jails[0]
+	if !status.Running || !auth.Active || auth.CurrentlyFailed != 2 || auth.TotalBanned != 3 || strings.Join(auth.BannedIPs, ",") != "203.0.113.5,2001:db8::1" {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	// 配置测试失败时恢复原 jail 配置
+	testErr = errors.New("exit status 255")
+	if _, err := svc.Save(model.Fail2banSettings{}); err == nil {
+		t.Fatal("expected test failure")
+	}
+	if after, _ := os.ReadFile(svc.JailPath()); string(after) != string(jail) {
+		t.Fatalf("jail config not restored:\n%s", after)
+	}
+
+	if err := svc.Unban("nginx-mgr-auth", "203.0.113.5"); err != nil {
+		t.Fatal(err)
+	}
+	if last := calls[len(calls)-1]; last != "fail2ban-client set nginx-mgr-auth unbanip 203.0.113.5" {
+		t.Fatalf("unexpected unban call: %s", last)
+	}
+	if err := svc.Unban("sshd", "203.0.113.5"); !errors.Is(err, ErrFail2banJailNotFound) {
+		t.Fatalf("expected unknown jail, got %v", err)
+	}
+}
+
+func TestBadBotFilter(t *testing.T) {
+	filter := renderBadBotFilter([]string{"sqlmap", "Ahrefs.*Bot"})
+	_, regexes, _ := strings.Cut(filter, "failregex = ")
+	regexes, _, _ = strings.Cut(regexes, "ignoreregex")
+	lines := []string{
+		`203.0.113.5 - - [16/Oct/2026:10:00:00 +0000] "GET /?id=1 HTTP/1.1" 403 0 "-" "sqlmap/1.7"`,
+		`{"time_local":"16/Oct/2026:10:00:00 +0000","remote_addr":"203.0.113.5","remote_user":"","request":"GET / HTTP/1.1","status":403,"body_bytes_sent":0,"http_referer":"","http_user_agent":"Mozilla/5.0 (compatible; AhrefsBot/7.0)","host":"a.com","request_time":0.000,"upstream_response_time":""}`,
+	}
+	var patterns []*regexp.Regexp
+	for _, raw := range strings.Split(strings.TrimSpace(regexes), "\n") {
+		raw = strings.ReplaceAll(strings.TrimSpace(raw), "<HOST>", `(?P<host>[0-9a-f.:]+)`)
+		patterns = append(patterns, regexp.MustCompile(raw))
+	}
+	for _, line := range lines {
+		matched := false
+		for _, pattern := range patterns {
+			if match := pattern.FindStringSubmatch(line); match != nil && match[1] == "203.0.113.5" {
+				matched = true
+			}
+		}
+		if !matched {
+			t.Fatalf("filter does not match %s", line)
+		}
+	}
+	for _, pattern := range patterns {
+		if pattern.MatchString(`203.0.113.5 - - [16/Oct/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 5 "-" "curl/8.0"`) {
+			t.Fatal("filter matched a normal request")
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+)
+
+const (
+	firewallSettingsPath = "/root/firewall_settings.json"
+	firewallBackendAuto  = "auto"
+	firewallBackendUfw   = "ufw"
+	firewallBackendFwd   = "firewalld"
+	firewallBackendNft   = "nftables"
+	// firewallRuleComment 面板添加的 ufw 与 nftables 规则带有的注释
+	firewallRuleComment = "nginx-mgr"
+	// firewallNftChain nftables 后端放行端口的链，即发行版默认的 /etc/nftables.conf 中的 input 链
+	firewallNftChain = "inet filter input"
+)
+
+var ErrInvalidFirewallSettings = errors.New("防火墙联动设置无效")
+
+var nftHandlePattern = regexp.MustCompile(`# handle (\d+)$`)
+
+// firewallState 保存在状态库中的联动状态
+type firewallState struct {
+	Rules            []model.FirewallRule `json:"rules"`
+	LastSyncUnixTime int64                `json:"last_sync_unix_time"`
+	LastError        string               `json:"last_error,omitempty"`
+}
+
+// FirewallService 按启用的站点（80/443）与四层转发规则的监听端口，在 ufw、firewalld 或 nftables 中放行端口。
+// 只关闭自己放行的端口，放行前已经允许的端口会标记为 Preexisting 并保持不变
+type FirewallService struct {
+	settingsPath string
+	store        *StateStore
+	run          func(name string, args ...string) (string, error)
+	// sources 返回需要放行的端口及其使用者
+	sources func() (map[string][]model.FirewallPort, error)
+	mu      sync.Mutex
+}
+
+func NewFirewallService(siteSvc *SiteService, streamSvc *StreamService, sniSvc *SNIService) *FirewallService {
+	return &FirewallService{
+		settingsPath: firewallSettingsPath,
+		store:        openStateStore(""),
+		run:          executor.ExecuteSimple,
+		sources: func() (map[string][]model.FirewallPort, error) {
+			return firewallSources(siteSvc, streamSvc, sniSvc)
+		},
+	}
+}
+
+// firewallSources 启用的站点使用 80/443，启用的转发规则与 SNI 分流使用各自的监听端口
+func firewallSources(siteSvc *SiteService, streamSvc *StreamService, sniSvc *SNIService) (map[string][]model.FirewallPort, error) {
+	sources := map[string][]model.FirewallPort{}
+	domains, err := siteSvc.ListEnabledSites()
+	if err != nil {
+		return nil, err
+	}
+	for _, domain := range domains {
+		sources["site:"+domain] = []model.FirewallPort{{Port: 80, Protocol: "tcp"}, {Port: 443, Protocol: "tcp"}}
+	}
+	streams, err := streamSvc.ListStreamConfigs()
+	if err != nil {
+		return nil, err
+	}
+	for _, stream := range streams {
+		if !stream.Enabled || stream.ListenPort == 0 {
+			continue
+		}
+		var ports []model.FirewallPort
+		if stream.Protocol != "udp" {
+			ports = append(ports, model.FirewallPort{Port: stream.ListenPort, Protocol: "tcp"})
+		}
+		if stream.Protocol == "udp" || stream.Protocol == "both" {
+			ports = append(ports, model.FirewallPort{Port: stream.ListenPort, Protocol: "udp"})
+		}
+		sources["stream:"+stream.Name] = ports
+	}
+	routes, err := sniSvc.ListSNI()
+	if err != nil {
+		return nil, err
+	}
+	for _, route := range routes {
+		if route.ListenPort != 0 {
+			sources["sni:"+route.Name] = []model.FirewallPort{{Port: route.ListenPort, Protocol: "tcp"}}
+		}
+	}
+	return sources, nil
+}
+
+func (s *FirewallService) defaultSettings() model.FirewallSettings {
+	return model.FirewallSettings{Enabled: false, Backend: firewallBackendAuto}
+}
+
+func (s *FirewallService) sanitize(input model.FirewallSettings) (model.FirewallSettings, error) {
+	output := s.defaultSettings()
+	output.Enabled = input.Enabled
+	output.LastUpdatedUnixTime = input.LastUpdatedUnixTime
+	switch input.Backend {
+	case "", firewallBackendAuto:
+	case firewallBackendUfw, firewallBackendFwd, firewallBackendNft:
+		output.Backend = input.Backend
+	default:
+		return model.FirewallSettings{}, fmt.Errorf("%w: 不支持的防火墙 %s", ErrInvalidFirewallSettings, input.Backend)
+	}
+	return output, nil
+}
+
+func (s *FirewallService) GetSettings() (model.FirewallSettings, error) {
+	content, err := os.ReadFile(s.settingsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s.defaultSettings(), nil
+		}
+		return model.FirewallSettings{}, err
+	}
+	var settings model.FirewallSettings
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return model.FirewallSettings{}, err
+	}
+	normalized, err := s.sanitize(settings)
+	if err != nil {
+		return s.defaultSettings(), nil
+	}
+	return normalized, nil
+}
+
+// SaveSettings 保存设置，开启时立即同步一次。同步失败不影响保存，错误记录在状态中
+func (s *FirewallService) SaveSettings(input model.FirewallSettings) (model.FirewallSettings, error) {
+	settings, err := s.sanitize(input)
+	if err != nil {
+		return model.FirewallSettings{}, err
+	}
+	if settings.Enabled && settings.Backend != firewallBackendAuto && !s.backendActive(settings.Backend) {
+		return model.FirewallSettings{}, fmt.Errorf("%w: %s 未安装或未运行", ErrInvalidFirewallSettings, settings.Backend)
+	}
+	settings.LastUpdatedUnixTime = time.Now().Unix()
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.FirewallSettings{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.settingsPath), 0700); err != nil {
+		return model.FirewallSettings{}, err
+	}
+	if err := os.WriteFile(s.settingsPath, data, 0600); err != nil {
+		return model.FirewallSettings{}, err
+	}
+	if settings.Enabled {
+		s.Sync()
+	}
+	return settings, nil
+}
+
+func (s *FirewallService) loadState() (firewallState, error) {
+	var state firewallState
+	if err := s.store.Get(stateKeyFirewall, &state); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return firewallState{}, err
+	}
+	if state.Rules == nil {
+		state.Rules = []model.FirewallRule{}
+	}
+	return state, nil
+}
+
+func (s *FirewallService) Status() (*model.FirewallStatus, error) {
+	settings, err := s.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.loadState()
+	if err != nil {
+		return nil, err
+	}
+	return &model.FirewallStatus{
+		FirewallSettings: settings,
+		Active:           s.detect(settings.Backend),
+		Rules:            state.Rules,
+		LastSyncUnixTime: state.LastSyncUnixTime,
+		LastError:        state.LastError,
+	}, nil
+}
+
+// detect 返回要使用的防火墙。auto 时依次检测 ufw、firewalld 与 nftables，都未运行时返回空字符串
+func (s *FirewallService) detect(backend string) string {
+	candidates := []string{firewallBackendUfw, firewallBackendFwd, firewallBackendNft}
+	if backend != "" && backend != firewallBackendAuto {
+		candidates = []string{backend}
+	}
+	for _, candidate := range candidates {
+		if s.backendActive(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+func (s *FirewallService) backendActive(backend string) bool {
+	switch backend {
+	case firewallBackendUfw:
+		out, err := s.run("ufw", "status")
+		return err == nil && strings.Contains(out, "Status: active")
+	case firewallBackendFwd:
+		out, err := s.run("firewall-cmd", "--state")
+		return err == nil && strings.TrimSpace(out) == "running"
+	case firewallBackendNft:
+		_, err := s.run("nft", append([]string{"list", "chain"}, strings.Fields(firewallNftChain)...)...)
+		return err == nil
+	}
+	return false
+}
+
+// Sync 对比需要的端口与已放行的规则，放行新增端口、关闭不再使用的端口。未开启联动或未检测到防火墙时不做改动
+func (s *FirewallService) Sync() error {
+	settings, err := s.GetSettings()
+	if err != nil || !settings.Enabled {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := s.loadState()
+	if err != nil {
+		return err
+	}
+	syncErr := s.syncLocked(settings, &state)
+	state.LastSyncUnixTime = time.Now().Unix()
+	state.LastError = ""
+	if syncErr != nil {
+		state.LastError = syncErr.Error()
+	}
+	if err := s.store.Put(stateKeyFirewall, state); err != nil {
+		return err
+	}
+	return syncErr
+}
+
+func (s *FirewallService) syncLocked(settings model.FirewallSettings, state *firewallState) error {
+	backend := s.detect(settings.Backend)
+	if backend == "" {
+		return errors.New("未检测到正在运行的 ufw、firewalld 或 nftables，端口未做改动")
+	}
+	sources, err := s.sources()
+	if err != nil {
+		return err
+	}
+	desired := map[model.FirewallPort][]string{}
+	for owner, ports := range sources {
+		for _, port := range ports {
+			desired[port] = append(desired[port], owner)
+		}
+	}
+
+	var errs []string
+	rules := []model.FirewallRule{}
+	for _, rule := range state.Rules {
+		owners, ok := desired[rule.FirewallPort]
+		if ok {
+			sort.Strings(owners)
+			rule.Owners = owners
+			rules = append(rules, rule)
+			delete(desired, rule.FirewallPort)
+			continue
+		}
+		if !rule.Preexisting {
+			if err := s.deny(rule.Backend, rule.FirewallPort); err != nil {
+				errs = append(errs, fmt.Sprintf("关闭 %d/%s 失败: %v", rule.Port, rule.Protocol, err))
+				rule.Owners = []string{}
+				rules = append(rules, rule)
+				continue
+			}
+		}
+	}
+	for port, owners := range desired {
+		sort.Strings(owners)
+		rule := model.FirewallRule{FirewallPort: port, Backend: backend, Owners: owners, CreatedUnixTime: time.Now().Unix()}
+		if s.allowed(backend, port) {
+			rule.Preexisting = true
+		} else if err := s.allow(backend, port); err != nil {
+			errs = append(errs, fmt.Sprintf("放行 %d/%s 失败: %v", port.Port, port.Protocol, err))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Port != rules[j].Port {
+			return rules[i].Port < rules[j].Port
+		}
+		return rules[i].Protocol < rules[j].Protocol
+	})
+	state.Rules = rules
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func portSpec(port model.FirewallPort) string {
+	return strconv.Itoa(port.Port) + "/" + port.Protocol
+}
+
+// allowed 检查防火墙中是否已有放行该端口的规则
+func (s *FirewallService) allowed(backend string, port model.FirewallPort) bool {
+	switch backend {
+	case firewallBackendUfw:
+		out, err := s.run("ufw", "status")
+		if err != nil {
+			return false
+		}
+		for _, line := range strings.Split(out, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && (fields[0] == portSpec(port) || fields[0] == strconv.Itoa(port.Port)) && fields[1] == "ALLOW" {
+				return true
+			}
+		}
+		return false
+	case firewallBackendFwd:
+		if _, err := s.run("firewall-cmd", "--query-port="+portSpec(port)); err == nil {
+			return true
+		}
+		service := map[int]string{80: "http", 443: "https"}[port.Port]
+		if service != "" && port.Protocol == "tcp" {
+			_, err := s.run("firewall-cmd", "--query-service="+service)
+			return err == nil
+		}
+		return false
+	case firewallBackendNft:
+		out, err := s.run("nft", append([]string{"list", "chain"}, strings.Fields(firewallNftChain)...)...)
+		if err != nil {
+			return false
+		}
+		pattern := regexp.MustCompile(fmt.Sprintf(`\b%s dport (%d|\{[^}]*\b%d\b[^}]*\})\s.*\baccept\b`, port.Protocol, port.Port, port.Port))
+		return pattern.MatchString(out)
+	}
+	return false
+}
+
+func (s *FirewallService) allow(backend string, port model.FirewallPort) error {
+	var out string
+	var err error
+	switch backend {
+	case firewallBackendUfw:
+		out, err = s.run("ufw", "allow", portSpec(port), "comment", firewallRuleComment)
+	case firewallBackendFwd:
+		if out, err = s.run("firewall-cmd", "--add-port="+portSpec(port)); err == nil {
+			out, err = s.run("firewall-cmd", "--permanent", "--add-port="+portSpec(port))
+		}
+	case firewallBackendNft:
+		// insert 插在链首，避免排在已有的 drop/reject 规则之后
+		args := append([]string{"insert", "rule"}, strings.Fields(firewallNftChain)...)
+		args = append(args, port.Protocol, "dport", strconv.Itoa(port.Port), "accept", "comment", `"`+firewallRuleComment+`"`)
+		out, err = s.run("nft", args...)
+	default:
+		return fmt.Errorf("不支持的防火墙 %s", backend)
+	}
+	if err != nil {
+		return fmt.Errorf("%s", strings.TrimSpace(out))
+	}
+	return nil
+}
+
+func (s *FirewallService) deny(backend string, port model.FirewallPort) error {
+	var out string
+	var err error
+	switch backend {
+	case firewallBackendUfw:
+		out, err = s.run("ufw", "delete", "allow", portSpec(port))
+	case firewallBackendFwd:
+		if out, err = s.run("firewall-cmd", "--remove-port="+portSpec(port)); err == nil {
+			out, err = s.run("firewall-cmd", "--permanent", "--remove-port="+portSpec(port))
+		}
+	case firewallBackendNft:
+		return s.denyNft(port)
+	default:
+		return fmt.Errorf("不支持的防火墙 %s", backend)
+	}
+	if err != nil {
+		return fmt.Errorf("%s", strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// denyNft 按句柄删除面板添加的 nftables 规则
+func (s *FirewallService) denyNft(port model.FirewallPort) error {
+	out, err := s.run("nft", append([]string{"-a", "list", "chain"}, strings.Fields(firewallNftChain)...)...)
+	if err != nil {
+		return fmt.Errorf("%s", strings.TrimSpace(out))
+	}
+	rule := fmt.Sprintf("%s dport %d accept comment %q", port.Protocol, port.Port, firewallRuleComment)
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.Contains(line, rule) {
+			continue
+		}
+		match := nftHandlePattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		args := append([]string{"delete", "rule"}, strings.Fields(firewallNftChain)...)
+		if out, err := s.run("nft", append(args, "handle", match[1])...); err != nil {
+			return fmt.Errorf("%s", strings.TrimSpace(out))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nginx-mgr/internal/model"
+)
+
+// fakeUfw 模拟 ufw 的 status、allow 与 delete allow
+type fakeUfw struct {
+	rules map[string]bool
+	calls []string
+}
+
+func (f *fakeUfw) run(name string, args ...string) (string, error) {
+	call := name + " " + strings.Join(args, " ")
+	if name != "ufw" {
+		return "command not found", errors.New("exit status 127")
+	}
+	switch {
+	case call == "ufw status":
+		out := "Status: active\n\nTo                         Action      From\n--                         ------      ----\n"
+		for rule := range f.rules {
+			out += rule + "                     ALLOW       Anywhere\n"
+		}
+		return out, nil
+	case len(args) >= 2 && args[0] == "allow":
+		f.rules[args[1]] = true
+	case len(args) >= 3 && args[0] == "delete":
+		delete(f.rules, args[2])
+	}
+	f.calls = append(f.calls, call)
+	return "", nil
+}
+
+func TestFirewallSync(t *testing.T) {
+	dir := t.TempDir()
+	ufw := &fakeUfw{rules: map[string]bool{"22/tcp": true, "80/tcp": true}}
+	sources := map[string][]model.FirewallPort{
+		"site:a.com":   {{Port: 80, Protocol: "tcp"}, {Port: 443, Protocol: "tcp"}},
+		"site:b.com":   {{Port: 80, Protocol: "tcp"}, {Port: 443, Protocol: "tcp"}},
+		"stream:mysql": {{Port: 3306, Protocol: "tcp"}},
+		"stream:dns":   {{Port: 53, Protocol: "tcp"}, {Port: 53, Protocol: "udp"}},
+	}
+	svc := &FirewallService{
+		settingsPath: filepath.Join(dir, "firewall.json"),
+		store:        openStateStore(filepath.Join(dir, "state.json")),
+		run:          ufw.run,
+		sources:      func() (map[string][]model.FirewallPort, error) { return sources, nil },
+	}
+
+	// 未开启时不做任何改动
+	if err := svc.Sync(); err != nil || len(ufw.calls) != 0 {
+		t.Fatalf("disabled sync changed firewall: %v %v", err, ufw.calls)
+	}
+	if _, err := svc.SaveSettings(model.FirewallSettings{Enabled: true, Backend: "firewalld"}); !errors.Is(err, ErrInvalidFirewallSettings) {
+		t.Fatalf("expected inactive backend to be rejected, got %v", err)
+	}
+	if _, err := svc.SaveSettings(model.FirewallSettings{Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, spec := range []string{"443/tcp", "3306/tcp", "53/tcp", "53/udp"} {
+		if !ufw.rules[spec] {
+			t.Fatalf("%s not opened: %v", spec, ufw.calls)
+		}
+	}
+	status, err := svc.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Active != "ufw" || len(status.Rules) != 5 || status.LastError != "" {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if web := status.Rules[2]; web.Port != 80 || !web.Preexisting || strings.Join(web.Owners, ",") != "site:a.com,site:b.com" {
+		t.Fatalf("unexpected rule for 80: %+v", web)
+	}
+
+	// 删除转发规则与全部站点后，只关闭面板放行的端口
+	delete(sources, "stream:mysql")
+	delete(sources, "site:a.com")
+	delete(sources, "site:b.com")
+	if err := svc.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if ufw.rules["3306/tcp"] || ufw.rules["443/tcp"] {
+		t.Fatalf("unused ports still open: %v", ufw.rules)
+	}
+	if !ufw.rules["80/tcp"] || !ufw.rules["22/tcp"] || !ufw.rules["53/udp"] {
+		t.Fatalf("ports closed unexpectedly: %v", ufw.rules)
+	}
+	if status, _ := svc.Status(); len(status.Rules) != 2 {
+		t.Fatalf("unexpected rules after sync: %+v", status.Rules)
+	}
+}
+
+func TestFirewallSources(t *testing.T) {
+	siteSvc := newTestSiteService(t)
+	if err := siteSvc.CreateSite(model.SiteConfig{Domain: "a.com", Type: "static"}); err != nil {
+		t.Fatal(err)
+	}
+	streamSvc := &StreamService{ConfDir: siteSvc.ConfDir}
+	os.MkdirAll(filepath.Join(siteSvc.ConfDir, "streams-available"), 0755)
+	sniSvc := &SNIService{ConfDir: siteSvc.ConfDir}
+	content, err := sniSvc.render(model.SNIConfig{Name: "tls", ListenPort: 8443, Routes: []model.SNIRoute{{Hostname: "a.com", Target: "10.0.0.1:443"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sniSvc.WriteSNIRaw("tls", content); err != nil {
+		t.Fatal(err)
+	}
+
+	sources, err := firewallSources(siteSvc, streamSvc, sniSvc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ports := sources["sni:tls"]; len(ports) != 1 || ports[0] != (model.FirewallPort{Port: 8443, Protocol: "tcp"}) {
+		t.Fatalf("SNI listen port missing: %+v", sources)
+	}
+	if len(sources["site:a.com"]) != 2 {
+		t.Fatalf("site ports missing: %+v", sources)
+	}
+}
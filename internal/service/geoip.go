@@ -0,0 +1,203 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	geoIPDir           = "/root/geoip"
+	geoIPCheckInterval = time.Minute
+	geoIPMaxUpload     = 256 << 20
+	geoIPCacheSize     = 1 << 16
+)
+
+var ErrInvalidGeoIPDB = errors.New("GeoIP 数据库无效")
+
+// geoIPDefaultPaths 依次查找的数据库位置：面板上传的文件优先，其次是 geoipupdate 的默认下载目录
+func geoIPDefaultPaths() []string {
+	paths := []string{filepath.Join(geoIPDir, "GeoIP.mmdb")}
+	for _, dir := range []string{"/usr/share/GeoIP", "/var/lib/GeoIP"} {
+		for _, name := range []string{"GeoLite2-City.mmdb", "GeoLite2-Country.mmdb", "GeoIP2-City.mmdb", "GeoIP2-Country.mmdb"} {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	return paths
+}
+
+type geoLocation struct {
+	country string // ISO 3166-1 代码
+	region  string // 国家代码-省份代码，仅 City 数据库提供
+}
+
+// GeoIPService 按 IP 查询国家与地区。没有数据库时 Lookup 返回 ok=false，调用方跳过地区统计；
+// 数据库文件被替换后在下次检查时自动重新加载
+type GeoIPService struct {
+	Paths []string
+
+	mu      sync.Mutex
+	reader  *mmdbReader
+	path    string
+	modTime time.Time
+	loadErr error
+	checked time.Time
+	cache   map[uint]geoLocation
+}
+
+func NewGeoIPService() *GeoIPService {
+	return &GeoIPService{Paths: geoIPDefaultPaths()}
+}
+
+// refreshLocked 每分钟最多检查一次数据库文件是否出现、消失或被更新
+func (g *GeoIPService) refreshLocked(now time.Time) {
+	if !g.checked.IsZero() && now.Sub(g.checked) < geoIPCheckInterval {
+		return
+	}
+	g.checked = now
+
+	path, modTime := "", time.Time{}
+	for _, candidate := range g.Paths {
+		if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+			path, modTime = candidate, info.ModTime()
+			break
+		}
+	}
+	if path == g.path && modTime.Equal(g.modTime) {
+		return
+	}
+	g.path, g.modTime = path, modTime
+	g.reader, g.loadErr, g.cache = nil, nil, nil
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		g.reader, err = openMMDB(data)
+	}
+	if err != nil {
+		g.loadErr = err
+		log.Printf("[geoip] 加载 %s 失败: %v", path, err)
+		return
+	}
+	g.cache = make(map[uint]geoLocation)
+	log.Printf("[geoip] 已加载 %s (%s)", path, g.reader.databaseType)
+}
+
+// Lookup 返回 IP 所属的国家与地区代码，数据库中没有该地址时两者为空。ok 为 false 表示没有可用的数据库
+func (g *GeoIPService) Lookup(ip string) (country, region string, ok bool) {
+	if g == nil {
+		return "", "", false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.refreshLocked(time.Now())
+	if g.reader == nil {
+		return "", "", false
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", "", true
+	}
+	offset, found, err := g.reader.lookup(parsed)
+	if err != nil || !found {
+		return "", "", true
+	}
+	if location, cached := g.cache[offset]; cached {
+		return location.country, location.region, true
+	}
+	var location geoLocation
+	if value, err := g.reader.decode(offset); err == nil {
+		location = geoLocationFromRecord(value)
+	}
+	if len(g.cache) >= geoIPCacheSize {
+		g.cache = make(map[uint]geoLocation)
+	}
+	g.cache[offset] = location
+	return location.country, location.region, true
+}
+
+// geoLocationFromRecord 从 GeoLite2/GeoIP2 记录中取国家与第一级行政区，没有 country 时使用注册国家
+func geoLocationFromRecord(value any) geoLocation {
+	record, _ := value.(map[string]any)
+	isoCode := func(value any) string {
+		fields, _ := value.(map[string]any)
+		code, _ := fields["iso_code"].(string)
+		return code
+	}
+	location := geoLocation{country: isoCode(record["country"])}
+	if location.country == "" {
+		location.country = isoCode(record["registered_country"])
+	}
+	if subdivisions, _ := record["subdivisions"].([]any); len(subdivisions) > 0 && location.country != "" {
+		if code := isoCode(subdivisions[0]); code != "" {
+			location.region = location.country + "-" + code
+		}
+	}
+	return location
+}
+
+// Available 是否有可用的数据库
+func (g *GeoIPService) Available() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.refreshLocked(time.Now())
+	return g.reader != nil
+}
+
+func (g *GeoIPService) Status() model.GeoIPStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.refreshLocked(time.Now())
+	status := model.GeoIPStatus{Path: g.path}
+	if g.loadErr != nil {
+		status.Error = g.loadErr.Error()
+	}
+	if g.reader != nil {
+		status.Available = true
+		status.DatabaseType = g.reader.databaseType
+		status.BuildUnixTime = int64(g.reader.buildEpoch)
+	}
+	return status
+}
+
+// Install 校验上传的 .mmdb 文件并保存为面板使用的数据库，立即生效
+func (g *GeoIPService) Install(src io.Reader) error {
+	data, err := io.ReadAll(io.LimitReader(src, geoIPMaxUpload+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > geoIPMaxUpload {
+		return fmt.Errorf("%w: 文件超过 %d MB", ErrInvalidGeoIPDB, geoIPMaxUpload>>20)
+	}
+	if _, err := openMMDB(data); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidGeoIPDB, err)
+	}
+	target := g.Paths[0]
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	g.mu.Lock()
+	g.checked, g.path = time.Time{}, ""
+	g.mu.Unlock()
+	return nil
+}
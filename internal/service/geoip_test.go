@@ -0,0 +1,218 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testMMDBNetwork struct {
+	cidr   string
+	record any // map[string]any，或 testMMDBPointer 指向前面的记录
+}
+
+type testMMDBPointer int
+
+// buildTestMMDB 生成 record_size 为 24 的最小 MaxMind DB
+func buildTestMMDB(t *testing.T, ipVersion int, networks []testMMDBNetwork) []byte {
+	t.Helper()
+	type record struct {
+		node, data int // node>0 指向子节点，data>=0 指向数据记录
+	}
+	nodes := [][2]record{{{data: -1}, {data: -1}}}
+	var data bytes.Buffer
+	var offsets []int
+	for i, network := range networks {
+		_, ipnet, err := net.ParseCIDR(network.cidr)
+		if err != nil {
+			t.Fatalf("parse %s: %v", network.cidr, err)
+		}
+		ones, _ := ipnet.Mask.Size()
+		ip := ipnet.IP.To16()
+		if v4 := ipnet.IP.To4(); v4 != nil {
+			ip = v4
+			if ipVersion == 6 {
+				ip, ones = append(make(net.IP, 12), v4...), ones+96
+			}
+		}
+
+		offsets = append(offsets, data.Len())
+		if ptr, ok := network.record.(testMMDBPointer); ok {
+			target := offsets[ptr]
+			data.Write([]byte{byte(1<<5 | target>>8&0x7), byte(target)})
+		} else {
+			encodeTestMMDB(&data, network.record)
+		}
+
+		node := 0
+		for bit := 0; bit < ones; bit++ {
+			side := ip[bit/8] >> (7 - bit%8) & 1
+			if bit == ones-1 {
+				nodes[node][side] = record{data: i}
+				break
+			}
+			if nodes[node][side].node == 0 {
+				nodes = append(nodes, [2]record{{data: -1}, {data: -1}})
+				nodes[node][side] = record{node: len(nodes) - 1, data: -1}
+			}
+			node = nodes[node][side].node
+		}
+	}
+
+	var out bytes.Buffer
+	for _, node := range nodes {
+		for _, rec := range node {
+			value := len(nodes)
+			switch {
+			case rec.data >= 0:
+				value = len(nodes) + 16 + offsets[rec.data]
+			case rec.node > 0:
+				value = rec.node
+			}
+			out.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.Write(mmdbMetadataMarker)
+	encodeTestMMDB(&out, map[string]any{
+		"node_count":    uint32(len(nodes)),
+		"record_size":   uint16(24),
+		"ip_version":    uint16(ipVersion),
+		"database_type": "Test-City",
+		"build_epoch":   uint64(1700000000),
+	})
+	return out.Bytes()
+}
+
+func encodeTestMMDB(buf *bytes.Buffer, value any) {
+	ctrl := func(kind, size int) {
+		if kind < 8 {
+			buf.WriteByte(byte(kind<<5 | size))
+			return
+		}
+		buf.Write([]byte{byte(size), byte(kind - 7)})
+	}
+	switch v := value.(type) {
+	case string:
+		ctrl(mmdbString, len(v))
+		buf.WriteString(v)
+	case uint16:
+		ctrl(mmdbUint16, 2)
+		binary.Write(buf, binary.BigEndian, v)
+	case uint32:
+		ctrl(mmdbUint32, 4)
+		binary.Write(buf, binary.BigEndian, v)
+	case uint64:
+		ctrl(mmdbUint64, 8)
+		binary.Write(buf, binary.BigEndian, v)
+	case []any:
+		ctrl(mmdbArray, len(v))
+		for _, item := range v {
+			encodeTestMMDB(buf, item)
+		}
+	case map[string]any:
+		ctrl(mmdbMap, len(v))
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			encodeTestMMDB(buf, key)
+			encodeTestMMDB(buf, v[key])
+		}
+	default:
+		panic(fmt.Sprintf("unsupported type %T", value))
+	}
+}
+
+func testGeoIPNetworks() []testMMDBNetwork {
+	country := func(code string) map[string]any { return map[string]any{"iso_code": code} }
+	return []testMMDBNetwork{
+		{"1.0.0.0/8", map[string]any{"country": country("AU")}},
+		{"8.8.0.0/16", map[string]any{"country": country("US"), "subdivisions": []any{country("CA")}}},
+		{"9.9.0.0/16", testMMDBPointer(0)},
+		{"2001:db8::/32", map[string]any{"registered_country": country("JP")}},
+	}
+}
+
+func TestGeoIPLookup(t *testing.T) {
+	dir := t.TempDir()
+	geo := &GeoIPService{Paths: []string{filepath.Join(dir, "GeoIP.mmdb")}}
+	if _, _, ok := geo.Lookup("1.2.3.4"); ok || geo.Status().Available {
+		t.Fatal("expected lookup to be unavailable without a database")
+	}
+
+	if err := geo.Install(strings.NewReader("not a database")); !errors.Is(err, ErrInvalidGeoIPDB) {
+		t.Fatalf("expected invalid database error, got %v", err)
+	}
+	if err := geo.Install(bytes.NewReader(buildTestMMDB(t, 6, testGeoIPNetworks()))); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	status := geo.Status()
+	if !status.Available || status.DatabaseType != "Test-City" || status.BuildUnixTime != 1700000000 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	for _, tc := range []struct{ ip, country, region string }{
+		{"1.2.3.4", "AU", ""},
+		{"8.8.8.8", "US", "US-CA"},
+		{"9.9.1.1", "AU", ""},
+		{"2001:db8::1", "JP", ""},
+		{"127.0.0.1", "", ""},
+		{"not-an-ip", "", ""},
+	} {
+		country, region, ok := geo.Lookup(tc.ip)
+		if !ok || country != tc.country || region != tc.region {
+			t.Fatalf("lookup %s = %q %q %v, want %q %q", tc.ip, country, region, ok, tc.country, tc.region)
+		}
+	}
+
+	v4 := &GeoIPService{Paths: []string{filepath.Join(dir, "v4.mmdb")}}
+	os.WriteFile(v4.Paths[0], buildTestMMDB(t, 4, testGeoIPNetworks()[:2]), 0644)
+	if country, _, _ := v4.Lookup("8.8.4.4"); country != "US" {
+		t.Fatalf("unexpected country from IPv4 database: %q", country)
+	}
+	if country, _, ok := v4.Lookup("2001:db8::1"); !ok || country != "" {
+		t.Fatalf("IPv6 address should not resolve in IPv4 database: %q", country)
+	}
+
+	// 有数据库时访问统计按国家与地区计数
+	svc := NewSiteStatsService(geo)
+	svc.LogDir = filepath.Join(dir, "logs")
+	svc.dir = filepath.Join(dir, "stats")
+	os.MkdirAll(svc.LogDir, 0755)
+	now := time.Date(2026, 3, 10, 12, 30, 0, 0, time.Local)
+	var content strings.Builder
+	for _, ip := range []string{"8.8.8.8", "8.8.4.4", "1.1.1.1", "10.0.0.1"} {
+		content.WriteString(fmt.Sprintf("%s - - [%s] \"GET / HTTP/1.1\" 200 10 \"-\" \"curl\"\n", ip, now.Add(-time.Minute).Format("02/Jan/2006:15:04:05 -0700")))
+	}
+	os.WriteFile(filepath.Join(svc.LogDir, "a.example.com-access.log"), []byte(content.String()), 0644)
+	svc.Ingest(now)
+
+	analytics, err := svc.Analytics("a.example.com", time.Time{}, time.Time{}, now, 0)
+	if err != nil {
+		t.Fatalf("analytics: %v", err)
+	}
+	if !analytics.GeoIP || len(analytics.Countries) != 3 || analytics.Countries[0].Value != "US" || analytics.Countries[0].Count != 2 {
+		t.Fatalf("unexpected countries: %+v", analytics.Countries)
+	}
+	if len(analytics.Regions) != 1 || analytics.Regions[0].Value != "US-CA" {
+		t.Fatalf("unexpected regions: %+v", analytics.Regions)
+	}
+	daily, err := svc.Stats("a.example.com", "day", time.Time{}, time.Time{}, now)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if len(daily.Points) != 1 || daily.Points[0].Countries["-"] != 1 || daily.Countries[0].Value != "US" {
+		t.Fatalf("unexpected daily countries: %+v", daily)
+	}
+}
@@ -0,0 +1,424 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+	"nginx-mgr/internal/nginxconf"
+)
+
+const globalTuningSettingsPath = "/root/global_tuning.json"
+
+var ErrInvalidGlobalTuning = errors.New("全局参数无效")
+
+var mimeTypePattern = regexp.MustCompile(`^[a-z0-9.+-]+/[a-z0-9.+*-]+$`)
+
+// tuningDirectives 各上下文中由面板接管的指令，nginx.conf 中原有的同名指令会被注释掉，避免重复定义
+var tuningDirectives = map[string][]string{
+	"main":   {"worker_processes"},
+	"events": {"worker_connections"},
+	"http": {"keepalive_timeout", "server_names_hash_bucket_size", "gzip", "gzip_comp_level",
+		"gzip_min_length", "gzip_types", "gzip_vary", "gzip_proxied"},
+}
+
+// GlobalTuningService 把 worker、长连接、server_names_hash 与 gzip 等全局参数写入
+// global_main.conf、global_events.conf 与 global_http.conf，并在 nginx.conf 的对应上下文中引入
+type GlobalTuningService struct {
+	ConfDir string
+
+	settingsPath string
+	run          func(name string, args ...string) (string, error)
+	mu           sync.Mutex
+}
+
+func NewGlobalTuningService() *GlobalTuningService {
+	return &GlobalTuningService{
+		ConfDir:      model.NginxConfDir,
+		settingsPath: globalTuningSettingsPath,
+		run:          executor.ExecuteSimple,
+	}
+}
+
+func (s *GlobalTuningService) includePath(context string) string {
+	return filepath.Join(s.ConfDir, "global_"+context+".conf")
+}
+
+func (s *GlobalTuningService) defaultSettings() model.GlobalTuning {
+	return model.GlobalTuning{
+		WorkerProcesses:           "auto",
+		WorkerConnections:         1024,
+		KeepaliveTimeout:          65,
+		ServerNamesHashBucketSize: 64,
+		Gzip:                      true,
+		GzipCompLevel:             5,
+		GzipMinLength:             256,
+		GzipTypes: []string{"text/plain", "text/css", "text/xml", "application/json", "application/javascript",
+			"application/xml", "application/rss+xml", "image/svg+xml"},
+	}
+}
+
+func (s *GlobalTuningService) sanitize(input model.GlobalTuning) (model.GlobalTuning, error) {
+	output := s.defaultSettings()
+	output.LastUpdatedUnixTime = input.LastUpdatedUnixTime
+	output.Gzip = input.Gzip
+
+	switch processes := strings.TrimSpace(input.WorkerProcesses); processes {
+	case "":
+	case "auto":
+		output.WorkerProcesses = processes
+	default:
+		n, err := strconv.Atoi(processes)
+		if err != nil || n < 1 || n > 1024 {
+			return model.GlobalTuning{}, fmt.Errorf("%w: worker_processes 需为 auto 或 1-1024 的整数", ErrInvalidGlobalTuning)
+		}
+		output.WorkerProcesses = strconv.Itoa(n)
+	}
+	if input.WorkerConnections != 0 {
+		if input.WorkerConnections < 64 || input.WorkerConnections > 1048576 {
+			return model.GlobalTuning{}, fmt.Errorf("%w: worker_connections 需在 64 到 1048576 之间", ErrInvalidGlobalTuning)
+		}
+		output.WorkerConnections = input.WorkerConnections
+	}
+	if input.KeepaliveTimeout < 0 || input.KeepaliveTimeout > 3600 {
+		return model.GlobalTuning{}, fmt.Errorf("%w: keepalive_timeout 需在 0 到 3600 秒之间", ErrInvalidGlobalTuning)
+	}
+	output.KeepaliveTimeout = input.KeepaliveTimeout
+	if size := input.ServerNamesHashBucketSize; size != 0 {
+		if size < 32 || size > 1024 || size&(size-1) != 0 {
+			return model.GlobalTuning{}, fmt.Errorf("%w: server_names_hash_bucket_size 需为 32 到 1024 之间 2 的幂", ErrInvalidGlobalTuning)
+		}
+		output.ServerNamesHashBucketSize = size
+	}
+	if input.GzipCompLevel != 0 {
+		if input.GzipCompLevel < 1 || input.GzipCompLevel > 9 {
+			return model.GlobalTuning{}, fmt.Errorf("%w: gzip_comp_level 需在 1 到 9 之间", ErrInvalidGlobalTuning)
+		}
+		output.GzipCompLevel = input.GzipCompLevel
+	}
+	if input.GzipMinLength < 0 {
+		return model.GlobalTuning{}, fmt.Errorf("%w: gzip_min_length 不能为负数", ErrInvalidGlobalTuning)
+	}
+	output.GzipMinLength = input.GzipMinLength
+	if input.GzipTypes != nil {
+		types := []string{}
+		seen := map[string]bool{}
+		for _, mime := range input.GzipTypes {
+			mime = strings.ToLower(strings.TrimSpace(mime))
+			// text/html 总会压缩，写进 gzip_types 时 nginx 会提示重复
+			if mime == "" || mime == "text/html" || seen[mime] {
+				continue
+			}
+			if !mimeTypePattern.MatchString(mime) {
+				return model.GlobalTuning{}, fmt.Errorf("%w: MIME 类型不合法 %s", ErrInvalidGlobalTuning, mime)
+			}
+			seen[mime] = true
+			types = append(types, mime)
+		}
+		output.GzipTypes = types
+	}
+	return output, nil
+}
+
+// Status 返回已保存的参数；尚未保存过时从 nginx.conf 读取当前值，读取不到的项使用默认值
+func (s *GlobalTuningService) Status() (*model.GlobalTuningStatus, error) {
+	content, err := os.ReadFile(s.settingsPath)
+	if err == nil {
+		var settings model.GlobalTuning
+		if err := json.Unmarshal(content, &settings); err != nil {
+			return nil, err
+		}
+		normalized, err := s.sanitize(settings)
+		if err != nil {
+			normalized = s.defaultSettings()
+		}
+		return &model.GlobalTuningStatus{GlobalTuning: normalized, Managed: true}, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return &model.GlobalTuningStatus{GlobalTuning: s.readCurrent()}, nil
+}
+
+// readCurrent 从 nginx.conf 中读取当前生效的参数
+func (s *GlobalTuningService) readCurrent() model.GlobalTuning {
+	settings := s.defaultSettings()
+	data, err := os.ReadFile(filepath.Join(s.ConfDir, "nginx.conf"))
+	if err != nil {
+		return settings
+	}
+	tree, err := nginxconf.Parse(string(data))
+	if err != nil {
+		return settings
+	}
+	// nginx 未配置 gzip 时默认关闭
+	settings.Gzip = false
+	if d := nginxconf.First(tree, "worker_processes"); d != nil {
+		settings.WorkerProcesses = d.Arg(0)
+	}
+	if events := nginxconf.First(tree, "events"); events != nil {
+		if d := nginxconf.First(events.Block, "worker_connections"); d != nil {
+			settings.WorkerConnections, _ = strconv.Atoi(d.Arg(0))
+		}
+	}
+	if http := nginxconf.First(tree, "http"); http != nil {
+		if d := nginxconf.First(http.Block, "keepalive_timeout"); d != nil {
+			if seconds, err := strconv.Atoi(strings.TrimSuffix(d.Arg(0), "s")); err == nil {
+				settings.KeepaliveTimeout = seconds
+			}
+		}
+		if d := nginxconf.First(http.Block, "server_names_hash_bucket_size"); d != nil {
+			settings.ServerNamesHashBucketSize, _ = strconv.Atoi(d.Arg(0))
+		}
+		if d := nginxconf.First(http.Block, "gzip"); d != nil {
+			settings.Gzip = d.Arg(0) == "on"
+		}
+		if d := nginxconf.First(http.Block, "gzip_comp_level"); d != nil {
+			settings.GzipCompLevel, _ = strconv.Atoi(d.Arg(0))
+		}
+		if d := nginxconf.First(http.Block, "gzip_min_length"); d != nil {
+			settings.GzipMinLength, _ = strconv.Atoi(d.Arg(0))
+		}
+		if d := nginxconf.First(http.Block, "gzip_types"); d != nil {
+			settings.GzipTypes = d.Args
+		}
+	}
+	if normalized, err := s.sanitize(settings); err == nil {
+		return normalized
+	}
+	return s.defaultSettings()
+}
+
+// Save 写入 include 文件并接管 nginx.conf 中的对应指令，测试或重载失败时恢复所有改动
+func (s *GlobalTuningService) Save(input model.GlobalTuning) (model.GlobalTuning, error) {
+	settings, err := s.sanitize(input)
+	if err != nil {
+		return model.GlobalTuning{}, err
+	}
+	settings.LastUpdatedUnixTime = time.Now().Unix()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.apply(settings); err != nil {
+		return model.GlobalTuning{}, err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.GlobalTuning{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.settingsPath), 0700); err != nil {
+		return model.GlobalTuning{}, err
+	}
+	if err := os.WriteFile(s.settingsPath, data, 0600); err != nil {
+		return model.GlobalTuning{}, err
+	}
+	return settings, nil
+}
+
+func (s *GlobalTuningService) apply(settings model.GlobalTuning) error {
+	confPath := filepath.Join(s.ConfDir, "nginx.conf")
+	rendered := map[string]string{
+		confPath:                "",
+		s.includePath("main"):   renderTuningMain(settings),
+		s.includePath("events"): renderTuningEvents(settings),
+		s.includePath("http"):   renderTuningHTTP(settings),
+	}
+	// 记录改动前的文件，失败时逐个恢复，原先不存在的删除
+	previous := map[string][]byte{}
+	for path := range rendered {
+		if data, err := os.ReadFile(path); err == nil {
+			previous[path] = data
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	mainConf, ok := previous[confPath]
+	if !ok {
+		return fmt.Errorf("%s 不存在，请先安装 Nginx", confPath)
+	}
+	restore := func() {
+		for path := range rendered {
+			if data, ok := previous[path]; ok {
+				os.WriteFile(path, data, 0644)
+			} else {
+				os.Remove(path)
+			}
+		}
+	}
+
+	adopted, err := adoptTuningDirectives(string(mainConf), s.includePath)
+	if err != nil {
+		return err
+	}
+	rendered[confPath] = adopted
+	for path, content := range rendered {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			restore()
+			return err
+		}
+	}
+	if out, err := s.run(model.NginxSbinPath, "-t"); err != nil {
+		restore()
+		return fmt.Errorf("配置验证失败: %s", strings.TrimSpace(out))
+	}
+	if _, err := s.run("systemctl", "reload", "nginx"); err != nil {
+		restore()
+		s.run("systemctl", "reload", "nginx")
+		return fmt.Errorf("重载 Nginx 失败: %w", err)
+	}
+	return nil
+}
+
+func renderTuningMain(settings model.GlobalTuning) string {
+	return "# 由面板自动生成，请勿手动修改\n" + fmt.Sprintf("worker_processes %s;\n", settings.WorkerProcesses)
+}
+
+func renderTuningEvents(settings model.GlobalTuning) string {
+	return "# 由面板自动生成，请勿手动修改\n" + fmt.Sprintf("worker_connections %d;\n", settings.WorkerConnections)
+}
+
+func renderTuningHTTP(settings model.GlobalTuning) string {
+	var b strings.Builder
+	b.WriteString("# 由面板自动生成，请勿手动修改\n")
+	fmt.Fprintf(&b, "keepalive_timeout %ds;\n", settings.KeepaliveTimeout)
+	fmt.Fprintf(&b, "server_names_hash_bucket_size %d;\n", settings.ServerNamesHashBucketSize)
+	if !settings.Gzip {
+		b.WriteString("gzip off;\n")
+		return b.String()
+	}
+	b.WriteString("gzip on;\ngzip_vary on;\ngzip_proxied any;\n")
+	fmt.Fprintf(&b, "gzip_comp_level %d;\n", settings.GzipCompLevel)
+	fmt.Fprintf(&b, "gzip_min_length %d;\n", settings.GzipMinLength)
+	if len(settings.GzipTypes) > 0 {
+		fmt.Fprintf(&b, "gzip_types %s;\n", strings.Join(settings.GzipTypes, " "))
+	}
+	return b.String()
+}
+
+// adoptTuningDirectives 注释掉 nginx.conf 中由面板接管的指令，并在 events 之前、events 与 http 块开头
+// 引入对应的 include 文件。已经接管过的配置不会重复改动。按行改写，指令或块的 "{" 与其他指令写在同一行时返回错误
+func adoptTuningDirectives(content string, includePath func(context string) string) (string, error) {
+	tree, err := nginxconf.Parse(content)
+	if err != nil {
+		return "", fmt.Errorf("解析 nginx.conf 失败: %w", err)
+	}
+	events := nginxconf.First(tree, "events")
+	http := nginxconf.First(tree, "http")
+	if events == nil || http == nil {
+		return "", errors.New("nginx.conf 中缺少 events 或 http 块")
+	}
+	lines := strings.Split(content, "\n")
+
+	includeLine := func(context string) string {
+		return fmt.Sprintf("include %s;", includePath(context))
+	}
+	// after 为 true 时插在该行之后（块内），否则插在该行之前
+	type insertion struct {
+		line  int
+		after bool
+		text  string
+	}
+	var insertions []insertion
+	for _, block := range []struct {
+		context   string
+		directive *nginxconf.Directive
+	}{{"events", events}, {"http", http}} {
+		if strings.Contains(content, includeLine(block.context)) {
+			continue
+		}
+		open, ok := blockOpenLine(lines, block.directive.Line)
+		if !ok {
+			return "", fmt.Errorf("nginx.conf 第 %d 行的 %s 块与其他内容写在同一行，请先拆分为多行", block.directive.Line, block.context)
+		}
+		insertions = append(insertions, insertion{open, true, "    " + includeLine(block.context)})
+	}
+	if !strings.Contains(content, includeLine("main")) {
+		insertions = append(insertions, insertion{events.Line, false, includeLine("main")})
+	}
+
+	var commented [][2]int
+	for _, block := range []struct {
+		context    string
+		directives []*nginxconf.Directive
+	}{{"main", tree}, {"events", events.Block}, {"http", http.Block}} {
+		for _, d := range block.directives {
+			if !slices.Contains(tuningDirectives[block.context], d.Name) {
+				continue
+			}
+			end, ok := directiveEndLine(lines, d)
+			if !ok {
+				return "", fmt.Errorf("nginx.conf 第 %d 行的 %s 与其他指令写在同一行，请先拆分为多行", d.Line, d.Name)
+			}
+			commented = append(commented, [2]int{d.Line, end})
+		}
+	}
+	for _, span := range commented {
+		for i := span[0] - 1; i < span[1]; i++ {
+			line := lines[i]
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			lines[i] = indent + "# " + strings.TrimLeft(line, " \t")
+		}
+	}
+
+	// 从后往前插入，保证前面的行号不变；同一行先插块内的 include
+	sort.Slice(insertions, func(i, j int) bool {
+		if insertions[i].line != insertions[j].line {
+			return insertions[i].line > insertions[j].line
+		}
+		return insertions[i].after && !insertions[j].after
+	})
+	for _, ins := range insertions {
+		at := ins.line - 1
+		if ins.after {
+			at = ins.line
+		}
+		lines = append(lines[:at], append([]string{ins.text}, lines[at:]...)...)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// lineCode 去掉行尾注释与首尾空白
+func lineCode(line string) string {
+	code, _, _ := strings.Cut(line, "#")
+	return strings.TrimSpace(code)
+}
+
+// blockOpenLine 返回块指令从 line 开始 "{" 所在的行号，"{" 之后同一行还有内容时 ok 为 false
+func blockOpenLine(lines []string, line int) (int, bool) {
+	for i := line - 1; i >= 0 && i < len(lines); i++ {
+		code := lineCode(lines[i])
+		if idx := strings.Index(code, "{"); idx >= 0 {
+			return i + 1, idx == len(code)-1
+		}
+	}
+	return 0, false
+}
+
+// directiveEndLine 返回指令分号所在的行号。指令需从行首开始、分号后没有其他内容，否则 ok 为 false
+func directiveEndLine(lines []string, d *nginxconf.Directive) (int, bool) {
+	if d.Line < 1 || d.Line > len(lines) {
+		return 0, false
+	}
+	first := lineCode(lines[d.Line-1])
+	if first != d.Name && !strings.HasPrefix(first, d.Name+" ") && !strings.HasPrefix(first, d.Name+"\t") {
+		return 0, false
+	}
+	for i := d.Line - 1; i < len(lines); i++ {
+		code := lineCode(lines[i])
+		if idx := strings.Index(code, ";"); idx >= 0 {
+			return i + 1, idx == len(code)-1
+		}
+	}
+	return 0, false
+}
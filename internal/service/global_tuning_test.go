@@ -0,0 +1,138 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nginx-mgr/internal/model"
+)
+
+const tuningTestConf = `user www-data;
+worker_processes 2;
+pid /run/nginx.pid;
+
+events {
+    worker_connections 768;
+}
+
+http {
+    sendfile on;
+    keepalive_timeout 30;
+    gzip on;
+    gzip_types text/plain
+        application/json;
+    include /etc/nginx/sites-enabled/*;
+}
+`
+
+func TestGlobalTuningSave(t *testing.T) {
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "nginx.conf")
+	if err := os.WriteFile(confPath, []byte(tuningTestConf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	svc := &GlobalTuningService{
+		ConfDir:      dir,
+		settingsPath: filepath.Join(dir, "global_tuning.json"),
+		run: func(name string, args ...string) (string, error) {
+			calls = append(calls, name+" "+strings.Join(args, " "))
+			return "", nil
+		},
+	}
+
+	status, err := svc.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Managed || status.WorkerProcesses != "2" || status.WorkerConnections != 768 || status.KeepaliveTimeout != 30 ||
+		!status.Gzip || strings.Join(status.GzipTypes, " ") != "text/plain application/json" {
+		t.Fatalf("unexpected current settings: %+v", status)
+	}
+
+	input := status.GlobalTuning
+	input.WorkerProcesses = "auto"
+	input.WorkerConnections = 4096
+	if _, err := svc.Save(input); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(confPath)
+	conf := string(data)
+	for _, want := range []string{
+		"# worker_processes 2;",
+		"include " + svc.includePath("main") + ";\nevents {\n    include " + svc.includePath("events") + ";\n    # worker_connections 768;\n}",
+		"http {\n    include " + svc.includePath("http") + ";",
+		"    # keepalive_timeout 30;",
+		"    # gzip_types text/plain\n        # application/json;",
+		"    sendfile on;",
+	} {
+		if !strings.Contains(conf, want) {
+			t.Fatalf("nginx.conf missing %q:\n%s", want, conf)
+		}
+	}
+	if events, _ := os.ReadFile(svc.includePath("events")); !strings.Contains(string(events), "worker_connections 4096;") {
+		t.Fatalf("unexpected events include: %s", events)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("expected test and reload, got %v", calls)
+	}
+
+	// 再次保存不重复改动 nginx.conf
+	if _, err := svc.Save(input); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(confPath); string(again) != conf {
+		t.Fatalf("nginx.conf changed on second save:\n%s", again)
+	}
+	if status, _ := svc.Status(); !status.Managed || status.WorkerConnections != 4096 {
+		t.Fatalf("unexpected saved status: %+v", status)
+	}
+}
+
+func TestGlobalTuningRollback(t *testing.T) {
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "nginx.conf")
+	if err := os.WriteFile(confPath, []byte(tuningTestConf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	svc := &GlobalTuningService{
+		ConfDir:      dir,
+		settingsPath: filepath.Join(dir, "global_tuning.json"),
+		run: func(name string, args ...string) (string, error) {
+			return "nginx: [emerg] \"gzip\" directive is duplicate", errors.New("exit status 1")
+		},
+	}
+	if _, err := svc.Save(model.GlobalTuning{Gzip: true}); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Fatalf("expected test failure, got %v", err)
+	}
+	if data, _ := os.ReadFile(confPath); string(data) != tuningTestConf {
+		t.Fatalf("nginx.conf not restored:\n%s", data)
+	}
+	for _, context := range []string{"main", "events", "http"} {
+		if _, err := os.Stat(svc.includePath(context)); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("include %s not removed: %v", context, err)
+		}
+	}
+	if _, err := os.Stat(svc.settingsPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("settings should not be saved: %v", err)
+	}
+
+	inline := strings.Replace(tuningTestConf, "events {\n    worker_connections 768;\n}", "events { worker_connections 768; }", 1)
+	if _, err := adoptTuningDirectives(inline, svc.includePath); err == nil || !strings.Contains(err.Error(), "同一行") {
+		t.Fatalf("expected inline events block to be rejected, got %v", err)
+	}
+
+	for _, bad := range []model.GlobalTuning{
+		{WorkerProcesses: "many"},
+		{ServerNamesHashBucketSize: 100},
+		{GzipCompLevel: 10},
+		{GzipTypes: []string{"text/plain;"}},
+	} {
+		if _, err := svc.Save(bad); !errors.Is(err, ErrInvalidGlobalTuning) {
+			t.Fatalf("expected %+v to be rejected, got %v", bad, err)
+		}
+	}
+}
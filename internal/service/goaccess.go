@@ -0,0 +1,186 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	goAccessReportDir = "/root/goaccess"
+	goAccessTimeout   = 3 * time.Minute
+	// goAccessCombinedFormat 与 main 格式一致，main_timing 额外解析 rt= 作为请求耗时
+	goAccessCombinedFormat = `%h %^[%d:%t %^] "%r" %s %b "%R" "%u"`
+	goAccessTimingFormat   = `%h %^[%d:%t %^] "%r" %s %b "%R" "%u" rt=%T %^`
+	// goAccessJSONFormat 对应 main_json 的字段，未列出的字段由 GoAccess 忽略
+	goAccessJSONFormat = `{"time_local":"%d:%t %^","remote_addr":"%h","request":"%r","status":"%s","body_bytes_sent":"%b","http_referer":"%R","http_user_agent":"%u","request_time":"%T"}`
+)
+
+var (
+	ErrGoAccessBusy     = errors.New("已有 GoAccess 报告正在生成，请稍后再试")
+	ErrGoAccessNoLogs   = errors.New("站点暂无访问日志")
+	ErrGoAccessNoReport = errors.New("尚未生成 GoAccess 报告")
+)
+
+// GoAccessService 调用 GoAccess 分析站点的访问日志并生成 HTML 报告，缺少 goaccess 时通过 apt-get 安装。
+// 同一时间只生成一份报告，避免大日志占满 CPU
+type GoAccessService struct {
+	LogDir    string
+	ReportDir string
+	Binary    string
+
+	running sync.Mutex
+}
+
+func NewGoAccessService() *GoAccessService {
+	return &GoAccessService{
+		LogDir:    model.NginxLogDir,
+		ReportDir: goAccessReportDir,
+		Binary:    "goaccess",
+	}
+}
+
+func (s *GoAccessService) reportPath(domain string) string {
+	return filepath.Join(s.ReportDir, domain+".html")
+}
+
+func (s *GoAccessService) ensureBinary() (string, error) {
+	if path, err := exec.LookPath(s.Binary); err == nil {
+		return path, nil
+	}
+	if _, err := executor.ExecuteSimple("bash", "-c", "apt-get update >/dev/null 2>&1 && apt-get install -y goaccess >/dev/null 2>&1"); err != nil {
+		return "", fmt.Errorf("安装 GoAccess 失败: %w", err)
+	}
+	return exec.LookPath(s.Binary)
+}
+
+// siteLogs 返回站点当前与上一份轮转的访问日志，压缩的历史日志不参与分析
+func (s *GoAccessService) siteLogs(domain string) []string {
+	var logs []string
+	for _, name := range []string{domain + "-access.log.1", domain + "-access.log"} {
+		path := filepath.Join(s.LogDir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && info.Size() > 0 {
+			logs = append(logs, path)
+		}
+	}
+	return logs
+}
+
+// goAccessLogFormat 按日志最后一行判断站点使用 main、main_timing 还是 main_json 格式
+func goAccessLogFormat(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return goAccessCombinedFormat
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err == nil && info.Size() > siteLogMaxLine {
+		file.Seek(info.Size()-siteLogMaxLine, 0)
+	}
+	last := ""
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), siteLogMaxLine)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			last = line
+		}
+	}
+	if strings.HasPrefix(last, "{") {
+		return goAccessJSONFormat
+	}
+	if accessTimingPattern.MatchString(last) {
+		return goAccessTimingFormat
+	}
+	return goAccessCombinedFormat
+}
+
+// Generate 分析站点的访问日志并覆盖上一次的报告
+func (s *GoAccessService) Generate(domain string) (*model.GoAccessReport, error) {
+	if domain == "" || filepath.Base(domain) != domain || strings.HasPrefix(domain, ".") {
+		return nil, os.ErrNotExist
+	}
+	if !s.running.TryLock() {
+		return nil, ErrGoAccessBusy
+	}
+	defer s.running.Unlock()
+
+	logs := s.siteLogs(domain)
+	if len(logs) == 0 {
+		return nil, ErrGoAccessNoLogs
+	}
+	binary, err := s.ensureBinary()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.ReportDir, 0700); err != nil {
+		return nil, err
+	}
+
+	target := s.reportPath(domain)
+	tmp := target + ".tmp.html"
+	args := append([]string{}, logs...)
+	args = append(args,
+		"--log-format="+goAccessLogFormat(logs[len(logs)-1]),
+		"--date-format=%d/%b/%Y",
+		"--time-format=%T",
+		"--html-report-title="+domain,
+		"--no-progress",
+		"-o", tmp,
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), goAccessTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, binary, args...).CombinedOutput()
+	if err != nil {
+		os.Remove(tmp)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("GoAccess 运行超过 %s，已终止", goAccessTimeout)
+		}
+		return nil, fmt.Errorf("GoAccess 运行失败: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	report, err := s.Report(domain)
+	if err != nil {
+		return nil, err
+	}
+	report.Logs = logs
+	return report, nil
+}
+
+// Report 返回上一次生成的报告信息
+func (s *GoAccessService) Report(domain string) (*model.GoAccessReport, error) {
+	if domain == "" || filepath.Base(domain) != domain || strings.HasPrefix(domain, ".") {
+		return nil, os.ErrNotExist
+	}
+	info, err := os.Stat(s.reportPath(domain))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrGoAccessNoReport
+		}
+		return nil, err
+	}
+	return &model.GoAccessReport{
+		Domain:            domain,
+		GeneratedUnixTime: info.ModTime().Unix(),
+		SizeBytes:         info.Size(),
+		Logs:              []string{},
+	}, nil
+}
+
+// ReportPath 返回报告文件路径，报告不存在时返回 ErrGoAccessNoReport
+func (s *GoAccessService) ReportPath(domain string) (string, error) {
+	if _, err := s.Report(domain); err != nil {
+		return "", err
+	}
+	return s.reportPath(domain), nil
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoAccessReport(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "goaccess")
+	// 模拟 goaccess：记录参数并把报告写到 -o 指定的文件
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\nwhile [ $# -gt 0 ]; do\n  if [ \"$1\" = -o ]; then echo '<html>report</html>' > \"$2\"; fi\n  shift\ndone\n"
+	os.WriteFile(binary, []byte(script), 0755)
+	svc := &GoAccessService{LogDir: filepath.Join(dir, "logs"), ReportDir: filepath.Join(dir, "reports"), Binary: binary}
+	os.MkdirAll(svc.LogDir, 0755)
+
+	if _, err := svc.Generate("a.example.com"); !errors.Is(err, ErrGoAccessNoLogs) {
+		t.Fatalf("expected no logs error, got %v", err)
+	}
+	if _, err := svc.ReportPath("a.example.com"); !errors.Is(err, ErrGoAccessNoReport) {
+		t.Fatalf("expected no report error, got %v", err)
+	}
+	if _, err := svc.Generate("../etc"); !os.IsNotExist(err) {
+		t.Fatalf("expected invalid domain to be rejected, got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(svc.LogDir, "a.example.com-access.log.1"), []byte("old\n"), 0644)
+	os.WriteFile(filepath.Join(svc.LogDir, "a.example.com-access.log"), []byte(`1.2.3.4 - - [16/Oct/2026:10:00:00 +0800] "GET / HTTP/1.1" 200 5 "-" "curl" rt=0.010 urt="-"`+"\n"), 0644)
+	report, err := svc.Generate("a.example.com")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(report.Logs) != 2 || report.SizeBytes == 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if !strings.Contains(string(args), "a.example.com-access.log.1") || !strings.Contains(string(args), "rt=%T") {
+		t.Fatalf("unexpected goaccess args: %s", args)
+	}
+	path, err := svc.ReportPath("a.example.com")
+	if data, _ := os.ReadFile(path); err != nil || !strings.Contains(string(data), "report") {
+		t.Fatalf("unexpected report file: %v %s", err, data)
+	}
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+)
+
+// HostInfoService 读取操作系统、内核、CPU、内存与虚拟化类型，读取失败的项留空
+type HostInfoService struct {
+	ProcDir       string
+	OSReleasePath string
+	run           func(name string, args ...string) (string, error)
+}
+
+func NewHostInfoService() *HostInfoService {
+	return &HostInfoService{
+		ProcDir:       "/proc",
+		OSReleasePath: "/etc/os-release",
+		run:           executor.ExecuteSimple,
+	}
+}
+
+func (s *HostInfoService) Info(now time.Time) *model.HostInfo {
+	info := &model.HostInfo{Arch: runtime.GOARCH}
+	info.Hostname, _ = os.Hostname()
+	info.OS, info.OSID, info.OSVersion = readOSRelease(s.OSReleasePath)
+	if data, err := os.ReadFile(filepath.Join(s.ProcDir, "sys", "kernel", "osrelease")); err == nil {
+		info.Kernel = strings.TrimSpace(string(data))
+	}
+	if data, err := os.ReadFile(filepath.Join(s.ProcDir, "sys", "kernel", "arch")); err == nil {
+		info.Arch = strings.TrimSpace(string(data))
+	}
+	if data, err := os.ReadFile(filepath.Join(s.ProcDir, "uptime")); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) > 0 {
+			if seconds, err := strconv.ParseFloat(fields[0], 64); err == nil {
+				info.UptimeSeconds = int64(seconds)
+				info.BootUnixTime = now.Unix() - info.UptimeSeconds
+			}
+		}
+	}
+	var hypervisor bool
+	info.CPUModel, info.CPUCores, hypervisor = readCPUInfo(filepath.Join(s.ProcDir, "cpuinfo"))
+	if info.CPUCores == 0 {
+		info.CPUCores = runtime.NumCPU()
+	}
+	info.MemoryTotalBytes, info.SwapTotalBytes = readMemTotals(filepath.Join(s.ProcDir, "meminfo"))
+	info.Virtualization = s.virtualization(hypervisor)
+	return info
+}
+
+// readOSRelease 返回 PRETTY_NAME、ID 与 VERSION_ID
+func readOSRelease(path string) (name, id, version string) {
+	fields := readOSReleaseFields(path)
+	return fields["PRETTY_NAME"], fields["ID"], fields["VERSION_ID"]
+}
+
+// readOSReleaseFields 按 KEY=VALUE 解析 os-release，去掉值两侧的引号
+func readOSReleaseFields(path string) map[string]string {
+	fields := make(map[string]string)
+	file, err := os.Open(path)
+	if err != nil {
+		return fields
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		fields[key] = strings.Trim(value, `"'`)
+	}
+	return fields
+}
+
+// readCPUInfo 返回 CPU 型号、逻辑 CPU 数以及是否带有 hypervisor 标志。
+// ARM 上没有 model name 时依次尝试 Model 与 Hardware 字段
+func readCPUInfo(path string) (cpuModel string, cores int, hypervisor bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, false
+	}
+	defer file.Close()
+	var fallback string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "processor":
+			cores++
+		case "model name":
+			if cpuModel == "" {
+				cpuModel = value
+			}
+		case "Model", "Hardware":
+			if fallback == "" {
+				fallback = value
+			}
+		case "flags":
+			hypervisor = hypervisor || strings.Contains(" "+value+" ", " hypervisor ")
+		}
+	}
+	if cpuModel == "" {
+		cpuModel = fallback
+	}
+	return cpuModel, cores, hypervisor
+}
+
+// readMemTotals 返回 MemTotal 与 SwapTotal（字节）
+func readMemTotals(path string) (memory, swap uint64) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			memory = value * 1024
+		case "SwapTotal:":
+			swap = value * 1024
+		}
+	}
+	return memory, swap
+}
+
+// virtualization 优先使用 systemd-detect-virt，不可用时按容器标记与 CPU 的 hypervisor 标志粗略判断
+func (s *HostInfoService) virtualization(hypervisor bool) string {
+	// 物理机上 systemd-detect-virt 输出 none 并以非零状态退出
+	if out, _ := s.run("systemd-detect-virt"); strings.TrimSpace(out) != "" && !strings.Contains(out, "not found") {
+		if fields := strings.Fields(out); len(fields) == 1 {
+			return fields[0]
+		}
+	}
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		return "docker"
+	}
+	if hypervisor {
+		return "vm"
+	}
+	return ""
+}
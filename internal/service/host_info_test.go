@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHostInfo(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"proc/sys/kernel/osrelease": "6.8.0-45-generic\n",
+		"proc/sys/kernel/arch":      "x86_64\n",
+		"proc/uptime":               "3600.52 7000.10\n",
+		"proc/cpuinfo": "processor\t: 0\nmodel name\t: AMD EPYC 7763 64-Core Processor\nflags\t\t: fpu vme hypervisor lahf_lm\n\n" +
+			"processor\t: 1\nmodel name\t: AMD EPYC 7763 64-Core Processor\nflags\t\t: fpu vme hypervisor lahf_lm\n",
+		"proc/meminfo": "MemTotal:        2014512 kB\nMemFree:          102400 kB\nSwapTotal:       1048572 kB\n",
+		"os-release":   "PRETTY_NAME=\"Ubuntu 24.04.1 LTS\"\nNAME=\"Ubuntu\"\nVERSION_ID=\"24.04\"\nID=ubuntu\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	virt := "kvm\n"
+	svc := &HostInfoService{
+		ProcDir:       filepath.Join(dir, "proc"),
+		OSReleasePath: filepath.Join(dir, "os-release"),
+		run: func(name string, args ...string) (string, error) {
+			return virt, nil
+		},
+	}
+	now := time.Unix(1700003600, 0)
+	info := svc.Info(now)
+	if info.OS != "Ubuntu 24.04.1 LTS" || info.OSID != "ubuntu" || info.OSVersion != "24.04" || info.Kernel != "6.8.0-45-generic" || info.Arch != "x86_64" {
+		t.Fatalf("unexpected os info: %+v", info)
+	}
+	if info.UptimeSeconds != 3600 || info.BootUnixTime != 1700000000 {
+		t.Fatalf("unexpected uptime: %+v", info)
+	}
+	if info.CPUModel != "AMD EPYC 7763 64-Core Processor" || info.CPUCores != 2 {
+		t.Fatalf("unexpected cpu: %+v", info)
+	}
+	if info.MemoryTotalBytes != 2014512*1024 || info.SwapTotalBytes != 1048572*1024 {
+		t.Fatalf("unexpected memory: %+v", info)
+	}
+	if info.Virtualization != "kvm" {
+		t.Fatalf("unexpected virtualization: %q", info.Virtualization)
+	}
+
+	// 没有 systemd-detect-virt 时按 hypervisor 标志判断
+	svc.run = func(name string, args ...string) (string, error) {
+		return "bash: systemd-detect-virt: command not found", errors.New("exit status 127")
+	}
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		t.Skip("running inside docker")
+	}
+	if got := svc.Info(now).Virtualization; got != "vm" {
+		t.Fatalf("expected vm fallback, got %q", got)
+	}
+}
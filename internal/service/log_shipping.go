@@ -0,0 +1,445 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+const (
+	logShippingSettingsPath = "/root/log_shipping_settings.json"
+	logShipInterval         = 5 * time.Second
+	logShipBatch            = 1000
+	// logShipMaxPending 推送持续失败时最多积压的行数，超出后丢弃最旧的
+	logShipMaxPending = 20000
+	// logShipEnterpriseID RFC 5612 保留给文档与示例的企业编号，用作结构化数据的 SD-ID
+	logShipEnterpriseID = 32473
+)
+
+var ErrInvalidLogShippingSettings = errors.New("日志转发配置无效")
+
+// logShipLabelPattern Loki 标签名的规则，同时满足 syslog SD-PARAM 名称的要求
+var logShipLabelPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,31}$`)
+
+// logShipReservedLabels 由转发器填写的标签，不能在附加标签中覆盖
+var logShipReservedLabels = map[string]bool{"job": true, "host": true, "domain": true, "type": true}
+
+type shippedLine struct {
+	domain string
+	kind   string // access 或 error
+	at     time.Time
+	line   string
+}
+
+// LogShipper 每 5 秒增量读取站点日志并推送到远程 syslog 或 Loki，每条日志带上域名与日志类型。
+// 推送失败的日志留在内存中下个周期重试，面板重启后从日志末尾开始读取
+type LogShipper struct {
+	LogDir string
+
+	settingsPath string
+	client       *http.Client
+	dialTimeout  time.Duration
+
+	mu      sync.Mutex
+	offsets map[string]int64
+	pending []shippedLine
+	status  model.LogShippingStatus
+}
+
+func NewLogShipper() *LogShipper {
+	return &LogShipper{
+		LogDir:       model.NginxLogDir,
+		settingsPath: logShippingSettingsPath,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		dialTimeout:  5 * time.Second,
+		offsets:      make(map[string]int64),
+	}
+}
+
+func (s *LogShipper) defaultSettings() model.LogShippingSettings {
+	return model.LogShippingSettings{
+		Enabled:       false,
+		Target:        "loki",
+		IncludeAccess: true,
+		IncludeError:  true,
+		Syslog:        model.SyslogShipping{Protocol: "udp", Facility: 16},
+		Labels:        map[string]string{},
+	}
+}
+
+func (s *LogShipper) sanitize(input model.LogShippingSettings) (model.LogShippingSettings, error) {
+	output := s.defaultSettings()
+	output.Enabled = input.Enabled
+	output.IncludeAccess = input.IncludeAccess
+	output.IncludeError = input.IncludeError
+	output.Hostname = strings.TrimSpace(input.Hostname)
+	output.LastUpdatedUnixTime = input.LastUpdatedUnixTime
+	invalid := func(format string, args ...any) (model.LogShippingSettings, error) {
+		return model.LogShippingSettings{}, fmt.Errorf("%w: "+format, append([]any{ErrInvalidLogShippingSettings}, args...)...)
+	}
+
+	switch input.Target {
+	case "", "loki":
+	case "syslog":
+		output.Target = "syslog"
+	default:
+		return invalid("不支持的转发目标 %s", input.Target)
+	}
+
+	output.Syslog.Address = strings.TrimSpace(input.Syslog.Address)
+	if input.Syslog.Protocol != "" {
+		if input.Syslog.Protocol != "udp" && input.Syslog.Protocol != "tcp" {
+			return invalid("syslog 协议只能是 udp 或 tcp")
+		}
+		output.Syslog.Protocol = input.Syslog.Protocol
+	}
+	if input.Syslog.Facility < 0 || input.Syslog.Facility > 23 {
+		return invalid("syslog facility 需在 0 到 23 之间")
+	}
+	if input.Syslog.Facility > 0 {
+		output.Syslog.Facility = input.Syslog.Facility
+	}
+
+	output.Loki = model.LokiShipping{
+		URL:      strings.TrimRight(strings.TrimSpace(input.Loki.URL), "/"),
+		Username: strings.TrimSpace(input.Loki.Username),
+		Password: input.Loki.Password,
+		TenantID: strings.TrimSpace(input.Loki.TenantID),
+	}
+
+	for key, value := range input.Labels {
+		if !logShipLabelPattern.MatchString(key) {
+			return invalid("标签名 %q 只能包含字母、数字与下划线，且不能以数字开头", key)
+		}
+		if logShipReservedLabels[key] {
+			return invalid("标签 %s 由面板填写，不能自定义", key)
+		}
+		output.Labels[key] = value
+	}
+
+	if !output.Enabled {
+		return output, nil
+	}
+	if !output.IncludeAccess && !output.IncludeError {
+		return invalid("至少需要转发访问日志或错误日志中的一种")
+	}
+	if output.Target == "syslog" {
+		if _, port, err := net.SplitHostPort(output.Syslog.Address); err != nil || port == "" {
+			return invalid("syslog 地址需为 host:port")
+		}
+		return output, nil
+	}
+	parsed, err := url.Parse(output.Loki.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return invalid("Loki 地址需为 http:// 或 https:// 开头的 URL")
+	}
+	return output, nil
+}
+
+func (s *LogShipper) load() (model.LogShippingSettings, error) {
+	content, err := os.ReadFile(s.settingsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s.defaultSettings(), nil
+		}
+		return model.LogShippingSettings{}, err
+	}
+	var settings model.LogShippingSettings
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return model.LogShippingSettings{}, err
+	}
+	normalized, err := s.sanitize(settings)
+	if err != nil {
+		return s.defaultSettings(), nil
+	}
+	return normalized, nil
+}
+
+func redactLogShippingSettings(settings model.LogShippingSettings) model.LogShippingSettings {
+	settings.Loki.HasPassword = settings.Loki.Password != ""
+	settings.Loki.Password = ""
+	return settings
+}
+
+// Status 返回配置（不包含 Loki 密码）与最近一次推送的结果
+func (s *LogShipper) Status() (*model.LogShippingStatus, error) {
+	settings, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	status := s.status
+	status.PendingLines = len(s.pending)
+	s.mu.Unlock()
+	status.LogShippingSettings = redactLogShippingSettings(settings)
+	return &status, nil
+}
+
+// Save 保存配置；Loki 密码留空时沿用已保存的值。修改后丢弃积压的日志，避免发往新目标
+func (s *LogShipper) Save(input model.LogShippingSettings) (model.LogShippingSettings, error) {
+	if input.Loki.Password == "" {
+		current, err := s.load()
+		if err != nil {
+			return model.LogShippingSettings{}, err
+		}
+		input.Loki.Password = current.Loki.Password
+	}
+	settings, err := s.sanitize(input)
+	if err != nil {
+		return model.LogShippingSettings{}, err
+	}
+	settings.LastUpdatedUnixTime = time.Now().Unix()
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.LogShippingSettings{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.settingsPath), 0700); err != nil {
+		return model.LogShippingSettings{}, err
+	}
+	if err := os.WriteFile(s.settingsPath, data, 0600); err != nil {
+		return model.LogShippingSettings{}, err
+	}
+
+	s.mu.Lock()
+	s.pending = nil
+	s.status = model.LogShippingStatus{}
+	s.mu.Unlock()
+	return redactLogShippingSettings(settings), nil
+}
+
+func (s *LogShipper) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ticker := time.NewTicker(logShipInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			settings, err := s.load()
+			if err != nil {
+				log.Printf("[log-shipping] 获取配置失败: %v", err)
+				continue
+			}
+			s.Run(settings, time.Now())
+		}
+	}
+}
+
+// Run 读取新增的日志并推送，未启用时重置读取位置，重新启用后从日志末尾开始
+func (s *LogShipper) Run(settings model.LogShippingSettings, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !settings.Enabled {
+		s.offsets = make(map[string]int64)
+		s.pending = nil
+		return
+	}
+	s.collect(settings, now)
+	for len(s.pending) > 0 {
+		batch := s.pending
+		if len(batch) > logShipBatch {
+			batch = batch[:logShipBatch]
+		}
+		if err := s.ship(settings, batch); err != nil {
+			if s.status.LastError == "" {
+				log.Printf("[log-shipping] 推送失败: %v", err)
+			}
+			s.status.LastError = err.Error()
+			s.status.LastErrorUnixTime = now.Unix()
+			return
+		}
+		s.pending = s.pending[len(batch):]
+		s.status.ShippedLines += int64(len(batch))
+		s.status.LastShipUnixTime = now.Unix()
+		s.status.LastError = ""
+	}
+}
+
+func (s *LogShipper) collect(settings model.LogShippingSettings, now time.Time) {
+	var kinds []string
+	if settings.IncludeAccess {
+		kinds = append(kinds, "access")
+	}
+	if settings.IncludeError {
+		kinds = append(kinds, "error")
+	}
+	for _, kind := range kinds {
+		suffix := "-" + kind + ".log"
+		paths, _ := filepath.Glob(filepath.Join(s.LogDir, "*"+suffix))
+		for _, path := range paths {
+			data, err := readNewLogLines(s.offsets, path)
+			if err != nil || len(data) == 0 {
+				continue
+			}
+			domain := strings.TrimSuffix(filepath.Base(path), suffix)
+			for _, line := range strings.Split(string(data), "\n") {
+				if line = strings.TrimRight(line, "\r"); line != "" {
+					s.pending = append(s.pending, shippedLine{domain: domain, kind: kind, at: now, line: line})
+				}
+			}
+		}
+	}
+	if over := len(s.pending) - logShipMaxPending; over > 0 {
+		s.pending = s.pending[over:]
+		s.status.DroppedLines += int64(over)
+	}
+}
+
+// Test 按已保存的配置发送一条测试日志
+func (s *LogShipper) Test() error {
+	settings, err := s.load()
+	if err != nil {
+		return err
+	}
+	settings.Enabled = true
+	if settings, err = s.sanitize(settings); err != nil {
+		return err
+	}
+	return s.ship(settings, []shippedLine{{domain: "nginx-mgr", kind: "test", at: time.Now(), line: "nginx-mgr 日志转发测试"}})
+}
+
+func (s *LogShipper) ship(settings model.LogShippingSettings, lines []shippedLine) error {
+	hostname := settings.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	if settings.Target == "syslog" {
+		return s.shipSyslog(settings, hostname, lines)
+	}
+	return s.shipLoki(settings, hostname, lines)
+}
+
+// shipLoki 按域名与日志类型分成多个 stream 推送，同一 stream 内的时间戳严格递增
+func (s *LogShipper) shipLoki(settings model.LogShippingSettings, hostname string, lines []shippedLine) error {
+	type lokiStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	streams := make(map[string]*lokiStream)
+	last := make(map[string]int64)
+	var keys []string
+	for _, line := range lines {
+		key := line.domain + "\x00" + line.kind
+		stream, ok := streams[key]
+		if !ok {
+			labels := map[string]string{"job": "nginx", "host": hostname, "domain": line.domain, "type": line.kind}
+			for name, value := range settings.Labels {
+				labels[name] = value
+			}
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			keys = append(keys, key)
+		}
+		ts := line.at.UnixNano()
+		if ts <= last[key] {
+			ts = last[key] + 1
+		}
+		last[key] = ts
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(ts, 10), line.line})
+	}
+	sort.Strings(keys)
+	payload := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, key := range keys {
+		payload.Streams = append(payload.Streams, streams[key])
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, settings.Loki.URL+"/loki/api/v1/push", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if settings.Loki.Username != "" || settings.Loki.Password != "" {
+		req.SetBasicAuth(settings.Loki.Username, settings.Loki.Password)
+	}
+	if settings.Loki.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", settings.Loki.TenantID)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Loki 返回 %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// formatSyslogLine 生成 RFC 5424 消息，域名、日志类型与附加标签写入结构化数据
+func formatSyslogLine(settings model.LogShippingSettings, hostname string, line shippedLine) string {
+	severity := 6 // informational
+	if line.kind == "error" {
+		severity = 3
+	}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	var sd strings.Builder
+	fmt.Fprintf(&sd, `[nginx@%d domain="%s" type="%s"`, logShipEnterpriseID, escape.Replace(line.domain), line.kind)
+	names := make([]string, 0, len(settings.Labels))
+	for name := range settings.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&sd, ` %s="%s"`, name, escape.Replace(settings.Labels[name]))
+	}
+	sd.WriteString("]")
+	if hostname == "" {
+		hostname = "-"
+	}
+	return fmt.Sprintf("<%d>1 %s %s nginx - %s %s %s",
+		settings.Syslog.Facility*8+severity, line.at.UTC().Format(time.RFC3339Nano), hostname, line.kind, sd.String(), line.line)
+}
+
+// shipSyslog 每次推送新建连接，UDP 每条日志一个数据报，TCP 按换行分隔
+func (s *LogShipper) shipSyslog(settings model.LogShippingSettings, hostname string, lines []shippedLine) error {
+	conn, err := net.DialTimeout(settings.Syslog.Protocol, settings.Syslog.Address, s.dialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(s.client.Timeout))
+	if settings.Syslog.Protocol == "udp" {
+		for _, line := range lines {
+			if _, err := conn.Write([]byte(formatSyslogLine(settings, hostname, line))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(formatSyslogLine(settings, hostname, line))
+		buf.WriteByte('\n')
+	}
+	_, err = conn.Write(buf.Bytes())
+	return err
+}
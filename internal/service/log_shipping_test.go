@@ -0,0 +1,130 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+func TestLogShipper(t *testing.T) {
+	type push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	var pushes []push
+	fail := true
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); r.URL.Path != "/loki/api/v1/push" || user != "u" || pass != "p" || r.Header.Get("X-Scope-OrgID") != "t1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body push
+		json.NewDecoder(r.Body).Decode(&body)
+		pushes = append(pushes, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer loki.Close()
+
+	dir := t.TempDir()
+	accessLog := filepath.Join(dir, "a.com-access.log")
+	errorLog := filepath.Join(dir, "b.com-error.log")
+	os.WriteFile(accessLog, []byte("old line\n"), 0644)
+	os.WriteFile(errorLog, nil, 0644)
+
+	shipper := NewLogShipper()
+	shipper.LogDir = dir
+	shipper.settingsPath = filepath.Join(dir, "log_shipping_settings.json")
+
+	if _, err := shipper.Save(model.LogShippingSettings{Enabled: true, Target: "loki", IncludeAccess: true, Loki: model.LokiShipping{URL: "ftp://x"}}); !errors.Is(err, ErrInvalidLogShippingSettings) {
+		t.Fatalf("expected invalid url, got %v", err)
+	}
+	if _, err := shipper.Save(model.LogShippingSettings{Enabled: true, IncludeAccess: true, Labels: map[string]string{"domain": "x"}, Loki: model.LokiShipping{URL: loki.URL}}); !errors.Is(err, ErrInvalidLogShippingSettings) {
+		t.Fatalf("expected reserved label to be rejected, got %v", err)
+	}
+	saved, err := shipper.Save(model.LogShippingSettings{
+		Enabled: true, Target: "loki", IncludeAccess: true, IncludeError: true, Hostname: "web1",
+		Labels: map[string]string{"env": "prod"},
+		Loki:   model.LokiShipping{URL: loki.URL + "/", Username: "u", Password: "p", TenantID: "t1"},
+	})
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if saved.Loki.Password != "" || !saved.Loki.HasPassword {
+		t.Fatalf("password not redacted: %+v", saved.Loki)
+	}
+	// 密码留空时沿用已保存的值
+	saved.Loki.HasPassword = false
+	if _, err := shipper.Save(saved); err != nil {
+		t.Fatalf("save without password: %v", err)
+	}
+	settings, _ := shipper.load()
+	if settings.Loki.Password != "p" {
+		t.Fatalf("password not kept: %+v", settings.Loki)
+	}
+
+	now := time.Now()
+	shipper.Run(settings, now)
+	os.WriteFile(accessLog, []byte("old line\nGET /1\nGET /2\n"), 0644)
+	os.WriteFile(errorLog, []byte("boom\n"), 0644)
+
+	// 推送失败时保留日志，下个周期重试
+	shipper.Run(settings, now.Add(5*time.Second))
+	status, _ := shipper.Status()
+	if status.PendingLines != 3 || status.LastError == "" || len(pushes) != 0 {
+		t.Fatalf("unexpected status after failure: %+v", status)
+	}
+	fail = false
+	shipper.Run(settings, now.Add(10*time.Second))
+	status, _ = shipper.Status()
+	if status.PendingLines != 0 || status.ShippedLines != 3 || status.LastError != "" || len(pushes) != 1 {
+		t.Fatalf("unexpected status after retry: %+v", status)
+	}
+	streams := pushes[0].Streams
+	if len(streams) != 2 || streams[0].Stream["domain"] != "a.com" || streams[0].Stream["type"] != "access" ||
+		streams[0].Stream["host"] != "web1" || streams[0].Stream["env"] != "prod" || streams[1].Stream["domain"] != "b.com" {
+		t.Fatalf("unexpected streams: %+v", streams)
+	}
+	values := streams[0].Values
+	if len(values) != 2 || values[0][1] != "GET /1" || values[1][1] != "GET /2" || values[0][0] >= values[1][0] {
+		t.Fatalf("unexpected values: %+v", values)
+	}
+
+	// syslog over UDP
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	settings.Target = "syslog"
+	settings.Syslog = model.SyslogShipping{Address: conn.LocalAddr().String(), Protocol: "udp"}
+	if settings, err = shipper.sanitize(settings); err != nil {
+		t.Fatalf("sanitize: %v", err)
+	}
+	os.WriteFile(errorLog, []byte("boom\nbad \"thing\"\n"), 0644)
+	shipper.Run(settings, now.Add(15*time.Second))
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read syslog: %v", err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<131>1 ") || !strings.Contains(msg, ` web1 nginx - error [nginx@32473 domain="b.com" type="error" env="prod"] bad "thing"`) {
+		t.Fatalf("unexpected syslog message: %s", msg)
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	loginMaxFailures   = 5              // 连续失败多少次后开始锁定
+	loginBaseLockout   = time.Minute    // 首次锁定时长，之后每多失败一次翻倍
+	loginMaxLockout    = time.Hour      // 单次锁定上限
+	loginFailureWindow = 24 * time.Hour // 超过该时间没有失败记录则清零
+)
+
+type loginAttempt struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// LoginLimiter 按来源 IP 统计失败的登录尝试，超过阈值后按指数退避临时锁定。
+// 状态只保存在内存中，面板重启后清零。
+type LoginLimiter struct {
+	attempts map[string]*loginAttempt
+	mu       sync.Mutex
+	now      func() time.Time
+}
+
+func NewLoginLimiter() *LoginLimiter {
+	return &LoginLimiter{
+		attempts: make(map[string]*loginAttempt),
+		now:      time.Now,
+	}
+}
+
+// LockedUntil 返回 ip 的锁定截止时间，未锁定时返回零值
+func (l *LoginLimiter) LockedUntil(ip string) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	attempt, ok := l.attempts[ip]
+	if !ok || !l.now().Before(attempt.lockedUntil) {
+		return time.Time{}
+	}
+	return attempt.lockedUntil
+}
+
+// Fail 记录一次失败，返回锁定前剩余的尝试次数及锁定截止时间（未锁定时为零值）
+func (l *LoginLimiter) Fail(ip string) (int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.pruneLocked(now)
+
+	attempt, ok := l.attempts[ip]
+	if !ok {
+		attempt = &loginAttempt{}
+		l.attempts[ip] = attempt
+	}
+	attempt.failures++
+	attempt.lastFailure = now
+	if attempt.failures < loginMaxFailures {
+		return loginMaxFailures - attempt.failures, time.Time{}
+	}
+
+	lockout := loginBaseLockout << (attempt.failures - loginMaxFailures)
+	if lockout > loginMaxLockout || lockout <= 0 {
+		lockout = loginMaxLockout
+	}
+	attempt.lockedUntil = now.Add(lockout)
+	return 0, attempt.lockedUntil
+}
+
+// Succeed 登录成功后清除 ip 的失败记录
+func (l *LoginLimiter) Succeed(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, ip)
+}
+
+func (l *LoginLimiter) pruneLocked(now time.Time) {
+	for ip, attempt := range l.attempts {
+		if now.Sub(attempt.lastFailure) > loginFailureWindow && !now.Before(attempt.lockedUntil) {
+			delete(l.attempts, ip)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLimiterBackoff(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewLoginLimiter()
+	limiter.now = func() time.Time { return now }
+
+	for i := 1; i < loginMaxFailures; i++ {
+		remaining, until := limiter.Fail("1.2.3.4")
+		if remaining != loginMaxFailures-i || !until.IsZero() {
+			t.Fatalf("failure %d: remaining=%d until=%v", i, remaining, until)
+		}
+	}
+	if _, until := limiter.Fail("1.2.3.4"); !until.Equal(now.Add(loginBaseLockout)) {
+		t.Fatalf("first lockout until %v", until)
+	}
+	if limiter.LockedUntil("5.6.7.8") != (time.Time{}) {
+		t.Fatalf("other ip should not be locked")
+	}
+
+	now = now.Add(loginBaseLockout)
+	if !limiter.LockedUntil("1.2.3.4").IsZero() {
+		t.Fatalf("lockout should have expired")
+	}
+	if _, until := limiter.Fail("1.2.3.4"); !until.Equal(now.Add(2 * loginBaseLockout)) {
+		t.Fatalf("second lockout should double, until %v", until)
+	}
+
+	limiter.Succeed("1.2.3.4")
+	if remaining, _ := limiter.Fail("1.2.3.4"); remaining != loginMaxFailures-1 {
+		t.Fatalf("success should reset failures, remaining=%d", remaining)
+	}
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+)
+
+const (
+	logRotateSettingsPath = "/root/logrotate_settings.json"
+	logRotateConfigPath   = "/etc/logrotate.d/nginx-mgr"
+)
+
+var ErrInvalidLogRotateSettings = errors.New("日志轮转规则无效")
+
+// LogRotateService 为面板创建的站点日志（<domain>-access.log、<domain>-error.log）生成 logrotate 配置。
+// 轮转后向 nginx 主进程发送 USR1 重新打开日志文件，缺少 logrotate 时通过 apt-get 安装
+type LogRotateService struct {
+	LogDir     string
+	ConfigPath string
+	// ConfigDir 系统的 logrotate 配置目录，用于检查其他配置是否已经覆盖站点日志
+	ConfigDir string
+	PidFile   string
+	Binary    string
+
+	settingsPath string
+	run          func(name string, args ...string) (string, error)
+	mu           sync.Mutex
+}
+
+func NewLogRotateService() *LogRotateService {
+	return &LogRotateService{
+		LogDir:       model.NginxLogDir,
+		ConfigPath:   logRotateConfigPath,
+		ConfigDir:    filepath.Dir(logRotateConfigPath),
+		PidFile:      filepath.Join(model.NginxPidDir, "nginx.pid"),
+		Binary:       "logrotate",
+		settingsPath: logRotateSettingsPath,
+		run:          executor.ExecuteSimple,
+	}
+}
+
+func (s *LogRotateService) defaultSettings() model.LogRotateSettings {
+	return model.LogRotateSettings{
+		Enabled:    false,
+		Frequency:  "daily",
+		MaxSizeMB:  100,
+		Rotate:     14,
+		MaxAgeDays: 30,
+		Compress:   true,
+	}
+}
+
+func (s *LogRotateService) sanitize(input model.LogRotateSettings) (model.LogRotateSettings, error) {
+	output := s.defaultSettings()
+	output.Enabled = input.Enabled
+	output.Compress = input.Compress
+	output.LastUpdatedUnixTime = input.LastUpdatedUnixTime
+	switch input.Frequency {
+	case "":
+	case "daily", "weekly", "monthly":
+		output.Frequency = input.Frequency
+	default:
+		return model.LogRotateSettings{}, fmt.Errorf("%w: 不支持的轮转周期 %s", ErrInvalidLogRotateSettings, input.Frequency)
+	}
+	if input.MaxSizeMB < 0 || input.MaxAgeDays < 0 {
+		return model.LogRotateSettings{}, fmt.Errorf("%w: 大小与保留天数不能为负数", ErrInvalidLogRotateSettings)
+	}
+	output.MaxSizeMB = input.MaxSizeMB
+	output.MaxAgeDays = input.MaxAgeDays
+	if input.Rotate < 0 || input.Rotate > 365 {
+		return model.LogRotateSettings{}, fmt.Errorf("%w: 保留份数需在 1 到 365 之间", ErrInvalidLogRotateSettings)
+	}
+	if input.Rotate > 0 {
+		output.Rotate = input.Rotate
+	}
+	return output, nil
+}
+
+func (s *LogRotateService) Get() (model.LogRotateSettings, error) {
+	content, err := os.ReadFile(s.settingsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s.defaultSettings(), nil
+		}
+		return model.LogRotateSettings{}, err
+	}
+	var settings model.LogRotateSettings
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return model.LogRotateSettings{}, err
+	}
+	normalized, err := s.sanitize(settings)
+	if err != nil {
+		return s.defaultSettings(), nil
+	}
+	return normalized, nil
+}
+
+func (s *LogRotateService) Status() (*model.LogRotateStatus, error) {
+	settings, err := s.Get()
+	if err != nil {
+		return nil, err
+	}
+	_, lookErr := exec.LookPath(s.Binary)
+	return &model.LogRotateStatus{LogRotateSettings: settings, Installed: lookErr == nil, ConfigPath: s.ConfigPath}, nil
+}
+
+func (s *LogRotateService) ensureBinary() error {
+	if _, err := exec.LookPath(s.Binary); err == nil {
+		return nil
+	}
+	if _, err := s.run("bash", "-c", "apt-get update >/dev/null 2>&1 && apt-get install -y logrotate >/dev/null 2>&1"); err != nil {
+		return fmt.Errorf("安装 logrotate 失败: %w", err)
+	}
+	if _, err := exec.LookPath(s.Binary); err != nil {
+		return fmt.Errorf("安装 logrotate 失败: %w", err)
+	}
+	return nil
+}
+
+// Save 保存规则并写入 logrotate 配置，关闭时删除配置。写入后用 logrotate -d 校验，失败时恢复原配置
+func (s *LogRotateService) Save(input model.LogRotateSettings) (model.LogRotateSettings, error) {
+	settings, err := s.sanitize(input)
+	if err != nil {
+		return model.LogRotateSettings{}, err
+	}
+	settings.LastUpdatedUnixTime = time.Now().Unix()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.writeConfig(settings); err != nil {
+		return model.LogRotateSettings{}, err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.LogRotateSettings{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.settingsPath), 0700); err != nil {
+		return model.LogRotateSettings{}, err
+	}
+	if err := os.WriteFile(s.settingsPath, data, 0600); err != nil {
+		return model.LogRotateSettings{}, err
+	}
+	return settings, nil
+}
+
+func (s *LogRotateService) writeConfig(settings model.LogRotateSettings) error {
+	if !settings.Enabled {
+		if err := os.Remove(s.ConfigPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if conflict := s.findConflict(); conflict != "" {
+		return fmt.Errorf("%w: %s 已经轮转 %s 下的日志，请先删除或调整该文件，避免同一日志被轮转两次", ErrInvalidLogRotateSettings, conflict, s.LogDir)
+	}
+	if err := s.ensureBinary(); err != nil {
+		return err
+	}
+
+	prev, prevErr := os.ReadFile(s.ConfigPath)
+	if err := os.MkdirAll(filepath.Dir(s.ConfigPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.ConfigPath, []byte(s.render(settings)), 0644); err != nil {
+		return err
+	}
+	if out, err := s.run(s.Binary, "-d", s.ConfigPath); err != nil {
+		if prevErr == nil {
+			os.WriteFile(s.ConfigPath, prev, 0644)
+		} else {
+			os.Remove(s.ConfigPath)
+		}
+		return fmt.Errorf("logrotate 配置校验失败: %s", strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// render 生成 logrotate 配置。delaycompress 保留最近一份未压缩的历史日志，GoAccess 报告会一并分析它
+func (s *LogRotateService) render(settings model.LogRotateSettings) string {
+	var b strings.Builder
+	b.WriteString("# 由面板自动生成，请勿手动修改\n")
+	fmt.Fprintf(&b, "%s %s {\n", filepath.Join(s.LogDir, "*-access.log"), filepath.Join(s.LogDir, "*-error.log"))
+	fmt.Fprintf(&b, "    %s\n", settings.Frequency)
+	if settings.MaxSizeMB > 0 {
+		fmt.Fprintf(&b, "    maxsize %dM\n", settings.MaxSizeMB)
+	}
+	fmt.Fprintf(&b, "    rotate %d\n", settings.Rotate)
+	if settings.MaxAgeDays > 0 {
+		fmt.Fprintf(&b, "    maxage %d\n", settings.MaxAgeDays)
+	}
+	b.WriteString("    missingok\n    notifempty\n")
+	if settings.Compress {
+		b.WriteString("    compress\n    delaycompress\n")
+	}
+	b.WriteString("    sharedscripts\n    postrotate\n")
+	fmt.Fprintf(&b, "        [ -s %[1]s ] && kill -USR1 \"$(cat %[1]s)\" || true\n", s.PidFile)
+	b.WriteString("    endscript\n}\n")
+	return b.String()
+}
+
+// findConflict 返回系统中已经匹配站点日志的其他 logrotate 配置文件，例如发行版 nginx 包自带的 /etc/logrotate.d/nginx
+func (s *LogRotateService) findConflict() string {
+	samples := []string{filepath.Join(s.LogDir, "example.com-access.log"), filepath.Join(s.LogDir, "example.com-error.log")}
+	entries, err := os.ReadDir(s.ConfigDir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		path := filepath.Join(s.ConfigDir, entry.Name())
+		if entry.IsDir() || path == s.ConfigPath {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		depth := 0
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			if depth == 0 {
+				for _, field := range strings.Fields(strings.TrimSuffix(line, "{")) {
+					for _, sample := range samples {
+						if ok, _ := filepath.Match(strings.Trim(field, `"`), sample); ok {
+							return path
+						}
+					}
+				}
+			}
+			depth += strings.Count(line, "{") - strings.Count(line, "}")
+		}
+	}
+	return ""
+}
+
+// RotateNow 立即按当前配置强制轮转一次
+func (s *LogRotateService) RotateNow() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.ConfigPath); err != nil {
+		return fmt.Errorf("%w: 尚未启用日志轮转", ErrInvalidLogRotateSettings)
+	}
+	if out, err := s.run(s.Binary, "-f", s.ConfigPath); err != nil {
+		return fmt.Errorf("日志轮转失败: %s", strings.TrimSpace(out))
+	}
+	return nil
+}
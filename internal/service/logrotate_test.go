@@ -0,0 +1,70 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nginx-mgr/internal/model"
+)
+
+func TestLogRotateService(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "logrotate.d")
+	os.MkdirAll(confDir, 0755)
+
+	var commands []string
+	svc := NewLogRotateService()
+	svc.LogDir = "/var/log/nginx"
+	svc.ConfigDir = confDir
+	svc.ConfigPath = filepath.Join(confDir, "nginx-mgr")
+	svc.Binary = "sh"
+	svc.settingsPath = filepath.Join(dir, "logrotate_settings.json")
+	svc.run = func(name string, args ...string) (string, error) {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return "", nil
+	}
+
+	if _, err := svc.Save(model.LogRotateSettings{Enabled: true, Frequency: "hourly"}); !errors.Is(err, ErrInvalidLogRotateSettings) {
+		t.Fatalf("expected invalid frequency, got %v", err)
+	}
+
+	saved, err := svc.Save(model.LogRotateSettings{Enabled: true, Frequency: "weekly", MaxSizeMB: 50, Rotate: 8, Compress: true})
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if saved.MaxAgeDays != 0 || saved.Rotate != 8 {
+		t.Fatalf("unexpected settings: %+v", saved)
+	}
+	conf, _ := os.ReadFile(svc.ConfigPath)
+	for _, want := range []string{"/var/log/nginx/*-access.log /var/log/nginx/*-error.log {", "weekly", "maxsize 50M", "rotate 8", "delaycompress", "kill -USR1"} {
+		if !strings.Contains(string(conf), want) {
+			t.Fatalf("config missing %q:\n%s", want, conf)
+		}
+	}
+	if strings.Contains(string(conf), "maxage") {
+		t.Fatalf("unexpected maxage:\n%s", conf)
+	}
+	if len(commands) != 1 || commands[0] != "sh -d "+svc.ConfigPath {
+		t.Fatalf("expected config check, got %v", commands)
+	}
+
+	// 发行版自带的配置已经覆盖站点日志时拒绝启用
+	os.WriteFile(filepath.Join(confDir, "nginx"), []byte("/var/log/nginx/*.log {\n    daily\n}\n"), 0644)
+	if _, err := svc.Save(saved); !errors.Is(err, ErrInvalidLogRotateSettings) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+
+	saved.Enabled = false
+	if _, err := svc.Save(saved); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if _, err := os.Stat(svc.ConfigPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("config not removed: %v", err)
+	}
+	if err := svc.RotateNow(); !errors.Is(err, ErrInvalidLogRotateSettings) {
+		t.Fatalf("expected rotate to require config, got %v", err)
+	}
+}
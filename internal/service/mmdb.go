@@ -0,0 +1,276 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+)
+
+// mmdbMetadataMarker 元数据段的起始标记，位于文件末尾 128KB 内
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+var errInvalidMMDB = errors.New("不是有效的 MaxMind 数据库")
+
+// MaxMind DB 数据段的字段类型
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// mmdbReader 只读解析 MaxMind DB（GeoLite2/GeoIP2 的 .mmdb 格式），数据整体读入内存
+type mmdbReader struct {
+	buf          []byte
+	data         []byte // 数据段，指针与查询结果的偏移都相对于它
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	ipv4Start    uint
+	databaseType string
+	buildEpoch   uint64
+}
+
+func openMMDB(buf []byte) (*mmdbReader, error) {
+	start := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if start < 0 {
+		return nil, errInvalidMMDB
+	}
+	meta := buf[start+len(mmdbMetadataMarker):]
+	value, _, err := decodeMMDB(meta, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 解析元数据失败: %v", errInvalidMMDB, err)
+	}
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return nil, errInvalidMMDB
+	}
+	r := &mmdbReader{buf: buf}
+	r.nodeCount = uint(mmdbUint(fields["node_count"]))
+	r.recordSize = uint(mmdbUint(fields["record_size"]))
+	r.ipVersion = uint(mmdbUint(fields["ip_version"]))
+	r.buildEpoch = mmdbUint(fields["build_epoch"])
+	r.databaseType, _ = fields["database_type"].(string)
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("%w: 不支持的 record_size %d", errInvalidMMDB, r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: 不支持的 ip_version %d", errInvalidMMDB, r.ipVersion)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+16 > uint(start) {
+		return nil, fmt.Errorf("%w: 搜索树超出文件范围", errInvalidMMDB)
+	}
+	r.data = buf[treeSize+16 : start]
+
+	// IPv6 数据库中 IPv4 地址位于 ::/96 之下，预先走完前 96 位
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// record 读取节点的左（bit=0）或右（bit=1）记录
+func (r *mmdbReader) record(node uint, bit uint) uint {
+	b := r.buf[node*r.recordSize/4:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// lookup 返回 IP 对应记录在数据段中的偏移，found 为 false 表示数据库中没有该地址
+func (r *mmdbReader) lookup(ip net.IP) (offset uint, found bool, err error) {
+	node, bits := uint(0), 128
+	if v4 := ip.To4(); v4 != nil {
+		ip, bits = v4, 32
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if r.ipVersion == 4 {
+		return 0, false, nil
+	}
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = r.record(node, bit)
+	}
+	switch {
+	case node == r.nodeCount:
+		return 0, false, nil
+	case node > r.nodeCount:
+		offset = node - r.nodeCount - 16
+		if offset >= uint(len(r.data)) {
+			return 0, false, fmt.Errorf("%w: 记录指向数据段之外", errInvalidMMDB)
+		}
+		return offset, true, nil
+	}
+	return 0, false, fmt.Errorf("%w: 搜索树不完整", errInvalidMMDB)
+}
+
+// decode 解码数据段中指定偏移的记录
+func (r *mmdbReader) decode(offset uint) (any, error) {
+	value, _, err := decodeMMDB(r.data, offset, 0)
+	return value, err
+}
+
+// decodeMMDB 解码 data[offset:] 处的一个字段，返回值与下一个字段的偏移
+func decodeMMDB(data []byte, offset uint, depth int) (any, uint, error) {
+	if depth > 32 {
+		return nil, 0, errors.New("嵌套层级过深")
+	}
+	if offset >= uint(len(data)) {
+		return nil, 0, errors.New("偏移超出数据范围")
+	}
+	ctrl := data[offset]
+	offset++
+	kind := uint(ctrl >> 5)
+
+	if kind == mmdbPointer {
+		size := uint(ctrl>>3) & 0x3
+		if offset+size+1 > uint(len(data)) {
+			return nil, 0, errors.New("指针被截断")
+		}
+		var target uint
+		b := data[offset:]
+		switch size {
+		case 0:
+			target = uint(ctrl&0x7)<<8 | uint(b[0])
+		case 1:
+			target = (uint(ctrl&0x7)<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			target = (uint(ctrl&0x7)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			target = uint(binary.BigEndian.Uint32(b))
+		}
+		value, _, err := decodeMMDB(data, target, depth+1)
+		return value, offset + size + 1, err
+	}
+
+	if kind == mmdbExtended {
+		if offset >= uint(len(data)) {
+			return nil, 0, errors.New("类型被截断")
+		}
+		kind = 7 + uint(data[offset])
+		offset++
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(data)) {
+			return nil, 0, errors.New("长度被截断")
+		}
+		n := uint(0)
+		for _, b := range data[offset : offset+extra] {
+			n = n<<8 | uint(b)
+		}
+		size = []uint{29, 285, 65821}[extra-1] + n
+		offset += extra
+	}
+
+	switch kind {
+	case mmdbMap:
+		fields := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := decodeMMDB(data, offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map 的键不是字符串")
+			}
+			value, next, err := decodeMMDB(data, next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			fields[name] = value
+			offset = next
+		}
+		return fields, offset, nil
+	case mmdbArray:
+		items := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := decodeMMDB(data, offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, value)
+			offset = next
+		}
+		return items, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	case mmdbContainer, mmdbEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(data)) {
+		return nil, 0, errors.New("字段被截断")
+	}
+	b := data[offset : offset+size]
+	offset += size
+	switch kind {
+	case mmdbString:
+		return string(b), offset, nil
+	case mmdbBytes:
+		return append([]byte(nil), b...), offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errors.New("double 长度无效")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errors.New("float 长度无效")
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbInt32:
+		if size > 8 {
+			return nil, 0, errors.New("整数长度无效")
+		}
+		n := uint64(0)
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		if kind == mmdbInt32 {
+			return int64(int32(uint32(n))), offset, nil
+		}
+		return n, offset, nil
+	case mmdbUint128:
+		// 查询只用到字符串字段，128 位整数原样保留
+		return append([]byte(nil), b...), offset, nil
+	}
+	return nil, 0, fmt.Errorf("未知的字段类型 %d", kind)
+}
+
+func mmdbUint(value any) uint64 {
+	n, _ := value.(uint64)
+	return n
+}
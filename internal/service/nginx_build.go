@@ -0,0 +1,226 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"nginx-mgr/internal/model"
+)
+
+const (
+	nginxBuildProfilePath = "/root/nginx_build_profile.json"
+	// nginxModulesConf 面板编译的动态模块的 load_module 列表，在 nginx.conf 开头引入
+	nginxModulesConf = "nginx-mgr-modules.conf"
+)
+
+// nginxModule 可选动态模块的源码来源与编译产物。Archive 为离线目录中的源码包文件名，
+// Subdir 为 --add-dynamic-module 指向的源码子目录
+type nginxModule struct {
+	URL     string
+	Git     bool
+	Archive string
+	Subdir  string
+	Objects []string
+	AptDeps []string
+	RpmDeps []string
+}
+
+var nginxModules = map[string]nginxModule{
+	"stream": {
+		Objects: []string{"ngx_stream_module.so"},
+	},
+	"acme": {
+		URL:     "https://github.com/nginx/nginx-acme.git",
+		Git:     true,
+		Archive: "nginx-acme.tar.gz",
+		Objects: []string{"ngx_http_acme_module.so"},
+		AptDeps: []string{"git", "cargo", "rustc", "libclang-dev", "pkg-config"},
+		RpmDeps: []string{"git", "cargo", "rust", "clang-devel", "pkgconf-pkg-config"},
+	},
+	"brotli": {
+		URL:     "https://github.com/google/ngx_brotli.git",
+		Git:     true,
+		Archive: "ngx_brotli.tar.gz",
+		Objects: []string{"ngx_http_brotli_filter_module.so", "ngx_http_brotli_static_module.so"},
+		AptDeps: []string{"git", "libbrotli-dev"},
+		RpmDeps: []string{"git", "brotli-devel"},
+	},
+	"headers-more": {
+		URL:     "https://github.com/openresty/headers-more-nginx-module/archive/refs/tags/v0.38.tar.gz",
+		Archive: "headers-more-nginx-module-0.38.tar.gz",
+		Objects: []string{"ngx_http_headers_more_filter_module.so"},
+	},
+	"njs": {
+		URL:     "https://github.com/nginx/njs/archive/refs/tags/0.9.1.tar.gz",
+		Archive: "njs-0.9.1.tar.gz",
+		Subdir:  "nginx",
+		Objects: []string{"ngx_http_js_module.so", "ngx_stream_js_module.so"},
+		AptDeps: []string{"libxml2-dev", "libxslt1-dev"},
+		RpmDeps: []string{"libxml2-devel", "libxslt-devel"},
+	},
+	"geoip2": {
+		URL:     "https://github.com/leev/ngx_http_geoip2_module/archive/refs/tags/3.4.tar.gz",
+		Archive: "ngx_http_geoip2_module-3.4.tar.gz",
+		Objects: []string{"ngx_http_geoip2_module.so", "ngx_stream_geoip2_module.so"},
+		AptDeps: []string{"libmaxminddb-dev"},
+		RpmDeps: []string{"libmaxminddb-devel"},
+	},
+}
+
+var configureStreamPattern = regexp.MustCompile(`(^|\s)--with-stream(=dynamic)?(\s|$)`)
+
+// sanitizeBuildModules 去重并按 model.NginxBuildModules 的顺序排列，stream 需在依赖它的模块之前加载
+func sanitizeBuildModules(modules []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, name := range modules {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := nginxModules[name]; !ok {
+			return nil, fmt.Errorf("不支持的模块 %q，可选: %s", name, strings.Join(model.NginxBuildModules, "、"))
+		}
+		seen[name] = true
+	}
+	sanitized := []string{}
+	for _, name := range model.NginxBuildModules {
+		if seen[name] {
+			sanitized = append(sanitized, name)
+		}
+	}
+	return sanitized, nil
+}
+
+// loadBuildProfile 读取上次编译使用的版本与模块，文件不存在时返回 nil
+func loadBuildProfile(path string) (*model.NginxBuildProfile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var profile model.NginxBuildProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("解析编译配置失败: %w", err)
+	}
+	if profile.Modules, err = sanitizeBuildModules(profile.Modules); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func saveBuildProfile(path string, profile model.NginxBuildProfile) error {
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// moduleConfigureArgs 去掉上次由面板添加的 --add-dynamic-module 参数，再按 modules 追加。
+// 原编译参数中已有 --with-stream 时不再重复添加
+func moduleConfigureArgs(configureArgs, moduleDir string, modules []string) string {
+	pattern := regexp.MustCompile(`\s*--add-dynamic-module=` + regexp.QuoteMeta(moduleDir) + `/\S*`)
+	args := strings.TrimSpace(pattern.ReplaceAllString(configureArgs, ""))
+	for _, name := range modules {
+		if name == "stream" {
+			if !configureStreamPattern.MatchString(args) {
+				args += " --with-stream=dynamic --with-stream_ssl_module --with-stream_ssl_preread_module"
+			}
+			continue
+		}
+		dir := filepath.Join(moduleDir, name)
+		if sub := nginxModules[name].Subdir; sub != "" {
+			dir = filepath.Join(dir, sub)
+		}
+		args += " --add-dynamic-module=" + dir
+	}
+	return strings.TrimSpace(args)
+}
+
+// renderModuleFetchScript 安装模块的编译依赖并把源码放到 moduleDir/<模块名>，
+// 离线目录中有对应源码包时直接解压，不访问 GitHub
+func renderModuleFetchScript(moduleDir, artifactDir string, modules []string) string {
+	var b strings.Builder
+	var aptDeps, rpmDeps []string
+	for _, name := range modules {
+		aptDeps = append(aptDeps, nginxModules[name].AptDeps...)
+		rpmDeps = append(rpmDeps, nginxModules[name].RpmDeps...)
+	}
+	if len(aptDeps) > 0 {
+		fmt.Fprintf(&b, `if command -v apt-get >/dev/null; then
+  DEBIAN_FRONTEND=noninteractive apt-get install -y %s
+elif command -v dnf >/dev/null; then
+  dnf install -y %s
+elif command -v yum >/dev/null; then
+  yum install -y %s
+fi
+`, strings.Join(aptDeps, " "), strings.Join(rpmDeps, " "), strings.Join(rpmDeps, " "))
+	}
+	for _, name := range modules {
+		module := nginxModules[name]
+		if module.URL == "" {
+			continue
+		}
+		dir := filepath.Join(moduleDir, name)
+		fmt.Fprintf(&b, "rm -rf %[1]s && mkdir -p %[1]s\n", dir)
+		switch local := offlineFile(artifactDir, module.Archive); {
+		case local != "":
+			fmt.Fprintf(&b, "tar xzf %s -C %s --strip-components=1\n", shellQuote(local), dir)
+		case module.Git:
+			fmt.Fprintf(&b, "git clone --depth 1 %s %s\n", module.URL, dir)
+		default:
+			fmt.Fprintf(&b, "curl -fsSL %s | tar xz -C %s --strip-components=1\n", module.URL, dir)
+		}
+	}
+	return b.String()
+}
+
+// installBuiltModules 把 objs 中所选模块的 .so 复制到按版本区分的目录，并生成 load_module 列表。
+// 按版本分目录可以在回滚时让原二进制继续加载原来的模块
+func installBuiltModules(objsDir, modulesDir, version string, modules []string) (string, error) {
+	target := filepath.Join(modulesDir, version)
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("# 由 nginx-mgr 生成：编译安装时选择的动态模块\n")
+	for _, name := range modules {
+		for _, object := range nginxModules[name].Objects {
+			src := filepath.Join(objsDir, object)
+			if _, err := os.Stat(src); err != nil {
+				// 例如未启用 stream 时不会生成 ngx_stream_js_module.so
+				continue
+			}
+			dest := filepath.Join(target, object)
+			if err := copyFileMode(src, dest, 0644); err != nil {
+				return "", fmt.Errorf("复制模块 %s 失败: %w", object, err)
+			}
+			fmt.Fprintf(&b, "load_module %s;\n", dest)
+		}
+	}
+	return b.String(), nil
+}
+
+// ensureModulesInclude 在 nginx.conf 开头引入模块列表，load_module 必须出现在所有块之前
+func ensureModulesInclude(confDir string) error {
+	confPath := filepath.Join(confDir, "nginx.conf")
+	data, err := os.ReadFile(confPath)
+	if err != nil {
+		return fmt.Errorf("读取 nginx.conf 失败: %w", err)
+	}
+	includeLine := fmt.Sprintf("include %s;", filepath.Join(confDir, nginxModulesConf))
+	if strings.Contains(string(data), includeLine) {
+		return nil
+	}
+	return os.WriteFile(confPath, append([]byte(includeLine+"\n"), data...), 0644)
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"nginx-mgr/internal/model"
+)
+
+const mainConfName = "nginx.conf"
+
+var ErrInvalidConfPath = errors.New("只能编辑 nginx.conf 与 conf.d 下的 .conf 文件")
+
+// NginxConfService 读写站点以外的全局配置：主配置 nginx.conf 与 conf.d 下的文件。
+// 只负责文件本身，测试与重载由调用方完成，失败时用 Restore 写回原内容
+type NginxConfService struct {
+	ConfDir string
+}
+
+func NewNginxConfService() *NginxConfService {
+	return &NginxConfService{ConfDir: model.NginxConfDir}
+}
+
+func (s *NginxConfService) mainPath() string {
+	return filepath.Join(s.ConfDir, mainConfName)
+}
+
+// resolve 校验相对路径并返回绝对路径，只接受 nginx.conf 与 conf.d/<name>.conf，不允许子目录
+func (s *NginxConfService) resolve(rel string) (string, error) {
+	rel = strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(rel)), "/")
+	if rel == mainConfName {
+		return s.mainPath(), nil
+	}
+	name, ok := strings.CutPrefix(rel, "conf.d/")
+	if !ok || name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".conf") {
+		return "", fmt.Errorf("%w: %s", ErrInvalidConfPath, rel)
+	}
+	return filepath.Join(s.ConfDir, "conf.d", name), nil
+}
+
+// List 返回 nginx.conf 与 conf.d 下的 .conf 文件，conf.d 不存在时只返回 nginx.conf
+func (s *NginxConfService) List() ([]model.NginxConfEntry, error) {
+	entries := []model.NginxConfEntry{}
+	if info, err := os.Stat(s.mainPath()); err == nil {
+		entries = append(entries, model.NginxConfEntry{Path: mainConfName, Size: info.Size(), ModifiedUnix: info.ModTime().Unix()})
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	files, err := os.ReadDir(filepath.Join(s.ConfDir, "conf.d"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	var included []model.NginxConfEntry
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".conf") {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		included = append(included, model.NginxConfEntry{Path: "conf.d/" + file.Name(), Size: info.Size(), ModifiedUnix: info.ModTime().Unix()})
+	}
+	sort.Slice(included, func(i, j int) bool { return included[i].Path < included[j].Path })
+	return append(entries, included...), nil
+}
+
+func (s *NginxConfService) Read(rel string) (string, error) {
+	path, err := s.resolve(rel)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// Write 写入新内容，返回写入前的内容以及文件原先是否存在，conf.d 下的文件不存在时新建
+func (s *NginxConfService) Write(rel, content string) (string, bool, error) {
+	path, err := s.resolve(rel)
+	if err != nil {
+		return "", false, err
+	}
+	prev, err := os.ReadFile(path)
+	existed := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", false, err
+	}
+	if !existed && path == s.mainPath() {
+		return "", false, fmt.Errorf("%s 不存在，请先安装 Nginx", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", false, err
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return "", false, err
+	}
+	return string(prev), existed, nil
+}
+
+// Delete 删除 conf.d 下的文件并返回原内容，nginx.conf 不能删除
+func (s *NginxConfService) Delete(rel string) (string, error) {
+	path, err := s.resolve(rel)
+	if err != nil {
+		return "", err
+	}
+	if path == s.mainPath() {
+		return "", fmt.Errorf("%w: 不能删除 nginx.conf", ErrInvalidConfPath)
+	}
+	prev, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Remove(path); err != nil {
+		return "", err
+	}
+	return string(prev), nil
+}
+
+// Restore 把文件恢复为 Write 或 Delete 之前的状态，existed 为 false 时删除新建的文件
+func (s *NginxConfService) Restore(rel, content string, existed bool) error {
+	path, err := s.resolve(rel)
+	if err != nil {
+		return err
+	}
+	if !existed {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNginxConfService(t *testing.T) {
+	dir := t.TempDir()
+	svc := &NginxConfService{ConfDir: dir}
+	if err := os.WriteFile(filepath.Join(dir, "nginx.conf"), []byte("events {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rel := range []string{"sites-available/a.com", "conf.d/../nginx.conf", "conf.d/sub/a.conf", "conf.d/a.txt", "mime.types", "conf.d/.conf"} {
+		if _, _, err := svc.Write(rel, "x"); !errors.Is(err, ErrInvalidConfPath) {
+			t.Fatalf("expected %s to be rejected, got %v", rel, err)
+		}
+	}
+
+	prev, existed, err := svc.Write("conf.d/gzip.conf", "gzip on;\n")
+	if err != nil || existed || prev != "" {
+		t.Fatalf("create: prev=%q existed=%v err=%v", prev, existed, err)
+	}
+	prev, existed, err = svc.Write("/nginx.conf", "events { worker_connections 1024; }\n")
+	if err != nil || !existed || prev != "events {}\n" {
+		t.Fatalf("update: prev=%q existed=%v err=%v", prev, existed, err)
+	}
+	if err := svc.Restore("nginx.conf", prev, existed); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := svc.Read("nginx.conf"); content != "events {}\n" {
+		t.Fatalf("restore failed: %q", content)
+	}
+
+	entries, err := svc.List()
+	if err != nil || len(entries) != 2 || entries[0].Path != "nginx.conf" || entries[1].Path != "conf.d/gzip.conf" {
+		t.Fatalf("unexpected list: %+v, %v", entries, err)
+	}
+
+	// 新建的文件回滚时删除
+	if err := svc.Restore("conf.d/gzip.conf", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Read("conf.d/gzip.conf"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected file removed, got %v", err)
+	}
+	if _, err := svc.Delete("nginx.conf"); !errors.Is(err, ErrInvalidConfPath) {
+		t.Fatalf("nginx.conf must not be deletable, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"nginx-mgr/internal/model"
+)
+
+// configDumpHeader nginx -T 在每个文件内容前输出的标记行
+const configDumpHeader = "# configuration file "
+
+var ErrNginxConfigInvalid = errors.New("Nginx 配置测试失败")
+
+// configIssuePattern 匹配 nginx: [emerg] unknown directive "foo" in /etc/nginx/conf.d/a.conf:12
+var configIssuePattern = regexp.MustCompile(`^nginx: \[(\w+)\] (.*?)(?: in (\S+):(\d+))?$`)
+
+// runNginx 执行 nginx 并分别返回 stdout 与 stderr，nginx -T 的配置写到 stdout、测试结果写到 stderr
+func runNginx(args ...string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(model.NginxSbinPath, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// ConfigDump 返回 nginx -T 输出的完整配置，包括面板不管理的 include 文件
+func (s *SystemService) ConfigDump() (*model.NginxConfigDump, error) {
+	stdout, stderr, err := runNginx("-T")
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("%w: %s", ErrNginxConfigInvalid, strings.TrimSpace(stderr))
+		}
+		return nil, err
+	}
+	return &model.NginxConfigDump{Files: parseConfigDump(stdout), Raw: stdout, Messages: strings.TrimSpace(stderr)}, nil
+}
+
+// parseConfigDump 按 "# configuration file <path>:" 标记把 nginx -T 的输出拆成各个文件
+func parseConfigDump(output string) []model.NginxConfigFile {
+	files := []model.NginxConfigFile{}
+	var current *model.NginxConfigFile
+	var content strings.Builder
+	flush := func() {
+		if current != nil {
+			// nginx 在每个文件内容后追加一个换行作为分隔
+			current.Content = strings.TrimSuffix(content.String(), "\n")
+			files = append(files, *current)
+		}
+		content.Reset()
+	}
+	for _, line := range strings.SplitAfter(output, "\n") {
+		trimmed := strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(trimmed, configDumpHeader) && strings.HasSuffix(trimmed, ":") {
+			flush()
+			current = &model.NginxConfigFile{Path: strings.TrimSuffix(strings.TrimPrefix(trimmed, configDumpHeader), ":")}
+			continue
+		}
+		if current != nil {
+			content.WriteString(line)
+		}
+	}
+	flush()
+	return files
+}
+
+// TestConfig 执行 nginx -t 并解析输出中的错误与警告，配置有误时 OK 为 false，无法执行 nginx 时返回错误
+func (s *SystemService) TestConfig() (*model.NginxConfigTest, error) {
+	_, stderr, err := runNginx("-t")
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, err
+		}
+	}
+	output := strings.TrimSpace(stderr)
+	return &model.NginxConfigTest{OK: err == nil, Issues: parseConfigTest(output), Output: output}, nil
+}
+
+// parseConfigTest 提取 nginx -t 输出中带级别的行，忽略 "syntax is ok"、"test failed" 等汇总行
+func parseConfigTest(output string) []model.NginxConfigIssue {
+	issues := []model.NginxConfigIssue{}
+	for _, line := range strings.Split(output, "\n") {
+		match := configIssuePattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		issue := model.NginxConfigIssue{Level: match[1], Message: match[2], File: match[3]}
+		issue.Line, _ = strconv.Atoi(match[4])
+		issues = append(issues, issue)
+	}
+	return issues
+}
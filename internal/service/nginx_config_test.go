@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+
+	"nginx-mgr/internal/model"
+)
+
+func TestParseConfigDump(t *testing.T) {
+	output := "# configuration file /etc/nginx/nginx.conf:\n" +
+		"http {\n    include /etc/nginx/conf.d/*.conf;\n}\n\n" +
+		"# configuration file /etc/nginx/conf.d/empty.conf:\n\n" +
+		"# configuration file /etc/nginx/conf.d/gzip.conf:\n" +
+		"gzip on;\n# configuration file /not/a/header\n"
+	files := parseConfigDump(output)
+	if len(files) != 3 {
+		t.Fatalf("unexpected files: %+v", files)
+	}
+	if files[0].Path != "/etc/nginx/nginx.conf" || files[0].Content != "http {\n    include /etc/nginx/conf.d/*.conf;\n}\n" {
+		t.Fatalf("unexpected main file: %+v", files[0])
+	}
+	if files[1].Path != "/etc/nginx/conf.d/empty.conf" || files[1].Content != "" {
+		t.Fatalf("unexpected empty file: %+v", files[1])
+	}
+	// 没有以换行结尾的文件保持原样，不完整的标记行视为内容
+	if files[2].Content != "gzip on;\n# configuration file /not/a/header" {
+		t.Fatalf("unexpected last file: %q", files[2].Content)
+	}
+}
+
+func TestParseConfigTest(t *testing.T) {
+	output := "nginx: [warn] conflicting server name \"a.com\" on 0.0.0.0:80, ignored\n" +
+		"nginx: [emerg] unknown directive \"foo\" in /etc/nginx/sites-enabled/a.com.conf:12\n" +
+		"nginx: configuration file /etc/nginx/nginx.conf test failed"
+	issues := parseConfigTest(output)
+	if len(issues) != 2 {
+		t.Fatalf("unexpected issues: %+v", issues)
+	}
+	if issues[0].Level != "warn" || issues[0].File != "" || issues[0].Line != 0 || issues[0].Message != "conflicting server name \"a.com\" on 0.0.0.0:80, ignored" {
+		t.Fatalf("unexpected warning: %+v", issues[0])
+	}
+	want := model.NginxConfigIssue{Level: "emerg", File: "/etc/nginx/sites-enabled/a.com.conf", Line: 12, Message: "unknown directive \"foo\""}
+	if issues[1] != want {
+		t.Fatalf("unexpected error: %+v", issues[1])
+	}
+	if got := parseConfigTest("nginx: the configuration file /etc/nginx/nginx.conf syntax is ok\nnginx: configuration file /etc/nginx/nginx.conf test is successful"); len(got) != 0 {
+		t.Fatalf("expected no issues, got %+v", got)
+	}
+}
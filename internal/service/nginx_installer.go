@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+)
+
+const (
+	// nginxInstallManifestPath 记录面板安装 Nginx 的方式与软件包，卸载时据此清理
+	nginxInstallManifestPath = "/root/nginx_install.json"
+	nginxUnitPath            = "/etc/systemd/system/nginx.service"
+)
+
+// nginxBuildDeps 编译 Nginx 本身需要的工具与库，动态模块的依赖由 renderModuleFetchScript 安装
+const nginxBuildDeps = `if command -v apt-get >/dev/null; then
+  export DEBIAN_FRONTEND=noninteractive
+  apt-get install -y build-essential libpcre2-dev zlib1g-dev libssl-dev curl ca-certificates
+elif command -v dnf >/dev/null; then
+  dnf install -y gcc make pcre2-devel zlib-devel openssl-devel curl
+elif command -v yum >/dev/null; then
+  yum install -y gcc make pcre2-devel zlib-devel openssl-devel curl
+fi
+`
+
+// sourceConfigureArgs 编译安装的 configure 参数，路径与发行版软件包保持一致，
+// 面板其他功能（站点目录、日志分析、平滑升级）无需区分安装方式
+func (s *NginxService) sourceConfigureArgs() string {
+	args := []string{
+		"--prefix=" + s.Prefix,
+		"--sbin-path=" + s.Upgrader.SbinPath,
+		"--modules-path=" + filepath.Join(s.Prefix, "modules"),
+		"--conf-path=" + filepath.Join(s.ConfDir, "nginx.conf"),
+		"--error-log-path=" + filepath.Join(s.LogDir, "error.log"),
+		"--http-log-path=" + filepath.Join(s.LogDir, "access.log"),
+		"--pid-path=" + s.Upgrader.PidFile,
+		"--lock-path=" + filepath.Join(filepath.Dir(s.Upgrader.PidFile), "nginx.lock"),
+		"--http-client-body-temp-path=" + filepath.Join(s.CacheDir, "client_temp"),
+		"--http-proxy-temp-path=" + filepath.Join(s.CacheDir, "proxy_temp"),
+		"--http-fastcgi-temp-path=" + filepath.Join(s.CacheDir, "fastcgi_temp"),
+		"--http-uwsgi-temp-path=" + filepath.Join(s.CacheDir, "uwsgi_temp"),
+		"--http-scgi-temp-path=" + filepath.Join(s.CacheDir, "scgi_temp"),
+		"--user=" + model.NginxUser,
+		"--group=" + model.NginxGroup,
+		"--with-compat",
+		"--with-threads",
+		"--with-file-aio",
+		"--with-pcre-jit",
+		"--with-http_ssl_module",
+		"--with-http_v2_module",
+		"--with-http_realip_module",
+		"--with-http_stub_status_module",
+		"--with-http_gzip_static_module",
+		"--with-http_sub_module",
+		"--with-http_auth_request_module",
+		"--with-stream",
+		"--with-stream_ssl_module",
+		"--with-stream_ssl_preread_module",
+		"--with-stream_realip_module",
+	}
+	return strings.Join(args, " ")
+}
+
+// defaultNginxConf 编译安装且原先没有 nginx.conf 时写入的主配置，已包含面板使用的全部 include
+func (s *NginxService) defaultNginxConf() string {
+	return fmt.Sprintf(`include %[1]s/%[2]s;
+
+user %[3]s;
+worker_processes auto;
+pid %[4]s;
+error_log %[5]s/error.log warn;
+
+events {
+    worker_connections 1024;
+}
+
+http {
+    include %[1]s/mime.types;
+    default_type application/octet-stream;
+
+%[6]s    access_log %[5]s/access.log main;
+
+    sendfile on;
+    tcp_nopush on;
+    keepalive_timeout 65;
+    server_tokens off;
+
+    include %[1]s/conf.d/*.conf;
+    include %[1]s/sites-enabled/*;
+}
+
+stream {
+    include %[1]s/streams-enabled/*;
+}
+`, s.ConfDir, nginxModulesConf, model.NginxUser, s.Upgrader.PidFile, s.LogDir, mainLogFormat)
+}
+
+// nginxUnit 编译安装的 systemd 单元。ExecStartPre 先测试配置，配置有误时不会停掉正在运行的实例
+func (s *NginxService) nginxUnit() string {
+	sbin := s.Upgrader.SbinPath
+	return fmt.Sprintf(`# 由 nginx-mgr 生成
+[Unit]
+Description=nginx - high performance web server
+Documentation=https://nginx.org/en/docs/
+After=network-online.target remote-fs.target nss-lookup.target
+Wants=network-online.target
+
+[Service]
+Type=forking
+PIDFile=%[2]s
+ExecStartPre=%[1]s -t -q
+ExecStart=%[1]s
+ExecReload=%[1]s -s reload
+ExecStop=%[1]s -s quit
+PrivateTmp=true
+
+[Install]
+WantedBy=multi-user.target
+`, sbin, s.Upgrader.PidFile)
+}
+
+// installSource 下载（或从离线目录复制）源码编译安装 Nginx 与所选动态模块，写入主配置、ACME 配置与 systemd 单元。
+// 编译目录、模块目录与编译配置和升级共用，之后升级沿用同样的模块
+func (s *NginxService) installSource(ctx context.Context, status *executor.TaskStatus, req model.InstallRequest) error {
+	u := s.Upgrader
+	artifactDir := u.ArtifactDir
+	if req.Offline {
+		if err := checkArtifacts(req.ArtifactDir, installArtifacts(req, "")); err != nil {
+			return err
+		}
+		artifactDir = req.ArtifactDir
+	}
+	confPath := filepath.Join(s.ConfDir, "nginx.conf")
+	_, statErr := os.Stat(confPath)
+	hadConf := statErr == nil
+
+	moduleDir := filepath.Join(u.BuildDir, "modules")
+	configureArgs := moduleConfigureArgs(s.sourceConfigureArgs(), moduleDir, req.Modules)
+	tarball := offlineFile(artifactDir, fmt.Sprintf("nginx-%s.tar.gz", req.Version))
+	if tarball != "" {
+		status.AddLog(fmt.Sprintf(">>> 使用离线源码包 %s 编译 nginx-%s", tarball, req.Version))
+	} else {
+		status.AddLog(fmt.Sprintf(">>> 下载并编译 nginx-%s", req.Version))
+	}
+	status.AddLog(fmt.Sprintf(">>> 动态模块: %s", strings.Join(req.Modules, "、")))
+	prepare := nginxBuildDeps +
+		fmt.Sprintf("id -u %[1]s >/dev/null 2>&1 || useradd --system --no-create-home --shell /usr/sbin/nologin %[1]s\n", model.NginxUser) +
+		renderModuleFetchScript(moduleDir, artifactDir, req.Modules)
+	script := renderNginxBuildScript(u.BuildDir, req.Version, configureArgs, tarball, prepare) + "make install\n"
+	if err := u.build(ctx, status, script); err != nil {
+		return fmt.Errorf("编译安装失败: %v", err)
+	}
+
+	status.AddLog(">>> 写入 nginx.conf、目录结构与动态模块列表")
+	for _, dir := range []string{s.LogDir, s.CacheDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if !hadConf {
+		if err := os.WriteFile(confPath, []byte(s.defaultNginxConf()), 0644); err != nil {
+			return fmt.Errorf("写入 nginx.conf 失败: %v", err)
+		}
+	}
+	if err := bootstrapPackageLayout(s.ConfDir, s.WebRoot, false); err != nil {
+		return fmt.Errorf("初始化目录结构失败: %v", err)
+	}
+	objsDir := filepath.Join(u.BuildDir, "nginx-"+req.Version, "objs")
+	modulesConf, err := installBuiltModules(objsDir, u.ModulesDir, req.Version, req.Modules)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.ConfDir, nginxModulesConf), []byte(modulesConf), 0644); err != nil {
+		return fmt.Errorf("写入模块列表失败: %v", err)
+	}
+	if err := ensureModulesInclude(s.ConfDir); err != nil {
+		return err
+	}
+	if err := writeACMEConf(s.ConfDir, filepath.Join(s.Prefix, "acme_letsencrypt")); err != nil {
+		return fmt.Errorf("写入 ACME 配置失败: %v", err)
+	}
+
+	status.AddLog(fmt.Sprintf(">>> 写入 systemd 单元 %s 并启动", s.UnitPath))
+	if err := os.WriteFile(s.UnitPath, []byte(s.nginxUnit()), 0644); err != nil {
+		return fmt.Errorf("写入 systemd 单元失败: %v", err)
+	}
+	if out, err := executor.ExecuteSimple("systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("systemctl daemon-reload 失败: %s", strings.TrimSpace(out))
+	}
+	if out, err := executor.ExecuteSimple(u.SbinPath, "-t"); err != nil {
+		return fmt.Errorf("配置验证失败: %s", strings.TrimSpace(out))
+	}
+	if out, err := executor.ExecuteSimple("systemctl", "enable", "--now", "nginx"); err != nil {
+		return fmt.Errorf("启动 Nginx 失败: %s", strings.TrimSpace(out))
+	}
+
+	profile := model.NginxBuildProfile{Version: req.Version, Modules: req.Modules, LastUpdatedUnixTime: time.Now().Unix()}
+	if err := saveBuildProfile(u.ProfilePath, profile); err != nil {
+		status.AddLog(fmt.Sprintf("!!! 警告: 保存编译配置失败: %v", err))
+	}
+	s.recordInstall(status, model.InstallManifest{Method: model.InstallMethodSource, Version: req.Version})
+	status.AddLog(fmt.Sprintf("=== nginx/%s 编译安装完成 ===", req.Version))
+	return nil
+}
+
+// recordInstall 保存安装记录，失败时只记录警告：卸载仍可按默认路径清理
+func (s *NginxService) recordInstall(status *executor.TaskStatus, manifest model.InstallManifest) {
+	manifest.InstalledUnixTime = time.Now().Unix()
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err == nil {
+		err = os.WriteFile(s.ManifestPath, data, 0600)
+	}
+	if err != nil {
+		status.AddLog(fmt.Sprintf("!!! 警告: 保存安装记录失败: %v", err))
+	}
+}
+
+// loadInstallManifest 读取安装记录，文件不存在时返回 nil
+func loadInstallManifest(path string) (*model.InstallManifest, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifest model.InstallManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("解析安装记录失败: %w", err)
+	}
+	return &manifest, nil
+}
+
+// packageInstallFootprint 返回软件包安装方式装上的软件包与写入的软件源文件
+func packageInstallFootprint(manager, source string) ([]string, []string) {
+	switch {
+	case manager == "apt-get" && source == model.InstallSourceDistro:
+		return []string{"nginx", "nginx-common", "libnginx-mod-stream"}, nil
+	case manager == "apt-get":
+		return []string{"nginx", "nginx-module-acme"}, []string{nginxOrgKeyring, "/etc/apt/sources.list.d/nginx.list", "/etc/apt/preferences.d/99nginx"}
+	case source == model.InstallSourceDistro:
+		return []string{"nginx", "nginx-mod-stream"}, nil
+	default:
+		return []string{"nginx", "nginx-module-acme"}, []string{"/etc/yum.repos.d/nginx.repo"}
+	}
+}
+
+// offlinePackageNames 从离线软件包的文件名取出包名。离线目录中的依赖库可能被其他程序使用，
+// 卸载时只移除 nginx 相关的软件包
+func offlinePackageNames(paths []string) []string {
+	var names []string
+	for _, path := range paths {
+		base := filepath.Base(path)
+		var name string
+		if strings.HasSuffix(base, ".deb") {
+			// nginx_1.28.0-1~bookworm_amd64.deb
+			name, _, _ = strings.Cut(base, "_")
+		} else {
+			// nginx-module-acme-1.28.0+0.1.1-1.el9.ngx.x86_64.rpm：去掉架构后再去掉最后两段版本与发行号
+			name = strings.TrimSuffix(base, ".rpm")
+			if i := strings.LastIndex(name, "."); i > 0 {
+				name = name[:i]
+			}
+			for range 2 {
+				if i := strings.LastIndex(name, "-"); i > 0 {
+					name = name[:i]
+				}
+			}
+		}
+		if strings.HasPrefix(name, "nginx") || strings.HasPrefix(name, "libnginx") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"nginx-mgr/internal/model"
+	"nginx-mgr/internal/nginxconf"
+)
+
+func newTestNginxService(t *testing.T) (*NginxService, string) {
+	dir := t.TempDir()
+	u := NewNginxUpgrader()
+	u.SbinPath = filepath.Join(dir, "sbin", "nginx")
+	u.PidFile = filepath.Join(dir, "run", "nginx.pid")
+	u.BuildDir = filepath.Join(dir, "build")
+	u.ProfilePath = filepath.Join(dir, "profile.json")
+	svc := NewNginxService(u)
+	svc.ConfDir = filepath.Join(dir, "etc")
+	svc.WebRoot = filepath.Join(dir, "www")
+	svc.Prefix = filepath.Join(dir, "prefix")
+	svc.LogDir = filepath.Join(dir, "log")
+	svc.CacheDir = filepath.Join(dir, "cache")
+	svc.UnitPath = filepath.Join(dir, "nginx.service")
+	svc.ManifestPath = filepath.Join(dir, "install.json")
+	svc.lookPath = func(string) (string, error) { return "", errors.New("not found") }
+	return svc, dir
+}
+
+func TestSourceInstallLayout(t *testing.T) {
+	svc, dir := newTestNginxService(t)
+
+	args := svc.sourceConfigureArgs()
+	for _, want := range []string{
+		"--sbin-path=" + svc.Upgrader.SbinPath,
+		"--conf-path=" + filepath.Join(svc.ConfDir, "nginx.conf"),
+		"--pid-path=" + svc.Upgrader.PidFile,
+		"--http-client-body-temp-path=" + filepath.Join(svc.CacheDir, "client_temp"),
+		"--with-compat",
+		"--with-stream ",
+	} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("configure args missing %q: %s", want, args)
+		}
+	}
+	// 静态编译了 stream 时选择 stream 模块不再重复添加
+	moduleDir := filepath.Join(dir, "build", "modules")
+	withModules := moduleConfigureArgs(args, moduleDir, []string{"stream", "acme"})
+	if strings.Contains(withModules, "--with-stream=dynamic") || !strings.HasSuffix(withModules, "--add-dynamic-module="+filepath.Join(moduleDir, "acme")) {
+		t.Fatalf("unexpected module args: %s", withModules)
+	}
+
+	conf := svc.defaultNginxConf()
+	tree, err := nginxconf.Parse(conf)
+	if err != nil {
+		t.Fatalf("default nginx.conf does not parse: %v\n%s", err, conf)
+	}
+	if include := nginxconf.First(tree, "include"); include == nil || include.Arg(0) != filepath.Join(svc.ConfDir, nginxModulesConf) {
+		t.Fatalf("modules include should come first:\n%s", conf)
+	}
+	// 默认配置已包含面板需要的全部内容，补齐目录时不再改动
+	patched, err := addLayoutIncludes(conf, svc.ConfDir, false)
+	if err != nil || patched != conf {
+		t.Fatalf("default nginx.conf should already contain the layout includes: %v\n%s", err, patched)
+	}
+
+	unit := svc.nginxUnit()
+	for _, want := range []string{"Type=forking", "PIDFile=" + svc.Upgrader.PidFile, "ExecStartPre=" + svc.Upgrader.SbinPath + " -t -q", "WantedBy=multi-user.target"} {
+		if !strings.Contains(unit, want) {
+			t.Fatalf("unit missing %q:\n%s", want, unit)
+		}
+	}
+}
+
+func TestUninstallPlan(t *testing.T) {
+	svc, _ := newTestNginxService(t)
+	for _, path := range []string{svc.ConfDir, svc.LogDir, svc.Prefix, filepath.Dir(svc.Upgrader.SbinPath)} {
+		os.MkdirAll(path, 0755)
+	}
+	os.WriteFile(svc.Upgrader.SbinPath, []byte("bin"), 0755)
+	os.WriteFile(svc.UnitPath, []byte("[Unit]\n"), 0644)
+
+	// 没有安装记录且二进制不属于软件包时按编译安装清理，只列出存在的文件
+	plan, err := svc.UninstallPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{svc.Upgrader.SbinPath, svc.UnitPath, svc.Prefix, svc.ConfDir, svc.LogDir}
+	if plan.Method != "unknown" || !slices.Equal(plan.Files, want) || len(plan.Packages) != 0 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if !slices.Contains(plan.Kept, svc.WebRoot) || !slices.Equal(plan.Services, []string{"nginx"}) {
+		t.Fatalf("web root should be kept: %+v", plan)
+	}
+
+	repoFile := filepath.Join(filepath.Dir(svc.ManifestPath), "nginx.list")
+	os.WriteFile(repoFile, []byte("deb"), 0644)
+	manifest, _ := json.Marshal(model.InstallManifest{Method: model.InstallMethodPackage, Packages: []string{"nginx", "nginx-module-acme"}, Files: []string{repoFile}})
+	os.WriteFile(svc.ManifestPath, manifest, 0600)
+	plan, err = svc.UninstallPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 软件包安装时二进制与单元文件由包管理器移除
+	want = []string{repoFile, svc.ConfDir, svc.LogDir, svc.ManifestPath}
+	if plan.Method != model.InstallMethodPackage || !slices.Equal(plan.Packages, []string{"nginx", "nginx-module-acme"}) || !slices.Equal(plan.Files, want) {
+		t.Fatalf("unexpected package plan: %+v", plan)
+	}
+}
+
+func TestUninstallConfirmToken(t *testing.T) {
+	svc, _ := newTestNginxService(t)
+	now := time.Unix(1700000000, 0)
+	svc.now = func() time.Time { return now }
+	os.MkdirAll(svc.ConfDir, 0755)
+
+	if _, err := svc.Uninstall(""); !errors.Is(err, ErrUninstallNotConfirmed) {
+		t.Fatalf("uninstall without preview should be rejected, got %v", err)
+	}
+	preview, err := svc.PreviewUninstall()
+	if err != nil || len(preview.ConfirmToken) != 32 || preview.ConfirmExpiresUnixTime != now.Add(uninstallConfirmTTL).Unix() {
+		t.Fatalf("unexpected preview: %+v %v", preview, err)
+	}
+	if _, err := os.Stat(svc.ConfDir); err != nil {
+		t.Fatal("preview must not remove anything")
+	}
+	if _, err := svc.Uninstall("wrong"); !errors.Is(err, ErrUninstallNotConfirmed) {
+		t.Fatalf("wrong token should be rejected, got %v", err)
+	}
+
+	plan, _ := svc.UninstallPlan()
+	if err := svc.consumeConfirmToken(preview.ConfirmToken, plan); err != nil {
+		t.Fatal(err)
+	}
+	// 确认码只能使用一次
+	if err := svc.consumeConfirmToken(preview.ConfirmToken, plan); !errors.Is(err, ErrUninstallNotConfirmed) {
+		t.Fatalf("token should be single-use, got %v", err)
+	}
+
+	preview, _ = svc.PreviewUninstall()
+	now = now.Add(uninstallConfirmTTL + time.Second)
+	if err := svc.consumeConfirmToken(preview.ConfirmToken, plan); !errors.Is(err, ErrUninstallNotConfirmed) {
+		t.Fatalf("expired token should be rejected, got %v", err)
+	}
+
+	// 预览后新出现的文件不能被同一个确认码删除
+	preview, _ = svc.PreviewUninstall()
+	os.MkdirAll(svc.LogDir, 0755)
+	if _, err := svc.Uninstall(preview.ConfirmToken); !errors.Is(err, ErrUninstallPlanChanged) {
+		t.Fatalf("changed plan should be rejected, got %v", err)
+	}
+	if _, err := os.Stat(svc.LogDir); err != nil {
+		t.Fatal("rejected uninstall must not remove anything")
+	}
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"nginx-mgr/internal/model"
+	"nginx-mgr/internal/nginxconf"
+)
+
+var ErrInvalidInstallRequest = errors.New("安装参数无效")
+
+const (
+	nginxOrgSigningKey = "https://nginx.org/keys/nginx_signing.key"
+	nginxOrgKeyring    = "/usr/share/keyrings/nginx-archive-keyring.gpg"
+	// nginxACMEConf ngx_http_acme 的签发配置，放在 conf.d 中由 http 块引入
+	nginxACMEConf = "acme.conf"
+)
+
+// NormalizeInstallRequest 校验安装方式并补全默认值
+func NormalizeInstallRequest(req model.InstallRequest) (model.InstallRequest, error) {
+	req.Method = strings.ToLower(strings.TrimSpace(req.Method))
+	req.Source = strings.ToLower(strings.TrimSpace(req.Source))
+	switch req.Method {
+	case "", model.InstallMethodSource, "script":
+		// script 为早期通过第三方脚本安装时的名称，现在同样由面板编译安装
+		if req.Source != "" {
+			return req, fmt.Errorf("%w: source 仅适用于 package 安装方式", ErrInvalidInstallRequest)
+		}
+		req.Method = model.InstallMethodSource
+	case model.InstallMethodPackage:
+		if req.Version != "" || len(req.Modules) > 0 {
+			return req, fmt.Errorf("%w: version 与 modules 仅适用于 source 安装方式，软件包方式请通过包管理器安装模块", ErrInvalidInstallRequest)
+		}
+		switch req.Source {
+		case "":
+			req.Source = model.InstallSourceDistro
+		case model.InstallSourceDistro, model.InstallSourceNginxOrg:
+		default:
+			return req, fmt.Errorf("%w: source 仅支持 distro 或 nginx.org", ErrInvalidInstallRequest)
+		}
+	default:
+		return req, fmt.Errorf("%w: method 仅支持 source 或 package", ErrInvalidInstallRequest)
+	}
+	if req.Method == model.InstallMethodSource {
+		version, ok := normalizeNginxVersion(req.Version)
+		if !ok {
+			return req, fmt.Errorf("%w: 版本号格式应为 1.28.0", ErrInvalidInstallRequest)
+		}
+		req.Version = version
+		// 站点模板使用 acme_certificate 申请证书，编译安装始终包含 ACME 模块
+		modules, err := sanitizeBuildModules(append([]string{"acme"}, req.Modules...))
+		if err != nil {
+			return req, fmt.Errorf("%w: %v", ErrInvalidInstallRequest, err)
+		}
+		req.Modules = modules
+	}
+	req.ArtifactDir = strings.TrimSpace(req.ArtifactDir)
+	if req.ArtifactDir != "" {
+		req.Offline = true
+		if !filepath.IsAbs(req.ArtifactDir) {
+			return req, fmt.Errorf("%w: artifact_dir 必须是绝对路径", ErrInvalidInstallRequest)
+		}
+		req.ArtifactDir = filepath.Clean(req.ArtifactDir)
+	} else if req.Offline {
+		req.ArtifactDir = offlineArtifactDir
+	}
+	return req, nil
+}
+
+// detectPackageManager 按 apt-get、dnf、yum 的顺序查找可用的包管理器
+func detectPackageManager(lookPath func(string) (string, error)) (string, error) {
+	for _, name := range []string{"apt-get", "dnf", "yum"} {
+		if _, err := lookPath(name); err == nil {
+			return name, nil
+		}
+	}
+	return "", errors.New("未找到 apt-get、dnf 或 yum，无法通过软件包安装")
+}
+
+// packageInstallScript 生成软件包安装脚本。发行版源另装 stream 动态模块；
+// nginx.org 源先导入签名密钥并写入软件源，同时安装 ACME 模块
+func packageInstallScript(manager, source string, osRelease map[string]string) (string, error) {
+	var b strings.Builder
+	b.WriteString("set -euo pipefail\n")
+	switch manager {
+	case "apt-get":
+		b.WriteString("export DEBIAN_FRONTEND=noninteractive\n")
+		b.WriteString("apt-get update\n")
+		if source == model.InstallSourceDistro {
+			b.WriteString("apt-get install -y nginx libnginx-mod-stream\n")
+			break
+		}
+		distro, err := nginxOrgAptDistro(osRelease)
+		if err != nil {
+			return "", err
+		}
+		codename := osRelease["VERSION_CODENAME"]
+		if codename == "" {
+			return "", errors.New("os-release 中缺少 VERSION_CODENAME，无法配置 nginx.org 软件源")
+		}
+		b.WriteString("apt-get install -y curl gnupg2 ca-certificates\n")
+		fmt.Fprintf(&b, "curl -fsSL %s | gpg --dearmor --yes -o %s\n", nginxOrgSigningKey, nginxOrgKeyring)
+		fmt.Fprintf(&b, "echo 'deb [signed-by=%s] http://nginx.org/packages/%s %s nginx' > /etc/apt/sources.list.d/nginx.list\n", nginxOrgKeyring, distro, codename)
+		// 优先使用 nginx.org 的软件包，避免被发行版的同名包覆盖
+		b.WriteString("printf 'Package: *\\nPin: origin nginx.org\\nPin: release o=nginx\\nPin-Priority: 900\\n' > /etc/apt/preferences.d/99nginx\n")
+		b.WriteString("apt-get update\n")
+		b.WriteString("apt-get install -y nginx nginx-module-acme\n")
+	case "dnf", "yum":
+		if source == model.InstallSourceDistro {
+			fmt.Fprintf(&b, "%s install -y nginx nginx-mod-stream\n", manager)
+			break
+		}
+		b.WriteString("cat > /etc/yum.repos.d/nginx.repo <<'EOF'\n")
+		b.WriteString("[nginx-stable]\nname=nginx stable repo\nbaseurl=http://nginx.org/packages/centos/$releasever/$basearch/\n")
+		fmt.Fprintf(&b, "gpgcheck=1\nenabled=1\ngpgkey=%s\nmodule_hotfixes=true\n", nginxOrgSigningKey)
+		b.WriteString("EOF\n")
+		fmt.Fprintf(&b, "%s install -y nginx nginx-module-acme\n", manager)
+	default:
+		return "", fmt.Errorf("不支持的包管理器: %s", manager)
+	}
+	b.WriteString("systemctl enable --now nginx\n")
+	return b.String(), nil
+}
+
+// offlinePackageScript 生成离线安装脚本，只安装目录中的软件包，缺少依赖时由 dpkg/rpm 直接报错
+func offlinePackageScript(manager string, packages []string) (string, error) {
+	quoted := make([]string, len(packages))
+	for i, path := range packages {
+		quoted[i] = shellQuote(path)
+	}
+	var b strings.Builder
+	b.WriteString("set -euo pipefail\n")
+	switch manager {
+	case "apt-get":
+		fmt.Fprintf(&b, "dpkg -i %s\n", strings.Join(quoted, " "))
+	case "dnf", "yum":
+		fmt.Fprintf(&b, "%s install -y --disablerepo='*' %s\n", manager, strings.Join(quoted, " "))
+	default:
+		return "", fmt.Errorf("不支持的包管理器: %s", manager)
+	}
+	b.WriteString("systemctl enable --now nginx\n")
+	return b.String(), nil
+}
+
+// nginxOrgAptDistro 返回 nginx.org 软件源路径中的发行版名，衍生发行版按 ID_LIKE 判断
+func nginxOrgAptDistro(osRelease map[string]string) (string, error) {
+	candidates := append([]string{osRelease["ID"]}, strings.Fields(osRelease["ID_LIKE"])...)
+	for _, id := range candidates {
+		if id == "ubuntu" || id == "debian" {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("nginx.org 软件源不支持当前系统 %q", osRelease["ID"])
+}
+
+// bootstrapPackageLayout 为软件包安装的 Nginx 补齐面板使用的目录结构：
+// http 块引入 sites-enabled 并定义站点日志使用的 main 格式，顶层 stream 块引入 streams-enabled；acme 为 true 时加载 ACME 模块
+func bootstrapPackageLayout(confDir, webRoot string, acme bool) error {
+	dirs := []string{
+		filepath.Join(confDir, "sites-available"),
+		filepath.Join(confDir, "sites-enabled"),
+		filepath.Join(confDir, "streams-available"),
+		filepath.Join(confDir, "streams-enabled"),
+		filepath.Join(confDir, "conf.d"),
+		webRoot,
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建目录 %s 失败: %w", dir, err)
+		}
+	}
+
+	confPath := filepath.Join(confDir, "nginx.conf")
+	data, err := os.ReadFile(confPath)
+	if err != nil {
+		return fmt.Errorf("读取 nginx.conf 失败: %w", err)
+	}
+	content, err := addLayoutIncludes(string(data), confDir, acme)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(confPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("写入 nginx.conf 失败: %w", err)
+	}
+	return nil
+}
+
+// writeACMEConf 写入 ngx_http_acme 的签发配置，证书保存在 stateDir，与仪表盘和面板 HTTPS 读取的目录一致
+func writeACMEConf(confDir, stateDir string) error {
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return err
+	}
+	acmeConf := fmt.Sprintf(`# 由 nginx-mgr 生成：ngx_http_acme 模块的证书签发配置
+resolver 1.1.1.1 8.8.8.8 valid=300s ipv6=off;
+
+acme_issuer letsencrypt {
+    uri https://acme-v02.api.letsencrypt.org/directory;
+    state_path %s;
+    accept_terms_of_service;
+}
+`, stateDir)
+	return os.WriteFile(filepath.Join(confDir, "conf.d", nginxACMEConf), []byte(acmeConf), 0644)
+}
+
+// mainLogFormat 与 nginx.org 默认配置相同的 main 日志格式
+const mainLogFormat = `    log_format main '$remote_addr - $remote_user [$time_local] "$request" '
+                    '$status $body_bytes_sent "$http_referer" '
+                    '"$http_user_agent" "$http_x_forwarded_for"';
+`
+
+// addLayoutIncludes 在 nginx.conf 中补充 sites-enabled 与 streams-enabled 的 include 及 main 日志格式，已存在的不重复添加。
+// sites-enabled 紧跟 http 块的开始行，stream 块不存在时追加到文件末尾
+func addLayoutIncludes(content, confDir string, acme bool) (string, error) {
+	tree, err := nginxconf.Parse(content)
+	if err != nil {
+		return "", fmt.Errorf("解析 nginx.conf 失败: %w", err)
+	}
+	lines := strings.Split(content, "\n")
+	hasInclude := func(block *nginxconf.Directive, anchor string) bool {
+		for _, d := range nginxconf.Find(block.Block, "include") {
+			if strings.Contains(d.Arg(0), anchor) {
+				return true
+			}
+		}
+		return false
+	}
+	// 先算出插入位置（块开始行之后），再自下而上插入，避免先插入的行影响后面的行号
+	inserts := map[int]string{}
+	http := nginxconf.First(tree, "http")
+	if http == nil {
+		return "", errors.New("nginx.conf 中未找到 http 块")
+	}
+	var httpLines []string
+	// 站点模板的 access_log 使用 main 格式，Debian 系的 nginx.conf 没有定义它；需写在 include 之前
+	hasMain := false
+	for _, d := range nginxconf.Find(http.Block, "log_format") {
+		if d.Arg(0) == "main" {
+			hasMain = true
+		}
+	}
+	if !hasMain {
+		httpLines = append(httpLines, strings.Split(strings.TrimSuffix(mainLogFormat, "\n"), "\n")...)
+	}
+	if !hasInclude(http, "sites-enabled") {
+		httpLines = append(httpLines, fmt.Sprintf("    include %s/*;", filepath.Join(confDir, "sites-enabled")))
+	}
+	if len(httpLines) > 0 {
+		open, ok := blockOpenLine(lines, http.Line)
+		if !ok {
+			return "", errors.New("nginx.conf 中 http 块的 { 后还有其他内容，无法自动引入 sites-enabled")
+		}
+		inserts[open] = strings.Join(httpLines, "\n")
+	}
+	stream := nginxconf.First(tree, "stream")
+	streamInclude := fmt.Sprintf("include %s/*;", filepath.Join(confDir, "streams-enabled"))
+	if stream != nil && !hasInclude(stream, "streams-enabled") {
+		open, ok := blockOpenLine(lines, stream.Line)
+		if !ok {
+			return "", errors.New("nginx.conf 中 stream 块的 { 后还有其他内容，无法自动引入 streams-enabled")
+		}
+		inserts[open] = "    " + streamInclude
+	}
+	for line := len(lines); line > 0; line-- {
+		if text, ok := inserts[line]; ok {
+			lines = append(lines[:line], append([]string{text}, lines[line:]...)...)
+		}
+	}
+	if stream == nil {
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		lines = append(lines, "", "stream {", "    "+streamInclude, "}", "")
+	}
+
+	if acme {
+		loadModule := "load_module modules/ngx_http_acme_module.so;"
+		loaded := false
+		for _, d := range nginxconf.Find(tree, "load_module") {
+			if strings.Contains(d.Arg(0), "ngx_http_acme_module") {
+				loaded = true
+			}
+		}
+		if !loaded {
+			// load_module 必须出现在所有块之前
+			lines = append([]string{loadModule}, lines...)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
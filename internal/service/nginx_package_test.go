@@ -0,0 +1,211 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nginx-mgr/internal/model"
+	"nginx-mgr/internal/nginxconf"
+)
+
+func TestNormalizeInstallRequest(t *testing.T) {
+	req, err := NormalizeInstallRequest(model.InstallRequest{})
+	if err != nil || req.Method != model.InstallMethodSource || req.Version != model.NginxVersion || strings.Join(req.Modules, ",") != "acme" {
+		t.Fatalf("empty request should default to a source build with acme: %+v %v", req, err)
+	}
+	if req, err = NormalizeInstallRequest(model.InstallRequest{Method: "script"}); err != nil || req.Method != model.InstallMethodSource {
+		t.Fatalf("script should be accepted as an alias of source: %+v %v", req, err)
+	}
+	req, err = NormalizeInstallRequest(model.InstallRequest{Method: "Package"})
+	if err != nil || req.Source != model.InstallSourceDistro {
+		t.Fatalf("package should default to distro source: %+v %v", req, err)
+	}
+	req, err = NormalizeInstallRequest(model.InstallRequest{Version: "v1.29.1", Modules: []string{"njs", "Stream", "njs"}})
+	if err != nil || req.Version != "1.29.1" || strings.Join(req.Modules, ",") != "stream,acme,njs" {
+		t.Fatalf("unexpected build options: %+v %v", req, err)
+	}
+	for _, bad := range []model.InstallRequest{
+		{Method: "docker"},
+		{Method: "package", Source: "ppa"},
+		{Source: "nginx.org"},
+		{Version: "1.28"},
+		{Modules: []string{"pagespeed"}},
+		{Method: "package", Modules: []string{"brotli"}},
+	} {
+		if _, err := NormalizeInstallRequest(bad); !errors.Is(err, ErrInvalidInstallRequest) {
+			t.Fatalf("expected invalid request for %+v, got %v", bad, err)
+		}
+	}
+}
+
+func TestPackageInstallScript(t *testing.T) {
+	mint := map[string]string{"ID": "linuxmint", "ID_LIKE": "ubuntu debian", "VERSION_CODENAME": "noble"}
+	script, err := packageInstallScript("apt-get", model.InstallSourceNginxOrg, mint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script, "http://nginx.org/packages/ubuntu noble nginx") || !strings.Contains(script, "apt-get install -y nginx nginx-module-acme") {
+		t.Fatalf("unexpected apt script:\n%s", script)
+	}
+	if _, err := packageInstallScript("apt-get", model.InstallSourceNginxOrg, map[string]string{"ID": "arch"}); err == nil {
+		t.Fatal("nginx.org apt repo should reject unsupported distributions")
+	}
+
+	script, err = packageInstallScript("dnf", model.InstallSourceDistro, nil)
+	if err != nil || !strings.Contains(script, "dnf install -y nginx nginx-mod-stream") || !strings.HasSuffix(script, "systemctl enable --now nginx\n") {
+		t.Fatalf("unexpected dnf script: %v\n%s", err, script)
+	}
+	script, _ = packageInstallScript("yum", model.InstallSourceNginxOrg, nil)
+	if !strings.Contains(script, "baseurl=http://nginx.org/packages/centos/$releasever/$basearch/") {
+		t.Fatalf("unexpected yum script:\n%s", script)
+	}
+
+	manager, err := detectPackageManager(func(name string) (string, error) {
+		if name == "yum" {
+			return "/usr/bin/yum", nil
+		}
+		return "", errors.New("not found")
+	})
+	if err != nil || manager != "yum" {
+		t.Fatalf("expected yum, got %q %v", manager, err)
+	}
+}
+
+func TestBootstrapPackageLayout(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "nginx")
+	os.MkdirAll(confDir, 0755)
+	debian := `user www-data;
+worker_processes auto;
+include /etc/nginx/modules-enabled/*.conf;
+
+events {
+	worker_connections 768;
+}
+
+http {
+	sendfile on;
+	include /etc/nginx/conf.d/*.conf;
+}
+`
+	confPath := filepath.Join(confDir, "nginx.conf")
+	os.WriteFile(confPath, []byte(debian), 0644)
+
+	webRoot := filepath.Join(dir, "www")
+	if err := bootstrapPackageLayout(confDir, webRoot, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"sites-available", "sites-enabled", "streams-available", "streams-enabled", "conf.d"} {
+		if _, err := os.Stat(filepath.Join(confDir, name)); err != nil {
+			t.Fatalf("%s not created: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(webRoot); err != nil {
+		t.Fatalf("web root not created: %v", err)
+	}
+	data, _ := os.ReadFile(confPath)
+	tree, err := nginxconf.Parse(string(data))
+	if err != nil {
+		t.Fatalf("bootstrapped nginx.conf does not parse: %v\n%s", err, data)
+	}
+	http := nginxconf.First(tree, "http")
+	if include := nginxconf.Find(http.Block, "include"); len(include) != 2 || include[0].Arg(0) != filepath.Join(confDir, "sites-enabled")+"/*" {
+		t.Fatalf("sites-enabled include missing from http block:\n%s", data)
+	}
+	stream := nginxconf.First(tree, "stream")
+	if stream == nil || nginxconf.First(stream.Block, "include").Arg(0) != filepath.Join(confDir, "streams-enabled")+"/*" {
+		t.Fatalf("stream block missing:\n%s", data)
+	}
+
+	// 再次执行不重复添加
+	if err := bootstrapPackageLayout(confDir, webRoot, false); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := os.ReadFile(confPath)
+	if string(again) != string(data) {
+		t.Fatalf("bootstrap is not idempotent:\n%s", again)
+	}
+
+	// stream 块在 http 之前时两处都插入到正确的块中，并在最前面加载 ACME 模块
+	content, err := addLayoutIncludes("stream {\n}\n\nhttp {\n    sendfile on;\n}\n", "/etc/nginx", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "load_module modules/ngx_http_acme_module.so;\nstream {\n    include /etc/nginx/streams-enabled/*;\n}\n\nhttp {\n" +
+		mainLogFormat + "    include /etc/nginx/sites-enabled/*;\n    sendfile on;\n}\n"
+	if content != want {
+		t.Fatalf("unexpected content:\n%s", content)
+	}
+
+	if _, err := addLayoutIncludes("http { sendfile on; }\n", "/etc/nginx", false); err == nil {
+		t.Fatal("single-line http block should be rejected")
+	}
+}
+
+func TestPrepareOfflineInstall(t *testing.T) {
+	dir := t.TempDir()
+	svc := NewNginxService(nil)
+	svc.lookPath = func(name string) (string, error) {
+		if name == "apt-get" {
+			return "/usr/bin/apt-get", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	if _, err := svc.PrepareInstall(model.InstallRequest{Method: "package", ArtifactDir: "relative/dir"}); !errors.Is(err, ErrInvalidInstallRequest) {
+		t.Fatalf("relative artifact dir should be rejected, got %v", err)
+	}
+	req, err := svc.PrepareInstall(model.InstallRequest{Method: "package", Source: "nginx.org", ArtifactDir: dir + "/"})
+	if !errors.Is(err, ErrMissingInstallArtifacts) {
+		t.Fatalf("expected missing artifacts, got %v", err)
+	}
+	if !req.Offline || req.ArtifactDir != dir {
+		t.Fatalf("artifact dir should imply offline: %+v", req)
+	}
+	if !strings.Contains(err.Error(), "nginx*.deb") || !strings.Contains(err.Error(), "nginx-module-acme*.deb") {
+		t.Fatalf("error should list every missing artifact: %v", err)
+	}
+
+	for _, name := range []string{"nginx_1.28.0-1~noble_amd64.deb", "nginx-module-acme_1.28.0+0.1.1-1~noble_amd64.deb", "libpcre2-8-0_10.42_amd64.deb"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("deb"), 0644)
+	}
+	if _, err := svc.PrepareInstall(model.InstallRequest{Method: "package", Source: "nginx.org", ArtifactDir: dir}); err != nil {
+		t.Fatalf("all artifacts present: %v", err)
+	}
+	script, err := offlinePackageScript("apt-get", offlinePackages(dir, "deb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script, "dpkg -i '"+filepath.Join(dir, "libpcre2-8-0_10.42_amd64.deb")+"' ") || strings.Contains(script, "curl") {
+		t.Fatalf("unexpected offline script:\n%s", script)
+	}
+
+	// 卸载时只移除 nginx 相关的软件包，依赖库保留
+	names := offlinePackageNames(append(offlinePackages(dir, "deb"), "/x/nginx-module-acme-1.28.0+0.1.1-1.el9.ngx.x86_64.rpm", "/x/pcre2-10.40-6.el9.x86_64.rpm"))
+	if strings.Join(names, ",") != "nginx-module-acme,nginx,nginx-module-acme" {
+		t.Fatalf("unexpected package names: %v", names)
+	}
+
+	// 编译安装需要源码包与所选模块的源码，ACME 模块始终包含
+	if _, err := svc.PrepareInstall(model.InstallRequest{Offline: true, ArtifactDir: dir, Modules: []string{"brotli"}}); err == nil ||
+		!strings.Contains(err.Error(), "nginx-"+model.NginxVersion+".tar.gz") || !strings.Contains(err.Error(), "nginx-acme.tar.gz") || !strings.Contains(err.Error(), "ngx_brotli.tar.gz") {
+		t.Fatalf("expected missing source archives, got %v", err)
+	}
+	for _, name := range []string{"nginx-" + model.NginxVersion + ".tar.gz", "nginx-acme.tar.gz"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("tgz"), 0644)
+	}
+	if _, err := svc.PrepareInstall(model.InstallRequest{Offline: true, ArtifactDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	if fetch := renderModuleFetchScript("/tmp/build/modules", dir, []string{"acme"}); strings.Contains(fetch, "git clone") {
+		t.Fatalf("offline module fetch should not clone:\n%s", fetch)
+	}
+
+	build := renderNginxBuildScript("/tmp/build", "1.28.0", "--with-http_ssl_module", filepath.Join(dir, "nginx-1.28.0.tar.gz"), "")
+	if strings.Contains(build, "curl") || !strings.Contains(build, "cp '"+filepath.Join(dir, "nginx-1.28.0.tar.gz")+"' nginx-1.28.0.tar.gz") {
+		t.Fatalf("offline build should copy the local tarball:\n%s", build)
+	}
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+const (
+	// clockTicks /proc 中 CPU 时间的单位（USER_HZ），主流 Linux 发行版均为 100
+	clockTicks = 100
+	// processSampleInterval 计算 CPU 占用的采样间隔
+	processSampleInterval = 500 * time.Millisecond
+)
+
+var ErrNginxNotRunning = errors.New("Nginx 未运行")
+
+// NginxProcessService 从 /proc 读取 nginx 各进程的 CPU、内存、运行时长与连接数，用于排查卡死或异常的工作进程
+type NginxProcessService struct {
+	ProcDir string
+	PidFile string
+	Sleep   func(time.Duration)
+}
+
+func NewNginxProcessService() *NginxProcessService {
+	return &NginxProcessService{
+		ProcDir: "/proc",
+		PidFile: filepath.Join(model.NginxPidDir, "nginx.pid"),
+		Sleep:   time.Sleep,
+	}
+}
+
+// procStat /proc/<pid>/stat 中用到的字段
+type procStat struct {
+	comm      string
+	state     string
+	ppid      int
+	cpuTicks  uint64 // utime + stime
+	startTick uint64
+	rssPages  uint64
+}
+
+// readProcStat 解析 /proc/<pid>/stat，comm 可能包含空格与括号，以最后一个 ")" 分隔
+func readProcStat(path string) (procStat, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return procStat{}, err
+	}
+	text := string(data)
+	open, end := strings.IndexByte(text, '('), strings.LastIndexByte(text, ')')
+	if open < 0 || end < open {
+		return procStat{}, errors.New("无法解析 " + path)
+	}
+	// state 为第 3 个字段，之后依次为 ppid、pgrp ...，utime/stime 为第 14、15 个，starttime 为第 22 个，rss 为第 24 个
+	fields := strings.Fields(text[end+1:])
+	if len(fields) < 22 {
+		return procStat{}, errors.New("无法解析 " + path)
+	}
+	stat := procStat{comm: text[open+1 : end], state: fields[0]}
+	stat.ppid, _ = strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	stat.cpuTicks = utime + stime
+	stat.startTick, _ = strconv.ParseUint(fields[19], 10, 64)
+	stat.rssPages, _ = strconv.ParseUint(fields[21], 10, 64)
+	return stat, nil
+}
+
+// nginxPIDs 返回 comm 为 nginx 的全部进程
+func (s *NginxProcessService) nginxPIDs() (map[int]procStat, error) {
+	entries, err := os.ReadDir(s.ProcDir)
+	if err != nil {
+		return nil, err
+	}
+	stats := map[int]procStat{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := readProcStat(filepath.Join(s.ProcDir, entry.Name(), "stat"))
+		if err != nil || stat.comm != "nginx" {
+			continue
+		}
+		stats[pid] = stat
+	}
+	return stats, nil
+}
+
+// bootTime 读取 /proc/stat 中的 btime，用于换算进程启动时间
+func (s *NginxProcessService) bootTime() int64 {
+	file, err := os.Open(filepath.Join(s.ProcDir, "stat"))
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			btime, _ := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			return btime
+		}
+	}
+	return 0
+}
+
+// establishedInodes 读取 /proc/net/tcp 与 tcp6 中处于 ESTABLISHED 状态的套接字 inode
+func (s *NginxProcessService) establishedInodes() map[string]bool {
+	inodes := map[string]bool{}
+	for _, name := range []string{"tcp", "tcp6"} {
+		file, err := os.Open(filepath.Join(s.ProcDir, "net", name))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Scan() // 表头
+		for scanner.Scan() {
+			// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 10 && fields[3] == "01" {
+				inodes[fields[9]] = true
+			}
+		}
+		file.Close()
+	}
+	return inodes
+}
+
+// countConnections 统计进程打开的套接字中处于 ESTABLISHED 状态的数量
+func (s *NginxProcessService) countConnections(pid int, established map[string]bool) int {
+	fdDir := filepath.Join(s.ProcDir, strconv.Itoa(pid), "fd")
+	entries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join(fdDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if inode, ok := strings.CutPrefix(target, "socket:["); ok && established[strings.TrimSuffix(inode, "]")] {
+			count++
+		}
+	}
+	return count
+}
+
+// processRole 从 cmdline（如 "nginx: worker process is shutting down"）判断进程角色
+func processRole(cmdline string) (role string, shuttingDown bool) {
+	cmdline = strings.TrimSpace(strings.ReplaceAll(cmdline, "\x00", " "))
+	shuttingDown = strings.HasSuffix(cmdline, "is shutting down")
+	switch {
+	case strings.Contains(cmdline, "master process"):
+		return "master", shuttingDown
+	case strings.Contains(cmdline, "cache manager"):
+		return "cache manager", shuttingDown
+	case strings.Contains(cmdline, "cache loader"):
+		return "cache loader", shuttingDown
+	default:
+		return "worker", shuttingDown
+	}
+}
+
+// Processes 采样两次 /proc 计算 CPU 占用，返回全部 nginx 进程，主进程在前、其余按 PID 排序
+func (s *NginxProcessService) Processes() (*model.NginxProcesses, error) {
+	before, err := s.nginxPIDs()
+	if err != nil {
+		return nil, err
+	}
+	if len(before) == 0 {
+		return nil, ErrNginxNotRunning
+	}
+	start := time.Now()
+	s.Sleep(processSampleInterval)
+	after, err := s.nginxPIDs()
+	if err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start).Seconds()
+	now := time.Now()
+	btime := s.bootTime()
+	established := s.establishedInodes()
+	pageSize := uint64(os.Getpagesize())
+
+	result := &model.NginxProcesses{Processes: []model.NginxProcessInfo{}, SampledUnixTime: now.Unix()}
+	if data, err := os.ReadFile(s.PidFile); err == nil {
+		result.MasterPID, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	for pid, stat := range after {
+		info := model.NginxProcessInfo{PID: pid, PPID: stat.ppid, State: stat.state, RSSBytes: stat.rssPages * pageSize}
+		cmdline, _ := os.ReadFile(filepath.Join(s.ProcDir, strconv.Itoa(pid), "cmdline"))
+		info.Role, info.ShuttingDown = processRole(string(cmdline))
+		if prev, ok := before[pid]; ok && elapsed > 0 && stat.cpuTicks >= prev.cpuTicks {
+			info.CPUPercent = float64(stat.cpuTicks-prev.cpuTicks) / clockTicks / elapsed * 100
+		}
+		if btime > 0 {
+			info.UptimeSeconds = max(now.Unix()-btime-int64(stat.startTick/clockTicks), 0)
+		}
+		info.Connections = s.countConnections(pid, established)
+		result.TotalConnections += info.Connections
+		result.Processes = append(result.Processes, info)
+	}
+	sort.Slice(result.Processes, func(i, j int) bool {
+		a, b := result.Processes[i], result.Processes[j]
+		if (a.Role == "master") != (b.Role == "master") {
+			return a.Role == "master"
+		}
+		return a.PID < b.PID
+	})
+	return result, nil
+}
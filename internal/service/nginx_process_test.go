@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFakeProc(t *testing.T, procDir string, pid, ppid int, comm, cmdline string, cpuTicks int, sockets ...string) {
+	t.Helper()
+	dir := filepath.Join(procDir, fmt.Sprint(pid))
+	if err := os.MkdirAll(filepath.Join(dir, "fd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// utime 为第 14 个字段，starttime 为第 22 个，rss 为第 24 个
+	stat := fmt.Sprintf("%d (%s) S %d %d %d 0 -1 4194624 100 0 0 0 %d 0 0 0 20 0 1 0 1000 10000000 256 18446744073709551615\n",
+		pid, comm, ppid, pid, pid, cpuTicks)
+	if err := os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cmdline"), []byte(cmdline+"\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i, socket := range sockets {
+		if err := os.Symlink(socket, filepath.Join(dir, "fd", fmt.Sprint(i+3))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNginxProcesses(t *testing.T) {
+	procDir := t.TempDir()
+	svc := &NginxProcessService{ProcDir: procDir, PidFile: filepath.Join(procDir, "nginx.pid"), Sleep: func(time.Duration) {}}
+	if _, err := svc.Processes(); !errors.Is(err, ErrNginxNotRunning) {
+		t.Fatalf("expected not running, got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(procDir, "nginx.pid"), []byte("100\n"), 0644)
+	os.WriteFile(filepath.Join(procDir, "stat"), []byte("cpu  1 2 3 4\nbtime 1700000000\n"), 0644)
+	os.MkdirAll(filepath.Join(procDir, "net"), 0755)
+	tcp := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+		"   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 111 1\n" +
+		"   1: 0100007F:0050 0100007F:D431 01 00000000:00000000 00:00000000 00000000    33        0 222 1\n" +
+		"   2: 0100007F:0050 0100007F:D432 01 00000000:00000000 00:00000000 00000000    33        0 333 1\n"
+	os.WriteFile(filepath.Join(procDir, "net", "tcp"), []byte(tcp), 0644)
+
+	writeFakeProc(t, procDir, 100, 1, "nginx", "nginx: master process /usr/sbin/nginx", 5, "socket:[111]")
+	writeFakeProc(t, procDir, 102, 100, "nginx", "nginx: worker process", 10, "socket:[111]", "socket:[222]", "socket:[333]", "/dev/null")
+	writeFakeProc(t, procDir, 101, 100, "nginx", "nginx: worker process is shutting down", 0)
+	writeFakeProc(t, procDir, 200, 1, "sshd", "sshd: root", 0)
+
+	result, err := svc.Processes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MasterPID != 100 || len(result.Processes) != 3 || result.TotalConnections != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	master, shutting, worker := result.Processes[0], result.Processes[1], result.Processes[2]
+	if master.PID != 100 || master.Role != "master" || master.Connections != 0 {
+		t.Fatalf("unexpected master: %+v", master)
+	}
+	if shutting.PID != 101 || shutting.Role != "worker" || !shutting.ShuttingDown {
+		t.Fatalf("unexpected shutting down worker: %+v", shutting)
+	}
+	if worker.PID != 102 || worker.PPID != 100 || worker.Connections != 2 || worker.State != "S" || worker.RSSBytes != 256*uint64(os.Getpagesize()) {
+		t.Fatalf("unexpected worker: %+v", worker)
+	}
+	if worker.UptimeSeconds <= 0 {
+		t.Fatalf("expected uptime, got %+v", worker)
+	}
+}
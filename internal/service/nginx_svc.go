@@ -6,20 +6,69 @@ import (
 	"nginx-mgr/internal/executor"
 	"nginx-mgr/internal/model"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
+// NginxService 安装与卸载 Nginx。编译安装与之后的升级共用 Upgrader 的编译目录、模块目录与编译配置
 type NginxService struct {
 	InstallStatus *executor.TaskStatus
+	ConfDir       string
+	WebRoot       string
+	Prefix        string
+	LogDir        string
+	CacheDir      string
+	UnitPath      string
+	ManifestPath  string
+	OSReleasePath string
+	Upgrader      *NginxUpgrader
+	lookPath      func(file string) (string, error)
+
+	mu      sync.Mutex
+	confirm uninstallConfirm
+	now     func() time.Time
 }
 
-func NewNginxService() *NginxService {
+func NewNginxService(upgrader *NginxUpgrader) *NginxService {
+	if upgrader == nil {
+		upgrader = NewNginxUpgrader()
+	}
 	return &NginxService{
 		InstallStatus: &executor.TaskStatus{ID: "install"},
+		Upgrader:      upgrader,
+		ConfDir:       model.NginxConfDir,
+		WebRoot:       defaultWebRoot,
+		Prefix:        model.NginxPrefix,
+		LogDir:        model.NginxLogDir,
+		CacheDir:      model.NginxCacheDir,
+		UnitPath:      nginxUnitPath,
+		ManifestPath:  nginxInstallManifestPath,
+		OSReleasePath: "/etc/os-release",
+		lookPath:      exec.LookPath,
+		now:           time.Now,
+	}
+}
+
+// PrepareInstall 校验安装参数；离线安装时检查离线目录中的文件，缺少时列出全部缺少的文件
+func (s *NginxService) PrepareInstall(req model.InstallRequest) (model.InstallRequest, error) {
+	req, err := NormalizeInstallRequest(req)
+	if err != nil || !req.Offline {
+		return req, err
 	}
+	var manager string
+	if req.Method == model.InstallMethodPackage {
+		if manager, err = detectPackageManager(s.lookPath); err != nil {
+			return req, fmt.Errorf("%w: %v", ErrInvalidInstallRequest, err)
+		}
+	}
+	return req, checkArtifacts(req.ArtifactDir, installArtifacts(req, manager))
 }
 
-func (s *NginxService) FullInstall(ctx context.Context) {
+// FullInstall 按 req 指定的方式安装 Nginx，req 需先经过 PrepareInstall
+func (s *NginxService) FullInstall(ctx context.Context, req model.InstallRequest) {
 	status := &executor.TaskStatus{ID: "install"}
 	s.InstallStatus = status
 
@@ -29,13 +78,94 @@ func (s *NginxService) FullInstall(ctx context.Context) {
 		return
 	}
 
-	status.AddLog(">>> 下载并执行 nginx-acme 安装脚本 (菜单 1)")
-	cmd := buildAcmeScriptCommand([]string{"1", "", "0"})
-	if err := executor.ExecuteCommand(ctx, status, "bash", "-c", cmd); err != nil {
-		status.AddLog(fmt.Sprintf("!!! 错误: 安装脚本执行失败: %v", err))
+	if req.Method == model.InstallMethodPackage {
+		if err := s.installPackage(ctx, status, req); err != nil {
+			status.AddLog(fmt.Sprintf("!!! 错误: %v", err))
+			return
+		}
+	} else if err := s.installSource(ctx, status, req); err != nil {
+		status.AddLog(fmt.Sprintf("!!! 错误: %v", err))
 		return
 	}
-	status.AddLog("=== Nginx 安装脚本执行完成 ===")
+
+	status.AddLog(">>> 配置本机 stub_status 状态页")
+	if err := enableStubStatus(NewStubStatusService()); err != nil {
+		status.AddLog(fmt.Sprintf("!!! 警告: 配置 stub_status 失败，可稍后在面板中重试: %v", err))
+		return
+	}
+	status.AddLog(fmt.Sprintf("stub_status 已监听 %s", stubStatusListen))
+}
+
+// installPackage 通过包管理器安装 Nginx，再补齐面板使用的目录结构并重启使其生效
+func (s *NginxService) installPackage(ctx context.Context, status *executor.TaskStatus, req model.InstallRequest) error {
+	manager, err := detectPackageManager(s.lookPath)
+	if err != nil {
+		return err
+	}
+	var script string
+	manifest := model.InstallManifest{Method: model.InstallMethodPackage, Source: req.Source}
+	if req.Offline {
+		if err := checkArtifacts(req.ArtifactDir, installArtifacts(req, manager)); err != nil {
+			return err
+		}
+		ext := "rpm"
+		if manager == "apt-get" {
+			ext = "deb"
+		}
+		packages := offlinePackages(req.ArtifactDir, ext)
+		script, err = offlinePackageScript(manager, packages)
+		manifest.Packages = offlinePackageNames(packages)
+		status.AddLog(fmt.Sprintf(">>> 离线安装 %s 中的 %d 个软件包", req.ArtifactDir, len(packages)))
+	} else {
+		script, err = packageInstallScript(manager, req.Source, readOSReleaseFields(s.OSReleasePath))
+		manifest.Packages, manifest.Files = packageInstallFootprint(manager, req.Source)
+		status.AddLog(fmt.Sprintf(">>> 通过 %s 安装 Nginx（软件源: %s）", manager, req.Source))
+	}
+	if err != nil {
+		return err
+	}
+	if err := executor.ExecuteCommand(ctx, status, "bash", "-c", script); err != nil {
+		return fmt.Errorf("软件包安装失败: %v", err)
+	}
+	s.recordInstall(status, manifest)
+
+	acme := req.Source == model.InstallSourceNginxOrg
+	status.AddLog(">>> 创建 sites-available、streams-available 等目录并在 nginx.conf 中引入")
+	if err := bootstrapPackageLayout(s.ConfDir, s.WebRoot, acme); err != nil {
+		return fmt.Errorf("初始化目录结构失败: %v", err)
+	}
+	if acme {
+		if err := writeACMEConf(s.ConfDir, filepath.Join(s.Prefix, "acme_letsencrypt")); err != nil {
+			return fmt.Errorf("写入 ACME 配置失败: %v", err)
+		}
+	}
+	if out, err := executor.ExecuteSimple(model.NginxSbinPath, "-t"); err != nil {
+		return fmt.Errorf("配置验证失败: %s", strings.TrimSpace(out))
+	}
+	if out, err := executor.ExecuteSimple("systemctl", "restart", "nginx"); err != nil {
+		return fmt.Errorf("重启 Nginx 失败: %s", strings.TrimSpace(out))
+	}
+	if !acme {
+		status.AddLog("提示: 发行版软件包不包含 ACME 模块，站点无法自动申请 HTTPS 证书；需要时请改用 nginx.org 软件源安装")
+	}
+	status.AddLog("=== Nginx 软件包安装完成 ===")
+	return nil
+}
+
+// enableStubStatus 写入 stub_status 配置并重载 Nginx，失败时回滚
+func enableStubStatus(stub *StubStatusService) error {
+	prev, err := stub.Enable()
+	if err != nil {
+		return err
+	}
+	if out, err := executor.ExecuteSimple(model.NginxSbinPath, "-t"); err != nil {
+		_ = stub.RestoreConf(prev)
+		return fmt.Errorf("配置验证失败: %s", strings.TrimSpace(out))
+	}
+	if _, err := executor.ExecuteSimple("systemctl", "reload", "nginx"); err != nil {
+		return fmt.Errorf("重载 Nginx 失败: %w", err)
+	}
+	return nil
 }
 
 func isNginxInstalled() bool {
@@ -56,3 +186,21 @@ func isNginxInstalled() bool {
 	}
 	return true
 }
+
+// nginxHasModule 检查 nginx -V 的编译参数中是否包含指定模块
+func nginxHasModule(keyword string) bool {
+	out, err := executor.ExecuteSimple(model.NginxSbinPath, "-V")
+	if err != nil {
+		return false
+	}
+	return strings.Contains(out, keyword)
+}
+
+// brotliAvailable 编译参数中包含 brotli（编译安装），或 modules-enabled 中加载了 brotli 模块（软件包安装）
+func brotliAvailable(confDir string) bool {
+	if nginxHasModule("brotli") {
+		return true
+	}
+	matches, _ := filepath.Glob(filepath.Join(confDir, "modules-enabled", "*brotli*"))
+	return len(matches) > 0
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+)
+
+const (
+	installMethodUnknown = "unknown"
+	// uninstallConfirmTTL 预览卸载计划后确认码的有效期
+	uninstallConfirmTTL = 10 * time.Minute
+)
+
+var (
+	ErrUninstallNotConfirmed = errors.New("卸载确认码无效或已过期，请先预览卸载计划")
+	ErrUninstallPlanChanged  = errors.New("预览后卸载计划已变化，请重新预览并确认")
+)
+
+// uninstallConfirm 最近一次预览发放的确认码，以及预览时计划的内容，用于确认时比对
+type uninstallConfirm struct {
+	token       string
+	expires     time.Time
+	fingerprint string
+}
+
+// UninstallPlan 按安装记录列出卸载时会停止的服务、移除的软件包与删除的文件。
+// 没有安装记录时（例如旧版面板安装）按 /usr/sbin/nginx 所属的软件包判断，不属于任何软件包时视为编译安装
+func (s *NginxService) UninstallPlan() (model.UninstallPlan, error) {
+	manifest, err := loadInstallManifest(s.ManifestPath)
+	if err != nil {
+		return model.UninstallPlan{}, err
+	}
+	plan := model.UninstallPlan{
+		Method:   installMethodUnknown,
+		Services: []string{"nginx"},
+		Packages: []string{},
+		Kept:     []string{s.WebRoot, localBackupDir},
+	}
+	if manifest != nil {
+		plan.Method = manifest.Method
+	} else if owner := s.sbinOwner(); owner != "" {
+		plan.Method = model.InstallMethodPackage
+		manifest = &model.InstallManifest{Packages: []string{owner}}
+	}
+
+	var files []string
+	if plan.Method == model.InstallMethodPackage {
+		plan.Packages = append(plan.Packages, manifest.Packages...)
+		files = append(files, manifest.Files...)
+		files = append(files, s.ConfDir, s.LogDir, s.CacheDir, filepath.Join(s.Prefix, "acme_letsencrypt"))
+	} else {
+		u := s.Upgrader
+		files = append(files, u.SbinPath, u.SbinPath+".bak", s.UnitPath, s.Prefix, s.ConfDir, s.LogDir, s.CacheDir, u.BuildDir)
+	}
+	files = append(files, s.Upgrader.ProfilePath, s.ManifestPath)
+
+	plan.Files = []string{}
+	seen := make(map[string]bool)
+	for _, path := range files {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if _, err := os.Lstat(path); err == nil {
+			plan.Files = append(plan.Files, path)
+		}
+	}
+	return plan, nil
+}
+
+// sbinOwner 返回 nginx 二进制所属的软件包，不属于软件包或无法判断时返回空字符串
+func (s *NginxService) sbinOwner() string {
+	manager, err := detectPackageManager(s.lookPath)
+	if err != nil {
+		return ""
+	}
+	if manager == "apt-get" {
+		// 输出形如 nginx-core: /usr/sbin/nginx
+		out, err := executor.ExecuteSimple("dpkg-query", "-S", s.Upgrader.SbinPath)
+		if err != nil {
+			return ""
+		}
+		name, _, _ := strings.Cut(strings.TrimSpace(out), ":")
+		return name
+	}
+	out, err := executor.ExecuteSimple("rpm", "-qf", "--qf", "%{NAME}", s.Upgrader.SbinPath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// PreviewUninstall 返回卸载计划并发放一次性确认码，只读取文件不做任何改动。再次预览时旧确认码失效
+func (s *NginxService) PreviewUninstall() (model.UninstallPlan, error) {
+	plan, err := s.UninstallPlan()
+	if err != nil {
+		return plan, err
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return plan, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.confirm = uninstallConfirm{
+		token:       hex.EncodeToString(raw),
+		expires:     s.now().Add(uninstallConfirmTTL),
+		fingerprint: uninstallFingerprint(plan),
+	}
+	plan.ConfirmToken = s.confirm.token
+	plan.ConfirmExpiresUnixTime = s.confirm.expires.Unix()
+	return plan, nil
+}
+
+// consumeConfirmToken 校验确认码并作废，确认码只能使用一次；plan 与预览时不同时拒绝执行，
+// 避免预览后新装的软件包或写入的文件被一并删除
+func (s *NginxService) consumeConfirmToken(token string, plan model.UninstallPlan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	confirm := s.confirm
+	if confirm.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(confirm.token)) != 1 {
+		return ErrUninstallNotConfirmed
+	}
+	s.confirm = uninstallConfirm{}
+	if s.now().After(confirm.expires) {
+		return ErrUninstallNotConfirmed
+	}
+	if uninstallFingerprint(plan) != confirm.fingerprint {
+		return ErrUninstallPlanChanged
+	}
+	return nil
+}
+
+func uninstallFingerprint(plan model.UninstallPlan) string {
+	parts := [][]string{{plan.Method}, plan.Services, plan.Packages, plan.Files}
+	var b strings.Builder
+	for _, part := range parts {
+		b.WriteString(strings.Join(part, "\x00"))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Uninstall 校验预览时发放的确认码后停止并禁用 Nginx，移除软件包并删除 UninstallPlan 列出的文件；网站目录与本地备份保留
+func (s *NginxService) Uninstall(token string) (model.UninstallPlan, error) {
+	plan, err := s.UninstallPlan()
+	if err != nil {
+		return plan, err
+	}
+	if err := s.consumeConfirmToken(token, plan); err != nil {
+		return plan, err
+	}
+	// 单元文件可能已不存在，停止失败不影响后续清理
+	for _, service := range plan.Services {
+		_, _ = executor.ExecuteSimple("systemctl", "disable", "--now", service)
+	}
+
+	var errs []error
+	if len(plan.Packages) > 0 {
+		manager, err := detectPackageManager(s.lookPath)
+		if err != nil {
+			return plan, err
+		}
+		args := append([]string{"remove", "-y"}, plan.Packages...)
+		if manager == "apt-get" {
+			args = append([]string{"purge", "-y"}, plan.Packages...)
+		}
+		if out, err := executor.ExecuteSimple(manager, args...); err != nil {
+			errs = append(errs, fmt.Errorf("移除软件包失败: %s", strings.TrimSpace(out)))
+		}
+	}
+	for _, path := range plan.Files {
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, fmt.Errorf("删除 %s 失败: %w", path, err))
+		}
+	}
+	if out, err := executor.ExecuteSimple("systemctl", "daemon-reload"); err != nil {
+		errs = append(errs, fmt.Errorf("systemctl daemon-reload 失败: %s", strings.TrimSpace(out)))
+	}
+	return plan, errors.Join(errs...)
+}
@@ -0,0 +1,421 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+)
+
+const (
+	nginxUpgradeHot     = "hot"
+	nginxUpgradeRestart = "restart"
+	nginxUpgradeTimeout = 60 * time.Minute
+	// nginxSwapWait 平滑切换时等待新主进程写出 pid 文件、旧进程退出的最长时间
+	nginxSwapWait = 15 * time.Second
+)
+
+var (
+	ErrInvalidNginxUpgrade = errors.New("升级参数无效")
+	ErrNginxUpgradeBusy    = errors.New("已有升级任务正在运行")
+)
+
+var (
+	nginxVersionPattern   = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+	nginxVersionOutput    = regexp.MustCompile(`nginx/(\d+\.\d+\.\d+)`)
+	nginxConfigurePattern = regexp.MustCompile(`(?m)^configure arguments:(.*)$`)
+)
+
+// NginxUpgrader 按当前二进制的编译参数编译新版本 Nginx 并替换 /usr/sbin/nginx。
+// 默认通过 USR2/WINCH/QUIT 平滑切换主进程，也可直接 systemctl restart；
+// 新版本配置测试、启动或版本校验失败时恢复原二进制，已在运行的旧进程继续提供服务
+type NginxUpgrader struct {
+	SbinPath string
+	PidFile  string
+	BuildDir string
+	// ArtifactDir 中有 nginx-<version>.tar.gz 时使用该源码包，不从 nginx.org 下载
+	ArtifactDir string
+	ConfDir     string
+	// ModulesDir 面板编译的动态模块按版本存放在其子目录中
+	ModulesDir  string
+	ProfilePath string
+
+	run    func(name string, args ...string) (string, error)
+	build  func(ctx context.Context, task *executor.TaskStatus, script string) error
+	signal func(pid int, sig syscall.Signal) error
+	wait   time.Duration
+
+	running sync.Mutex
+	mu      sync.Mutex
+	status  model.NginxUpgradeStatus
+	task    *executor.TaskStatus
+}
+
+func NewNginxUpgrader() *NginxUpgrader {
+	return &NginxUpgrader{
+		SbinPath:    model.NginxSbinPath,
+		PidFile:     filepath.Join(model.NginxPidDir, "nginx.pid"),
+		BuildDir:    model.BuildDir,
+		ArtifactDir: offlineArtifactDir,
+		ConfDir:     model.NginxConfDir,
+		ModulesDir:  filepath.Join(model.NginxPrefix, "modules", "nginx-mgr"),
+		ProfilePath: nginxBuildProfilePath,
+		run:         executor.ExecuteSimple,
+		build: func(ctx context.Context, task *executor.TaskStatus, script string) error {
+			return executor.ExecuteCommand(ctx, task, "bash", "-c", script)
+		},
+		signal: func(pid int, sig syscall.Signal) error { return syscall.Kill(pid, sig) },
+		wait:   nginxSwapWait,
+		task:   &executor.TaskStatus{ID: "upgrade"},
+	}
+}
+
+// Status 返回最近一次升级任务的状态，日志包括编译输出
+func (u *NginxUpgrader) Status() model.NginxUpgradeStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	status := u.status
+	status.Logs = append([]string{}, u.task.GetLogs()...)
+	return status
+}
+
+// normalizeNginxVersion 去掉前缀 v，为空时使用面板内置的版本
+func normalizeNginxVersion(version string) (string, bool) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if version == "" {
+		version = model.NginxVersion
+	}
+	return version, nginxVersionPattern.MatchString(version)
+}
+
+// Profile 返回上次编译使用的版本与模块，从未通过面板编译时返回 nil
+func (u *NginxUpgrader) Profile() (*model.NginxBuildProfile, error) {
+	return loadBuildProfile(u.ProfilePath)
+}
+
+// Start 校验参数后在后台执行升级，version 为空时使用面板内置的版本。
+// modules 为 nil 时沿用编译配置中的模块；版本不变但模块有变化时按新的模块重新编译
+func (u *NginxUpgrader) Start(version, mode string, modules []string) error {
+	version, ok := normalizeNginxVersion(version)
+	if !ok {
+		return fmt.Errorf("%w: 版本号格式应为 1.28.0", ErrInvalidNginxUpgrade)
+	}
+	switch mode {
+	case "":
+		mode = nginxUpgradeHot
+	case nginxUpgradeHot, nginxUpgradeRestart:
+	default:
+		return fmt.Errorf("%w: mode 仅支持 hot 或 restart", ErrInvalidNginxUpgrade)
+	}
+	if modules == nil {
+		profile, err := u.Profile()
+		if err != nil {
+			return err
+		}
+		if profile != nil {
+			modules = profile.Modules
+		}
+	}
+	modules, err := sanitizeBuildModules(modules)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidNginxUpgrade, err)
+	}
+	if _, err := os.Stat(u.SbinPath); err != nil {
+		return fmt.Errorf("%w: 未找到 %s，请先安装 Nginx", ErrInvalidNginxUpgrade, u.SbinPath)
+	}
+	if !u.running.TryLock() {
+		return ErrNginxUpgradeBusy
+	}
+	u.begin(&executor.TaskStatus{ID: "upgrade"}, mode, version, modules)
+
+	go func() {
+		defer u.running.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), nginxUpgradeTimeout)
+		defer cancel()
+		rolledBack, err := u.upgrade(ctx, version, mode, modules)
+		u.finish(version, modules, rolledBack, err)
+	}()
+	return nil
+}
+
+// Rebuild 同步按指定版本与模块重新编译并重启，日志写入 task
+func (u *NginxUpgrader) Rebuild(ctx context.Context, task *executor.TaskStatus, version string, modules []string) error {
+	if !u.running.TryLock() {
+		return ErrNginxUpgradeBusy
+	}
+	defer u.running.Unlock()
+	u.begin(task, nginxUpgradeRestart, version, modules)
+	rolledBack, err := u.upgrade(ctx, version, nginxUpgradeRestart, modules)
+	return u.finish(version, modules, rolledBack, err)
+}
+
+func (u *NginxUpgrader) begin(task *executor.TaskStatus, mode, version string, modules []string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.task = task
+	u.status = model.NginxUpgradeStatus{Running: true, Mode: mode, ToVersion: version, Modules: modules, StartedUnixTime: time.Now().Unix()}
+}
+
+// finish 记录结果，成功时保存编译配置供之后升级沿用
+func (u *NginxUpgrader) finish(version string, modules []string, rolledBack bool, err error) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.status.Running = false
+	u.status.RolledBack = rolledBack
+	u.status.FinishedUnixTime = time.Now().Unix()
+	if err != nil {
+		u.status.Error = err.Error()
+		u.task.AddLog(fmt.Sprintf("!!! 升级失败: %v", err))
+		return err
+	}
+	u.status.Success = true
+	profile := model.NginxBuildProfile{Version: version, Modules: modules, LastUpdatedUnixTime: time.Now().Unix()}
+	if err := saveBuildProfile(u.ProfilePath, profile); err != nil {
+		u.task.AddLog(fmt.Sprintf("!!! 警告: 保存编译配置失败: %v", err))
+	}
+	u.task.AddLog(fmt.Sprintf("=== 已升级到 nginx/%s ===", version))
+	return nil
+}
+
+func (u *NginxUpgrader) log(format string, args ...any) {
+	u.task.AddLog(fmt.Sprintf(format, args...))
+}
+
+func (u *NginxUpgrader) binaryVersion(path string) (string, error) {
+	out, err := u.run(path, "-v")
+	if err != nil {
+		return "", fmt.Errorf("执行 %s -v 失败: %s", path, strings.TrimSpace(out))
+	}
+	match := nginxVersionOutput.FindStringSubmatch(out)
+	if match == nil {
+		return "", fmt.Errorf("无法识别 %s 的版本: %s", path, strings.TrimSpace(out))
+	}
+	return match[1], nil
+}
+
+// upgrade 返回是否已恢复原二进制
+func (u *NginxUpgrader) upgrade(ctx context.Context, version, mode string, modules []string) (bool, error) {
+	current, err := u.binaryVersion(u.SbinPath)
+	if err != nil {
+		return false, err
+	}
+	u.mu.Lock()
+	u.status.FromVersion = current
+	u.mu.Unlock()
+	if current == version {
+		previous, err := u.Profile()
+		if err != nil {
+			return false, err
+		}
+		if (previous == nil && len(modules) == 0) || (previous != nil && slices.Equal(previous.Modules, modules)) {
+			return false, fmt.Errorf("当前已是 nginx/%s", version)
+		}
+	}
+
+	u.log(">>> 读取当前编译参数 (nginx/%s)", current)
+	out, err := u.run(u.SbinPath, "-V")
+	if err != nil {
+		return false, fmt.Errorf("执行 nginx -V 失败: %s", strings.TrimSpace(out))
+	}
+	match := nginxConfigurePattern.FindStringSubmatch(out)
+	if match == nil {
+		return false, errors.New("无法读取当前的编译参数")
+	}
+	moduleDir := filepath.Join(u.BuildDir, "modules")
+	configureArgs := moduleConfigureArgs(strings.TrimSpace(match[1]), moduleDir, modules)
+	if len(modules) > 0 {
+		u.log(">>> 动态模块: %s", strings.Join(modules, "、"))
+	}
+
+	tarball := offlineFile(u.ArtifactDir, fmt.Sprintf("nginx-%s.tar.gz", version))
+	if tarball != "" {
+		u.log(">>> 使用离线源码包 %s 编译 nginx-%s", tarball, version)
+	} else {
+		u.log(">>> 下载并编译 nginx-%s", version)
+	}
+	srcDir := filepath.Join(u.BuildDir, "nginx-"+version)
+	prepare := renderModuleFetchScript(moduleDir, u.ArtifactDir, modules)
+	if err := u.build(ctx, u.task, renderNginxBuildScript(u.BuildDir, version, configureArgs, tarball, prepare)); err != nil {
+		return false, fmt.Errorf("编译失败: %w", err)
+	}
+	newBinary := filepath.Join(srcDir, "objs", "nginx")
+	built, err := u.binaryVersion(newBinary)
+	if err != nil {
+		return false, err
+	}
+	if built != version {
+		return false, fmt.Errorf("编译结果的版本为 %s，与目标版本 %s 不一致", built, version)
+	}
+
+	// 模块按版本分目录安装，回滚时恢复 load_module 列表即可让原二进制加载原来的模块
+	modulesConf := filepath.Join(u.ConfDir, nginxModulesConf)
+	prevModules, readErr := os.ReadFile(modulesConf)
+	manageModules := len(modules) > 0 || readErr == nil
+	restoreModules := func() {
+		if !manageModules {
+			return
+		}
+		if readErr != nil {
+			prevModules = []byte("# 由 nginx-mgr 生成：编译安装时选择的动态模块\n")
+		}
+		_ = os.WriteFile(modulesConf, prevModules, 0644)
+	}
+	if manageModules {
+		content, err := installBuiltModules(filepath.Join(srcDir, "objs"), u.ModulesDir, version, modules)
+		if err != nil {
+			return false, err
+		}
+		if err := os.WriteFile(modulesConf, []byte(content), 0644); err != nil {
+			return false, fmt.Errorf("写入模块列表失败: %w", err)
+		}
+		if err := ensureModulesInclude(u.ConfDir); err != nil {
+			restoreModules()
+			return false, err
+		}
+	}
+	if out, err := u.run(newBinary, "-t"); err != nil {
+		restoreModules()
+		return false, fmt.Errorf("新版本未通过配置测试，未替换二进制: %s", strings.TrimSpace(out))
+	}
+
+	u.log(">>> 替换 %s（原二进制备份为 %s.bak）", u.SbinPath, u.SbinPath)
+	backup := u.SbinPath + ".bak"
+	if err := copyFileMode(u.SbinPath, backup, 0755); err != nil {
+		return false, fmt.Errorf("备份原二进制失败: %w", err)
+	}
+	if err := replaceBinary(newBinary, u.SbinPath); err != nil {
+		return false, fmt.Errorf("替换二进制失败: %w", err)
+	}
+	// restartOnRollback 新版本已经接管服务时，恢复二进制后需要重启才能回到原版本
+	restartOnRollback := mode == nginxUpgradeRestart
+	rollback := func(cause error) (bool, error) {
+		u.log(">>> 恢复 nginx/%s 的二进制", current)
+		restoreModules()
+		if err := replaceBinary(backup, u.SbinPath); err != nil {
+			return false, fmt.Errorf("%v；恢复原二进制失败: %v", cause, err)
+		}
+		if restartOnRollback {
+			if out, err := u.run("systemctl", "restart", "nginx"); err != nil {
+				return true, fmt.Errorf("%v；已恢复原二进制但重启失败: %s", cause, strings.TrimSpace(out))
+			}
+		}
+		return true, cause
+	}
+
+	if mode == nginxUpgradeHot {
+		u.log(">>> 平滑切换主进程 (USR2/WINCH/QUIT)")
+		if err = u.hotSwap(version); err == nil {
+			restartOnRollback = true
+		}
+	} else {
+		u.log(">>> 重启 Nginx")
+		if out, runErr := u.run("systemctl", "restart", "nginx"); runErr != nil {
+			err = fmt.Errorf("重启失败: %s", strings.TrimSpace(out))
+		}
+	}
+	if err != nil {
+		return rollback(err)
+	}
+
+	if running, err := u.binaryVersion(u.SbinPath); err != nil {
+		return rollback(fmt.Errorf("升级后的版本校验失败: %w", err))
+	} else if running != version {
+		return rollback(fmt.Errorf("升级后的版本为 %s，与目标版本 %s 不一致", running, version))
+	}
+	if out, err := u.run("systemctl", "is-active", "nginx"); err != nil {
+		return rollback(fmt.Errorf("升级后 Nginx 未在运行: %s", strings.TrimSpace(out)))
+	}
+	return false, nil
+}
+
+// renderNginxBuildScript 生成编译脚本，tarball 非空时复制本地源码包而不下载；prepare 在下载源码前执行，用于准备模块源码
+func renderNginxBuildScript(buildDir, version, configureArgs, tarball, prepare string) string {
+	fetch := fmt.Sprintf("curl -fsSL https://nginx.org/download/nginx-%[1]s.tar.gz -o nginx-%[1]s.tar.gz", version)
+	if tarball != "" {
+		fetch = fmt.Sprintf("cp %s nginx-%s.tar.gz", shellQuote(tarball), version)
+	}
+	return fmt.Sprintf(`set -euo pipefail
+%[5]smkdir -p %[1]s && cd %[1]s
+%[4]s
+rm -rf nginx-%[2]s && tar xzf nginx-%[2]s.tar.gz
+cd nginx-%[2]s
+./configure %[3]s
+make -j"$(nproc)"
+`, buildDir, version, configureArgs, fetch, prepare)
+}
+
+// replaceBinary 先写到同目录的临时文件再重命名，正在运行的进程不受影响
+func replaceBinary(src, dest string) error {
+	tmp := dest + ".new"
+	if err := copyFileMode(src, tmp, 0755); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+func readPidFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// hotSwap 按 Nginx 官方的升级流程切换：USR2 让旧主进程用新二进制启动新主进程（旧 pid 文件改名为 .oldbin），
+// WINCH 让旧工作进程处理完请求后退出，确认新主进程存活后 QUIT 旧主进程。
+// 新主进程未能启动或随后退出时 HUP 旧主进程重新拉起工作进程
+func (u *NginxUpgrader) hotSwap(version string) error {
+	oldPid, err := readPidFile(u.PidFile)
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败，Nginx 可能未在运行: %w", u.PidFile, err)
+	}
+	if err := u.signal(oldPid, syscall.SIGUSR2); err != nil {
+		return fmt.Errorf("向旧主进程 %d 发送 USR2 失败: %w", oldPid, err)
+	}
+
+	var newPid int
+	deadline := time.Now().Add(u.wait)
+	for {
+		if _, err := os.Stat(u.PidFile + ".oldbin"); err == nil {
+			if pid, err := readPidFile(u.PidFile); err == nil && pid != oldPid {
+				newPid = pid
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			return errors.New("新主进程未能启动，旧进程保持运行")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	u.log("新主进程 %d 已启动，停止旧主进程 %d 的工作进程", newPid, oldPid)
+
+	if err := u.signal(oldPid, syscall.SIGWINCH); err != nil {
+		u.signal(newPid, syscall.SIGQUIT)
+		return fmt.Errorf("向旧主进程发送 WINCH 失败: %w", err)
+	}
+	time.Sleep(u.wait / 10)
+	if err := u.signal(newPid, 0); err != nil {
+		u.signal(oldPid, syscall.SIGHUP)
+		return fmt.Errorf("新主进程 %d 已退出，已恢复旧工作进程", newPid)
+	}
+	if err := u.signal(oldPid, syscall.SIGQUIT); err != nil {
+		return fmt.Errorf("向旧主进程发送 QUIT 失败: %w", err)
+	}
+	u.log("旧主进程 %d 已退出，nginx/%s 接管服务", oldPid, version)
+	return nil
+}
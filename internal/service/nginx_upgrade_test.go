@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+)
+
+func TestNginxUpgrader(t *testing.T) {
+	dir := t.TempDir()
+	sbin := filepath.Join(dir, "nginx")
+	pidFile := filepath.Join(dir, "nginx.pid")
+
+	var commands, signals []string
+	newUpgrader := func(swapWorks bool) *NginxUpgrader {
+		os.WriteFile(sbin, []byte("1.26.0"), 0755)
+		os.WriteFile(pidFile, []byte("100\n"), 0644)
+		os.Remove(pidFile + ".oldbin")
+		commands, signals = nil, nil
+
+		u := NewNginxUpgrader()
+		u.SbinPath = sbin
+		u.PidFile = pidFile
+		u.BuildDir = filepath.Join(dir, "build")
+		u.ArtifactDir = filepath.Join(dir, "offline")
+		u.ConfDir = filepath.Join(dir, "conf")
+		u.ModulesDir = filepath.Join(dir, "modules")
+		u.ProfilePath = filepath.Join(dir, "profile.json")
+		u.wait = 300 * time.Millisecond
+		u.run = func(name string, args ...string) (string, error) {
+			commands = append(commands, filepath.Base(name)+" "+strings.Join(args, " "))
+			switch {
+			case name == "systemctl":
+				return "active", nil
+			case args[0] == "-v":
+				version, err := os.ReadFile(name)
+				return "nginx version: nginx/" + string(version), err
+			case args[0] == "-V":
+				return "nginx version: nginx/1.26.0\nconfigure arguments: --prefix=/usr/local/nginx --with-cc-opt='-O2 -g'\n", nil
+			}
+			return "", nil
+		}
+		u.build = func(ctx context.Context, task *executor.TaskStatus, script string) error {
+			if !strings.Contains(script, "nginx-1.28.1.tar.gz") || !strings.Contains(script, "./configure --prefix=/usr/local/nginx --with-cc-opt='-O2 -g'\n") {
+				return fmt.Errorf("unexpected build script:\n%s", script)
+			}
+			objs := filepath.Join(u.BuildDir, "nginx-1.28.1", "objs")
+			os.MkdirAll(objs, 0755)
+			return os.WriteFile(filepath.Join(objs, "nginx"), []byte("1.28.1"), 0755)
+		}
+		u.signal = func(pid int, sig syscall.Signal) error {
+			signals = append(signals, fmt.Sprintf("%d %d", pid, sig))
+			if pid == 100 && sig == syscall.SIGUSR2 && swapWorks {
+				os.Rename(pidFile, pidFile+".oldbin")
+				os.WriteFile(pidFile, []byte(strconv.Itoa(200)), 0644)
+			}
+			return nil
+		}
+		return u
+	}
+	wait := func(u *NginxUpgrader) model.NginxUpgradeStatus {
+		for i := 0; i < 100; i++ {
+			if status := u.Status(); !status.Running {
+				return status
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatal("upgrade did not finish")
+		return model.NginxUpgradeStatus{}
+	}
+
+	u := newUpgrader(true)
+	if err := u.Start("1.28", "", nil); !errors.Is(err, ErrInvalidNginxUpgrade) {
+		t.Fatalf("expected invalid version, got %v", err)
+	}
+	if err := u.Start("1.28.1", "", nil); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	status := wait(u)
+	if !status.Success || status.FromVersion != "1.26.0" || status.Mode != "hot" || status.RolledBack {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if data, _ := os.ReadFile(sbin); string(data) != "1.28.1" {
+		t.Fatalf("binary not replaced: %s", data)
+	}
+	if data, _ := os.ReadFile(sbin + ".bak"); string(data) != "1.26.0" {
+		t.Fatalf("backup missing: %s", data)
+	}
+	want := []string{
+		fmt.Sprintf("100 %d", syscall.SIGUSR2),
+		fmt.Sprintf("100 %d", syscall.SIGWINCH),
+		"200 0",
+		fmt.Sprintf("100 %d", syscall.SIGQUIT),
+	}
+	if strings.Join(signals, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected signals: %v", signals)
+	}
+
+	// 新主进程没有启动时恢复原二进制，旧进程保持运行且不重启
+	u = newUpgrader(false)
+	if err := u.Start("1.28.1", "hot", nil); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	status = wait(u)
+	if status.Success || !status.RolledBack || !strings.Contains(status.Error, "新主进程未能启动") {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if data, _ := os.ReadFile(sbin); string(data) != "1.26.0" {
+		t.Fatalf("binary not restored: %s", data)
+	}
+	for _, command := range commands {
+		if strings.HasPrefix(command, "systemctl restart") {
+			t.Fatalf("unexpected restart: %v", commands)
+		}
+	}
+
+	u = newUpgrader(false)
+	if err := u.Start("1.28.1", "restart", nil); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if status = wait(u); !status.Success || len(signals) != 0 {
+		t.Fatalf("unexpected restart upgrade: %+v %v", status, signals)
+	}
+}
+
+func TestNginxUpgraderModules(t *testing.T) {
+	dir := t.TempDir()
+	sbin := filepath.Join(dir, "nginx")
+	os.WriteFile(sbin, []byte("1.28.0"), 0755)
+	confDir := filepath.Join(dir, "conf")
+	os.MkdirAll(confDir, 0755)
+	os.WriteFile(filepath.Join(confDir, "nginx.conf"), []byte("user www-data;\nhttp {\n}\n"), 0644)
+
+	u := NewNginxUpgrader()
+	u.SbinPath = sbin
+	u.BuildDir = filepath.Join(dir, "build")
+	u.ArtifactDir = filepath.Join(dir, "offline")
+	u.ConfDir = confDir
+	u.ModulesDir = filepath.Join(dir, "modules")
+	u.ProfilePath = filepath.Join(dir, "profile.json")
+	configTestFails := false
+	u.run = func(name string, args ...string) (string, error) {
+		switch {
+		case name == "systemctl":
+			return "active", nil
+		case args[0] == "-v":
+			version, err := os.ReadFile(name)
+			return "nginx version: nginx/" + string(version), err
+		case args[0] == "-V":
+			return "configure arguments: --prefix=/usr/local/nginx --add-dynamic-module=" + u.BuildDir + "/modules/geoip2\n", nil
+		case args[0] == "-t" && configTestFails:
+			return "nginx: [emerg] module is not binary compatible", errors.New("exit status 1")
+		}
+		return "", nil
+	}
+	var script string
+	u.build = func(ctx context.Context, task *executor.TaskStatus, s string) error {
+		script = s
+		objs := filepath.Join(u.BuildDir, "nginx-1.28.0", "objs")
+		os.MkdirAll(objs, 0755)
+		for _, name := range []string{"ngx_stream_module.so", "ngx_http_headers_more_filter_module.so", "ngx_http_js_module.so"} {
+			os.WriteFile(filepath.Join(objs, name), []byte("so"), 0644)
+		}
+		return os.WriteFile(filepath.Join(objs, "nginx"), []byte("1.28.0"), 0755)
+	}
+
+	// 版本不变、模块有变化时重新编译；已移除的 geoip2 不再出现在编译参数中
+	if err := u.Rebuild(context.Background(), &executor.TaskStatus{}, "1.28.0", []string{"stream", "headers-more"}); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	wantArgs := "./configure --prefix=/usr/local/nginx --with-stream=dynamic --with-stream_ssl_module --with-stream_ssl_preread_module --add-dynamic-module=" + u.BuildDir + "/modules/headers-more\n"
+	if !strings.Contains(script, wantArgs) || !strings.Contains(script, "headers-more-nginx-module/archive/refs/tags/v0.38.tar.gz") {
+		t.Fatalf("unexpected build script:\n%s", script)
+	}
+	modulesConf, _ := os.ReadFile(filepath.Join(confDir, nginxModulesConf))
+	wantConf := "load_module " + filepath.Join(u.ModulesDir, "1.28.0", "ngx_stream_module.so") + ";\nload_module " + filepath.Join(u.ModulesDir, "1.28.0", "ngx_http_headers_more_filter_module.so") + ";\n"
+	if !strings.HasSuffix(string(modulesConf), wantConf) {
+		t.Fatalf("unexpected modules conf:\n%s", modulesConf)
+	}
+	if nginxConf, _ := os.ReadFile(filepath.Join(confDir, "nginx.conf")); !strings.HasPrefix(string(nginxConf), "include "+filepath.Join(confDir, nginxModulesConf)+";\nuser www-data;") {
+		t.Fatalf("modules conf not included:\n%s", nginxConf)
+	}
+	profile, err := u.Profile()
+	if err != nil || profile == nil || profile.Version != "1.28.0" || strings.Join(profile.Modules, ",") != "stream,headers-more" {
+		t.Fatalf("unexpected profile: %+v %v", profile, err)
+	}
+
+	// 版本与模块都没有变化时拒绝重复编译
+	if err := u.Rebuild(context.Background(), &executor.TaskStatus{}, "1.28.0", []string{"stream", "headers-more"}); err == nil || !strings.Contains(err.Error(), "当前已是") {
+		t.Fatalf("expected no-op rebuild to be rejected, got %v", err)
+	}
+
+	// 新二进制配置测试失败时恢复原来的模块列表
+	configTestFails = true
+	if err := u.Rebuild(context.Background(), &executor.TaskStatus{}, "1.28.0", []string{"njs"}); err == nil {
+		t.Fatal("expected config test failure")
+	}
+	if restored, _ := os.ReadFile(filepath.Join(confDir, nginxModulesConf)); string(restored) != string(modulesConf) {
+		t.Fatalf("modules conf not restored:\n%s", restored)
+	}
+	if profile, _ := u.Profile(); strings.Join(profile.Modules, ",") != "stream,headers-more" {
+		t.Fatalf("profile should be unchanged after failure: %+v", profile)
+	}
+
+	if err := u.Start("1.28.1", "", []string{"pagespeed"}); !errors.Is(err, ErrInvalidNginxUpgrade) {
+		t.Fatalf("expected unsupported module error, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+// NotifyCertMonitor 汇总发送外部域名证书的问题，problems 已按剩余天数升序排列
+func (d *NotificationDispatcher) NotifyCertMonitor(problems []model.CertCheckResult, warnDays int) {
+	settings, err := d.svc.Get()
+	if err != nil {
+		log.Printf("[notification] 获取配置失败: %v", err)
+		return
+	}
+	if !hasEnabledChannel(settings) {
+		return
+	}
+	title := fmt.Sprintf("外部证书告警 · %d 个主机", len(problems))
+	d.dispatch(settings, notifyEventCert, title, buildCertMonitorAlert(settings, problems, warnDays))
+}
+
+func buildCertMonitorAlert(settings model.NotificationSettings, problems []model.CertCheckResult, warnDays int) string {
+	lines := []string{
+		"## 🔐 外部证书告警",
+		"",
+		fmt.Sprintf("* **服务名称**: %s", alertServerName(settings)),
+		fmt.Sprintf("* **告警阈值**: 剩余 %d 天", warnDays),
+		"",
+	}
+	for _, result := range problems {
+		target := result.ServerName
+		if result.Host != result.ServerName {
+			target = fmt.Sprintf("%s（%s:%d）", result.ServerName, result.Host, result.Port)
+		} else if result.Port != 443 {
+			target = fmt.Sprintf("%s:%d", result.Host, result.Port)
+		}
+		switch {
+		case result.NotAfterUnixTime == 0:
+			lines = append(lines, fmt.Sprintf("* **%s**: %s", target, result.Error))
+		case result.Error != "":
+			lines = append(lines, fmt.Sprintf("* **%s**: %s，到期 %s（剩余 %d 天）", target, result.Error,
+				time.Unix(result.NotAfterUnixTime, 0).Format("2006-01-02"), result.DaysLeft))
+		default:
+			lines = append(lines, fmt.Sprintf("* **%s**: 将于 %s 到期（剩余 %d 天），颁发者 %s", target,
+				time.Unix(result.NotAfterUnixTime, 0).Format("2006-01-02"), result.DaysLeft, result.Issuer))
+		}
+	}
+	lines = append(lines, "", "> 建议：请联系证书维护方续期，或检查服务端是否返回了完整的证书链。")
+	return strings.Join(lines, "\n")
+}
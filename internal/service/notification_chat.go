@@ -0,0 +1,162 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"nginx-mgr/internal/model"
+)
+
+const (
+	wecomContentLimit = 4096
+	slackSectionLimit = 3000
+	discordEmbedLimit = 4096
+	discordTitleLimit = 256
+	slackHeaderLimit  = 150
+	discordAlertColor = 0xF59E0B
+)
+
+// sendWeCom 通过企业微信群机器人发送 Markdown 消息。接口始终返回 200，需检查 errcode
+func (d *NotificationDispatcher) sendWeCom(cfg model.WeComSettings, content string) error {
+	webhook := strings.TrimSpace(cfg.Webhook)
+	if webhook == "" {
+		return errors.New("企业微信 Webhook 未配置")
+	}
+	// 企业微信的长度限制按字节计算，截断时保证不切开多字节字符
+	if len(content) > wecomContentLimit {
+		cut := wecomContentLimit - len("…")
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		content = content[:cut] + "…"
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"content": content},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("企业微信返回状态码: %d", resp.StatusCode)
+	}
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("解析企业微信响应失败: %w", err)
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("企业微信返回错误: %d %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// sendSlack 以 Block Kit 发送告警：标题作为 header，正文转换为 mrkdwn
+func (d *NotificationDispatcher) sendSlack(cfg model.SlackSettings, title, content string) error {
+	webhook := strings.TrimSpace(cfg.Webhook)
+	if webhook == "" {
+		return errors.New("Slack Webhook 未配置")
+	}
+	payload := map[string]interface{}{
+		"text": buildPlainText(title, content),
+		"blocks": []map[string]interface{}{
+			{
+				"type": "header",
+				"text": map[string]string{"type": "plain_text", "text": truncateRunes(title, slackHeaderLimit)},
+			},
+			{
+				"type": "section",
+				"text": map[string]string{"type": "mrkdwn", "text": truncateRunes(convertAlertMarkdown(content, "*"), slackSectionLimit)},
+			},
+		},
+	}
+	return d.postChatJSON("Slack", webhook, payload)
+}
+
+// sendDiscord 以 embed 发送告警，Discord 成功时返回 204
+func (d *NotificationDispatcher) sendDiscord(cfg model.DiscordSettings, title, content string) error {
+	webhook := strings.TrimSpace(cfg.Webhook)
+	if webhook == "" {
+		return errors.New("Discord Webhook 未配置")
+	}
+	payload := map[string]interface{}{
+		"embeds": []map[string]interface{}{
+			{
+				"title":       truncateRunes(title, discordTitleLimit),
+				"description": truncateRunes(convertAlertMarkdown(content, "**"), discordEmbedLimit),
+				"color":       discordAlertColor,
+				"timestamp":   time.Now().UTC().Format(time.RFC3339),
+			},
+		},
+	}
+	return d.postChatJSON("Discord", webhook, payload)
+}
+
+func (d *NotificationDispatcher) postChatJSON(name, webhook string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s 返回状态码: %d", name, resp.StatusCode)
+	}
+	return nil
+}
+
+// convertAlertMarkdown 将告警正文（钉钉 Markdown）转换为聊天平台支持的格式：
+// 标题改为加粗行，列表符号统一为 •，加粗标记替换为 bold（Slack 为 *，Discord 为 **）
+func convertAlertMarkdown(content, bold string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		line = strings.ReplaceAll(line, "**", bold)
+		switch {
+		case strings.HasPrefix(line, "#"):
+			line = bold + strings.TrimSpace(strings.TrimLeft(line, "#")) + bold
+		case strings.HasPrefix(line, "* "), strings.HasPrefix(line, "- "):
+			line = "• " + line[2:]
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+func truncateRunes(value string, limit int) string {
+	runes := []rune(value)
+	if len(runes) <= limit {
+		return value
+	}
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+const (
+	digestTopSites  = 5
+	digestTopCerts  = 5
+	digestCertAlert = 14 // 证书剩余天数不足时在日报中标记
+)
+
+type siteRequestStat struct {
+	domain   string
+	requests int
+	client   int // 4xx
+	server   int // 5xx
+}
+
+type certExpiry struct {
+	name     string
+	notAfter time.Time
+}
+
+// dailyDigest 每日运行日报的数据来源与上次发送时间，上次发送时间首次使用时从通知历史恢复，避免重启后重复发送
+type dailyDigest struct {
+	logDir       string
+	acmeDir      string
+	schedulePath string
+	lastSent     time.Time
+	loaded       bool
+}
+
+func newDailyDigest() dailyDigest {
+	return dailyDigest{
+		logDir:       model.NginxLogDir,
+		acmeDir:      filepath.Join(model.NginxPrefix, "acme_letsencrypt"),
+		schedulePath: backupSchedulePath,
+	}
+}
+
+// checkDigest 每天到达设定时间后发送一次日报，面板在设定时间停机时启动后补发
+func (d *NotificationDispatcher) checkDigest(settings model.NotificationSettings, now time.Time) {
+	cfg := settings.DailyDigest
+	if !cfg.Enabled {
+		return
+	}
+	at, err := time.ParseInLocation("15:04", cfg.Time, now.Location())
+	if err != nil {
+		return
+	}
+	scheduled := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if now.Before(scheduled) {
+		return
+	}
+
+	d.mu.Lock()
+	g := &d.digest
+	if !g.loaded {
+		if history, err := d.svc.History(notifyEventDigest, 1); err == nil && len(history) > 0 {
+			g.lastSent = time.Unix(history[0].CreatedUnixTime, 0)
+		}
+		g.loaded = true
+	}
+	if !g.lastSent.Before(scheduled) {
+		d.mu.Unlock()
+		return
+	}
+	g.lastSent = now
+	d.mu.Unlock()
+
+	var cycle *TrafficCycle
+	if d.trafficMgr != nil {
+		if current, err := readTrafficSnapshot(); err == nil && current != nil {
+			if snapshot, err := d.trafficMgr.Snapshot(settings, current.TotalBytes); err == nil {
+				cycle = &snapshot
+			}
+		}
+	}
+	since := now.Add(-24 * time.Hour)
+	sites := g.collectSiteStats(since, now)
+	certs := collectACMECerts(g.acmeDir)
+	var schedule *model.BackupSchedule
+	if loaded, err := loadBackupSchedule(g.schedulePath); err == nil {
+		schedule = &loaded
+	} else {
+		log.Printf("[notification] 读取备份状态失败: %v", err)
+	}
+
+	content := buildDailyDigest(settings, now, cycle, sites, certs, schedule)
+	d.dispatch(settings, notifyEventDigest, fmt.Sprintf("每日日报 · %s", alertServerName(settings)), content)
+}
+
+// collectSiteStats 统计各站点近 24 小时的请求数，轮转后的 .1 文件一并读取
+func (g *dailyDigest) collectSiteStats(since, until time.Time) []siteRequestStat {
+	paths, _ := filepath.Glob(filepath.Join(g.logDir, "*-access.log"))
+	stats := make([]siteRequestStat, 0, len(paths))
+	for _, path := range paths {
+		stat := siteRequestStat{domain: strings.TrimSuffix(filepath.Base(path), "-access.log")}
+		for _, file := range []string{path + ".1", path} {
+			countAccessLog(file, since, until, &stat)
+		}
+		if stat.requests > 0 {
+			stats = append(stats, stat)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].requests != stats[j].requests {
+			return stats[i].requests > stats[j].requests
+		}
+		return stats[i].domain < stats[j].domain
+	})
+	return stats
+}
+
+func countAccessLog(path string, since, until time.Time, stat *siteRequestStat) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		entry, ok := parseAccessLine(scanner.Text())
+		if !ok || entry.Time.Before(since) || entry.Time.After(until) {
+			continue
+		}
+		stat.requests++
+		switch status := entry.Status; {
+		case status >= 500 && status <= 599:
+			stat.server++
+		case status >= 400 && status <= 499:
+			stat.client++
+		}
+	}
+}
+
+// collectACMECerts 读取 nginx-acme 签发的证书，同一域名只保留到期时间最晚的一张（续期后旧证书仍在目录中）
+func collectACMECerts(acmeDir string) []certExpiry {
+	latest := make(map[string]time.Time)
+	_ = filepath.WalkDir(acmeDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if entry.IsDir() || (ext != ".crt" && ext != ".pem") {
+			return nil
+		}
+		leaf, err := readLeafCert(path)
+		if err != nil {
+			return nil
+		}
+		name := leaf.Subject.CommonName
+		if len(leaf.DNSNames) > 0 {
+			name = leaf.DNSNames[0]
+		}
+		if name != "" && leaf.NotAfter.After(latest[name]) {
+			latest[name] = leaf.NotAfter
+		}
+		return nil
+	})
+	certs := make([]certExpiry, 0, len(latest))
+	for name, notAfter := range latest {
+		certs = append(certs, certExpiry{name, notAfter})
+	}
+	sort.Slice(certs, func(i, j int) bool {
+		if !certs[i].notAfter.Equal(certs[j].notAfter) {
+			return certs[i].notAfter.Before(certs[j].notAfter)
+		}
+		return certs[i].name < certs[j].name
+	})
+	return certs
+}
+
+func buildDailyDigest(settings model.NotificationSettings, now time.Time, cycle *TrafficCycle, sites []siteRequestStat, certs []certExpiry, schedule *model.BackupSchedule) string {
+	lines := []string{
+		"## 📊 每日运行日报",
+		"",
+		fmt.Sprintf("* **服务名称**: %s", alertServerName(settings)),
+		fmt.Sprintf("* **统计区间**: %s ~ %s", now.Add(-24*time.Hour).Format("01-02 15:04"), now.Format("01-02 15:04")),
+	}
+
+	lines = append(lines, "", "### 流量")
+	switch {
+	case cycle == nil:
+		lines = append(lines, "- 读取网络流量失败")
+	case cycle.LimitBytes > 0:
+		lines = append(lines, fmt.Sprintf("- **本周期已用**: %s / %s（%.1f%%）", formatBytes(float64(cycle.UsedBytes)), formatBytes(float64(cycle.LimitBytes)), float64(cycle.UsedBytes)/float64(cycle.LimitBytes)*100))
+	default:
+		lines = append(lines, fmt.Sprintf("- **本周期已用**: %s", formatBytes(float64(cycle.UsedBytes))))
+	}
+	if cycle != nil && !cycle.NextReset.IsZero() {
+		lines = append(lines, fmt.Sprintf("- **下次流量重置**: %s", cycle.NextReset.Format("2006-01-02")))
+	}
+
+	lines = append(lines, "", "### 站点请求")
+	if len(sites) == 0 {
+		lines = append(lines, "- 近 24 小时没有访问记录")
+	} else {
+		total, client, server := 0, 0, 0
+		for _, site := range sites {
+			total += site.requests
+			client += site.client
+			server += site.server
+		}
+		lines = append(lines, fmt.Sprintf("- **合计**: %d 个请求，4xx %d 个，5xx %d 个", total, client, server))
+		for i, site := range sites {
+			if i >= digestTopSites {
+				break
+			}
+			lines = append(lines, fmt.Sprintf("- %s: %d 个请求（4xx %d，5xx %d）", site.domain, site.requests, site.client, site.server))
+		}
+	}
+
+	lines = append(lines, "", "### 证书")
+	if len(certs) == 0 {
+		lines = append(lines, "- 未找到 ACME 证书")
+	}
+	for i, cert := range certs {
+		if i >= digestTopCerts {
+			lines = append(lines, fmt.Sprintf("- 其余 %d 张证书到期时间更晚", len(certs)-digestTopCerts))
+			break
+		}
+		days := int(cert.notAfter.Sub(now).Hours() / 24)
+		mark := ""
+		switch {
+		case days < 0:
+			mark = " ⚠️ 已过期"
+		case days <= digestCertAlert:
+			mark = " ⚠️"
+		}
+		lines = append(lines, fmt.Sprintf("- %s: %s 到期（剩余 %d 天）%s", cert.name, cert.notAfter.Local().Format("2006-01-02"), days, mark))
+	}
+
+	lines = append(lines, "", "### 备份")
+	switch {
+	case schedule == nil:
+		lines = append(lines, "- 读取备份状态失败")
+	case schedule.LastRunUnixTime == 0:
+		lines = append(lines, "- 尚未执行过备份")
+	default:
+		result := "成功"
+		if !schedule.LastSuccess {
+			result = "失败"
+			if schedule.LastError != "" {
+				result += ": " + schedule.LastError
+			}
+		}
+		lines = append(lines, fmt.Sprintf("- **最近一次**: %s，%s", time.Unix(schedule.LastRunUnixTime, 0).Format("2006-01-02 15:04"), result))
+	}
+	if schedule != nil {
+		if schedule.Enabled && schedule.NextRunUnixTime > 0 {
+			lines = append(lines, fmt.Sprintf("- **下次定时备份**: %s", time.Unix(schedule.NextRunUnixTime, 0).Format("2006-01-02 15:04")))
+		} else {
+			lines = append(lines, "- 定时备份未启用")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+// diskCooldown 磁盘持续超过阈值时的重复提醒间隔
+const diskCooldown = 6 * time.Hour
+
+type diskStat struct {
+	Device uint64
+	Total  uint64
+	Used   uint64
+}
+
+// diskWatch 检查根目录、日志目录与本地备份目录所在磁盘的使用率，同一文件系统只统计一次
+type diskWatch struct {
+	paths []string
+	stat  func(path string) (diskStat, error)
+
+	lastAlert time.Time
+}
+
+func newDiskWatch() diskWatch {
+	return diskWatch{
+		paths: []string{"/", "/var/log", localBackupDir},
+		stat:  statDisk,
+	}
+}
+
+// statDisk 与 df 的算法一致：已用 = 总量 - 空闲，容量 = 已用 + 普通用户可用
+func statDisk(path string) (diskStat, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return diskStat{}, err
+	}
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return diskStat{}, err
+	}
+	stat := diskStat{
+		Used: (uint64(fs.Blocks) - uint64(fs.Bfree)) * uint64(fs.Bsize),
+	}
+	stat.Total = stat.Used + uint64(fs.Bavail)*uint64(fs.Bsize)
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		stat.Device = uint64(sys.Dev)
+	}
+	return stat, nil
+}
+
+func (d *NotificationDispatcher) checkDisk(settings model.NotificationSettings) {
+	if settings.DiskThreshold <= 0 {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w := &d.disk
+
+	type usage struct {
+		paths []string
+		stat  diskStat
+	}
+	var devices []*usage
+	byDevice := make(map[uint64]*usage)
+	for _, path := range w.paths {
+		stat, err := w.stat(path)
+		if err != nil || stat.Total == 0 {
+			// 备份目录在首次备份前不存在
+			continue
+		}
+		if existing, ok := byDevice[stat.Device]; ok {
+			existing.paths = append(existing.paths, path)
+			continue
+		}
+		entry := &usage{paths: []string{path}, stat: stat}
+		byDevice[stat.Device] = entry
+		devices = append(devices, entry)
+	}
+
+	var lines []string
+	for _, entry := range devices {
+		percent := float64(entry.stat.Used) / float64(entry.stat.Total) * 100
+		if percent < float64(settings.DiskThreshold) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("* **%s**: 已用 %.1f%%（%s / %s，剩余 %s）",
+			strings.Join(entry.paths, "、"),
+			percent,
+			formatBytes(float64(entry.stat.Used)),
+			formatBytes(float64(entry.stat.Total)),
+			formatBytes(float64(entry.stat.Total-entry.stat.Used)),
+		))
+	}
+	if len(lines) == 0 {
+		w.lastAlert = time.Time{}
+		return
+	}
+	if time.Since(w.lastAlert) < diskCooldown {
+		return
+	}
+
+	serverName := alertServerName(settings)
+	now := time.Now()
+	content := strings.Join(append([]string{
+		"## 💾 磁盘空间告警",
+		"",
+		fmt.Sprintf("* **服务名称**: %s", serverName),
+		fmt.Sprintf("* **监测时间**: %s", now.Format("2006-01-02 15:04:05")),
+		fmt.Sprintf("* **阈值设定**: %d%%", settings.DiskThreshold),
+	}, append(lines, "", "> 建议：磁盘写满会导致日志写入与备份失败，请清理旧日志、旧备份或扩容。")...), "\n")
+
+	d.dispatch(settings, notifyEventDisk, fmt.Sprintf("磁盘空间告警 · %s", serverName), content)
+	w.lastAlert = now
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,6 +16,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -30,6 +32,9 @@ const (
 )
 
 type NotificationDispatcher struct {
+	// SiteStats 可选，设置后流量告警附带本周期各站点的流量
+	SiteStats *SiteStatsService
+
 	svc        *NotificationService
 	trafficMgr *TrafficUsageManager
 	client     *http.Client
@@ -39,6 +44,15 @@ type NotificationDispatcher struct {
 	lastTrafficAlert time.Time
 	lastExpiryKey    string
 	lastExpiryAlert  time.Time
+	watchdog         nginxWatchdog
+	disk             diskWatch
+	errorRate        errorRateWatch
+	latency          latencyWatch
+	limiter          trafficLimiter
+	digest           dailyDigest
+
+	proxyMu         sync.Mutex
+	proxyTransports map[string]*http.Transport
 }
 
 type trafficSnapshot struct {
@@ -60,6 +74,12 @@ func NewNotificationDispatcher(notificationSvc *NotificationService, trafficMgr
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		watchdog:  newNginxWatchdog(),
+		disk:      newDiskWatch(),
+		errorRate: newErrorRateWatch(),
+		latency:   newLatencyWatch(),
+		limiter:   newTrafficLimiter(),
+		digest:    newDailyDigest(),
 	}
 }
 
@@ -89,12 +109,18 @@ func (d *NotificationDispatcher) runCycle() {
 		return
 	}
 
-	if !settings.DingTalk.Enabled && !settings.Telegram.Enabled {
+	if !hasEnabledChannel(settings) {
 		return
 	}
 
+	d.checkNginx(settings)
+	d.checkDisk(settings)
+	d.checkErrorRate(settings)
+	d.checkLatency(settings)
 	d.checkTraffic(settings)
+	d.checkTrafficLimit(settings)
 	d.checkExpiry(settings)
+	d.checkDigest(settings, time.Now())
 }
 
 func (d *NotificationDispatcher) checkTraffic(settings model.NotificationSettings) {
@@ -193,11 +219,12 @@ func (d *NotificationDispatcher) checkTraffic(settings model.NotificationSetting
 		contentLines = append(contentLines, fmt.Sprintf("* **统计起始**: %s", cycle.CycleStart.Format("2006-01-02")))
 	}
 
+	contentLines = append(contentLines, d.trafficSiteLines(cycle)...)
 	contentLines = append(contentLines, "", "> 建议：请排查高流量应用或调整提醒阈值。")
 
 	content := strings.Join(contentLines, "\n")
 
-	d.dispatch(settings, title, content)
+	d.dispatch(settings, notifyEventTraffic, title, content)
 	d.lastTrafficAlert = now
 	d.lastSnapshot = current
 }
@@ -269,21 +296,121 @@ func (d *NotificationDispatcher) checkExpiry(settings model.NotificationSettings
 		return
 	}
 
-	d.dispatch(settings, title, content)
+	d.dispatch(settings, notifyEventExpiry, title, content)
 	d.lastExpiryKey = key
 	d.lastExpiryAlert = time.Now()
 }
 
-func (d *NotificationDispatcher) dispatch(settings model.NotificationSettings, title, content string) {
-	if settings.DingTalk.Enabled && settings.DingTalk.Webhook != "" {
-		if err := d.sendDingTalk(settings.DingTalk, title, content); err != nil {
-			log.Printf("[notification] 钉钉通知失败: %v", err)
+// NotifyBackup 按通知设置中的开关发送定时备份结果
+func (d *NotificationDispatcher) NotifyBackup(job BackupJob) {
+	settings, err := d.svc.Get()
+	if err != nil {
+		log.Printf("[notification] 获取配置失败: %v", err)
+		return
+	}
+	failed := job.Status == BackupJobFailed
+	if (failed && !settings.Backup.OnFailure) || (!failed && !settings.Backup.OnSuccess) {
+		return
+	}
+
+	serverName := strings.TrimSpace(settings.ServerLabel)
+	if serverName == "" {
+		serverName = "本机服务器"
+	}
+	duration := time.Duration(job.FinishedUnixTime-job.StartedUnixTime) * time.Second
+	destination := job.Destination
+	if destination == "" {
+		destination = "未知"
+	}
+
+	var title, content string
+	if failed {
+		title = fmt.Sprintf("备份失败 · %s", serverName)
+		content = fmt.Sprintf(
+			"## ❌ 定时备份失败\n\n* **服务名称**: %s\n* **备份目标**: %s\n* **耗时**: %s\n* **错误信息**: %s\n* **操作建议**: 请检查备份存储配置与任务日志",
+			serverName,
+			destination,
+			duration,
+			job.Error,
+		)
+	} else {
+		title = fmt.Sprintf("备份成功 · %s", serverName)
+		content = fmt.Sprintf(
+			"## ✅ 定时备份完成\n\n* **服务名称**: %s\n* **备份文件**: %s\n* **文件大小**: %s\n* **耗时**: %s\n* **备份目标**: %s",
+			serverName,
+			job.Archive,
+			formatBytes(float64(job.Size)),
+			duration,
+			destination,
+		)
+	}
+	d.dispatch(settings, notifyEventBackup, title, content)
+}
+
+// hasEnabledChannel 是否至少启用了一个通知渠道
+func hasEnabledChannel(settings model.NotificationSettings) bool {
+	return settings.DingTalk.Enabled || settings.Telegram.Enabled || settings.WeCom.Enabled ||
+		settings.Slack.Enabled || settings.Discord.Enabled || settings.Bark.Enabled ||
+		settings.ServerChan.Enabled || settings.Webhook.Enabled
+}
+
+// dispatch 通过已启用的渠道发送告警，配置了路由规则的事件只发送到规则中的渠道，并按渠道记录发送结果
+func (d *NotificationDispatcher) dispatch(settings model.NotificationSettings, event, title, content string) {
+	routes, routed := settings.Routes[event]
+	routed = routed && len(routes) > 0
+
+	var records []NotificationRecord
+	// sender 为当前渠道使用的发送方，按代理设置在每次发送前切换
+	var sender *NotificationDispatcher
+	deliver := func(channel, label string, send func() error) {
+		if routed && !slices.Contains(routes, channel) {
+			return
+		}
+		sender = d.channelSender(settings.Proxy, channel)
+		err := send()
+		record := NotificationRecord{
+			Event:           event,
+			Channel:         channel,
+			Title:           title,
+			Content:         content,
+			Success:         err == nil,
+			CreatedUnixTime: time.Now().Unix(),
+		}
+		if err != nil {
+			record.Error = err.Error()
+			log.Printf("[notification] %s 通知失败: %v", label, err)
 		}
+		records = append(records, record)
 	}
 
+	if settings.DingTalk.Enabled && settings.DingTalk.Webhook != "" {
+		deliver("dingtalk", "钉钉", func() error { return sender.sendDingTalk(settings.DingTalk, title, content) })
+	}
 	if settings.Telegram.Enabled && settings.Telegram.BotToken != "" && settings.Telegram.ChatID != "" {
-		if err := d.sendTelegram(settings.Telegram, title, content); err != nil {
-			log.Printf("[notification] Telegram 通知失败: %v", err)
+		deliver("telegram", "Telegram", func() error { return sender.sendTelegram(settings.Telegram, title, content) })
+	}
+	if settings.WeCom.Enabled && settings.WeCom.Webhook != "" {
+		deliver("wecom", "企业微信", func() error { return sender.sendWeCom(settings.WeCom, content) })
+	}
+	if settings.Slack.Enabled && settings.Slack.Webhook != "" {
+		deliver("slack", "Slack", func() error { return sender.sendSlack(settings.Slack, title, content) })
+	}
+	if settings.Discord.Enabled && settings.Discord.Webhook != "" {
+		deliver("discord", "Discord", func() error { return sender.sendDiscord(settings.Discord, title, content) })
+	}
+	if settings.Bark.Enabled && settings.Bark.DeviceKey != "" {
+		deliver("bark", "Bark", func() error { return sender.sendBark(settings.Bark, title, content) })
+	}
+	if settings.ServerChan.Enabled && settings.ServerChan.SendKey != "" {
+		deliver("serverchan", "Server酱", func() error { return sender.sendServerChan(settings.ServerChan, title, content) })
+	}
+	if settings.Webhook.Enabled && settings.Webhook.URL != "" {
+		deliver("webhook", "Webhook", func() error { return sender.sendWebhook(settings.Webhook, settings.ServerLabel, title, content) })
+	}
+
+	if len(records) > 0 {
+		if err := d.svc.appendHistory(records...); err != nil {
+			log.Printf("[notification] 保存通知记录失败: %v", err)
 		}
 	}
 }
@@ -326,6 +453,14 @@ func (d *NotificationDispatcher) sendDingTalk(cfg model.DingTalkSettings, title,
 	if resp.StatusCode >= 300 {
 		return fmt.Errorf("钉钉返回状态码: %d", resp.StatusCode)
 	}
+	// 钉钉关键词、签名校验失败时同样返回 200，需检查 errcode
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil && result.ErrCode != 0 {
+		return fmt.Errorf("钉钉返回错误: %d %s", result.ErrCode, result.ErrMsg)
+	}
 	return nil
 }
 
@@ -363,6 +498,59 @@ func (d *NotificationDispatcher) sendTelegram(cfg model.TelegramSettings, title,
 	return nil
 }
 
+// sendWebhook 以 JSON 发送告警。配置 Secret 时，X-Nova-Signature 为
+// HMAC-SHA256(secret, 时间戳 + "." + 请求体) 的十六进制值，接收方可据此校验来源并拒绝重放
+func (d *NotificationDispatcher) sendWebhook(cfg model.WebhookSettings, serverLabel, title, content string) error {
+	target := strings.TrimSpace(cfg.URL)
+	if target == "" {
+		return errors.New("Webhook 地址未配置")
+	}
+	method := cfg.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	now := time.Now()
+	body, err := json.Marshal(map[string]interface{}{
+		"title":     title,
+		"content":   content,
+		"text":      buildPlainText(title, content),
+		"server":    strings.TrimSpace(serverLabel),
+		"timestamp": now.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	if cfg.Secret != "" {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		h := hmac.New(sha256.New, []byte(cfg.Secret))
+		h.Write([]byte(timestamp + "."))
+		h.Write(body)
+		req.Header.Set("X-Nova-Timestamp", timestamp)
+		req.Header.Set("X-Nova-Signature", "sha256="+hex.EncodeToString(h.Sum(nil)))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook 返回状态码: %d", resp.StatusCode)
+	}
+	return nil
+}
+
 func buildPlainText(title, content string) string {
 	lines := []string{title, ""}
 	for _, line := range strings.Split(content, "\n") {
@@ -0,0 +1,954 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+func TestNotifyBackup(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Markdown struct {
+				Title string `json:"title"`
+				Text  string `json:"text"`
+			} `json:"markdown"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload.Markdown.Title+"\n"+payload.Markdown.Text)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(dir, "state.json"))
+	// 旧版本保存的配置没有 backup 字段，默认只通知失败
+	legacy := `{"dingtalk":{"enabled":true,"webhook":"` + server.URL + `"},"server_label":"edge-1"}`
+	legacyPath := filepath.Join(dir, "notification_settings.json")
+	if err := os.WriteFile(legacyPath, []byte(legacy), 0600); err != nil {
+		t.Fatalf("write settings: %v", err)
+	}
+	svc.store.migrate(stateKeyNotificationSettings, legacyPath)
+	if _, err := os.Stat(legacyPath + ".migrated"); err != nil {
+		t.Fatalf("legacy file should be renamed after migration: %v", err)
+	}
+	dispatcher := NewNotificationDispatcher(svc, nil)
+
+	dispatcher.NotifyBackup(BackupJob{Status: BackupJobSucceeded, Archive: "nginx_backup_1.tar.gz", Size: 2048})
+	if len(received) != 0 {
+		t.Fatalf("success should not be sent by default: %v", received)
+	}
+	dispatcher.NotifyBackup(BackupJob{Status: BackupJobFailed, Error: "上传备份失败", Destination: "r2:bucket/nginx", StartedUnixTime: 100, FinishedUnixTime: 165})
+	if len(received) != 1 || !strings.Contains(received[0], "备份失败 · edge-1") || !strings.Contains(received[0], "上传备份失败") || !strings.Contains(received[0], "1m5s") {
+		t.Fatalf("unexpected failure notification: %v", received)
+	}
+
+	settings, _ := svc.Get()
+	settings.Backup.OnSuccess = true
+	settings.Backup.OnFailure = false
+	if _, err := svc.Save(settings); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	dispatcher.NotifyBackup(BackupJob{Status: BackupJobFailed, Error: "boom"})
+	dispatcher.NotifyBackup(BackupJob{Status: BackupJobSucceeded, Archive: "nginx_backup_2.tar.gz", Size: 2048, Destination: "r2:bucket/nginx/nginx_backup_2.tar.gz"})
+	if len(received) != 2 || !strings.Contains(received[1], "nginx_backup_2.tar.gz") || !strings.Contains(received[1], "2.00 KB") {
+		t.Fatalf("unexpected success notification: %v", received)
+	}
+}
+
+func TestWebhookNotification(t *testing.T) {
+	var method, auth, signature, timestamp string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		auth = r.Header.Get("Authorization")
+		signature = r.Header.Get("X-Nova-Signature")
+		timestamp = r.Header.Get("X-Nova-Timestamp")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(t.TempDir(), "state.json"))
+	settings, _ := svc.Get()
+	settings.ServerLabel = "edge-1"
+	settings.Webhook = model.WebhookSettings{
+		Enabled: true,
+		URL:     server.URL,
+		Method:  "put",
+		Secret:  "s3cret",
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	}
+	if _, err := svc.Save(settings); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	NewNotificationDispatcher(svc, nil).NotifyBackup(BackupJob{Status: BackupJobFailed, Error: "上传备份失败"})
+
+	if method != http.MethodPut || auth != "Bearer token" {
+		t.Fatalf("unexpected request: method=%s auth=%q", method, auth)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	if signature != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("signature mismatch: %s", signature)
+	}
+	var payload struct {
+		Title  string `json:"title"`
+		Server string `json:"server"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Title != "备份失败 · edge-1" || payload.Server != "edge-1" {
+		t.Fatalf("unexpected payload: %s", body)
+	}
+
+	for _, invalid := range []model.WebhookSettings{
+		{URL: "ftp://example.com"},
+		{URL: server.URL, Method: "GET"},
+		{URL: server.URL, Headers: map[string]string{"Bad Header": "x"}},
+	} {
+		settings.Webhook = invalid
+		if _, err := svc.Save(settings); !errors.Is(err, ErrInvalidNotificationSettings) {
+			t.Fatalf("expected invalid settings for %+v, got %v", invalid, err)
+		}
+	}
+}
+
+func TestSlackDiscordNotification(t *testing.T) {
+	received := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received[r.URL.Path] = string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(t.TempDir(), "state.json"))
+	settings, _ := svc.Get()
+	settings.Slack = model.SlackSettings{Enabled: true, Webhook: server.URL + "/slack"}
+	settings.Discord = model.DiscordSettings{Enabled: true, Webhook: server.URL + "/discord"}
+	if _, err := svc.Save(settings); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	NewNotificationDispatcher(svc, nil).NotifyBackup(BackupJob{Status: BackupJobFailed, Error: "上传备份失败"})
+
+	var slack struct {
+		Blocks []struct {
+			Type string `json:"type"`
+			Text struct {
+				Text string `json:"text"`
+			} `json:"text"`
+		} `json:"blocks"`
+	}
+	if err := json.Unmarshal([]byte(received["/slack"]), &slack); err != nil || len(slack.Blocks) != 2 {
+		t.Fatalf("unexpected slack payload: %s", received["/slack"])
+	}
+	if section := slack.Blocks[1].Text.Text; !strings.HasPrefix(section, "*❌ 定时备份失败*") || !strings.Contains(section, "• *错误信息*: 上传备份失败") {
+		t.Fatalf("unexpected slack mrkdwn: %s", section)
+	}
+
+	var discord struct {
+		Embeds []struct {
+			Title       string `json:"title"`
+			Description string `json:"description"`
+		} `json:"embeds"`
+	}
+	if err := json.Unmarshal([]byte(received["/discord"]), &discord); err != nil || len(discord.Embeds) != 1 {
+		t.Fatalf("unexpected discord payload: %s", received["/discord"])
+	}
+	if embed := discord.Embeds[0]; embed.Title != "备份失败 · 本机服务器" || !strings.Contains(embed.Description, "• **错误信息**: 上传备份失败") {
+		t.Fatalf("unexpected discord embed: %+v", embed)
+	}
+
+	settings.Discord.Webhook = "discord.com/api/webhooks/1"
+	if _, err := svc.Save(settings); !errors.Is(err, ErrInvalidNotificationSettings) {
+		t.Fatalf("expected invalid discord webhook, got %v", err)
+	}
+}
+
+func TestWeComNotification(t *testing.T) {
+	var content string
+	errcode := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			MsgType  string `json:"msgtype"`
+			Markdown struct {
+				Content string `json:"content"`
+			} `json:"markdown"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		content = payload.MsgType + "|" + payload.Markdown.Content
+		json.NewEncoder(w).Encode(map[string]interface{}{"errcode": errcode, "errmsg": "invalid webhook url"})
+	}))
+	defer server.Close()
+
+	dispatcher := NewNotificationDispatcher(NewNotificationService(), nil)
+	cfg := model.WeComSettings{Enabled: true, Webhook: server.URL}
+	if err := dispatcher.sendWeCom(cfg, "## 🚨 流量告警\n\n* **当前利用率**: 91.0%"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if content != "markdown|## 🚨 流量告警\n\n* **当前利用率**: 91.0%" {
+		t.Fatalf("unexpected payload: %q", content)
+	}
+
+	errcode = 93000
+	if err := dispatcher.sendWeCom(cfg, strings.Repeat("流量", 2000)); err == nil || !strings.Contains(err.Error(), "93000") {
+		t.Fatalf("expected errcode to be reported, got %v", err)
+	}
+	if len(content) > len("markdown|")+wecomContentLimit || !strings.HasSuffix(content, "…") {
+		t.Fatalf("content should be truncated to %d bytes, got %d", wecomContentLimit, len(content)-len("markdown|"))
+	}
+}
+
+func TestBarkServerChanNotification(t *testing.T) {
+	received := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/push" {
+			var payload map[string]string
+			json.NewDecoder(r.Body).Decode(&payload)
+			received["bark"] = payload["device_key"] + "|" + payload["title"] + "|" + payload["body"]
+			w.Write([]byte(`{"code":200,"message":"success"}`))
+			return
+		}
+		r.ParseForm()
+		received[r.URL.Path] = r.PostForm.Get("title") + "|" + r.PostForm.Get("desp")
+		w.Write([]byte(`{"code":0,"message":""}`))
+	}))
+	defer server.Close()
+	defer func(api string) { serverChanAPI = api }(serverChanAPI)
+	serverChanAPI = server.URL
+
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(t.TempDir(), "state.json"))
+	settings, _ := svc.Get()
+	if settings.Bark.Server != defaultBarkServer {
+		t.Fatalf("unexpected default bark server: %q", settings.Bark.Server)
+	}
+	settings.Bark = model.BarkSettings{Enabled: true, Server: server.URL + "/", DeviceKey: "abc123"}
+	settings.ServerChan = model.ServerChanSettings{Enabled: true, SendKey: "SCT1key"}
+	if _, err := svc.Save(settings); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	NewNotificationDispatcher(svc, nil).NotifyBackup(BackupJob{Status: BackupJobFailed, Error: "上传备份失败"})
+
+	if bark := received["bark"]; !strings.HasPrefix(bark, "abc123|备份失败 · 本机服务器|❌ 定时备份失败") || !strings.Contains(bark, "• 错误信息: 上传备份失败") {
+		t.Fatalf("unexpected bark push: %q", bark)
+	}
+	if push := received["/SCT1key.send"]; !strings.HasPrefix(push, "备份失败 · 本机服务器|## ❌ 定时备份失败") {
+		t.Fatalf("unexpected serverchan push: %q", push)
+	}
+	if got := serverChanURL("sctp123tABC"); got != "https://123.push.ft07.com/send/sctp123tABC.send" {
+		t.Fatalf("unexpected Server酱³ url: %s", got)
+	}
+
+	settings.ServerChan.SendKey = "../key"
+	if _, err := svc.Save(settings); !errors.Is(err, ErrInvalidNotificationSettings) {
+		t.Fatalf("expected invalid send key, got %v", err)
+	}
+}
+
+func TestNotificationSettingsRedaction(t *testing.T) {
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(t.TempDir(), "state.json"))
+	settings, _ := svc.Get()
+	settings.DingTalk = model.DingTalkSettings{Enabled: true, Webhook: "https://oapi.dingtalk.com/robot/send?access_token=dt", Secret: "SECdt"}
+	settings.Telegram = model.TelegramSettings{Enabled: true, BotToken: "123:tg", ChatID: "42"}
+	settings.Slack = model.SlackSettings{Enabled: true, Webhook: "https://hooks.slack.com/services/sl"}
+	settings.ServerChan = model.ServerChanSettings{Enabled: true, SendKey: "SCTsc"}
+	settings.Webhook = model.WebhookSettings{Enabled: true, URL: "https://hooks.example.com", Secret: "wh", Headers: map[string]string{"Authorization": "Bearer wh"}}
+	saved, err := svc.Save(settings)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	redacted := RedactNotificationSettings(saved)
+	data, _ := json.Marshal(redacted)
+	for _, secret := range []string{"access_token=dt", "SECdt", "123:tg", "services/sl", "SCTsc", "Bearer wh"} {
+		if strings.Contains(string(data), secret) {
+			t.Fatalf("%s should be redacted: %s", secret, data)
+		}
+	}
+	if !redacted.DingTalk.HasWebhook || !redacted.DingTalk.HasSecret || !redacted.Telegram.HasBotToken || redacted.Telegram.ChatID != "42" ||
+		!redacted.Slack.HasWebhook || redacted.Discord.HasWebhook || !redacted.ServerChan.HasSendKey || !redacted.Webhook.HasSecret {
+		t.Fatalf("unexpected has_* flags: %+v", redacted)
+	}
+	if value, ok := redacted.Webhook.Headers["Authorization"]; !ok || value != "" {
+		t.Fatalf("header names should be kept without values: %v", redacted.Webhook.Headers)
+	}
+
+	// 把查询结果原样提交：留空的密钥沿用原值，新填写的值覆盖原值
+	redacted.Telegram.ChatID = "43"
+	redacted.Slack.Webhook = "https://hooks.slack.com/services/new"
+	if _, err := svc.Save(redacted); err != nil {
+		t.Fatalf("save redacted: %v", err)
+	}
+	current, _ := svc.Get()
+	if current.DingTalk != settings.DingTalk || current.Telegram.BotToken != "123:tg" || current.Telegram.ChatID != "43" ||
+		current.Slack.Webhook != "https://hooks.slack.com/services/new" || current.ServerChan.SendKey != "SCTsc" ||
+		current.Webhook.Secret != "wh" || current.Webhook.Headers["Authorization"] != "Bearer wh" {
+		t.Fatalf("blank secrets should keep the saved values: %+v", current)
+	}
+
+	// 测试通知使用表单配置时同样沿用已保存的密钥
+	normalized, err := svc.Normalize(RedactNotificationSettings(current))
+	if err != nil || normalized.Telegram.BotToken != "123:tg" || normalized.Webhook.Headers["Authorization"] != "Bearer wh" {
+		t.Fatalf("normalize should fill saved secrets: %+v %v", normalized, err)
+	}
+}
+
+func TestSendTestNotification(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errcode":310000,"errmsg":"keywords not in content"}`))
+	}))
+	defer server.Close()
+
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(t.TempDir(), "state.json"))
+	dispatcher := NewNotificationDispatcher(svc, nil)
+	settings := model.NotificationSettings{
+		ServerLabel: "edge-1",
+		// 未启用的渠道同样可以测试
+		WeCom:    model.WeComSettings{Webhook: server.URL},
+		DingTalk: model.DingTalkSettings{Webhook: server.URL},
+	}
+
+	result, err := dispatcher.SendTest("wecom", settings)
+	if err != nil {
+		t.Fatalf("send test: %v", err)
+	}
+	if result.Success || result.StatusCode != http.StatusOK || !strings.Contains(result.Response, "keywords not in content") || !strings.Contains(result.Error, "310000") {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	result, err = dispatcher.SendTest("dingtalk", settings)
+	if err != nil || result.Success || !strings.Contains(result.Error, "keywords not in content") {
+		t.Fatalf("unexpected dingtalk result: %+v, %v", result, err)
+	}
+
+	if result, _ := dispatcher.SendTest("slack", settings); result.Success || result.Error == "" {
+		t.Fatalf("unconfigured channel should fail: %+v", result)
+	}
+	if _, err := dispatcher.SendTest("sms", settings); !errors.Is(err, ErrUnknownNotificationChannel) {
+		t.Fatalf("expected unknown channel, got %v", err)
+	}
+	if history, _ := svc.History(notifyEventTest, 0); len(history) != 3 || history[0].Channel != "slack" || history[2].Channel != "wecom" {
+		t.Fatalf("test notifications should be recorded, got %+v", history)
+	}
+}
+
+func TestNginxWatchdog(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Title   string `json:"title"`
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload.Title+"\n"+payload.Content)
+	}))
+	defer server.Close()
+
+	root := t.TempDir()
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(root, "state.json"))
+	settings, _ := svc.Get()
+	if !settings.NginxWatchdog.Enabled || settings.NginxWatchdog.AutoRestart {
+		t.Fatalf("unexpected watchdog defaults: %+v", settings.NginxWatchdog)
+	}
+	settings.Webhook = model.WebhookSettings{Enabled: true, URL: server.URL, Method: http.MethodPost}
+
+	state, restarts := "active", 0
+	dispatcher := NewNotificationDispatcher(svc, nil)
+	dispatcher.watchdog.binary = filepath.Join(root, "nginx")
+	dispatcher.watchdog.errorLog = filepath.Join(root, "error.log")
+	dispatcher.watchdog.pidFile = filepath.Join(root, "nginx.pid")
+	dispatcher.watchdog.state = func() string { return state }
+	dispatcher.watchdog.restart = func() error {
+		restarts++
+		state = "active"
+		return os.Remove(dispatcher.watchdog.pidFile)
+	}
+	os.WriteFile(dispatcher.watchdog.binary, []byte("{}"), 0600)
+	os.WriteFile(dispatcher.watchdog.errorLog, []byte("old line\n[emerg] bind() to 0.0.0.0:80 failed\n\n"), 0644)
+
+	dispatcher.checkNginx(settings)
+	state = "failed"
+	dispatcher.checkNginx(settings)
+	dispatcher.checkNginx(settings)
+	if len(received) != 1 || !strings.Contains(received[0], "异常退出（failed）") || !strings.Contains(received[0], "[emerg] bind()") {
+		t.Fatalf("expected a single down alert with error log, got %v", received)
+	}
+	state = "active"
+	dispatcher.checkNginx(settings)
+	if len(received) != 2 || !strings.HasPrefix(received[1], "Nginx 已恢复") {
+		t.Fatalf("expected recovery notice, got %v", received)
+	}
+
+	// 主进程消失时自动重启，重启成功不再发送恢复通知
+	settings.NginxWatchdog.AutoRestart = true
+	os.WriteFile(dispatcher.watchdog.pidFile, []byte("999999999"), 0644)
+	dispatcher.checkNginx(settings)
+	dispatcher.checkNginx(settings)
+	if restarts != 1 || len(received) != 3 || !strings.Contains(received[2], "主进程不存在") || !strings.Contains(received[2], "已成功重启") {
+		t.Fatalf("expected auto restart, got %d restarts and %v", restarts, received)
+	}
+
+	// 手动停止不自动重启
+	state = "inactive"
+	dispatcher.checkNginx(settings)
+	if restarts != 1 || len(received) != 4 || strings.Contains(received[3], "自动重启") {
+		t.Fatalf("inactive nginx should not be restarted: %d, %v", restarts, received)
+	}
+}
+
+func TestDiskAlert(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload.Content)
+	}))
+	defer server.Close()
+
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(t.TempDir(), "state.json"))
+	settings, _ := svc.Get()
+	if settings.DiskThreshold != 90 {
+		t.Fatalf("unexpected default disk threshold: %d", settings.DiskThreshold)
+	}
+	settings.Webhook = model.WebhookSettings{Enabled: true, URL: server.URL, Method: http.MethodPost}
+
+	const gb = 1 << 30
+	stats := map[string]diskStat{
+		"/":        {Device: 1, Total: 100 * gb, Used: 95 * gb},
+		"/var/log": {Device: 1, Total: 100 * gb, Used: 95 * gb},
+		"/backup":  {Device: 2, Total: 100 * gb, Used: 10 * gb},
+	}
+	dispatcher := NewNotificationDispatcher(svc, nil)
+	dispatcher.disk.paths = []string{"/", "/var/log", "/backup", "/missing"}
+	dispatcher.disk.stat = func(path string) (diskStat, error) {
+		stat, ok := stats[path]
+		if !ok {
+			return diskStat{}, os.ErrNotExist
+		}
+		return stat, nil
+	}
+
+	dispatcher.checkDisk(settings)
+	dispatcher.checkDisk(settings)
+	if len(received) != 1 || !strings.Contains(received[0], "**/、/var/log**: 已用 95.0%") || strings.Contains(received[0], "/backup") {
+		t.Fatalf("expected one alert for the shared root disk, got %v", received)
+	}
+
+	// 恢复正常后重新计算冷却时间
+	stats["/"] = diskStat{Device: 1, Total: 100 * gb, Used: 50 * gb}
+	stats["/var/log"] = stats["/"]
+	dispatcher.checkDisk(settings)
+	stats["/backup"] = diskStat{Device: 2, Total: 100 * gb, Used: 99 * gb}
+	dispatcher.checkDisk(settings)
+	if len(received) != 2 || !strings.Contains(received[1], "**/backup**: 已用 99.0%") {
+		t.Fatalf("expected backup disk alert, got %v", received)
+	}
+
+	if stat, err := statDisk(t.TempDir()); err != nil || stat.Total == 0 || stat.Used > stat.Total {
+		t.Fatalf("unexpected statDisk result: %+v, %v", stat, err)
+	}
+}
+
+func TestErrorRateAlert(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Title   string `json:"title"`
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload.Title+"\n"+payload.Content)
+	}))
+	defer server.Close()
+
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(t.TempDir(), "state.json"))
+	settings, _ := svc.Get()
+	settings.Webhook = model.WebhookSettings{Enabled: true, URL: server.URL, Method: http.MethodPost}
+	settings.ErrorRate = model.ErrorRateAlertSettings{Enabled: true, Threshold: 20, WindowMinutes: 5, MinRequests: 10}
+	settings, err := svc.Normalize(settings)
+	if err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+
+	logDir := t.TempDir()
+	logPath := filepath.Join(logDir, "a.com-access.log")
+	entry := func(uri string, status int) string {
+		return `1.2.3.4 - - [16/Oct/2026:10:00:00 +0800] "GET ` + uri + ` HTTP/1.1" ` + strconv.Itoa(status) + ` 512 "-" "curl/8.0"` + "\n"
+	}
+	os.WriteFile(logPath, []byte(strings.Repeat(entry("/old", 502), 50)), 0644)
+
+	dispatcher := NewNotificationDispatcher(svc, nil)
+	dispatcher.errorRate.logDir = logDir
+	// 首次读取从文件末尾开始，已有的错误不告警
+	dispatcher.checkErrorRate(settings)
+
+	var lines string
+	lines += strings.Repeat(entry("/", 200), 6)
+	lines += strings.Repeat(entry("/api/pay?id=1", 502), 3) + entry("/api/pay?id=2", 504) + entry("/login", 500)
+	file, _ := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(lines + `1.2.3.4 - - [16/Oct/2026:10:00:01 +0800] "GET /partial`)
+	file.Close()
+
+	dispatcher.checkErrorRate(settings)
+	dispatcher.checkErrorRate(settings)
+	if len(received) != 1 {
+		t.Fatalf("expected one alert, got %v", received)
+	}
+	alert := received[0]
+	if !strings.HasPrefix(alert, "5xx 告警 · a.com") || !strings.Contains(alert, "45.5%（5 个") || !strings.Contains(alert, "共 11 个请求") ||
+		!strings.Contains(alert, "- `/api/pay`: 4 次") || strings.Contains(alert, "/old") {
+		t.Fatalf("unexpected alert: %s", alert)
+	}
+	if strings.Index(alert, "/api/pay") > strings.Index(alert, "/login") {
+		t.Fatalf("failing URIs should be sorted by count: %s", alert)
+	}
+
+	// 日志被轮转后从头读取
+	os.WriteFile(logPath, []byte(entry("/", 200)), 0644)
+	dispatcher.checkErrorRate(settings)
+	if offset := dispatcher.errorRate.offsets[logPath]; offset != int64(len(entry("/", 200))) {
+		t.Fatalf("unexpected offset after rotation: %d", offset)
+	}
+}
+
+func TestLatencyAlert(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Title   string `json:"title"`
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload.Title+"\n"+payload.Content)
+	}))
+	defer server.Close()
+
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(t.TempDir(), "state.json"))
+	settings, _ := svc.Get()
+	settings.Webhook = model.WebhookSettings{Enabled: true, URL: server.URL, Method: http.MethodPost}
+	settings.Latency = model.LatencyAlertSettings{Enabled: true, Percentile: 99, ThresholdMs: 1000, WindowMinutes: 5, MinRequests: 10}
+	settings, err := svc.Normalize(settings)
+	if err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if _, err := svc.Normalize(model.NotificationSettings{Latency: model.LatencyAlertSettings{Percentile: 90}}); !errors.Is(err, ErrInvalidNotificationSettings) {
+		t.Fatalf("expected invalid percentile error, got %v", err)
+	}
+
+	logDir := t.TempDir()
+	logPath := filepath.Join(logDir, "a.com-access.log")
+	entry := func(rt string) string {
+		return `1.2.3.4 - - [16/Oct/2026:10:00:00 +0800] "GET / HTTP/1.1" 200 512 "-" "curl/8.0" rt=` + rt + ` urt="` + rt + `"` + "\n"
+	}
+	os.WriteFile(logPath, nil, 0644)
+	dispatcher := NewNotificationDispatcher(svc, nil)
+	dispatcher.latency.logDir = logDir
+	dispatcher.checkLatency(settings)
+
+	// 未使用 main_timing 格式的日志行不计入
+	file, _ := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(strings.Repeat(entry("0.020"), 9) + strings.Repeat(`1.2.3.4 - - [16/Oct/2026:10:00:00 +0800] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"`+"\n", 20))
+	file.Close()
+	dispatcher.checkLatency(settings)
+	if len(received) != 0 {
+		t.Fatalf("expected no alert below min requests, got %v", received)
+	}
+
+	file, _ = os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(strings.Repeat(entry("2.500"), 2))
+	file.Close()
+	dispatcher.checkLatency(settings)
+	dispatcher.checkLatency(settings)
+	if len(received) != 1 {
+		t.Fatalf("expected one alert, got %v", received)
+	}
+	if alert := received[0]; !strings.HasPrefix(alert, "延迟告警 · a.com") || !strings.Contains(alert, "共 11 个请求") || !strings.Contains(alert, "阈值 1000 ms") {
+		t.Fatalf("unexpected alert: %s", alert)
+	}
+}
+
+func TestNotificationHistory(t *testing.T) {
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(t.TempDir(), "state.json"))
+	settings, _ := svc.Get()
+	settings.DingTalk = model.DingTalkSettings{Enabled: true, Webhook: server.URL}
+	settings.Webhook = model.WebhookSettings{Enabled: true, URL: server.URL, Method: http.MethodPost}
+	dispatcher := NewNotificationDispatcher(svc, nil)
+
+	dispatcher.dispatch(settings, notifyEventDisk, "磁盘空间告警", "## 💾 磁盘空间告警")
+	fail = true
+	dispatcher.dispatch(settings, notifyEventBackup, "备份失败", "## ❌ 定时备份失败")
+
+	history, err := svc.History("", 0)
+	if err != nil || len(history) != 4 {
+		t.Fatalf("expected 4 records, got %+v, %v", history, err)
+	}
+	if latest := history[0]; latest.Event != notifyEventBackup || latest.Channel != "webhook" || latest.Success || !strings.Contains(latest.Error, "502") {
+		t.Fatalf("unexpected latest record: %+v", latest)
+	}
+	if oldest := history[3]; oldest.Channel != "dingtalk" || !oldest.Success || oldest.Content != "## 💾 磁盘空间告警" || oldest.CreatedUnixTime == 0 {
+		t.Fatalf("unexpected oldest record: %+v", oldest)
+	}
+	if disk, _ := svc.History(notifyEventDisk, 1); len(disk) != 1 || disk[0].Channel != "webhook" {
+		t.Fatalf("unexpected filtered history: %+v", disk)
+	}
+
+	for i := 0; i < maxNotificationHistory; i++ {
+		svc.appendHistory(NotificationRecord{Event: notifyEventTraffic})
+	}
+	if all, _ := svc.History("", 0); len(all) != maxNotificationHistory || all[len(all)-1].Event != notifyEventTraffic {
+		t.Fatalf("history should keep the newest %d records, got %d", maxNotificationHistory, len(all))
+	}
+
+	// 长消息截断，总大小超出上限时丢弃最早的记录
+	long := strings.Repeat("流量", maxNotificationContentRunes)
+	for i := 0; i < 100; i++ {
+		svc.appendHistory(NotificationRecord{Event: notifyEventDigest, Content: long, Error: long})
+	}
+	all, _ := svc.History("", 0)
+	if latest := all[0]; len([]rune(latest.Content)) != maxNotificationContentRunes || len([]rune(latest.Error)) != maxNotificationErrorRunes {
+		t.Fatalf("long fields should be truncated: %d %d", len([]rune(latest.Content)), len([]rune(latest.Error)))
+	}
+	data, _ := json.Marshal(all)
+	if len(data) > maxNotificationHistoryBytes || len(all) >= maxNotificationHistory || all[len(all)-1].Event != notifyEventDigest {
+		t.Fatalf("history should be capped at %d bytes, got %d bytes in %d records", maxNotificationHistoryBytes, len(data), len(all))
+	}
+}
+
+func TestNotificationRoutes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(t.TempDir(), "state.json"))
+	settings, _ := svc.Get()
+	settings.DingTalk = model.DingTalkSettings{Enabled: true, Webhook: server.URL}
+	settings.WeCom = model.WeComSettings{Enabled: true, Webhook: server.URL + "/wecom"}
+	settings.Webhook = model.WebhookSettings{Enabled: true, URL: server.URL, Method: http.MethodPost}
+	settings.Routes = map[string][]string{
+		notifyEventTraffic: {"webhook", "webhook"},
+		notifyEventExpiry:  {"dingtalk", "slack"},
+		notifyEventDisk:    {},
+	}
+	saved, err := svc.Save(settings)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if len(saved.Routes) != 2 || len(saved.Routes[notifyEventTraffic]) != 1 {
+		t.Fatalf("routes should be deduplicated and empty rules dropped: %v", saved.Routes)
+	}
+
+	dispatcher := NewNotificationDispatcher(svc, nil)
+	channelsOf := func(event string) []string {
+		history, _ := svc.History(event, 0)
+		var channels []string
+		for _, record := range history {
+			channels = append(channels, record.Channel)
+		}
+		return channels
+	}
+	dispatcher.dispatch(saved, notifyEventTraffic, "流量告警", "流量")
+	dispatcher.dispatch(saved, notifyEventExpiry, "续费提醒", "到期")
+	dispatcher.dispatch(saved, notifyEventDisk, "磁盘空间告警", "磁盘")
+	if got := channelsOf(notifyEventTraffic); len(got) != 1 || got[0] != "webhook" {
+		t.Fatalf("traffic alert should only go to webhook, got %v", got)
+	}
+	// slack 未启用，路由中的未启用渠道不会发送
+	if got := channelsOf(notifyEventExpiry); len(got) != 1 || got[0] != "dingtalk" {
+		t.Fatalf("expiry alert should only go to dingtalk, got %v", got)
+	}
+	if got := channelsOf(notifyEventDisk); len(got) != 3 {
+		t.Fatalf("unrouted events should go to every enabled channel, got %v", got)
+	}
+
+	for _, routes := range []map[string][]string{
+		{"reboot": {"dingtalk"}},
+		{notifyEventTraffic: {"email"}},
+	} {
+		settings.Routes = routes
+		if _, err := svc.Save(settings); !errors.Is(err, ErrInvalidNotificationSettings) {
+			t.Fatalf("expected invalid routes for %v, got %v", routes, err)
+		}
+	}
+}
+
+func TestTrafficLimitAction(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload.Content)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(dir, "state.json"))
+	settings, _ := svc.Get()
+	settings.Webhook = model.WebhookSettings{Enabled: true, URL: server.URL, Method: http.MethodPost}
+
+	for _, action := range []model.TrafficLimitActionSettings{
+		{Action: "shutdown"},
+		{Action: trafficActionLimitRate, LimitRate: "fast"},
+		{Action: trafficActionDisableSites},
+		{Action: trafficActionDisableSites, Sites: []string{"../nginx.conf"}},
+	} {
+		settings.TrafficLimitAction = action
+		if _, err := svc.Save(settings); !errors.Is(err, ErrInvalidNotificationSettings) {
+			t.Fatalf("expected invalid action for %+v, got %v", action, err)
+		}
+	}
+
+	confDir := filepath.Join(dir, "nginx")
+	for _, sub := range []string{"sites-available", "sites-enabled"} {
+		os.MkdirAll(filepath.Join(confDir, sub), 0755)
+	}
+	for _, site := range []string{"a.example.com", "b.example.com"} {
+		available := filepath.Join(confDir, "sites-available", site)
+		os.WriteFile(available, []byte("server {}\n"), 0644)
+		os.Symlink(available, filepath.Join(confDir, "sites-enabled", site))
+	}
+
+	var commands []string
+	dispatcher := NewNotificationDispatcher(svc, NewTrafficUsageManager(filepath.Join(dir, "state.json")))
+	dispatcher.limiter = trafficLimiter{
+		confDir: confDir,
+		run: func(name string, args ...string) (string, error) {
+			commands = append(commands, strings.Join(append([]string{filepath.Base(name)}, args...), " "))
+			return "", nil
+		},
+	}
+
+	settings.TrafficLimitAction = model.TrafficLimitActionSettings{Action: trafficActionDisableSites, Sites: []string{"a.example.com", "a.example.com", "missing.example.com"}}
+	saved, err := svc.Save(settings)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if len(saved.TrafficLimitAction.Sites) != 2 {
+		t.Fatalf("sites should be deduplicated: %v", saved.TrafficLimitAction.Sites)
+	}
+
+	const gb = 1 << 30
+	cycleStart := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)
+	cycle := TrafficCycle{UsedBytes: 50 * gb, LimitBytes: 100 * gb, CycleStart: cycleStart}
+	dispatcher.handleTrafficLimit(saved, cycle)
+	if len(received) != 0 || len(commands) != 0 {
+		t.Fatalf("no action expected below the limit: %v %v", received, commands)
+	}
+
+	cycle.UsedBytes = 101 * gb
+	dispatcher.handleTrafficLimit(saved, cycle)
+	dispatcher.handleTrafficLimit(saved, cycle)
+	if len(received) != 1 || !strings.Contains(received[0], "已停用站点 a.example.com") {
+		t.Fatalf("expected one traffic limit alert, got %v", received)
+	}
+	if _, err := os.Lstat(filepath.Join(confDir, "sites-enabled", "a.example.com")); !os.IsNotExist(err) {
+		t.Fatalf("site a should be disabled: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(confDir, "sites-enabled", "b.example.com")); err != nil {
+		t.Fatalf("site b should stay enabled: %v", err)
+	}
+	if strings.Join(commands, ";") != "nginx -t;systemctl reload nginx" {
+		t.Fatalf("unexpected commands: %v", commands)
+	}
+
+	// 进入新周期后恢复停用的站点
+	next := TrafficCycle{UsedBytes: gb, LimitBytes: 100 * gb, CycleStart: cycleStart.AddDate(0, 1, 0)}
+	dispatcher.handleTrafficLimit(saved, next)
+	if _, err := os.Lstat(filepath.Join(confDir, "sites-enabled", "a.example.com")); err != nil {
+		t.Fatalf("site a should be re-enabled: %v", err)
+	}
+	if len(received) != 2 || !strings.Contains(received[1], "已撤销上一周期的超额动作") {
+		t.Fatalf("expected reset notice, got %v", received)
+	}
+	if record, _ := dispatcher.trafficMgr.limitRecord(); record != nil {
+		t.Fatalf("limit record should be cleared: %+v", record)
+	}
+
+	// 全局限速写入 http 级别配置
+	os.WriteFile(filepath.Join(confDir, "nginx.conf"), []byte("http {\n    include sites-enabled/*;\n}\n"), 0644)
+	saved.TrafficLimitAction = model.TrafficLimitActionSettings{Action: trafficActionLimitRate, LimitRate: "512k"}
+	next.UsedBytes = 100 * gb
+	dispatcher.handleTrafficLimit(saved, next)
+	data, _ := os.ReadFile(filepath.Join(confDir, "traffic_limit.conf"))
+	conf, _ := os.ReadFile(filepath.Join(confDir, "nginx.conf"))
+	if string(data) != "limit_rate 512k;\n" || !strings.Contains(string(conf), "include "+filepath.Join(confDir, "traffic_limit.conf")+";") {
+		t.Fatalf("unexpected limit config: %q\n%s", data, conf)
+	}
+	if len(received) != 3 || !strings.Contains(received[2], "已全局限速 512k/连接") {
+		t.Fatalf("expected limit_rate alert, got %v", received)
+	}
+}
+
+func TestDailyDigest(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload.Content)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(dir, "state.json"))
+	settings, _ := svc.Get()
+	settings.Webhook = model.WebhookSettings{Enabled: true, URL: server.URL, Method: http.MethodPost}
+	settings.DailyDigest = model.DailyDigestSettings{Enabled: true, Time: "25:00"}
+	if _, err := svc.Save(settings); !errors.Is(err, ErrInvalidNotificationSettings) {
+		t.Fatalf("expected invalid digest time, got %v", err)
+	}
+	settings.DailyDigest.Time = "09:30"
+
+	now := time.Date(2026, 3, 10, 9, 45, 0, 0, time.Local)
+	logDir := filepath.Join(dir, "logs")
+	acmeDir := filepath.Join(dir, "acme")
+	os.MkdirAll(logDir, 0755)
+	os.MkdirAll(acmeDir, 0755)
+	logLine := func(at time.Time, status int) string {
+		return fmt.Sprintf("1.2.3.4 - - [%s] \"GET /index HTTP/1.1\" %d 512 \"-\" \"curl\"\n", at.Format("02/Jan/2006:15:04:05 -0700"), status)
+	}
+	os.WriteFile(filepath.Join(logDir, "a.example.com-access.log.1"), []byte(logLine(now.Add(-30*time.Hour), 200)+logLine(now.Add(-20*time.Hour), 404)), 0644)
+	os.WriteFile(filepath.Join(logDir, "a.example.com-access.log"), []byte(logLine(now.Add(-time.Hour), 200)+logLine(now.Add(-time.Minute), 502)), 0644)
+	os.WriteFile(filepath.Join(logDir, "b.example.com-access.log"), []byte(logLine(now.Add(-time.Hour), 200)), 0644)
+	writeTestCert(t, acmeDir, "old", "a.example.com", now.AddDate(0, 0, 5))
+	writeTestCert(t, acmeDir, "new", "a.example.com", now.AddDate(0, 0, 80))
+	writeTestCert(t, acmeDir, "b", "b.example.com", now.AddDate(0, 0, 10))
+	schedulePath := filepath.Join(dir, "backup_schedule.json")
+	schedule, _ := json.Marshal(model.BackupSchedule{LastRunUnixTime: now.Add(-6 * time.Hour).Unix(), LastError: "上传失败"})
+	os.WriteFile(schedulePath, schedule, 0600)
+
+	newDispatcher := func() *NotificationDispatcher {
+		dispatcher := NewNotificationDispatcher(svc, NewTrafficUsageManager(filepath.Join(dir, "state.json")))
+		dispatcher.digest.logDir = logDir
+		dispatcher.digest.acmeDir = acmeDir
+		dispatcher.digest.schedulePath = schedulePath
+		return dispatcher
+	}
+	dispatcher := newDispatcher()
+	dispatcher.checkDigest(settings, now.Add(-time.Hour))
+	if len(received) != 0 {
+		t.Fatalf("digest should wait for the configured time, got %v", received)
+	}
+	dispatcher.checkDigest(settings, now)
+	dispatcher.checkDigest(settings, now.Add(time.Minute))
+	if len(received) != 1 {
+		t.Fatalf("expected one digest, got %v", received)
+	}
+	for _, want := range []string{
+		"**合计**: 4 个请求，4xx 1 个，5xx 1 个",
+		"a.example.com: 3 个请求（4xx 1，5xx 1）",
+		"b.example.com: " + now.AddDate(0, 0, 10).Format("2006-01-02") + " 到期（剩余 10 天） ⚠️",
+	} {
+		if !strings.Contains(received[0], want) {
+			t.Fatalf("digest missing %q:\n%s", want, received[0])
+		}
+	}
+	if strings.Contains(received[0], now.AddDate(0, 0, 5).Format("2006-01-02")) || !strings.Contains(received[0], "失败: 上传失败") {
+		t.Fatalf("unexpected cert or backup section:\n%s", received[0])
+	}
+
+	// 重启后从通知历史恢复发送时间，不会重复发送
+	newDispatcher().checkDigest(settings, now.Add(2*time.Hour))
+	if len(received) != 1 {
+		t.Fatalf("digest should not be resent after restart, got %d", len(received))
+	}
+	dispatcher.checkDigest(settings, now.AddDate(0, 0, 1))
+	if len(received) != 2 {
+		t.Fatalf("expected next day's digest, got %d", len(received))
+	}
+}
+
+func TestNotificationProxy(t *testing.T) {
+	var direct, proxied []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		direct = append(direct, r.URL.Path)
+	}))
+	defer target.Close()
+	// HTTP 代理收到的是绝对地址，这里直接应答而不转发
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+	}))
+	defer proxy.Close()
+
+	svc := NewNotificationService()
+	svc.store = openStateStore(filepath.Join(t.TempDir(), "state.json"))
+	settings, _ := svc.Get()
+	settings.Webhook = model.WebhookSettings{Enabled: true, URL: target.URL + "/webhook", Method: http.MethodPost}
+	settings.Slack = model.SlackSettings{Enabled: true, Webhook: target.URL + "/slack"}
+
+	for _, proxyCfg := range []model.NotificationProxySettings{
+		{URL: "ftp://127.0.0.1:21"},
+		{URL: "127.0.0.1:1080"},
+		{URL: proxy.URL, Channels: []string{"email"}},
+	} {
+		settings.Proxy = proxyCfg
+		if _, err := svc.Save(settings); !errors.Is(err, ErrInvalidNotificationSettings) {
+			t.Fatalf("expected invalid proxy for %+v, got %v", proxyCfg, err)
+		}
+	}
+
+	settings.Proxy = model.NotificationProxySettings{URL: proxy.URL, Channels: []string{"webhook", "webhook"}}
+	saved, err := svc.Save(settings)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if len(saved.Proxy.Channels) != 1 {
+		t.Fatalf("proxy channels should be deduplicated: %v", saved.Proxy.Channels)
+	}
+
+	dispatcher := NewNotificationDispatcher(svc, nil)
+	dispatcher.dispatch(saved, notifyEventDisk, "磁盘空间告警", "磁盘")
+	if len(proxied) != 1 || proxied[0] != target.URL+"/webhook" {
+		t.Fatalf("webhook should go through the proxy, got %v", proxied)
+	}
+	if len(direct) != 1 || direct[0] != "/slack" {
+		t.Fatalf("slack should be sent directly, got %v", direct)
+	}
+
+	// 未指定渠道时所有渠道都走代理
+	saved.Proxy.Channels = nil
+	result, err := dispatcher.SendTest("slack", saved)
+	if err != nil || !result.Success {
+		t.Fatalf("test through proxy failed: %+v, %v", result, err)
+	}
+	if len(proxied) != 2 || proxied[1] != target.URL+"/slack" || len(direct) != 1 {
+		t.Fatalf("test notification should use the proxy, proxied %v direct %v", proxied, direct)
+	}
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+const (
+	// errorRateCooldown 同一域名的重复告警间隔
+	errorRateCooldown = 30 * time.Minute
+	// errorRateMaxRead 每个周期从单个日志读取的上限，超出时跳过较早的部分
+	errorRateMaxRead = 8 << 20
+	errorRateTopURIs = 5
+)
+
+type errorRateBucket struct {
+	at     time.Time
+	total  int
+	errors int
+	uris   map[string]int
+}
+
+// errorRateWatch 增量读取各站点的访问日志，按域名统计滑动窗口内的 5xx 比例
+type errorRateWatch struct {
+	logDir    string
+	offsets   map[string]int64
+	buckets   map[string][]errorRateBucket
+	lastAlert map[string]time.Time
+}
+
+func newErrorRateWatch() errorRateWatch {
+	return errorRateWatch{
+		logDir:    model.NginxLogDir,
+		offsets:   make(map[string]int64),
+		buckets:   make(map[string][]errorRateBucket),
+		lastAlert: make(map[string]time.Time),
+	}
+}
+
+func (w *errorRateWatch) readNew(path string) ([]byte, error) {
+	return readNewLogLines(w.offsets, path)
+}
+
+// readNewLogLines 返回日志自上次读取后新增的完整行，offsets 记录各文件的读取位置。
+// 首次读取从文件末尾开始，文件变小（被轮转）时从头读取
+func readNewLogLines(offsets map[string]int64, path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	offset, seen := offsets[path]
+	if !seen {
+		offsets[path] = info.Size()
+		return nil, nil
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+	if info.Size()-offset > errorRateMaxRead {
+		offset = info.Size() - errorRateMaxRead
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(file, info.Size()-offset))
+	if err != nil {
+		return nil, err
+	}
+	// 只处理完整的行，未写完的行留到下个周期
+	end := bytes.LastIndexByte(data, '\n') + 1
+	offsets[path] = offset + int64(end)
+	return data[:end], nil
+}
+
+func (d *NotificationDispatcher) checkErrorRate(settings model.NotificationSettings) {
+	cfg := settings.ErrorRate
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w := &d.errorRate
+	if !cfg.Enabled {
+		w.offsets = make(map[string]int64)
+		w.buckets = make(map[string][]errorRateBucket)
+		return
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(w.logDir, "*-access.log"))
+	now := time.Now()
+	window := time.Duration(cfg.WindowMinutes) * time.Minute
+	for _, path := range paths {
+		domain := strings.TrimSuffix(filepath.Base(path), "-access.log")
+		data, err := w.readNew(path)
+		if err != nil {
+			continue
+		}
+
+		bucket := errorRateBucket{at: now, uris: make(map[string]int)}
+		for _, line := range strings.Split(string(data), "\n") {
+			entry, ok := parseAccessLine(line)
+			if !ok {
+				continue
+			}
+			bucket.total++
+			if entry.Status >= 500 && entry.Status <= 599 {
+				bucket.errors++
+				bucket.uris[entry.URI()]++
+			}
+		}
+
+		buckets := append(w.buckets[domain], bucket)
+		for len(buckets) > 0 && now.Sub(buckets[0].at) >= window {
+			buckets = buckets[1:]
+		}
+		w.buckets[domain] = buckets
+
+		total, errors := 0, 0
+		uris := make(map[string]int)
+		for _, b := range buckets {
+			total += b.total
+			errors += b.errors
+			for uri, count := range b.uris {
+				uris[uri] += count
+			}
+		}
+		if total < cfg.MinRequests || total == 0 {
+			continue
+		}
+		rate := float64(errors) / float64(total) * 100
+		if rate < float64(cfg.Threshold) || now.Sub(w.lastAlert[domain]) < errorRateCooldown {
+			continue
+		}
+
+		d.dispatch(settings, notifyEventErrorRate, fmt.Sprintf("5xx 告警 · %s", domain), buildErrorRateAlert(settings, domain, cfg, total, errors, rate, uris, now))
+		w.lastAlert[domain] = now
+	}
+}
+
+func buildErrorRateAlert(settings model.NotificationSettings, domain string, cfg model.ErrorRateAlertSettings, total, errors int, rate float64, uris map[string]int, now time.Time) string {
+	lines := []string{
+		"## 🚨 5xx 错误率告警",
+		"",
+		fmt.Sprintf("* **服务名称**: %s", alertServerName(settings)),
+		fmt.Sprintf("* **站点**: %s", domain),
+		fmt.Sprintf("* **监测时间**: %s", now.Format("2006-01-02 15:04:05")),
+		fmt.Sprintf("* **统计窗口**: 近 %d 分钟，共 %d 个请求", cfg.WindowMinutes, total),
+		fmt.Sprintf("* **5xx 比例**: %.1f%%（%d 个，阈值 %d%%）", rate, errors, cfg.Threshold),
+	}
+
+	type uriCount struct {
+		uri   string
+		count int
+	}
+	top := make([]uriCount, 0, len(uris))
+	for uri, count := range uris {
+		top = append(top, uriCount{uri, count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].count != top[j].count {
+			return top[i].count > top[j].count
+		}
+		return top[i].uri < top[j].uri
+	})
+	if len(top) > errorRateTopURIs {
+		top = top[:errorRateTopURIs]
+	}
+	if len(top) > 0 {
+		lines = append(lines, "", "### 出错最多的请求")
+		for _, item := range top {
+			lines = append(lines, fmt.Sprintf("- `%s`: %d 次", item.uri, item.count))
+		}
+	}
+	lines = append(lines, "", "> 建议：请查看该站点的错误日志与后端服务状态。")
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// 状态库每次写入都会重写整个文件，通知历史按条数与总大小限制，超出后丢弃最早的记录
+const (
+	maxNotificationHistory      = 500
+	maxNotificationHistoryBytes = 256 << 10
+	// 单条记录的正文与错误信息超出时截断，避免日报等长消息挤占历史
+	maxNotificationContentRunes = 2000
+	maxNotificationErrorRunes   = 500
+)
+
+// 告警事件类型，记录在通知历史中
+const (
+	notifyEventTraffic      = "traffic"
+	notifyEventTrafficLimit = "traffic_limit"
+	notifyEventExpiry       = "expiry"
+	notifyEventBackup       = "backup"
+	notifyEventNginx        = "nginx"
+	notifyEventDisk         = "disk"
+	notifyEventErrorRate    = "error_rate"
+	notifyEventLatency      = "latency"
+	notifyEventUptime       = "uptime"
+	notifyEventCert         = "cert"
+	notifyEventDigest       = "digest"
+	notifyEventTest         = "test"
+)
+
+// notifyEvents 可以配置路由规则的告警事件
+var notifyEvents = []string{notifyEventTraffic, notifyEventTrafficLimit, notifyEventExpiry, notifyEventBackup, notifyEventNginx, notifyEventDisk, notifyEventErrorRate, notifyEventLatency, notifyEventUptime, notifyEventCert, notifyEventDigest}
+
+// notifyChannels 通知渠道名称，与 NotificationSettings 中各渠道的 JSON 字段一致
+var notifyChannels = []string{"dingtalk", "telegram", "wecom", "slack", "discord", "bark", "serverchan", "webhook"}
+
+// NotificationRecord 一次告警在单个渠道上的发送结果
+type NotificationRecord struct {
+	Event           string `json:"event"`
+	Channel         string `json:"channel"`
+	Title           string `json:"title"`
+	Content         string `json:"content"`
+	Success         bool   `json:"success"`
+	Error           string `json:"error,omitempty"`
+	CreatedUnixTime int64  `json:"created_unix_time"`
+}
+
+// loadHistory 读取通知记录，按发送时间从旧到新排列
+func (s *NotificationService) loadHistory() ([]NotificationRecord, error) {
+	var records []NotificationRecord
+	if err := s.store.Get(stateKeyNotificationHistory, &records); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取通知记录失败: %w", err)
+	}
+	return records, nil
+}
+
+func (s *NotificationService) appendHistory(records ...NotificationRecord) error {
+	return s.store.Update(stateKeyNotificationHistory, func(current json.RawMessage) (any, error) {
+		var history []NotificationRecord
+		if current != nil && json.Unmarshal(current, &history) != nil {
+			// 记录损坏时重新开始记录，不影响告警发送
+			history = nil
+		}
+		for _, record := range records {
+			record.Content = truncateRunes(record.Content, maxNotificationContentRunes)
+			record.Error = truncateRunes(record.Error, maxNotificationErrorRunes)
+			history = append(history, record)
+		}
+		if len(history) > maxNotificationHistory {
+			history = history[len(history)-maxNotificationHistory:]
+		}
+		sizes := make([]int, len(history))
+		total := 0
+		for i, record := range history {
+			data, _ := json.Marshal(record)
+			sizes[i] = len(data) + 1
+			total += sizes[i]
+		}
+		for len(history) > 0 && total > maxNotificationHistoryBytes {
+			total -= sizes[0]
+			sizes, history = sizes[1:], history[1:]
+		}
+		return history, nil
+	})
+}
+
+// History 返回最近的通知记录，最新的在前。event 非空时只返回该类型的记录，limit 不大于 0 时返回全部
+func (s *NotificationService) History(event string, limit int) ([]NotificationRecord, error) {
+	history, err := s.loadHistory()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]NotificationRecord, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		if event != "" && history[i].Event != event {
+			continue
+		}
+		list = append(list, history[i])
+		if limit > 0 && len(list) >= limit {
+			break
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+// latencyCooldown 同一域名的重复告警间隔
+const latencyCooldown = 30 * time.Minute
+
+type latencyBucket struct {
+	at        time.Time
+	histogram []int64
+}
+
+// latencyWatch 增量读取各站点的访问日志，按域名统计滑动窗口内的请求耗时分布。
+// 只有 main_timing 与 main_json 格式的日志行带有耗时，其余格式的站点不会触发告警
+type latencyWatch struct {
+	logDir    string
+	offsets   map[string]int64
+	buckets   map[string][]latencyBucket
+	lastAlert map[string]time.Time
+}
+
+func newLatencyWatch() latencyWatch {
+	return latencyWatch{
+		logDir:    model.NginxLogDir,
+		offsets:   make(map[string]int64),
+		buckets:   make(map[string][]latencyBucket),
+		lastAlert: make(map[string]time.Time),
+	}
+}
+
+func (d *NotificationDispatcher) checkLatency(settings model.NotificationSettings) {
+	cfg := settings.Latency
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w := &d.latency
+	if !cfg.Enabled {
+		w.offsets = make(map[string]int64)
+		w.buckets = make(map[string][]latencyBucket)
+		return
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(w.logDir, "*-access.log"))
+	now := time.Now()
+	window := time.Duration(cfg.WindowMinutes) * time.Minute
+	for _, path := range paths {
+		domain := strings.TrimSuffix(filepath.Base(path), "-access.log")
+		data, err := readNewLogLines(w.offsets, path)
+		if err != nil {
+			continue
+		}
+
+		bucket := latencyBucket{at: now}
+		for _, line := range strings.Split(string(data), "\n") {
+			if entry, ok := parseAccessLine(line); ok && entry.HasTiming {
+				bucket.histogram = observeLatency(bucket.histogram, entry.RequestTime)
+			}
+		}
+
+		buckets := append(w.buckets[domain], bucket)
+		for len(buckets) > 0 && now.Sub(buckets[0].at) >= window {
+			buckets = buckets[1:]
+		}
+		w.buckets[domain] = buckets
+
+		var histogram []int64
+		for _, b := range buckets {
+			histogram = mergeLatency(histogram, b.histogram)
+		}
+		samples := latencySamples(histogram)
+		if samples < int64(cfg.MinRequests) || samples == 0 {
+			continue
+		}
+		value := latencyPercentile(histogram, float64(cfg.Percentile))
+		if value < float64(cfg.ThresholdMs) || now.Sub(w.lastAlert[domain]) < latencyCooldown {
+			continue
+		}
+
+		d.dispatch(settings, notifyEventLatency, fmt.Sprintf("延迟告警 · %s", domain), buildLatencyAlert(settings, domain, cfg, histogram, value, now))
+		w.lastAlert[domain] = now
+	}
+}
+
+func buildLatencyAlert(settings model.NotificationSettings, domain string, cfg model.LatencyAlertSettings, histogram []int64, value float64, now time.Time) string {
+	lines := []string{
+		"## 🐢 站点延迟告警",
+		"",
+		fmt.Sprintf("* **服务名称**: %s", alertServerName(settings)),
+		fmt.Sprintf("* **站点**: %s", domain),
+		fmt.Sprintf("* **监测时间**: %s", now.Format("2006-01-02 15:04:05")),
+		fmt.Sprintf("* **统计窗口**: 近 %d 分钟，共 %d 个请求", cfg.WindowMinutes, latencySamples(histogram)),
+		fmt.Sprintf("* **P%d 耗时**: %.0f ms（阈值 %d ms）", cfg.Percentile, value, cfg.ThresholdMs),
+		fmt.Sprintf("* **P50 / P95 / P99**: %.0f / %.0f / %.0f ms", latencyPercentile(histogram, 50), latencyPercentile(histogram, 95), latencyPercentile(histogram, 99)),
+		"",
+		"> 建议：请检查后端服务负载与慢请求，耗时按分桶估算。",
+	}
+	return strings.Join(lines, "\n")
+}
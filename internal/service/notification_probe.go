@@ -0,0 +1,119 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+// maxProbeResponse 测试通知时保留的渠道响应长度
+const maxProbeResponse = 4096
+
+var ErrUnknownNotificationChannel = errors.New("未知的通知渠道")
+
+// NotificationTestResult 测试通知的结果，Response 为渠道返回的原始内容
+type NotificationTestResult struct {
+	Channel    string `json:"channel"`
+	Success    bool   `json:"success"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Response   string `json:"response,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// recordingTransport 记录最后一次请求的响应，并把读取过的响应体交还给发送方继续解析
+type recordingTransport struct {
+	base       http.RoundTripper
+	statusCode int
+	response   []byte
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxProbeResponse))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	t.statusCode = resp.StatusCode
+	t.response = data
+	return resp, nil
+}
+
+// SendTest 通过指定渠道发送一条示例消息。渠道未启用时也会发送，便于保存前验证；
+// 渠道返回错误时不返回 error，而是记录在结果中，连同渠道的原始响应一起交给调用方
+func (d *NotificationDispatcher) SendTest(channel string, settings model.NotificationSettings) (NotificationTestResult, error) {
+	base := d.channelSender(settings.Proxy, channel).client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	recorder := &recordingTransport{base: base}
+	probe := &NotificationDispatcher{
+		svc:    d.svc,
+		client: &http.Client{Timeout: d.client.Timeout, Transport: recorder},
+	}
+
+	serverName := strings.TrimSpace(settings.ServerLabel)
+	if serverName == "" {
+		serverName = "本机服务器"
+	}
+	title := fmt.Sprintf("测试通知 · %s", serverName)
+	content := fmt.Sprintf(
+		"## 🔔 测试通知\n\n* **服务名称**: %s\n* **发送时间**: %s\n* **通知渠道**: %s\n\n> 收到这条消息说明通知渠道配置正确。",
+		serverName,
+		time.Now().Format("2006-01-02 15:04:05"),
+		channel,
+	)
+
+	var err error
+	switch channel {
+	case "dingtalk":
+		err = probe.sendDingTalk(settings.DingTalk, title, content)
+	case "telegram":
+		err = probe.sendTelegram(settings.Telegram, title, content)
+	case "wecom":
+		err = probe.sendWeCom(settings.WeCom, content)
+	case "slack":
+		err = probe.sendSlack(settings.Slack, title, content)
+	case "discord":
+		err = probe.sendDiscord(settings.Discord, title, content)
+	case "bark":
+		err = probe.sendBark(settings.Bark, title, content)
+	case "serverchan":
+		err = probe.sendServerChan(settings.ServerChan, title, content)
+	case "webhook":
+		err = probe.sendWebhook(settings.Webhook, settings.ServerLabel, title, content)
+	default:
+		return NotificationTestResult{}, fmt.Errorf("%w: %s", ErrUnknownNotificationChannel, channel)
+	}
+
+	result := NotificationTestResult{
+		Channel:    channel,
+		Success:    err == nil,
+		StatusCode: recorder.statusCode,
+		Response:   string(recorder.response),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	record := NotificationRecord{
+		Event:           notifyEventTest,
+		Channel:         channel,
+		Title:           title,
+		Content:         content,
+		Success:         result.Success,
+		Error:           result.Error,
+		CreatedUnixTime: time.Now().Unix(),
+	}
+	if err := d.svc.appendHistory(record); err != nil {
+		log.Printf("[notification] 保存通知记录失败: %v", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+
+	"nginx-mgr/internal/model"
+)
+
+// channelSender 返回发送指定渠道时使用的发送方，渠道需要走代理时换用经代理的 http.Client
+func (d *NotificationDispatcher) channelSender(cfg model.NotificationProxySettings, channel string) *NotificationDispatcher {
+	if cfg.URL == "" || (len(cfg.Channels) > 0 && !slices.Contains(cfg.Channels, channel)) {
+		return d
+	}
+	transport := d.proxyTransport(cfg.URL)
+	if transport == nil {
+		return d
+	}
+	return &NotificationDispatcher{
+		svc:    d.svc,
+		client: &http.Client{Timeout: d.client.Timeout, Transport: transport},
+	}
+}
+
+// proxyTransport 按代理地址缓存 Transport，复用到代理的连接
+func (d *NotificationDispatcher) proxyTransport(raw string) *http.Transport {
+	d.proxyMu.Lock()
+	defer d.proxyMu.Unlock()
+	if transport, ok := d.proxyTransports[raw]; ok {
+		return transport
+	}
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	if d.proxyTransports == nil {
+		d.proxyTransports = make(map[string]*http.Transport)
+	}
+	d.proxyTransports[raw] = transport
+	return transport
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"nginx-mgr/internal/model"
+)
+
+// serverChanTitleLimit Server酱标题最长 32 个字符
+const serverChanTitleLimit = 32
+
+// serverChanAPI Turbo 版 SendKey 的推送地址
+var serverChanAPI = "https://sctapi.ftqq.com"
+
+// serverChan3KeyPattern Server酱³ 的 SendKey 形如 sctp{uid}t...，需推送到 uid 对应的域名
+var serverChan3KeyPattern = regexp.MustCompile(`^sctp(\d+)t`)
+
+// sendBark 推送到 Bark，正文去掉 Markdown 标记，同一面板的告警归入同一分组
+func (d *NotificationDispatcher) sendBark(cfg model.BarkSettings, title, content string) error {
+	key := strings.TrimSpace(cfg.DeviceKey)
+	if key == "" {
+		return errors.New("Bark 设备 Key 未配置")
+	}
+	server := strings.TrimRight(strings.TrimSpace(cfg.Server), "/")
+	if server == "" {
+		server = defaultBarkServer
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"device_key": key,
+		"title":      title,
+		"body":       strings.TrimSpace(convertAlertMarkdown(content, "")),
+		"group":      "nginx-mgr",
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", server+"/push", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode >= 300 || result.Code != http.StatusOK {
+		return fmt.Errorf("Bark 返回错误: %d %s", resp.StatusCode, result.Message)
+	}
+	return nil
+}
+
+// sendServerChan 推送到 Server酱，desp 支持 Markdown，直接使用告警正文
+func (d *NotificationDispatcher) sendServerChan(cfg model.ServerChanSettings, title, content string) error {
+	key := strings.TrimSpace(cfg.SendKey)
+	if key == "" {
+		return errors.New("Server酱 SendKey 未配置")
+	}
+
+	values := url.Values{}
+	values.Set("title", truncateRunes(title, serverChanTitleLimit))
+	values.Set("desp", content)
+	req, err := http.NewRequest("POST", serverChanURL(key), strings.NewReader(values.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode >= 300 || result.Code != 0 {
+		return fmt.Errorf("Server酱返回错误: %d %s", resp.StatusCode, result.Message)
+	}
+	return nil
+}
+
+func serverChanURL(key string) string {
+	if match := serverChan3KeyPattern.FindStringSubmatch(key); match != nil {
+		return fmt.Sprintf("https://%s.push.ft07.com/send/%s.send", match[1], key)
+	}
+	return fmt.Sprintf("%s/%s.send", serverChanAPI, key)
+}
@@ -1,35 +1,52 @@
 package service
 
 import (
-	"encoding/json"
 	"errors"
+	"fmt"
 	"math"
+	"net/http"
+	"net/url"
 	"nginx-mgr/internal/model"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 )
 
 type NotificationService struct {
-	path string
-	mu   sync.Mutex
+	store *StateStore
+	mu    sync.Mutex
 }
 
-const notificationSettingsPath = "/root/notification_settings.json"
+var (
+	ErrInvalidExpiryDateFormat     = errors.New("服务器到期日期格式应为 YYYY-MM-DD")
+	ErrInvalidNotificationSettings = errors.New("通知配置无效")
+)
+
+const defaultBarkServer = "https://api.day.app"
+
+// pushKeyPattern Bark 设备 Key 与 Server酱 SendKey 会拼入请求路径，只允许字母和数字
+var pushKeyPattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// webhookHeaderPattern 自定义请求头名称，与 HTTP token 规则一致
+// digestTimePattern 日报发送时间 HH:MM
+var digestTimePattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
 
-var ErrInvalidExpiryDateFormat = errors.New("服务器到期日期格式应为 YYYY-MM-DD")
+var webhookHeaderPattern = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
 
 func NewNotificationService() *NotificationService {
 	return &NotificationService{
-		path: notificationSettingsPath,
+		store: openStateStore(""),
 	}
 }
 
 func (s *NotificationService) defaultSettings() model.NotificationSettings {
 	return model.NotificationSettings{
 		TrafficThreshold:    80,
+		DiskThreshold:       90,
 		ServerExpiryDate:    "",
 		ExpiryNotifyDays:    7,
 		ServerLabel:         "",
@@ -44,6 +61,38 @@ func (s *NotificationService) defaultSettings() model.NotificationSettings {
 			BotToken: "",
 			ChatID:   "",
 		},
+		Webhook: model.WebhookSettings{
+			Enabled: false,
+			Method:  http.MethodPost,
+		},
+		Bark: model.BarkSettings{
+			Server: defaultBarkServer,
+		},
+		Backup: model.BackupNotifySettings{
+			OnSuccess: false,
+			OnFailure: true,
+		},
+		NginxWatchdog: model.NginxWatchdogSettings{
+			Enabled:     true,
+			AutoRestart: false,
+		},
+		ErrorRate: model.ErrorRateAlertSettings{
+			Enabled:       false,
+			Threshold:     5,
+			WindowMinutes: 5,
+			MinRequests:   20,
+		},
+		Latency: model.LatencyAlertSettings{
+			Enabled:       false,
+			Percentile:    95,
+			ThresholdMs:   1000,
+			WindowMinutes: 5,
+			MinRequests:   20,
+		},
+		DailyDigest: model.DailyDigestSettings{
+			Enabled: false,
+			Time:    "09:00",
+		},
 		LastUpdatedUnixTime: 0,
 	}
 }
@@ -60,6 +109,14 @@ func (s *NotificationService) sanitize(input model.NotificationSettings) (model.
 	}
 	output.TrafficThreshold = threshold
 
+	output.DiskThreshold = input.DiskThreshold
+	if output.DiskThreshold < 0 {
+		output.DiskThreshold = 0
+	}
+	if output.DiskThreshold > 100 {
+		output.DiskThreshold = 100
+	}
+
 	date := strings.TrimSpace(input.ServerExpiryDate)
 	if date != "" {
 		if _, err := time.Parse("2006-01-02", date); err != nil {
@@ -82,6 +139,102 @@ func (s *NotificationService) sanitize(input model.NotificationSettings) (model.
 	output.Telegram.BotToken = strings.TrimSpace(input.Telegram.BotToken)
 	output.Telegram.ChatID = strings.TrimSpace(input.Telegram.ChatID)
 
+	output.WeCom.Enabled = input.WeCom.Enabled
+	output.WeCom.Webhook = strings.TrimSpace(input.WeCom.Webhook)
+	if err := validateNotifyURL(output.WeCom.Webhook, "企业微信 Webhook"); err != nil {
+		return model.NotificationSettings{}, err
+	}
+
+	output.Slack.Enabled = input.Slack.Enabled
+	output.Slack.Webhook = strings.TrimSpace(input.Slack.Webhook)
+	if err := validateNotifyURL(output.Slack.Webhook, "Slack Webhook"); err != nil {
+		return model.NotificationSettings{}, err
+	}
+	output.Discord.Enabled = input.Discord.Enabled
+	output.Discord.Webhook = strings.TrimSpace(input.Discord.Webhook)
+	if err := validateNotifyURL(output.Discord.Webhook, "Discord Webhook"); err != nil {
+		return model.NotificationSettings{}, err
+	}
+
+	output.Bark.Enabled = input.Bark.Enabled
+	output.Bark.DeviceKey = strings.TrimSpace(input.Bark.DeviceKey)
+	if server := strings.TrimRight(strings.TrimSpace(input.Bark.Server), "/"); server != "" {
+		if err := validateNotifyURL(server, "Bark 服务"); err != nil {
+			return model.NotificationSettings{}, err
+		}
+		output.Bark.Server = server
+	}
+	if output.Bark.DeviceKey != "" && !pushKeyPattern.MatchString(output.Bark.DeviceKey) {
+		return model.NotificationSettings{}, fmt.Errorf("%w: Bark 设备 Key 只能包含字母和数字", ErrInvalidNotificationSettings)
+	}
+
+	output.ServerChan.Enabled = input.ServerChan.Enabled
+	output.ServerChan.SendKey = strings.TrimSpace(input.ServerChan.SendKey)
+	if output.ServerChan.SendKey != "" && !pushKeyPattern.MatchString(output.ServerChan.SendKey) {
+		return model.NotificationSettings{}, fmt.Errorf("%w: Server酱 SendKey 只能包含字母和数字", ErrInvalidNotificationSettings)
+	}
+
+	action, err := sanitizeTrafficLimitAction(input.TrafficLimitAction)
+	if err != nil {
+		return model.NotificationSettings{}, err
+	}
+	output.TrafficLimitAction = action
+
+	proxy, err := sanitizeNotifyProxy(input.Proxy)
+	if err != nil {
+		return model.NotificationSettings{}, err
+	}
+	output.Proxy = proxy
+
+	routes, err := sanitizeRoutes(input.Routes)
+	if err != nil {
+		return model.NotificationSettings{}, err
+	}
+	output.Routes = routes
+
+	webhook, err := sanitizeWebhook(input.Webhook)
+	if err != nil {
+		return model.NotificationSettings{}, err
+	}
+	output.Webhook = webhook
+
+	output.Backup = input.Backup
+	output.NginxWatchdog = input.NginxWatchdog
+	output.ErrorRate.Enabled = input.ErrorRate.Enabled
+	if input.ErrorRate.Threshold > 0 && input.ErrorRate.Threshold <= 100 {
+		output.ErrorRate.Threshold = input.ErrorRate.Threshold
+	}
+	if input.ErrorRate.WindowMinutes > 0 && input.ErrorRate.WindowMinutes <= 60 {
+		output.ErrorRate.WindowMinutes = input.ErrorRate.WindowMinutes
+	}
+	if input.ErrorRate.MinRequests > 0 {
+		output.ErrorRate.MinRequests = input.ErrorRate.MinRequests
+	}
+	output.Latency.Enabled = input.Latency.Enabled
+	switch input.Latency.Percentile {
+	case 0:
+	case 50, 95, 99:
+		output.Latency.Percentile = input.Latency.Percentile
+	default:
+		return model.NotificationSettings{}, fmt.Errorf("%w: 延迟告警的百分位仅支持 50、95、99", ErrInvalidNotificationSettings)
+	}
+	if input.Latency.ThresholdMs > 0 && input.Latency.ThresholdMs <= 60000 {
+		output.Latency.ThresholdMs = input.Latency.ThresholdMs
+	}
+	if input.Latency.WindowMinutes > 0 && input.Latency.WindowMinutes <= 60 {
+		output.Latency.WindowMinutes = input.Latency.WindowMinutes
+	}
+	if input.Latency.MinRequests > 0 {
+		output.Latency.MinRequests = input.Latency.MinRequests
+	}
+	output.DailyDigest.Enabled = input.DailyDigest.Enabled
+	if digestTime := strings.TrimSpace(input.DailyDigest.Time); digestTime != "" {
+		if !digestTimePattern.MatchString(digestTime) {
+			return model.NotificationSettings{}, fmt.Errorf("%w: 日报发送时间格式应为 HH:MM", ErrInvalidNotificationSettings)
+		}
+		output.DailyDigest.Time = digestTime
+	}
+
 	output.ServerLabel = strings.TrimSpace(input.ServerLabel)
 	if math.IsNaN(input.MonthlyTrafficLimit) || input.MonthlyTrafficLimit < 0 {
 		output.MonthlyTrafficLimit = 0
@@ -92,31 +245,200 @@ func (s *NotificationService) sanitize(input model.NotificationSettings) (model.
 	return output, nil
 }
 
-func (s *NotificationService) ensureDir() error {
-	dir := filepath.Dir(s.path)
-	if dir == "." || dir == "/" {
+func sanitizeNotifyProxy(input model.NotificationProxySettings) (model.NotificationProxySettings, error) {
+	output := model.NotificationProxySettings{URL: strings.TrimSpace(input.URL)}
+	if output.URL == "" {
+		return output, nil
+	}
+	parsed, err := url.Parse(output.URL)
+	if err != nil || parsed.Host == "" {
+		return model.NotificationProxySettings{}, fmt.Errorf("%w: 代理地址无效，示例 socks5://127.0.0.1:1080", ErrInvalidNotificationSettings)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return model.NotificationProxySettings{}, fmt.Errorf("%w: 代理仅支持 http、https、socks5 与 socks5h", ErrInvalidNotificationSettings)
+	}
+	for _, channel := range input.Channels {
+		if !slices.Contains(notifyChannels, channel) {
+			return model.NotificationProxySettings{}, fmt.Errorf("%w: 未知的通知渠道 %s", ErrInvalidNotificationSettings, channel)
+		}
+		if !slices.Contains(output.Channels, channel) {
+			output.Channels = append(output.Channels, channel)
+		}
+	}
+	return output, nil
+}
+
+func sanitizeWebhook(input model.WebhookSettings) (model.WebhookSettings, error) {
+	output := model.WebhookSettings{
+		Enabled: input.Enabled,
+		URL:     strings.TrimSpace(input.URL),
+		Method:  strings.ToUpper(strings.TrimSpace(input.Method)),
+		Secret:  strings.TrimSpace(input.Secret),
+	}
+	if err := validateNotifyURL(output.URL, "Webhook"); err != nil {
+		return model.WebhookSettings{}, err
+	}
+	switch output.Method {
+	case "":
+		output.Method = http.MethodPost
+	case http.MethodPost, http.MethodPut:
+	default:
+		return model.WebhookSettings{}, fmt.Errorf("%w: Webhook 仅支持 POST 或 PUT", ErrInvalidNotificationSettings)
+	}
+	for key, value := range input.Headers {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if !webhookHeaderPattern.MatchString(key) || strings.ContainsAny(value, "\r\n") {
+			return model.WebhookSettings{}, fmt.Errorf("%w: 请求头 %s 无效", ErrInvalidNotificationSettings, key)
+		}
+		if output.Headers == nil {
+			output.Headers = make(map[string]string)
+		}
+		output.Headers[key] = strings.TrimSpace(value)
+	}
+	return output, nil
+}
+
+func sanitizeTrafficLimitAction(input model.TrafficLimitActionSettings) (model.TrafficLimitActionSettings, error) {
+	output := model.TrafficLimitActionSettings{Action: strings.TrimSpace(input.Action)}
+	switch output.Action {
+	case "":
+	case trafficActionLimitRate:
+		output.LimitRate = strings.TrimSpace(input.LimitRate)
+		if !sizePattern.MatchString(output.LimitRate) || strings.Trim(output.LimitRate, "0kKmMgG") == "" {
+			return model.TrafficLimitActionSettings{}, fmt.Errorf("%w: 限速值应为正数，如 512k 或 1m", ErrInvalidNotificationSettings)
+		}
+	case trafficActionStopNginx:
+	case trafficActionDisableSites:
+		for _, site := range input.Sites {
+			site = strings.TrimSpace(site)
+			if site == "" || slices.Contains(output.Sites, site) {
+				continue
+			}
+			if site != filepath.Base(site) || strings.HasPrefix(site, ".") {
+				return model.TrafficLimitActionSettings{}, fmt.Errorf("%w: 站点名称无效 %s", ErrInvalidNotificationSettings, site)
+			}
+			output.Sites = append(output.Sites, site)
+		}
+		if len(output.Sites) == 0 {
+			return model.TrafficLimitActionSettings{}, fmt.Errorf("%w: 请选择超额后要停用的站点", ErrInvalidNotificationSettings)
+		}
+	default:
+		return model.TrafficLimitActionSettings{}, fmt.Errorf("%w: 未知的超额动作 %s", ErrInvalidNotificationSettings, output.Action)
+	}
+	return output, nil
+}
+
+// sanitizeRoutes 校验路由规则中的事件与渠道名称并去重，渠道列表为空的事件视为未配置
+func sanitizeRoutes(input map[string][]string) (map[string][]string, error) {
+	var routes map[string][]string
+	for event, channels := range input {
+		if !slices.Contains(notifyEvents, event) {
+			return nil, fmt.Errorf("%w: 未知的告警事件 %s", ErrInvalidNotificationSettings, event)
+		}
+		var list []string
+		for _, channel := range channels {
+			if !slices.Contains(notifyChannels, channel) {
+				return nil, fmt.Errorf("%w: 未知的通知渠道 %s", ErrInvalidNotificationSettings, channel)
+			}
+			if !slices.Contains(list, channel) {
+				list = append(list, channel)
+			}
+		}
+		if len(list) == 0 {
+			continue
+		}
+		if routes == nil {
+			routes = make(map[string][]string)
+		}
+		routes[event] = list
+	}
+	return routes, nil
+}
+
+// validateNotifyURL 校验渠道地址，留空表示未配置
+func validateNotifyURL(raw, name string) error {
+	if raw == "" {
 		return nil
 	}
-	return os.MkdirAll(dir, 0700)
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return fmt.Errorf("%w: %s 地址需以 http:// 或 https:// 开头", ErrInvalidNotificationSettings, name)
+	}
+	return nil
+}
+
+// Normalize 校验并规范化尚未保存的通知设置，例如测试通知时使用表单中的当前配置；留空的密钥沿用已保存的值
+func (s *NotificationService) Normalize(input model.NotificationSettings) (model.NotificationSettings, error) {
+	current, err := s.Get()
+	if err != nil {
+		return model.NotificationSettings{}, err
+	}
+	return s.sanitize(keepNotificationSecrets(input, current))
+}
+
+// RedactNotificationSettings 去掉渠道密钥与含令牌的 Webhook 地址，只保留 Has* 标记；自定义请求头只保留名称
+func RedactNotificationSettings(settings model.NotificationSettings) model.NotificationSettings {
+	settings.DingTalk.HasWebhook, settings.DingTalk.Webhook = settings.DingTalk.Webhook != "", ""
+	settings.DingTalk.HasSecret, settings.DingTalk.Secret = settings.DingTalk.Secret != "", ""
+	settings.Telegram.HasBotToken, settings.Telegram.BotToken = settings.Telegram.BotToken != "", ""
+	settings.WeCom.HasWebhook, settings.WeCom.Webhook = settings.WeCom.Webhook != "", ""
+	settings.Slack.HasWebhook, settings.Slack.Webhook = settings.Slack.Webhook != "", ""
+	settings.Discord.HasWebhook, settings.Discord.Webhook = settings.Discord.Webhook != "", ""
+	settings.Bark.HasDeviceKey, settings.Bark.DeviceKey = settings.Bark.DeviceKey != "", ""
+	settings.ServerChan.HasSendKey, settings.ServerChan.SendKey = settings.ServerChan.SendKey != "", ""
+	settings.Webhook.HasSecret, settings.Webhook.Secret = settings.Webhook.Secret != "", ""
+	if len(settings.Webhook.Headers) > 0 {
+		headers := make(map[string]string, len(settings.Webhook.Headers))
+		for name := range settings.Webhook.Headers {
+			headers[name] = ""
+		}
+		settings.Webhook.Headers = headers
+	}
+	return settings
+}
+
+// keepNotificationSecrets 表单中留空的密钥、Webhook 地址与请求头的值沿用 current 中已保存的值
+func keepNotificationSecrets(input, current model.NotificationSettings) model.NotificationSettings {
+	keep := func(value *string, saved string) {
+		if strings.TrimSpace(*value) == "" {
+			*value = saved
+		}
+	}
+	keep(&input.DingTalk.Webhook, current.DingTalk.Webhook)
+	keep(&input.DingTalk.Secret, current.DingTalk.Secret)
+	keep(&input.Telegram.BotToken, current.Telegram.BotToken)
+	keep(&input.WeCom.Webhook, current.WeCom.Webhook)
+	keep(&input.Slack.Webhook, current.Slack.Webhook)
+	keep(&input.Discord.Webhook, current.Discord.Webhook)
+	keep(&input.Bark.DeviceKey, current.Bark.DeviceKey)
+	keep(&input.ServerChan.SendKey, current.ServerChan.SendKey)
+	keep(&input.Webhook.Secret, current.Webhook.Secret)
+	for name, value := range input.Webhook.Headers {
+		if saved, ok := current.Webhook.Headers[name]; ok && strings.TrimSpace(value) == "" {
+			input.Webhook.Headers[name] = saved
+		}
+	}
+	return input
 }
 
 func (s *NotificationService) Get() (model.NotificationSettings, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	content, err := os.ReadFile(s.path)
-	if err != nil {
+	// 以默认值为基础解析，旧版本保存的配置缺少的字段沿用默认值
+	settings := s.defaultSettings()
+	if err := s.store.Get(stateKeyNotificationSettings, &settings); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return s.defaultSettings(), nil
 		}
 		return model.NotificationSettings{}, err
 	}
 
-	var settings model.NotificationSettings
-	if err := json.Unmarshal(content, &settings); err != nil {
-		return model.NotificationSettings{}, err
-	}
-
 	normalized, err := s.sanitize(settings)
 	if err != nil {
 		// 如果已有数据格式不正确，返回默认值并忽略错误以避免界面无法展示
@@ -127,26 +449,22 @@ func (s *NotificationService) Get() (model.NotificationSettings, error) {
 	return normalized, nil
 }
 
+// Save 保存通知设置；密钥、Webhook 地址与请求头的值留空时沿用已保存的值
 func (s *NotificationService) Save(input model.NotificationSettings) (model.NotificationSettings, error) {
-	settings, err := s.sanitize(input)
+	current, err := s.Get()
 	if err != nil {
 		return model.NotificationSettings{}, err
 	}
-	settings.LastUpdatedUnixTime = time.Now().Unix()
-
-	data, err := json.MarshalIndent(settings, "", "  ")
+	settings, err := s.sanitize(keepNotificationSecrets(input, current))
 	if err != nil {
 		return model.NotificationSettings{}, err
 	}
-
-	if err := s.ensureDir(); err != nil {
-		return model.NotificationSettings{}, err
-	}
+	settings.LastUpdatedUnixTime = time.Now().Unix()
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if err := os.WriteFile(s.path, data, 0600); err != nil {
+	if err := s.store.Put(stateKeyNotificationSettings, settings); err != nil {
 		return model.NotificationSettings{}, err
 	}
 
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+// NotifyUptime 发送站点不可用或恢复的通知。down 为 true 时表示连续失败达到阈值
+func (d *NotificationDispatcher) NotifyUptime(domain, url string, check model.UptimeCheck, fails int, downSince int64, down bool) {
+	settings, err := d.svc.Get()
+	if err != nil {
+		log.Printf("[notification] 获取配置失败: %v", err)
+		return
+	}
+	if !hasEnabledChannel(settings) {
+		return
+	}
+	d.dispatch(settings, notifyEventUptime, uptimeAlertTitle(domain, down), buildUptimeAlert(settings, domain, url, check, fails, downSince, down))
+}
+
+func uptimeAlertTitle(domain string, down bool) string {
+	if down {
+		return fmt.Sprintf("站点不可用 · %s", domain)
+	}
+	return fmt.Sprintf("站点已恢复 · %s", domain)
+}
+
+func buildUptimeAlert(settings model.NotificationSettings, domain, url string, check model.UptimeCheck, fails int, downSince int64, down bool) string {
+	at := time.Unix(check.UnixTime, 0)
+	var lines []string
+	if down {
+		lines = []string{
+			"## 🔴 站点不可用",
+			"",
+			fmt.Sprintf("* **服务名称**: %s", alertServerName(settings)),
+			fmt.Sprintf("* **站点**: %s", domain),
+			fmt.Sprintf("* **探测地址**: %s", url),
+			fmt.Sprintf("* **连续失败**: %d 次", fails),
+			fmt.Sprintf("* **首次失败**: %s", time.Unix(downSince, 0).Format("2006-01-02 15:04:05")),
+			fmt.Sprintf("* **错误信息**: %s", check.Error),
+			"",
+			"> 建议：请检查域名解析、证书与后端服务状态。",
+		}
+	} else {
+		lines = []string{
+			"## 🟢 站点已恢复",
+			"",
+			fmt.Sprintf("* **服务名称**: %s", alertServerName(settings)),
+			fmt.Sprintf("* **站点**: %s", domain),
+			fmt.Sprintf("* **探测地址**: %s", url),
+			fmt.Sprintf("* **恢复时间**: %s", at.Format("2006-01-02 15:04:05")),
+			fmt.Sprintf("* **HTTP 状态码**: %d，耗时 %d ms", check.Status, check.LatencyMs),
+		}
+		if downSince > 0 {
+			lines = append(lines, fmt.Sprintf("* **不可用时长**: %s", at.Sub(time.Unix(downSince, 0)).Round(time.Second)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+)
+
+// watchdogErrorLines 告警中附带的 error.log 行数
+const watchdogErrorLines = 10
+
+// nginxWatchdog 记录 Nginx 的运行状态，只在状态变化时告警
+type nginxWatchdog struct {
+	binary   string
+	errorLog string
+	pidFile  string
+	state    func() string
+	restart  func() error
+
+	down      bool
+	downSince time.Time
+}
+
+func newNginxWatchdog() nginxWatchdog {
+	return nginxWatchdog{
+		binary:   model.NginxSbinPath,
+		errorLog: filepath.Join(model.NginxLogDir, "error.log"),
+		pidFile:  filepath.Join(model.NginxPidDir, "nginx.pid"),
+		state: func() string {
+			out, _ := executor.ExecuteSimple("systemctl", "is-active", "nginx")
+			return strings.TrimSpace(out)
+		},
+		restart: func() error {
+			out, err := executor.ExecuteSimple("systemctl", "restart", "nginx")
+			if err != nil && strings.TrimSpace(out) != "" {
+				return errors.New(strings.TrimSpace(out))
+			}
+			return err
+		},
+	}
+}
+
+// probe 返回 Nginx 当前状态；systemd 显示运行但 PID 文件中的主进程已不存在时返回 "master-missing"
+func (w *nginxWatchdog) probe() string {
+	state := w.state()
+	if state != "active" {
+		return state
+	}
+	data, err := os.ReadFile(w.pidFile)
+	if err != nil {
+		return state
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return state
+	}
+	if _, err := os.Stat(filepath.Join("/proc", strconv.Itoa(pid))); errors.Is(err, os.ErrNotExist) {
+		return "master-missing"
+	}
+	return state
+}
+
+// checkNginx 发现 Nginx 停止（inactive/failed）或主进程消失时立即告警，恢复后再发送一次恢复通知。
+// 开启自动重启时只处理异常退出，手动停止（inactive）的 Nginx 不会被拉起
+func (d *NotificationDispatcher) checkNginx(settings model.NotificationSettings) {
+	if !settings.NginxWatchdog.Enabled {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w := &d.watchdog
+	// 尚未安装 Nginx 时不检查
+	if _, err := os.Stat(w.binary); err != nil {
+		return
+	}
+
+	state := w.probe()
+	if state != "inactive" && state != "failed" && state != "master-missing" {
+		if state == "active" && w.down {
+			w.down = false
+			d.dispatch(settings, notifyEventNginx, fmt.Sprintf("Nginx 已恢复 · %s", alertServerName(settings)), fmt.Sprintf(
+				"## ✅ Nginx 已恢复运行\n\n* **服务名称**: %s\n* **恢复时间**: %s\n* **中断时长**: %s",
+				alertServerName(settings),
+				time.Now().Format("2006-01-02 15:04:05"),
+				time.Since(w.downSince).Round(time.Second),
+			))
+		}
+		return
+	}
+	if w.down {
+		return
+	}
+
+	now := time.Now()
+	lines := []string{
+		"## 🚨 Nginx 已停止",
+		"",
+		fmt.Sprintf("* **服务名称**: %s", alertServerName(settings)),
+		fmt.Sprintf("* **检测时间**: %s", now.Format("2006-01-02 15:04:05")),
+		fmt.Sprintf("* **运行状态**: %s", describeNginxState(state)),
+	}
+
+	recovered := false
+	if settings.NginxWatchdog.AutoRestart && state != "inactive" {
+		if err := w.restart(); err != nil {
+			lines = append(lines, fmt.Sprintf("* **自动重启**: 失败（%v）", err))
+		} else if w.probe() == "active" {
+			recovered = true
+			lines = append(lines, "* **自动重启**: 已成功重启")
+		} else {
+			lines = append(lines, "* **自动重启**: 已执行，但 Nginx 仍未运行")
+		}
+	}
+
+	if tail, err := readLastLines(w.errorLog, watchdogErrorLines); err == nil && len(tail) > 0 {
+		lines = append(lines, "", "最近的错误日志：", "```")
+		lines = append(lines, tail...)
+		lines = append(lines, "```")
+	}
+	if !recovered {
+		lines = append(lines, "", "> 建议：请执行 nginx -t 检查配置，并查看 systemctl status nginx。")
+	}
+
+	d.dispatch(settings, notifyEventNginx, fmt.Sprintf("Nginx 停止告警 · %s", alertServerName(settings)), strings.Join(lines, "\n"))
+	if !recovered {
+		w.down = true
+		w.downSince = now
+	}
+	log.Printf("[notification] 检测到 Nginx 状态异常: %s", state)
+}
+
+func alertServerName(settings model.NotificationSettings) string {
+	if name := strings.TrimSpace(settings.ServerLabel); name != "" {
+		return name
+	}
+	return "本机服务器"
+}
+
+func describeNginxState(state string) string {
+	switch state {
+	case "inactive":
+		return "已停止（inactive）"
+	case "failed":
+		return "异常退出（failed）"
+	case "master-missing":
+		return "主进程不存在"
+	default:
+		return state
+	}
+}
+
+// readLastLines 读取文件末尾的 n 个非空行
+func readLastLines(path string, n int) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	const window int64 = 64 * 1024
+	start := int64(0)
+	if info.Size() > window {
+		start = info.Size() - window
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := strings.Split(string(data), "\n")
+	if start > 0 && len(raw) > 0 {
+		raw = raw[1:]
+	}
+	lines := make([]string, 0, n)
+	for i := len(raw) - 1; i >= 0 && len(lines) < n; i-- {
+		if line := strings.TrimSpace(raw[i]); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines, nil
+}
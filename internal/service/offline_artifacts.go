@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"nginx-mgr/internal/model"
+)
+
+// offlineArtifactDir 离线安装包的默认目录。安装、升级与 rclone 依赖优先使用其中预先下载的文件，
+// 不再访问 GitHub、nginx.org 或 rclone.org
+const offlineArtifactDir = "/root/nginx-mgr-offline"
+
+var ErrMissingInstallArtifacts = errors.New("离线安装缺少所需文件")
+
+// offlineArtifact 离线安装需要预先放入目录的文件，Pattern 为 filepath.Glob 模式
+type offlineArtifact struct {
+	Pattern string
+	Desc    string
+}
+
+// installArtifacts 返回离线安装所需的文件，manager 为检测到的包管理器
+func installArtifacts(req model.InstallRequest, manager string) []offlineArtifact {
+	if req.Method != model.InstallMethodPackage {
+		artifacts := []offlineArtifact{{Pattern: fmt.Sprintf("nginx-%s.tar.gz", req.Version), Desc: "Nginx 源码包"}}
+		for _, name := range req.Modules {
+			if module := nginxModules[name]; module.Archive != "" {
+				artifacts = append(artifacts, offlineArtifact{Pattern: module.Archive, Desc: name + " 模块源码包"})
+			}
+		}
+		return artifacts
+	}
+	ext := "rpm"
+	if manager == "apt-get" {
+		ext = "deb"
+	}
+	artifacts := []offlineArtifact{{Pattern: "nginx*." + ext, Desc: "Nginx 软件包及其依赖"}}
+	if req.Source == model.InstallSourceNginxOrg {
+		artifacts = append(artifacts, offlineArtifact{Pattern: "nginx-module-acme*." + ext, Desc: "nginx.org 的 ACME 模块软件包"})
+	}
+	return artifacts
+}
+
+// checkArtifacts 列出目录中缺少的文件，全部存在时返回 nil
+func checkArtifacts(dir string, artifacts []offlineArtifact) error {
+	var missing []string
+	for _, artifact := range artifacts {
+		if matches, _ := filepath.Glob(filepath.Join(dir, artifact.Pattern)); len(matches) == 0 {
+			missing = append(missing, fmt.Sprintf("%s（%s）", artifact.Pattern, artifact.Desc))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w，请放入 %s: %s", ErrMissingInstallArtifacts, dir, strings.Join(missing, "、"))
+	}
+	return nil
+}
+
+// offlinePackages 返回目录中全部指定扩展名的软件包，依赖包也一并安装
+func offlinePackages(dir, ext string) []string {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*."+ext))
+	sort.Strings(matches)
+	return matches
+}
+
+// offlineFile 返回离线目录中存在的文件路径，不存在时返回空字符串
+func offlineFile(dir, name string) string {
+	path := filepath.Join(dir, name)
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		return path
+	}
+	return ""
+}
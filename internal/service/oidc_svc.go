@@ -0,0 +1,736 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcSettingsPath = "/root/oidc.json"
+	oidcStateTTL     = 10 * time.Minute // 从跳转到提供方到回调的最长时间
+	oidcProviderTTL  = time.Hour        // 发现文档缓存时间
+	oidcJWKSRefresh  = time.Minute      // 遇到未知 kid 时重新拉取公钥的最小间隔
+	oidcClockSkew    = time.Minute
+	oidcMaxResponse  = 1 << 20
+)
+
+var (
+	ErrInvalidOIDC   = errors.New("OIDC 配置无效")
+	ErrOIDCDisabled  = errors.New("未启用 OIDC 单点登录")
+	ErrOIDCLogin     = errors.New("OIDC 登录失败")
+	ErrOIDCForbidden = errors.New("该账号未被授权访问面板")
+)
+
+// 角色权限由低到高，多个分组匹配时取权限最高者
+var oidcRoleRank = map[string]int{
+	model.RoleViewer:   1,
+	model.RoleOperator: 2,
+	model.RoleAdmin:    3,
+}
+
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcPending struct {
+	verifier    string
+	nonce       string
+	redirectURL string
+	expiresAt   time.Time
+}
+
+// OIDCIdentity 通过提供方校验后的登录身份
+type OIDCIdentity struct {
+	Username string
+	Role     string
+	Groups   []string
+}
+
+// OIDCService 保存 OIDC 配置并实现授权码 + PKCE 登录流程。
+// 发现文档与签名公钥缓存在内存中，进行中的登录 state 也只保存在内存里。
+type OIDCService struct {
+	path   string
+	client *http.Client
+	now    func() time.Time
+	mu     sync.Mutex
+
+	pending         map[string]oidcPending
+	provider        *oidcProvider
+	providerIssuer  string
+	providerFetched time.Time
+	keys            map[string]crypto.PublicKey
+	keysFetched     time.Time
+}
+
+func NewOIDCService() *OIDCService {
+	return &OIDCService{
+		path:    oidcSettingsPath,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		now:     time.Now,
+		pending: make(map[string]oidcPending),
+	}
+}
+
+func (s *OIDCService) defaultSettings() model.OIDCSettings {
+	return model.OIDCSettings{
+		Scopes:        []string{"openid", "profile", "email"},
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		GroupRoles:    map[string]string{},
+	}
+}
+
+func (s *OIDCService) sanitize(input model.OIDCSettings) (model.OIDCSettings, error) {
+	output := s.defaultSettings()
+	output.Enabled = input.Enabled
+	output.DisplayName = strings.TrimSpace(input.DisplayName)
+	output.Issuer = strings.TrimRight(strings.TrimSpace(input.Issuer), "/")
+	output.ClientID = strings.TrimSpace(input.ClientID)
+	output.ClientSecret = strings.TrimSpace(input.ClientSecret)
+	output.RedirectURL = strings.TrimSpace(input.RedirectURL)
+	if claim := strings.TrimSpace(input.UsernameClaim); claim != "" {
+		output.UsernameClaim = claim
+	}
+	if claim := strings.TrimSpace(input.GroupsClaim); claim != "" {
+		output.GroupsClaim = claim
+	}
+
+	if output.Issuer != "" {
+		if err := validateOIDCURL(output.Issuer); err != nil {
+			return model.OIDCSettings{}, fmt.Errorf("%w: issuer %v", ErrInvalidOIDC, err)
+		}
+	}
+	if output.RedirectURL != "" {
+		if err := validateOIDCURL(output.RedirectURL); err != nil {
+			return model.OIDCSettings{}, fmt.Errorf("%w: redirect_url %v", ErrInvalidOIDC, err)
+		}
+	}
+	if output.Enabled && (output.Issuer == "" || output.ClientID == "") {
+		return model.OIDCSettings{}, fmt.Errorf("%w: 启用时必须填写 issuer 与 client_id", ErrInvalidOIDC)
+	}
+
+	if len(input.Scopes) > 0 {
+		scopes := []string{"openid"}
+		for _, scope := range input.Scopes {
+			scope = strings.TrimSpace(scope)
+			if scope != "" && scope != "openid" {
+				scopes = append(scopes, scope)
+			}
+		}
+		output.Scopes = scopes
+	}
+
+	for group, role := range input.GroupRoles {
+		group = strings.TrimSpace(group)
+		if group == "" {
+			continue
+		}
+		if err := validateRole(role); err != nil {
+			return model.OIDCSettings{}, fmt.Errorf("%w: 分组 %s 的角色无效", ErrInvalidOIDC, group)
+		}
+		output.GroupRoles[group] = role
+	}
+	if input.DefaultRole != "" {
+		if err := validateRole(input.DefaultRole); err != nil {
+			return model.OIDCSettings{}, fmt.Errorf("%w: 默认角色无效", ErrInvalidOIDC)
+		}
+		output.DefaultRole = input.DefaultRole
+	}
+	return output, nil
+}
+
+// validateOIDCURL 要求使用 https，仅本机地址允许 http 以便调试
+func validateOIDCURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("格式不正确")
+	}
+	switch parsed.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := parsed.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("必须使用 https")
+}
+
+func (s *OIDCService) load() (model.OIDCSettings, error) {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s.defaultSettings(), nil
+		}
+		return model.OIDCSettings{}, err
+	}
+
+	var settings model.OIDCSettings
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return model.OIDCSettings{}, err
+	}
+	normalized, err := s.sanitize(settings)
+	if err != nil {
+		return model.OIDCSettings{}, err
+	}
+	normalized.LastUpdatedUnixTime = settings.LastUpdatedUnixTime
+	return normalized, nil
+}
+
+func redactOIDCSettings(settings model.OIDCSettings) model.OIDCSettings {
+	settings.HasClientSecret = settings.ClientSecret != ""
+	settings.ClientSecret = ""
+	return settings
+}
+
+// Get 返回配置，不包含 client_secret
+func (s *OIDCService) Get() (model.OIDCSettings, error) {
+	settings, err := s.load()
+	if err != nil {
+		return model.OIDCSettings{}, err
+	}
+	return redactOIDCSettings(settings), nil
+}
+
+// Save 保存配置；client_secret 留空时沿用已保存的值
+func (s *OIDCService) Save(input model.OIDCSettings) (model.OIDCSettings, error) {
+	if strings.TrimSpace(input.ClientSecret) == "" {
+		current, err := s.load()
+		if err != nil {
+			return model.OIDCSettings{}, err
+		}
+		input.ClientSecret = current.ClientSecret
+	}
+	settings, err := s.sanitize(input)
+	if err != nil {
+		return model.OIDCSettings{}, err
+	}
+	settings.LastUpdatedUnixTime = time.Now().Unix()
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.OIDCSettings{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return model.OIDCSettings{}, err
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return model.OIDCSettings{}, err
+	}
+
+	// issuer 可能已变化，丢弃缓存的发现文档与公钥
+	s.mu.Lock()
+	s.provider = nil
+	s.keys = nil
+	s.mu.Unlock()
+	return redactOIDCSettings(settings), nil
+}
+
+// AuthCodeURL 生成跳转到提供方的授权地址，redirectURL 仅在配置未指定回调地址时使用
+func (s *OIDCService) AuthCodeURL(ctx context.Context, redirectURL string) (string, error) {
+	settings, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	if !settings.Enabled {
+		return "", ErrOIDCDisabled
+	}
+	if settings.RedirectURL != "" {
+		redirectURL = settings.RedirectURL
+	}
+	provider, err := s.discover(ctx, settings.Issuer)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomURLToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomURLToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomURLToken()
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	s.mu.Lock()
+	now := s.now()
+	for key, pending := range s.pending {
+		if now.After(pending.expiresAt) {
+			delete(s.pending, key)
+		}
+	}
+	s.pending[state] = oidcPending{
+		verifier:    verifier,
+		nonce:       nonce,
+		redirectURL: redirectURL,
+		expiresAt:   now.Add(oidcStateTTL),
+	}
+	s.mu.Unlock()
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", settings.ClientID)
+	query.Set("redirect_uri", redirectURL)
+	query.Set("scope", strings.Join(settings.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return provider.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange 用回调中的授权码换取并校验 ID Token，按分组映射出面板角色
+func (s *OIDCService) Exchange(ctx context.Context, state, code string) (OIDCIdentity, error) {
+	s.mu.Lock()
+	pending, ok := s.pending[state]
+	delete(s.pending, state)
+	s.mu.Unlock()
+	if !ok || s.now().After(pending.expiresAt) {
+		return OIDCIdentity{}, fmt.Errorf("%w: 登录请求无效或已过期，请重新登录", ErrOIDCLogin)
+	}
+
+	settings, err := s.load()
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	if !settings.Enabled {
+		return OIDCIdentity{}, ErrOIDCDisabled
+	}
+	provider, err := s.discover(ctx, settings.Issuer)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", pending.redirectURL)
+	form.Set("code_verifier", pending.verifier)
+	if settings.ClientSecret == "" {
+		// 公开客户端只靠 PKCE 保护
+		form.Set("client_id", settings.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if settings.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(settings.ClientID), url.QueryEscape(settings.ClientSecret))
+	}
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := s.doJSON(req, &tokens); err != nil && tokens.Error == "" {
+		return OIDCIdentity{}, fmt.Errorf("%w: 换取令牌失败: %v", ErrOIDCLogin, err)
+	}
+	if tokens.Error != "" {
+		return OIDCIdentity{}, fmt.Errorf("%w: %s %s", ErrOIDCLogin, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return OIDCIdentity{}, fmt.Errorf("%w: 提供方未返回 id_token", ErrOIDCLogin)
+	}
+
+	claims, err := s.verifyIDToken(ctx, settings, provider, tokens.IDToken, pending.nonce)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	// 部分提供方只在 userinfo 中返回用户名或分组
+	_, hasUsername := claims[settings.UsernameClaim]
+	_, hasGroups := claims[settings.GroupsClaim]
+	if (!hasUsername || !hasGroups) && provider.UserinfoEndpoint != "" && tokens.AccessToken != "" {
+		if err := s.mergeUserinfo(ctx, provider, tokens.AccessToken, claims); err != nil {
+			return OIDCIdentity{}, err
+		}
+	}
+
+	identity := OIDCIdentity{
+		Username: claimString(claims[settings.UsernameClaim]),
+		Groups:   claimStrings(claims[settings.GroupsClaim]),
+	}
+	if identity.Username == "" {
+		return OIDCIdentity{}, fmt.Errorf("%w: 身份信息中缺少 %s", ErrOIDCLogin, settings.UsernameClaim)
+	}
+	identity.Role = settings.DefaultRole
+	for _, group := range identity.Groups {
+		if role, ok := settings.GroupRoles[group]; ok && oidcRoleRank[role] > oidcRoleRank[identity.Role] {
+			identity.Role = role
+		}
+	}
+	if identity.Role == "" {
+		return OIDCIdentity{}, fmt.Errorf("%w: %s", ErrOIDCForbidden, identity.Username)
+	}
+	return identity, nil
+}
+
+func (s *OIDCService) mergeUserinfo(ctx context.Context, provider *oidcProvider, accessToken string, claims map[string]interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.UserinfoEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	var info map[string]interface{}
+	if err := s.doJSON(req, &info); err != nil {
+		return fmt.Errorf("%w: 获取 userinfo 失败: %v", ErrOIDCLogin, err)
+	}
+	if claimString(info["sub"]) != claimString(claims["sub"]) {
+		return fmt.Errorf("%w: userinfo 与 id_token 的 sub 不一致", ErrOIDCLogin)
+	}
+	for key, value := range info {
+		if _, ok := claims[key]; !ok {
+			claims[key] = value
+		}
+	}
+	return nil
+}
+
+func (s *OIDCService) discover(ctx context.Context, issuer string) (*oidcProvider, error) {
+	s.mu.Lock()
+	if s.provider != nil && s.providerIssuer == issuer && s.now().Sub(s.providerFetched) < oidcProviderTTL {
+		provider := s.provider
+		s.mu.Unlock()
+		return provider, nil
+	}
+	s.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var provider oidcProvider
+	if err := s.doJSON(req, &provider); err != nil {
+		return nil, fmt.Errorf("%w: 获取发现文档失败: %v", ErrOIDCLogin, err)
+	}
+	if strings.TrimRight(provider.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("%w: 发现文档中的 issuer %q 与配置不一致", ErrOIDCLogin, provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: 发现文档缺少必要的端点", ErrOIDCLogin)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.providerIssuer != issuer {
+		s.keys = nil
+	}
+	s.provider = &provider
+	s.providerIssuer = issuer
+	s.providerFetched = s.now()
+	return &provider, nil
+}
+
+// publicKey 返回 kid 对应的签名公钥，未知 kid 时（提供方轮换密钥）重新拉取 JWKS
+func (s *OIDCService) publicKey(ctx context.Context, provider *oidcProvider, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	key, ok := lookupJWK(s.keys, kid)
+	refresh := s.keys == nil || s.now().Sub(s.keysFetched) >= oidcJWKSRefresh
+	s.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !refresh {
+		return nil, fmt.Errorf("%w: 未知的签名密钥 %q", ErrOIDCLogin, kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := s.doJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("%w: 获取签名公钥失败: %v", ErrOIDCLogin, err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, raw := range set.Keys {
+		id, parsed, err := parseJWK(raw)
+		if err != nil {
+			continue // 忽略不支持的密钥类型
+		}
+		keys[id] = parsed
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.keysFetched = s.now()
+	s.mu.Unlock()
+	if key, ok := lookupJWK(keys, kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: 未知的签名密钥 %q", ErrOIDCLogin, kid)
+}
+
+// lookupJWK 令牌未指定 kid 且提供方只有一个密钥时直接使用该密钥
+func lookupJWK(keys map[string]crypto.PublicKey, kid string) (crypto.PublicKey, bool) {
+	if key, ok := keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func parseJWK(raw json.RawMessage) (string, crypto.PublicKey, error) {
+	var jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", nil, err
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return "", nil, fmt.Errorf("非签名密钥")
+	}
+	decode := func(value string) (*big.Int, error) {
+		data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+		if err != nil || len(data) == 0 {
+			return nil, fmt.Errorf("密钥参数无效")
+		}
+		return new(big.Int).SetBytes(data), nil
+	}
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return "", nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil || !e.IsInt64() {
+			return "", nil, fmt.Errorf("密钥参数无效")
+		}
+		return jwk.Kid, &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return "", nil, fmt.Errorf("不支持的曲线 %s", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return "", nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return "", nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return "", nil, fmt.Errorf("密钥参数无效")
+		}
+		return jwk.Kid, &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return "", nil, fmt.Errorf("不支持的密钥类型 %s", jwk.Kty)
+}
+
+func (s *OIDCService) verifyIDToken(ctx context.Context, settings model.OIDCSettings, provider *oidcProvider, token, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: id_token 格式不正确", ErrOIDCLogin)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: id_token 格式不正确", ErrOIDCLogin)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: id_token 格式不正确", ErrOIDCLogin)
+	}
+	key, err := s.publicKey(ctx, provider, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: id_token 签名无效: %v", ErrOIDCLogin, err)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: id_token 格式不正确", ErrOIDCLogin)
+	}
+	if strings.TrimRight(claimString(claims["iss"]), "/") != settings.Issuer {
+		return nil, fmt.Errorf("%w: id_token 的签发方不匹配", ErrOIDCLogin)
+	}
+	audiences := claimStrings(claims["aud"])
+	audienceOK := false
+	for _, aud := range audiences {
+		if aud == settings.ClientID {
+			audienceOK = true
+		}
+	}
+	if !audienceOK || (len(audiences) > 1 && claimString(claims["azp"]) != settings.ClientID) {
+		return nil, fmt.Errorf("%w: id_token 的受众不匹配", ErrOIDCLogin)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || s.now().After(time.Unix(int64(exp), 0).Add(oidcClockSkew)) {
+		return nil, fmt.Errorf("%w: id_token 已过期", ErrOIDCLogin)
+	}
+	if claimString(claims["nonce"]) != nonce {
+		return nil, fmt.Errorf("%w: id_token 的 nonce 不匹配", ErrOIDCLogin)
+	}
+	return claims, nil
+}
+
+func verifyJWTSignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("不支持的算法 %q", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("不支持的算法 %s", alg)
+	}
+	hasher := hash.New()
+	hasher.Write([]byte(signingInput))
+	digest := hasher.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("算法 %s 与密钥类型不匹配", alg)
+		}
+		if alg[:2] == "PS" {
+			return rsa.VerifyPSS(pub, hash, digest, signature, nil)
+		}
+		return rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("算法 %s 与密钥类型不匹配", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("签名长度不正确")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		sig := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, sig) {
+			return fmt.Errorf("签名不匹配")
+		}
+		return nil
+	}
+	return fmt.Errorf("不支持的算法 %s", alg)
+}
+
+func decodeJWTSegment(segment string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func (s *OIDCService) doJSON(req *http.Request, target interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, oidcMaxResponse))
+	if err != nil {
+		return err
+	}
+	// 错误响应同样尝试解析，以便调用方读取 error 字段
+	decodeErr := json.Unmarshal(body, target)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return decodeErr
+}
+
+func claimString(value interface{}) string {
+	if text, ok := value.(string); ok {
+		return strings.TrimSpace(text)
+	}
+	return ""
+}
+
+// claimStrings 兼容单个字符串与字符串数组两种写法
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if v = strings.TrimSpace(v); v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if text := claimString(item); text != "" {
+				values = append(values, text)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func randomURLToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
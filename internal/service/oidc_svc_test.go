@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+type fakeOIDCProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	nonce    string
+	audience string
+	groups   []string
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	p := &fakeOIDCProvider{key: key, audience: "panel", groups: []string{"staff", "nginx-ops"}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "panel" || secret != "s3cret" || r.FormValue("code") != "good-code" || r.FormValue("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.idToken(t)})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *fakeOIDCProvider) idToken(t *testing.T) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":                p.server.URL,
+		"sub":                "1234",
+		"aud":                p.audience,
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"nonce":              p.nonce,
+		"preferred_username": "alice@example.com",
+		"groups":             p.groups,
+	})
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// begin 发起登录并记下 nonce，模拟浏览器跳转到提供方
+func (p *fakeOIDCProvider) begin(t *testing.T, svc *OIDCService) string {
+	t.Helper()
+	authURL, err := svc.AuthCodeURL(context.Background(), "https://panel.example.com/api/v1/auth/oidc/callback")
+	if err != nil {
+		t.Fatalf("auth code url: %v", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	if !strings.HasPrefix(authURL, p.server.URL+"/authorize?") || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected auth url %s", authURL)
+	}
+	p.nonce = query.Get("nonce")
+	return query.Get("state")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	svc := NewOIDCService()
+	svc.path = filepath.Join(t.TempDir(), "oidc.json")
+
+	if _, err := svc.AuthCodeURL(context.Background(), ""); !errors.Is(err, ErrOIDCDisabled) {
+		t.Fatalf("expected disabled, got %v", err)
+	}
+	if _, err := svc.Save(model.OIDCSettings{Enabled: true, Issuer: "http://idp.example.com", ClientID: "panel"}); !errors.Is(err, ErrInvalidOIDC) {
+		t.Fatalf("plain http issuer should be rejected, got %v", err)
+	}
+	saved, err := svc.Save(model.OIDCSettings{
+		Enabled:      true,
+		Issuer:       provider.server.URL + "/",
+		ClientID:     "panel",
+		ClientSecret: "s3cret",
+		GroupRoles:   map[string]string{"staff": model.RoleViewer, "nginx-ops": model.RoleOperator},
+	})
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if saved.ClientSecret != "" || !saved.HasClientSecret {
+		t.Fatalf("client secret must not be returned: %+v", saved)
+	}
+	// 留空 client_secret 时沿用原值
+	if _, err := svc.Save(model.OIDCSettings{Enabled: true, Issuer: provider.server.URL, ClientID: "panel",
+		GroupRoles: map[string]string{"staff": model.RoleViewer, "nginx-ops": model.RoleOperator}}); err != nil {
+		t.Fatalf("save without secret: %v", err)
+	}
+
+	state := provider.begin(t, svc)
+	identity, err := svc.Exchange(context.Background(), state, "good-code")
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if identity.Username != "alice@example.com" || identity.Role != model.RoleOperator {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+	if _, err := svc.Exchange(context.Background(), state, "good-code"); !errors.Is(err, ErrOIDCLogin) {
+		t.Fatalf("state must be single use, got %v", err)
+	}
+
+	provider.groups = []string{"guests"}
+	state = provider.begin(t, svc)
+	if _, err := svc.Exchange(context.Background(), state, "good-code"); !errors.Is(err, ErrOIDCForbidden) {
+		t.Fatalf("unmapped groups should be rejected, got %v", err)
+	}
+
+	provider.groups = []string{"staff"}
+	provider.audience = "someone-else"
+	state = provider.begin(t, svc)
+	if _, err := svc.Exchange(context.Background(), state, "good-code"); !errors.Is(err, ErrOIDCLogin) {
+		t.Fatalf("wrong audience should be rejected, got %v", err)
+	}
+}
+
+func TestUserStoreLoginExternal(t *testing.T) {
+	store, err := NewUserStore(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	// 尚无账号时首个单点登录用户成为管理员
+	token, _, err := store.LoginExternal("oidc", "alice@example.com", model.RoleViewer, true, SessionClient{})
+	if err != nil {
+		t.Fatalf("login external: %v", err)
+	}
+	user, _, err := store.Validate(token)
+	if err != nil || user.Role != model.RoleAdmin || user.Source != "oidc" {
+		t.Fatalf("first external user should be admin: %+v, %v", user, err)
+	}
+	if _, _, err := store.Login("alice@example.com", "", "", SessionClient{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("external user must not log in with a password, got %v", err)
+	}
+
+	if _, err := store.CreateUser("bob", "correct-horse", model.RoleAdmin); err != nil {
+		t.Fatalf("create bob: %v", err)
+	}
+	if _, _, err := store.LoginExternal("oidc", "bob", model.RoleAdmin, true, SessionClient{}); !errors.Is(err, ErrExternalConflict) {
+		t.Fatalf("local account must not be taken over, got %v", err)
+	}
+	token, _, err = store.LoginExternal("oidc", "alice@example.com", model.RoleViewer, true, SessionClient{})
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if user, _, _ := store.Validate(token); user.Role != model.RoleViewer {
+		t.Fatalf("role should follow the provider groups, got %s", user.Role)
+	}
+}
+
+func TestUserStoreLoginExternalWithLegacyToken(t *testing.T) {
+	store, err := NewUserStore(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	// 已设置旧登录令牌时，首个单点登录用户按分组映射的角色创建
+	token, _, err := store.LoginExternal("oidc", "alice@example.com", model.RoleViewer, false, SessionClient{})
+	if err != nil {
+		t.Fatalf("login external: %v", err)
+	}
+	if user, _, _ := store.Validate(token); user.Role != model.RoleViewer {
+		t.Fatalf("first external user should keep the mapped role, got %s", user.Role)
+	}
+	// 没有管理员账号时旧令牌仍然有效
+	if hasAdmin, err := store.HasAdmin(); err != nil || hasAdmin {
+		t.Fatalf("no admin expected: %v %v", hasAdmin, err)
+	}
+	if _, _, err := store.LoginExternal("oidc", "carol@example.com", model.RoleAdmin, false, SessionClient{}); err != nil {
+		t.Fatalf("login external: %v", err)
+	}
+	if hasAdmin, _ := store.HasAdmin(); !hasAdmin {
+		t.Fatal("mapped admin should count as admin")
+	}
+}
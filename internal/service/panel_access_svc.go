@@ -0,0 +1,187 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const panelAccessSettingsPath = "/root/panel_access.json"
+
+var ErrInvalidPanelAccess = errors.New("面板访问白名单无效")
+
+// PanelAccessService 维护面板来源 IP 白名单。配置文件可直接手工编辑，
+// 按修改时间缓存解析结果，避免每个请求都读取磁盘。本机回环地址始终放行。
+type PanelAccessService struct {
+	path string
+	mu   sync.Mutex
+
+	cachedModTime time.Time
+	cachedNets    []*net.IPNet
+}
+
+func NewPanelAccessService() *PanelAccessService {
+	return &PanelAccessService{
+		path: panelAccessSettingsPath,
+	}
+}
+
+func (s *PanelAccessService) defaultSettings() model.PanelAccessSettings {
+	return model.PanelAccessSettings{
+		AllowedCIDRs: []string{},
+	}
+}
+
+func (s *PanelAccessService) sanitize(input model.PanelAccessSettings) (model.PanelAccessSettings, []*net.IPNet, error) {
+	output := s.defaultSettings()
+	var nets []*net.IPNet
+	seen := make(map[string]bool, len(input.AllowedCIDRs))
+	for _, entry := range input.AllowedCIDRs {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return model.PanelAccessSettings{}, nil, fmt.Errorf("%w: 无法解析 %q", ErrInvalidPanelAccess, entry)
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return model.PanelAccessSettings{}, nil, fmt.Errorf("%w: 无法解析 %q", ErrInvalidPanelAccess, entry)
+		}
+		normalized := ipNet.String()
+		if seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		output.AllowedCIDRs = append(output.AllowedCIDRs, normalized)
+		nets = append(nets, ipNet)
+	}
+	return output, nets, nil
+}
+
+func (s *PanelAccessService) Get() (model.PanelAccessSettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s.defaultSettings(), nil
+		}
+		return model.PanelAccessSettings{}, err
+	}
+
+	var settings model.PanelAccessSettings
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return model.PanelAccessSettings{}, err
+	}
+	normalized, _, err := s.sanitize(settings)
+	if err != nil {
+		return model.PanelAccessSettings{}, err
+	}
+	normalized.LastUpdatedUnixTime = settings.LastUpdatedUnixTime
+	return normalized, nil
+}
+
+// Save 保存白名单；若新名单不包含 requester，拒绝保存以免把当前操作者锁在面板之外
+func (s *PanelAccessService) Save(input model.PanelAccessSettings, requester net.IP) (model.PanelAccessSettings, error) {
+	settings, nets, err := s.sanitize(input)
+	if err != nil {
+		return model.PanelAccessSettings{}, err
+	}
+	if requester != nil && !ipAllowed(nets, requester) {
+		return model.PanelAccessSettings{}, fmt.Errorf("%w: 当前来源 IP %s 不在名单中，保存后将无法访问面板", ErrInvalidPanelAccess, requester)
+	}
+	settings.LastUpdatedUnixTime = time.Now().Unix()
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.PanelAccessSettings{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return model.PanelAccessSettings{}, err
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return model.PanelAccessSettings{}, err
+	}
+	s.cachedModTime = time.Time{}
+	return settings, nil
+}
+
+// Allowed 判断来源 IP 是否可以访问面板
+func (s *PanelAccessService) Allowed(ip net.IP) (bool, error) {
+	if ip == nil {
+		return false, nil
+	}
+	if ip.IsLoopback() {
+		return true, nil
+	}
+	nets, err := s.networks()
+	if err != nil {
+		return false, err
+	}
+	return ipAllowed(nets, ip), nil
+}
+
+func (s *PanelAccessService) networks() ([]*net.IPNet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if info.ModTime().Equal(s.cachedModTime) {
+		return s.cachedNets, nil
+	}
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var settings model.PanelAccessSettings
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return nil, fmt.Errorf("%w: 解析 %s 失败: %v", ErrInvalidPanelAccess, s.path, err)
+	}
+	_, nets, err := s.sanitize(settings)
+	if err != nil {
+		return nil, err
+	}
+	s.cachedModTime = info.ModTime()
+	s.cachedNets = nets
+	return nets, nil
+}
+
+// ipAllowed 名单为空时放行所有来源
+func ipAllowed(nets []*net.IPNet, ip net.IP) bool {
+	if len(nets) == 0 || ip.IsLoopback() {
+		return true
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
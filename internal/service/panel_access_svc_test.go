@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+func TestPanelAccessAllowlist(t *testing.T) {
+	svc := NewPanelAccessService()
+	svc.path = filepath.Join(t.TempDir(), "panel_access.json")
+
+	if ok, err := svc.Allowed(net.ParseIP("198.51.100.9")); err != nil || !ok {
+		t.Fatalf("empty allowlist should allow everyone: %v, %v", ok, err)
+	}
+
+	input := model.PanelAccessSettings{AllowedCIDRs: []string{"10.8.0.0/24", " 203.0.113.7 ", "10.8.0.5/24", "2001:db8::/32"}}
+	if _, err := svc.Save(input, net.ParseIP("198.51.100.9")); !errors.Is(err, ErrInvalidPanelAccess) {
+		t.Fatalf("saving a list that excludes the requester should fail, got %v", err)
+	}
+	saved, err := svc.Save(input, net.ParseIP("10.8.0.20"))
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if want := []string{"10.8.0.0/24", "203.0.113.7/32", "2001:db8::/32"}; !reflect.DeepEqual(saved.AllowedCIDRs, want) {
+		t.Fatalf("normalized cidrs %v, want %v", saved.AllowedCIDRs, want)
+	}
+
+	for ip, want := range map[string]bool{
+		"10.8.0.77":    true,
+		"203.0.113.7":  true,
+		"203.0.113.8":  false,
+		"2001:db8::1":  true,
+		"127.0.0.1":    true,
+		"198.51.100.9": false,
+	} {
+		if ok, err := svc.Allowed(net.ParseIP(ip)); err != nil || ok != want {
+			t.Fatalf("%s: allowed=%v err=%v, want %v", ip, ok, err, want)
+		}
+	}
+
+	// 手工编辑配置文件后立即生效
+	if err := os.WriteFile(svc.path, []byte(`{"allowed_cidrs":["198.51.100.0/24"]}`), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(svc.path, future, future); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if ok, _ := svc.Allowed(net.ParseIP("198.51.100.9")); !ok {
+		t.Fatalf("hand-edited allowlist was not picked up")
+	}
+}
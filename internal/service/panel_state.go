@@ -0,0 +1,122 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// panelStateFile 面板自身的配置与状态文件，secret 表示含有密码哈希、令牌或私钥
+type panelStateFile struct {
+	path   string
+	secret bool
+}
+
+// panelStateFiles 随备份打包的面板状态。账号与令牌文件位于面板工作目录，按绝对路径保存
+func panelStateFiles() []panelStateFile {
+	workDir, err := filepath.Abs(".")
+	if err != nil {
+		workDir = "/root"
+	}
+	return []panelStateFile{
+		{path: filepath.Join(workDir, "auth_token.json"), secret: true},
+		{path: filepath.Join(workDir, "users.json"), secret: true},
+		{path: stateStorePath, secret: true},
+		{path: oidcSettingsPath, secret: true},
+		{path: logShippingSettingsPath, secret: true},
+		{path: panelSelfSignedDir, secret: true},
+		{path: "/root/backup_settings.json", secret: true},
+		{path: "/root/.config/rclone/rclone.conf", secret: true},
+		{path: "/root/.config/rclone/backup_sftp.key", secret: true},
+		{path: "/root/backup_config.conf"},
+		{path: "/root/backup_schedule.json"},
+		{path: panelAccessSettingsPath},
+		{path: panelTLSSettingsPath},
+		{path: readOnlySettingsPath},
+		{path: siteDefaultsPath},
+		{path: botBlockSettingsPath},
+		{path: healthCheckSettingsPath},
+		{path: siteStatsDir},
+		{path: systemMetricsPath},
+		{path: trafficHistoryPath},
+		{path: uptimeSettingsPath},
+		{path: uptimeStatePath},
+		{path: abuseSettingsPath},
+		{path: logRotateSettingsPath},
+		{path: certMonitorSettingsPath},
+		{path: globalTuningSettingsPath},
+		{path: firewallSettingsPath},
+		{path: fail2banSettingsPath},
+		{path: nginxBuildProfilePath},
+		{path: nginxInstallManifestPath},
+	}
+}
+
+// panelStatePaths 返回需要打包的面板状态路径，skipSecrets 时跳过含凭据的文件
+func panelStatePaths(skipSecrets bool) []string {
+	var paths []string
+	for _, file := range panelStateFiles() {
+		if skipSecrets && file.secret {
+			continue
+		}
+		paths = append(paths, file.path)
+	}
+	return paths
+}
+
+// restorePanelState 将解压目录中的面板状态复制回原位置，返回恢复的路径。
+// 面板运行期间账号等数据缓存在内存中，需重启面板后生效；旧版本备份中的独立状态文件在重启时导入状态库
+func restorePanelState(root string) ([]string, error) {
+	var restored []string
+	files := panelStateFiles()
+	for _, path := range legacyStateFiles {
+		files = append(files, panelStateFile{path: path, secret: true})
+	}
+	for _, file := range files {
+		src := filepath.Join(root, strings.TrimPrefix(file.path, "/"))
+		info, err := os.Lstat(src)
+		if err != nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(file.path), 0700); err != nil {
+			return restored, err
+		}
+		if info.IsDir() {
+			if err := copyDirContents(src, file.path); err != nil {
+				return restored, err
+			}
+		} else if err := copyFileMode(src, file.path, info.Mode().Perm()); err != nil {
+			return restored, err
+		}
+		restored = append(restored, file.path)
+	}
+	return restored, nil
+}
+
+func copyFileMode(src, dest string, mode os.FileMode) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dest, data, mode)
+}
+
+func copyDirContents(src, dest string) error {
+	if err := os.MkdirAll(dest, 0700); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if err := copyFileMode(filepath.Join(src, entry.Name()), filepath.Join(dest, entry.Name()), info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
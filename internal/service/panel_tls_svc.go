@@ -0,0 +1,340 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	panelTLSSettingsPath = "/root/panel_tls.json"
+	panelSelfSignedDir   = "/root/panel_tls"
+)
+
+var ErrInvalidPanelTLS = errors.New("面板 HTTPS 配置无效")
+
+var panelTLSModes = map[string]bool{
+	"off":         true,
+	"custom":      true,
+	"self_signed": true,
+	"acme":        true,
+}
+
+// panelCertCheckInterval 证书文件的检查间隔，续期后无需重启面板即可生效
+const panelCertCheckInterval = time.Minute
+
+// PanelTLSService 管理面板自身的 HTTPS：自定义证书、首次启动自动生成的自签名证书，
+// 或复用 nginx-acme 为面板域名签发的证书
+type PanelTLSService struct {
+	path          string
+	SelfSignedDir string
+	mu            sync.Mutex
+}
+
+func NewPanelTLSService() *PanelTLSService {
+	return &PanelTLSService{
+		path:          panelTLSSettingsPath,
+		SelfSignedDir: panelSelfSignedDir,
+	}
+}
+
+func (s *PanelTLSService) defaultSettings() model.PanelTLSSettings {
+	return model.PanelTLSSettings{
+		Mode:         "off",
+		ACMEStateDir: filepath.Join(model.NginxPrefix, "acme_letsencrypt"),
+	}
+}
+
+func (s *PanelTLSService) sanitize(input model.PanelTLSSettings) (model.PanelTLSSettings, error) {
+	output := s.defaultSettings()
+	mode := strings.ToLower(strings.TrimSpace(input.Mode))
+	if mode != "" {
+		if !panelTLSModes[mode] {
+			return model.PanelTLSSettings{}, fmt.Errorf("%w: 不支持的模式 %s", ErrInvalidPanelTLS, mode)
+		}
+		output.Mode = mode
+	}
+	output.Domain = strings.ToLower(strings.TrimSpace(input.Domain))
+	if dir := strings.TrimSpace(input.ACMEStateDir); dir != "" {
+		output.ACMEStateDir = filepath.Clean(dir)
+	}
+	output.CertFile = strings.TrimSpace(input.CertFile)
+	output.KeyFile = strings.TrimSpace(input.KeyFile)
+
+	switch output.Mode {
+	case "custom":
+		if !filepath.IsAbs(output.CertFile) || !filepath.IsAbs(output.KeyFile) {
+			return model.PanelTLSSettings{}, fmt.Errorf("%w: 证书与私钥需使用绝对路径", ErrInvalidPanelTLS)
+		}
+	case "acme":
+		if output.Domain == "" || !sniHostnamePattern.MatchString(output.Domain) || strings.HasPrefix(output.Domain, "*") {
+			return model.PanelTLSSettings{}, fmt.Errorf("%w: 请填写面板域名", ErrInvalidPanelTLS)
+		}
+	}
+	return output, nil
+}
+
+func (s *PanelTLSService) Get() (model.PanelTLSSettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s.defaultSettings(), nil
+		}
+		return model.PanelTLSSettings{}, err
+	}
+
+	var settings model.PanelTLSSettings
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return model.PanelTLSSettings{}, err
+	}
+	normalized, err := s.sanitize(settings)
+	if err != nil {
+		return model.PanelTLSSettings{}, err
+	}
+	normalized.LastUpdatedUnixTime = settings.LastUpdatedUnixTime
+	return normalized, nil
+}
+
+// Save 校验证书可用后保存，重启面板后生效
+func (s *PanelTLSService) Save(input model.PanelTLSSettings) (model.PanelTLSSettings, error) {
+	settings, err := s.sanitize(input)
+	if err != nil {
+		return model.PanelTLSSettings{}, err
+	}
+	if settings.Mode != "off" {
+		if _, err := s.certSource(settings)(); err != nil {
+			return model.PanelTLSSettings{}, fmt.Errorf("%w: %v", ErrInvalidPanelTLS, err)
+		}
+	}
+	settings.LastUpdatedUnixTime = time.Now().Unix()
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.PanelTLSSettings{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return model.PanelTLSSettings{}, err
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return model.PanelTLSSettings{}, err
+	}
+	return settings, nil
+}
+
+// TLSConfig 返回面板监听使用的 TLS 配置，未启用 HTTPS 时返回 nil
+func (s *PanelTLSService) TLSConfig() (*tls.Config, error) {
+	settings, err := s.Get()
+	if err != nil {
+		return nil, err
+	}
+	if settings.Mode == "off" {
+		return nil, nil
+	}
+	loader := &panelCertLoader{source: s.certSource(settings)}
+	if _, err := loader.get(); err != nil {
+		return nil, fmt.Errorf("加载面板证书失败: %w", err)
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return loader.get()
+		},
+	}, nil
+}
+
+type certFiles struct {
+	cert, key string
+}
+
+func (s *PanelTLSService) certSource(settings model.PanelTLSSettings) func() (certFiles, error) {
+	switch settings.Mode {
+	case "custom":
+		return func() (certFiles, error) {
+			files := certFiles{settings.CertFile, settings.KeyFile}
+			_, err := tls.LoadX509KeyPair(files.cert, files.key)
+			return files, err
+		}
+	case "self_signed":
+		return func() (certFiles, error) {
+			return s.ensureSelfSigned(settings.Domain)
+		}
+	default:
+		return func() (certFiles, error) {
+			return findACMECert(settings.ACMEStateDir, settings.Domain, time.Now())
+		}
+	}
+}
+
+// ensureSelfSigned 证书不存在时生成自签名证书，已存在则直接复用
+func (s *PanelTLSService) ensureSelfSigned(domain string) (certFiles, error) {
+	files := certFiles{
+		cert: filepath.Join(s.SelfSignedDir, "panel.crt"),
+		key:  filepath.Join(s.SelfSignedDir, "panel.key"),
+	}
+	if _, err := tls.LoadX509KeyPair(files.cert, files.key); err == nil {
+		return files, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return certFiles{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return certFiles{}, err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "ngx-nova panel"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	for _, name := range []string{hostname, domain} {
+		if name != "" && name != "localhost" {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return certFiles{}, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return certFiles{}, err
+	}
+
+	if err := os.MkdirAll(s.SelfSignedDir, 0700); err != nil {
+		return certFiles{}, err
+	}
+	if err := os.WriteFile(files.key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return certFiles{}, err
+	}
+	if err := os.WriteFile(files.cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return certFiles{}, err
+	}
+	return files, nil
+}
+
+// findACMECert 在 nginx-acme 状态目录中查找覆盖 domain 且仍在有效期内的证书，
+// 私钥为同名的 .key 文件；存在多张时取到期时间最晚的一张
+func findACMECert(dir, domain string, now time.Time) (certFiles, error) {
+	var best certFiles
+	var bestExpiry time.Time
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(path)
+		if d.IsDir() || (ext != ".crt" && ext != ".pem") {
+			return nil
+		}
+		leaf, err := readLeafCert(path)
+		if err != nil || leaf.VerifyHostname(domain) != nil || now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+			return nil
+		}
+		keyPath := strings.TrimSuffix(path, ext) + ".key"
+		if _, err := os.Stat(keyPath); err != nil {
+			return nil
+		}
+		if leaf.NotAfter.After(bestExpiry) {
+			best = certFiles{path, keyPath}
+			bestExpiry = leaf.NotAfter
+		}
+		return nil
+	})
+	if err != nil {
+		return certFiles{}, fmt.Errorf("读取 ACME 证书目录失败: %w", err)
+	}
+	if best.cert == "" {
+		return certFiles{}, fmt.Errorf("%s 中没有覆盖 %s 的有效证书，请先为该域名创建站点并完成签发", dir, domain)
+	}
+	return best, nil
+}
+
+func readLeafCert(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("不是 PEM 证书")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// panelCertLoader 定期检查证书来源，文件变化（如 ACME 续期）后重新加载
+type panelCertLoader struct {
+	source func() (certFiles, error)
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	files     certFiles
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func (l *panelCertLoader) get() (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cert != nil && time.Since(l.checkedAt) < panelCertCheckInterval {
+		return l.cert, nil
+	}
+	l.checkedAt = time.Now()
+
+	files, err := l.source()
+	if err != nil {
+		// 暂时找不到新证书时继续使用已加载的证书
+		if l.cert != nil {
+			return l.cert, nil
+		}
+		return nil, err
+	}
+	info, err := os.Stat(files.cert)
+	if err != nil {
+		if l.cert != nil {
+			return l.cert, nil
+		}
+		return nil, err
+	}
+	if l.cert != nil && files == l.files && info.ModTime().Equal(l.modTime) {
+		return l.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(files.cert, files.key)
+	if err != nil {
+		if l.cert != nil {
+			return l.cert, nil
+		}
+		return nil, err
+	}
+	l.cert, l.files, l.modTime = &cert, files, info.ModTime()
+	return l.cert, nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+func writeTestCert(t *testing.T, dir, name, host string, notAfter time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    notAfter.AddDate(0, -3, 0),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create cert: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+}
+
+func TestFindACMECert(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeTestCert(t, dir, "old", "panel.example.com", now.AddDate(0, 0, 10))
+	writeTestCert(t, dir, "new", "panel.example.com", now.AddDate(0, 0, 80))
+	writeTestCert(t, dir, "other", "www.example.com", now.AddDate(0, 0, 89))
+	writeTestCert(t, dir, "expired", "panel.example.com", now.AddDate(0, 0, -1))
+
+	files, err := findACMECert(dir, "panel.example.com", now)
+	if err != nil {
+		t.Fatalf("find cert: %v", err)
+	}
+	if files.cert != filepath.Join(dir, "new.crt") || files.key != filepath.Join(dir, "new.key") {
+		t.Fatalf("expected the latest valid cert, got %+v", files)
+	}
+	if _, err := findACMECert(dir, "missing.example.com", now); err == nil {
+		t.Fatalf("expected error for a domain without certificate")
+	}
+}
+
+func TestPanelTLSSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	svc := NewPanelTLSService()
+	svc.path = filepath.Join(dir, "panel_tls.json")
+	svc.SelfSignedDir = filepath.Join(dir, "tls")
+
+	if cfg, err := svc.TLSConfig(); err != nil || cfg != nil {
+		t.Fatalf("default mode should serve plain HTTP: %v, %v", cfg, err)
+	}
+	if _, err := svc.Save(model.PanelTLSSettings{Mode: "custom", CertFile: "relative.crt", KeyFile: "/tmp/x.key"}); err == nil {
+		t.Fatalf("expected relative cert path to be rejected")
+	}
+	if _, err := svc.Save(model.PanelTLSSettings{Mode: "self_signed"}); err != nil {
+		t.Fatalf("save self_signed: %v", err)
+	}
+	first, err := os.ReadFile(filepath.Join(svc.SelfSignedDir, "panel.crt"))
+	if err != nil {
+		t.Fatalf("self-signed cert not generated: %v", err)
+	}
+	cfg, err := svc.TLSConfig()
+	if err != nil || cfg == nil {
+		t.Fatalf("tls config: %v, %v", cfg, err)
+	}
+	if cert, err := cfg.GetCertificate(nil); err != nil || cert == nil {
+		t.Fatalf("get certificate: %v", err)
+	}
+	// 已存在的自签名证书不会被重新生成
+	second, _ := os.ReadFile(filepath.Join(svc.SelfSignedDir, "panel.crt"))
+	if string(first) != string(second) {
+		t.Fatalf("self-signed cert should be reused")
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"nginx-mgr/internal/executor"
+)
+
+// PanelUnitPath nginx-mgr 自身的 systemd 单元
+const PanelUnitPath = "/etc/systemd/system/nginx-mgr.service"
+
+var ErrInvalidPanelUnit = errors.New("面板服务参数无效")
+
+var (
+	unitUserPattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+	unitEnvPattern  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+)
+
+// 非 root 账号安装时会递归修改工作目录的所有者，以下系统目录不能作为其工作目录：
+// panelUnitSystemDirs 只拒绝目录本身，panelUnitSystemTrees 连同子目录一并拒绝
+var (
+	panelUnitSystemDirs  = []string{"/", "/home", "/opt", "/srv", "/var", "/var/lib", "/tmp", "/mnt", "/media"}
+	panelUnitSystemTrees = []string{"/root", "/usr", "/bin", "/sbin", "/lib", "/lib64", "/etc", "/boot", "/dev", "/proc", "/sys", "/run"}
+)
+
+// systemWorkDir 判断 dir 是否为不能交给非 root 账号的系统目录
+func systemWorkDir(dir string) bool {
+	dir = filepath.Clean(dir)
+	for _, system := range panelUnitSystemDirs {
+		if dir == system {
+			return true
+		}
+	}
+	for _, tree := range panelUnitSystemTrees {
+		if dir == tree || strings.HasPrefix(dir, tree+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// PanelUnitOptions 面板 systemd 单元的参数。面板从工作目录读取 auth_token.json 等文件，
+// WorkDir 需与原先手动启动时的目录一致
+type PanelUnitOptions struct {
+	Binary  string
+	WorkDir string
+	User    string
+	Env     []string // KEY=VALUE
+	Restart string   // always、on-failure 或 on-abnormal
+}
+
+// RenderPanelUnit 校验参数并生成单元内容。非 root 账号只授予绑定低端口的能力，
+// 安装 Nginx、防火墙与 fail2ban 等需要 root 的功能将无法使用
+func RenderPanelUnit(opts PanelUnitOptions) (string, error) {
+	if !filepath.IsAbs(opts.Binary) || !filepath.IsAbs(opts.WorkDir) {
+		return "", fmt.Errorf("%w: 程序路径与工作目录必须是绝对路径", ErrInvalidPanelUnit)
+	}
+	if strings.ContainsAny(opts.Binary+opts.WorkDir, " \t\r\n%") {
+		return "", fmt.Errorf("%w: 程序路径与工作目录不能包含空白字符或 %%", ErrInvalidPanelUnit)
+	}
+	if !unitUserPattern.MatchString(opts.User) {
+		return "", fmt.Errorf("%w: 账号名 %q 不合法", ErrInvalidPanelUnit, opts.User)
+	}
+	if opts.User != "root" && systemWorkDir(opts.WorkDir) {
+		return "", fmt.Errorf("%w: 非 root 账号的工作目录不能是系统目录 %s，请指定面板专用目录", ErrInvalidPanelUnit, opts.WorkDir)
+	}
+	switch opts.Restart {
+	case "always", "on-failure", "on-abnormal":
+	default:
+		return "", fmt.Errorf("%w: 重启策略仅支持 always、on-failure 或 on-abnormal", ErrInvalidPanelUnit)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `# 由 nginx-mgr installer 生成
+[Unit]
+Description=nginx-mgr Nginx 管理面板
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+User=%s
+WorkingDirectory=%s
+`, opts.User, opts.WorkDir)
+	for _, env := range opts.Env {
+		if !unitEnvPattern.MatchString(env) || strings.ContainsAny(env, "\r\n") {
+			return "", fmt.Errorf("%w: 环境变量 %q 应为 KEY=VALUE", ErrInvalidPanelUnit, env)
+		}
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%").Replace(env)
+		fmt.Fprintf(&b, "Environment=\"%s\"\n", escaped)
+	}
+	fmt.Fprintf(&b, `ExecStart=%s
+Restart=%s
+RestartSec=5s
+LimitNOFILE=65535
+`, opts.Binary, opts.Restart)
+	if opts.User != "root" {
+		b.WriteString("AmbientCapabilities=CAP_NET_BIND_SERVICE\n")
+	}
+	b.WriteString(`
+[Install]
+WantedBy=multi-user.target
+`)
+	return b.String(), nil
+}
+
+// InstallPanelUnit 写入单元并启用、（重新）启动面板，返回 systemctl status 的输出。
+// 非 root 账号不存在时创建系统账号，并把工作目录（已由 RenderPanelUnit 排除系统目录）交给该账号
+func InstallPanelUnit(opts PanelUnitOptions, unitPath string) (string, error) {
+	unit, err := RenderPanelUnit(opts)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(opts.Binary); err != nil || info.IsDir() || info.Mode().Perm()&0111 == 0 {
+		return "", fmt.Errorf("%w: %s 不存在或不可执行", ErrInvalidPanelUnit, opts.Binary)
+	}
+	if err := os.MkdirAll(opts.WorkDir, 0750); err != nil {
+		return "", err
+	}
+	if opts.User != "root" {
+		if _, err := executor.ExecuteSimple("id", "-u", opts.User); err != nil {
+			if out, err := executor.ExecuteSimple("useradd", "--system", "--home-dir", opts.WorkDir, "--shell", "/usr/sbin/nologin", opts.User); err != nil {
+				return "", fmt.Errorf("创建账号 %s 失败: %s", opts.User, strings.TrimSpace(out))
+			}
+		}
+		if out, err := executor.ExecuteSimple("chown", "-R", opts.User+":", opts.WorkDir); err != nil {
+			return "", fmt.Errorf("修改工作目录所有者失败: %s", strings.TrimSpace(out))
+		}
+	}
+	if err := os.WriteFile(unitPath, []byte(unit), 0644); err != nil {
+		return "", fmt.Errorf("写入 systemd 单元失败: %w", err)
+	}
+	name := filepath.Base(unitPath)
+	// restart 而不是 start：重复执行时让修改后的单元立即生效
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", name}, {"restart", name}} {
+		if out, err := executor.ExecuteSimple("systemctl", args...); err != nil {
+			return "", fmt.Errorf("systemctl %s 失败: %s", strings.Join(args, " "), strings.TrimSpace(out))
+		}
+	}
+	status, _ := executor.ExecuteSimple("systemctl", "status", "--no-pager", "--lines=10", name)
+	if out, err := executor.ExecuteSimple("systemctl", "is-active", name); err != nil {
+		return status, fmt.Errorf("%s 未能启动: %s", name, strings.TrimSpace(out))
+	}
+	return status, nil
+}
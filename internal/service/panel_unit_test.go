@@ -0,0 +1,64 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRenderPanelUnit(t *testing.T) {
+	opts := PanelUnitOptions{
+		Binary:  "/opt/nginx-mgr/nginx-mgr",
+		WorkDir: "/opt/nginx-mgr",
+		User:    "root",
+		Env:     []string{"GIN_MODE=release", `NOTE=50% "quoted"`},
+		Restart: "on-failure",
+	}
+	unit, err := RenderPanelUnit(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"User=root\n",
+		"WorkingDirectory=/opt/nginx-mgr\n",
+		"Environment=\"GIN_MODE=release\"\n",
+		`Environment="NOTE=50%% \"quoted\""` + "\n",
+		"ExecStart=/opt/nginx-mgr/nginx-mgr\n",
+		"Restart=on-failure\n",
+		"WantedBy=multi-user.target\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Fatalf("unit missing %q:\n%s", want, unit)
+		}
+	}
+	if strings.Contains(unit, "AmbientCapabilities") {
+		t.Fatalf("root unit should not add capabilities:\n%s", unit)
+	}
+
+	opts.User = "nginx-mgr"
+	if unit, _ = RenderPanelUnit(opts); !strings.Contains(unit, "AmbientCapabilities=CAP_NET_BIND_SERVICE\n") {
+		t.Fatalf("non-root unit should be able to bind low ports:\n%s", unit)
+	}
+
+	for _, bad := range []PanelUnitOptions{
+		{Binary: "nginx-mgr", WorkDir: "/opt/nginx-mgr", User: "root", Restart: "always"},
+		{Binary: "/opt/nginx mgr/nginx-mgr", WorkDir: "/opt/nginx-mgr", User: "root", Restart: "always"},
+		{Binary: "/opt/nginx-mgr/nginx-mgr", WorkDir: "/opt/nginx-mgr", User: "Root;rm", Restart: "always"},
+		{Binary: "/opt/nginx-mgr/nginx-mgr", WorkDir: "/opt/nginx-mgr", User: "root", Restart: "no"},
+		{Binary: "/opt/nginx-mgr/nginx-mgr", WorkDir: "/opt/nginx-mgr", User: "root", Restart: "always", Env: []string{"NOVALUE"}},
+		{Binary: "/opt/nginx-mgr/nginx-mgr", WorkDir: "/opt/nginx-mgr", User: "root", Restart: "always", Env: []string{"A=1\nExecStartPre=/bin/sh"}},
+		{Binary: "/usr/local/bin/nginx-mgr", WorkDir: "/usr/local/bin", User: "nginx-mgr", Restart: "always"},
+		{Binary: "/opt/nginx-mgr/nginx-mgr", WorkDir: "/", User: "nginx-mgr", Restart: "always"},
+		{Binary: "/opt/nginx-mgr/nginx-mgr", WorkDir: "/root", User: "nginx-mgr", Restart: "always"},
+		{Binary: "/opt/nginx-mgr/nginx-mgr", WorkDir: "/opt/", User: "nginx-mgr", Restart: "always"},
+		{Binary: "/opt/nginx-mgr/nginx-mgr", WorkDir: "/bin", User: "nginx-mgr", Restart: "always"},
+	} {
+		if _, err := RenderPanelUnit(bad); !errors.Is(err, ErrInvalidPanelUnit) {
+			t.Fatalf("expected invalid options for %+v, got %v", bad, err)
+		}
+	}
+	// root 账号不修改目录所有者，系统目录仍可作为工作目录
+	if _, err := RenderPanelUnit(PanelUnitOptions{Binary: "/usr/local/bin/nginx-mgr", WorkDir: "/root", User: "root", Restart: "always"}); err != nil {
+		t.Fatalf("root may use /root as workdir: %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var ErrRcloneRemoteNotFound = errors.New("rclone remote 不存在")
+
+var (
+	rcloneRemoteNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+	rcloneTypePattern       = regexp.MustCompile(`^[a-z0-9]+$`)
+	rcloneOptionPattern     = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// rcloneSecretOptions 查询时隐藏的参数；其中 rcloneObscuredOptions 需先经 rclone obscure 混淆再写入
+var rcloneSecretOptions = map[string]bool{
+	"pass":              true,
+	"password":          true,
+	"password2":         true,
+	"key_file_pass":     true,
+	"token":             true,
+	"client_secret":     true,
+	"secret_access_key": true,
+	"key_pem":           true,
+}
+
+var rcloneObscuredOptions = map[string]bool{
+	"pass":          true,
+	"password":      true,
+	"password2":     true,
+	"key_file_pass": true,
+}
+
+// rcloneConfSection rclone.conf 中的一个配置段，options 保持文件中的顺序
+type rcloneConfSection struct {
+	name    string
+	options [][2]string
+}
+
+func (c *rcloneConfSection) get(key string) string {
+	for _, option := range c.options {
+		if option[0] == key {
+			return option[1]
+		}
+	}
+	return ""
+}
+
+// parseRcloneConf 解析 rclone.conf，忽略注释与空行
+func parseRcloneConf(data string) []rcloneConfSection {
+	var sections []rcloneConfSection
+	for _, line := range strings.Split(data, "\n") {
+		trim := strings.TrimSpace(line)
+		if trim == "" || strings.HasPrefix(trim, "#") || strings.HasPrefix(trim, ";") {
+			continue
+		}
+		if strings.HasPrefix(trim, "[") && strings.HasSuffix(trim, "]") {
+			sections = append(sections, rcloneConfSection{name: strings.TrimSpace(trim[1 : len(trim)-1])})
+			continue
+		}
+		parts := strings.SplitN(trim, "=", 2)
+		if len(parts) != 2 || len(sections) == 0 {
+			continue
+		}
+		current := &sections[len(sections)-1]
+		current.options = append(current.options, [2]string{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])})
+	}
+	return sections
+}
+
+func renderRcloneConf(sections []rcloneConfSection) string {
+	var b strings.Builder
+	for i, section := range sections {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[%s]\n", section.name)
+		for _, option := range section.options {
+			fmt.Fprintf(&b, "%s = %s\n", option[0], option[1])
+		}
+	}
+	return b.String()
+}
+
+func (s *BackupService) loadRcloneSections() ([]rcloneConfSection, error) {
+	data, err := os.ReadFile(s.rcloneConfigPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseRcloneConf(string(data)), nil
+}
+
+func (s *BackupService) saveRcloneSections(sections []rcloneConfSection) error {
+	if err := os.MkdirAll(filepath.Dir(s.rcloneConfigPath), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.rcloneConfigPath, []byte(renderRcloneConf(sections)), 0600)
+}
+
+// upsertRcloneSection 替换或追加一个配置段，保留 rclone.conf 中的其他 remote
+func (s *BackupService) upsertRcloneSection(section rcloneConfSection) error {
+	sections, err := s.loadRcloneSections()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i := range sections {
+		if sections[i].name == section.name {
+			sections[i] = section
+			replaced = true
+		}
+	}
+	if !replaced {
+		sections = append(sections, section)
+	}
+	return s.saveRcloneSections(sections)
+}
+
+func (s *BackupService) findRcloneSection(name string) (rcloneConfSection, error) {
+	sections, err := s.loadRcloneSections()
+	if err != nil {
+		return rcloneConfSection{}, err
+	}
+	for _, section := range sections {
+		if section.name == name {
+			return section, nil
+		}
+	}
+	return rcloneConfSection{}, fmt.Errorf("%w: %s", ErrRcloneRemoteNotFound, name)
+}
+
+func remoteFromSection(section rcloneConfSection, managed bool) model.RcloneRemote {
+	remote := model.RcloneRemote{Name: section.name, Options: map[string]string{}, Managed: managed}
+	for _, option := range section.options {
+		switch {
+		case option[0] == "type":
+			remote.Type = option[1]
+		case rcloneSecretOptions[option[0]]:
+			remote.Secrets = append(remote.Secrets, option[0])
+		default:
+			remote.Options[option[0]] = option[1]
+		}
+	}
+	return remote
+}
+
+// ListRemotes 列出 rclone.conf 中的全部 remote，按名称排序
+func (s *BackupService) ListRemotes() ([]model.RcloneRemote, error) {
+	sections, err := s.loadRcloneSections()
+	if err != nil {
+		return nil, err
+	}
+	remotes := make([]model.RcloneRemote, 0, len(sections))
+	for _, section := range sections {
+		remotes = append(remotes, remoteFromSection(section, section.name == s.rcloneRemote))
+	}
+	sort.Slice(remotes, func(i, j int) bool { return remotes[i].Name < remotes[j].Name })
+	return remotes, nil
+}
+
+// SaveRemote 创建或更新一个 remote。敏感参数留空时沿用已保存的值，密码类参数写入前先混淆
+func (s *BackupService) SaveRemote(input model.RcloneRemote) (model.RcloneRemote, error) {
+	name := strings.TrimSpace(input.Name)
+	if !rcloneRemoteNamePattern.MatchString(name) {
+		return model.RcloneRemote{}, fmt.Errorf("%w: remote 名称只能包含字母、数字、点、下划线与短横线", ErrInvalidBackupSettings)
+	}
+	if name == s.rcloneRemote {
+		return model.RcloneRemote{}, fmt.Errorf("%w: %s 由备份存储设置管理，请在存储配置中修改", ErrInvalidBackupSettings, name)
+	}
+	remoteType := strings.ToLower(strings.TrimSpace(input.Type))
+	if !rcloneTypePattern.MatchString(remoteType) {
+		return model.RcloneRemote{}, fmt.Errorf("%w: remote 类型无效", ErrInvalidBackupSettings)
+	}
+
+	existing, err := s.findRcloneSection(name)
+	if err != nil && !errors.Is(err, ErrRcloneRemoteNotFound) {
+		return model.RcloneRemote{}, err
+	}
+
+	keys := make([]string, 0, len(input.Options))
+	for key := range input.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	section := rcloneConfSection{name: name, options: [][2]string{{"type", remoteType}}}
+	provided := make(map[string]bool)
+	for _, key := range keys {
+		value := strings.TrimSpace(input.Options[key])
+		if !rcloneOptionPattern.MatchString(key) || key == "type" {
+			return model.RcloneRemote{}, fmt.Errorf("%w: 参数名无效 %s", ErrInvalidBackupSettings, key)
+		}
+		// 写入 rclone.conf 的值不能包含换行，否则可注入任意配置项
+		if strings.ContainsAny(value, "\r\n") {
+			return model.RcloneRemote{}, fmt.Errorf("%w: 参数不能包含换行", ErrInvalidBackupSettings)
+		}
+		if value == "" {
+			continue
+		}
+		if rcloneObscuredOptions[key] {
+			if value, err = rcloneObscure(value); err != nil {
+				return model.RcloneRemote{}, err
+			}
+		}
+		provided[key] = true
+		section.options = append(section.options, [2]string{key, value})
+	}
+	// 仍是同一类型时沿用未重新填写的敏感参数
+	if existing.get("type") == remoteType {
+		for _, option := range existing.options {
+			if rcloneSecretOptions[option[0]] && !provided[option[0]] {
+				section.options = append(section.options, option)
+			}
+		}
+	}
+	if err := s.upsertRcloneSection(section); err != nil {
+		return model.RcloneRemote{}, err
+	}
+	return remoteFromSection(section, false), nil
+}
+
+// DeleteRemote 删除 remote，备份存储设置生成的与当前备份正在使用的 remote 不能删除
+func (s *BackupService) DeleteRemote(name string) error {
+	if name == s.rcloneRemote {
+		return fmt.Errorf("%w: %s 由备份存储设置管理", ErrInvalidBackupSettings, name)
+	}
+	if settings, err := s.loadBackupSettings(); err == nil && settings.Type == model.BackupTargetRclone && settings.Remote == name {
+		return fmt.Errorf("%w: 备份正在使用 %s，请先更换存储", ErrInvalidBackupSettings, name)
+	}
+	sections, err := s.loadRcloneSections()
+	if err != nil {
+		return err
+	}
+	kept := sections[:0]
+	found := false
+	for _, section := range sections {
+		if section.name == name {
+			found = true
+			continue
+		}
+		kept = append(kept, section)
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrRcloneRemoteNotFound, name)
+	}
+	return s.saveRcloneSections(kept)
+}
+
+// TestRemote 检查指定 remote 能否列出根目录
+func (s *BackupService) TestRemote(name string) error {
+	if _, err := s.findRcloneSection(name); err != nil {
+		return err
+	}
+	return testRcloneRemote(name)
+}
+
+func testRcloneRemote(name string) error {
+	if _, err := executor.ExecuteSimple("timeout", "10", "rclone", "lsjson", name+":"); err != nil {
+		return fmt.Errorf("rclone 连接测试失败: %w", err)
+	}
+	return nil
+}
+
+// activeRemote 返回备份实际使用的 remote 名称
+func (s *BackupService) activeRemote() string {
+	settings, err := s.loadBackupSettings()
+	if err == nil && settings.Type == model.BackupTargetRclone && settings.Remote != "" {
+		return settings.Remote
+	}
+	return s.rcloneRemote
+}
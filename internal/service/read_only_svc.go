@@ -0,0 +1,90 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	readOnlySettingsPath = "/root/read_only.json"
+	readOnlyEnv          = "NGINX_MGR_READ_ONLY"
+)
+
+var ErrReadOnlyForced = errors.New("只读模式由环境变量 " + readOnlyEnv + " 开启，需修改环境变量并重启面板后才能关闭")
+
+// ReadOnlyService 维护面板级只读锁，可通过接口切换，也可由环境变量强制开启。
+// 迁移期间或临时交给审计人员查看时使用。
+type ReadOnlyService struct {
+	path   string
+	forced bool
+	mu     sync.Mutex
+}
+
+func NewReadOnlyService() *ReadOnlyService {
+	forced, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv(readOnlyEnv)))
+	return &ReadOnlyService{
+		path:   readOnlySettingsPath,
+		forced: forced,
+	}
+}
+
+func (s *ReadOnlyService) Get() (model.ReadOnlySettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getLocked()
+}
+
+func (s *ReadOnlyService) getLocked() (model.ReadOnlySettings, error) {
+	var settings model.ReadOnlySettings
+	content, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return model.ReadOnlySettings{}, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(content, &settings); err != nil {
+			return model.ReadOnlySettings{}, fmt.Errorf("解析 %s 失败: %w", s.path, err)
+		}
+	}
+	if s.forced {
+		settings.Enabled = true
+		settings.ForcedByEnv = true
+	}
+	return settings, nil
+}
+
+// Save 切换只读锁，by 记录操作者
+func (s *ReadOnlyService) Save(enabled bool, reason, by string) (model.ReadOnlySettings, error) {
+	if s.forced && !enabled {
+		return model.ReadOnlySettings{}, ErrReadOnlyForced
+	}
+	settings := model.ReadOnlySettings{
+		Enabled:             enabled,
+		LastUpdatedUnixTime: time.Now().Unix(),
+	}
+	if enabled {
+		settings.Reason = strings.TrimSpace(reason)
+		settings.EnabledBy = by
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.ReadOnlySettings{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return model.ReadOnlySettings{}, err
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return model.ReadOnlySettings{}, err
+	}
+	return s.getLocked()
+}
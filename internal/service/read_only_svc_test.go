@@ -0,0 +1,34 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadOnlyService(t *testing.T) {
+	t.Setenv(readOnlyEnv, "")
+	svc := NewReadOnlyService()
+	svc.path = filepath.Join(t.TempDir(), "read_only.json")
+
+	if settings, err := svc.Get(); err != nil || settings.Enabled {
+		t.Fatalf("read-only should be off by default: %+v, %v", settings, err)
+	}
+	settings, err := svc.Save(true, " 迁移中 ", "alice")
+	if err != nil || !settings.Enabled || settings.Reason != "迁移中" || settings.EnabledBy != "alice" {
+		t.Fatalf("enable: %+v, %v", settings, err)
+	}
+	if settings, err = svc.Save(false, "", "alice"); err != nil || settings.Enabled || settings.Reason != "" {
+		t.Fatalf("disable: %+v, %v", settings, err)
+	}
+
+	t.Setenv(readOnlyEnv, "true")
+	forced := NewReadOnlyService()
+	forced.path = svc.path
+	if settings, err := forced.Get(); err != nil || !settings.Enabled || !settings.ForcedByEnv {
+		t.Fatalf("env should force read-only: %+v, %v", settings, err)
+	}
+	if _, err := forced.Save(false, "", "alice"); !errors.Is(err, ErrReadOnlyForced) {
+		t.Fatalf("expected forced error, got %v", err)
+	}
+}
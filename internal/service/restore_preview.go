@@ -0,0 +1,251 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RestorePreview 恢复前的差异预览，路径均为恢复后的系统路径。
+// 完整恢复按合并方式复制，仅存在于当前系统的文件列在 Kept 中，不会被删除
+type RestorePreview struct {
+	Archive   string   `json:"archive"`
+	Scope     string   `json:"scope"`
+	Domain    string   `json:"domain,omitempty"`
+	Added     []string `json:"added"`
+	Changed   []string `json:"changed"`
+	Removed   []string `json:"removed"`
+	Kept      []string `json:"kept,omitempty"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// fullRestoreTargets 完整恢复时复制的目录，兼容直接打包 nginx 目录与只含配置文件的旧备份
+func fullRestoreTargets(root, confDir, webRoot string) []restoreTarget {
+	etcDir := filepath.Join(root, "etc", "nginx")
+	varDir := filepath.Join(root, strings.TrimPrefix(webRoot, "/"))
+	altNginxDir := filepath.Join(root, "nginx")
+
+	var targets []restoreTarget
+	if dirExists(etcDir) {
+		targets = append(targets, restoreTarget{src: etcDir, dest: confDir})
+	}
+	if dirExists(varDir) {
+		targets = append(targets, restoreTarget{src: varDir, dest: webRoot})
+	}
+	if dirExists(altNginxDir) && !dirExists(etcDir) {
+		targets = append(targets, restoreTarget{src: altNginxDir, dest: confDir})
+	}
+	if len(targets) == 0 {
+		targets = append(targets, restoreTarget{src: root, dest: confDir})
+	}
+	return targets
+}
+
+// previewRestore 解压备份并与当前文件比对，不修改系统中的任何文件
+func previewRestore(archivePath string, scope RestoreScope, confDir, webRoot string) (RestorePreview, error) {
+	scope, err := scope.normalize()
+	if err != nil {
+		return RestorePreview{}, err
+	}
+	preview := RestorePreview{Archive: filepath.Base(archivePath), Scope: scope.Scope, Domain: scope.Domain}
+
+	tmpDir, err := os.MkdirTemp("", "nginx_restore_preview")
+	if err != nil {
+		return preview, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if _, err := executor.ExecuteSimple("tar", "-xzf", archivePath, "-C", tmpDir, "--exclude="+backupManifestName); err != nil {
+		return preview, fmt.Errorf("%w: 解压备份失败: %v", ErrInvalidBackupArchive, err)
+	}
+
+	var targets []restoreTarget
+	merge := scope.Scope == RestoreScopeFull
+	if merge {
+		targets = fullRestoreTargets(tmpDir, confDir, webRoot)
+	} else if targets, err = restoreScopeTargets(scope, tmpDir, confDir, webRoot); err != nil {
+		return preview, err
+	}
+	for _, target := range targets {
+		if err := diffRestoreTarget(target, merge, &preview); err != nil {
+			return preview, err
+		}
+	}
+	for _, list := range [][]string{preview.Added, preview.Changed, preview.Removed, preview.Kept} {
+		sort.Strings(list)
+	}
+	return preview, nil
+}
+
+// diffRestoreTarget 比对单个恢复目标。merge 为 false 时目标会被整体替换，多出的文件计为删除
+func diffRestoreTarget(target restoreTarget, merge bool, preview *RestorePreview) error {
+	incoming, err := collectRestoreFiles(target.src)
+	if err != nil {
+		return fmt.Errorf("读取备份内容失败: %w", err)
+	}
+	current, err := collectRestoreFiles(target.dest)
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败: %w", target.dest, err)
+	}
+	for rel, src := range incoming {
+		path := filepath.Join(target.dest, rel)
+		dest, ok := current[rel]
+		if !ok {
+			preview.Added = append(preview.Added, path)
+			continue
+		}
+		same, err := sameRestoreFile(src, dest)
+		if err != nil {
+			return err
+		}
+		if same {
+			preview.Unchanged++
+		} else {
+			preview.Changed = append(preview.Changed, path)
+		}
+	}
+	for rel := range current {
+		if _, ok := incoming[rel]; ok {
+			continue
+		}
+		path := filepath.Join(target.dest, rel)
+		if merge {
+			preview.Kept = append(preview.Kept, path)
+		} else {
+			preview.Removed = append(preview.Removed, path)
+		}
+	}
+	return nil
+}
+
+// collectRestoreFiles 列出 root 下除目录外的全部条目，root 本身是文件或软链接时以空路径表示
+func collectRestoreFiles(root string) (map[string]string, error) {
+	files := make(map[string]string)
+	if root == "" {
+		return files, nil
+	}
+	info, err := os.Lstat(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return files, nil
+		}
+		return nil, err
+	}
+	if !info.IsDir() {
+		files[""] = root
+		return files, nil
+	}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[rel] = path
+		return nil
+	})
+	return files, err
+}
+
+// sameRestoreFile 软链接比较指向，普通文件先比较大小再比较 SHA-256
+func sameRestoreFile(a, b string) (bool, error) {
+	aInfo, err := os.Lstat(a)
+	if err != nil {
+		return false, err
+	}
+	bInfo, err := os.Lstat(b)
+	if err != nil {
+		return false, err
+	}
+	if aInfo.Mode().Type() != bInfo.Mode().Type() {
+		return false, nil
+	}
+	switch {
+	case aInfo.Mode()&os.ModeSymlink != 0:
+		aLink, err := os.Readlink(a)
+		if err != nil {
+			return false, err
+		}
+		bLink, err := os.Readlink(b)
+		if err != nil {
+			return false, err
+		}
+		return aLink == bLink, nil
+	case aInfo.Mode().IsRegular():
+		if aInfo.Size() != bInfo.Size() {
+			return false, nil
+		}
+		aSum, err := fileSHA256(a)
+		if err != nil {
+			return false, err
+		}
+		bSum, err := fileSHA256(b)
+		if err != nil {
+			return false, err
+		}
+		return aSum == bSum, nil
+	}
+	return true, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// PreviewRestore 预览本地备份恢复后的变化，path 为目录时使用其中最新的备份
+func (s *SystemService) PreviewRestore(path string, scope RestoreScope) (RestorePreview, error) {
+	cleanPath, err := resolveLocalBackup(path)
+	if err != nil {
+		return RestorePreview{}, err
+	}
+	return previewRestore(cleanPath, scope, model.NginxConfDir, defaultWebRoot)
+}
+
+// resolveLocalBackup 检查本地备份路径，目录时返回其中最新的备份
+func resolveLocalBackup(path string) (string, error) {
+	cleanPath := filepath.Clean(strings.TrimSpace(path))
+	if dirExists(cleanPath) {
+		return selectLatestBackup(cleanPath)
+	}
+	if _, err := os.Stat(cleanPath); err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%w: %s", ErrBackupArchiveNotFound, cleanPath)
+		}
+		return "", err
+	}
+	return cleanPath, nil
+}
+
+// PreviewRestore 下载远程备份并预览恢复后的变化，archive 为空时使用最新的备份
+func (s *BackupService) PreviewRestore(remote, archive string, scope RestoreScope) (RestorePreview, error) {
+	tempDir, err := os.MkdirTemp("", "backup_preview")
+	if err != nil {
+		return RestorePreview{}, err
+	}
+	defer os.RemoveAll(tempDir)
+	localFile, err := s.downloadArchive(remote, archive, tempDir)
+	if err != nil {
+		return RestorePreview{}, err
+	}
+	return previewRestore(localFile, scope, model.NginxConfDir, defaultWebRoot)
+}
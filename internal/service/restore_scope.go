@@ -0,0 +1,187 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	RestoreScopeFull    = "full"
+	RestoreScopeSites   = "sites"
+	RestoreScopeStreams = "streams"
+	RestoreScopeDomain  = "domain"
+)
+
+var ErrInvalidRestoreScope = errors.New("恢复范围无效")
+
+// RestoreScope 恢复范围。full 覆盖整个配置；sites、streams 只替换对应目录；
+// domain 只恢复单个站点的配置、启用状态和网站目录
+type RestoreScope struct {
+	Scope  string `json:"scope"`
+	Domain string `json:"domain"`
+}
+
+func (r RestoreScope) normalize() (RestoreScope, error) {
+	r.Scope = strings.ToLower(strings.TrimSpace(r.Scope))
+	r.Domain = strings.TrimSpace(r.Domain)
+	switch r.Scope {
+	case "", RestoreScopeFull:
+		return RestoreScope{Scope: RestoreScopeFull}, nil
+	case RestoreScopeSites, RestoreScopeStreams:
+		return RestoreScope{Scope: r.Scope}, nil
+	case RestoreScopeDomain:
+		if r.Domain == "" || r.Domain == "." || r.Domain == ".." || strings.ContainsAny(r.Domain, "/\\ \t\r\n") {
+			return RestoreScope{}, fmt.Errorf("%w: 域名无效", ErrInvalidRestoreScope)
+		}
+		return r, nil
+	default:
+		return RestoreScope{}, fmt.Errorf("%w: 不支持的范围 %s", ErrInvalidRestoreScope, r.Scope)
+	}
+}
+
+// restoreTarget 按范围替换的路径，src 为空表示备份中不存在，恢复时删除 dest
+type restoreTarget struct {
+	src  string
+	dest string
+}
+
+// archiveNginxDir 返回解压目录中的 Nginx 配置目录，兼容直接打包 nginx 目录的旧备份
+func archiveNginxDir(root string) string {
+	for _, dir := range []string{filepath.Join(root, "etc", "nginx"), filepath.Join(root, "nginx")} {
+		if dirExists(dir) {
+			return dir
+		}
+	}
+	return root
+}
+
+// restoreScopeTargets 根据范围列出需要替换的路径，备份中缺少该范围的内容时返回错误
+func restoreScopeTargets(scope RestoreScope, root, confDir, webRoot string) ([]restoreTarget, error) {
+	nginxDir := archiveNginxDir(root)
+	pick := func(rel, dest string) restoreTarget {
+		src := filepath.Join(nginxDir, rel)
+		if _, err := os.Lstat(src); err != nil {
+			src = ""
+		}
+		return restoreTarget{src: src, dest: dest}
+	}
+	var targets []restoreTarget
+	switch scope.Scope {
+	case RestoreScopeSites, RestoreScopeStreams:
+		prefix := scope.Scope
+		targets = []restoreTarget{
+			pick(prefix+"-available", filepath.Join(confDir, prefix+"-available")),
+			pick(prefix+"-enabled", filepath.Join(confDir, prefix+"-enabled")),
+		}
+	case RestoreScopeDomain:
+		targets = []restoreTarget{
+			pick(filepath.Join("sites-available", scope.Domain), filepath.Join(confDir, "sites-available", scope.Domain)),
+			pick(filepath.Join("sites-enabled", scope.Domain), filepath.Join(confDir, "sites-enabled", scope.Domain)),
+		}
+		// 网站目录只在备份中存在时替换，未打包网站文件的备份不影响现有内容
+		webSrc := filepath.Join(root, strings.TrimPrefix(webRoot, "/"), scope.Domain)
+		if dirExists(webSrc) {
+			targets = append(targets, restoreTarget{src: webSrc, dest: filepath.Join(webRoot, scope.Domain)})
+		}
+	default:
+		return nil, fmt.Errorf("%w: 不支持的范围 %s", ErrInvalidRestoreScope, scope.Scope)
+	}
+	if targets[0].src == "" {
+		if scope.Scope == RestoreScopeDomain {
+			return nil, fmt.Errorf("%w: 备份中未找到站点 %s", ErrInvalidRestoreScope, scope.Domain)
+		}
+		return nil, fmt.Errorf("%w: 备份中未找到 %s-available", ErrInvalidRestoreScope, scope.Scope)
+	}
+	return targets, nil
+}
+
+// applyRestoreTargets 先删除现有路径再复制备份内容，保留软链接与权限
+func applyRestoreTargets(targets []restoreTarget) error {
+	for _, target := range targets {
+		if err := os.RemoveAll(target.dest); err != nil {
+			return fmt.Errorf("删除 %s 失败: %w", target.dest, err)
+		}
+		if target.src == "" {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target.dest), 0755); err != nil {
+			return fmt.Errorf("创建目录失败 %s: %w", filepath.Dir(target.dest), err)
+		}
+		if _, err := executor.ExecuteSimple("cp", "-a", target.src, target.dest); err != nil {
+			return fmt.Errorf("复制 %s 至 %s 失败: %w", target.src, target.dest, err)
+		}
+	}
+	return nil
+}
+
+// rollbackRestoreTargets 删除已替换的路径并从快照还原，快照为空表示恢复前这些路径都不存在
+func rollbackRestoreTargets(targets []restoreTarget, snapshot string) error {
+	for _, target := range targets {
+		if err := os.RemoveAll(target.dest); err != nil {
+			return err
+		}
+	}
+	if snapshot == "" {
+		return nil
+	}
+	_, err := executor.ExecuteSimple("tar", "-xzf", snapshot, "-C", "/", "--exclude="+backupManifestName)
+	return err
+}
+
+// restoreScoped 只替换范围内的文件，nginx -t 通过后平滑重载，失败时仅回滚该范围，不停止 Nginx
+func (s *SystemService) restoreScoped(backupPath string, scope RestoreScope) error {
+	tmpDir, err := os.MkdirTemp("", "nginx_restore")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if _, err := executor.ExecuteSimple("tar", "-xzf", backupPath, "-C", tmpDir); err != nil {
+		return fmt.Errorf("解压备份失败: %w", err)
+	}
+
+	targets, err := restoreScopeTargets(scope, tmpDir, model.NginxConfDir, defaultWebRoot)
+	if err != nil {
+		return err
+	}
+
+	var current []string
+	for _, target := range targets {
+		if _, err := os.Lstat(target.dest); err == nil {
+			current = append(current, target.dest)
+		}
+	}
+	snapshot := ""
+	if len(current) > 0 {
+		snapshot = fmt.Sprintf("/tmp/nginx_pre_restore_%s_%d.tar.gz", scope.Scope, time.Now().Unix())
+		if err := createBackupArchive(snapshot, current, nil); err != nil {
+			return fmt.Errorf("当前配置备份失败: %w", err)
+		}
+		defer os.Remove(snapshot)
+	}
+
+	rollback := func(stage string, cause error) error {
+		if rollbackErr := rollbackRestoreTargets(targets, snapshot); rollbackErr != nil {
+			return fmt.Errorf("%s: %v；尝试恢复原配置时出错: %v", stage, cause, rollbackErr)
+		}
+		return fmt.Errorf("%s: %w", stage, cause)
+	}
+
+	if err := applyRestoreTargets(targets); err != nil {
+		return rollback("恢复失败", err)
+	}
+	if _, err := executor.ExecuteSimple(model.NginxSbinPath, "-t"); err != nil {
+		return rollback("配置验证失败", err)
+	}
+	if _, err := executor.ExecuteSimple("systemctl", "reload", "nginx"); err != nil {
+		err = rollback("重载 Nginx 失败", err)
+		_, _ = executor.ExecuteSimple("systemctl", "reload", "nginx")
+		return err
+	}
+	return nil
+}
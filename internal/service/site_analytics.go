@@ -0,0 +1,174 @@
+package service
+
+import (
+	"fmt"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 访问分析的维度，对应 siteStatsHour.Top 的键
+const (
+	analyticsIP     = "ip"
+	analyticsURI    = "uri"
+	analyticsStatus = "status"
+	analyticsAgent  = "agent"
+	// 以下两项只在有 GeoIP 数据库时记录
+	analyticsCountry = "country"
+	analyticsRegion  = "region"
+)
+
+const (
+	// siteAnalyticsKeep 已结束的小时在每个维度上保留的取值数量
+	siteAnalyticsKeep         = 100
+	siteAnalyticsDefaultLimit = 10
+	siteAnalyticsMaxLimit     = siteAnalyticsKeep
+	siteAnalyticsMaxURI       = 256
+	siteAnalyticsMaxAgent     = 256
+)
+
+// count 按维度累计一条请求
+func (h *siteStatsHour) count(ip, request, status, agent string) {
+	uri := "-"
+	if fields := strings.Fields(request); len(fields) >= 2 {
+		uri, _, _ = strings.Cut(fields[1], "?")
+	}
+	if agent == "" {
+		agent = "-"
+	}
+	for dimension, value := range map[string]string{
+		analyticsIP:     ip,
+		analyticsURI:    truncateRunes(uri, siteAnalyticsMaxURI),
+		analyticsStatus: status,
+		analyticsAgent:  truncateRunes(agent, siteAnalyticsMaxAgent),
+	} {
+		h.add(dimension, value)
+	}
+}
+
+// countGeo 按国家与地区累计一条请求，查不到归属的地址记为 "-"
+func (h *siteStatsHour) countGeo(country, region string) {
+	if country == "" {
+		country = "-"
+	}
+	h.add(analyticsCountry, country)
+	if region != "" {
+		h.add(analyticsRegion, region)
+	}
+}
+
+func (h *siteStatsHour) add(dimension, value string) {
+	if h.Top == nil {
+		h.Top = make(map[string]map[string]int64)
+	}
+	values := h.Top[dimension]
+	if values == nil {
+		values = make(map[string]int64)
+		h.Top[dimension] = values
+	}
+	values[value]++
+}
+
+// trimTop 只保留每个维度请求数最多的取值，控制已结束小时的存储大小
+func (h *siteStatsHour) trimTop() {
+	for dimension, values := range h.Top {
+		if len(values) <= siteAnalyticsKeep {
+			continue
+		}
+		kept := make(map[string]int64, siteAnalyticsKeep)
+		for _, entry := range topAnalyticsEntries(values, siteAnalyticsKeep) {
+			kept[entry.Value] = entry.Count
+		}
+		h.Top[dimension] = kept
+	}
+}
+
+func topAnalyticsEntries(values map[string]int64, limit int) []model.SiteAnalyticsEntry {
+	entries := make([]model.SiteAnalyticsEntry, 0, len(values))
+	for value, count := range values {
+		entries = append(entries, model.SiteAnalyticsEntry{Value: value, Count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Value < entries[j].Value
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+// Analytics 汇总站点在 [from, to) 内按 IP、URI、状态码与 UA 的请求排行，并附带最近各窗口的延迟分位数。
+// 数据来自按小时汇总的访问日志，最多可查询最近 7 天；未指定范围时取最近 24 小时
+func (s *SiteStatsService) Analytics(domain string, from, to, now time.Time, limit int) (*model.SiteAnalytics, error) {
+	if domain == "" || filepath.Base(domain) != domain || strings.HasPrefix(domain, ".") {
+		return nil, os.ErrNotExist
+	}
+	if limit <= 0 {
+		limit = siteAnalyticsDefaultLimit
+	}
+	if limit > siteAnalyticsMaxLimit {
+		return nil, fmt.Errorf("%w: limit 不能超过 %d", ErrInvalidStatsRange, siteAnalyticsMaxLimit)
+	}
+	if to.IsZero() {
+		to = now
+	}
+	if from.IsZero() {
+		from = to.Add(-24 * time.Hour)
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: 开始时间需早于结束时间", ErrInvalidStatsRange)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.loadState(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]map[string]int64)
+	analytics := &model.SiteAnalytics{
+		Domain:       domain,
+		FromUnixTime: from.Truncate(time.Hour).Unix(),
+		ToUnixTime:   to.Unix(),
+		IPs:          []model.SiteAnalyticsEntry{},
+		URIs:         []model.SiteAnalyticsEntry{},
+		StatusCodes:  []model.SiteAnalyticsEntry{},
+		UserAgents:   []model.SiteAnalyticsEntry{},
+		Approximate:  []string{},
+		GeoIP:        s.geo.Available(),
+	}
+	for _, hour := range state.Hours {
+		if hour.Start < analytics.FromUnixTime || hour.Start >= analytics.ToUnixTime {
+			continue
+		}
+		analytics.Requests += hour.Requests
+		for dimension, values := range hour.Top {
+			if merged[dimension] == nil {
+				merged[dimension] = make(map[string]int64)
+			}
+			for value, count := range values {
+				merged[dimension][value] += count
+			}
+			if len(values) >= siteAnalyticsKeep && !slices.Contains(analytics.Approximate, dimension) {
+				analytics.Approximate = append(analytics.Approximate, dimension)
+			}
+		}
+	}
+	analytics.IPs = topAnalyticsEntries(merged[analyticsIP], limit)
+	analytics.URIs = topAnalyticsEntries(merged[analyticsURI], limit)
+	analytics.StatusCodes = topAnalyticsEntries(merged[analyticsStatus], limit)
+	analytics.UserAgents = topAnalyticsEntries(merged[analyticsAgent], limit)
+	analytics.Countries = topAnalyticsEntries(merged[analyticsCountry], limit)
+	analytics.Regions = topAnalyticsEntries(merged[analyticsRegion], limit)
+	sort.Strings(analytics.Approximate)
+	analytics.Latency = state.siteLatencyWindows(now)
+	return analytics, nil
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const siteDefaultsPath = "/root/site_defaults.json"
+
+var ErrInvalidSiteOption = errors.New("站点参数无效")
+
+var (
+	headerNamePattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	logFormatPattern  = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	sizePattern       = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+	durationPattern   = regexp.MustCompile(`^[0-9]+(ms|s|m|h|d)?$`)
+)
+
+var tlsPolicies = map[string]bool{
+	"modern":       true,
+	"intermediate": true,
+	"compat":       true,
+}
+
+var compressionModes = map[string]bool{
+	"both":   true,
+	"gzip":   true,
+	"brotli": true,
+	"off":    true,
+}
+
+type SiteDefaultsService struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewSiteDefaultsService() *SiteDefaultsService {
+	return &SiteDefaultsService{
+		path: siteDefaultsPath,
+	}
+}
+
+func (s *SiteDefaultsService) defaultSettings() model.SiteDefaults {
+	return model.SiteDefaults{
+		ProxyHeaders: map[string]string{},
+		TLSPolicy:    "",
+		Compression:  "", // 未设置时按站点类型决定，见 Apply
+		LogFormat:    "main",
+	}
+}
+
+func (s *SiteDefaultsService) sanitize(input model.SiteDefaults) (model.SiteDefaults, error) {
+	output := s.defaultSettings()
+
+	headers, err := sanitizeProxyHeaders(input.ProxyHeaders)
+	if err != nil {
+		return model.SiteDefaults{}, err
+	}
+	output.ProxyHeaders = headers
+
+	policy := strings.ToLower(strings.TrimSpace(input.TLSPolicy))
+	if policy != "" && !tlsPolicies[policy] {
+		return model.SiteDefaults{}, fmt.Errorf("%w: 不支持的 TLS 策略 %s", ErrInvalidSiteOption, policy)
+	}
+	output.TLSPolicy = policy
+
+	compression := strings.ToLower(strings.TrimSpace(input.Compression))
+	if compression != "" {
+		if !compressionModes[compression] {
+			return model.SiteDefaults{}, fmt.Errorf("%w: 不支持的压缩方式 %s", ErrInvalidSiteOption, compression)
+		}
+		output.Compression = compression
+	}
+
+	format := strings.TrimSpace(input.LogFormat)
+	if format != "" {
+		if !logFormatPattern.MatchString(format) {
+			return model.SiteDefaults{}, fmt.Errorf("%w: 日志格式名称不合法 %s", ErrInvalidSiteOption, format)
+		}
+		output.LogFormat = format
+	}
+
+	return output, nil
+}
+
+func (s *SiteDefaultsService) Get() (model.SiteDefaults, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s.defaultSettings(), nil
+		}
+		return model.SiteDefaults{}, err
+	}
+
+	var settings model.SiteDefaults
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return model.SiteDefaults{}, err
+	}
+
+	normalized, err := s.sanitize(settings)
+	if err != nil {
+		return s.defaultSettings(), nil
+	}
+	normalized.LastUpdatedUnixTime = settings.LastUpdatedUnixTime
+
+	return normalized, nil
+}
+
+func (s *SiteDefaultsService) Save(input model.SiteDefaults) (model.SiteDefaults, error) {
+	settings, err := s.sanitize(input)
+	if err != nil {
+		return model.SiteDefaults{}, err
+	}
+	settings.LastUpdatedUnixTime = time.Now().Unix()
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.SiteDefaults{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return model.SiteDefaults{}, err
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return model.SiteDefaults{}, err
+	}
+
+	return settings, nil
+}
+
+// Apply 使用面板默认值补全站点配置中未显式指定的字段
+func (s *SiteDefaultsService) Apply(config model.SiteConfig) (model.SiteConfig, error) {
+	defaults, err := s.Get()
+	if err != nil {
+		return config, err
+	}
+
+	// 站点中同名（不区分大小写）的请求头覆盖默认值，值为空表示不使用该默认请求头
+	headers := make(map[string]string, len(defaults.ProxyHeaders)+len(config.ProxyHeaders))
+	for name, value := range defaults.ProxyHeaders {
+		if _, ok := lookupHeader(config.ProxyHeaders, name); !ok {
+			headers[name] = value
+		}
+	}
+	for name, value := range config.ProxyHeaders {
+		if strings.TrimSpace(value) != "" {
+			headers[name] = value
+		}
+	}
+	config.ProxyHeaders = headers
+
+	if strings.TrimSpace(config.TLSPolicy) == "" {
+		config.TLSPolicy = defaults.TLSPolicy
+	}
+	if strings.TrimSpace(config.Compression) == "" {
+		config.Compression = defaults.Compression
+	}
+	if strings.TrimSpace(config.Compression) == "" {
+		// 未设置面板默认值时保持原有行为：反向代理与负载均衡启用压缩，其他类型需显式开启
+		config.Compression = "off"
+		if config.Type == "proxy" || config.Type == "lb" {
+			config.Compression = "both"
+		}
+	}
+	if strings.TrimSpace(config.LogFormat) == "" {
+		config.LogFormat = defaults.LogFormat
+	}
+	return config, nil
+}
+
+// lookupHeader 按不区分大小写的名称查找请求头
+func lookupHeader(headers map[string]string, name string) (string, bool) {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func sanitizeProxyHeaders(input map[string]string) (map[string]string, error) {
+	output := make(map[string]string, len(input))
+	for name, value := range input {
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+		if name == "" {
+			continue
+		}
+		if !headerNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("%w: 请求头名称不合法 %s", ErrInvalidSiteOption, name)
+		}
+		if value == "" || strings.ContainsAny(value, ";{}\r\n") {
+			return nil, fmt.Errorf("%w: 请求头 %s 的值不合法", ErrInvalidSiteOption, name)
+		}
+		output[name] = value
+	}
+	return output, nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// siteErrorMaxRead 只分析错误日志末尾的这部分内容
+	siteErrorMaxRead      = 8 << 20
+	siteErrorDefaultLimit = 50
+	siteErrorMaxLimit     = 200
+)
+
+var ErrInvalidErrorLevel = errors.New("日志级别无效")
+
+// errorLevels 按严重程度从低到高排列的 nginx 日志级别
+var errorLevels = []string{"debug", "info", "notice", "warn", "error", "crit", "alert", "emerg"}
+
+var (
+	// errorLinePattern 匹配 "2026/10/16 10:00:00 [error] 1234#1234: *56 message"，*连接号 可能缺省
+	errorLinePattern = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[(\w+)\] (\d+)#\d+: (?:\*(\d+) )?(.*)$`)
+	// errorContextPattern 匹配 nginx 追加在消息末尾的 ", client: ..., server: ..., request: "..."" 等上下文
+	errorContextPattern = regexp.MustCompile(`, (client|server|request|upstream|host|referrer): ("[^"]*"|[^,]*)`)
+	errorQuotedPattern  = regexp.MustCompile(`"[^"]*"`)
+	errorNumberPattern  = regexp.MustCompile(`(^|[^(\d])\d+`)
+)
+
+// parseErrorLine 把一行 nginx 错误日志解析为结构化记录，续行等无法识别的内容返回 false
+func parseErrorLine(line string) (model.SiteErrorEntry, bool) {
+	match := errorLinePattern.FindStringSubmatch(strings.TrimRight(line, "\r"))
+	if match == nil {
+		return model.SiteErrorEntry{}, false
+	}
+	at, err := time.ParseInLocation("2006/01/02 15:04:05", match[1], time.Local)
+	if err != nil {
+		return model.SiteErrorEntry{}, false
+	}
+	entry := model.SiteErrorEntry{UnixTime: at.Unix(), Level: match[2], Message: match[5]}
+	entry.PID, _ = strconv.Atoi(match[3])
+	entry.Connection, _ = strconv.ParseInt(match[4], 10, 64)
+
+	if loc := errorContextPattern.FindStringIndex(entry.Message); loc != nil {
+		context := entry.Message[loc[0]:]
+		entry.Message = entry.Message[:loc[0]]
+		for _, field := range errorContextPattern.FindAllStringSubmatch(context, -1) {
+			value := strings.Trim(field[2], `"`)
+			switch field[1] {
+			case "client":
+				entry.Client = value
+			case "server":
+				entry.Server = value
+			case "request":
+				entry.Request = value
+			case "upstream":
+				entry.Upstream = value
+			case "host":
+				entry.Host = value
+			}
+		}
+	}
+	return entry, true
+}
+
+// errorPattern 归并同类错误：引号内的路径与参数、以及数字替换为占位符，括号内的错误码保留
+func errorPattern(message string) string {
+	message = errorQuotedPattern.ReplaceAllString(message, `"…"`)
+	return errorNumberPattern.ReplaceAllString(message, "${1}N")
+}
+
+func errorLevelRank(level string) int {
+	return slices.Index(errorLevels, level)
+}
+
+// SummarizeErrors 按级别、消息模式与后端归并站点错误日志中 [from, to) 内的记录，按出现次数降序返回。
+// minLevel 非空时只统计不低于该级别的记录；未指定范围时取最近 24 小时
+func (s *SiteService) SummarizeErrors(domain string, from, to, now time.Time, minLevel string, limit int) (*model.SiteErrorSummary, error) {
+	return summarizeErrorLog(model.NginxLogDir, domain, from, to, now, minLevel, limit)
+}
+
+func summarizeErrorLog(logDir, domain string, from, to, now time.Time, minLevel string, limit int) (*model.SiteErrorSummary, error) {
+	if domain == "" || filepath.Base(domain) != domain || strings.HasPrefix(domain, ".") {
+		return nil, os.ErrNotExist
+	}
+	minRank := 0
+	if minLevel != "" {
+		if minRank = errorLevelRank(minLevel); minRank < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidErrorLevel, minLevel)
+		}
+	}
+	if limit <= 0 {
+		limit = siteErrorDefaultLimit
+	}
+	if limit > siteErrorMaxLimit {
+		return nil, fmt.Errorf("%w: limit 不能超过 %d", ErrInvalidStatsRange, siteErrorMaxLimit)
+	}
+	if to.IsZero() {
+		to = now
+	}
+	if from.IsZero() {
+		from = to.Add(-24 * time.Hour)
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: 开始时间需早于结束时间", ErrInvalidStatsRange)
+	}
+
+	summary := &model.SiteErrorSummary{
+		Domain:       domain,
+		FromUnixTime: from.Unix(),
+		ToUnixTime:   to.Unix(),
+		Levels:       map[string]int64{},
+		Groups:       []model.SiteErrorGroup{},
+	}
+	path := filepath.Join(logDir, fmt.Sprintf("%s-error.log", domain))
+	data, err := readLogTail(path, siteErrorMaxRead)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return summary, nil
+		}
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		summary.Truncated = info.Size() > siteErrorMaxRead
+	}
+
+	groups := make(map[string]*model.SiteErrorGroup)
+	for _, line := range strings.Split(string(data), "\n") {
+		entry, ok := parseErrorLine(line)
+		if !ok || entry.UnixTime < summary.FromUnixTime || entry.UnixTime >= summary.ToUnixTime || errorLevelRank(entry.Level) < minRank {
+			continue
+		}
+		summary.Total++
+		summary.Levels[entry.Level]++
+		pattern := errorPattern(entry.Message)
+		key := entry.Level + "\x00" + pattern + "\x00" + entry.Upstream
+		group := groups[key]
+		if group == nil {
+			group = &model.SiteErrorGroup{Level: entry.Level, Pattern: pattern, Upstream: entry.Upstream, FirstUnixTime: entry.UnixTime}
+			groups[key] = group
+		}
+		group.Count++
+		group.LastUnixTime = entry.UnixTime
+		group.Sample = entry
+	}
+
+	for _, group := range groups {
+		summary.Groups = append(summary.Groups, *group)
+	}
+	sort.Slice(summary.Groups, func(i, j int) bool {
+		a, b := summary.Groups[i], summary.Groups[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.LastUnixTime != b.LastUnixTime {
+			return a.LastUnixTime > b.LastUnixTime
+		}
+		return a.Pattern < b.Pattern
+	})
+	if len(summary.Groups) > limit {
+		summary.Groups = summary.Groups[:limit]
+	}
+	return summary, nil
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarizeErrorLog(t *testing.T) {
+	entry, ok := parseErrorLine(`2026/10/16 10:00:05 [error] 1234#1234: *56 connect() failed (111: Connection refused) while connecting to upstream, client: 1.2.3.4, server: a.com, request: "GET /api?id=1 HTTP/1.1", upstream: "http://127.0.0.1:8080/api?id=1", host: "a.com"`)
+	if !ok || entry.Level != "error" || entry.PID != 1234 || entry.Connection != 56 || entry.Client != "1.2.3.4" ||
+		entry.Upstream != "http://127.0.0.1:8080/api?id=1" || entry.Request != "GET /api?id=1 HTTP/1.1" ||
+		entry.Message != "connect() failed (111: Connection refused) while connecting to upstream" {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+	if got := errorPattern(`open() "/var/www/a/x.png" failed (2: No such file or directory)`); got != `open() "…" failed (2: No such file or directory)` {
+		t.Fatalf("unexpected pattern: %s", got)
+	}
+	if got := errorPattern("client intended to send too large body: 10485761 bytes"); got != "client intended to send too large body: N bytes" {
+		t.Fatalf("unexpected pattern: %s", got)
+	}
+
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local)
+	line := func(at time.Time, level, message string) string {
+		return at.Format("2006/01/02 15:04:05") + " [" + level + "] 100#100: " + message + "\n"
+	}
+	var content strings.Builder
+	content.WriteString(line(now.Add(-48*time.Hour), "error", `*1 open() "/var/www/a/old" failed (2: No such file or directory), client: 1.1.1.1`))
+	for i, file := range []string{"a.png", "b.png", "c.png"} {
+		content.WriteString(line(now.Add(time.Duration(i-3)*time.Minute), "error", `*2 open() "/var/www/a/`+file+`" failed (2: No such file or directory), client: 1.1.1.1, server: a.com`))
+	}
+	content.WriteString(line(now.Add(-time.Minute), "warn", `*3 an upstream response is buffered to a temporary file /var/cache/nginx/1/00/0000000001 while reading upstream, client: 1.1.1.1`))
+	content.WriteString("  continuation line without header\n")
+	os.WriteFile(filepath.Join(dir, "a.com-error.log"), []byte(content.String()), 0644)
+
+	summary, err := summarizeErrorLog(dir, "a.com", time.Time{}, time.Time{}, now, "", 0)
+	if err != nil {
+		t.Fatalf("summarize: %v", err)
+	}
+	if summary.Total != 4 || summary.Levels["error"] != 3 || summary.Levels["warn"] != 1 || len(summary.Groups) != 2 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if group := summary.Groups[0]; group.Count != 3 || group.Level != "error" || !strings.Contains(group.Sample.Message, "c.png") ||
+		group.FirstUnixTime != now.Add(-3*time.Minute).Unix() {
+		t.Fatalf("unexpected top group: %+v", group)
+	}
+
+	errorsOnly, _ := summarizeErrorLog(dir, "a.com", time.Time{}, time.Time{}, now, "error", 0)
+	if errorsOnly.Total != 3 || len(errorsOnly.Groups) != 1 {
+		t.Fatalf("unexpected level filter result: %+v", errorsOnly)
+	}
+	if _, err := summarizeErrorLog(dir, "a.com", time.Time{}, time.Time{}, now, "fatal", 0); !errors.Is(err, ErrInvalidErrorLevel) {
+		t.Fatalf("expected invalid level error, got %v", err)
+	}
+	if empty, err := summarizeErrorLog(dir, "b.com", time.Time{}, time.Time{}, now, "", 0); err != nil || empty.Total != 0 {
+		t.Fatalf("missing log should return an empty summary: %+v %v", empty, err)
+	}
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSitePath = errors.New("非法的文件路径")
+
+type SiteFileEntry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+func (s *SiteService) siteRoot(domain string) (string, error) {
+	domain = strings.TrimSpace(domain)
+	if domain == "" || domain == "." || domain == ".." || strings.ContainsAny(domain, `/\`) {
+		return "", ErrInvalidSitePath
+	}
+	return filepath.Join(s.WebRoot, domain), nil
+}
+
+// resolveSitePath 将相对路径解析为站点根目录下的绝对路径，拒绝越出根目录的访问
+func (s *SiteService) resolveSitePath(domain, rel string) (string, string, error) {
+	root, err := s.siteRoot(domain)
+	if err != nil {
+		return "", "", err
+	}
+	cleanRel := filepath.Clean("/" + strings.TrimSpace(rel))
+	full := filepath.Join(root, cleanRel)
+	if full != root && !strings.HasPrefix(full, root+string(os.PathSeparator)) {
+		return "", "", ErrInvalidSitePath
+	}
+
+	// 防止通过符号链接跳出站点目录
+	if realRoot, err := filepath.EvalSymlinks(root); err == nil {
+		probe := full
+		for {
+			if realProbe, err := filepath.EvalSymlinks(probe); err == nil {
+				if realProbe != realRoot && !strings.HasPrefix(realProbe, realRoot+string(os.PathSeparator)) {
+					return "", "", ErrInvalidSitePath
+				}
+				break
+			}
+			if probe == root {
+				break
+			}
+			probe = filepath.Dir(probe)
+		}
+	}
+	return full, strings.TrimPrefix(cleanRel, "/"), nil
+}
+
+func (s *SiteService) ListSiteFiles(domain, rel string) ([]SiteFileEntry, error) {
+	dir, cleanRel, err := s.resolveSitePath(domain, rel)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]SiteFileEntry, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, SiteFileEntry{
+			Name:    entry.Name(),
+			Path:    filepath.ToSlash(filepath.Join(cleanRel, entry.Name())),
+			IsDir:   entry.IsDir(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].IsDir != files[j].IsDir {
+			return files[i].IsDir
+		}
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// SaveSiteFile 将上传内容写入站点目录，dir 为目标目录的相对路径
+func (s *SiteService) SaveSiteFile(domain, dir, name string, src io.Reader) (string, error) {
+	name = filepath.Base(strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." || name == string(os.PathSeparator) {
+		return "", ErrInvalidSitePath
+	}
+	target, cleanRel, err := s.resolveSitePath(domain, filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("写入文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", err
+	}
+	return cleanRel, nil
+}
+
+// OpenSiteFile 返回可供下载的文件路径
+func (s *SiteService) OpenSiteFile(domain, rel string) (string, error) {
+	target, _, err := s.resolveSitePath(domain, rel)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%w: 不能下载目录", ErrInvalidSitePath)
+	}
+	return target, nil
+}
+
+func (s *SiteService) DeleteSiteFile(domain, rel string) error {
+	root, err := s.siteRoot(domain)
+	if err != nil {
+		return err
+	}
+	target, _, err := s.resolveSitePath(domain, rel)
+	if err != nil {
+		return err
+	}
+	if target == root {
+		return fmt.Errorf("%w: 不能删除站点根目录", ErrInvalidSitePath)
+	}
+	if _, err := os.Lstat(target); err != nil {
+		return err
+	}
+	return os.RemoveAll(target)
+}
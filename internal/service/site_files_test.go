@@ -0,0 +1,44 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSiteFilesRejectTraversal(t *testing.T) {
+	root := t.TempDir()
+	svc := &SiteService{WebRoot: root}
+	if err := os.MkdirAll(filepath.Join(root, "example.com"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret.txt"), []byte("x"), 0644); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+	if err := os.Symlink(root, filepath.Join(root, "example.com", "escape")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	saved, err := svc.SaveSiteFile("example.com", "../../assets", "app.js", strings.NewReader("ok"))
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if saved != "assets/app.js" {
+		t.Fatalf("unexpected saved path %q", saved)
+	}
+	if _, err := os.Stat(filepath.Join(root, "example.com", "assets", "app.js")); err != nil {
+		t.Fatalf("uploaded file should stay inside webroot: %v", err)
+	}
+
+	if _, err := svc.ListSiteFiles("..", ""); !errors.Is(err, ErrInvalidSitePath) {
+		t.Fatalf("expected invalid domain error, got %v", err)
+	}
+	if _, err := svc.OpenSiteFile("example.com", "escape/secret.txt"); !errors.Is(err, ErrInvalidSitePath) {
+		t.Fatalf("expected symlink escape to be rejected, got %v", err)
+	}
+	if err := svc.DeleteSiteFile("example.com", "/"); !errors.Is(err, ErrInvalidSitePath) {
+		t.Fatalf("expected root deletion to be rejected, got %v", err)
+	}
+}
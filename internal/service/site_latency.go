@@ -0,0 +1,163 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// timingLogFormat 面板维护的日志格式，在 main 格式末尾追加请求耗时与后端响应耗时，
+// 站点的 log_format 设为该名称后才会统计延迟
+const timingLogFormat = "main_timing"
+
+// accessTimingPattern 匹配 main_timing 末尾的 rt=$request_time urt="$upstream_response_time"
+var accessTimingPattern = regexp.MustCompile(` rt=(\d+(?:\.\d+)?) urt="([^"]*)"`)
+
+// latencyBoundsMs 耗时直方图各桶的上界（毫秒），最后一个桶记录超过 60 秒的请求
+var latencyBoundsMs = []float64{5, 10, 25, 50, 75, 100, 150, 200, 300, 500, 750, 1000, 1500, 2000, 3000, 5000, 10000, 30000, 60000}
+
+// latencyWindows 访问分析中返回的延迟统计窗口，按整点小时对齐
+var latencyWindows = []struct {
+	name   string
+	window time.Duration
+}{
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+}
+
+func timingLogFormatPath(confDir string) string {
+	return filepath.Join(confDir, "log_format.conf")
+}
+
+func renderTimingLogFormat() string {
+	return fmt.Sprintf("log_format %s '$remote_addr - $remote_user [$time_local] \"$request\" '\n"+
+		"    '$status $body_bytes_sent \"$http_referer\" '\n"+
+		"    '\"$http_user_agent\" rt=$request_time urt=\"$upstream_response_time\"';\n", timingLogFormat)
+}
+
+// ensureManagedLogFormats 写入 main_timing 与 main_json 的定义并在 nginx.conf 中引入
+func ensureManagedLogFormats(confDir string) error {
+	path := timingLogFormatPath(confDir)
+	content := renderTimingLogFormat() + renderJSONLogFormat()
+	if current, err := os.ReadFile(path); err != nil || string(current) != content {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return ensureHTTPInclude(confDir, path)
+}
+
+// parseAccessTiming 从日志行中取请求耗时与后端响应耗时（秒）。经过多个后端时
+// $upstream_response_time 为逗号或冒号分隔的多个值，取其总和；没有后端时 upstreamOK 为 false
+func parseAccessTiming(line string) (request, upstream float64, ok, upstreamOK bool) {
+	match := accessTimingPattern.FindStringSubmatch(line)
+	if match == nil {
+		return 0, 0, false, false
+	}
+	request, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, 0, false, false
+	}
+	upstream, upstreamOK = sumUpstreamTimes(match[2])
+	return request, upstream, true, upstreamOK
+}
+
+// observeLatency 把一次耗时（秒）计入直方图
+func observeLatency(histogram []int64, seconds float64) []int64 {
+	if len(histogram) != len(latencyBoundsMs)+1 {
+		histogram = make([]int64, len(latencyBoundsMs)+1)
+	}
+	ms := seconds * 1000
+	index := len(latencyBoundsMs)
+	for i, bound := range latencyBoundsMs {
+		if ms <= bound {
+			index = i
+			break
+		}
+	}
+	histogram[index]++
+	return histogram
+}
+
+func mergeLatency(dst, src []int64) []int64 {
+	if len(src) != len(latencyBoundsMs)+1 {
+		return dst
+	}
+	if len(dst) != len(src) {
+		dst = make([]int64, len(src))
+	}
+	for i, count := range src {
+		dst[i] += count
+	}
+	return dst
+}
+
+// latencyPercentile 按直方图估算分位数（毫秒），在所在桶的上下界之间线性插值；
+// 落在最后一个桶时返回 60 秒上界
+func latencyPercentile(histogram []int64, percentile float64) float64 {
+	var total int64
+	for _, count := range histogram {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(percentile / 100 * float64(total)))
+	var seen int64
+	for i, count := range histogram {
+		if count == 0 || seen+count < rank {
+			seen += count
+			continue
+		}
+		if i >= len(latencyBoundsMs) {
+			return latencyBoundsMs[len(latencyBoundsMs)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = latencyBoundsMs[i-1]
+		}
+		return lower + (latencyBoundsMs[i]-lower)*float64(rank-seen)/float64(count)
+	}
+	return latencyBoundsMs[len(latencyBoundsMs)-1]
+}
+
+func latencySamples(histogram []int64) int64 {
+	var total int64
+	for _, count := range histogram {
+		total += count
+	}
+	return total
+}
+
+// siteLatencyWindows 汇总最近 1 小时、24 小时与 7 天的延迟分位数
+func (st *siteStatsState) siteLatencyWindows(now time.Time) []model.SiteLatency {
+	windows := make([]model.SiteLatency, 0, len(latencyWindows))
+	for _, w := range latencyWindows {
+		from := now.Add(-w.window).Truncate(time.Hour).Unix()
+		var request, upstream []int64
+		for _, hour := range st.Hours {
+			if hour.Start >= from && hour.Start <= now.Unix() {
+				request = mergeLatency(request, hour.Latency)
+				upstream = mergeLatency(upstream, hour.UpstreamLatency)
+			}
+		}
+		windows = append(windows, model.SiteLatency{
+			Window:          w.name,
+			Samples:         latencySamples(request),
+			P50Ms:           latencyPercentile(request, 50),
+			P95Ms:           latencyPercentile(request, 95),
+			P99Ms:           latencyPercentile(request, 99),
+			UpstreamSamples: latencySamples(upstream),
+			UpstreamP50Ms:   latencyPercentile(upstream, 50),
+			UpstreamP95Ms:   latencyPercentile(upstream, 95),
+			UpstreamP99Ms:   latencyPercentile(upstream, 99),
+		})
+	}
+	return windows
+}
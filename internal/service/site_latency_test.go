@@ -0,0 +1,83 @@
+package service
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSiteLatency(t *testing.T) {
+	if request, upstream, ok, upstreamOK := parseAccessTiming(`1.2.3.4 - - [x] "GET / HTTP/1.1" 200 5 "-" "curl" rt=0.120 urt="0.050, 0.030 : 0.010"`); !ok || !upstreamOK ||
+		request != 0.12 || math.Abs(upstream-0.09) > 1e-9 {
+		t.Fatalf("unexpected timing: %v %v %v %v", request, upstream, ok, upstreamOK)
+	}
+	if _, _, ok, upstreamOK := parseAccessTiming(`1.2.3.4 - - [x] "GET / HTTP/1.1" 200 5 "-" "curl" rt=0.001 urt="-"`); !ok || upstreamOK {
+		t.Fatal("static requests should have no upstream timing")
+	}
+
+	var histogram []int64
+	for i := 0; i < 90; i++ {
+		histogram = observeLatency(histogram, 0.004)
+	}
+	for i := 0; i < 10; i++ {
+		histogram = observeLatency(histogram, 0.4)
+	}
+	if p50, p95, p99 := latencyPercentile(histogram, 50), latencyPercentile(histogram, 95), latencyPercentile(histogram, 99); p50 > 5 || p95 < 300 || p95 > 500 || p99 < p95 {
+		t.Fatalf("unexpected percentiles: %v %v %v", p50, p95, p99)
+	}
+	if latencyPercentile(observeLatency(nil, 120), 50) != 60000 {
+		t.Fatal("overflow bucket should report the last bound")
+	}
+
+	dir := t.TempDir()
+	svc := NewSiteStatsService(nil)
+	svc.LogDir = filepath.Join(dir, "logs")
+	svc.dir = filepath.Join(dir, "stats")
+	os.MkdirAll(svc.LogDir, 0755)
+	now := time.Date(2026, 3, 10, 12, 30, 0, 0, time.Local)
+	var content strings.Builder
+	line := func(at time.Time, rt, urt string) {
+		content.WriteString(`1.2.3.4 - - [` + at.Format("02/Jan/2006:15:04:05 -0700") + `] "GET / HTTP/1.1" 200 10 "-" "curl" rt=` + rt + ` urt="` + urt + `"` + "\n")
+	}
+	line(now.Add(-3*time.Hour), "2.000", "1.900")
+	for i := 0; i < 4; i++ {
+		line(now.Add(-time.Minute), "0.040", "-")
+	}
+	content.WriteString(`1.2.3.4 - - [` + now.Format("02/Jan/2006:15:04:05 -0700") + `] "GET / HTTP/1.1" 200 10 "-" "curl"` + "\n")
+	os.WriteFile(filepath.Join(svc.LogDir, "a.example.com-access.log"), []byte(content.String()), 0644)
+	svc.Ingest(now)
+
+	analytics, err := svc.Analytics("a.example.com", time.Time{}, time.Time{}, now, 0)
+	if err != nil {
+		t.Fatalf("analytics: %v", err)
+	}
+	if analytics.Requests != 6 || len(analytics.Latency) != 3 {
+		t.Fatalf("unexpected analytics: %+v", analytics)
+	}
+	hour, day := analytics.Latency[0], analytics.Latency[1]
+	if hour.Window != "1h" || hour.Samples != 4 || hour.P99Ms > 50 || hour.UpstreamSamples != 0 {
+		t.Fatalf("unexpected 1h latency: %+v", hour)
+	}
+	if day.Samples != 5 || day.P99Ms < 1500 || day.UpstreamSamples != 1 || day.UpstreamP50Ms < 1500 {
+		t.Fatalf("unexpected 24h latency: %+v", day)
+	}
+
+	// 使用 main_timing 或 main_json 的站点会写入格式定义并在 nginx.conf 中引入
+	confDir := filepath.Join(dir, "nginx")
+	os.MkdirAll(confDir, 0755)
+	os.WriteFile(filepath.Join(confDir, "nginx.conf"), []byte("http {\n    include /etc/nginx/sites-enabled/*;\n}\n"), 0644)
+	for i := 0; i < 2; i++ {
+		if err := ensureManagedLogFormats(confDir); err != nil {
+			t.Fatalf("ensure log format: %v", err)
+		}
+	}
+	conf, _ := os.ReadFile(filepath.Join(confDir, "nginx.conf"))
+	format, _ := os.ReadFile(timingLogFormatPath(confDir))
+	if strings.Count(string(conf), "log_format.conf") != 1 || !strings.Contains(string(format), `rt=$request_time urt="$upstream_response_time"`) ||
+		!strings.Contains(string(format), "log_format main_json escape=json") {
+		t.Fatalf("unexpected config:\n%s\n%s", conf, format)
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+const (
+	// siteLogTailMaxRead 每次轮询从单个日志读取的上限，积压的部分在下次轮询继续读取
+	siteLogTailMaxRead = 1 << 20
+	siteLogMaxLine     = 64 * 1024
+	siteLogMaxKeyword  = 200
+)
+
+var ErrInvalidLogFilter = errors.New("日志过滤条件无效")
+
+type SiteLogLine struct {
+	Kind string `json:"kind"` // access, error
+	Line string `json:"line"`
+}
+
+// SiteLogFilter 实时日志的服务端过滤条件。StatusClasses 只作用于访问日志，Keyword 不区分大小写
+type SiteLogFilter struct {
+	Kind          string
+	StatusClasses []byte // '2' ~ '5'
+	Keyword       string
+}
+
+// ParseSiteLogFilter 解析查询参数：kind 为 access/error，status 为逗号分隔的 2xx~5xx
+func ParseSiteLogFilter(kind, status, keyword string) (SiteLogFilter, error) {
+	filter := SiteLogFilter{Kind: kind, Keyword: strings.ToLower(strings.TrimSpace(keyword))}
+	if kind != "" && kind != "access" && kind != "error" {
+		return filter, fmt.Errorf("%w: kind 仅支持 access 或 error", ErrInvalidLogFilter)
+	}
+	for _, class := range strings.Split(status, ",") {
+		class = strings.ToLower(strings.TrimSpace(class))
+		if class == "" {
+			continue
+		}
+		if len(class) != 3 || class[0] < '2' || class[0] > '5' || class[1:] != "xx" {
+			return filter, fmt.Errorf("%w: 状态码类别仅支持 2xx、3xx、4xx、5xx", ErrInvalidLogFilter)
+		}
+		filter.StatusClasses = append(filter.StatusClasses, class[0])
+	}
+	if len([]rune(filter.Keyword)) > siteLogMaxKeyword {
+		return filter, fmt.Errorf("%w: 关键字不能超过 %d 个字符", ErrInvalidLogFilter, siteLogMaxKeyword)
+	}
+	return filter, nil
+}
+
+func (f SiteLogFilter) match(kind, line string) bool {
+	if kind == "access" && len(f.StatusClasses) > 0 {
+		entry, ok := parseAccessLine(line)
+		if !ok || !slices.Contains(f.StatusClasses, byte('0'+entry.Status/100)) {
+			return false
+		}
+	}
+	return f.Keyword == "" || strings.Contains(strings.ToLower(line), f.Keyword)
+}
+
+// logFollower 跟踪单个日志文件的新增内容，文件被轮转（inode 变化或变小）后从新文件开头继续读取
+type logFollower struct {
+	kind    string
+	path    string
+	file    *os.File
+	inode   uint64
+	offset  int64
+	partial []byte
+}
+
+func (f *logFollower) open(fromEnd bool) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return
+	}
+	f.file, f.inode, f.offset, f.partial = file, fileInode(info), 0, nil
+	if fromEnd {
+		f.offset = info.Size()
+	}
+}
+
+func fileInode(info os.FileInfo) uint64 {
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(sys.Ino)
+	}
+	return 0
+}
+
+// poll 返回自上次以来新增的完整行
+func (f *logFollower) poll() []string {
+	if f.file == nil {
+		// 启动时文件尚不存在，之后出现的内容全部读取
+		f.open(false)
+		if f.file == nil {
+			return nil
+		}
+	}
+	lines := f.read()
+	if info, err := os.Stat(f.path); err == nil && (fileInode(info) != f.inode || info.Size() < f.offset) {
+		f.close()
+		f.open(false)
+		if f.file != nil {
+			lines = append(lines, f.read()...)
+		}
+	}
+	return lines
+}
+
+func (f *logFollower) read() []string {
+	info, err := f.file.Stat()
+	if err != nil || info.Size() <= f.offset {
+		return nil
+	}
+	size := min(info.Size()-f.offset, siteLogTailMaxRead)
+	data := make([]byte, size)
+	n, err := f.file.ReadAt(data, f.offset)
+	if err != nil && err != io.EOF {
+		return nil
+	}
+	f.offset += int64(n)
+	data = append(f.partial, data[:n]...)
+
+	end := bytes.LastIndexByte(data, '\n')
+	f.partial = nil
+	if end < 0 {
+		// 超长的未完成行直接丢弃，避免占用过多内存
+		if len(data) <= siteLogMaxLine {
+			f.partial = data
+		}
+		return nil
+	}
+	if rest := data[end+1:]; len(rest) > 0 && len(rest) <= siteLogMaxLine {
+		f.partial = append([]byte(nil), rest...)
+	}
+	return strings.Split(string(data[:end]), "\n")
+}
+
+func (f *logFollower) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+// SiteLogTail 跟踪站点的访问日志与错误日志，从创建时的末尾开始只返回新增且符合过滤条件的行
+type SiteLogTail struct {
+	filter    SiteLogFilter
+	followers []*logFollower
+}
+
+func newSiteLogTail(logDir, domain string, filter SiteLogFilter) (*SiteLogTail, error) {
+	if domain == "" || filepath.Base(domain) != domain || strings.HasPrefix(domain, ".") {
+		return nil, os.ErrNotExist
+	}
+	tail := &SiteLogTail{filter: filter}
+	for _, kind := range []string{"access", "error"} {
+		if filter.Kind != "" && filter.Kind != kind {
+			continue
+		}
+		follower := &logFollower{kind: kind, path: filepath.Join(logDir, fmt.Sprintf("%s-%s.log", domain, kind))}
+		follower.open(true)
+		tail.followers = append(tail.followers, follower)
+	}
+	return tail, nil
+}
+
+// TailLogs 开始跟踪站点日志，调用方需定期 Poll 并在结束时 Close
+func (s *SiteService) TailLogs(domain string, filter SiteLogFilter) (*SiteLogTail, error) {
+	return newSiteLogTail(model.NginxLogDir, domain, filter)
+}
+
+func (t *SiteLogTail) Poll() []SiteLogLine {
+	var lines []SiteLogLine
+	for _, follower := range t.followers {
+		for _, line := range follower.poll() {
+			line = strings.TrimRight(line, "\r")
+			if line != "" && t.filter.match(follower.kind, line) {
+				lines = append(lines, SiteLogLine{Kind: follower.kind, Line: line})
+			}
+		}
+	}
+	return lines
+}
+
+func (t *SiteLogTail) Close() {
+	for _, follower := range t.followers {
+		follower.close()
+	}
+}
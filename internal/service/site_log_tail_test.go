@@ -0,0 +1,63 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSiteLogTail(t *testing.T) {
+	dir := t.TempDir()
+	accessPath := filepath.Join(dir, "a.example.com-access.log")
+	errorPath := filepath.Join(dir, "a.example.com-error.log")
+	os.WriteFile(accessPath, []byte(`1.1.1.1 - - [10/Mar/2026:12:00:00 +0800] "GET /old HTTP/1.1" 500 1 "-" "curl"`+"\n"), 0644)
+
+	filter, err := ParseSiteLogFilter("", "4xx, 5xx", "API")
+	if err != nil {
+		t.Fatalf("parse filter: %v", err)
+	}
+	tail, err := newSiteLogTail(dir, "a.example.com", filter)
+	if err != nil {
+		t.Fatalf("tail: %v", err)
+	}
+	defer tail.Close()
+	if lines := tail.Poll(); len(lines) != 0 {
+		t.Fatalf("existing lines should be skipped: %+v", lines)
+	}
+
+	appendLog := func(path, content string) {
+		file, _ := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		file.WriteString(content)
+		file.Close()
+	}
+	appendLog(accessPath, `2.2.2.2 - - [10/Mar/2026:12:00:01 +0800] "GET /api/a HTTP/1.1" 200 1 "-" "curl"`+"\n"+
+		`2.2.2.2 - - [10/Mar/2026:12:00:02 +0800] "GET /api/b HTTP/1.1" 404 1 "-" "curl"`+"\n"+
+		`2.2.2.2 - - [10/Mar/2026:12:00:03 +0800] "GET /static HTTP/1.1" 502 1 "-" "curl"`+"\n"+
+		`2.2.2.2 - - [10/Mar/2026:12:00:04 +0800] "GET /api/c`)
+	// 错误日志在跟踪开始后才创建，不受状态码过滤影响
+	appendLog(errorPath, "2026/03/10 12:00:05 [error] 1#1: upstream timed out, request: \"GET /api/d\"\n")
+	lines := tail.Poll()
+	if len(lines) != 2 || lines[0].Kind != "access" || !strings.Contains(lines[0].Line, "/api/b") || lines[1].Kind != "error" {
+		t.Fatalf("unexpected lines: %+v", lines)
+	}
+
+	// 未写完的行在补全后返回；日志轮转后从新文件开头读取
+	appendLog(accessPath, ` HTTP/1.1" 503 1 "-" "curl"`+"\n")
+	os.Rename(accessPath, accessPath+".1")
+	appendLog(accessPath, `3.3.3.3 - - [10/Mar/2026:12:00:06 +0800] "POST /api/e HTTP/1.1" 500 1 "-" "curl"`+"\n")
+	lines = tail.Poll()
+	if len(lines) != 2 || lines[0].Line[:7] != "2.2.2.2" || lines[1].Line[:7] != "3.3.3.3" {
+		t.Fatalf("unexpected lines after rotation: %+v", lines)
+	}
+
+	for _, tc := range [][3]string{{"debug", "", ""}, {"", "6xx", ""}, {"", "40x", ""}} {
+		if _, err := ParseSiteLogFilter(tc[0], tc[1], tc[2]); !errors.Is(err, ErrInvalidLogFilter) {
+			t.Fatalf("expected invalid filter for %v, got %v", tc, err)
+		}
+	}
+	if _, err := newSiteLogTail(dir, "../etc", SiteLogFilter{}); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist for invalid domain, got %v", err)
+	}
+}
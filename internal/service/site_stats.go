@@ -0,0 +1,395 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	siteStatsDir      = "/root/site_stats"
+	siteStatsInterval = time.Minute
+	// siteStatsMaxRead 每个周期从单个日志读取的上限，积压的部分在后续周期继续读取
+	siteStatsMaxRead     = 16 << 20
+	siteStatsHourRetain  = 7 * 24 * time.Hour
+	siteStatsDayRetain   = 400
+	siteStatsDefaultDays = 30
+)
+
+var ErrInvalidStatsRange = errors.New("统计范围无效")
+
+// accessLinePattern 匹配 main/combined 格式：$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent
+// "$http_referer" "$http_user_agent"，末尾的 referer 与 UA 可以缺省
+var accessLinePattern = regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "([^"]*)" (\d{3}) (\d+|-)(?: "[^"]*" "([^"]*)")?`)
+
+// siteStatsHour 一小时的汇总。IPs 只在当天与前一天保留，用于计算按天去重的访客数；
+// Top 按维度记录各取值的请求数，小时结束后只保留前 siteAnalyticsKeep 项；
+// Latency 与 UpstreamLatency 为按 latencyBoundsMs 分桶的耗时直方图，仅 main_timing 与 main_json 格式的日志有数据
+type siteStatsHour struct {
+	Start           int64                       `json:"start"`
+	Requests        int64                       `json:"requests"`
+	Bytes           int64                       `json:"bytes"`
+	UniqueIPs       int                         `json:"unique_ips"`
+	IPs             []string                    `json:"ips,omitempty"`
+	Top             map[string]map[string]int64 `json:"top,omitempty"`
+	Latency         []int64                     `json:"latency,omitempty"`
+	UpstreamLatency []int64                     `json:"upstream_latency,omitempty"`
+
+	ips map[string]struct{}
+}
+
+// siteStatsState 单个站点的读取进度与汇总数据，保存为 <dir>/<domain>.json
+type siteStatsState struct {
+	Inode  uint64                 `json:"inode"`
+	Offset int64                  `json:"offset"`
+	Hours  []*siteStatsHour       `json:"hours"`
+	Days   []model.SiteStatsPoint `json:"days"`
+}
+
+// SiteStatsService 增量读取各站点的访问日志，按小时与天汇总请求数、流量与独立 IP；
+// 有 GeoIP 数据库时同时按国家与地区计数。汇总结果按域名保存为 siteStatsDir 下的 JSON 文件，
+// 并未使用 SQLite：引入 SQLite 驱动需要新增依赖，在确认引入依赖或调整需求范围之前沿用 JSON 文件
+type SiteStatsService struct {
+	LogDir string
+	dir    string
+	geo    *GeoIPService
+	mu     sync.Mutex
+	states map[string]*siteStatsState
+}
+
+func NewSiteStatsService(geo *GeoIPService) *SiteStatsService {
+	return &SiteStatsService{
+		LogDir: model.NginxLogDir,
+		dir:    siteStatsDir,
+		geo:    geo,
+		states: make(map[string]*siteStatsState),
+	}
+}
+
+func (s *SiteStatsService) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ticker := time.NewTicker(siteStatsInterval)
+	defer ticker.Stop()
+
+	s.Ingest(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Ingest(time.Now())
+		}
+	}
+}
+
+func (s *SiteStatsService) statePath(domain string) string {
+	return filepath.Join(s.dir, domain+".json")
+}
+
+func (s *SiteStatsService) loadState(domain string) (*siteStatsState, error) {
+	if state, ok := s.states[domain]; ok {
+		return state, nil
+	}
+	state := &siteStatsState{}
+	data, err := os.ReadFile(s.statePath(domain))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("解析 %s 失败: %w", s.statePath(domain), err)
+		}
+	}
+	for _, hour := range state.Hours {
+		if len(hour.IPs) == 0 {
+			continue
+		}
+		hour.ips = make(map[string]struct{}, len(hour.IPs))
+		for _, ip := range hour.IPs {
+			hour.ips[ip] = struct{}{}
+		}
+	}
+	s.states[domain] = state
+	return state, nil
+}
+
+func (s *SiteStatsService) saveState(domain string, state *siteStatsState) error {
+	for _, hour := range state.Hours {
+		hour.IPs = hour.IPs[:0]
+		for ip := range hour.ips {
+			hour.IPs = append(hour.IPs, ip)
+		}
+		sort.Strings(hour.IPs)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.statePath(domain), data, 0600)
+}
+
+// Ingest 读取所有站点日志的新增内容并更新汇总
+func (s *SiteStatsService) Ingest(now time.Time) {
+	paths, _ := filepath.Glob(filepath.Join(s.LogDir, "*-access.log"))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, path := range paths {
+		domain := strings.TrimSuffix(filepath.Base(path), "-access.log")
+		if err := s.ingestSite(domain, path, now); err != nil {
+			log.Printf("[site-stats] 统计 %s 失败: %v", domain, err)
+		}
+	}
+}
+
+func (s *SiteStatsService) ingestSite(domain, path string, now time.Time) error {
+	state, err := s.loadState(domain)
+	if err != nil {
+		return err
+	}
+	prevInode, prevOffset := state.Inode, state.Offset
+	data, err := readAccessLogChunk(path, state)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 && state.Inode == prevInode && state.Offset == prevOffset {
+		return nil
+	}
+
+	hours := make(map[int64]*siteStatsHour, len(state.Hours))
+	for _, hour := range state.Hours {
+		hours[hour.Start] = hour
+	}
+	oldest := now.Add(-siteStatsHourRetain)
+	touchedDays := make(map[int64]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		entry, ok := parseAccessLine(line)
+		if !ok || entry.Time.Before(oldest) {
+			continue
+		}
+		at := entry.Time
+		start := at.Truncate(time.Hour).Unix()
+		hour := hours[start]
+		if hour == nil {
+			hour = &siteStatsHour{Start: start, ips: make(map[string]struct{})}
+			hours[start] = hour
+			state.Hours = append(state.Hours, hour)
+		}
+		hour.Requests++
+		hour.Bytes += entry.Bytes
+		hour.count(entry.IP, entry.Request, strconv.Itoa(entry.Status), entry.UserAgent)
+		if entry.HasTiming {
+			hour.Latency = observeLatency(hour.Latency, entry.RequestTime)
+			if entry.HasUpstream {
+				hour.UpstreamLatency = observeLatency(hour.UpstreamLatency, entry.UpstreamTime)
+			}
+		}
+		if country, region, ok := s.geo.Lookup(entry.IP); ok {
+			hour.countGeo(country, region)
+		}
+		if hour.ips != nil {
+			hour.ips[entry.IP] = struct{}{}
+			hour.UniqueIPs = len(hour.ips)
+		}
+		touchedDays[dayStart(at.Local()).Unix()] = true
+	}
+
+	sort.Slice(state.Hours, func(i, j int) bool { return state.Hours[i].Start < state.Hours[j].Start })
+	for day := range touchedDays {
+		state.rollupDay(day)
+	}
+	state.prune(now)
+	return s.saveState(domain, state)
+}
+
+// readAccessLogChunk 从上次的位置读取新增的完整行，日志被轮转（inode 变化或文件变小）时从头读取
+func readAccessLogChunk(path string, state *siteStatsState) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var inode uint64
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		inode = uint64(sys.Ino)
+	}
+	if inode != state.Inode || info.Size() < state.Offset {
+		state.Inode = inode
+		state.Offset = 0
+	}
+	size := info.Size() - state.Offset
+	if size <= 0 {
+		return nil, nil
+	}
+	if size > siteStatsMaxRead {
+		size = siteStatsMaxRead
+	}
+	data := make([]byte, size)
+	n, err := file.ReadAt(data, state.Offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	data = data[:n]
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		// 超长的单行直接跳过，避免卡住读取进度
+		if int64(n) == siteStatsMaxRead {
+			state.Offset += int64(n)
+		}
+		return nil, nil
+	}
+	state.Offset += int64(end + 1)
+	return data[:end+1], nil
+}
+
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// rollupDay 由该天的小时数据重新计算按天汇总，独立 IP 只在小时数据仍保留 IP 时重新计算
+func (st *siteStatsState) rollupDay(day int64) {
+	end := time.Unix(day, 0).AddDate(0, 0, 1).Unix()
+	point := model.SiteStatsPoint{StartUnixTime: day}
+	ips := make(map[string]struct{})
+	for _, hour := range st.Hours {
+		if hour.Start < day || hour.Start >= end {
+			continue
+		}
+		point.Requests += hour.Requests
+		point.Bytes += hour.Bytes
+		for country, count := range hour.Top[analyticsCountry] {
+			if point.Countries == nil {
+				point.Countries = make(map[string]int64)
+			}
+			point.Countries[country] += count
+		}
+		for ip := range hour.ips {
+			ips[ip] = struct{}{}
+		}
+	}
+	point.UniqueIPs = len(ips)
+
+	idx := sort.Search(len(st.Days), func(i int) bool { return st.Days[i].StartUnixTime >= day })
+	if idx < len(st.Days) && st.Days[idx].StartUnixTime == day {
+		if point.UniqueIPs < st.Days[idx].UniqueIPs {
+			point.UniqueIPs = st.Days[idx].UniqueIPs
+		}
+		st.Days[idx] = point
+		return
+	}
+	st.Days = append(st.Days, model.SiteStatsPoint{})
+	copy(st.Days[idx+1:], st.Days[idx:])
+	st.Days[idx] = point
+}
+
+// prune 删除过期的小时与天数据，前一天之前的小时数据不再保留 IP
+func (st *siteStatsState) prune(now time.Time) {
+	oldest := now.Add(-siteStatsHourRetain).Truncate(time.Hour).Unix()
+	ipHorizon := dayStart(now.Local()).AddDate(0, 0, -1).Unix()
+	current := now.Truncate(time.Hour).Unix()
+	hours := st.Hours[:0]
+	for _, hour := range st.Hours {
+		if hour.Start < oldest {
+			continue
+		}
+		if hour.Start < current {
+			hour.trimTop()
+		}
+		if hour.Start < ipHorizon {
+			hour.ips = nil
+		}
+		hours = append(hours, hour)
+	}
+	st.Hours = hours
+
+	oldestDay := dayStart(now.Local()).AddDate(0, 0, -siteStatsDayRetain).Unix()
+	days := st.Days[:0]
+	for _, day := range st.Days {
+		if day.StartUnixTime >= oldestDay {
+			days = append(days, day)
+		}
+	}
+	st.Days = days
+}
+
+// Stats 返回站点在 [from, to) 内的按小时或按天汇总。未指定范围时小时数据取最近 24 小时，天数据取最近 30 天
+func (s *SiteStatsService) Stats(domain, granularity string, from, to, now time.Time) (*model.SiteStats, error) {
+	if domain == "" || filepath.Base(domain) != domain || strings.HasPrefix(domain, ".") {
+		return nil, os.ErrNotExist
+	}
+	if granularity == "" {
+		granularity = "hour"
+	}
+	if granularity != "hour" && granularity != "day" {
+		return nil, fmt.Errorf("%w: 粒度仅支持 hour 或 day", ErrInvalidStatsRange)
+	}
+	if to.IsZero() {
+		to = now
+	}
+	if from.IsZero() {
+		from = to.Add(-24 * time.Hour)
+		if granularity == "day" {
+			from = to.AddDate(0, 0, -siteStatsDefaultDays)
+		}
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: 开始时间需早于结束时间", ErrInvalidStatsRange)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.loadState(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	// 起点所在的小时或天也计入结果
+	var points []model.SiteStatsPoint
+	lower := from.Truncate(time.Hour).Unix()
+	if granularity == "hour" {
+		for _, hour := range state.Hours {
+			points = append(points, model.SiteStatsPoint{StartUnixTime: hour.Start, Requests: hour.Requests, Bytes: hour.Bytes, UniqueIPs: hour.UniqueIPs, Countries: hour.Top[analyticsCountry]})
+		}
+	} else {
+		points = state.Days
+		lower = dayStart(from.Local()).Unix()
+	}
+
+	stats := &model.SiteStats{Domain: domain, Granularity: granularity, Points: []model.SiteStatsPoint{}, GeoIP: s.geo.Available()}
+	countries := make(map[string]int64)
+	for _, point := range points {
+		if point.StartUnixTime < lower || point.StartUnixTime >= to.Unix() {
+			continue
+		}
+		stats.Points = append(stats.Points, point)
+		stats.Requests += point.Requests
+		stats.Bytes += point.Bytes
+		for country, count := range point.Countries {
+			countries[country] += count
+		}
+	}
+	stats.Countries = topAnalyticsEntries(countries, len(countries))
+	return stats, nil
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"fmt"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSiteStatsIngest(t *testing.T) {
+	dir := t.TempDir()
+	svc := NewSiteStatsService(nil)
+	svc.LogDir = filepath.Join(dir, "logs")
+	svc.dir = filepath.Join(dir, "stats")
+	os.MkdirAll(svc.LogDir, 0755)
+
+	now := time.Date(2026, 3, 10, 12, 30, 0, 0, time.Local)
+	line := func(ip string, at time.Time, size string) string {
+		return fmt.Sprintf("%s - - [%s] \"GET / HTTP/1.1\" 200 %s \"-\" \"curl\"\n", ip, at.Format("02/Jan/2006:15:04:05 -0700"), size)
+	}
+	logPath := filepath.Join(svc.LogDir, "a.example.com-access.log")
+	os.WriteFile(logPath, []byte(
+		line("1.1.1.1", now.Add(-10*24*time.Hour), "100")+ // 超出保留期
+			line("1.1.1.1", now.Add(-2*time.Hour), "100")+
+			line("2.2.2.2", now.Add(-2*time.Hour), "-")+
+			line("1.1.1.1", now.Add(-time.Minute), "300")+
+			"not a log line\n"+
+			line("3.3.3.3", now, "50")[:20], // 未写完的行留到下次读取
+	), 0644)
+
+	svc.Ingest(now)
+	stats, err := svc.Stats("a.example.com", "hour", time.Time{}, time.Time{}, now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if len(stats.Points) != 2 || stats.Requests != 3 || stats.Bytes != 400 || stats.Points[0].UniqueIPs != 2 {
+		t.Fatalf("unexpected hourly stats: %+v", stats)
+	}
+
+	// 补全上次未写完的行，重启后从保存的进度继续读取
+	file, _ := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(line("3.3.3.3", now, "50")[20:])
+	file.Close()
+	restarted := NewSiteStatsService(nil)
+	restarted.LogDir, restarted.dir = svc.LogDir, svc.dir
+	restarted.Ingest(now)
+	daily, err := restarted.Stats("a.example.com", "day", time.Time{}, time.Time{}, now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("daily stats: %v", err)
+	}
+	if len(daily.Points) != 1 || daily.Points[0].Requests != 4 || daily.Points[0].UniqueIPs != 3 || daily.Bytes != 450 {
+		t.Fatalf("unexpected daily stats: %+v", daily)
+	}
+
+	// 日志被轮转后从新文件开头读取
+	os.Remove(logPath)
+	os.WriteFile(logPath, []byte(line("4.4.4.4", now, "1")), 0644)
+	restarted.Ingest(now)
+	daily, _ = restarted.Stats("a.example.com", "day", time.Time{}, time.Time{}, now.Add(time.Second))
+	if daily.Points[0].Requests != 5 || daily.Points[0].UniqueIPs != 4 {
+		t.Fatalf("rotated log not ingested: %+v", daily)
+	}
+
+	if _, err := svc.Stats("a.example.com", "week", time.Time{}, time.Time{}, now); err == nil || !strings.Contains(err.Error(), "粒度") {
+		t.Fatalf("expected granularity error, got %v", err)
+	}
+	if _, err := svc.Stats("../etc", "hour", time.Time{}, time.Time{}, now); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist for invalid domain, got %v", err)
+	}
+}
+
+func TestSiteAnalytics(t *testing.T) {
+	dir := t.TempDir()
+	svc := NewSiteStatsService(nil)
+	svc.LogDir = filepath.Join(dir, "logs")
+	svc.dir = filepath.Join(dir, "stats")
+	os.MkdirAll(svc.LogDir, 0755)
+
+	now := time.Date(2026, 3, 10, 12, 30, 0, 0, time.Local)
+	line := func(ip string, at time.Time, request, status, agent string) string {
+		return fmt.Sprintf("%s - - [%s] \"%s\" %s 10 \"-\" \"%s\"\n", ip, at.Format("02/Jan/2006:15:04:05 -0700"), request, status, agent)
+	}
+	var content strings.Builder
+	for i := 0; i < 3; i++ {
+		content.WriteString(line("1.1.1.1", now.Add(-2*time.Hour), "GET /index.html?page=1 HTTP/1.1", "200", "curl/8.0"))
+	}
+	content.WriteString(line("2.2.2.2", now.Add(-time.Hour), "GET /missing HTTP/1.1", "404", "Mozilla/5.0"))
+	content.WriteString(line("2.2.2.2", now.Add(-30*time.Hour), "GET /old HTTP/1.1", "500", "Mozilla/5.0"))
+	// 缺少 referer 与 UA 的 common 格式
+	content.WriteString(fmt.Sprintf("3.3.3.3 - - [%s] \"GET /index.html HTTP/1.1\" 200 5\n", now.Add(-time.Minute).Format("02/Jan/2006:15:04:05 -0700")))
+	os.WriteFile(filepath.Join(svc.LogDir, "a.example.com-access.log"), []byte(content.String()), 0644)
+
+	svc.Ingest(now)
+	analytics, err := svc.Analytics("a.example.com", time.Time{}, time.Time{}, now, 2)
+	if err != nil {
+		t.Fatalf("analytics: %v", err)
+	}
+	if analytics.Requests != 5 {
+		t.Fatalf("expected 5 requests in the last 24 hours, got %+v", analytics)
+	}
+	if len(analytics.IPs) != 2 || analytics.IPs[0].Value != "1.1.1.1" || analytics.IPs[0].Count != 3 {
+		t.Fatalf("unexpected top IPs: %+v", analytics.IPs)
+	}
+	if analytics.URIs[0].Value != "/index.html" || analytics.URIs[0].Count != 4 {
+		t.Fatalf("query string should be stripped from URIs: %+v", analytics.URIs)
+	}
+	if analytics.StatusCodes[0].Value != "200" || analytics.StatusCodes[1].Value != "404" {
+		t.Fatalf("unexpected status codes: %+v", analytics.StatusCodes)
+	}
+	if analytics.UserAgents[0].Value != "curl/8.0" || analytics.UserAgents[1].Value != "-" {
+		t.Fatalf("unexpected user agents: %+v", analytics.UserAgents)
+	}
+
+	older, err := svc.Analytics("a.example.com", now.Add(-48*time.Hour), now.Add(-24*time.Hour), now, 0)
+	if err != nil || older.Requests != 1 || older.StatusCodes[0].Value != "500" {
+		t.Fatalf("unexpected analytics for custom range: %+v, %v", older, err)
+	}
+	if _, err := svc.Analytics("a.example.com", time.Time{}, time.Time{}, now, siteAnalyticsMaxLimit+1); err == nil {
+		t.Fatal("expected limit error")
+	}
+
+	// 已结束的小时只保留排名靠前的取值
+	hour := &siteStatsHour{}
+	for i := 0; i < siteAnalyticsKeep+20; i++ {
+		hour.count(fmt.Sprintf("10.0.0.%d", i), "GET / HTTP/1.1", "200", "curl")
+	}
+	hour.count("10.0.0.1", "GET / HTTP/1.1", "200", "curl")
+	hour.trimTop()
+	if len(hour.Top[analyticsIP]) != siteAnalyticsKeep || hour.Top[analyticsIP]["10.0.0.1"] != 2 {
+		t.Fatalf("unexpected trimmed values: %d", len(hour.Top[analyticsIP]))
+	}
+}
+
+func TestSiteTrafficBreakdown(t *testing.T) {
+	dir := t.TempDir()
+	svc := NewSiteStatsService(nil)
+	svc.dir = dir
+
+	at := func(day, hour int) int64 { return time.Date(2026, 3, day, hour, 0, 0, 0, time.Local).Unix() }
+	now := time.Date(2026, 3, 10, 12, 30, 0, 0, time.Local)
+	// 小时数据从 3 月 3 日中午开始，3 月 3 日及之前按天汇总
+	svc.states["a.example.com"] = &siteStatsState{
+		Hours: []*siteStatsHour{
+			{Start: at(3, 13), Requests: 3, Bytes: 30},
+			{Start: at(4, 1), Requests: 4, Bytes: 40},
+			{Start: at(10, 11), Requests: 5, Bytes: 50},
+		},
+		Days: []model.SiteStatsPoint{
+			{StartUnixTime: at(1, 0), Requests: 1, Bytes: 100},
+			{StartUnixTime: at(2, 0), Requests: 2, Bytes: 200},
+			{StartUnixTime: at(3, 0), Requests: 3, Bytes: 300},
+			{StartUnixTime: at(4, 0), Requests: 4, Bytes: 400},
+		},
+	}
+	os.WriteFile(filepath.Join(dir, "b.example.com.json"), []byte(fmt.Sprintf(`{"hours":[{"start":%d,"requests":1,"bytes":10}]}`, at(10, 12))), 0600)
+
+	cycle := TrafficCycle{UsedBytes: 1000, LimitBytes: 2000, CycleStart: time.Date(2026, 3, 2, 8, 0, 0, 0, time.Local)}
+	breakdown, err := svc.TrafficBreakdown(cycle, now)
+	if err != nil {
+		t.Fatalf("breakdown: %v", err)
+	}
+	if len(breakdown.Sites) != 2 || breakdown.Sites[0].Domain != "a.example.com" || breakdown.Sites[0].Bytes != 590 ||
+		breakdown.Sites[0].Requests != 14 || breakdown.Sites[0].Percent != 59 {
+		t.Fatalf("unexpected breakdown: %+v", breakdown.Sites)
+	}
+	if breakdown.SiteBytes != 600 || breakdown.OtherBytes != 400 {
+		t.Fatalf("unexpected totals: %+v", breakdown)
+	}
+
+	cycle.CycleStart = time.Date(2026, 3, 10, 10, 30, 0, 0, time.Local)
+	breakdown, _ = svc.TrafficBreakdown(cycle, now)
+	if len(breakdown.Sites) != 2 || breakdown.Sites[0].Bytes != 50 || breakdown.Sites[1].Bytes != 10 {
+		t.Fatalf("unexpected breakdown for recent cycle: %+v", breakdown.Sites)
+	}
+}
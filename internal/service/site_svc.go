@@ -1,12 +1,17 @@
 package service
 
 import (
+	"bytes"
 	"embed"
 	"fmt"
 	"nginx-mgr/internal/model"
+	"nginx-mgr/internal/nginxconf"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 )
 
@@ -14,59 +19,251 @@ import (
 var templateFS embed.FS
 
 type SiteService struct {
-	ConfDir string
+	ConfDir     string
+	WebRoot     string
+	defaultsSvc *SiteDefaultsService
+	// locks 按域名串行化站点配置的读改写，站点接口与健康检查的自动摘除共用
+	locks sync.Map
 }
 
-func NewSiteService() *SiteService {
+func NewSiteService(defaultsSvc *SiteDefaultsService) *SiteService {
+	if defaultsSvc == nil {
+		defaultsSvc = NewSiteDefaultsService()
+	}
 	return &SiteService{
-		ConfDir: model.NginxConfDir,
+		ConfDir:     model.NginxConfDir,
+		WebRoot:     "/var/www/html",
+		defaultsSvc: defaultsSvc,
 	}
 }
 
+// LockSite 锁定站点配置直到调用返回的函数，读取现有配置到写入并重载期间应持有该锁
+func (s *SiteService) LockSite(domain string) func() {
+	value, _ := s.locks.LoadOrStore(domain, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
 func (s *SiteService) CreateSite(config model.SiteConfig) error {
+	content, err := s.renderSite(&config)
+	if err != nil {
+		return err
+	}
+	if config.LogFormat == timingLogFormat || config.LogFormat == jsonLogFormat {
+		if err := ensureManagedLogFormats(s.ConfDir); err != nil {
+			return err
+		}
+	}
+	if config.Type == "static" || config.Type == "uwsgi" || config.Type == "fastcgi" {
+		// 创建站点根目录
+		os.MkdirAll(filepath.Join(s.WebRoot, config.Domain), 0755)
+	}
+
+	availablePath := s.availablePath(config.Domain)
+	if err := os.WriteFile(availablePath, []byte(content), 0644); err != nil {
+		return err
+	}
+
+	// 默认启用站点
+	enabledPath := s.enabledPath(config.Domain)
+	// 如果已存在则先删除
+	os.Remove(enabledPath)
+	return os.Symlink(availablePath, enabledPath)
+}
+
+// renderSite 补全默认值并渲染站点模板，返回生成的配置文本
+func (s *SiteService) renderSite(config *model.SiteConfig) (string, error) {
+	applied, err := s.defaultsSvc.Apply(*config)
+	if err != nil {
+		return "", err
+	}
+	*config = applied
+	if err := validateSiteOptions(config); err != nil {
+		return "", err
+	}
+	// 未加载 brotli 模块时 brotli 指令会让 nginx -t 失败
+	if (config.Compression == "both" || config.Compression == "brotli") && !brotliAvailable(s.ConfDir) {
+		if config.Compression == "brotli" {
+			return "", fmt.Errorf("%w: 当前 Nginx 未加载 brotli 模块，请改用 gzip", ErrInvalidSiteOption)
+		}
+		config.Compression = "gzip"
+	}
+	if config.Upstream != "" {
+		if config.Type != "proxy" && config.Type != "lb" {
+			return "", fmt.Errorf("%w: 仅反向代理与负载均衡站点可引用 upstream", ErrInvalidSiteOption)
+		}
+		if !upstreamNamePattern.MatchString(config.Upstream) {
+			return "", fmt.Errorf("%w: upstream 名称不合法 %s", ErrInvalidSiteOption, config.Upstream)
+		}
+		if _, err := os.Stat(upstreamFilePath(s.ConfDir, config.Upstream)); err != nil {
+			return "", fmt.Errorf("%w: upstream %s 不存在", ErrInvalidSiteOption, config.Upstream)
+		}
+	}
+
+	if config.BlockBots {
+		if _, err := os.Stat(filepath.Join(s.ConfDir, "bot_block.conf")); err != nil {
+			return "", fmt.Errorf("%w: 全局 UA 拦截名单尚未生成，请先保存一次全局名单", ErrInvalidSiteOption)
+		}
+	}
+
 	var tmplName string
 	switch config.Type {
 	case "proxy":
 		tmplName = "proxy.tmpl"
 	case "static":
 		tmplName = "static.tmpl"
-		// 创建静态目录
-		os.MkdirAll(filepath.Join("/var/www/html", config.Domain), 0755)
 	case "lb":
 		tmplName = "lb.tmpl"
 	case "redirect":
 		tmplName = "redirect.tmpl"
+	case "uwsgi", "fastcgi":
+		config.AppTarget = strings.TrimSpace(config.AppTarget)
+		if config.AppTarget == "" || strings.ContainsAny(config.AppTarget, " \t;{}\"'") {
+			return "", fmt.Errorf("%w: 应用后端地址不合法 %q", ErrInvalidSiteOption, config.AppTarget)
+		}
+		tmplName = config.Type + ".tmpl"
 	default:
-		return fmt.Errorf("不支持的站点类型: %s", config.Type)
+		return "", fmt.Errorf("不支持的站点类型: %s", config.Type)
 	}
 
 	funcMap := template.FuncMap{
 		"replace": func(old, new, src string) string {
 			return strings.ReplaceAll(src, old, new)
 		},
+		"join": strings.Join,
 	}
 
-	tmpl, err := template.New(tmplName).Funcs(funcMap).ParseFS(templateFS, "templates/"+tmplName)
+	tmpl, err := template.New(tmplName).Funcs(funcMap).ParseFS(templateFS, "templates/"+tmplName, "templates/partials.tmpl")
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	availablePath := s.availablePath(config.Domain)
-	f, err := os.Create(availablePath)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, config); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// DroppedDirectives 对比现有配置与按 config 重新生成的配置，
+// 返回手工添加且在结构化更新后会丢失的指令
+func (s *SiteService) DroppedDirectives(domain string, config model.SiteConfig) ([]string, error) {
+	current, err := s.ReadSiteRaw(domain)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	oldTree, err := nginxconf.Parse(current)
+	if err != nil {
+		return nil, fmt.Errorf("解析现有配置失败: %w", err)
+	}
+	rendered, err := s.renderSite(&config)
+	if err != nil {
+		return nil, err
+	}
+	newTree, err := nginxconf.Parse(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("解析生成的配置失败: %w", err)
 	}
-	defer f.Close()
 
-	if err := tmpl.Execute(f, config); err != nil {
-		return err
+	kept := make(map[string]bool)
+	for _, key := range directiveKeys(newTree) {
+		kept[key] = true
+	}
+	var dropped []string
+	seen := make(map[string]bool)
+	for _, key := range directiveKeys(oldTree) {
+		if kept[key] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		dropped = append(dropped, key)
 	}
+	return dropped, nil
+}
 
-	// 默认启用站点
-	enabledPath := s.enabledPath(config.Domain)
-	// 如果已存在则先删除
-	os.Remove(enabledPath)
-	return os.Symlink(availablePath, enabledPath)
+// managedDirectives 由 SiteConfig 字段生成的指令，结构化更新时允许增删
+var managedDirectives = map[string]bool{
+	"gzip":                      true,
+	"gzip_min_length":           true,
+	"gzip_comp_level":           true,
+	"gzip_types":                true,
+	"brotli":                    true,
+	"brotli_comp_level":         true,
+	"brotli_types":              true,
+	"ssl_protocols":             true,
+	"ssl_ciphers":               true,
+	"ssl_prefer_server_ciphers": true,
+	"limit_rate":                true,
+	"limit_rate_after":          true,
+	"proxy_set_header":          true,
+	"least_conn":                true,
+	"ip_hash":                   true,
+	"hash":                      true,
+	"sticky":                    true,
+	"valid_referers":            true,
+}
+
+// isManagedBlock 判断指令是否属于 RedirectRules 或防盗链生成的片段
+func isManagedBlock(d *nginxconf.Directive) bool {
+	if isRedirectRule(d) {
+		return true
+	}
+	switch d.Name {
+	case "map":
+		return strings.HasPrefix(d.Arg(1), "$blocked_agent_")
+	case "set":
+		return d.Arg(0) == "$hotlink_check"
+	case "if":
+		cond := strings.Join(d.Args, " ")
+		if strings.Contains(cond, "$hotlink_check") || strings.Contains(cond, "$blocked_agent") {
+			return true
+		}
+		set := nginxconf.First(d.Block, "set")
+		return len(d.Block) == 1 && set.Arg(0) == "$hotlink_check"
+	}
+	return false
+}
+
+// directiveKeys 以“上下文路径 + 指令名”标识每条指令，块指令的路径包含其参数
+func directiveKeys(tree []*nginxconf.Directive) []string {
+	var keys []string
+	nginxconf.Walk(tree, func(d *nginxconf.Directive, parents []*nginxconf.Directive) {
+		if d.Name == "#" || (!d.IsBlock && managedDirectives[d.Name]) || isManagedBlock(d) {
+			return
+		}
+		for _, parent := range parents {
+			if isManagedBlock(parent) {
+				return
+			}
+		}
+		parts := make([]string, 0, len(parents)+1)
+		for _, parent := range parents {
+			parts = append(parts, blockLabel(parent))
+		}
+		if d.IsBlock {
+			parts = append(parts, blockLabel(d))
+		} else {
+			parts = append(parts, d.Name)
+		}
+		keys = append(keys, strings.Join(parts, " > "))
+	})
+	return keys
+}
+
+func blockLabel(d *nginxconf.Directive) string {
+	if d.Name == "server" {
+		if listen := nginxconf.First(d.Block, "listen"); listen != nil {
+			return fmt.Sprintf("server[%s]", strings.Join(listen.Args, " "))
+		}
+	}
+	if d.Name == "upstream" {
+		return "upstream"
+	}
+	if len(d.Args) == 0 {
+		return d.Name
+	}
+	return d.Name + " " + strings.Join(d.Args, " ")
 }
 
 func (s *SiteService) DeleteSite(domain string) error {
@@ -83,41 +280,81 @@ func (s *SiteService) GetSite(domain string) (*model.SiteConfig, error) {
 		return nil, err
 	}
 
+	tree, err := nginxconf.Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("解析站点配置失败: %w", err)
+	}
+
 	config := &model.SiteConfig{Domain: domain}
-	strContent := content
-	if t := extractSiteType(strContent); t != "" {
+	parseSiteOptions(tree, config)
+	parseRedirectRules(tree, config)
+	parseHotlink(tree, config)
+	parseAgentBlocks(tree, config)
+	if t := extractSiteType(tree); t != "" {
 		config.Type = t
 		switch t {
 		case "lb":
-			parseLoadBalancers(strContent, config)
+			parseLoadBalancers(tree, config)
+			s.parseUpstreamRef(tree, config)
 		case "proxy":
-			parseProxyBackend(strContent, config)
+			parseProxyBackend(tree, config)
+			s.parseUpstreamRef(tree, config)
 		case "redirect":
-			parseRedirectTarget(strContent, config)
+			parseRedirectTarget(tree, config)
+		case "uwsgi", "fastcgi":
+			parseAppTarget(tree, config)
 		default:
 			config.Type = "static"
 		}
+		s.markRemovedProxyHeaders(config)
 		return config, nil
 	}
 
-	if strings.Contains(strContent, "proxy_pass") {
-		if strings.Contains(strContent, "upstream") {
-			config.Type = "lb"
-			parseLoadBalancers(strContent, config)
-		} else {
-			config.Type = "proxy"
-			parseProxyBackend(strContent, config)
-		}
-	} else if strings.Contains(strContent, "return 301") {
+	proxyPass := findDirectives(tree, "proxy_pass")
+	switch {
+	case len(proxyPass) > 0 && len(nginxconf.Find(tree, "upstream")) > 0:
+		config.Type = "lb"
+		parseLoadBalancers(tree, config)
+	case len(proxyPass) > 0:
+		config.Type = "proxy"
+		parseProxyBackend(tree, config)
+	case len(findDirectives(tree, "uwsgi_pass")) > 0:
+		config.Type = "uwsgi"
+		parseAppTarget(tree, config)
+	case len(findDirectives(tree, "fastcgi_pass")) > 0:
+		config.Type = "fastcgi"
+		parseAppTarget(tree, config)
+	case findReturn(tree, "301") != nil:
 		config.Type = "redirect"
-		parseRedirectTarget(strContent, config)
-	} else {
+		parseRedirectTarget(tree, config)
+	default:
 		config.Type = "static"
 	}
 
+	s.markRemovedProxyHeaders(config)
 	return config, nil
 }
 
+// markRemovedProxyHeaders 反向代理与负载均衡站点中没有的默认请求头以空值返回，再次保存时不会被默认值补回
+func (s *SiteService) markRemovedProxyHeaders(config *model.SiteConfig) {
+	if s.defaultsSvc == nil || (config.Type != "proxy" && config.Type != "lb") {
+		return
+	}
+	defaults, err := s.defaultsSvc.Get()
+	if err != nil {
+		return
+	}
+	for name := range defaults.ProxyHeaders {
+		if _, ok := lookupHeader(config.ProxyHeaders, name); ok {
+			continue
+		}
+		if config.ProxyHeaders == nil {
+			config.ProxyHeaders = make(map[string]string)
+		}
+		config.ProxyHeaders[name] = ""
+	}
+}
+
 func (s *SiteService) ListSites() ([]string, error) {
 	files, err := os.ReadDir(filepath.Join(s.ConfDir, "sites-available"))
 	if err != nil {
@@ -179,63 +416,551 @@ func (s *SiteService) ListSiteConfigs() ([]model.SiteConfig, error) {
 	return configs, nil
 }
 
-func extractSiteType(content string) string {
-	lines := strings.Split(content, "\n")
-	for _, line := range lines {
-		trim := strings.TrimSpace(line)
-		if strings.HasPrefix(trim, "#") && strings.Contains(trim, "site_type:") {
-			parts := strings.SplitN(trim, "site_type:", 2)
-			if len(parts) == 2 {
-				return strings.TrimSpace(parts[1])
-			}
+func extractSiteType(tree []*nginxconf.Directive) string {
+	for _, d := range tree {
+		if d.Name == "#" && strings.HasPrefix(d.Comment, "site_type:") {
+			return strings.TrimSpace(strings.TrimPrefix(d.Comment, "site_type:"))
 		}
 	}
 	return ""
 }
 
-func parseLoadBalancers(content string, config *model.SiteConfig) {
-	lines := strings.Split(content, "\n")
+// findDirectives 递归查找所有名称匹配的指令
+func findDirectives(tree []*nginxconf.Directive, name string) []*nginxconf.Directive {
+	var found []*nginxconf.Directive
+	nginxconf.Walk(tree, func(d *nginxconf.Directive, _ []*nginxconf.Directive) {
+		if d.Name == name {
+			found = append(found, d)
+		}
+	})
+	return found
+}
+
+// mainLocation 返回 HTTPS server 中的 location /，找不到时退回任意 location /
+func mainLocation(tree []*nginxconf.Directive) *nginxconf.Directive {
+	var fallback *nginxconf.Directive
+	for _, server := range nginxconf.Find(tree, "server") {
+		for _, loc := range nginxconf.Find(server.Block, "location") {
+			if len(loc.Args) != 1 || loc.Args[0] != "/" {
+				continue
+			}
+			if isSSLServer(server) {
+				return loc
+			}
+			if fallback == nil {
+				fallback = loc
+			}
+		}
+	}
+	return fallback
+}
+
+func isSSLServer(server *nginxconf.Directive) bool {
+	for _, listen := range nginxconf.Find(server.Block, "listen") {
+		if strings.HasSuffix(listen.Arg(0), "443") {
+			return true
+		}
+		for _, arg := range listen.Args[1:] {
+			if arg == "ssl" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findReturn 查找整站跳转的 return 指令，忽略 HTTPS 跳转与路径重定向规则
+func findReturn(tree []*nginxconf.Directive, code string) *nginxconf.Directive {
+	var found *nginxconf.Directive
+	nginxconf.Walk(tree, func(d *nginxconf.Directive, parents []*nginxconf.Directive) {
+		if found != nil || d.Name != "return" || d.Arg(0) != code || len(d.Args) < 2 {
+			return
+		}
+		if strings.HasPrefix(d.Arg(1), "https://$host") {
+			return
+		}
+		if len(parents) > 0 && isRedirectRule(parents[len(parents)-1]) {
+			return
+		}
+		found = d
+	})
+	return found
+}
+
+func parseLoadBalancers(tree []*nginxconf.Directive, config *model.SiteConfig) {
 	config.Backends = config.Backends[:0]
-	for _, line := range lines {
-		trim := strings.TrimSpace(line)
-		if strings.HasPrefix(trim, "server ") && strings.HasSuffix(trim, ";") {
-			addr := strings.TrimSuffix(strings.TrimPrefix(trim, "server "), ";")
-			if addr != "" {
-				config.Backends = append(config.Backends, addr)
+	for _, upstream := range nginxconf.Find(tree, "upstream") {
+		for _, d := range upstream.Block {
+			switch d.Name {
+			case "least_conn":
+				config.LBMethod = d.Name
+			case "ip_hash":
+				config.LBMethod = d.Name
+				config.Sticky = "ip_hash"
+			case "sticky":
+				config.Sticky = "cookie"
+				for _, arg := range d.Args {
+					if name, ok := strings.CutPrefix(arg, "name="); ok {
+						config.StickyCookie = name
+					}
+				}
+			case "hash":
+				config.LBMethod = "hash"
+				config.LBHashKey = d.Arg(0)
+			}
+		}
+		for _, server := range nginxconf.Find(upstream.Block, "server") {
+			backend, err := model.ParseBackend(server.Args)
+			if err != nil {
+				// 无法识别的参数（如 resolve、slow_start）仅保留地址
+				backend = model.Backend{Address: server.Arg(0)}
+			}
+			if backend.Address != "" {
+				config.Backends = append(config.Backends, backend)
 			}
 		}
 	}
 }
 
-func parseProxyBackend(content string, config *model.SiteConfig) {
-	idx := strings.Index(content, "proxy_pass http://")
-	if idx == -1 {
+func parseProxyBackend(tree []*nginxconf.Directive, config *model.SiteConfig) {
+	var proxyPass *nginxconf.Directive
+	if loc := mainLocation(tree); loc != nil {
+		proxyPass = nginxconf.First(loc.Block, "proxy_pass")
+	}
+	if proxyPass == nil {
+		if all := findDirectives(tree, "proxy_pass"); len(all) > 0 {
+			proxyPass = all[0]
+		}
+	}
+	if proxyPass == nil {
 		return
 	}
-	part := content[idx+len("proxy_pass http://"):]
-	endIdx := strings.Index(part, ";")
-	if endIdx == -1 {
+	addr := proxyPass.Arg(0)
+	addr = strings.TrimPrefix(strings.TrimPrefix(addr, "http://"), "https://")
+	if idx := strings.Index(addr, "/"); idx != -1 {
+		addr = addr[:idx]
+	}
+	host, port := addr, ""
+	if idx := strings.LastIndex(addr, ":"); idx != -1 && !strings.HasSuffix(addr, "]") {
+		host, port = addr[:idx], addr[idx+1:]
+	}
+	config.BackendIP = strings.Trim(host, "[]")
+	if port != "" {
+		if value, err := strconv.Atoi(port); err == nil {
+			config.BackendPort = value
+		}
+	}
+}
+
+// parseUpstreamRef 识别 proxy_pass 指向共享 upstream 的站点
+func (s *SiteService) parseUpstreamRef(tree []*nginxconf.Directive, config *model.SiteConfig) {
+	loc := mainLocation(tree)
+	if loc == nil {
+		return
+	}
+	target := strings.TrimPrefix(nginxconf.First(loc.Block, "proxy_pass").Arg(0), "http://")
+	if target == "" || strings.ContainsAny(target, ":/$") {
+		return
+	}
+	for _, upstream := range nginxconf.Find(tree, "upstream") {
+		if upstream.Arg(0) == target {
+			return
+		}
+	}
+	if _, err := os.Stat(upstreamFilePath(s.ConfDir, target)); err != nil {
 		return
 	}
-	addr := part[:endIdx]
-	parts := strings.Split(addr, ":")
-	if len(parts) > 0 {
-		config.BackendIP = parts[0]
+	config.Upstream = target
+	config.BackendIP = ""
+	config.BackendPort = 0
+}
+
+// isRedirectRule 判断 location 是否为 RedirectRules 生成的规则：带修饰符且仅包含一条 3xx return
+func isRedirectRule(d *nginxconf.Directive) bool {
+	if d.Name != "location" || len(d.Args) != 2 || len(d.Block) != 1 {
+		return false
+	}
+	if d.Args[0] != "=" && d.Args[0] != "^~" && d.Args[0] != "~" {
+		return false
+	}
+	ret := d.Block[0]
+	return ret.Name == "return" && len(ret.Args) == 2 && redirectCodes[ret.Args[0]]
+}
+
+// parseRedirectRules 从 HTTPS server 中还原路径重定向规则
+func parseRedirectRules(tree []*nginxconf.Directive, config *model.SiteConfig) {
+	for _, server := range nginxconf.Find(tree, "server") {
+		if !isSSLServer(server) {
+			continue
+		}
+		for _, loc := range nginxconf.Find(server.Block, "location") {
+			if !isRedirectRule(loc) {
+				continue
+			}
+			rule, err := model.ParseRedirectRule([]string{loc.Args[0], loc.Args[1], loc.Block[0].Arg(1), loc.Block[0].Arg(0)})
+			if err == nil {
+				config.RedirectRules = append(config.RedirectRules, rule)
+			}
+		}
+		return
 	}
-	if len(parts) > 1 {
-		fmt.Sscanf(parts[1], "%d", &config.BackendPort)
+}
+
+// parseHotlink 从 HTTPS server 的 valid_referers 与扩展名判断还原防盗链设置
+func parseHotlink(tree []*nginxconf.Directive, config *model.SiteConfig) {
+	for _, server := range nginxconf.Find(tree, "server") {
+		if !isSSLServer(server) {
+			continue
+		}
+		referers := nginxconf.First(server.Block, "valid_referers")
+		if referers == nil {
+			return
+		}
+		hotlink := &model.HotlinkConfig{Enabled: true, BlockEmpty: true, AllowedReferers: []string{}}
+		for _, arg := range referers.Args {
+			switch arg {
+			case "none", "blocked":
+				hotlink.BlockEmpty = false
+			case "server_names":
+			default:
+				hotlink.AllowedReferers = append(hotlink.AllowedReferers, arg)
+			}
+		}
+		for _, cond := range nginxconf.Find(server.Block, "if") {
+			if !isManagedBlock(cond) || len(cond.Args) < 3 {
+				continue
+			}
+			pattern := strings.TrimSuffix(strings.TrimPrefix(cond.Args[2], `\.(`), ")$")
+			if pattern != cond.Args[2] {
+				hotlink.Extensions = strings.Split(pattern, "|")
+			}
+		}
+		config.Hotlink = hotlink
+		return
 	}
 }
 
-func parseRedirectTarget(content string, config *model.SiteConfig) {
-	idx := strings.Index(content, "return 301 ")
-	if idx == -1 {
+// parseAgentBlocks 还原站点级 UA 拦截名单与全局名单开关
+func parseAgentBlocks(tree []*nginxconf.Directive, config *model.SiteConfig) {
+	for _, m := range nginxconf.Find(tree, "map") {
+		if !isManagedBlock(m) {
+			continue
+		}
+		for _, entry := range m.Block {
+			if agent, ok := strings.CutPrefix(entry.Name, "~*"); ok {
+				config.BlockedAgents = append(config.BlockedAgents, agent)
+			}
+		}
+	}
+	for _, server := range nginxconf.Find(tree, "server") {
+		if !isSSLServer(server) {
+			continue
+		}
+		for _, cond := range nginxconf.Find(server.Block, "if") {
+			if strings.Join(cond.Args, " ") == "($blocked_agent)" {
+				config.BlockBots = true
+			}
+		}
 		return
 	}
-	part := content[idx+len("return 301 "):]
-	endIdx := strings.Index(part, ";")
-	if endIdx == -1 {
+}
+
+func parseRedirectTarget(tree []*nginxconf.Directive, config *model.SiteConfig) {
+	ret := findReturn(tree, "301")
+	if ret == nil {
 		return
 	}
-	config.TargetURL = part[:endIdx]
+	config.TargetURL = strings.TrimSuffix(ret.Arg(1), "$request_uri")
+}
+
+// parseAppTarget 读取 uwsgi_pass / fastcgi_pass 的目标地址
+func parseAppTarget(tree []*nginxconf.Directive, config *model.SiteConfig) {
+	if all := findDirectives(tree, config.Type+"_pass"); len(all) > 0 {
+		config.AppTarget = all[0].Arg(0)
+	}
+}
+
+var builtinProxyHeaders = map[string]bool{
+	"host":              true,
+	"x-real-ip":         true,
+	"x-forwarded-for":   true,
+	"x-forwarded-proto": true,
+	"x-forwarded-port":  true,
+	"connection":        true,
+	"upgrade":           true,
+	"accept-encoding":   true,
+}
+
+func validateSiteOptions(config *model.SiteConfig) error {
+	headers, err := sanitizeProxyHeaders(config.ProxyHeaders)
+	if err != nil {
+		return err
+	}
+	config.ProxyHeaders = headers
+
+	config.TLSPolicy = strings.ToLower(strings.TrimSpace(config.TLSPolicy))
+	if config.TLSPolicy != "" && !tlsPolicies[config.TLSPolicy] {
+		return fmt.Errorf("%w: 不支持的 TLS 策略 %s", ErrInvalidSiteOption, config.TLSPolicy)
+	}
+	config.Compression = strings.ToLower(strings.TrimSpace(config.Compression))
+	if config.Compression != "" && !compressionModes[config.Compression] {
+		return fmt.Errorf("%w: 不支持的压缩方式 %s", ErrInvalidSiteOption, config.Compression)
+	}
+	config.LogFormat = strings.TrimSpace(config.LogFormat)
+	if config.LogFormat != "" && !logFormatPattern.MatchString(config.LogFormat) {
+		return fmt.Errorf("%w: 日志格式名称不合法 %s", ErrInvalidSiteOption, config.LogFormat)
+	}
+	config.LimitRate = strings.TrimSpace(config.LimitRate)
+	if config.LimitRate == "0" {
+		config.LimitRate = ""
+	}
+	if config.LimitRate != "" && !sizePattern.MatchString(config.LimitRate) {
+		return fmt.Errorf("%w: 限速值格式不正确 %s", ErrInvalidSiteOption, config.LimitRate)
+	}
+	for i := range config.Backends {
+		backend := &config.Backends[i]
+		backend.Address = strings.TrimSpace(backend.Address)
+		if backend.Address == "" || strings.ContainsAny(backend.Address, " ;{}") {
+			return fmt.Errorf("%w: 节点地址不合法 %q", ErrInvalidSiteOption, backend.Address)
+		}
+		if backend.Weight < 0 || backend.MaxFails < 0 {
+			return fmt.Errorf("%w: 节点 %s 的权重或失败次数不能为负数", ErrInvalidSiteOption, backend.Address)
+		}
+		backend.FailTimeout = strings.TrimSpace(backend.FailTimeout)
+		if backend.FailTimeout != "" && !durationPattern.MatchString(backend.FailTimeout) {
+			return fmt.Errorf("%w: 节点 %s 的 fail_timeout 格式不正确", ErrInvalidSiteOption, backend.Address)
+		}
+	}
+	config.LBMethod = strings.ToLower(strings.TrimSpace(config.LBMethod))
+	config.LBHashKey = strings.TrimSpace(config.LBHashKey)
+	config.Sticky = strings.ToLower(strings.TrimSpace(config.Sticky))
+	config.StickyCookie = strings.TrimSpace(config.StickyCookie)
+	switch config.Sticky {
+	case "":
+		config.StickyCookie = ""
+	case "ip_hash":
+		// 基于客户端 IP 的会话保持即 ip_hash 算法
+		if config.LBMethod != "" && config.LBMethod != "round_robin" && config.LBMethod != "ip_hash" {
+			return fmt.Errorf("%w: 会话保持 ip_hash 与负载均衡算法 %s 冲突", ErrInvalidSiteOption, config.LBMethod)
+		}
+		config.LBMethod = "ip_hash"
+		config.StickyCookie = ""
+	case "cookie":
+		if config.StickyCookie == "" {
+			config.StickyCookie = "route"
+		}
+		if !logFormatPattern.MatchString(config.StickyCookie) {
+			return fmt.Errorf("%w: Cookie 名称不合法 %s", ErrInvalidSiteOption, config.StickyCookie)
+		}
+		if config.LBMethod != "" && config.LBMethod != "round_robin" {
+			return fmt.Errorf("%w: Cookie 会话保持仅支持轮询算法", ErrInvalidSiteOption)
+		}
+		if config.Type == "lb" && !nginxHasModule("sticky") {
+			return fmt.Errorf("%w: 当前 Nginx 未编译 sticky 模块，请改用 ip_hash", ErrInvalidSiteOption)
+		}
+	default:
+		return fmt.Errorf("%w: 不支持的会话保持方式 %s", ErrInvalidSiteOption, config.Sticky)
+	}
+	switch config.LBMethod {
+	case "", "round_robin":
+		config.LBMethod = ""
+		config.LBHashKey = ""
+	case "least_conn", "ip_hash":
+		config.LBHashKey = ""
+	case "hash":
+		if config.LBHashKey == "" || strings.ContainsAny(config.LBHashKey, " ;{}\"'") {
+			return fmt.Errorf("%w: hash 算法需要合法的 key，例如 $request_uri", ErrInvalidSiteOption)
+		}
+	default:
+		return fmt.Errorf("%w: 不支持的负载均衡算法 %s", ErrInvalidSiteOption, config.LBMethod)
+	}
+	if config.LBMethod == "ip_hash" || config.LBMethod == "hash" {
+		for _, backend := range config.Backends {
+			if backend.Backup {
+				return fmt.Errorf("%w: %s 算法不支持 backup 节点", ErrInvalidSiteOption, config.LBMethod)
+			}
+		}
+	}
+	config.LimitRateAfter = strings.TrimSpace(config.LimitRateAfter)
+	if config.LimitRateAfter != "" && !sizePattern.MatchString(config.LimitRateAfter) {
+		return fmt.Errorf("%w: 限速起始值格式不正确 %s", ErrInvalidSiteOption, config.LimitRateAfter)
+	}
+	if err := validateHotlink(config); err != nil {
+		return err
+	}
+	agents, err := sanitizeUserAgents(config.BlockedAgents)
+	if err != nil {
+		return err
+	}
+	config.BlockedAgents = agents
+	if len(agents) == 0 {
+		config.BlockedAgents = nil
+	}
+	return validateRedirectRules(config)
+}
+
+var (
+	defaultHotlinkExtensions = []string{"jpg", "jpeg", "png", "gif", "webp", "bmp", "mp4", "webm", "mov", "m4v", "flv"}
+	extensionPattern         = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+)
+
+func validateHotlink(config *model.SiteConfig) error {
+	if config.Hotlink == nil {
+		return nil
+	}
+	if !config.Hotlink.Enabled {
+		config.Hotlink = nil
+		return nil
+	}
+	hotlink := *config.Hotlink
+	referers := make([]string, 0, len(hotlink.AllowedReferers))
+	for _, referer := range hotlink.AllowedReferers {
+		referer = strings.TrimSpace(referer)
+		if referer == "" {
+			continue
+		}
+		if strings.ContainsAny(referer, " \t\r\n;{}\"'") {
+			return fmt.Errorf("%w: 防盗链白名单不合法 %q", ErrInvalidSiteOption, referer)
+		}
+		referers = append(referers, referer)
+	}
+	hotlink.AllowedReferers = referers
+
+	extensions := make([]string, 0, len(hotlink.Extensions))
+	for _, ext := range hotlink.Extensions {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext == "" {
+			continue
+		}
+		if !extensionPattern.MatchString(ext) {
+			return fmt.Errorf("%w: 防盗链扩展名不合法 %q", ErrInvalidSiteOption, ext)
+		}
+		extensions = append(extensions, ext)
+	}
+	if len(extensions) == 0 {
+		extensions = append(extensions, defaultHotlinkExtensions...)
+	}
+	hotlink.Extensions = extensions
+	config.Hotlink = &hotlink
+	return nil
+}
+
+var redirectCodes = map[string]bool{
+	"301": true,
+	"302": true,
+	"307": true,
+	"308": true,
+}
+
+func validateRedirectRules(config *model.SiteConfig) error {
+	seen := make(map[string]bool, len(config.RedirectRules))
+	for i := range config.RedirectRules {
+		rule := &config.RedirectRules[i]
+		rule.Match = strings.ToLower(strings.TrimSpace(rule.Match))
+		rule.Path = strings.TrimSpace(rule.Path)
+		rule.Target = strings.TrimSpace(rule.Target)
+		if rule.Match == "" {
+			rule.Match = "exact"
+		}
+		if rule.Code == 0 {
+			rule.Code = 301
+		}
+		switch rule.Match {
+		case "exact", "prefix":
+			if !strings.HasPrefix(rule.Path, "/") {
+				return fmt.Errorf("%w: 重定向路径必须以 / 开头 %q", ErrInvalidSiteOption, rule.Path)
+			}
+		case "regex":
+			if rule.Path == "" {
+				return fmt.Errorf("%w: 重定向正则不能为空", ErrInvalidSiteOption)
+			}
+		default:
+			return fmt.Errorf("%w: 不支持的重定向匹配方式 %s", ErrInvalidSiteOption, rule.Match)
+		}
+		if strings.ContainsAny(rule.Path, " \t\r\n;\"'") || (rule.Match != "regex" && strings.ContainsAny(rule.Path, "{}")) {
+			return fmt.Errorf("%w: 重定向路径不合法 %q", ErrInvalidSiteOption, rule.Path)
+		}
+		if rule.Target == "" || strings.ContainsAny(rule.Target, " \t\r\n;{}\"'") {
+			return fmt.Errorf("%w: 重定向目标不合法 %q", ErrInvalidSiteOption, rule.Target)
+		}
+		if !redirectCodes[strconv.Itoa(rule.Code)] {
+			return fmt.Errorf("%w: 不支持的重定向状态码 %d", ErrInvalidSiteOption, rule.Code)
+		}
+		key := rule.Match + " " + rule.Path
+		if seen[key] {
+			return fmt.Errorf("%w: 重定向路径重复 %s", ErrInvalidSiteOption, rule.Path)
+		}
+		seen[key] = true
+	}
+	if config.Type == "redirect" && strings.TrimSpace(config.TargetURL) == "" && len(config.RedirectRules) == 0 {
+		return fmt.Errorf("%w: 重定向站点需要目标 URL 或至少一条重定向规则", ErrInvalidSiteOption)
+	}
+	return nil
+}
+
+// parseSiteOptions 从已生成的配置中还原 TLS 策略、压缩方式、日志格式、限速与自定义请求头
+func parseSiteOptions(tree []*nginxconf.Directive, config *model.SiteConfig) {
+	var scope []*nginxconf.Directive
+	for _, server := range nginxconf.Find(tree, "server") {
+		if isSSLServer(server) {
+			scope = server.Block
+			break
+		}
+	}
+	if scope == nil {
+		if servers := nginxconf.Find(tree, "server"); len(servers) > 0 {
+			scope = servers[0].Block
+		}
+	}
+
+	var hasGzip, hasBrotli bool
+	for _, d := range scope {
+		switch d.Name {
+		case "access_log":
+			if len(d.Args) >= 2 && config.LogFormat == "" && !strings.Contains(d.Args[1], "=") {
+				config.LogFormat = d.Args[1]
+			}
+		case "limit_rate":
+			config.LimitRate = d.Arg(0)
+		case "limit_rate_after":
+			config.LimitRateAfter = d.Arg(0)
+		case "gzip":
+			hasGzip = d.Arg(0) == "on"
+		case "brotli":
+			hasBrotli = d.Arg(0) == "on"
+		case "ssl_protocols":
+			protocols := strings.Join(d.Args, " ")
+			switch {
+			case protocols == "TLSv1.3":
+				config.TLSPolicy = "modern"
+			case protocols == "TLSv1.2 TLSv1.3":
+				config.TLSPolicy = "intermediate"
+			case strings.Contains(protocols, "TLSv1.1"):
+				config.TLSPolicy = "compat"
+			}
+		}
+	}
+
+	if loc := mainLocation(tree); loc != nil {
+		for _, d := range nginxconf.Find(loc.Block, "proxy_set_header") {
+			if len(d.Args) < 2 || builtinProxyHeaders[strings.ToLower(d.Args[0])] {
+				continue
+			}
+			if config.ProxyHeaders == nil {
+				config.ProxyHeaders = make(map[string]string)
+			}
+			config.ProxyHeaders[d.Args[0]] = strings.Join(d.Args[1:], " ")
+		}
+	}
+
+	switch {
+	case hasGzip && hasBrotli:
+		config.Compression = "both"
+	case hasGzip:
+		config.Compression = "gzip"
+	case hasBrotli:
+		config.Compression = "brotli"
+	default:
+		config.Compression = "off"
+	}
 }
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"nginx-mgr/internal/model"
+)
+
+func newTestSiteService(t *testing.T) *SiteService {
+	t.Helper()
+	dir := t.TempDir()
+	for _, sub := range []string{"sites-available", "sites-enabled", "www"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", sub, err)
+		}
+	}
+	svc := NewSiteService(&SiteDefaultsService{path: filepath.Join(dir, "site_defaults.json")})
+	svc.ConfDir = dir
+	svc.WebRoot = filepath.Join(dir, "www")
+	return svc
+}
+
+func TestSiteConfigRoundTrip(t *testing.T) {
+	svc := newTestSiteService(t)
+	cases := []model.SiteConfig{
+		{Domain: "proxy.example.com", Type: "proxy", BackendIP: "10.0.0.2", BackendPort: 8080,
+			ProxyHeaders: map[string]string{"X-Env": "prod"}, TLSPolicy: "modern", Compression: "gzip", LimitRate: "512k", LimitRateAfter: "10m",
+			BlockedAgents: []string{"sqlmap", `Go-http-client/\d`}},
+		{Domain: "lb.example.com", Type: "lb", LBMethod: "least_conn", Backends: []model.Backend{
+			{Address: "10.0.0.3:80", Weight: 3, MaxFails: 2, FailTimeout: "10s"},
+			{Address: "10.0.0.4:80", Backup: true},
+		}},
+		{Domain: "static.example.com", Type: "static", LogFormat: "json",
+			Hotlink: &model.HotlinkConfig{Enabled: true, AllowedReferers: []string{"*.example.org"}, Extensions: []string{"png", "mp4"}}},
+		{Domain: "redirect.example.com", Type: "redirect", TargetURL: "https://example.org"},
+		{Domain: "legacy.example.com", Type: "redirect", TargetURL: "https://example.org", RedirectRules: []model.RedirectRule{
+			{Match: "exact", Path: "/about.html", Target: "https://example.org/about", Code: 301},
+			{Match: "prefix", Path: "/blog/", Target: "https://blog.example.org", Code: 302},
+			{Match: "regex", Path: `^/p/(\d+)$`, Target: "https://example.org/posts/$1", Code: 301},
+		}},
+		{Domain: "py.example.com", Type: "uwsgi", AppTarget: "unix:/run/uwsgi/app.sock"},
+		{Domain: "php.example.com", Type: "fastcgi", AppTarget: "127.0.0.1:9000"},
+	}
+	for _, want := range cases {
+		if err := svc.CreateSite(want); err != nil {
+			t.Fatalf("create %s: %v", want.Domain, err)
+		}
+		got, err := svc.GetSite(want.Domain)
+		if err != nil {
+			t.Fatalf("get %s: %v", want.Domain, err)
+		}
+		if got.Type != want.Type || got.BackendIP != want.BackendIP || got.BackendPort != want.BackendPort || got.TargetURL != want.TargetURL || got.AppTarget != want.AppTarget {
+			t.Fatalf("%s: basic fields mismatch: %+v", want.Domain, got)
+		}
+		if !reflect.DeepEqual(got.BlockedAgents, want.BlockedAgents) {
+			t.Fatalf("%s: blocked agents mismatch: %v", want.Domain, got.BlockedAgents)
+		}
+		if want.Hotlink != nil && !reflect.DeepEqual(got.Hotlink, want.Hotlink) {
+			t.Fatalf("%s: hotlink mismatch: %+v", want.Domain, got.Hotlink)
+		}
+		if len(want.RedirectRules) > 0 && !reflect.DeepEqual(got.RedirectRules, want.RedirectRules) {
+			t.Fatalf("%s: redirect rules mismatch: %v", want.Domain, got.RedirectRules)
+		}
+		if len(want.Backends) > 0 && !reflect.DeepEqual(got.Backends, want.Backends) {
+			t.Fatalf("%s: backends mismatch: %v", want.Domain, got.Backends)
+		}
+		if got.LBMethod != want.LBMethod || got.LBHashKey != want.LBHashKey {
+			t.Fatalf("%s: lb method mismatch: %q %q", want.Domain, got.LBMethod, got.LBHashKey)
+		}
+		if want.TLSPolicy != "" && got.TLSPolicy != want.TLSPolicy {
+			t.Fatalf("%s: tls policy mismatch: %q", want.Domain, got.TLSPolicy)
+		}
+		if want.Compression != "" && got.Compression != want.Compression {
+			t.Fatalf("%s: compression mismatch: %q", want.Domain, got.Compression)
+		}
+		if want.LogFormat != "" && got.LogFormat != want.LogFormat {
+			t.Fatalf("%s: log format mismatch: %q", want.Domain, got.LogFormat)
+		}
+		if got.LimitRate != want.LimitRate || got.LimitRateAfter != want.LimitRateAfter {
+			t.Fatalf("%s: limit rate mismatch: %q %q", want.Domain, got.LimitRate, got.LimitRateAfter)
+		}
+		if want.ProxyHeaders != nil && !reflect.DeepEqual(got.ProxyHeaders, want.ProxyHeaders) {
+			t.Fatalf("%s: proxy headers mismatch: %v", want.Domain, got.ProxyHeaders)
+		}
+	}
+}
+
+func TestDroppedDirectivesReportsHandEdits(t *testing.T) {
+	svc := newTestSiteService(t)
+	config := model.SiteConfig{Domain: "app.example.com", Type: "proxy", BackendIP: "10.0.0.2", BackendPort: 8080}
+	if err := svc.CreateSite(config); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	config.BackendPort = 9090
+	config.Compression = "off"
+	dropped, err := svc.DroppedDirectives(config.Domain, config)
+	if err != nil {
+		t.Fatalf("dropped: %v", err)
+	}
+	if len(dropped) != 0 {
+		t.Fatalf("structured changes should not be reported, got %v", dropped)
+	}
+
+	raw, _ := svc.ReadSiteRaw(config.Domain)
+	raw = strings.Replace(raw, "    # ===== 动态内容 =====", "    location /api/ {\n        proxy_pass http://10.0.0.9:7000;\n    }\n\n    # ===== 动态内容 =====", 1)
+	raw = strings.Replace(raw, "proxy_pass http://10.0.0.2:8080;\n        # WebSocket支持", "proxy_pass http://10.0.0.2:8080;\n        client_max_body_size 50m;\n        # WebSocket支持", 1)
+	if err := svc.WriteSiteRaw(config.Domain, raw); err != nil {
+		t.Fatalf("write raw: %v", err)
+	}
+
+	dropped, err = svc.DroppedDirectives(config.Domain, config)
+	if err != nil {
+		t.Fatalf("dropped: %v", err)
+	}
+	want := []string{
+		"server[443 ssl] > location /api/",
+		"server[443 ssl] > location /api/ > proxy_pass",
+		"server[443 ssl] > location / > client_max_body_size",
+	}
+	if !reflect.DeepEqual(dropped, want) {
+		t.Fatalf("unexpected dropped directives:\n got %v\nwant %v", dropped, want)
+	}
+}
+
+func TestSiteDefaultsOverrides(t *testing.T) {
+	svc := newTestSiteService(t)
+	if _, err := svc.defaultsSvc.Save(model.SiteDefaults{ProxyHeaders: map[string]string{"X-Env": "prod", "X-Team": "ops"}}); err != nil {
+		t.Fatalf("save defaults: %v", err)
+	}
+
+	// 站点可覆盖默认请求头，空值表示去掉该默认请求头
+	site := model.SiteConfig{Domain: "app.example.com", Type: "proxy", BackendIP: "10.0.0.2", BackendPort: 8080,
+		ProxyHeaders: map[string]string{"x-env": "staging", "X-Team": ""}}
+	if err := svc.CreateSite(site); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	raw, _ := svc.ReadSiteRaw(site.Domain)
+	if !strings.Contains(raw, "proxy_set_header x-env staging;") || strings.Contains(raw, "X-Env prod") || strings.Contains(raw, "X-Team") {
+		t.Fatalf("site headers should override defaults:\n%s", raw)
+	}
+	// 去掉的默认请求头在读取时以空值返回，原样保存后仍不会补回
+	got, err := svc.GetSite(site.Domain)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !reflect.DeepEqual(got.ProxyHeaders, map[string]string{"x-env": "staging", "X-Team": ""}) {
+		t.Fatalf("unexpected headers: %v", got.ProxyHeaders)
+	}
+	if err := svc.CreateSite(*got); err != nil {
+		t.Fatalf("resave: %v", err)
+	}
+	if resaved, _ := svc.ReadSiteRaw(site.Domain); resaved != raw {
+		t.Fatalf("resave should not bring back removed defaults:\n%s", resaved)
+	}
+
+	// 未设置压缩默认值时静态站点不压缩，反向代理在没有 brotli 模块时只启用 gzip
+	if err := svc.CreateSite(model.SiteConfig{Domain: "static.example.com", Type: "static"}); err != nil {
+		t.Fatalf("create static: %v", err)
+	}
+	if raw, _ := svc.ReadSiteRaw("static.example.com"); strings.Contains(raw, "gzip") || strings.Contains(raw, "brotli") {
+		t.Fatalf("static sites should not compress by default:\n%s", raw)
+	}
+	if !strings.Contains(raw, "gzip on;") || strings.Contains(raw, "brotli") {
+		t.Fatalf("proxy sites should fall back to gzip without brotli:\n%s", raw)
+	}
+	if err := svc.CreateSite(model.SiteConfig{Domain: "br.example.com", Type: "static", Compression: "brotli"}); !errors.Is(err, ErrInvalidSiteOption) {
+		t.Fatalf("brotli without the module should be rejected, got %v", err)
+	}
+	os.MkdirAll(filepath.Join(svc.ConfDir, "modules-enabled"), 0755)
+	os.WriteFile(filepath.Join(svc.ConfDir, "modules-enabled", "50-mod-http-brotli-filter.conf"), nil, 0644)
+	if err := svc.CreateSite(model.SiteConfig{Domain: "br.example.com", Type: "static", Compression: "brotli"}); err != nil {
+		t.Fatalf("create brotli site: %v", err)
+	}
+	if raw, _ := svc.ReadSiteRaw("br.example.com"); !strings.Contains(raw, "brotli on;") || strings.Contains(raw, "gzip") {
+		t.Fatalf("brotli should be enabled once the module is loaded:\n%s", raw)
+	}
+}
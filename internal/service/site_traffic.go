@@ -0,0 +1,106 @@
+package service
+
+import (
+	"fmt"
+	"nginx-mgr/internal/model"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// siteTrafficAlertTop 流量告警中列出的站点数量
+const siteTrafficAlertTop = 5
+
+// TrafficBreakdown 按站点拆分流量周期的用量。最近 7 天按小时数据统计，更早的部分按天汇总，周期开始当天整天计入
+func (s *SiteStatsService) TrafficBreakdown(cycle TrafficCycle, now time.Time) (*model.TrafficSiteBreakdown, error) {
+	paths, _ := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	domains := make(map[string]bool, len(paths)+len(s.states))
+	for _, path := range paths {
+		domains[strings.TrimSuffix(filepath.Base(path), ".json")] = true
+	}
+	for domain := range s.states {
+		domains[domain] = true
+	}
+
+	breakdown := &model.TrafficSiteBreakdown{
+		CycleStartUnixTime: cycle.CycleStart.Unix(),
+		UsedBytes:          cycle.UsedBytes,
+		LimitBytes:         cycle.LimitBytes,
+		Sites:              []model.SiteTrafficUsage{},
+	}
+	if !cycle.NextReset.IsZero() {
+		breakdown.NextResetUnixTime = cycle.NextReset.Unix()
+	}
+	for domain := range domains {
+		state, err := s.loadState(domain)
+		if err != nil {
+			return nil, err
+		}
+		usage := state.usageSince(cycle.CycleStart, now)
+		if usage.Requests == 0 && usage.Bytes == 0 {
+			continue
+		}
+		usage.Domain = domain
+		if cycle.UsedBytes > 0 {
+			usage.Percent = float64(usage.Bytes) / float64(cycle.UsedBytes) * 100
+		}
+		breakdown.SiteBytes += usage.Bytes
+		breakdown.Sites = append(breakdown.Sites, usage)
+	}
+	sort.Slice(breakdown.Sites, func(i, j int) bool {
+		if breakdown.Sites[i].Bytes != breakdown.Sites[j].Bytes {
+			return breakdown.Sites[i].Bytes > breakdown.Sites[j].Bytes
+		}
+		return breakdown.Sites[i].Domain < breakdown.Sites[j].Domain
+	})
+	breakdown.OtherBytes = max(0, int64(cycle.UsedBytes)-breakdown.SiteBytes)
+	return breakdown, nil
+}
+
+// usageSince 汇总 since 之后的请求数与流量。小时数据保留期内第一个完整日之前使用按天汇总
+func (st *siteStatsState) usageSince(since, now time.Time) model.SiteTrafficUsage {
+	var usage model.SiteTrafficUsage
+	covered := dayStart(now.Add(-siteStatsHourRetain).Local()).AddDate(0, 0, 1).Unix()
+	sinceDay := dayStart(since.Local()).Unix()
+	for _, day := range st.Days {
+		if day.StartUnixTime >= sinceDay && day.StartUnixTime < covered {
+			usage.Requests += day.Requests
+			usage.Bytes += day.Bytes
+		}
+	}
+	lower := max(since.Truncate(time.Hour).Unix(), covered)
+	for _, hour := range st.Hours {
+		if hour.Start >= lower && hour.Start <= now.Unix() {
+			usage.Requests += hour.Requests
+			usage.Bytes += hour.Bytes
+		}
+	}
+	return usage
+}
+
+// trafficSiteLines 告警正文中的站点流量排行，没有站点统计时返回空
+func (d *NotificationDispatcher) trafficSiteLines(cycle TrafficCycle) []string {
+	if d.SiteStats == nil || cycle.CycleStart.IsZero() {
+		return nil
+	}
+	breakdown, err := d.SiteStats.TrafficBreakdown(cycle, time.Now())
+	if err != nil || len(breakdown.Sites) == 0 {
+		return nil
+	}
+	lines := []string{"", "### 本周期站点流量"}
+	for i, site := range breakdown.Sites {
+		if i >= siteTrafficAlertTop {
+			lines = append(lines, fmt.Sprintf("- 其余 %d 个站点", len(breakdown.Sites)-siteTrafficAlertTop))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("- %s: %s（%.1f%%）", site.Domain, formatBytes(float64(site.Bytes)), site.Percent))
+	}
+	if breakdown.OtherBytes > 0 {
+		lines = append(lines, fmt.Sprintf("- 非站点流量（入站、端口转发等）: %s", formatBytes(float64(breakdown.OtherBytes))))
+	}
+	return lines
+}
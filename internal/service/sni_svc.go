@@ -0,0 +1,254 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"nginx-mgr/internal/model"
+	"nginx-mgr/internal/nginxconf"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+var ErrInvalidSNIRoute = errors.New("SNI 路由配置无效")
+
+var sniHostnamePattern = regexp.MustCompile(`^(\*\.|\.)?[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*$`)
+
+// SNIService 管理 <ConfDir>/sni-routes 下基于 ssl_preread 的 TLS 透传路由
+type SNIService struct {
+	ConfDir string
+}
+
+func NewSNIService() *SNIService {
+	return &SNIService{
+		ConfDir: model.NginxConfDir,
+	}
+}
+
+func (s *SNIService) path(name string) string {
+	return filepath.Join(s.ConfDir, "sni-routes", name+".conf")
+}
+
+func (s *SNIService) validate(config *model.SNIConfig) error {
+	config.Name = strings.TrimSpace(config.Name)
+	if !upstreamNamePattern.MatchString(config.Name) {
+		return fmt.Errorf("%w: 名称只能包含字母、数字、下划线和短横线", ErrInvalidSNIRoute)
+	}
+	if config.ListenPort <= 0 || config.ListenPort > 65535 {
+		return fmt.Errorf("%w: 监听端口超出范围 %d", ErrInvalidSNIRoute, config.ListenPort)
+	}
+	if len(config.Routes) == 0 {
+		return fmt.Errorf("%w: 至少需要一条路由", ErrInvalidSNIRoute)
+	}
+	seen := make(map[string]bool, len(config.Routes))
+	for i := range config.Routes {
+		route := &config.Routes[i]
+		route.Hostname = strings.ToLower(strings.TrimSpace(route.Hostname))
+		route.Target = strings.TrimSpace(route.Target)
+		if !sniHostnamePattern.MatchString(route.Hostname) {
+			return fmt.Errorf("%w: 主机名不合法 %q", ErrInvalidSNIRoute, route.Hostname)
+		}
+		if seen[route.Hostname] {
+			return fmt.Errorf("%w: 主机名重复 %s", ErrInvalidSNIRoute, route.Hostname)
+		}
+		seen[route.Hostname] = true
+		if !validStreamTarget(route.Target) {
+			return fmt.Errorf("%w: 主机 %s 的后端地址不合法 %q", ErrInvalidSNIRoute, route.Hostname, route.Target)
+		}
+	}
+	config.Default = strings.TrimSpace(config.Default)
+	if config.Default != "" && !validStreamTarget(config.Default) {
+		return fmt.Errorf("%w: 默认后端地址不合法 %q", ErrInvalidSNIRoute, config.Default)
+	}
+	return nil
+}
+
+func validStreamTarget(target string) bool {
+	return target != "" && strings.Contains(target, ":") && !strings.ContainsAny(target, " \t;{}$")
+}
+
+func (s *SNIService) render(config model.SNIConfig) (string, error) {
+	funcMap := template.FuncMap{
+		"replace": func(old, new, src string) string {
+			return strings.ReplaceAll(src, old, new)
+		},
+	}
+	tmpl, err := template.New("sni.tmpl").Funcs(funcMap).ParseFS(templateFS, "templates/sni.tmpl")
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, config); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// SaveSNI 创建或覆盖 SNI 路由
+func (s *SNIService) SaveSNI(config model.SNIConfig) error {
+	if err := s.validate(&config); err != nil {
+		return err
+	}
+	if err := s.checkPortConflict(config); err != nil {
+		return err
+	}
+	content, err := s.render(config)
+	if err != nil {
+		return err
+	}
+	if err := ensureStreamInclude(s.ConfDir, filepath.Join(s.ConfDir, "sni-routes", "*.conf")); err != nil {
+		return err
+	}
+	return s.WriteSNIRaw(config.Name, content)
+}
+
+// checkPortConflict 透传需要独占监听端口：已启用站点（例如 listen 443 ssl）或其他 SNI 路由
+// 使用同一端口时拒绝保存，站点应改为监听本机其他端口并作为路由的后端
+func (s *SNIService) checkPortConflict(config model.SNIConfig) error {
+	sites, err := sitesListeningOn(s.ConfDir, config.ListenPort)
+	if err != nil {
+		return err
+	}
+	if len(sites) > 0 {
+		return fmt.Errorf("%w: 端口 %d 已被站点 %s 监听，请先把这些站点改为监听本机其他端口（例如 127.0.0.1:8443）并作为 SNI 路由的后端",
+			ErrStreamPortConflict, config.ListenPort, strings.Join(sites, ", "))
+	}
+	routes, err := s.ListSNI()
+	if err != nil {
+		return err
+	}
+	for _, other := range routes {
+		if other.Name != config.Name && other.ListenPort == config.ListenPort {
+			return fmt.Errorf("%w: 端口 %d 已被 SNI 路由 %s 使用", ErrStreamPortConflict, config.ListenPort, other.Name)
+		}
+	}
+	return nil
+}
+
+// sitesListeningOn 返回 listen 指令使用了 port 的已启用站点
+func sitesListeningOn(confDir string, port int) ([]string, error) {
+	dir := filepath.Join(confDir, "sites-enabled")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var sites []string
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		tree, err := nginxconf.Parse(string(content))
+		if err != nil {
+			continue
+		}
+		for _, listen := range findDirectives(tree, "listen") {
+			if listenPort(listen.Arg(0)) == port && !slices.Contains(sites, entry.Name()) {
+				sites = append(sites, entry.Name())
+			}
+		}
+	}
+	return sites, nil
+}
+
+// listenPort 解析 listen 的地址参数：443、[::]:443、127.0.0.1:443，只写地址时为 80，unix 套接字返回 0
+func listenPort(arg string) int {
+	if strings.HasPrefix(arg, "unix:") {
+		return 0
+	}
+	if _, port, err := net.SplitHostPort(arg); err == nil {
+		n, _ := strconv.Atoi(port)
+		return n
+	}
+	if n, err := strconv.Atoi(arg); err == nil {
+		return n
+	}
+	return 80
+}
+
+func (s *SNIService) GetSNI(name string) (*model.SNIConfig, error) {
+	content, err := s.ReadSNIRaw(name)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := nginxconf.Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("解析 SNI 路由配置失败: %w", err)
+	}
+	cfg := &model.SNIConfig{Name: name, Routes: []model.SNIRoute{}}
+	if m := nginxconf.First(tree, "map"); m != nil {
+		for _, d := range m.Block {
+			switch d.Name {
+			case "#", "hostnames":
+			case "default":
+				cfg.Default = d.Arg(0)
+			default:
+				cfg.Routes = append(cfg.Routes, model.SNIRoute{Hostname: d.Name, Target: d.Arg(0)})
+			}
+		}
+	}
+	if server := nginxconf.First(tree, "server"); server != nil {
+		if port, err := strconv.Atoi(nginxconf.First(server.Block, "listen").Arg(0)); err == nil {
+			cfg.ListenPort = port
+		}
+	}
+	return cfg, nil
+}
+
+func (s *SNIService) ListSNI() ([]model.SNIConfig, error) {
+	entries, err := os.ReadDir(filepath.Join(s.ConfDir, "sni-routes"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []model.SNIConfig{}, nil
+		}
+		return nil, err
+	}
+	configs := make([]model.SNIConfig, 0, len(entries))
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".conf")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		cfg, err := s.GetSNI(name)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, *cfg)
+	}
+	return configs, nil
+}
+
+func (s *SNIService) ReadSNIRaw(name string) (string, error) {
+	if !upstreamNamePattern.MatchString(name) {
+		return "", fmt.Errorf("%w: 名称不合法", ErrInvalidSNIRoute)
+	}
+	content, err := os.ReadFile(s.path(name))
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+func (s *SNIService) WriteSNIRaw(name, content string) error {
+	path := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+func (s *SNIService) DeleteSNI(name string) error {
+	if !upstreamNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: 名称不合法", ErrInvalidSNIRoute)
+	}
+	return os.Remove(s.path(name))
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// stateStorePath 面板运行状态库，通知设置、通知记录与流量周期等按键保存在同一个文件中
+const stateStorePath = "/var/lib/nginx-mgr/state.json"
+
+// 状态库中的记录键
+const (
+	stateKeyNotificationSettings = "notification_settings"
+	stateKeyNotificationHistory  = "notification_history"
+	stateKeyTrafficUsage         = "traffic_usage"
+	stateKeyAbuseBans            = "abuse_bans"
+	stateKeyCertMonitor          = "cert_monitor"
+	stateKeyFirewall             = "firewall"
+)
+
+// 旧版本保存在 /root 下的独立状态文件，启动时导入状态库
+const (
+	legacyNotificationSettingsPath = "/root/notification_settings.json"
+	legacyNotificationHistoryPath  = "/root/notification_history.json"
+	legacyTrafficStatePath         = "/root/traffic_usage_state.json"
+)
+
+// legacyStateFiles 旧版本备份中的独立状态文件，恢复后在面板下次启动时导入
+var legacyStateFiles = []string{legacyNotificationSettingsPath, legacyNotificationHistoryPath, legacyTrafficStatePath}
+
+// stateStoreLocks 同一路径的状态库在进程内共用一把锁
+var stateStoreLocks sync.Map
+
+// StateStore 单个 JSON 文件实现的键值存储。这只是过渡方案，并未实现嵌入式数据库：改用 bbolt/SQLite 需要新增依赖，
+// 在确认引入依赖或调整需求范围之前，状态仍保存在 JSON 文件中。
+// 进程内通过共享的互斥锁、进程间通过 flock 串行访问，写入时先写临时文件再重命名，中途断电也不会留下半个文件。
+// 每次写入都会重写整个文件，各记录需自行限制大小（如通知历史）
+type StateStore struct {
+	path string
+	mu   *sync.Mutex
+}
+
+func openStateStore(path string) *StateStore {
+	if path == "" {
+		path = stateStorePath
+	}
+	mu, _ := stateStoreLocks.LoadOrStore(path, &sync.Mutex{})
+	return &StateStore{path: path, mu: mu.(*sync.Mutex)}
+}
+
+func (s *StateStore) lock() (func(), error) {
+	s.mu.Lock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	file, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		s.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+		s.mu.Unlock()
+	}, nil
+}
+
+func (s *StateStore) readAll() (map[string]json.RawMessage, error) {
+	records := make(map[string]json.RawMessage)
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return records, nil
+		}
+		return nil, err
+	}
+	if len(data) == 0 {
+		return records, nil
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", s.path, err)
+	}
+	return records, nil
+}
+
+func (s *StateStore) writeAll(records map[string]json.RawMessage) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Get 读取 key 对应的记录并解析到 v，记录不存在时返回 os.ErrNotExist
+func (s *StateStore) Get(key string, v any) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	records, err := s.readAll()
+	if err != nil {
+		return err
+	}
+	raw, ok := records[key]
+	if !ok {
+		return os.ErrNotExist
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func (s *StateStore) Put(key string, v any) error {
+	return s.Update(key, func(json.RawMessage) (any, error) { return v, nil })
+}
+
+// Update 在同一次加锁内读取、修改并写回 key 对应的记录。fn 收到当前内容（不存在时为 nil），
+// 返回新的值；返回错误时不写入
+func (s *StateStore) Update(key string, fn func(current json.RawMessage) (any, error)) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	records, err := s.readAll()
+	if err != nil {
+		return err
+	}
+	value, err := fn(records[key])
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	records[key] = data
+	return s.writeAll(records)
+}
+
+// MigrateLegacyState 面板启动时把旧版本的独立状态文件导入默认状态库
+func MigrateLegacyState() {
+	store := openStateStore("")
+	store.migrate(stateKeyNotificationSettings, legacyNotificationSettingsPath)
+	store.migrate(stateKeyNotificationHistory, legacyNotificationHistoryPath)
+	store.migrate(stateKeyTrafficUsage, legacyTrafficStatePath)
+}
+
+// migrate 把旧版本的独立 JSON 文件导入 key 并将原文件重命名为 .migrated。
+// 从旧备份恢复出的文件同样会在下次启动时导入，覆盖状态库中的记录
+func (s *StateStore) migrate(key, legacyPath string) {
+	data, err := os.ReadFile(legacyPath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[state] 读取 %s 失败: %v", legacyPath, err)
+		}
+		return
+	}
+	if !json.Valid(data) {
+		log.Printf("[state] %s 不是有效的 JSON，跳过导入", legacyPath)
+		return
+	}
+	if err := s.Update(key, func(json.RawMessage) (any, error) { return json.RawMessage(data), nil }); err != nil {
+		log.Printf("[state] 导入 %s 失败: %v", legacyPath, err)
+		return
+	}
+	if err := os.Rename(legacyPath, legacyPath+".migrated"); err != nil {
+		log.Printf("[state] 重命名 %s 失败: %v", legacyPath, err)
+		return
+	}
+	log.Printf("[state] 已将 %s 导入 %s", legacyPath, s.path)
+}
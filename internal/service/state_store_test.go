@@ -0,0 +1,71 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestStateStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	store := openStateStore(path)
+
+	var counter int
+	if err := store.Get("counter", &counter); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected missing record, got %v", err)
+	}
+
+	// 同一路径的不同实例共用一把锁，并发累加不会丢失更新
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := openStateStore(path).Update("counter", func(current json.RawMessage) (any, error) {
+				var value int
+				if current != nil {
+					if err := json.Unmarshal(current, &value); err != nil {
+						return nil, err
+					}
+				}
+				return value + 1, nil
+			})
+			if err != nil {
+				t.Errorf("update: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := store.Get("counter", &counter); err != nil || counter != 20 {
+		t.Fatalf("expected 20, got %d (%v)", counter, err)
+	}
+
+	// 导入旧文件后原文件改名，其余记录保持不变
+	legacy := filepath.Join(dir, "traffic_usage_state.json")
+	os.WriteFile(legacy, []byte(`{"baseline_bytes": 1024, "cycle_start_unix": 1700000000}`), 0600)
+	store.migrate(stateKeyTrafficUsage, legacy)
+	state, err := NewTrafficUsageManager(path).loadState()
+	if err != nil || state.BaselineBytes != 1024 || state.CycleStart != 1700000000 {
+		t.Fatalf("unexpected migrated state %+v (%v)", state, err)
+	}
+	if _, err := os.Stat(legacy); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("legacy file should be renamed: %v", err)
+	}
+	if err := store.Get("counter", &counter); err != nil || counter != 20 {
+		t.Fatalf("migration should keep other records, got %d (%v)", counter, err)
+	}
+
+	// 无效的旧文件不导入，也不改名
+	os.WriteFile(legacy, []byte("{broken"), 0600)
+	store.migrate(stateKeyTrafficUsage, legacy)
+	if _, err := os.Stat(legacy); err != nil {
+		t.Fatalf("invalid legacy file should stay in place: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected store file mode: %v %v", info, err)
+	}
+}
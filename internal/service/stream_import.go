@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"nginx-mgr/internal/model"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseStreamImport 解析批量导入内容，支持三种格式：
+//   - StreamConfig 数组（JSON）
+//   - {"监听": "目标"} 形式的简单 JSON 对象
+//   - 每行 "监听,目标[,协议[,名称]]" 的 CSV
+//
+// 监听可以是 "端口" 或 "地址:端口"，未指定名称时按监听生成。
+func ParseStreamImport(data []byte) ([]model.StreamConfig, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: 导入内容为空", ErrInvalidStream)
+	}
+	switch data[0] {
+	case '[':
+		var configs []model.StreamConfig
+		if err := json.Unmarshal(data, &configs); err != nil {
+			return nil, fmt.Errorf("%w: 解析 JSON 失败: %v", ErrInvalidStream, err)
+		}
+		return configs, nil
+	case '{':
+		var pairs map[string]string
+		if err := json.Unmarshal(data, &pairs); err != nil {
+			return nil, fmt.Errorf("%w: 解析 JSON 失败: %v", ErrInvalidStream, err)
+		}
+		listens := make([]string, 0, len(pairs))
+		for listen := range pairs {
+			listens = append(listens, listen)
+		}
+		sort.Strings(listens)
+		configs := make([]model.StreamConfig, 0, len(pairs))
+		for _, listen := range listens {
+			config, err := simpleStreamConfig(listen, pairs[listen], "", "")
+			if err != nil {
+				return nil, err
+			}
+			configs = append(configs, config)
+		}
+		return configs, nil
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	var configs []model.StreamConfig
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: 解析 CSV 失败: %v", ErrInvalidStream, err)
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("%w: 第 %d 行至少需要监听与目标两列", ErrInvalidStream, line)
+		}
+		// 跳过表头
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "listen") {
+			continue
+		}
+		record = append(record, "", "")
+		config, err := simpleStreamConfig(record[0], record[1], record[2], record[3])
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行: %w", line, err)
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+func simpleStreamConfig(listen, target, protocol, name string) (model.StreamConfig, error) {
+	listen = strings.TrimSpace(listen)
+	addr, portText := "", listen
+	if host, p, err := net.SplitHostPort(listen); err == nil {
+		addr, portText = host, p
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return model.StreamConfig{}, fmt.Errorf("%w: 监听格式不正确 %q", ErrInvalidStream, listen)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = fmt.Sprintf("port-%d", port)
+		if addr != "" {
+			name = strings.NewReplacer(".", "_", ":", "_").Replace(addr) + "-" + strconv.Itoa(port)
+		}
+		if p := strings.ToLower(strings.TrimSpace(protocol)); p == "udp" {
+			name += "-udp"
+		}
+	}
+	return model.StreamConfig{
+		Name:       name,
+		ListenAddr: addr,
+		ListenPort: port,
+		Target:     strings.TrimSpace(target),
+		Protocol:   protocol,
+	}, nil
+}
+
+// ImportStreams 依次创建全部转发规则，任一失败则删除本次已创建的规则。
+// 不重载 nginx，由调用方统一测试并重载一次，失败时调用 DeleteStream 回滚返回的名称。
+func (s *StreamService) ImportStreams(configs []model.StreamConfig) ([]string, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("%w: 没有可导入的转发规则", ErrInvalidStream)
+	}
+	seen := make(map[string]bool, len(configs))
+	for i := range configs {
+		if err := validateStream(&configs[i]); err != nil {
+			return nil, fmt.Errorf("第 %d 条: %w", i+1, err)
+		}
+		name := configs[i].Name
+		if seen[name] {
+			return nil, fmt.Errorf("%w: 名称重复 %s", ErrInvalidStream, name)
+		}
+		seen[name] = true
+		if _, err := os.Stat(s.availablePath(name)); err == nil {
+			return nil, fmt.Errorf("%w: 转发规则 %s 已存在", ErrInvalidStream, name)
+		}
+	}
+
+	created := make([]string, 0, len(configs))
+	for _, config := range configs {
+		// 逐条写入，后续规则的端口冲突检查会把本批次已创建的规则计算在内
+		if err := s.CreateStream(config); err != nil {
+			for _, name := range created {
+				_ = s.DeleteStream(name)
+			}
+			_ = s.DeleteStream(config.Name)
+			return nil, fmt.Errorf("导入 %s 失败: %w", config.Name, err)
+		}
+		created = append(created, config.Name)
+	}
+	return created, nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrStreamPortConflict = errors.New("监听端口已被占用")
+
+// hostSocket 主机上已绑定的本地端口
+type hostSocket struct {
+	proto string // tcp, udp
+	addr  net.IP
+	port  int
+}
+
+// checkPortConflict 检查其他转发规则与主机上已监听的套接字是否占用了 config 的端口
+func (s *StreamService) checkPortConflict(config model.StreamConfig) error {
+	protos := streamProtoSet(config.Protocol)
+	addr := net.ParseIP(config.ListenAddr)
+
+	configs, err := s.ListStreamConfigs()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var current *model.StreamConfig
+	for i := range configs {
+		other := configs[i]
+		if other.Name == config.Name {
+			current = &configs[i]
+			continue
+		}
+		if !other.Enabled || other.ListenPort != config.ListenPort || !addrOverlaps(addr, net.ParseIP(other.ListenAddr)) {
+			continue
+		}
+		for proto := range streamProtoSet(other.Protocol) {
+			if protos[proto] {
+				return fmt.Errorf("%w: %s 端口 %d 已被转发规则 %s 使用", ErrStreamPortConflict, proto, config.ListenPort, other.Name)
+			}
+		}
+	}
+
+	sockets, err := s.hostSockets()
+	if err != nil {
+		return err
+	}
+	for _, sock := range sockets {
+		if sock.port != config.ListenPort || !protos[sock.proto] || !addrOverlaps(addr, sock.addr) {
+			continue
+		}
+		// 更新规则时，原规则自身由 nginx 持有的端口不算冲突
+		if current != nil && current.Enabled && current.ListenPort == sock.port && streamProtoSet(current.Protocol)[sock.proto] {
+			continue
+		}
+		return fmt.Errorf("%w: 主机上 %s 端口 %d 已在监听", ErrStreamPortConflict, sock.proto, config.ListenPort)
+	}
+	return nil
+}
+
+func streamProtoSet(protocol string) map[string]bool {
+	switch protocol {
+	case "udp":
+		return map[string]bool{"udp": true}
+	case "both":
+		return map[string]bool{"tcp": true, "udp": true}
+	default:
+		return map[string]bool{"tcp": true}
+	}
+}
+
+// addrOverlaps 任一方为空或通配地址时视为重叠
+func addrOverlaps(a, b net.IP) bool {
+	if a == nil || b == nil || a.IsUnspecified() || b.IsUnspecified() {
+		return true
+	}
+	return a.Equal(b)
+}
+
+// hostSockets 读取 /proc/net 下处于监听状态的 TCP 与已绑定的 UDP 套接字
+func (s *StreamService) hostSockets() ([]hostSocket, error) {
+	var sockets []hostSocket
+	for _, file := range []struct{ name, proto, state string }{
+		{"tcp", "tcp", "0A"},
+		{"tcp6", "tcp", "0A"},
+		{"udp", "udp", "07"},
+		{"udp6", "udp", "07"},
+	} {
+		f, err := os.Open(filepath.Join(s.ProcNetDir, file.name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // 表头
+		for scanner.Scan() {
+			// sl local_address rem_address st ...
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 4 || fields[3] != file.state {
+				continue
+			}
+			addr, port, ok := parseProcAddr(fields[1])
+			if ok {
+				sockets = append(sockets, hostSocket{proto: file.proto, addr: addr, port: port})
+			}
+		}
+		f.Close()
+	}
+	return sockets, nil
+}
+
+// parseProcAddr 解析 /proc/net 中 "0100007F:0050" 形式的地址，IP 按 32 位字小端存储
+func parseProcAddr(value string) (net.IP, int, bool) {
+	hexAddr, hexPort, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, 0, false
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return nil, 0, false
+	}
+	raw, err := hex.DecodeString(hexAddr)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil, 0, false
+	}
+	for i := 0; i+4 <= len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	return net.IP(raw), int(port), true
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// streamStatsWindows 统计窗口，按从短到长排列
+var streamStatsWindows = []struct {
+	label    string
+	duration time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+}
+
+// streamStatsReadLimit 只读取日志末尾这么多字节，避免大文件拖慢接口
+const streamStatsReadLimit int64 = 16 * 1024 * 1024
+
+func (s *StreamService) logPath(name string) string {
+	return filepath.Join(s.LogDir, "stream-"+name+".log")
+}
+
+// Stats 解析 stream 访问日志，返回最近各时间窗口的连接数与流量
+func (s *StreamService) Stats(name string, now time.Time) (*model.StreamStats, error) {
+	if !upstreamNamePattern.MatchString(name) {
+		return nil, os.ErrNotExist
+	}
+	if _, err := os.Stat(s.availablePath(name)); err != nil {
+		return nil, err
+	}
+	stats := &model.StreamStats{Name: name, Windows: make([]model.StreamStatsWindow, len(streamStatsWindows))}
+	sessions := make([]float64, len(streamStatsWindows))
+	for i, w := range streamStatsWindows {
+		stats.Windows[i].Window = w.label
+	}
+
+	data, err := readLogTail(s.logPath(name), streamStatsReadLimit)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// $msec $remote_addr $protocol $status $bytes_sent $bytes_received $session_time $upstream_addr
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 7 {
+			continue
+		}
+		msec, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		age := now.Sub(time.UnixMilli(int64(msec * 1000)))
+		sent, _ := strconv.ParseInt(fields[4], 10, 64)
+		received, _ := strconv.ParseInt(fields[5], 10, 64)
+		session, _ := strconv.ParseFloat(fields[6], 64)
+		for i, w := range streamStatsWindows {
+			if age < 0 || age > w.duration {
+				continue
+			}
+			window := &stats.Windows[i]
+			window.Connections++
+			if fields[3] != "200" {
+				window.Failed++
+			}
+			window.BytesSent += sent
+			window.BytesReceived += received
+			sessions[i] += session
+		}
+	}
+	for i := range stats.Windows {
+		if stats.Windows[i].Connections > 0 {
+			stats.Windows[i].AvgSessionSec = sessions[i] / float64(stats.Windows[i].Connections)
+		}
+	}
+	return stats, nil
+}
+
+func readLogTail(path string, limit int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	start := int64(0)
+	if info.Size() > limit {
+		start = info.Size() - limit
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if start > 0 {
+		// 丢弃被截断的第一行
+		if idx := bytes.IndexByte(data, '\n'); idx != -1 {
+			data = data[idx+1:]
+		}
+	}
+	return data, nil
+}
@@ -1,8 +1,11 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"nginx-mgr/internal/model"
+	"nginx-mgr/internal/nginxconf"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -10,23 +13,106 @@ import (
 	"text/template"
 )
 
+var ErrInvalidStream = errors.New("转发规则参数无效")
+
+var streamProtocols = map[string]bool{
+	"tcp":  true,
+	"udp":  true,
+	"both": true,
+}
+
 type StreamService struct {
-	ConfDir string
+	ConfDir    string
+	LogDir     string
+	ProcNetDir string
 }
 
 func NewStreamService() *StreamService {
 	return &StreamService{
-		ConfDir: model.NginxConfDir,
+		ConfDir:    model.NginxConfDir,
+		LogDir:     "/var/log/nginx",
+		ProcNetDir: "/proc/net",
+	}
+}
+
+func validateStream(config *model.StreamConfig) error {
+	config.Name = strings.TrimSpace(config.Name)
+	if !upstreamNamePattern.MatchString(config.Name) {
+		return fmt.Errorf("%w: 名称只能包含字母、数字、下划线和短横线", ErrInvalidStream)
+	}
+	if config.ListenPort <= 0 || config.ListenPort > 65535 {
+		return fmt.Errorf("%w: 监听端口超出范围 %d", ErrInvalidStream, config.ListenPort)
+	}
+	config.ListenAddr = strings.Trim(strings.TrimSpace(config.ListenAddr), "[]")
+	if config.ListenAddr != "" && net.ParseIP(config.ListenAddr) == nil {
+		return fmt.Errorf("%w: 监听地址必须是本机 IP %q", ErrInvalidStream, config.ListenAddr)
+	}
+	config.Target = strings.TrimSpace(config.Target)
+	if len(config.Targets) == 0 {
+		if config.Target == "" || strings.ContainsAny(config.Target, " ;{}") {
+			return fmt.Errorf("%w: 目标地址不合法 %q", ErrInvalidStream, config.Target)
+		}
+		config.Targets = []model.Backend{{Address: config.Target}}
+	}
+	// 复用站点负载均衡的节点校验规则
+	probe := model.SiteConfig{Type: "lb", Backends: config.Targets}
+	if err := validateSiteOptions(&probe); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidStream, strings.TrimPrefix(err.Error(), ErrInvalidSiteOption.Error()+": "))
+	}
+	config.Targets = probe.Backends
+	config.Target = config.Targets[0].Address
+	config.LBMethod = strings.ToLower(strings.TrimSpace(config.LBMethod))
+	switch config.LBMethod {
+	case "", "round_robin":
+		config.LBMethod = ""
+	case "least_conn":
+	case "hash":
+		for _, target := range config.Targets {
+			if target.Backup {
+				return fmt.Errorf("%w: hash 算法不支持 backup 节点", ErrInvalidStream)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: 不支持的负载均衡算法 %s", ErrInvalidStream, config.LBMethod)
+	}
+	config.Protocol = strings.ToLower(strings.TrimSpace(config.Protocol))
+	if config.Protocol == "" {
+		config.Protocol = "tcp"
+	}
+	if !streamProtocols[config.Protocol] {
+		return fmt.Errorf("%w: 不支持的协议 %s", ErrInvalidStream, config.Protocol)
+	}
+	if config.MaxConns < 0 || config.MaxConnsPerIP < 0 {
+		return fmt.Errorf("%w: 连接数限制不能为负数", ErrInvalidStream)
+	}
+	for _, rate := range []*string{&config.UploadRate, &config.DownloadRate} {
+		*rate = strings.TrimSpace(*rate)
+		if *rate == "0" {
+			*rate = ""
+		}
+		if *rate != "" && !sizePattern.MatchString(*rate) {
+			return fmt.Errorf("%w: 限速值格式不正确 %s", ErrInvalidStream, *rate)
+		}
 	}
+	return nil
 }
 
 func (s *StreamService) CreateStream(config model.StreamConfig) error {
+	if err := validateStream(&config); err != nil {
+		return err
+	}
+	if err := s.checkPortConflict(config); err != nil {
+		return err
+	}
 	tmpl, err := template.ParseFS(templateFS, "templates/stream.tmpl")
 	if err != nil {
 		return err
 	}
 
 	availablePath := s.availablePath(config.Name)
+	// 更新已停用的规则时保持停用状态
+	_, existErr := os.Stat(availablePath)
+	keepDisabled := existErr == nil && !s.IsEnabled(config.Name)
 	f, err := os.Create(availablePath)
 	if err != nil {
 		return err
@@ -37,11 +123,46 @@ func (s *StreamService) CreateStream(config model.StreamConfig) error {
 		return err
 	}
 
+	if keepDisabled {
+		return nil
+	}
 	enabledPath := s.enabledPath(config.Name)
 	os.Remove(enabledPath)
 	return os.Symlink(availablePath, enabledPath)
 }
 
+// IsEnabled 判断 streams-enabled 中是否存在对应的软链接
+func (s *StreamService) IsEnabled(name string) bool {
+	_, err := os.Lstat(s.enabledPath(name))
+	return err == nil
+}
+
+// EnableStream 仅创建 streams-enabled 软链接，启用前检查端口冲突
+func (s *StreamService) EnableStream(name string) error {
+	config, err := s.GetStream(name)
+	if err != nil {
+		return err
+	}
+	if config.Enabled {
+		return nil
+	}
+	if err := s.checkPortConflict(*config); err != nil {
+		return err
+	}
+	return os.Symlink(s.availablePath(name), s.enabledPath(name))
+}
+
+// DisableStream 仅移除 streams-enabled 软链接，保留配置文件
+func (s *StreamService) DisableStream(name string) error {
+	if _, err := os.Stat(s.availablePath(name)); err != nil {
+		return err
+	}
+	if err := os.Remove(s.enabledPath(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (s *StreamService) DeleteStream(name string) error {
 	enabledPath := s.enabledPath(name)
 	availablePath := s.availablePath(name)
@@ -67,22 +188,80 @@ func (s *StreamService) GetStream(name string) (*model.StreamConfig, error) {
 	if err != nil {
 		return nil, err
 	}
+	cfg, err := parseStreamConfig(name, string(content))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Enabled = s.IsEnabled(name)
+	return cfg, nil
+}
+
+// parseStreamConfig 从转发配置内容中解析监听端口与后端，不含启用状态
+func parseStreamConfig(name, content string) (*model.StreamConfig, error) {
+	tree, err := nginxconf.Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("解析转发配置失败: %w", err)
+	}
 	cfg := &model.StreamConfig{Name: name}
-	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		switch {
-		case strings.HasPrefix(line, "listen "):
-			value := strings.TrimSuffix(strings.TrimPrefix(line, "listen "), ";")
-			port, err := strconv.Atoi(value)
+	for _, upstream := range nginxconf.Find(tree, "upstream") {
+		for _, d := range upstream.Block {
+			switch d.Name {
+			case "least_conn", "hash":
+				cfg.LBMethod = d.Name
+			case "server":
+				target, err := model.ParseBackend(d.Args)
+				if err != nil {
+					target = model.Backend{Address: d.Arg(0)}
+				}
+				cfg.Targets = append(cfg.Targets, target)
+			}
+		}
+	}
+	if len(cfg.Targets) > 0 {
+		cfg.Target = cfg.Targets[0].Address
+	}
+	var hasTCP, hasUDP bool
+	for _, server := range nginxconf.Find(tree, "server") {
+		for _, listen := range nginxconf.Find(server.Block, "listen") {
+			addr, portText := "", listen.Arg(0)
+			if host, p, err := net.SplitHostPort(portText); err == nil {
+				addr, portText = host, p
+			}
+			port, err := strconv.Atoi(portText)
 			if err != nil {
 				return nil, fmt.Errorf("解析端口失败: %w", err)
 			}
 			cfg.ListenPort = port
-		case strings.HasPrefix(line, "server ") && strings.HasSuffix(line, ";"):
-			value := strings.TrimSuffix(strings.TrimPrefix(line, "server "), ";")
-			cfg.Target = value
+			cfg.ListenAddr = addr
+			if listen.Arg(1) == "udp" {
+				hasUDP = true
+			} else {
+				hasTCP = true
+			}
 		}
+		for _, d := range server.Block {
+			switch d.Name {
+			case "limit_conn":
+				limit, _ := strconv.Atoi(d.Arg(1))
+				if strings.HasSuffix(d.Arg(0), "_conn_ip") {
+					cfg.MaxConnsPerIP = limit
+				} else {
+					cfg.MaxConns = limit
+				}
+			case "proxy_upload_rate":
+				cfg.UploadRate = d.Arg(0)
+			case "proxy_download_rate":
+				cfg.DownloadRate = d.Arg(0)
+			}
+		}
+	}
+	switch {
+	case hasTCP && hasUDP:
+		cfg.Protocol = "both"
+	case hasUDP:
+		cfg.Protocol = "udp"
+	default:
+		cfg.Protocol = "tcp"
 	}
 	return cfg, nil
 }
@@ -119,24 +298,39 @@ func (s *StreamService) ReadStreamRaw(name string) (string, error) {
 	return string(content), nil
 }
 
+// WriteStreamRaw 写入原始配置并保持当前启用状态，启用中的规则先检查新端口是否冲突
 func (s *StreamService) WriteStreamRaw(name, content string) error {
-	path := s.availablePath(name)
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+	if s.IsEnabled(name) {
+		config, err := parseStreamConfig(name, content)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidStream, err)
+		}
+		if err := s.checkPortConflict(*config); err != nil {
+			return err
+		}
+	}
+	return s.writeStreamFile(name, content)
+}
+
+// RestoreStreamRaw 回滚时恢复原始配置与启用状态，原端口仍由 nginx 持有，不做端口冲突检查
+func (s *StreamService) RestoreStreamRaw(name, content string, enabled bool) error {
+	if err := s.writeStreamFile(name, content); err != nil {
 		return err
 	}
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+	enabledPath := s.enabledPath(name)
+	if err := os.Remove(enabledPath); err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	enabled := s.enabledPath(name)
-	if info, err := os.Lstat(enabled); err == nil {
-		if info.Mode()&os.ModeSymlink == 0 {
-			os.Remove(enabled)
-			return os.Symlink(path, enabled)
-		}
+	if !enabled {
 		return nil
-	} else if os.IsNotExist(err) {
-		return os.Symlink(path, enabled)
-	} else {
+	}
+	return os.Symlink(s.availablePath(name), enabledPath)
+}
+
+func (s *StreamService) writeStreamFile(name, content string) error {
+	path := s.availablePath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return err
 	}
+	return os.WriteFile(path, []byte(content), 0644)
 }
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+func newTestStreamService(t *testing.T) *StreamService {
+	t.Helper()
+	dir := t.TempDir()
+	for _, sub := range []string{"streams-available", "streams-enabled"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", sub, err)
+		}
+	}
+	svc := NewStreamService()
+	svc.ConfDir = dir
+	svc.LogDir = dir
+	svc.ProcNetDir = dir
+	return svc
+}
+
+func TestStreamConfigRoundTrip(t *testing.T) {
+	svc := newTestStreamService(t)
+	cases := []model.StreamConfig{
+		{Name: "mysql", Enabled: true, ListenPort: 3306, ListenAddr: "10.0.0.1", Target: "10.0.0.5:3306", Protocol: "tcp",
+			Targets: []model.Backend{{Address: "10.0.0.5:3306"}}},
+		{Name: "dns", Enabled: true, ListenPort: 53, ListenAddr: "::1", Target: "10.0.0.53:53", Protocol: "udp",
+			Targets: []model.Backend{{Address: "10.0.0.53:53"}}},
+		{Name: "wireguard", Enabled: true, ListenPort: 51820, Target: "10.0.0.9:51820", Protocol: "both",
+			Targets: []model.Backend{{Address: "10.0.0.9:51820"}}},
+		{Name: "redis", Enabled: true, ListenPort: 6379, Target: "10.0.0.7:6379", Protocol: "tcp", LBMethod: "least_conn",
+			MaxConns: 500, MaxConnsPerIP: 20, UploadRate: "1m", DownloadRate: "512k",
+			Targets: []model.Backend{{Address: "10.0.0.7:6379", Weight: 2, MaxFails: 3, FailTimeout: "10s"}, {Address: "10.0.0.8:6379", Backup: true}}},
+	}
+	for _, want := range cases {
+		if err := svc.CreateStream(want); err != nil {
+			t.Fatalf("create %s: %v", want.Name, err)
+		}
+		got, err := svc.GetStream(want.Name)
+		if err != nil {
+			t.Fatalf("get %s: %v", want.Name, err)
+		}
+		if !reflect.DeepEqual(*got, want) {
+			t.Fatalf("%s: got %+v, want %+v", want.Name, *got, want)
+		}
+	}
+	if err := svc.CreateStream(model.StreamConfig{Name: "bad", ListenPort: 53, Target: "10.0.0.1:53", Protocol: "sctp"}); err == nil {
+		t.Fatalf("expected unsupported protocol to be rejected")
+	}
+}
+
+func TestSNIRouteRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	nginxConf := filepath.Join(dir, "nginx.conf")
+	if err := os.WriteFile(nginxConf, []byte("stream {\n    include /etc/nginx/streams-enabled/*;\n}\n"), 0644); err != nil {
+		t.Fatalf("write nginx.conf: %v", err)
+	}
+	svc := NewSNIService()
+	svc.ConfDir = dir
+
+	want := model.SNIConfig{Name: "tls-edge", ListenPort: 8443, Default: "10.0.0.9:443", Routes: []model.SNIRoute{
+		{Hostname: "git.example.com", Target: "10.0.0.2:443"},
+		{Hostname: "*.apps.example.com", Target: "10.0.0.3:8443"},
+	}}
+	if err := svc.SaveSNI(want); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	got, err := svc.GetSNI("tls-edge")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !reflect.DeepEqual(*got, want) {
+		t.Fatalf("got %+v, want %+v", *got, want)
+	}
+	raw, _ := svc.ReadSNIRaw("tls-edge")
+	if !strings.Contains(raw, "proxy_pass $tls_edge_sni_backend;") {
+		t.Fatalf("unexpected config:\n%s", raw)
+	}
+	if err := svc.SaveSNI(model.SNIConfig{Name: "bad", ListenPort: 443, Routes: []model.SNIRoute{{Hostname: "a b", Target: "10.0.0.1:443"}}}); err == nil {
+		t.Fatalf("expected invalid hostname to be rejected")
+	}
+}
+
+func TestSNIRoutePortConflict(t *testing.T) {
+	siteSvc := newTestSiteService(t)
+	if err := siteSvc.CreateSite(model.SiteConfig{Domain: "a.example.com", Type: "static"}); err != nil {
+		t.Fatalf("create site: %v", err)
+	}
+	svc := NewSNIService()
+	svc.ConfDir = siteSvc.ConfDir
+	os.WriteFile(filepath.Join(svc.ConfDir, "nginx.conf"), []byte("stream {\n    include /etc/nginx/streams-enabled/*;\n}\n"), 0644)
+	routes := []model.SNIRoute{{Hostname: "git.example.com", Target: "10.0.0.2:443"}}
+
+	// 站点监听 443 ssl 时 443 上的透传在保存前被拒绝
+	err := svc.SaveSNI(model.SNIConfig{Name: "edge", ListenPort: 443, Routes: routes})
+	if !errors.Is(err, ErrStreamPortConflict) || !strings.Contains(err.Error(), "a.example.com") {
+		t.Fatalf("expected conflict with site, got %v", err)
+	}
+	if _, err := svc.ReadSNIRaw("edge"); err == nil {
+		t.Fatalf("conflicting route should not be saved")
+	}
+
+	// 站点改为监听本机端口后可以接管 443
+	raw, _ := siteSvc.ReadSiteRaw("a.example.com")
+	raw = strings.ReplaceAll(raw, "listen 443 ssl;", "listen 127.0.0.1:8443 ssl;")
+	raw = strings.ReplaceAll(raw, "listen [::]:443 ssl;", "")
+	siteSvc.WriteSiteRaw("a.example.com", raw)
+	if err := svc.SaveSNI(model.SNIConfig{Name: "edge", ListenPort: 443, Routes: routes, Default: "127.0.0.1:8443"}); err != nil {
+		t.Fatalf("save after moving site: %v", err)
+	}
+	// 更新自身不冲突，其他路由不能复用同一端口
+	if err := svc.SaveSNI(model.SNIConfig{Name: "edge", ListenPort: 443, Routes: routes}); err != nil {
+		t.Fatalf("update edge: %v", err)
+	}
+	if err := svc.SaveSNI(model.SNIConfig{Name: "edge2", ListenPort: 443, Routes: routes}); !errors.Is(err, ErrStreamPortConflict) {
+		t.Fatalf("expected conflict with edge, got %v", err)
+	}
+	if err := svc.SaveSNI(model.SNIConfig{Name: "alt", ListenPort: 80, Routes: routes}); !errors.Is(err, ErrStreamPortConflict) {
+		t.Fatalf("expected conflict with plain http site, got %v", err)
+	}
+}
+
+func TestStreamStatsWindows(t *testing.T) {
+	svc := newTestStreamService(t)
+	if err := svc.CreateStream(model.StreamConfig{Name: "ssh", ListenPort: 2222, Target: "10.0.0.2:22"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	line := func(age time.Duration, status string, sent, received int) string {
+		ts := float64(now.Add(-age).UnixMilli()) / 1000
+		return fmt.Sprintf("%.3f 1.2.3.4 TCP %s %d %d 2.000 10.0.0.2:22\n", ts, status, sent, received)
+	}
+	log := line(2*time.Minute, "200", 100, 10) + line(30*time.Minute, "502", 0, 0) + line(3*time.Hour, "200", 1000, 50) + line(48*time.Hour, "200", 5, 5)
+	if err := os.WriteFile(filepath.Join(svc.LogDir, "stream-ssh.log"), []byte(log), 0644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+
+	stats, err := svc.Stats("ssh", now)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	want := []model.StreamStatsWindow{
+		{Window: "5m", Connections: 1, BytesSent: 100, BytesReceived: 10, AvgSessionSec: 2},
+		{Window: "1h", Connections: 2, Failed: 1, BytesSent: 100, BytesReceived: 10, AvgSessionSec: 2},
+		{Window: "24h", Connections: 3, Failed: 1, BytesSent: 1100, BytesReceived: 60, AvgSessionSec: 2},
+	}
+	if !reflect.DeepEqual(stats.Windows, want) {
+		t.Fatalf("got %+v, want %+v", stats.Windows, want)
+	}
+}
+
+func TestStreamPortConflict(t *testing.T) {
+	svc := newTestStreamService(t)
+	svc.ProcNetDir = t.TempDir()
+	tcp := "  sl  local_address rem_address   st\n" +
+		"   0: 00000000:0016 00000000:0000 0A\n" + // 0.0.0.0:22 LISTEN
+		"   1: 0100007F:1F90 00000000:0000 0A\n" + // 127.0.0.1:8080 LISTEN
+		"   2: 0100007F:1F91 0100007F:D431 01\n" // 127.0.0.1:8081 ESTABLISHED
+	if err := os.WriteFile(filepath.Join(svc.ProcNetDir, "tcp"), []byte(tcp), 0644); err != nil {
+		t.Fatalf("write tcp: %v", err)
+	}
+
+	cases := []struct {
+		config   model.StreamConfig
+		conflict bool
+	}{
+		{model.StreamConfig{Name: "ssh", ListenPort: 22, Target: "10.0.0.2:22"}, true},
+		{model.StreamConfig{Name: "ssh-udp", ListenPort: 22, Target: "10.0.0.2:22", Protocol: "udp"}, false},
+		{model.StreamConfig{Name: "web", ListenPort: 8080, ListenAddr: "10.0.0.5", Target: "10.0.0.2:80"}, false},
+		{model.StreamConfig{Name: "web-all", ListenPort: 8080, Target: "10.0.0.2:80"}, true},
+		{model.StreamConfig{Name: "alt", ListenPort: 8081, Target: "10.0.0.2:80"}, false},
+		{model.StreamConfig{Name: "alt-dup", ListenPort: 8081, Target: "10.0.0.3:80"}, true},
+	}
+	for _, tc := range cases {
+		err := svc.CreateStream(tc.config)
+		if got := errors.Is(err, ErrStreamPortConflict); got != tc.conflict {
+			t.Fatalf("%s: conflict = %v, err = %v", tc.config.Name, got, err)
+		}
+	}
+	// 更新已存在的规则不应与自身冲突
+	if err := svc.CreateStream(model.StreamConfig{Name: "alt", ListenPort: 8081, Target: "10.0.0.9:80"}); err != nil {
+		t.Fatalf("update alt: %v", err)
+	}
+}
+
+func TestStreamEnableDisable(t *testing.T) {
+	svc := newTestStreamService(t)
+	config := model.StreamConfig{Name: "pg", ListenPort: 5432, Target: "10.0.0.4:5432"}
+	if err := svc.CreateStream(config); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := svc.DisableStream("pg"); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if svc.IsEnabled("pg") {
+		t.Fatalf("pg should be disabled")
+	}
+	// 停用的规则更新后仍保持停用，且不占用端口
+	config.Target = "10.0.0.5:5432"
+	if err := svc.CreateStream(config); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if svc.IsEnabled("pg") {
+		t.Fatalf("update should keep pg disabled")
+	}
+	if err := svc.CreateStream(model.StreamConfig{Name: "pg2", ListenPort: 5432, Target: "10.0.0.6:5432"}); err != nil {
+		t.Fatalf("disabled stream should not reserve its port: %v", err)
+	}
+	if err := svc.EnableStream("pg"); !errors.Is(err, ErrStreamPortConflict) {
+		t.Fatalf("enable should detect conflict with pg2, got %v", err)
+	}
+	if err := svc.DisableStream("pg2"); err != nil {
+		t.Fatalf("disable pg2: %v", err)
+	}
+	if err := svc.EnableStream("pg"); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	got, _ := svc.GetStream("pg")
+	if !got.Enabled || got.Target != "10.0.0.5:5432" {
+		t.Fatalf("unexpected stream: %+v", got)
+	}
+}
+
+func TestStreamRawKeepsEnabledState(t *testing.T) {
+	svc := newTestStreamService(t)
+	for _, config := range []model.StreamConfig{
+		{Name: "pg", ListenPort: 5432, Target: "10.0.0.4:5432"},
+		{Name: "mysql", ListenPort: 3306, Target: "10.0.0.5:3306"},
+	} {
+		if err := svc.CreateStream(config); err != nil {
+			t.Fatalf("create %s: %v", config.Name, err)
+		}
+	}
+	if err := svc.DisableStream("pg"); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+
+	// 编辑停用规则的原始配置后仍保持停用，也不检查端口
+	content, _ := svc.ReadStreamRaw("pg")
+	edited := strings.ReplaceAll(content, "5432", "3306")
+	if err := svc.WriteStreamRaw("pg", edited); err != nil {
+		t.Fatalf("write raw: %v", err)
+	}
+	if svc.IsEnabled("pg") {
+		t.Fatalf("raw edit should keep pg disabled")
+	}
+	if got, _ := svc.ReadStreamRaw("pg"); got != edited {
+		t.Fatalf("raw content not written:\n%s", got)
+	}
+
+	if err := svc.EnableStream("pg"); !errors.Is(err, ErrStreamPortConflict) {
+		t.Fatalf("enable should detect conflict with mysql, got %v", err)
+	}
+
+	// 启用中的规则改到已被占用的端口时拒绝写入
+	if err := svc.RestoreStreamRaw("pg", content, true); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if err := svc.WriteStreamRaw("pg", edited); !errors.Is(err, ErrStreamPortConflict) {
+		t.Fatalf("raw edit of enabled stream should detect conflict, got %v", err)
+	}
+	if got, _ := svc.ReadStreamRaw("pg"); got != content || !svc.IsEnabled("pg") {
+		t.Fatalf("rejected raw edit should leave pg untouched")
+	}
+
+	// 回滚按请求前的状态恢复软链接
+	if err := svc.RestoreStreamRaw("pg", edited, false); err != nil {
+		t.Fatalf("restore disabled: %v", err)
+	}
+	if svc.IsEnabled("pg") {
+		t.Fatalf("restore should keep pg disabled")
+	}
+}
+
+func TestImportStreams(t *testing.T) {
+	svc := newTestStreamService(t)
+	configs, err := ParseStreamImport([]byte("listen,target,protocol\n8080, 10.0.0.1:80\n127.0.0.1:5353,10.0.0.53:53,udp\n# comment\n9000,10.0.0.9:9000,tcp,custom\n"))
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	created, err := svc.ImportStreams(configs)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if want := []string{"port-8080", "127_0_0_1-5353-udp", "custom"}; !reflect.DeepEqual(created, want) {
+		t.Fatalf("created %v, want %v", created, want)
+	}
+	got, err := svc.GetStream("127_0_0_1-5353-udp")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.ListenAddr != "127.0.0.1" || got.ListenPort != 5353 || got.Protocol != "udp" || got.Target != "10.0.0.53:53" {
+		t.Fatalf("unexpected imported stream %+v", *got)
+	}
+
+	// 批次内端口冲突时整批回滚
+	configs, err = ParseStreamImport([]byte(`{"7000": "10.0.0.1:7000", "0.0.0.0:7000": "10.0.0.2:7000"}`))
+	if err != nil {
+		t.Fatalf("parse json: %v", err)
+	}
+	if _, err := svc.ImportStreams(configs); !errors.Is(err, ErrStreamPortConflict) {
+		t.Fatalf("expected port conflict, got %v", err)
+	}
+	for _, name := range []string{"port-7000", "0_0_0_0-7000"} {
+		if _, err := os.Stat(svc.availablePath(name)); !os.IsNotExist(err) {
+			t.Fatalf("%s should have been rolled back, stat err %v", name, err)
+		}
+	}
+
+	if _, err := svc.ImportStreams([]model.StreamConfig{{Name: "custom", ListenPort: 9100, Target: "10.0.0.1:9100"}}); !errors.Is(err, ErrInvalidStream) {
+		t.Fatalf("expected existing name to be rejected, got %v", err)
+	}
+}
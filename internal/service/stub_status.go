@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// stubStatusListen stub_status 只监听本机，不经过站点的 server 块
+	stubStatusListen = "127.0.0.1:8818"
+	stubStatusPath   = "/nginx_status"
+)
+
+var (
+	ErrStubStatusUnsupported = errors.New("当前 Nginx 未编译 http_stub_status_module")
+	ErrStubStatusDisabled    = errors.New("尚未配置 stub_status")
+)
+
+var stubStatusPattern = regexp.MustCompile(`Active connections:\s*(\d+)\s+server accepts handled requests\s+(\d+)\s+(\d+)\s+(\d+)\s+Reading:\s*(\d+)\s+Writing:\s*(\d+)\s+Waiting:\s*(\d+)`)
+
+// StubStatusService 维护本机的 stub_status 状态页并解析其输出
+type StubStatusService struct {
+	ConfDir string
+	URL     string
+	client  *http.Client
+}
+
+func NewStubStatusService() *StubStatusService {
+	return &StubStatusService{
+		ConfDir: model.NginxConfDir,
+		URL:     "http://" + stubStatusListen + stubStatusPath,
+		client:  &http.Client{Timeout: 3 * time.Second},
+	}
+}
+
+// ConfPath 返回 stub_status server 块的配置文件路径
+func (s *StubStatusService) ConfPath() string {
+	return filepath.Join(s.ConfDir, "stub_status.conf")
+}
+
+// Enabled 配置文件已写入时返回 true
+func (s *StubStatusService) Enabled() bool {
+	info, err := os.Stat(s.ConfPath())
+	return err == nil && info.Size() > 0
+}
+
+// Enable 写入只允许本机访问的 stub_status server 块并在 nginx.conf 中引入，
+// 返回写入前的配置内容以便重载失败时回滚
+func (s *StubStatusService) Enable() (string, error) {
+	if !nginxHasModule("http_stub_status_module") {
+		return "", ErrStubStatusUnsupported
+	}
+	prev, _ := os.ReadFile(s.ConfPath())
+	if err := os.WriteFile(s.ConfPath(), []byte(renderStubStatusConf()), 0644); err != nil {
+		return "", err
+	}
+	if err := ensureHTTPInclude(s.ConfDir, s.ConfPath()); err != nil {
+		_ = s.RestoreConf(string(prev))
+		return "", err
+	}
+	return string(prev), nil
+}
+
+// RestoreConf 回滚配置文件；prev 为空表示此前未配置，写入空文件使 include 仍然有效
+func (s *StubStatusService) RestoreConf(prev string) error {
+	return os.WriteFile(s.ConfPath(), []byte(prev), 0644)
+}
+
+func renderStubStatusConf() string {
+	return fmt.Sprintf(`server {
+    listen %s;
+    server_name localhost;
+    access_log off;
+
+    location = %s {
+        stub_status;
+        allow 127.0.0.1;
+        deny all;
+    }
+}
+`, stubStatusListen, stubStatusPath)
+}
+
+// Fetch 读取并解析 stub_status 的当前计数
+func (s *StubStatusService) Fetch() (model.StubStatus, error) {
+	if !s.Enabled() {
+		return model.StubStatus{}, ErrStubStatusDisabled
+	}
+	resp, err := s.client.Get(s.URL)
+	if err != nil {
+		return model.StubStatus{}, fmt.Errorf("读取 stub_status 失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return model.StubStatus{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return model.StubStatus{}, fmt.Errorf("读取 stub_status 失败: HTTP %d", resp.StatusCode)
+	}
+	return parseStubStatus(string(body))
+}
+
+func parseStubStatus(text string) (model.StubStatus, error) {
+	match := stubStatusPattern.FindStringSubmatch(text)
+	if match == nil {
+		return model.StubStatus{}, errors.New("无法解析 stub_status 输出")
+	}
+	values := make([]int64, len(match)-1)
+	for i, raw := range match[1:] {
+		values[i], _ = strconv.ParseInt(raw, 10, 64)
+	}
+	return model.StubStatus{
+		ActiveConnections: values[0],
+		Accepts:           values[1],
+		Handled:           values[2],
+		Requests:          values[3],
+		Reading:           values[4],
+		Writing:           values[5],
+		Waiting:           values[6],
+	}, nil
+}
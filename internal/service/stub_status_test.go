@@ -0,0 +1,38 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStubStatusFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Active connections: 291 \nserver accepts handled requests\n 16630948 16630948 31070465 \nReading: 6 Writing: 179 Waiting: 106 \n"))
+	}))
+	defer server.Close()
+
+	svc := NewStubStatusService()
+	svc.ConfDir = t.TempDir()
+	svc.URL = server.URL
+	if _, err := svc.Fetch(); !errors.Is(err, ErrStubStatusDisabled) {
+		t.Fatalf("expected disabled error, got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(svc.ConfDir, "stub_status.conf"), []byte(renderStubStatusConf()), 0644)
+	stub, err := svc.Fetch()
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if stub.ActiveConnections != 291 || stub.Accepts != 16630948 || stub.Handled != 16630948 || stub.Requests != 31070465 ||
+		stub.Reading != 6 || stub.Writing != 179 || stub.Waiting != 106 {
+		t.Fatalf("unexpected stub status: %+v", stub)
+	}
+
+	if _, err := parseStubStatus("<html>404</html>"); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
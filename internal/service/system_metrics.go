@@ -0,0 +1,411 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	systemMetricsPath     = "/root/system_metrics.json"
+	systemMetricsInterval = time.Minute
+	systemMetricsRetain   = 7 * 24 * time.Hour
+	// systemMetricsSaveEvery 每采样若干次写一次磁盘，面板重启最多丢失这段时间的数据
+	systemMetricsSaveEvery = 10
+	systemMetricsMaxPoints = 360
+)
+
+var ErrInvalidMetricsRange = errors.New("时间范围无效")
+
+// metricsRing 固定容量的环形缓冲区，写满后覆盖最早的采样
+type metricsRing struct {
+	buf   []model.SystemMetricsPoint
+	start int
+	size  int
+}
+
+func newMetricsRing(capacity int) *metricsRing {
+	return &metricsRing{buf: make([]model.SystemMetricsPoint, capacity)}
+}
+
+func (r *metricsRing) push(point model.SystemMetricsPoint) {
+	if r.size < len(r.buf) {
+		r.buf[(r.start+r.size)%len(r.buf)] = point
+		r.size++
+		return
+	}
+	r.buf[r.start] = point
+	r.start = (r.start + 1) % len(r.buf)
+}
+
+// points 按时间先后返回全部采样
+func (r *metricsRing) points() []model.SystemMetricsPoint {
+	points := make([]model.SystemMetricsPoint, 0, r.size)
+	for i := 0; i < r.size; i++ {
+		points = append(points, r.buf[(r.start+i)%len(r.buf)])
+	}
+	return points
+}
+
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+// SystemMetricsService 每分钟采样 CPU、内存、负载与网络速率，已配置 stub_status 时同时记录 Nginx 的连接与请求数，
+// 保留最近 7 天并定期落盘
+type SystemMetricsService struct {
+	ProcDir string
+	NetDir  string
+	path    string
+	stub    *StubStatusService
+
+	mu       sync.Mutex
+	ring     *metricsRing
+	loaded   bool
+	unsaved  int
+	lastAt   time.Time
+	lastCPU  cpuTimes
+	lastRX   uint64
+	lastTX   uint64
+	baseline bool
+	lastStub model.StubStatus
+	hasStub  bool
+}
+
+// NewSystemMetricsService stub 为 nil 时不采集 stub_status
+func NewSystemMetricsService(stub *StubStatusService) *SystemMetricsService {
+	return &SystemMetricsService{
+		ProcDir: "/proc",
+		NetDir:  "/sys/class/net",
+		path:    systemMetricsPath,
+		stub:    stub,
+		ring:    newMetricsRing(int(systemMetricsRetain / systemMetricsInterval)),
+	}
+}
+
+func (s *SystemMetricsService) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ticker := time.NewTicker(systemMetricsInterval)
+	defer ticker.Stop()
+
+	s.Sample(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.saveLocked()
+			s.mu.Unlock()
+			return
+		case <-ticker.C:
+			s.Sample(time.Now())
+		}
+	}
+}
+
+func (s *SystemMetricsService) loadLocked() {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[metrics] 读取 %s 失败: %v", s.path, err)
+		}
+		return
+	}
+	var stored struct {
+		Points []model.SystemMetricsPoint `json:"points"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		log.Printf("[metrics] 解析 %s 失败: %v", s.path, err)
+		return
+	}
+	for _, point := range stored.Points {
+		s.ring.push(point)
+	}
+}
+
+func (s *SystemMetricsService) saveLocked() {
+	data, err := json.Marshal(map[string]interface{}{"points": s.ring.points()})
+	if err == nil {
+		err = os.WriteFile(s.path, data, 0600)
+	}
+	if err != nil {
+		log.Printf("[metrics] 保存 %s 失败: %v", s.path, err)
+		return
+	}
+	s.unsaved = 0
+}
+
+// Sample 采集一次当前状态。CPU 使用率与网络速率由相邻两次采样的差值计算，面板启动后的第一次采样只记录基准值
+func (s *SystemMetricsService) Sample(now time.Time) {
+	// 请求 stub_status 可能耗时数秒，在加锁前完成
+	stub, stubErr := model.StubStatus{}, ErrStubStatusDisabled
+	if s.stub != nil {
+		stub, stubErr = s.stub.Fetch()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loadLocked()
+
+	cpu, cpuErr := readCPUTimes(filepath.Join(s.ProcDir, "stat"))
+	rx, tx := readInterfaceBytes(s.NetDir)
+	point := model.SystemMetricsPoint{UnixTime: now.Unix()}
+	point.MemUsedBytes, point.MemTotalBytes, _ = readMemInfo(filepath.Join(s.ProcDir, "meminfo"))
+	point.Load1, point.Load5, point.Load15, _ = readLoadAvg(filepath.Join(s.ProcDir, "loadavg"))
+
+	if stubErr == nil {
+		point.NginxActiveConnections = float64(stub.ActiveConnections)
+	}
+
+	prevAt, prevCPU, prevRX, prevTX, hadBaseline := s.lastAt, s.lastCPU, s.lastRX, s.lastTX, s.baseline
+	s.lastAt, s.lastCPU, s.lastRX, s.lastTX, s.baseline = now, cpu, rx, tx, cpuErr == nil
+	prevStub, hadStub := s.lastStub, s.hasStub
+	s.lastStub, s.hasStub = stub, stubErr == nil
+	if !hadBaseline || cpuErr != nil {
+		return
+	}
+	if total := cpu.total - prevCPU.total; cpu.total > prevCPU.total {
+		busy := float64(total) - float64(cpu.idle-prevCPU.idle)
+		point.CPUPercent = max(0, busy/float64(total)*100)
+	}
+	if seconds := now.Sub(prevAt).Seconds(); seconds > 0 {
+		// 计数器回绕或网卡重建时本周期速率记为 0
+		if rx >= prevRX {
+			point.RXBytesPerSec = float64(rx-prevRX) / seconds
+		}
+		if tx >= prevTX {
+			point.TXBytesPerSec = float64(tx-prevTX) / seconds
+		}
+		if hadStub && stubErr == nil {
+			point.NginxAcceptsPerSec = counterRate(prevStub.Accepts, stub.Accepts, seconds)
+			point.NginxHandledPerSec = counterRate(prevStub.Handled, stub.Handled, seconds)
+			point.NginxRequestsPerSec = counterRate(prevStub.Requests, stub.Requests, seconds)
+		}
+	}
+	s.ring.push(point)
+	s.unsaved++
+	if s.unsaved >= systemMetricsSaveEvery {
+		s.saveLocked()
+	}
+}
+
+// counterRate 计算累计计数的每秒增量，Nginx 重启导致计数归零时记为 0
+func counterRate(prev, current int64, seconds float64) float64 {
+	if current < prev {
+		return 0
+	}
+	return float64(current-prev) / seconds
+}
+
+// readCPUTimes 读取 /proc/stat 的汇总行，iowait 计入空闲，guest 已包含在 user 中不重复累加
+func readCPUTimes(path string) (cpuTimes, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return cpuTimes{}, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		var times cpuTimes
+		for i, field := range fields[1:min(len(fields), 9)] {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return cpuTimes{}, err
+			}
+			times.total += value
+			if i == 3 || i == 4 {
+				times.idle += value
+			}
+		}
+		return times, nil
+	}
+	return cpuTimes{}, fmt.Errorf("%s 中没有 cpu 汇总行", path)
+}
+
+// readMemInfo 返回已用与总内存，已用内存按 MemTotal - MemAvailable 计算
+func readMemInfo(path string) (used, total uint64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	var available uint64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = value * 1024
+		case "MemAvailable:":
+			available = value * 1024
+		}
+	}
+	if total < available {
+		return 0, total, nil
+	}
+	return total - available, total, nil
+}
+
+func readLoadAvg(path string) (load1, load5, load15 float64, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return 0, 0, 0, fmt.Errorf("无法解析 %s", path)
+	}
+	values := make([]float64, 3)
+	for i := range values {
+		if values[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return values[0], values[1], values[2], nil
+}
+
+// readInterfaceBytes 汇总除 lo 外所有网卡的收发字节数
+func readInterfaceBytes(netDir string) (rx, tx uint64) {
+	entries, err := os.ReadDir(netDir)
+	if err != nil {
+		return 0, 0
+	}
+	for _, entry := range entries {
+		if entry.Name() == "lo" {
+			continue
+		}
+		base := filepath.Join(netDir, entry.Name(), "statistics")
+		if value, err := readUintFromFile(filepath.Join(base, "rx_bytes")); err == nil {
+			rx += value
+		}
+		if value, err := readUintFromFile(filepath.Join(base, "tx_bytes")); err == nil {
+			tx += value
+		}
+	}
+	return rx, tx
+}
+
+// parseMetricsRange 解析 30m、24h、7d 形式的时间范围
+func parseMetricsRange(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 24 * time.Hour, nil
+	}
+	var window time.Duration
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", ErrInvalidMetricsRange, raw)
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", ErrInvalidMetricsRange, raw)
+		}
+		window = parsed
+	}
+	if window < systemMetricsInterval || window > systemMetricsRetain {
+		return 0, fmt.Errorf("%w: 需在 1m 到 7d 之间", ErrInvalidMetricsRange)
+	}
+	return window, nil
+}
+
+// Query 返回最近一段时间的采样，点数超过 systemMetricsMaxPoints 时按步长对齐的时间桶取平均
+func (s *SystemMetricsService) Query(rawRange string, now time.Time) (*model.SystemMetrics, error) {
+	window, err := parseMetricsRange(rawRange)
+	if err != nil {
+		return nil, err
+	}
+	step := systemMetricsInterval
+	if buckets := window / systemMetricsMaxPoints; buckets > step {
+		step = (buckets + systemMetricsInterval - 1) / systemMetricsInterval * systemMetricsInterval
+	}
+
+	s.mu.Lock()
+	s.loadLocked()
+	all := s.ring.points()
+	s.mu.Unlock()
+
+	from := now.Add(-window).Unix()
+	result := &model.SystemMetrics{
+		RangeSeconds: int64(window / time.Second),
+		StepSeconds:  int64(step / time.Second),
+		StubStatus:   s.stub != nil && s.stub.Enabled(),
+		Points:       []model.SystemMetricsPoint{},
+	}
+	var sum model.SystemMetricsPoint
+	count, bucket := 0, int64(-1)
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		n := float64(count)
+		result.Points = append(result.Points, model.SystemMetricsPoint{
+			UnixTime:      bucket * result.StepSeconds,
+			CPUPercent:    sum.CPUPercent / n,
+			MemUsedBytes:  sum.MemUsedBytes / uint64(count),
+			MemTotalBytes: sum.MemTotalBytes,
+			Load1:         sum.Load1 / n,
+			Load5:         sum.Load5 / n,
+			Load15:        sum.Load15 / n,
+			RXBytesPerSec: sum.RXBytesPerSec / n,
+			TXBytesPerSec: sum.TXBytesPerSec / n,
+
+			NginxActiveConnections: sum.NginxActiveConnections / n,
+			NginxAcceptsPerSec:     sum.NginxAcceptsPerSec / n,
+			NginxHandledPerSec:     sum.NginxHandledPerSec / n,
+			NginxRequestsPerSec:    sum.NginxRequestsPerSec / n,
+		})
+	}
+	for _, point := range all {
+		if point.UnixTime <= from || point.UnixTime > now.Unix() {
+			continue
+		}
+		if index := point.UnixTime / result.StepSeconds; index != bucket {
+			flush()
+			sum, count, bucket = model.SystemMetricsPoint{}, 0, index
+		}
+		sum.CPUPercent += point.CPUPercent
+		sum.MemUsedBytes += point.MemUsedBytes
+		sum.MemTotalBytes = point.MemTotalBytes
+		sum.Load1 += point.Load1
+		sum.Load5 += point.Load5
+		sum.Load15 += point.Load15
+		sum.RXBytesPerSec += point.RXBytesPerSec
+		sum.TXBytesPerSec += point.TXBytesPerSec
+		sum.NginxActiveConnections += point.NginxActiveConnections
+		sum.NginxAcceptsPerSec += point.NginxAcceptsPerSec
+		sum.NginxHandledPerSec += point.NginxHandledPerSec
+		sum.NginxRequestsPerSec += point.NginxRequestsPerSec
+		count++
+	}
+	flush()
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSystemMetrics(t *testing.T) {
+	dir := t.TempDir()
+	svc := NewSystemMetricsService(nil)
+	svc.ProcDir = filepath.Join(dir, "proc")
+	svc.NetDir = filepath.Join(dir, "net")
+	svc.path = filepath.Join(dir, "metrics.json")
+	os.MkdirAll(svc.ProcDir, 0755)
+	os.MkdirAll(filepath.Join(svc.NetDir, "eth0", "statistics"), 0755)
+	os.MkdirAll(filepath.Join(svc.NetDir, "lo", "statistics"), 0755)
+
+	write := func(cpu, rx string) {
+		os.WriteFile(filepath.Join(svc.ProcDir, "stat"), []byte(cpu+"\ncpu0 1 2 3 4\n"), 0644)
+		os.WriteFile(filepath.Join(svc.NetDir, "eth0", "statistics", "rx_bytes"), []byte(rx), 0644)
+		os.WriteFile(filepath.Join(svc.NetDir, "eth0", "statistics", "tx_bytes"), []byte("1000"), 0644)
+		os.WriteFile(filepath.Join(svc.NetDir, "lo", "statistics", "rx_bytes"), []byte("999999"), 0644)
+	}
+	os.WriteFile(filepath.Join(svc.ProcDir, "meminfo"), []byte("MemTotal:       2048 kB\nMemFree:         512 kB\nMemAvailable:   1024 kB\n"), 0644)
+	os.WriteFile(filepath.Join(svc.ProcDir, "loadavg"), []byte("0.50 0.25 0.10 1/100 1234\n"), 0644)
+
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	write("cpu  100 0 100 700 100 0 0 0 0 0", "6000")
+	svc.Sample(now)
+	// user+system 增加 50，idle+iowait 增加 150
+	write("cpu  125 0 125 800 150 0 0 0 0 0", "12000")
+	svc.Sample(now.Add(time.Minute))
+	write("cpu  125 0 125 800 150 0 0 0 0 0", "100")
+	svc.Sample(now.Add(2 * time.Minute))
+
+	metrics, err := svc.Query("1h", now.Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if metrics.StepSeconds != 60 || len(metrics.Points) != 2 {
+		t.Fatalf("unexpected metrics: %+v", metrics)
+	}
+	point := metrics.Points[0]
+	if point.CPUPercent != 25 || point.RXBytesPerSec != 100 || point.TXBytesPerSec != 0 ||
+		point.MemUsedBytes != 1024*1024 || point.MemTotalBytes != 2048*1024 || point.Load1 != 0.5 {
+		t.Fatalf("unexpected point: %+v", point)
+	}
+	if metrics.Points[1].RXBytesPerSec != 0 {
+		t.Fatalf("counter reset should not produce a rate: %+v", metrics.Points[1])
+	}
+
+	// 较长的范围按时间分桶取平均，落盘后重启仍可查询
+	svc.mu.Lock()
+	svc.saveLocked()
+	svc.mu.Unlock()
+	restarted := NewSystemMetricsService(nil)
+	restarted.path = svc.path
+	weekly, err := restarted.Query("7d", now.Add(2*time.Minute))
+	if err != nil || weekly.StepSeconds != 1680 || len(weekly.Points) != 1 || weekly.Points[0].CPUPercent != 12.5 {
+		t.Fatalf("unexpected weekly metrics: %+v, %v", weekly, err)
+	}
+
+	for _, raw := range []string{"8d", "10s", "abc", "-1h"} {
+		if _, err := svc.Query(raw, now); !errors.Is(err, ErrInvalidMetricsRange) {
+			t.Fatalf("expected invalid range for %q, got %v", raw, err)
+		}
+	}
+
+	ring := newMetricsRing(3)
+	for i := int64(1); i <= 5; i++ {
+		ring.push(model.SystemMetricsPoint{UnixTime: i})
+	}
+	if points := ring.points(); len(points) != 3 || points[0].UnixTime != 3 || points[2].UnixTime != 5 {
+		t.Fatalf("unexpected ring contents: %+v", points)
+	}
+}
+
+func TestSystemMetricsStubStatus(t *testing.T) {
+	var active, requests atomic.Int64
+	active.Store(10)
+	requests.Store(1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		total := requests.Load()
+		fmt.Fprintf(w, "Active connections: %d \nserver accepts handled requests\n %d %d %d \nReading: 0 Writing: 1 Waiting: 2 \n", active.Load(), total/10, total/10, total)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	stub := NewStubStatusService()
+	stub.ConfDir = dir
+	stub.URL = server.URL
+	svc := NewSystemMetricsService(stub)
+	svc.ProcDir = dir
+	svc.NetDir = dir
+	svc.path = filepath.Join(dir, "metrics.json")
+	os.WriteFile(filepath.Join(dir, "stat"), []byte("cpu  100 0 100 700 100 0 0 0 0 0\n"), 0644)
+
+	// 未配置 stub_status 时不记录 Nginx 计数
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	svc.Sample(now)
+	svc.Sample(now.Add(time.Minute))
+	os.WriteFile(stub.ConfPath(), []byte(renderStubStatusConf()), 0644)
+	svc.Sample(now.Add(2 * time.Minute))
+	active.Store(20)
+	requests.Store(7000)
+	svc.Sample(now.Add(3 * time.Minute))
+	// Nginx 重启后计数归零，本周期速率记为 0
+	requests.Store(100)
+	svc.Sample(now.Add(4 * time.Minute))
+
+	metrics, err := svc.Query("1h", now.Add(4*time.Minute))
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if !metrics.StubStatus || len(metrics.Points) != 4 {
+		t.Fatalf("unexpected metrics: %+v", metrics)
+	}
+	points := metrics.Points
+	if points[0].NginxActiveConnections != 0 || points[0].NginxRequestsPerSec != 0 {
+		t.Fatalf("stub counters should be empty before stub_status is configured: %+v", points[0])
+	}
+	if points[1].NginxActiveConnections != 10 || points[1].NginxRequestsPerSec != 0 {
+		t.Fatalf("first stub sample only records the baseline: %+v", points[1])
+	}
+	if points[2].NginxActiveConnections != 20 || points[2].NginxRequestsPerSec != 100 || points[2].NginxAcceptsPerSec != 10 || points[2].NginxHandledPerSec != 10 {
+		t.Fatalf("unexpected stub rates: %+v", points[2])
+	}
+	if points[3].NginxRequestsPerSec != 0 || points[3].NginxAcceptsPerSec != 0 {
+		t.Fatalf("counter reset should not produce a rate: %+v", points[3])
+	}
+}
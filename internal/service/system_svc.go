@@ -1,7 +1,12 @@
 package service
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"nginx-mgr/internal/executor"
 	"nginx-mgr/internal/model"
 	"os"
@@ -11,6 +16,11 @@ import (
 	"time"
 )
 
+// maxUploadedBackupSize 上传恢复的备份包大小上限
+const maxUploadedBackupSize = 1 << 30
+
+var ErrInvalidBackupArchive = errors.New("备份文件无效")
+
 type SystemService struct {
 	notificationSvc *NotificationService
 	trafficMgr      *TrafficUsageManager
@@ -40,21 +50,29 @@ func (s *SystemService) Reload() error {
 }
 
 func (s *SystemService) Backup() (string, error) {
-	backupDir := "/root/nginx_backups"
+	backupDir := localBackupDir
 	os.MkdirAll(backupDir, 0755)
 
 	filename := fmt.Sprintf("nginx_conf_%s.tar.gz", time.Now().Format("20060102_150405"))
 	path := filepath.Join(backupDir, filename)
 
-	// 备份 /etc/nginx 和 /var/www/html
-	_, err := executor.ExecuteSimple("tar", "-czf", path, "-C", "/", "etc/nginx", "var/www/html")
+	// 默认备份 /etc/nginx、/var/www/html 与面板状态，可在备份设置中调整
+	include, exclude, err := NewBackupService().archivePaths()
 	if err != nil {
 		return "", err
 	}
+	if err := createBackupArchive(path, include, exclude); err != nil {
+		return "", err
+	}
 	return path, nil
 }
 
-func (s *SystemService) Restore(backupPath string) error {
+// Restore 从备份包恢复，scope 为空时按完整恢复处理
+func (s *SystemService) Restore(backupPath string, scope RestoreScope) error {
+	scope, err := scope.normalize()
+	if err != nil {
+		return err
+	}
 	backupPath = strings.TrimSpace(backupPath)
 	if backupPath == "" {
 		return fmt.Errorf("备份文件路径不能为空")
@@ -84,9 +102,23 @@ func (s *SystemService) Restore(backupPath string) error {
 	if _, err := executor.ExecuteSimple("tar", "-tzf", cleanPath); err != nil {
 		return fmt.Errorf("备份文件校验失败: %w", err)
 	}
+	verified, err := verifyBackupArchive(cleanPath)
+	if err != nil {
+		return err
+	}
+	if !verified.Valid {
+		return fmt.Errorf("%w: 完整性校验未通过，%s", ErrInvalidBackupArchive, verified.summary())
+	}
+	if !verified.HasManifest {
+		log.Printf("[restore] %s 没有文件清单，跳过完整性校验", verified.Archive)
+	}
+	if scope.Scope != RestoreScopeFull {
+		return s.restoreScoped(cleanPath, scope)
+	}
 
 	currentBackup := fmt.Sprintf("/tmp/nginx_pre_restore_%d.tar.gz", time.Now().Unix())
-	if _, err := executor.ExecuteSimple("tar", "-czf", currentBackup, "-C", "/", "etc/nginx", "var/www/html"); err != nil {
+	current := append([]string{model.NginxConfDir, "/var/www/html"}, panelStatePaths(false)...)
+	if err := createBackupArchive(currentBackup, current, nil); err != nil {
 		return fmt.Errorf("当前配置备份失败: %w", err)
 	}
 	defer os.Remove(currentBackup)
@@ -137,35 +169,121 @@ func (s *SystemService) Restore(backupPath string) error {
 	return nil
 }
 
-func (s *SystemService) Stop() error {
-	_, err := executor.ExecuteSimple("systemctl", "stop", "nginx")
-	return err
+// RestoreUpload 恢复从其他服务器上传的备份包，用于迁移
+func (s *SystemService) RestoreUpload(filename string, src io.Reader, scope RestoreScope) error {
+	scope, err := scope.normalize()
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(filename, ".tar.gz") && !strings.HasSuffix(filename, ".tgz") {
+		return fmt.Errorf("%w: 仅支持 .tar.gz 格式", ErrInvalidBackupArchive)
+	}
+	tmp, err := os.CreateTemp("", "nginx_upload_*.tar.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	written, err := io.Copy(tmp, io.LimitReader(src, maxUploadedBackupSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("保存上传文件失败: %w", err)
+	}
+	if written > maxUploadedBackupSize {
+		return fmt.Errorf("%w: 文件超过 %d MB", ErrInvalidBackupArchive, maxUploadedBackupSize>>20)
+	}
+	if err := validateBackupArchive(tmp.Name()); err != nil {
+		return err
+	}
+	return s.Restore(tmp.Name(), scope)
 }
 
-func (s *SystemService) Uninstall() error {
-	cmd := buildAcmeScriptCommand([]string{"15", "YES", "", "0"})
-	out, err := executor.ExecuteSimple("bash", "-c", cmd)
+// validateBackupArchive 解压前检查备份包：必须包含 Nginx 配置，且不能含有越界路径或设备文件
+func validateBackupArchive(path string) error {
+	file, err := os.Open(path)
 	if err != nil {
-		msg := strings.TrimSpace(out)
-		if msg == "" {
-			msg = err.Error()
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("%w: 不是有效的 gzip 文件", ErrInvalidBackupArchive)
+	}
+	defer gz.Close()
+
+	reader := tar.NewReader(gz)
+	hasNginx := false
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: 读取归档失败: %v", ErrInvalidBackupArchive, err)
+		}
+		name := strings.TrimPrefix(header.Name, "./")
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") || strings.Contains(name, "/../") {
+			return fmt.Errorf("%w: 包含非法路径 %s", ErrInvalidBackupArchive, header.Name)
 		}
-		return fmt.Errorf("卸载脚本执行失败: %s", msg)
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeDir, tar.TypeSymlink, tar.TypeLink:
+		default:
+			return fmt.Errorf("%w: 不支持的文件类型 %s", ErrInvalidBackupArchive, header.Name)
+		}
+		if strings.HasPrefix(name, "etc/nginx/") || strings.HasPrefix(name, "nginx/") || name == "nginx.conf" {
+			hasNginx = true
+		}
+	}
+	if !hasNginx {
+		return fmt.Errorf("%w: 未找到 Nginx 配置", ErrInvalidBackupArchive)
 	}
 	return nil
 }
 
+// VerifyBackup 校验本地备份包的完整性，path 为目录时校验其中最新的备份
+func (s *SystemService) VerifyBackup(path string) (BackupVerifyResult, error) {
+	cleanPath, err := resolveLocalBackup(path)
+	if err != nil {
+		return BackupVerifyResult{}, err
+	}
+	return verifyBackupArchive(cleanPath)
+}
+
+func (s *SystemService) Stop() error {
+	_, err := executor.ExecuteSimple("systemctl", "stop", "nginx")
+	return err
+}
+
 func (s *SystemService) GetStatus() (map[string]interface{}, error) {
 	status := make(map[string]interface{})
+	status["nginx_active"], status["nginx_version"] = s.NginxState()
+	status["network_traffic"] = s.collectNetworkTraffic()
 
-	out, _ := executor.ExecuteSimple("systemctl", "is-active", "nginx")
-	status["nginx_active"] = (strings.TrimSpace(out) == "active")
+	return status, nil
+}
 
+// NginxState 返回 nginx 服务是否运行以及 nginx -v 输出的版本
+func (s *SystemService) NginxState() (bool, string) {
+	out, _ := executor.ExecuteSimple("systemctl", "is-active", "nginx")
 	version, _ := executor.ExecuteSimple(model.NginxSbinPath, "-v")
-	status["nginx_version"] = strings.TrimSpace(version)
-	status["network_traffic"] = s.collectNetworkTraffic()
+	return strings.TrimSpace(out) == "active", strings.TrimSpace(version)
+}
 
-	return status, nil
+// TrafficCycle 返回当前流量周期的用量
+func (s *SystemService) TrafficCycle() (TrafficCycle, error) {
+	if s.notificationSvc == nil || s.trafficMgr == nil {
+		return TrafficCycle{}, errors.New("未启用流量统计")
+	}
+	settings, err := s.notificationSvc.Get()
+	if err != nil {
+		return TrafficCycle{}, err
+	}
+	current, err := readTrafficSnapshot()
+	if err != nil {
+		return TrafficCycle{}, err
+	}
+	return s.trafficMgr.Snapshot(settings, current.TotalBytes)
 }
 
 func (s *SystemService) collectNetworkTraffic() model.NetworkTraffic {
@@ -215,31 +333,7 @@ func (s *SystemService) collectNetworkTraffic() model.NetworkTraffic {
 }
 
 func (s *SystemService) applyExtractedArchive(root string) error {
-	type copyTask struct {
-		src  string
-		dest string
-	}
-
-	var tasks []copyTask
-
-	etcDir := filepath.Join(root, "etc", "nginx")
-	varDir := filepath.Join(root, "var", "www", "html")
-	altNginxDir := filepath.Join(root, "nginx")
-
-	if dirExists(etcDir) {
-		tasks = append(tasks, copyTask{src: etcDir, dest: model.NginxConfDir})
-	}
-	if dirExists(varDir) {
-		tasks = append(tasks, copyTask{src: varDir, dest: "/var/www/html"})
-	}
-	if dirExists(altNginxDir) && !dirExists(etcDir) {
-		tasks = append(tasks, copyTask{src: altNginxDir, dest: model.NginxConfDir})
-	}
-	if len(tasks) == 0 {
-		tasks = append(tasks, copyTask{src: root, dest: model.NginxConfDir})
-	}
-
-	for _, task := range tasks {
+	for _, task := range fullRestoreTargets(root, model.NginxConfDir, defaultWebRoot) {
 		if err := os.MkdirAll(task.dest, 0755); err != nil {
 			return fmt.Errorf("创建目录失败 %s: %w", task.dest, err)
 		}
@@ -249,6 +343,13 @@ func (s *SystemService) applyExtractedArchive(root string) error {
 			return fmt.Errorf("复制 %s 至 %s 失败: %w", task.src, task.dest, err)
 		}
 	}
+	restored, err := restorePanelState(root)
+	if err != nil {
+		return fmt.Errorf("恢复面板状态失败: %w", err)
+	}
+	if len(restored) > 0 {
+		log.Printf("[restore] 已恢复面板状态 %d 项，重启面板后生效", len(restored))
+	}
 	return nil
 }
 
@@ -297,7 +398,7 @@ func (s *SystemService) restoreFromBackup(backupFile string) error {
 	}
 	_, _ = executor.ExecuteSimple("systemctl", "stop", "nginx")
 	_, _ = executor.ExecuteSimple("pkill", "-9", "nginx")
-	if _, err := executor.ExecuteSimple("tar", "-xzf", backupFile, "-C", "/"); err != nil {
+	if _, err := executor.ExecuteSimple("tar", "-xzf", backupFile, "-C", "/", "--exclude="+backupManifestName); err != nil {
 		return err
 	}
 	if _, err := executor.ExecuteSimple("systemctl", "start", "nginx"); err != nil {
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTestArchive(t *testing.T, entries map[string]byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "backup.tar.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for name, typeflag := range entries {
+		header := &tar.Header{Name: name, Typeflag: typeflag, Mode: 0644}
+		if typeflag == tar.TypeReg {
+			header.Size = 1
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("write header: %v", err)
+		}
+		if typeflag == tar.TypeReg {
+			tw.Write([]byte("x"))
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return path
+}
+
+func TestValidateBackupArchive(t *testing.T) {
+	valid := writeTestArchive(t, map[string]byte{
+		"etc/nginx/":           tar.TypeDir,
+		"etc/nginx/nginx.conf": tar.TypeReg,
+		"var/www/html/a.html":  tar.TypeReg,
+	})
+	if err := validateBackupArchive(valid); err != nil {
+		t.Fatalf("valid archive rejected: %v", err)
+	}
+
+	for name, entries := range map[string]map[string]byte{
+		"traversal": {"etc/nginx/nginx.conf": tar.TypeReg, "etc/nginx/../../root/.ssh/authorized_keys": tar.TypeReg},
+		"absolute":  {"etc/nginx/nginx.conf": tar.TypeReg, "/etc/passwd": tar.TypeReg},
+		"device":    {"etc/nginx/nginx.conf": tar.TypeReg, "etc/nginx/null": tar.TypeChar},
+		"no nginx":  {"home/user/notes.txt": tar.TypeReg},
+	} {
+		if err := validateBackupArchive(writeTestArchive(t, entries)); !errors.Is(err, ErrInvalidBackupArchive) {
+			t.Fatalf("%s: expected invalid archive, got %v", name, err)
+		}
+	}
+
+	plain := filepath.Join(t.TempDir(), "plain.tar.gz")
+	os.WriteFile(plain, []byte("not gzip"), 0644)
+	if err := validateBackupArchive(plain); !errors.Is(err, ErrInvalidBackupArchive) {
+		t.Fatalf("non-gzip file should be rejected, got %v", err)
+	}
+}
+
+func TestRestoreScope(t *testing.T) {
+	for _, scope := range []RestoreScope{{Scope: "everything"}, {Scope: "domain"}, {Scope: "domain", Domain: "../etc"}} {
+		if _, err := scope.normalize(); !errors.Is(err, ErrInvalidRestoreScope) {
+			t.Fatalf("%+v: expected invalid scope, got %v", scope, err)
+		}
+	}
+	if scope, err := (RestoreScope{}).normalize(); err != nil || scope.Scope != RestoreScopeFull {
+		t.Fatalf("empty scope should mean full restore: %+v, %v", scope, err)
+	}
+
+	archive := t.TempDir()
+	nginxDir := filepath.Join(archive, "etc", "nginx")
+	os.MkdirAll(filepath.Join(nginxDir, "sites-available"), 0755)
+	os.MkdirAll(filepath.Join(nginxDir, "sites-enabled"), 0755)
+	os.WriteFile(filepath.Join(nginxDir, "sites-available", "a.com"), []byte("backup a"), 0644)
+	os.Symlink("../sites-available/a.com", filepath.Join(nginxDir, "sites-enabled", "a.com"))
+	os.MkdirAll(filepath.Join(archive, "var", "www", "html", "a.com"), 0755)
+	os.WriteFile(filepath.Join(archive, "var", "www", "html", "a.com", "index.html"), []byte("backup page"), 0644)
+
+	live := t.TempDir()
+	confDir := filepath.Join(live, "nginx")
+	os.MkdirAll(filepath.Join(confDir, "sites-available"), 0755)
+	os.MkdirAll(filepath.Join(confDir, "sites-enabled"), 0755)
+	os.WriteFile(filepath.Join(confDir, "sites-available", "a.com"), []byte("live a"), 0644)
+	os.WriteFile(filepath.Join(confDir, "sites-available", "b.com"), []byte("live b"), 0644)
+
+	if _, err := restoreScopeTargets(RestoreScope{Scope: RestoreScopeStreams}, archive, confDir, defaultWebRoot); !errors.Is(err, ErrInvalidRestoreScope) {
+		t.Fatalf("missing streams should be rejected, got %v", err)
+	}
+	if _, err := restoreScopeTargets(RestoreScope{Scope: RestoreScopeDomain, Domain: "c.com"}, archive, confDir, defaultWebRoot); !errors.Is(err, ErrInvalidRestoreScope) {
+		t.Fatalf("missing domain should be rejected, got %v", err)
+	}
+
+	targets, err := restoreScopeTargets(RestoreScope{Scope: RestoreScopeDomain, Domain: "a.com"}, archive, confDir, defaultWebRoot)
+	if err != nil {
+		t.Fatalf("domain targets: %v", err)
+	}
+	if len(targets) != 3 || targets[2].dest != filepath.Join(defaultWebRoot, "a.com") {
+		t.Fatalf("unexpected targets %+v", targets)
+	}
+	// 网站目录位于系统路径，只验证站点配置的替换与回滚
+	targets = targets[:2]
+
+	snapshot := filepath.Join(t.TempDir(), "snapshot.tar.gz")
+	if err := createBackupArchive(snapshot, []string{targets[0].dest}, nil); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if err := applyRestoreTargets(targets); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(confDir, "sites-available", "a.com")); string(data) != "backup a" {
+		t.Fatalf("site not restored: %q", data)
+	}
+	if link, err := os.Readlink(filepath.Join(confDir, "sites-enabled", "a.com")); err != nil || link != "../sites-available/a.com" {
+		t.Fatalf("enabled link not restored: %q, %v", link, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(confDir, "sites-available", "b.com")); string(data) != "live b" {
+		t.Fatal("other sites must be left untouched")
+	}
+
+	if err := rollbackRestoreTargets(targets, snapshot); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(confDir, "sites-available", "a.com")); string(data) != "live a" {
+		t.Fatalf("rollback should bring back the live config: %q", data)
+	}
+	if _, err := os.Lstat(filepath.Join(confDir, "sites-enabled", "a.com")); !os.IsNotExist(err) {
+		t.Fatal("rollback should remove the link that did not exist before")
+	}
+}
+
+func TestRestorePreview(t *testing.T) {
+	src := t.TempDir()
+	nginxDir := filepath.Join(src, "etc", "nginx")
+	os.MkdirAll(filepath.Join(nginxDir, "sites-available"), 0755)
+	os.MkdirAll(filepath.Join(nginxDir, "sites-enabled"), 0755)
+	os.WriteFile(filepath.Join(nginxDir, "nginx.conf"), []byte("same"), 0644)
+	os.WriteFile(filepath.Join(nginxDir, "sites-available", "a.com"), []byte("backup a"), 0644)
+	os.WriteFile(filepath.Join(nginxDir, "sites-available", "c.com"), []byte("backup c"), 0644)
+	os.Symlink("../sites-available/a.com", filepath.Join(nginxDir, "sites-enabled", "a.com"))
+	archive := filepath.Join(t.TempDir(), "backup.tar.gz")
+	if out, err := exec.Command("tar", "-czf", archive, "-C", src, ".").CombinedOutput(); err != nil {
+		t.Fatalf("tar: %v %s", err, out)
+	}
+
+	live := t.TempDir()
+	confDir := filepath.Join(live, "nginx")
+	webRoot := filepath.Join(live, "www")
+	os.MkdirAll(filepath.Join(confDir, "sites-available"), 0755)
+	os.WriteFile(filepath.Join(confDir, "nginx.conf"), []byte("same"), 0644)
+	os.WriteFile(filepath.Join(confDir, "sites-available", "a.com"), []byte("live a"), 0644)
+	os.WriteFile(filepath.Join(confDir, "sites-available", "b.com"), []byte("live b"), 0644)
+
+	availableA := filepath.Join(confDir, "sites-available", "a.com")
+	availableB := filepath.Join(confDir, "sites-available", "b.com")
+	availableC := filepath.Join(confDir, "sites-available", "c.com")
+	enabledA := filepath.Join(confDir, "sites-enabled", "a.com")
+
+	full, err := previewRestore(archive, RestoreScope{}, confDir, webRoot)
+	if err != nil {
+		t.Fatalf("full preview: %v", err)
+	}
+	if !reflect.DeepEqual(full.Added, []string{availableC, enabledA}) || !reflect.DeepEqual(full.Changed, []string{availableA}) ||
+		len(full.Removed) != 0 || !reflect.DeepEqual(full.Kept, []string{availableB}) || full.Unchanged != 1 {
+		t.Fatalf("unexpected full preview %+v", full)
+	}
+
+	// 按范围恢复会整体替换目录，多出的站点计为删除
+	sites, err := previewRestore(archive, RestoreScope{Scope: RestoreScopeSites}, confDir, webRoot)
+	if err != nil {
+		t.Fatalf("sites preview: %v", err)
+	}
+	if !reflect.DeepEqual(sites.Removed, []string{availableB}) || len(sites.Kept) != 0 || len(sites.Added) != 2 || sites.Unchanged != 0 {
+		t.Fatalf("unexpected sites preview %+v", sites)
+	}
+
+	domain, err := previewRestore(archive, RestoreScope{Scope: RestoreScopeDomain, Domain: "a.com"}, confDir, webRoot)
+	if err != nil {
+		t.Fatalf("domain preview: %v", err)
+	}
+	if !reflect.DeepEqual(domain.Changed, []string{availableA}) || !reflect.DeepEqual(domain.Added, []string{enabledA}) || len(domain.Removed) != 0 {
+		t.Fatalf("unexpected domain preview %+v", domain)
+	}
+	if data, _ := os.ReadFile(availableA); string(data) != "live a" {
+		t.Fatal("preview must not modify live files")
+	}
+}
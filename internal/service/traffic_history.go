@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	trafficHistoryPath     = "/root/traffic_history.json"
+	trafficHistoryInterval = time.Minute
+	trafficHistoryDays     = 90
+	trafficHistoryMonths   = 24
+)
+
+// interfaceHistory 单个网卡的累计记录，LastRX/LastTX 为上次读取的内核计数器，用于计算增量
+type interfaceHistory struct {
+	LastRX uint64                        `json:"last_rx"`
+	LastTX uint64                        `json:"last_tx"`
+	Days   []model.InterfaceTrafficEntry `json:"days"`
+	Months []model.InterfaceTrafficEntry `json:"months"`
+}
+
+type trafficHistoryState struct {
+	UpdatedUnixTime int64                        `json:"updated_unix_time"`
+	BootID          string                       `json:"boot_id"`
+	Interfaces      map[string]*interfaceHistory `json:"interfaces"`
+}
+
+// TrafficHistoryService 每分钟读取各网卡的收发计数器，按天与按月累计增量并落盘。
+// 重启后计数器从零开始，通过 boot_id 与计数器回退识别，不会把重启前的数据重复计入
+type TrafficHistoryService struct {
+	NetDir     string
+	BootIDPath string
+	path       string
+
+	mu     sync.Mutex
+	state  *trafficHistoryState
+	loaded bool
+}
+
+func NewTrafficHistoryService() *TrafficHistoryService {
+	return &TrafficHistoryService{
+		NetDir:     "/sys/class/net",
+		BootIDPath: "/proc/sys/kernel/random/boot_id",
+		path:       trafficHistoryPath,
+	}
+}
+
+func (s *TrafficHistoryService) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ticker := time.NewTicker(trafficHistoryInterval)
+	defer ticker.Stop()
+
+	s.Collect(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Collect(time.Now())
+		}
+	}
+}
+
+func (s *TrafficHistoryService) loadLocked() error {
+	if s.loaded {
+		return nil
+	}
+	state := &trafficHistoryState{Interfaces: make(map[string]*interfaceHistory)}
+	data, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return fmt.Errorf("解析 %s 失败: %w", s.path, err)
+		}
+		if state.Interfaces == nil {
+			state.Interfaces = make(map[string]*interfaceHistory)
+		}
+	}
+	s.state, s.loaded = state, true
+	return nil
+}
+
+// Collect 读取一次计数器并把增量计入当天与当月
+func (s *TrafficHistoryService) Collect(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		log.Printf("[traffic-history] %v", err)
+		return
+	}
+
+	bootID := ""
+	if data, err := os.ReadFile(s.BootIDPath); err == nil {
+		bootID = strings.TrimSpace(string(data))
+	}
+	rebooted := bootID != "" && s.state.BootID != "" && bootID != s.state.BootID
+	s.state.BootID = bootID
+
+	entries, err := os.ReadDir(s.NetDir)
+	if err != nil {
+		log.Printf("[traffic-history] 读取网卡列表失败: %v", err)
+		return
+	}
+	day, month := now.Format("2006-01-02"), now.Format("2006-01")
+	for _, entry := range entries {
+		name := entry.Name()
+		// 容器的 veth 网卡随容器创建与销毁，流量已体现在宿主机的物理网卡上
+		if name == "lo" || strings.HasPrefix(name, "veth") {
+			continue
+		}
+		base := filepath.Join(s.NetDir, name, "statistics")
+		rx, rxErr := readUintFromFile(filepath.Join(base, "rx_bytes"))
+		tx, txErr := readUintFromFile(filepath.Join(base, "tx_bytes"))
+		if rxErr != nil || txErr != nil {
+			continue
+		}
+		history := s.state.Interfaces[name]
+		if history == nil {
+			// 首次出现的网卡只记录基准值
+			s.state.Interfaces[name] = &interfaceHistory{LastRX: rx, LastTX: tx}
+			continue
+		}
+		deltaRX, deltaTX := counterDelta(history.LastRX, rx, rebooted), counterDelta(history.LastTX, tx, rebooted)
+		history.LastRX, history.LastTX = rx, tx
+		history.Days = addTrafficEntry(history.Days, day, deltaRX, deltaTX, trafficHistoryDays)
+		history.Months = addTrafficEntry(history.Months, month, deltaRX, deltaTX, trafficHistoryMonths)
+	}
+	s.state.UpdatedUnixTime = now.Unix()
+
+	data, err := json.Marshal(s.state)
+	if err == nil {
+		err = os.WriteFile(s.path, data, 0600)
+	}
+	if err != nil {
+		log.Printf("[traffic-history] 保存 %s 失败: %v", s.path, err)
+	}
+}
+
+// counterDelta 计算计数器增量。重启或网卡重建后计数器从零重新累计，此时当前值即为增量
+func counterDelta(last, current uint64, reset bool) uint64 {
+	if reset || current < last {
+		return current
+	}
+	return current - last
+}
+
+// addTrafficEntry 累加到 period 对应的记录并只保留最近 keep 条
+func addTrafficEntry(entries []model.InterfaceTrafficEntry, period string, rx, tx uint64, keep int) []model.InterfaceTrafficEntry {
+	idx := sort.Search(len(entries), func(i int) bool { return entries[i].Period >= period })
+	if idx == len(entries) || entries[idx].Period != period {
+		entries = append(entries, model.InterfaceTrafficEntry{})
+		copy(entries[idx+1:], entries[idx:])
+		entries[idx] = model.InterfaceTrafficEntry{Period: period}
+	}
+	entries[idx].RXBytes += rx
+	entries[idx].TXBytes += tx
+	entries[idx].TotalBytes = entries[idx].RXBytes + entries[idx].TXBytes
+	if len(entries) > keep {
+		entries = append(entries[:0], entries[len(entries)-keep:]...)
+	}
+	return entries
+}
+
+// History 返回各网卡的按天与按月记录，iface 非空时只返回该网卡，days 限制返回的天数（0 表示全部）
+func (s *TrafficHistoryService) History(iface string, days int) (*model.TrafficHistory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(s.state.Interfaces))
+	for name := range s.state.Interfaces {
+		if iface == "" || name == iface {
+			names = append(names, name)
+		}
+	}
+	if iface != "" && len(names) == 0 {
+		return nil, os.ErrNotExist
+	}
+	sort.Strings(names)
+
+	history := &model.TrafficHistory{UpdatedUnixTime: s.state.UpdatedUnixTime, Interfaces: []model.InterfaceTrafficHistory{}}
+	for _, name := range names {
+		record := s.state.Interfaces[name]
+		daily := record.Days
+		if days > 0 && len(daily) > days {
+			daily = daily[len(daily)-days:]
+		}
+		history.Interfaces = append(history.Interfaces, model.InterfaceTrafficHistory{
+			Interface: name,
+			Days:      append([]model.InterfaceTrafficEntry{}, daily...),
+			Months:    append([]model.InterfaceTrafficEntry{}, record.Months...),
+		})
+	}
+	return history, nil
+}
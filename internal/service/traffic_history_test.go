@@ -0,0 +1,69 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTrafficHistoryCollect(t *testing.T) {
+	dir := t.TempDir()
+	svc := &TrafficHistoryService{
+		NetDir:     filepath.Join(dir, "net"),
+		BootIDPath: filepath.Join(dir, "boot_id"),
+		path:       filepath.Join(dir, "traffic_history.json"),
+	}
+	setCounters := func(iface string, rx, tx uint64) {
+		base := filepath.Join(svc.NetDir, iface, "statistics")
+		os.MkdirAll(base, 0755)
+		os.WriteFile(filepath.Join(base, "rx_bytes"), []byte(strconv.FormatUint(rx, 10)+"\n"), 0644)
+		os.WriteFile(filepath.Join(base, "tx_bytes"), []byte(strconv.FormatUint(tx, 10)+"\n"), 0644)
+	}
+	os.WriteFile(svc.BootIDPath, []byte("boot-a\n"), 0644)
+	setCounters("eth0", 1000, 500)
+	setCounters("lo", 9999, 9999)
+
+	day1 := time.Date(2026, 3, 31, 23, 58, 0, 0, time.Local)
+	svc.Collect(day1)
+	setCounters("eth0", 1600, 700)
+	svc.Collect(day1.Add(time.Minute))
+
+	// 跨月后重启，计数器从零开始
+	day2 := time.Date(2026, 4, 1, 0, 5, 0, 0, time.Local)
+	os.WriteFile(svc.BootIDPath, []byte("boot-b\n"), 0644)
+	setCounters("eth0", 300, 100)
+	svc.Collect(day2)
+
+	// 重新加载落盘的状态后继续累计
+	reloaded := &TrafficHistoryService{NetDir: svc.NetDir, BootIDPath: svc.BootIDPath, path: svc.path}
+	setCounters("eth0", 400, 150)
+	reloaded.Collect(day2.Add(time.Minute))
+
+	history, err := reloaded.History("", 0)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(history.Interfaces) != 1 || history.Interfaces[0].Interface != "eth0" {
+		t.Fatalf("unexpected interfaces: %+v", history.Interfaces)
+	}
+	eth0 := history.Interfaces[0]
+	if len(eth0.Days) != 2 || eth0.Days[0].Period != "2026-03-31" || eth0.Days[0].RXBytes != 600 || eth0.Days[0].TXBytes != 200 {
+		t.Fatalf("unexpected days: %+v", eth0.Days)
+	}
+	if eth0.Days[1].RXBytes != 400 || eth0.Days[1].TXBytes != 150 || eth0.Days[1].TotalBytes != 550 {
+		t.Fatalf("unexpected reboot day: %+v", eth0.Days[1])
+	}
+	if len(eth0.Months) != 2 || eth0.Months[0].Period != "2026-03" || eth0.Months[1].Period != "2026-04" {
+		t.Fatalf("unexpected months: %+v", eth0.Months)
+	}
+
+	limited, _ := reloaded.History("eth0", 1)
+	if len(limited.Interfaces[0].Days) != 1 || limited.Interfaces[0].Days[0].Period != "2026-04-01" {
+		t.Fatalf("unexpected limited days: %+v", limited.Interfaces[0].Days)
+	}
+	if _, err := reloaded.History("eth1", 0); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist for unknown interface, got %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"nginx-mgr/internal/executor"
+	"nginx-mgr/internal/model"
+)
+
+// 超出月流量上限后可执行的动作
+const (
+	trafficActionLimitRate    = "limit_rate"
+	trafficActionStopNginx    = "stop_nginx"
+	trafficActionDisableSites = "disable_sites"
+)
+
+// trafficLimiter 执行与撤销超额动作，限速写入 http 级别的 traffic_limit.conf
+type trafficLimiter struct {
+	confDir string
+	run     func(name string, args ...string) (string, error)
+}
+
+func newTrafficLimiter() trafficLimiter {
+	return trafficLimiter{
+		confDir: model.NginxConfDir,
+		run:     executor.ExecuteSimple,
+	}
+}
+
+func (l trafficLimiter) confPath() string {
+	return filepath.Join(l.confDir, "traffic_limit.conf")
+}
+
+// reload 测试配置并重载 Nginx
+func (l trafficLimiter) reload() error {
+	if out, err := l.run(model.NginxSbinPath, "-t"); err != nil {
+		return fmt.Errorf("配置验证失败: %s", strings.TrimSpace(out))
+	}
+	if _, err := l.run("systemctl", "reload", "nginx"); err != nil {
+		return fmt.Errorf("重载 Nginx 失败: %w", err)
+	}
+	return nil
+}
+
+// apply 执行超额动作，返回实际执行的记录；disable_sites 只记录本次停用的站点
+func (l trafficLimiter) apply(cfg model.TrafficLimitActionSettings) (trafficLimitRecord, error) {
+	record := trafficLimitRecord{Action: cfg.Action}
+	switch cfg.Action {
+	case trafficActionLimitRate:
+		if err := os.WriteFile(l.confPath(), []byte(fmt.Sprintf("limit_rate %s;\n", cfg.LimitRate)), 0644); err != nil {
+			return record, err
+		}
+		if err := ensureHTTPInclude(l.confDir, l.confPath()); err != nil {
+			_ = os.WriteFile(l.confPath(), nil, 0644)
+			return record, err
+		}
+		if err := l.reload(); err != nil {
+			_ = os.WriteFile(l.confPath(), nil, 0644)
+			return record, err
+		}
+	case trafficActionStopNginx:
+		if _, err := l.run("systemctl", "stop", "nginx"); err != nil {
+			return record, fmt.Errorf("停止 Nginx 失败: %w", err)
+		}
+	case trafficActionDisableSites:
+		for _, site := range cfg.Sites {
+			enabled := filepath.Join(l.confDir, "sites-enabled", site)
+			if _, err := os.Lstat(enabled); err != nil {
+				continue
+			}
+			if err := os.Remove(enabled); err != nil {
+				return record, err
+			}
+			record.Sites = append(record.Sites, site)
+		}
+		if len(record.Sites) == 0 {
+			return record, nil
+		}
+		if err := l.reload(); err != nil {
+			l.enableSites(record.Sites)
+			return record, err
+		}
+	}
+	return record, nil
+}
+
+// revert 撤销上一周期执行的动作
+func (l trafficLimiter) revert(record trafficLimitRecord) error {
+	switch record.Action {
+	case trafficActionLimitRate:
+		if err := os.WriteFile(l.confPath(), nil, 0644); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return l.reload()
+	case trafficActionStopNginx:
+		if _, err := l.run("systemctl", "start", "nginx"); err != nil {
+			return fmt.Errorf("启动 Nginx 失败: %w", err)
+		}
+	case trafficActionDisableSites:
+		if len(record.Sites) == 0 {
+			return nil
+		}
+		l.enableSites(record.Sites)
+		return l.reload()
+	}
+	return nil
+}
+
+func (l trafficLimiter) enableSites(sites []string) {
+	for _, site := range sites {
+		available := filepath.Join(l.confDir, "sites-available", site)
+		if _, err := os.Stat(available); err != nil {
+			continue
+		}
+		_ = os.Symlink(available, filepath.Join(l.confDir, "sites-enabled", site))
+	}
+}
+
+func describeTrafficAction(record trafficLimitRecord, cfg model.TrafficLimitActionSettings) string {
+	switch record.Action {
+	case trafficActionLimitRate:
+		return fmt.Sprintf("已全局限速 %s/连接", cfg.LimitRate)
+	case trafficActionStopNginx:
+		return "已停止 Nginx"
+	case trafficActionDisableSites:
+		if len(record.Sites) == 0 {
+			return "所选站点均未启用，未停用任何站点"
+		}
+		return "已停用站点 " + strings.Join(record.Sites, "、")
+	default:
+		return "仅通知"
+	}
+}
+
+// checkTrafficLimit 周期流量超过月流量上限时发送告警并执行配置的动作，每个周期只处理一次；
+// 进入新周期后撤销上一周期执行的动作
+func (d *NotificationDispatcher) checkTrafficLimit(settings model.NotificationSettings) {
+	if d.trafficMgr == nil {
+		return
+	}
+	current, err := readTrafficSnapshot()
+	if err != nil || current == nil {
+		return
+	}
+	cycle, err := d.trafficMgr.Snapshot(settings, current.TotalBytes)
+	if err != nil {
+		log.Printf("[notification] 统计周期流量失败: %v", err)
+		return
+	}
+	d.handleTrafficLimit(settings, cycle)
+}
+
+func (d *NotificationDispatcher) handleTrafficLimit(settings model.NotificationSettings, cycle TrafficCycle) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	record, err := d.trafficMgr.limitRecord()
+	if err != nil {
+		log.Printf("[notification] 读取超额记录失败: %v", err)
+		return
+	}
+	serverName := alertServerName(settings)
+	if record != nil && record.CycleStart != cycle.CycleStart.Unix() {
+		revertErr := d.limiter.revert(*record)
+		if revertErr != nil {
+			log.Printf("[notification] 撤销超额动作失败: %v", revertErr)
+		}
+		if err := d.trafficMgr.setLimitRecord(nil); err != nil {
+			log.Printf("[notification] 清除超额记录失败: %v", err)
+		}
+		if record.Action != "" {
+			result := "已撤销上一周期的超额动作"
+			if revertErr != nil {
+				result = fmt.Sprintf("撤销上一周期的超额动作失败: %v", revertErr)
+			}
+			d.dispatch(settings, notifyEventTrafficLimit, fmt.Sprintf("流量周期已重置 · %s", serverName), fmt.Sprintf(
+				"## 🔄 流量周期已重置\n\n* **服务名称**: %s\n* **周期开始**: %s\n* **处理结果**: %s",
+				serverName,
+				cycle.CycleStart.Format("2006-01-02"),
+				result,
+			))
+		}
+		record = nil
+	}
+
+	if cycle.LimitBytes == 0 || cycle.UsedBytes < cycle.LimitBytes || record != nil {
+		return
+	}
+
+	cfg := settings.TrafficLimitAction
+	applied, actionErr := d.limiter.apply(cfg)
+	applied.CycleStart = cycle.CycleStart.Unix()
+	result := describeTrafficAction(applied, cfg)
+	if actionErr != nil {
+		result = fmt.Sprintf("执行失败: %v", actionErr)
+		applied.Action = ""
+		applied.Sites = nil
+	}
+	if err := d.trafficMgr.setLimitRecord(&applied); err != nil {
+		log.Printf("[notification] 保存超额记录失败: %v", err)
+	}
+
+	lines := []string{
+		"## ⛔ 月流量已超额",
+		"",
+		fmt.Sprintf("* **服务名称**: %s", serverName),
+		fmt.Sprintf("* **监测时间**: %s", time.Now().Format("2006-01-02 15:04:05")),
+		fmt.Sprintf("* **当前周期用量**: %s / %s", formatBytes(float64(cycle.UsedBytes)), formatBytes(float64(cycle.LimitBytes))),
+		fmt.Sprintf("* **统计起始**: %s", cycle.CycleStart.Format("2006-01-02")),
+	}
+	if !cycle.NextReset.IsZero() {
+		lines = append(lines, fmt.Sprintf("* **下次流量重置**: %s", cycle.NextReset.Format("2006-01-02")))
+	}
+	lines = append(lines, fmt.Sprintf("* **自动处理**: %s", result))
+	lines = append(lines, d.trafficSiteLines(cycle)...)
+	if applied.Action != "" {
+		lines = append(lines, "", "> 进入下一个流量周期后将自动撤销。")
+	}
+	d.dispatch(settings, notifyEventTrafficLimit, fmt.Sprintf("流量超额 · %s", serverName), strings.Join(lines, "\n"))
+}
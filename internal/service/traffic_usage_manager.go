@@ -6,24 +6,29 @@ import (
 	"math"
 	"nginx-mgr/internal/model"
 	"os"
-	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 )
 
-const defaultTrafficStatePath = "/root/traffic_usage_state.json"
-
 type TrafficUsageManager struct {
-	path string
-	mu   sync.Mutex
+	store *StateStore
+	mu    sync.Mutex
 }
 
 type trafficUsageState struct {
-	BaselineBytes uint64 `json:"baseline_bytes"`
-	CycleStart    int64  `json:"cycle_start_unix"`
-	NextReset     int64  `json:"next_reset_unix"`
-	ExpiryDate    string `json:"expiry_date"`
+	BaselineBytes uint64              `json:"baseline_bytes"`
+	CycleStart    int64               `json:"cycle_start_unix"`
+	NextReset     int64               `json:"next_reset_unix"`
+	ExpiryDate    string              `json:"expiry_date"`
+	Limit         *trafficLimitRecord `json:"limit,omitempty"`
+}
+
+// trafficLimitRecord 记录已处理超额的周期及执行的动作，新周期开始时据此撤销
+type trafficLimitRecord struct {
+	CycleStart int64    `json:"cycle_start_unix"`
+	Action     string   `json:"action"`
+	Sites      []string `json:"sites,omitempty"`
 }
 
 type TrafficCycle struct {
@@ -33,111 +38,131 @@ type TrafficCycle struct {
 	NextReset  time.Time
 }
 
-func NewTrafficUsageManager(path string) *TrafficUsageManager {
-	if path == "" {
-		path = defaultTrafficStatePath
-	}
-	return &TrafficUsageManager{path: path}
+// NewTrafficUsageManager storePath 为状态库路径，留空时使用默认状态库
+func NewTrafficUsageManager(storePath string) *TrafficUsageManager {
+	return &TrafficUsageManager{store: openStateStore(storePath)}
 }
 
 func (m *TrafficUsageManager) Snapshot(settings model.NotificationSettings, totalBytes uint64) (TrafficCycle, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	state, err := m.loadState()
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		return TrafficCycle{}, err
-	}
-	now := time.Now()
+	var cycle TrafficCycle
+	err := m.updateState(func(state *trafficUsageState) (*trafficUsageState, error) {
+		now := time.Now()
 
-	// Ensure defaults.
-	if state == nil {
-		state = &trafficUsageState{
-			BaselineBytes: totalBytes,
-			CycleStart:    now.Unix(),
+		// Ensure defaults.
+		if state == nil {
+			state = &trafficUsageState{
+				BaselineBytes: totalBytes,
+				CycleStart:    now.Unix(),
+			}
 		}
-	}
-
-	if totalBytes < state.BaselineBytes {
-		// Counter wrapped (e.g., system reboot). Reset baseline to current.
-		state.BaselineBytes = totalBytes
-		state.CycleStart = now.Unix()
-		state.NextReset = 0
-	}
-
-	var nextReset time.Time
 
-	if strings.TrimSpace(settings.ServerExpiryDate) == "" {
-		state.ExpiryDate = ""
-		state.NextReset = 0
-		nextReset = time.Time{}
-	} else {
-		if state.ExpiryDate != settings.ServerExpiryDate {
+		if totalBytes < state.BaselineBytes {
+			// Counter wrapped (e.g., system reboot). Reset baseline to current.
 			state.BaselineBytes = totalBytes
 			state.CycleStart = now.Unix()
+			state.NextReset = 0
 		}
-		nextReset = computeNextReset(now, settings.ServerExpiryDate)
-		if nextReset.IsZero() {
+
+		var nextReset time.Time
+
+		if strings.TrimSpace(settings.ServerExpiryDate) == "" {
+			state.ExpiryDate = ""
 			state.NextReset = 0
+			nextReset = time.Time{}
 		} else {
-			// If current next reset passed or differs from expected, update.
-			if state.NextReset == 0 || now.Unix() >= state.NextReset || absDuration(nextReset.Unix()-state.NextReset) > int64(12*time.Hour/time.Second) {
+			if state.ExpiryDate != settings.ServerExpiryDate {
 				state.BaselineBytes = totalBytes
 				state.CycleStart = now.Unix()
-				state.NextReset = nextReset.Unix()
+			}
+			nextReset = computeNextReset(now, settings.ServerExpiryDate)
+			if nextReset.IsZero() {
+				state.NextReset = 0
 			} else {
-				nextReset = time.Unix(state.NextReset, 0)
-				if now.Unix() >= state.NextReset {
+				// If current next reset passed or differs from expected, update.
+				if state.NextReset == 0 || now.Unix() >= state.NextReset || absDuration(nextReset.Unix()-state.NextReset) > int64(12*time.Hour/time.Second) {
 					state.BaselineBytes = totalBytes
 					state.CycleStart = now.Unix()
-					nextReset = computeNextReset(now.Add(time.Second), settings.ServerExpiryDate)
 					state.NextReset = nextReset.Unix()
+				} else {
+					nextReset = time.Unix(state.NextReset, 0)
+					if now.Unix() >= state.NextReset {
+						state.BaselineBytes = totalBytes
+						state.CycleStart = now.Unix()
+						nextReset = computeNextReset(now.Add(time.Second), settings.ServerExpiryDate)
+						state.NextReset = nextReset.Unix()
+					}
 				}
 			}
+			state.ExpiryDate = settings.ServerExpiryDate
 		}
-		state.ExpiryDate = settings.ServerExpiryDate
-	}
-
-	used := totalBytes - state.BaselineBytes
 
-	if err := m.saveState(state); err != nil {
+		cycle = TrafficCycle{
+			UsedBytes:  totalBytes - state.BaselineBytes,
+			CycleStart: time.Unix(state.CycleStart, 0),
+			NextReset:  nextReset,
+		}
+		return state, nil
+	})
+	if err != nil {
 		return TrafficCycle{}, err
 	}
 
-	limitBytes := uint64(0)
 	if settings.MonthlyTrafficLimit > 0 {
-		limitBytes = uint64(math.Round(settings.MonthlyTrafficLimit * float64(1<<30)))
+		cycle.LimitBytes = uint64(math.Round(settings.MonthlyTrafficLimit * float64(1<<30)))
 	}
-
-	return TrafficCycle{
-		UsedBytes:  used,
-		LimitBytes: limitBytes,
-		CycleStart: time.Unix(state.CycleStart, 0),
-		NextReset:  nextReset,
-	}, nil
+	return cycle, nil
 }
 
 func (m *TrafficUsageManager) loadState() (*trafficUsageState, error) {
-	data, err := os.ReadFile(m.path)
-	if err != nil {
-		return nil, err
-	}
 	var state trafficUsageState
-	if err := json.Unmarshal(data, &state); err != nil {
+	if err := m.store.Get(stateKeyTrafficUsage, &state); err != nil {
 		return nil, err
 	}
 	return &state, nil
 }
 
-func (m *TrafficUsageManager) saveState(state *trafficUsageState) error {
-	if err := os.MkdirAll(filepath.Dir(m.path), 0700); err != nil {
-		return err
-	}
-	data, err := json.MarshalIndent(state, "", "  ")
+// updateState 在状态库的同一次加锁内读取并写回流量状态，尚无记录时 fn 收到 nil
+func (m *TrafficUsageManager) updateState(fn func(state *trafficUsageState) (*trafficUsageState, error)) error {
+	return m.store.Update(stateKeyTrafficUsage, func(current json.RawMessage) (any, error) {
+		var state *trafficUsageState
+		if current != nil {
+			state = &trafficUsageState{}
+			if err := json.Unmarshal(current, state); err != nil {
+				return nil, err
+			}
+		}
+		return fn(state)
+	})
+}
+
+// limitRecord 返回当前记录的超额处理情况，未超额过时返回 nil
+func (m *TrafficUsageManager) limitRecord() (*trafficLimitRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, err := m.loadState()
 	if err != nil {
-		return err
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
 	}
-	return os.WriteFile(m.path, data, 0600)
+	return state.Limit, nil
+}
+
+// setLimitRecord 保存或清除（record 为 nil）超额处理记录
+func (m *TrafficUsageManager) setLimitRecord(record *trafficLimitRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.updateState(func(state *trafficUsageState) (*trafficUsageState, error) {
+		if state == nil {
+			state = &trafficUsageState{}
+		}
+		state.Limit = record
+		return state, nil
+	})
 }
 
 func computeNextReset(now time.Time, expiry string) time.Time {
@@ -0,0 +1,469 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"nginx-mgr/internal/model"
+	"nginx-mgr/internal/nginxconf"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	healthCheckSettingsPath = "/root/health_check_settings.json"
+	healthCheckStatePath    = "/root/upstream_health_state.json"
+)
+
+var ErrInvalidHealthCheckSettings = errors.New("健康检查配置无效")
+
+// UpstreamHealthChecker 定期探测负载均衡站点的后端节点，
+// 开启自动摘除后会将连续失败的节点标记为 down 并重载，恢复后再重新启用
+type UpstreamHealthChecker struct {
+	siteSvc      *SiteService
+	systemSvc    *SystemService
+	settingsPath string
+	statePath    string
+	reload       func() error
+
+	mu      sync.Mutex
+	results map[string]*model.UpstreamHealth
+	ejected map[string]bool
+	lastRun time.Time
+}
+
+type upstreamHealthState struct {
+	Ejected []string `json:"ejected"`
+}
+
+func NewUpstreamHealthChecker(siteSvc *SiteService, systemSvc *SystemService) *UpstreamHealthChecker {
+	if siteSvc == nil {
+		siteSvc = NewSiteService(nil)
+	}
+	if systemSvc == nil {
+		systemSvc = NewSystemService(nil, nil)
+	}
+	checker := &UpstreamHealthChecker{
+		siteSvc:      siteSvc,
+		systemSvc:    systemSvc,
+		settingsPath: healthCheckSettingsPath,
+		statePath:    healthCheckStatePath,
+		reload:       systemSvc.Reload,
+		results:      make(map[string]*model.UpstreamHealth),
+		ejected:      make(map[string]bool),
+	}
+	checker.loadState()
+	return checker
+}
+
+func (c *UpstreamHealthChecker) defaultSettings() model.HealthCheckSettings {
+	return model.HealthCheckSettings{
+		Enabled:         false,
+		IntervalSeconds: 30,
+		TimeoutSeconds:  3,
+		Mode:            "tcp",
+		HTTPPath:        "/",
+		FailThreshold:   3,
+		RiseThreshold:   2,
+		AutoEject:       false,
+	}
+}
+
+func (c *UpstreamHealthChecker) sanitize(input model.HealthCheckSettings) (model.HealthCheckSettings, error) {
+	output := c.defaultSettings()
+	output.Enabled = input.Enabled
+	output.AutoEject = input.AutoEject
+
+	if input.IntervalSeconds > 0 {
+		if input.IntervalSeconds < 5 {
+			input.IntervalSeconds = 5
+		}
+		output.IntervalSeconds = input.IntervalSeconds
+	}
+	if input.TimeoutSeconds > 0 {
+		output.TimeoutSeconds = input.TimeoutSeconds
+	}
+	if output.TimeoutSeconds >= output.IntervalSeconds {
+		output.TimeoutSeconds = output.IntervalSeconds - 1
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(input.Mode))
+	switch mode {
+	case "":
+	case "tcp", "http":
+		output.Mode = mode
+	default:
+		return model.HealthCheckSettings{}, fmt.Errorf("%w: 不支持的探测方式 %s", ErrInvalidHealthCheckSettings, mode)
+	}
+
+	path := strings.TrimSpace(input.HTTPPath)
+	if path != "" {
+		if !strings.HasPrefix(path, "/") {
+			return model.HealthCheckSettings{}, fmt.Errorf("%w: HTTP 探测路径需以 / 开头", ErrInvalidHealthCheckSettings)
+		}
+		output.HTTPPath = path
+	}
+
+	if input.FailThreshold > 0 {
+		output.FailThreshold = input.FailThreshold
+	}
+	if input.RiseThreshold > 0 {
+		output.RiseThreshold = input.RiseThreshold
+	}
+	return output, nil
+}
+
+func (c *UpstreamHealthChecker) GetSettings() (model.HealthCheckSettings, error) {
+	content, err := os.ReadFile(c.settingsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c.defaultSettings(), nil
+		}
+		return model.HealthCheckSettings{}, err
+	}
+	var settings model.HealthCheckSettings
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return model.HealthCheckSettings{}, err
+	}
+	normalized, err := c.sanitize(settings)
+	if err != nil {
+		return c.defaultSettings(), nil
+	}
+	return normalized, nil
+}
+
+func (c *UpstreamHealthChecker) SaveSettings(input model.HealthCheckSettings) (model.HealthCheckSettings, error) {
+	settings, err := c.sanitize(input)
+	if err != nil {
+		return model.HealthCheckSettings{}, err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.HealthCheckSettings{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.settingsPath), 0700); err != nil {
+		return model.HealthCheckSettings{}, err
+	}
+	if err := os.WriteFile(c.settingsPath, data, 0600); err != nil {
+		return model.HealthCheckSettings{}, err
+	}
+	return settings, nil
+}
+
+// Results 返回最近一次探测的结果
+func (c *UpstreamHealthChecker) Results() []model.UpstreamHealth {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	results := make([]model.UpstreamHealth, 0, len(c.results))
+	for _, r := range c.results {
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Site != results[j].Site {
+			return results[i].Site < results[j].Site
+		}
+		return results[i].Address < results[j].Address
+	})
+	return results
+}
+
+func (c *UpstreamHealthChecker) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			settings, err := c.GetSettings()
+			if err != nil {
+				log.Printf("[health] 获取配置失败: %v", err)
+				continue
+			}
+			if !settings.Enabled {
+				continue
+			}
+			if time.Since(c.lastRun) < time.Duration(settings.IntervalSeconds)*time.Second {
+				continue
+			}
+			c.lastRun = time.Now()
+			c.runCycle(settings)
+		}
+	}
+}
+
+func (c *UpstreamHealthChecker) runCycle(settings model.HealthCheckSettings) {
+	configs, err := c.siteSvc.ListSiteConfigs()
+	if err != nil {
+		log.Printf("[health] 读取站点失败: %v", err)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, cfg := range configs {
+		if cfg.Type != "lb" {
+			continue
+		}
+		var wg sync.WaitGroup
+		// changes 本轮需要切换 down 标记的节点地址及目标状态
+		changes := make(map[string]bool)
+		probes := make([]error, len(cfg.Backends))
+		latency := make([]time.Duration, len(cfg.Backends))
+		for i, backend := range cfg.Backends {
+			if backend.Down && !c.isEjected(cfg.Domain, backend.Address) {
+				// 手动标记为 down 的节点不参与探测
+				continue
+			}
+			wg.Add(1)
+			go func(i int, addr string) {
+				defer wg.Done()
+				start := time.Now()
+				probes[i] = probeBackend(settings, addr)
+				latency[i] = time.Since(start)
+			}(i, backend.Address)
+		}
+		wg.Wait()
+
+		c.mu.Lock()
+		for i, backend := range cfg.Backends {
+			key := healthKey(cfg.Domain, backend.Address)
+			if backend.Down && !c.ejected[key] {
+				continue
+			}
+			seen[key] = true
+			result, ok := c.results[key]
+			if !ok {
+				result = &model.UpstreamHealth{Site: cfg.Domain, Address: backend.Address}
+				c.results[key] = result
+			}
+			result.LastCheck = time.Now().Format(time.RFC3339)
+			result.LatencyMs = latency[i].Milliseconds()
+			if probes[i] != nil {
+				result.Healthy = false
+				result.LastError = probes[i].Error()
+				result.ConsecutiveFails++
+				result.ConsecutiveOKs = 0
+			} else {
+				result.Healthy = true
+				result.LastError = ""
+				result.ConsecutiveOKs++
+				result.ConsecutiveFails = 0
+			}
+
+			if !settings.AutoEject {
+				continue
+			}
+			switch {
+			case !backend.Down && result.ConsecutiveFails >= settings.FailThreshold && activeBackends(cfg.Backends) > 1:
+				cfg.Backends[i].Down = true
+				c.ejected[key] = true
+				changes[backend.Address] = true
+				log.Printf("[health] %s 节点 %s 连续 %d 次探测失败，已摘除", cfg.Domain, backend.Address, result.ConsecutiveFails)
+			case backend.Down && c.ejected[key] && result.ConsecutiveOKs >= settings.RiseThreshold:
+				cfg.Backends[i].Down = false
+				delete(c.ejected, key)
+				changes[backend.Address] = false
+				log.Printf("[health] %s 节点 %s 已恢复，重新启用", cfg.Domain, backend.Address)
+			}
+			result.Ejected = c.ejected[key]
+		}
+		c.mu.Unlock()
+
+		if len(changes) > 0 {
+			if err := c.applySite(cfg.Domain, changes); err != nil {
+				log.Printf("[health] 更新站点 %s 失败: %v", cfg.Domain, err)
+				c.loadState()
+				continue
+			}
+			c.saveState()
+		}
+	}
+
+	c.mu.Lock()
+	for key := range c.results {
+		if !seen[key] {
+			delete(c.results, key)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// applySite 持有站点锁重新读取配置，只切换 changes 中节点的 down 标记后重载，失败时回滚。
+// 探测期间通过站点接口做的修改不会被覆盖，其他指令也保持原样；
+// 节点已被删除或已是目标状态（例如用户手动标记了 down）时不再视为自动摘除
+func (c *UpstreamHealthChecker) applySite(domain string, changes map[string]bool) error {
+	defer c.siteSvc.LockSite(domain)()
+	prev, err := c.siteSvc.ReadSiteRaw(domain)
+	if err != nil {
+		return err
+	}
+	updated, applied, err := setBackendsDown(prev, changes)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	for addr := range changes {
+		if !applied[addr] {
+			delete(c.ejected, healthKey(domain, addr))
+			if result, ok := c.results[healthKey(domain, addr)]; ok {
+				result.Ejected = false
+			}
+		}
+	}
+	c.mu.Unlock()
+	if len(applied) == 0 {
+		return nil
+	}
+	if err := c.siteSvc.WriteSiteRaw(domain, updated); err != nil {
+		return err
+	}
+	if err := c.reload(); err != nil {
+		_ = c.siteSvc.WriteSiteRaw(domain, prev)
+		_ = c.reload()
+		return err
+	}
+	return nil
+}
+
+// setBackendsDown 在 upstream 块的 server 指令上添加或去掉 down 参数，返回实际修改过的节点地址
+func setBackendsDown(content string, changes map[string]bool) (string, map[string]bool, error) {
+	tree, err := nginxconf.Parse(content)
+	if err != nil {
+		return "", nil, fmt.Errorf("解析站点配置失败: %w", err)
+	}
+	lines := strings.Split(content, "\n")
+	applied := make(map[string]bool)
+	for _, upstream := range nginxconf.Find(tree, "upstream") {
+		for _, server := range nginxconf.Find(upstream.Block, "server") {
+			addr := server.Arg(0)
+			down, ok := changes[addr]
+			if !ok || slices.Contains(server.Args[1:], "down") == down {
+				continue
+			}
+			idx := server.Line - 1
+			line := lines[idx]
+			// 只处理单行的 server 指令：分号之前为指令本身，之后可能是注释
+			head, tail, found := strings.Cut(line, ";")
+			fields := strings.Fields(head)
+			if !found || len(fields) < 2 || fields[0] != "server" || fields[1] != addr {
+				return "", nil, fmt.Errorf("无法定位节点 %s 的 server 指令（第 %d 行）", addr, server.Line)
+			}
+			if down {
+				fields = append(fields, "down")
+			} else {
+				fields = append(fields[:2], slices.DeleteFunc(fields[2:], func(f string) bool { return f == "down" })...)
+			}
+			indent := head[:len(head)-len(strings.TrimLeft(head, " \t"))]
+			lines[idx] = indent + strings.Join(fields, " ") + ";" + tail
+			applied[addr] = true
+		}
+	}
+	return strings.Join(lines, "\n"), applied, nil
+}
+
+func (c *UpstreamHealthChecker) isEjected(site, addr string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ejected[healthKey(site, addr)]
+}
+
+func (c *UpstreamHealthChecker) loadState() {
+	data, err := os.ReadFile(c.statePath)
+	if err != nil {
+		return
+	}
+	var state upstreamHealthState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ejected = make(map[string]bool, len(state.Ejected))
+	for _, key := range state.Ejected {
+		c.ejected[key] = true
+	}
+}
+
+func (c *UpstreamHealthChecker) saveState() {
+	c.mu.Lock()
+	state := upstreamHealthState{Ejected: make([]string, 0, len(c.ejected))}
+	for key := range c.ejected {
+		state.Ejected = append(state.Ejected, key)
+	}
+	c.mu.Unlock()
+	sort.Strings(state.Ejected)
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.statePath), 0700); err != nil {
+		return
+	}
+	if err := os.WriteFile(c.statePath, data, 0600); err != nil {
+		log.Printf("[health] 保存状态失败: %v", err)
+	}
+}
+
+func healthKey(site, addr string) string {
+	return site + "|" + addr
+}
+
+func activeBackends(backends []model.Backend) int {
+	count := 0
+	for _, b := range backends {
+		if !b.Down && !b.Backup {
+			count++
+		}
+	}
+	return count
+}
+
+func probeBackend(settings model.HealthCheckSettings, addr string) error {
+	timeout := time.Duration(settings.TimeoutSeconds) * time.Second
+	network := "tcp"
+	target := addr
+	if strings.HasPrefix(addr, "unix:") {
+		network = "unix"
+		target = strings.TrimPrefix(addr, "unix:")
+	} else if _, _, err := net.SplitHostPort(addr); err != nil {
+		target = net.JoinHostPort(strings.Trim(addr, "[]"), "80")
+	}
+
+	if settings.Mode != "http" || network == "unix" {
+		conn, err := net.DialTimeout(network, target, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get("http://" + target + settings.HTTPPath)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("HTTP 状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
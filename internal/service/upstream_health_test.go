@@ -0,0 +1,108 @@
+package service
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nginx-mgr/internal/model"
+)
+
+func TestUpstreamHealthAutoEject(t *testing.T) {
+	healthy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer healthy.Close()
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadAddr := dead.Addr().String()
+	dead.Close()
+
+	siteSvc := newTestSiteService(t)
+	site := model.SiteConfig{Domain: "lb.example.com", Type: "lb", Backends: []model.Backend{
+		{Address: healthy.Addr().String()},
+		{Address: deadAddr, Weight: 2},
+	}}
+	if err := siteSvc.CreateSite(site); err != nil {
+		t.Fatalf("create site: %v", err)
+	}
+	// 手工添加的指令不能妨碍自动摘除，也不能被改写
+	original, _ := siteSvc.ReadSiteRaw(site.Domain)
+	original = strings.Replace(original, "server_name", "add_header X-Custom 1;\n    server_name", 1)
+	siteSvc.WriteSiteRaw(site.Domain, original)
+
+	reloads := 0
+	checker := NewUpstreamHealthChecker(siteSvc, nil)
+	checker.statePath = filepath.Join(t.TempDir(), "state.json")
+	checker.ejected = make(map[string]bool)
+	checker.reload = func() error {
+		reloads++
+		return nil
+	}
+	settings := model.HealthCheckSettings{Mode: "tcp", TimeoutSeconds: 1, FailThreshold: 1, RiseThreshold: 1, AutoEject: true}
+
+	// 摘除：只有故障节点的 server 行加上 down
+	checker.runCycle(settings)
+	ejected, _ := siteSvc.ReadSiteRaw(site.Domain)
+	if reloads != 1 || !checker.isEjected(site.Domain, deadAddr) {
+		t.Fatalf("dead backend should be ejected, reloads=%d", reloads)
+	}
+	want := strings.Replace(original, "server "+deadAddr+" weight=2;", "server "+deadAddr+" weight=2 down;", 1)
+	if ejected != want {
+		t.Fatalf("only the down flag should change:\n%s", ejected)
+	}
+
+	// 状态不变时不写入也不重载
+	checker.runCycle(settings)
+	if content, _ := siteSvc.ReadSiteRaw(site.Domain); reloads != 1 || content != ejected {
+		t.Fatalf("no-op cycle should not touch the site, reloads=%d", reloads)
+	}
+
+	// 恢复：节点重新可用后去掉 down，配置与摘除前一致
+	revived, err := net.Listen("tcp", deadAddr)
+	if err != nil {
+		t.Skipf("cannot re-listen on %s: %v", deadAddr, err)
+	}
+	defer revived.Close()
+	checker.runCycle(settings)
+	if content, _ := siteSvc.ReadSiteRaw(site.Domain); reloads != 2 || content != original || checker.isEjected(site.Domain, deadAddr) {
+		t.Fatalf("backend should be restored, reloads=%d:\n%s", reloads, content)
+	}
+}
+
+func TestUpstreamHealthApplyKeepsConcurrentEdits(t *testing.T) {
+	siteSvc := newTestSiteService(t)
+	site := model.SiteConfig{Domain: "lb.example.com", Type: "lb", Backends: []model.Backend{
+		{Address: "10.0.0.3:80"},
+		{Address: "10.0.0.4:80"},
+	}}
+	if err := siteSvc.CreateSite(site); err != nil {
+		t.Fatalf("create site: %v", err)
+	}
+	checker := NewUpstreamHealthChecker(siteSvc, nil)
+	checker.statePath = filepath.Join(t.TempDir(), "state.json")
+	checker.ejected = map[string]bool{healthKey(site.Domain, "10.0.0.4:80"): true, healthKey(site.Domain, "10.0.0.9:80"): true}
+	checker.reload = func() error { return nil }
+
+	// 探测期间用户通过站点接口新增了节点并修改了其他配置
+	edited, _ := siteSvc.ReadSiteRaw(site.Domain)
+	edited = strings.Replace(edited, "server 10.0.0.3:80;", "server 10.0.0.3:80;\n    server 10.0.0.5:80;", 1)
+	edited = strings.Replace(edited, "server_name", "client_max_body_size 20m;\n    server_name", 1)
+	siteSvc.WriteSiteRaw(site.Domain, edited)
+
+	// 10.0.0.9 已被用户删除，不再记为自动摘除
+	if err := checker.applySite(site.Domain, map[string]bool{"10.0.0.4:80": true, "10.0.0.9:80": true}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	content, _ := siteSvc.ReadSiteRaw(site.Domain)
+	if content != strings.Replace(edited, "server 10.0.0.4:80;", "server 10.0.0.4:80 down;", 1) {
+		t.Fatalf("concurrent edits should be kept:\n%s", content)
+	}
+	if !checker.isEjected(site.Domain, "10.0.0.4:80") || checker.isEjected(site.Domain, "10.0.0.9:80") {
+		t.Fatalf("unexpected ejected state: %v", checker.ejected)
+	}
+}
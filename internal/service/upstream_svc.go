@@ -0,0 +1,270 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"nginx-mgr/internal/model"
+	"nginx-mgr/internal/nginxconf"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+var (
+	ErrInvalidUpstream = errors.New("upstream 配置无效")
+	ErrUpstreamInUse   = errors.New("upstream 仍被站点引用")
+)
+
+var upstreamNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// UpstreamService 管理 <ConfDir>/upstreams 下可被多个站点引用的 upstream
+type UpstreamService struct {
+	ConfDir string
+	siteSvc *SiteService
+}
+
+func NewUpstreamService(siteSvc *SiteService) *UpstreamService {
+	if siteSvc == nil {
+		siteSvc = NewSiteService(nil)
+	}
+	return &UpstreamService{
+		ConfDir: model.NginxConfDir,
+		siteSvc: siteSvc,
+	}
+}
+
+func upstreamFilePath(confDir, name string) string {
+	return filepath.Join(confDir, "upstreams", name+".conf")
+}
+
+func (s *UpstreamService) path(name string) string {
+	return upstreamFilePath(s.ConfDir, name)
+}
+
+func (s *UpstreamService) validate(config *model.UpstreamConfig) error {
+	config.Name = strings.TrimSpace(config.Name)
+	if !upstreamNamePattern.MatchString(config.Name) {
+		return fmt.Errorf("%w: 名称只能包含字母、数字、下划线和短横线", ErrInvalidUpstream)
+	}
+	if len(config.Backends) == 0 {
+		return fmt.Errorf("%w: 至少需要一个后端节点", ErrInvalidUpstream)
+	}
+	if config.Keepalive <= 0 {
+		config.Keepalive = 320
+	}
+	// 复用站点的节点与算法校验规则
+	probe := model.SiteConfig{
+		Type:      "lb",
+		Backends:  config.Backends,
+		LBMethod:  config.LBMethod,
+		LBHashKey: config.LBHashKey,
+	}
+	if err := validateSiteOptions(&probe); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidUpstream, strings.TrimPrefix(err.Error(), ErrInvalidSiteOption.Error()+": "))
+	}
+	config.Backends = probe.Backends
+	config.LBMethod = probe.LBMethod
+	config.LBHashKey = probe.LBHashKey
+	return nil
+}
+
+func (s *UpstreamService) render(config model.UpstreamConfig) (string, error) {
+	tmpl, err := template.ParseFS(templateFS, "templates/upstream.tmpl")
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, config); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// SaveUpstream 创建或覆盖 upstream 定义
+func (s *UpstreamService) SaveUpstream(config model.UpstreamConfig) error {
+	if err := s.validate(&config); err != nil {
+		return err
+	}
+	if err := s.checkNameConflict(config.Name); err != nil {
+		return err
+	}
+	content, err := s.render(config)
+	if err != nil {
+		return err
+	}
+	if err := s.ensureInclude(); err != nil {
+		return err
+	}
+	path := s.path(config.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+func (s *UpstreamService) GetUpstream(name string) (*model.UpstreamConfig, error) {
+	if !upstreamNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w: 名称不合法", ErrInvalidUpstream)
+	}
+	content, err := os.ReadFile(s.path(name))
+	if err != nil {
+		return nil, err
+	}
+	tree, err := nginxconf.Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("解析 upstream 配置失败: %w", err)
+	}
+	block := nginxconf.First(tree, "upstream")
+	if block == nil {
+		return nil, fmt.Errorf("%s 中未找到 upstream 块", s.path(name))
+	}
+	cfg := &model.UpstreamConfig{Name: name, Backends: []model.Backend{}}
+	for _, d := range block.Block {
+		switch d.Name {
+		case "least_conn", "ip_hash":
+			cfg.LBMethod = d.Name
+		case "hash":
+			cfg.LBMethod = "hash"
+			cfg.LBHashKey = d.Arg(0)
+		case "keepalive":
+			fmt.Sscanf(d.Arg(0), "%d", &cfg.Keepalive)
+		case "server":
+			backend, err := model.ParseBackend(d.Args)
+			if err != nil {
+				backend = model.Backend{Address: d.Arg(0)}
+			}
+			cfg.Backends = append(cfg.Backends, backend)
+		}
+	}
+	return cfg, nil
+}
+
+func (s *UpstreamService) ListUpstreams() ([]model.UpstreamConfig, error) {
+	entries, err := os.ReadDir(filepath.Join(s.ConfDir, "upstreams"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []model.UpstreamConfig{}, nil
+		}
+		return nil, err
+	}
+	configs := make([]model.UpstreamConfig, 0, len(entries))
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".conf")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		cfg, err := s.GetUpstream(name)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, *cfg)
+	}
+	return configs, nil
+}
+
+func (s *UpstreamService) ReadUpstreamRaw(name string) (string, error) {
+	if !upstreamNamePattern.MatchString(name) {
+		return "", fmt.Errorf("%w: 名称不合法", ErrInvalidUpstream)
+	}
+	content, err := os.ReadFile(s.path(name))
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+func (s *UpstreamService) WriteUpstreamRaw(name, content string) error {
+	path := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// DeleteUpstream 删除未被任何站点引用的 upstream
+func (s *UpstreamService) DeleteUpstream(name string) error {
+	users, err := s.Users(name)
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return fmt.Errorf("%w: %s", ErrUpstreamInUse, strings.Join(users, ", "))
+	}
+	return os.Remove(s.path(name))
+}
+
+// Users 返回引用了指定 upstream 的站点
+func (s *UpstreamService) Users(name string) ([]string, error) {
+	configs, err := s.siteSvc.ListSiteConfigs()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var users []string
+	for _, cfg := range configs {
+		if cfg.Upstream == name {
+			users = append(users, cfg.Domain)
+		}
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+// checkNameConflict 避免与负载均衡站点内联生成的 upstream 重名
+func (s *UpstreamService) checkNameConflict(name string) error {
+	configs, err := s.siteSvc.ListSiteConfigs()
+	if err != nil {
+		return nil
+	}
+	for _, cfg := range configs {
+		if cfg.Type == "lb" && cfg.Upstream == "" && strings.ReplaceAll(cfg.Domain, ".", "_") == name {
+			return fmt.Errorf("%w: 名称与站点 %s 的内置 upstream 冲突", ErrInvalidUpstream, cfg.Domain)
+		}
+	}
+	return nil
+}
+
+// ensureInclude 确保 nginx.conf 的 http 块引入了 upstreams 目录
+func (s *UpstreamService) ensureInclude() error {
+	return ensureHTTPInclude(s.ConfDir, filepath.Join(s.ConfDir, "upstreams", "*.conf"))
+}
+
+// ensureHTTPInclude 在 nginx.conf 中 sites-enabled 的 include 之前插入 include target
+func ensureHTTPInclude(confDir, target string) error {
+	return ensureIncludeBefore(confDir, "sites-enabled", target)
+}
+
+// ensureStreamInclude 在 nginx.conf 中 streams-enabled 的 include 之前插入 include target
+func ensureStreamInclude(confDir, target string) error {
+	return ensureIncludeBefore(confDir, "streams-enabled", target)
+}
+
+func ensureIncludeBefore(confDir, anchor, target string) error {
+	confPath := filepath.Join(confDir, "nginx.conf")
+	data, err := os.ReadFile(confPath)
+	if err != nil {
+		return fmt.Errorf("读取 nginx.conf 失败: %w", err)
+	}
+	content := string(data)
+	includeLine := fmt.Sprintf("include %s;", target)
+	if strings.Contains(content, includeLine) {
+		return nil
+	}
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		trim := strings.TrimSpace(line)
+		if strings.HasPrefix(trim, "include") && strings.Contains(trim, anchor) {
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			lines = append(lines[:i], append([]string{indent + includeLine}, lines[i:]...)...)
+			return os.WriteFile(confPath, []byte(strings.Join(lines, "\n")), 0644)
+		}
+	}
+	return fmt.Errorf("nginx.conf 中未找到 %s 的 include，无法自动引入 %s", anchor, target)
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nginx-mgr/internal/model"
+)
+
+func TestSharedUpstreamReferencedBySites(t *testing.T) {
+	siteSvc := newTestSiteService(t)
+	nginxConf := filepath.Join(siteSvc.ConfDir, "nginx.conf")
+	if err := os.WriteFile(nginxConf, []byte("http {\n    include /etc/nginx/sites-enabled/*;\n}\n"), 0644); err != nil {
+		t.Fatalf("write nginx.conf: %v", err)
+	}
+	upstreamSvc := NewUpstreamService(siteSvc)
+	upstreamSvc.ConfDir = siteSvc.ConfDir
+
+	pool := model.UpstreamConfig{Name: "api_pool", LBMethod: "least_conn", Backends: []model.Backend{{Address: "10.0.0.5:8080", Weight: 2}}}
+	if err := upstreamSvc.SaveUpstream(pool); err != nil {
+		t.Fatalf("save upstream: %v", err)
+	}
+	conf, _ := os.ReadFile(nginxConf)
+	if !strings.Contains(string(conf), "include "+filepath.Join(siteSvc.ConfDir, "upstreams")+"/*.conf;") {
+		t.Fatalf("nginx.conf should include upstreams dir:\n%s", conf)
+	}
+
+	got, err := upstreamSvc.GetUpstream("api_pool")
+	if err != nil {
+		t.Fatalf("get upstream: %v", err)
+	}
+	if got.LBMethod != "least_conn" || len(got.Backends) != 1 || got.Backends[0].Weight != 2 {
+		t.Fatalf("unexpected upstream: %+v", got)
+	}
+
+	for _, site := range []model.SiteConfig{
+		{Domain: "a.example.com", Type: "proxy", Upstream: "api_pool"},
+		{Domain: "b.example.com", Type: "lb", Upstream: "api_pool"},
+	} {
+		if err := siteSvc.CreateSite(site); err != nil {
+			t.Fatalf("create %s: %v", site.Domain, err)
+		}
+		cfg, err := siteSvc.GetSite(site.Domain)
+		if err != nil {
+			t.Fatalf("get %s: %v", site.Domain, err)
+		}
+		if cfg.Upstream != "api_pool" || cfg.BackendIP != "" {
+			t.Fatalf("%s: upstream reference not parsed: %+v", site.Domain, cfg)
+		}
+	}
+
+	if err := upstreamSvc.DeleteUpstream("api_pool"); !errors.Is(err, ErrUpstreamInUse) {
+		t.Fatalf("expected in-use error, got %v", err)
+	}
+	if err := siteSvc.CreateSite(model.SiteConfig{Domain: "c.example.com", Type: "proxy", Upstream: "missing"}); !errors.Is(err, ErrInvalidSiteOption) {
+		t.Fatalf("expected missing upstream to be rejected, got %v", err)
+	}
+}
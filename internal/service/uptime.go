@@ -0,0 +1,446 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	uptimeSettingsPath = "/root/uptime_settings.json"
+	uptimeStatePath    = "/root/uptime_state.json"
+	uptimeRecentChecks = 60
+	uptimeHourRetain   = 7 * 24 * time.Hour
+	uptimeConcurrency  = 8
+)
+
+var ErrInvalidUptimeSettings = errors.New("可用性监测配置无效")
+
+// uptimeHour 一小时内的探测汇总，LatencyMs 为成功探测的耗时之和
+type uptimeHour struct {
+	Start     int64 `json:"start"`
+	Checks    int64 `json:"checks"`
+	Up        int64 `json:"up"`
+	LatencyMs int64 `json:"latency_ms"`
+}
+
+type uptimeSiteState struct {
+	ConsecutiveFails  int                 `json:"consecutive_fails"`
+	DownSinceUnixTime int64               `json:"down_since_unix_time,omitempty"`
+	Alerted           bool                `json:"alerted"`
+	Recent            []model.UptimeCheck `json:"recent"`
+	Hours             []uptimeHour        `json:"hours"`
+}
+
+// UptimeMonitor 定期请求各启用站点，记录响应耗时与可用率，连续失败达到阈值时告警，恢复后再通知一次。
+// 探测经过公网 DNS 与 HTTPS，能发现证书过期、解析错误等后端探测发现不了的问题
+type UptimeMonitor struct {
+	Notifier *NotificationDispatcher
+
+	siteSvc      *SiteService
+	settingsPath string
+	statePath    string
+	// target 返回站点的探测地址，测试中替换为本地服务
+	target func(domain, path string) string
+
+	mu      sync.Mutex
+	sites   map[string]*uptimeSiteState
+	loaded  bool
+	lastRun time.Time
+}
+
+func NewUptimeMonitor(siteSvc *SiteService) *UptimeMonitor {
+	if siteSvc == nil {
+		siteSvc = NewSiteService(nil)
+	}
+	return &UptimeMonitor{
+		siteSvc:      siteSvc,
+		settingsPath: uptimeSettingsPath,
+		statePath:    uptimeStatePath,
+		target: func(domain, path string) string {
+			return "https://" + domain + path
+		},
+	}
+}
+
+func (m *UptimeMonitor) defaultSettings() model.UptimeSettings {
+	return model.UptimeSettings{
+		Enabled:         false,
+		IntervalSeconds: 60,
+		TimeoutSeconds:  10,
+		FailThreshold:   3,
+		Sites:           map[string]model.UptimeSiteSettings{},
+	}
+}
+
+func (m *UptimeMonitor) sanitize(input model.UptimeSettings) (model.UptimeSettings, error) {
+	output := m.defaultSettings()
+	output.Enabled = input.Enabled
+	output.LastUpdatedUnixTime = input.LastUpdatedUnixTime
+	if input.IntervalSeconds > 0 {
+		output.IntervalSeconds = max(input.IntervalSeconds, 30)
+	}
+	if input.TimeoutSeconds > 0 {
+		output.TimeoutSeconds = min(input.TimeoutSeconds, 60)
+	}
+	if output.TimeoutSeconds >= output.IntervalSeconds {
+		output.TimeoutSeconds = output.IntervalSeconds - 1
+	}
+	if input.FailThreshold > 0 {
+		output.FailThreshold = input.FailThreshold
+	}
+
+	for domain, site := range input.Sites {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" || filepath.Base(domain) != domain || strings.HasPrefix(domain, ".") {
+			return model.UptimeSettings{}, fmt.Errorf("%w: 域名不合法 %q", ErrInvalidUptimeSettings, domain)
+		}
+		site.Path = strings.TrimSpace(site.Path)
+		if site.Path == "" {
+			site.Path = "/"
+		}
+		if !strings.HasPrefix(site.Path, "/") || strings.ContainsAny(site.Path, " \t\r\n#") {
+			return model.UptimeSettings{}, fmt.Errorf("%w: %s 的探测路径需以 / 开头且不含空白", ErrInvalidUptimeSettings, domain)
+		}
+		if site.ExpectedStatus != 0 && (site.ExpectedStatus < 100 || site.ExpectedStatus > 599) {
+			return model.UptimeSettings{}, fmt.Errorf("%w: %s 的期望状态码 %d 无效", ErrInvalidUptimeSettings, domain, site.ExpectedStatus)
+		}
+		output.Sites[domain] = site
+	}
+	return output, nil
+}
+
+func (m *UptimeMonitor) GetSettings() (model.UptimeSettings, error) {
+	content, err := os.ReadFile(m.settingsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return m.defaultSettings(), nil
+		}
+		return model.UptimeSettings{}, err
+	}
+	var settings model.UptimeSettings
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return model.UptimeSettings{}, err
+	}
+	normalized, err := m.sanitize(settings)
+	if err != nil {
+		return m.defaultSettings(), nil
+	}
+	return normalized, nil
+}
+
+// SaveSettings 保存配置，下一个检查周期立即按新配置探测
+func (m *UptimeMonitor) SaveSettings(input model.UptimeSettings) (model.UptimeSettings, error) {
+	settings, err := m.sanitize(input)
+	if err != nil {
+		return model.UptimeSettings{}, err
+	}
+	settings.LastUpdatedUnixTime = time.Now().Unix()
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return model.UptimeSettings{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.settingsPath), 0700); err != nil {
+		return model.UptimeSettings{}, err
+	}
+	if err := os.WriteFile(m.settingsPath, data, 0600); err != nil {
+		return model.UptimeSettings{}, err
+	}
+	m.mu.Lock()
+	m.lastRun = time.Time{}
+	m.mu.Unlock()
+	return settings, nil
+}
+
+func (m *UptimeMonitor) Start(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			settings, err := m.GetSettings()
+			if err != nil {
+				log.Printf("[uptime] 获取配置失败: %v", err)
+				continue
+			}
+			if !settings.Enabled {
+				continue
+			}
+			m.mu.Lock()
+			due := time.Since(m.lastRun) >= time.Duration(settings.IntervalSeconds)*time.Second
+			if due {
+				m.lastRun = time.Now()
+			}
+			m.mu.Unlock()
+			if due {
+				m.RunChecks(settings, time.Now())
+			}
+		}
+	}
+}
+
+func (m *UptimeMonitor) loadLocked() {
+	if m.loaded {
+		return
+	}
+	m.loaded = true
+	m.sites = make(map[string]*uptimeSiteState)
+	data, err := os.ReadFile(m.statePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[uptime] 读取 %s 失败: %v", m.statePath, err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &m.sites); err != nil {
+		log.Printf("[uptime] 解析 %s 失败: %v", m.statePath, err)
+		m.sites = make(map[string]*uptimeSiteState)
+	}
+}
+
+func (m *UptimeMonitor) saveLocked() {
+	data, err := json.Marshal(m.sites)
+	if err == nil {
+		err = os.WriteFile(m.statePath, data, 0600)
+	}
+	if err != nil {
+		log.Printf("[uptime] 保存 %s 失败: %v", m.statePath, err)
+	}
+}
+
+// monitoredSites 返回需要探测的启用站点及其探测配置
+func (m *UptimeMonitor) monitoredSites(settings model.UptimeSettings) (map[string]model.UptimeSiteSettings, error) {
+	domains, err := m.siteSvc.ListEnabledSites()
+	if err != nil {
+		return nil, err
+	}
+	sites := make(map[string]model.UptimeSiteSettings, len(domains))
+	for _, domain := range domains {
+		site, ok := settings.Sites[domain]
+		if !ok {
+			site = model.UptimeSiteSettings{Path: "/"}
+		}
+		if !site.Disabled {
+			sites[domain] = site
+		}
+	}
+	return sites, nil
+}
+
+// RunChecks 并发探测所有站点并更新记录
+func (m *UptimeMonitor) RunChecks(settings model.UptimeSettings, now time.Time) {
+	sites, err := m.monitoredSites(settings)
+	if err != nil {
+		log.Printf("[uptime] 读取站点失败: %v", err)
+		return
+	}
+	client := &http.Client{
+		Timeout: time.Duration(settings.TimeoutSeconds) * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var (
+		wg      sync.WaitGroup
+		resultM sync.Mutex
+		sem     = make(chan struct{}, uptimeConcurrency)
+	)
+	results := make(map[string]model.UptimeCheck, len(sites))
+	for domain, site := range sites {
+		wg.Add(1)
+		go func(domain string, site model.UptimeSiteSettings) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			check := probeUptime(client, m.target(domain, site.Path), site.ExpectedStatus)
+			check.UnixTime = now.Unix()
+			resultM.Lock()
+			results[domain] = check
+			resultM.Unlock()
+		}(domain, site)
+	}
+	wg.Wait()
+
+	type transition struct {
+		domain string
+		state  uptimeSiteState
+		check  model.UptimeCheck
+		down   bool
+	}
+	var transitions []transition
+
+	m.mu.Lock()
+	m.loadLocked()
+	for domain := range m.sites {
+		if _, ok := sites[domain]; !ok {
+			delete(m.sites, domain)
+		}
+	}
+	for domain, check := range results {
+		state := m.sites[domain]
+		if state == nil {
+			state = &uptimeSiteState{}
+			m.sites[domain] = state
+		}
+		state.record(check, now)
+		switch {
+		case !check.Up && !state.Alerted && state.ConsecutiveFails >= settings.FailThreshold:
+			state.Alerted = true
+			transitions = append(transitions, transition{domain, *state, check, true})
+		case check.Up && state.Alerted:
+			transitions = append(transitions, transition{domain, *state, check, false})
+			state.Alerted = false
+			state.DownSinceUnixTime = 0
+		}
+	}
+	m.saveLocked()
+	m.mu.Unlock()
+
+	if m.Notifier == nil {
+		return
+	}
+	sort.Slice(transitions, func(i, j int) bool { return transitions[i].domain < transitions[j].domain })
+	for _, t := range transitions {
+		m.Notifier.NotifyUptime(t.domain, m.target(t.domain, sites[t.domain].Path), t.check, t.state.ConsecutiveFails, t.state.DownSinceUnixTime, t.down)
+	}
+}
+
+// record 计入一次探测结果。恢复时 DownSinceUnixTime 保留到通知发出后再清除
+func (st *uptimeSiteState) record(check model.UptimeCheck, now time.Time) {
+	if check.Up {
+		if !st.Alerted {
+			st.DownSinceUnixTime = 0
+		}
+		st.ConsecutiveFails = 0
+	} else {
+		if st.ConsecutiveFails == 0 && !st.Alerted {
+			st.DownSinceUnixTime = check.UnixTime
+		}
+		st.ConsecutiveFails++
+	}
+	st.Recent = append(st.Recent, check)
+	if len(st.Recent) > uptimeRecentChecks {
+		st.Recent = append(st.Recent[:0], st.Recent[len(st.Recent)-uptimeRecentChecks:]...)
+	}
+
+	start := now.Truncate(time.Hour).Unix()
+	if len(st.Hours) == 0 || st.Hours[len(st.Hours)-1].Start != start {
+		st.Hours = append(st.Hours, uptimeHour{Start: start})
+	}
+	hour := &st.Hours[len(st.Hours)-1]
+	hour.Checks++
+	if check.Up {
+		hour.Up++
+		hour.LatencyMs += check.LatencyMs
+	}
+	oldest := now.Add(-uptimeHourRetain).Truncate(time.Hour).Unix()
+	for len(st.Hours) > 0 && st.Hours[0].Start < oldest {
+		st.Hours = st.Hours[1:]
+	}
+}
+
+func probeUptime(client *http.Client, url string, expected int) model.UptimeCheck {
+	start := time.Now()
+	resp, err := client.Get(url)
+	check := model.UptimeCheck{LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	resp.Body.Close()
+	check.Status = resp.StatusCode
+	switch {
+	case expected != 0 && resp.StatusCode != expected:
+		check.Error = fmt.Sprintf("HTTP 状态码 %d，期望 %d", resp.StatusCode, expected)
+	case expected == 0 && (resp.StatusCode < 200 || resp.StatusCode >= 400):
+		check.Error = fmt.Sprintf("HTTP 状态码 %d", resp.StatusCode)
+	default:
+		check.Up = true
+	}
+	return check
+}
+
+// Status 返回各启用站点的当前状态与可用率
+func (m *UptimeMonitor) Status(now time.Time) ([]model.UptimeSiteStatus, error) {
+	settings, err := m.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	domains, err := m.siteSvc.ListEnabledSites()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(domains)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loadLocked()
+	statuses := make([]model.UptimeSiteStatus, 0, len(domains))
+	for _, domain := range domains {
+		site, ok := settings.Sites[domain]
+		if !ok {
+			site = model.UptimeSiteSettings{Path: "/"}
+		}
+		status := model.UptimeSiteStatus{
+			Domain:          domain,
+			URL:             m.target(domain, site.Path),
+			Monitored:       settings.Enabled && !site.Disabled,
+			Availability24h: -1,
+			Availability7d:  -1,
+			Recent:          []model.UptimeCheck{},
+		}
+		if state := m.sites[domain]; state != nil && len(state.Recent) > 0 {
+			last := state.Recent[len(state.Recent)-1]
+			status.LastCheck = &last
+			status.Up = last.Up
+			status.ConsecutiveFails = state.ConsecutiveFails
+			if !last.Up {
+				status.DownSinceUnixTime = state.DownSinceUnixTime
+			}
+			status.Recent = append(status.Recent, state.Recent...)
+			status.Availability24h, status.AvgLatencyMs24h = state.availability(now.Add(-24*time.Hour), now)
+			status.Availability7d, _ = state.availability(now.Add(-uptimeHourRetain), now)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// availability 返回 [from, now] 内按小时汇总的可用率与成功探测的平均耗时
+func (st *uptimeSiteState) availability(from, now time.Time) (float64, int64) {
+	var checks, up, latency int64
+	oldest := from.Truncate(time.Hour).Unix()
+	for _, hour := range st.Hours {
+		if hour.Start < oldest || hour.Start > now.Unix() {
+			continue
+		}
+		checks += hour.Checks
+		up += hour.Up
+		latency += hour.LatencyMs
+	}
+	if checks == 0 {
+		return -1, 0
+	}
+	var avg int64
+	if up > 0 {
+		avg = latency / up
+	}
+	return float64(up) / float64(checks) * 100, avg
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+func TestUptimeMonitor(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.WriteHeader(int(status.Load()))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer site.Close()
+
+	var received []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Title   string `json:"title"`
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload.Title+"\n"+payload.Content)
+	}))
+	defer webhook.Close()
+
+	dir := t.TempDir()
+	notifySvc := NewNotificationService()
+	notifySvc.store = openStateStore(filepath.Join(dir, "state.json"))
+	settings, _ := notifySvc.Get()
+	settings.Webhook = model.WebhookSettings{Enabled: true, URL: webhook.URL, Method: http.MethodPost}
+	if _, err := notifySvc.Save(settings); err != nil {
+		t.Fatalf("save notification settings: %v", err)
+	}
+
+	siteSvc := &SiteService{ConfDir: dir}
+	os.MkdirAll(filepath.Join(dir, "sites-enabled"), 0755)
+	os.WriteFile(filepath.Join(dir, "sites-enabled", "a.com"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "sites-enabled", "b.com"), nil, 0644)
+
+	monitor := NewUptimeMonitor(siteSvc)
+	monitor.settingsPath = filepath.Join(dir, "uptime_settings.json")
+	monitor.statePath = filepath.Join(dir, "uptime_state.json")
+	monitor.target = func(domain, path string) string { return site.URL + path }
+	monitor.Notifier = NewNotificationDispatcher(notifySvc, nil)
+
+	if _, err := monitor.SaveSettings(model.UptimeSettings{Sites: map[string]model.UptimeSiteSettings{"a.com": {Path: "health"}}}); !errors.Is(err, ErrInvalidUptimeSettings) {
+		t.Fatalf("expected invalid path error, got %v", err)
+	}
+	saved, err := monitor.SaveSettings(model.UptimeSettings{
+		Enabled:       true,
+		FailThreshold: 2,
+		Sites: map[string]model.UptimeSiteSettings{
+			"a.com": {Path: "/health", ExpectedStatus: http.StatusOK},
+			"b.com": {Disabled: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("save settings: %v", err)
+	}
+	if saved.IntervalSeconds != 60 || saved.TimeoutSeconds != 10 {
+		t.Fatalf("unexpected defaults: %+v", saved)
+	}
+
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.Local)
+	monitor.RunChecks(saved, now)
+	status.Store(http.StatusBadGateway)
+	monitor.RunChecks(saved, now.Add(time.Minute))
+	if len(received) != 0 {
+		t.Fatalf("expected no alert below threshold, got %v", received)
+	}
+	monitor.RunChecks(saved, now.Add(2*time.Minute))
+	monitor.RunChecks(saved, now.Add(3*time.Minute))
+	if len(received) != 1 || !strings.Contains(received[0], "站点不可用 · a.com") || !strings.Contains(received[0], "502") {
+		t.Fatalf("expected one down alert, got %v", received)
+	}
+
+	statuses, err := monitor.Status(now.Add(3 * time.Minute))
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].Domain != "a.com" || statuses[1].Monitored {
+		t.Fatalf("unexpected statuses: %+v", statuses)
+	}
+	a := statuses[0]
+	if a.Up || a.ConsecutiveFails != 3 || a.DownSinceUnixTime != now.Add(time.Minute).Unix() || a.Availability24h != 25 || len(a.Recent) != 4 {
+		t.Fatalf("unexpected a.com status: %+v", a)
+	}
+	if statuses[1].Availability24h != -1 {
+		t.Fatalf("expected no data for disabled site: %+v", statuses[1])
+	}
+
+	status.Store(http.StatusOK)
+	restarted := NewUptimeMonitor(siteSvc)
+	restarted.settingsPath, restarted.statePath = monitor.settingsPath, monitor.statePath
+	restarted.target, restarted.Notifier = monitor.target, monitor.Notifier
+	restarted.RunChecks(saved, now.Add(4*time.Minute))
+	if len(received) != 2 || !strings.Contains(received[1], "站点已恢复 · a.com") || !strings.Contains(received[1], "3m0s") {
+		t.Fatalf("expected recovery alert after restart, got %v", received)
+	}
+	statuses, _ = restarted.Status(now.Add(4 * time.Minute))
+	if !statuses[0].Up || statuses[0].DownSinceUnixTime != 0 || statuses[0].Availability24h != 40 {
+		t.Fatalf("unexpected recovered status: %+v", statuses[0])
+	}
+}
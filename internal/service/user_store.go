@@ -0,0 +1,591 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nginx-mgr/internal/model"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidUser        = errors.New("账号参数无效")
+	ErrUserExists         = errors.New("账号已存在")
+	ErrUserNotFound       = errors.New("账号不存在")
+	ErrLastUser           = errors.New("至少需要保留一个管理员账号")
+	ErrInvalidCredentials = errors.New("用户名或密码不正确")
+	ErrSessionNotFound    = errors.New("会话不存在或已退出")
+	ErrTOTPRequired       = errors.New("需要输入两步验证码")
+	ErrInvalidTOTP        = errors.New("两步验证码不正确")
+	ErrExternalConflict   = errors.New("已存在同名的本地账号，无法通过单点登录登录")
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{2,32}$`)
+
+// 单点登录的用户名来自提供方，常见为邮箱地址
+var externalUsernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.@+-]{2,64}$`)
+
+const minPasswordLength = 8
+
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+type userRecord struct {
+	Username     string    `json:"username"`
+	Role         string    `json:"role,omitempty"`
+	PasswordHash string    `json:"password_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastLoginAt  time.Time `json:"last_login_at,omitempty"`
+	Source       string    `json:"source,omitempty"` // 单点登录创建的账号记录来源，如 oidc
+
+	TOTPSecret        string   `json:"totp_secret,omitempty"`
+	TOTPEnabled       bool     `json:"totp_enabled,omitempty"`
+	TOTPLastCounter   int64    `json:"totp_last_counter,omitempty"`
+	PendingTOTPSecret string   `json:"pending_totp_secret,omitempty"`
+	RecoveryCodes     []string `json:"recovery_codes,omitempty"` // SHA-256 哈希，使用后移除
+}
+
+type sessionRecord struct {
+	ID        string    `json:"id,omitempty"`
+	TokenHash string    `json:"token_hash"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// SessionClient 登录时记录的客户端信息，便于用户辨认需要注销的会话
+type SessionClient struct {
+	IP        string
+	UserAgent string
+}
+
+// id 引入会话 ID 之前创建的会话以令牌哈希前缀作为 ID
+func (r sessionRecord) id() string {
+	if r.ID != "" {
+		return r.ID
+	}
+	return r.TokenHash[:16]
+}
+
+func (r sessionRecord) toModel() model.Session {
+	return model.Session{
+		ID:        r.id(),
+		Username:  r.Username,
+		CreatedAt: r.CreatedAt,
+		ExpiresAt: r.ExpiresAt,
+		ClientIP:  r.ClientIP,
+		UserAgent: r.UserAgent,
+	}
+}
+
+type userStoreState struct {
+	Users    []userRecord    `json:"users"`
+	Sessions []sessionRecord `json:"sessions"`
+}
+
+// UserStore 以 users.json 保存面板账号与各自的登录会话。
+// 与 AuthManager 一样每次操作前从磁盘刷新，以便终端工具在另一个进程中修改账号。
+type UserStore struct {
+	path  string
+	state userStoreState
+	mu    sync.Mutex
+}
+
+func NewUserStore(path string) (*UserStore, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	store := &UserStore{path: absPath}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err := store.loadLocked(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *UserStore) loadLocked() error {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			s.state = userStoreState{}
+			return nil
+		}
+		return err
+	}
+	var state userStoreState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return err
+	}
+	s.state = state
+	return nil
+}
+
+func (s *UserStore) saveLocked() error {
+	// 顺带清理过期会话，避免文件无限增长
+	now := time.Now()
+	sessions := s.state.Sessions[:0]
+	for _, session := range s.state.Sessions {
+		if now.Before(session.ExpiresAt) {
+			sessions = append(sessions, session)
+		}
+	}
+	s.state.Sessions = sessions
+
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+func (s *UserStore) findLocked(username string) int {
+	for i, user := range s.state.Users {
+		if user.Username == username {
+			return i
+		}
+	}
+	return -1
+}
+
+// role 引入角色之前创建的账号视为管理员
+func (r userRecord) role() string {
+	if r.Role == "" {
+		return model.RoleAdmin
+	}
+	return r.Role
+}
+
+func (r userRecord) toModel() model.User {
+	return model.User{
+		Username:    r.Username,
+		Role:        r.role(),
+		TOTPEnabled: r.TOTPEnabled,
+		Source:      r.Source,
+		CreatedAt:   r.CreatedAt,
+		LastLoginAt: r.LastLoginAt,
+	}
+}
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func validateRole(role string) error {
+	switch role {
+	case model.RoleAdmin, model.RoleOperator, model.RoleViewer:
+		return nil
+	default:
+		return fmt.Errorf("%w: 不支持的角色 %q", ErrInvalidUser, role)
+	}
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("%w: 密码长度不能少于 %d 位", ErrInvalidUser, minPasswordLength)
+	}
+	if len(password) > 72 {
+		return fmt.Errorf("%w: 密码长度不能超过 72 字节", ErrInvalidUser)
+	}
+	return nil
+}
+
+// HasUsers 是否已创建账号；没有账号时仍沿用旧的单令牌登录
+func (s *UserStore) HasUsers() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return false, err
+	}
+	return len(s.state.Users) > 0, nil
+}
+
+// HasAdmin 是否已有管理员账号。单点登录自动创建的账号可能都不是管理员，此时仍接受旧的单令牌，避免无人可管理面板
+func (s *UserStore) HasAdmin() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return false, err
+	}
+	for _, user := range s.state.Users {
+		if user.role() == model.RoleAdmin {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *UserStore) ListUsers() ([]model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return nil, err
+	}
+	users := make([]model.User, 0, len(s.state.Users))
+	for _, user := range s.state.Users {
+		users = append(users, user.toModel())
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+func (s *UserStore) CreateUser(username, password, role string) (model.User, error) {
+	if !usernamePattern.MatchString(username) {
+		return model.User{}, fmt.Errorf("%w: 用户名需为 2-32 位字母、数字、下划线、点或短横线", ErrInvalidUser)
+	}
+	if err := validateRole(role); err != nil {
+		return model.User{}, err
+	}
+	if err := validatePassword(password); err != nil {
+		return model.User{}, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return model.User{}, err
+	}
+	if s.findLocked(username) != -1 {
+		return model.User{}, fmt.Errorf("%w: %s", ErrUserExists, username)
+	}
+	record := userRecord{
+		Username:     username,
+		Role:         role,
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now(),
+	}
+	s.state.Users = append(s.state.Users, record)
+	if err := s.saveLocked(); err != nil {
+		return model.User{}, err
+	}
+	return record.toModel(), nil
+}
+
+// SetPassword 修改密码并注销该账号的全部会话
+func (s *UserStore) SetPassword(username, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return err
+	}
+	idx := s.findLocked(username)
+	if idx == -1 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	s.state.Users[idx].PasswordHash = string(hash)
+	s.revokeLocked(username)
+	return s.saveLocked()
+}
+
+// SetRole 修改账号角色，不允许降级最后一个管理员
+func (s *UserStore) SetRole(username, role string) (model.User, error) {
+	if err := validateRole(role); err != nil {
+		return model.User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return model.User{}, err
+	}
+	idx := s.findLocked(username)
+	if idx == -1 {
+		return model.User{}, fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	if role != model.RoleAdmin && s.isLastAdminLocked(idx) {
+		return model.User{}, ErrLastUser
+	}
+	s.state.Users[idx].Role = role
+	if err := s.saveLocked(); err != nil {
+		return model.User{}, err
+	}
+	return s.state.Users[idx].toModel(), nil
+}
+
+func (s *UserStore) isLastAdminLocked(idx int) bool {
+	if s.state.Users[idx].role() != model.RoleAdmin {
+		return false
+	}
+	for i, user := range s.state.Users {
+		if i != idx && user.role() == model.RoleAdmin {
+			return false
+		}
+	}
+	return true
+}
+
+// DeleteUser 删除账号及其会话，不允许删除最后一个管理员
+func (s *UserStore) DeleteUser(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return err
+	}
+	idx := s.findLocked(username)
+	if idx == -1 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	if s.isLastAdminLocked(idx) {
+		return ErrLastUser
+	}
+	s.state.Users = append(s.state.Users[:idx], s.state.Users[idx+1:]...)
+	s.revokeLocked(username)
+	return s.saveLocked()
+}
+
+func (s *UserStore) revokeLocked(username string) {
+	sessions := s.state.Sessions[:0]
+	for _, session := range s.state.Sessions {
+		if session.Username != username {
+			sessions = append(sessions, session)
+		}
+	}
+	s.state.Sessions = sessions
+}
+
+// Login 校验密码（及已启用的两步验证码或恢复码）并签发新的会话令牌，每个会话独立过期
+func (s *UserStore) Login(username, password, otp string, client SessionClient) (string, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return "", time.Time{}, err
+	}
+	idx, err := s.authenticateLocked(username, password, otp)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return s.issueSessionLocked(idx, client)
+}
+
+// LoginExternal 为通过外部身份提供方认证的用户签发会话。账号不存在时自动创建（无本地密码），
+// 每次登录按提供方分组同步角色（最后一个管理员不会被降级）。bootstrapAdmin 为 true 且尚无任何账号时
+// 首个登录者成为管理员；已设置旧登录令牌时应传 false，由令牌持有者管理面板，新账号按分组映射的角色创建。
+func (s *UserStore) LoginExternal(source, username, role string, bootstrapAdmin bool, client SessionClient) (string, time.Time, error) {
+	if !externalUsernamePattern.MatchString(username) {
+		return "", time.Time{}, fmt.Errorf("%w: 用户名 %q 不符合要求", ErrInvalidUser, username)
+	}
+	if err := validateRole(role); err != nil {
+		return "", time.Time{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return "", time.Time{}, err
+	}
+	idx := s.findLocked(username)
+	if idx == -1 {
+		if bootstrapAdmin && len(s.state.Users) == 0 {
+			role = model.RoleAdmin
+		}
+		s.state.Users = append(s.state.Users, userRecord{
+			Username:  username,
+			Role:      role,
+			Source:    source,
+			CreatedAt: time.Now(),
+		})
+		idx = len(s.state.Users) - 1
+	} else if s.state.Users[idx].Source != source {
+		// 不允许外部身份接管同名的本地账号
+		return "", time.Time{}, fmt.Errorf("%w: %s", ErrExternalConflict, username)
+	} else if role == model.RoleAdmin || !s.isLastAdminLocked(idx) {
+		// 最后一个管理员保留管理员角色，避免面板无人可管理
+		s.state.Users[idx].Role = role
+	}
+	return s.issueSessionLocked(idx, client)
+}
+
+func (s *UserStore) issueSessionLocked(idx int, client SessionClient) (string, time.Time, error) {
+	raw := make([]byte, 40)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(raw[:32])
+	now := time.Now()
+	expiresAt := now.Add(tokenTTL)
+	userAgent := client.UserAgent
+	if len(userAgent) > 256 {
+		userAgent = userAgent[:256]
+	}
+	s.state.Users[idx].LastLoginAt = now
+	s.state.Sessions = append(s.state.Sessions, sessionRecord{
+		ID:        hex.EncodeToString(raw[32:]),
+		TokenHash: hashSessionToken(token),
+		Username:  s.state.Users[idx].Username,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+		ClientIP:  client.IP,
+		UserAgent: userAgent,
+	})
+	if err := s.saveLocked(); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// CheckCredentials 仅校验凭据而不签发会话，用于敏感操作前的二次确认
+func (s *UserStore) CheckCredentials(username, password, otp string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return err
+	}
+	if _, err := s.authenticateLocked(username, password, otp); err != nil {
+		return err
+	}
+	// 保存已消耗的时间步或恢复码
+	return s.saveLocked()
+}
+
+func (s *UserStore) authenticateLocked(username, password, otp string) (int, error) {
+	idx := s.findLocked(username)
+	if idx == -1 {
+		// 仍执行一次比较，避免通过响应时间探测账号是否存在
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("nginx-mgr"), bcrypt.DefaultCost)
+		})
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return -1, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(s.state.Users[idx].PasswordHash), []byte(password)); err != nil {
+		return -1, ErrInvalidCredentials
+	}
+	if s.state.Users[idx].TOTPEnabled {
+		if strings.TrimSpace(otp) == "" {
+			return -1, ErrTOTPRequired
+		}
+		if !s.checkSecondFactorLocked(idx, otp, time.Now()) {
+			return -1, ErrInvalidTOTP
+		}
+	}
+	return idx, nil
+}
+
+// Validate 返回会话所属账号及会话信息
+func (s *UserStore) Validate(token string) (model.User, model.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return model.User{}, model.Session{}, err
+	}
+	tokenHash := hashSessionToken(token)
+	for _, session := range s.state.Sessions {
+		if session.TokenHash != tokenHash {
+			continue
+		}
+		if time.Now().After(session.ExpiresAt) {
+			return model.User{}, model.Session{}, ErrTokenExpired
+		}
+		idx := s.findLocked(session.Username)
+		if idx == -1 {
+			return model.User{}, model.Session{}, ErrSessionNotFound
+		}
+		current := session.toModel()
+		current.Current = true
+		return s.state.Users[idx].toModel(), current, nil
+	}
+	return model.User{}, model.Session{}, ErrSessionNotFound
+}
+
+// ListSessions 返回未过期的会话，username 为空时返回全部账号的会话，按创建时间倒序
+func (s *UserStore) ListSessions(username, currentID string) ([]model.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	sessions := make([]model.Session, 0, len(s.state.Sessions))
+	for _, record := range s.state.Sessions {
+		if now.After(record.ExpiresAt) || (username != "" && record.Username != username) {
+			continue
+		}
+		session := record.toModel()
+		session.Current = session.ID == currentID
+		sessions = append(sessions, session)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	return sessions, nil
+}
+
+// RevokeSession 按 ID 注销会话；username 非空时只能注销该账号自己的会话
+func (s *UserStore) RevokeSession(id, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return err
+	}
+	for i, session := range s.state.Sessions {
+		if session.id() != id || (username != "" && session.Username != username) {
+			continue
+		}
+		s.state.Sessions = append(s.state.Sessions[:i], s.state.Sessions[i+1:]...)
+		return s.saveLocked()
+	}
+	return ErrSessionNotFound
+}
+
+// LogoutAll 注销账号的全部会话，返回注销的数量
+func (s *UserStore) LogoutAll(username string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return 0, err
+	}
+	before := len(s.state.Sessions)
+	s.revokeLocked(username)
+	revoked := before - len(s.state.Sessions)
+	if revoked == 0 {
+		return 0, nil
+	}
+	return revoked, s.saveLocked()
+}
+
+// Logout 注销单个会话
+func (s *UserStore) Logout(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return err
+	}
+	tokenHash := hashSessionToken(token)
+	for i, session := range s.state.Sessions {
+		if session.TokenHash == tokenHash {
+			s.state.Sessions = append(s.state.Sessions[:i], s.state.Sessions[i+1:]...)
+			return s.saveLocked()
+		}
+	}
+	return nil
+}
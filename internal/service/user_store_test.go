@@ -0,0 +1,192 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nginx-mgr/internal/model"
+)
+
+func TestUserStoreSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	store, err := NewUserStore(path)
+	if err != nil {
+		t.Fatalf("new user store: %v", err)
+	}
+	if _, err := store.CreateUser("alice", "short", model.RoleAdmin); !errors.Is(err, ErrInvalidUser) {
+		t.Fatalf("expected short password to be rejected, got %v", err)
+	}
+	if _, err := store.CreateUser("alice", "correct-horse", "root"); !errors.Is(err, ErrInvalidUser) {
+		t.Fatalf("expected unknown role to be rejected, got %v", err)
+	}
+	if _, err := store.CreateUser("alice", "correct-horse", model.RoleAdmin); err != nil {
+		t.Fatalf("create alice: %v", err)
+	}
+	if _, err := store.CreateUser("alice", "correct-horse", model.RoleAdmin); !errors.Is(err, ErrUserExists) {
+		t.Fatalf("expected duplicate user, got %v", err)
+	}
+	if _, _, err := store.Login("alice", "wrong-password", "", SessionClient{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+
+	first, _, err := store.Login("alice", "correct-horse", "", SessionClient{})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	second, _, err := store.Login("alice", "correct-horse", "", SessionClient{})
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	user, _, err := store.Validate(first)
+	if err != nil || user.Username != "alice" {
+		t.Fatalf("validate first session: %+v, %v", user, err)
+	}
+
+	// 另一个进程（如 tokenctl）看到的是同一份会话
+	other, err := NewUserStore(path)
+	if err != nil {
+		t.Fatalf("reload store: %v", err)
+	}
+	if err := other.Logout(first); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	if _, _, err := store.Validate(first); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("logged out session should be invalid, got %v", err)
+	}
+	if _, _, err := store.Validate(second); err != nil {
+		t.Fatalf("other session should survive logout: %v", err)
+	}
+
+	sessions, err := store.ListSessions("alice", "")
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("list sessions: %+v, %v", sessions, err)
+	}
+	if _, current, _ := store.Validate(second); current.ID != sessions[0].ID || !current.Current {
+		t.Fatalf("validate should report the current session %+v", current)
+	}
+	third, _, err := store.Login("alice", "correct-horse", "", SessionClient{IP: "10.0.0.1", UserAgent: "curl/8"})
+	if err != nil {
+		t.Fatalf("third login: %v", err)
+	}
+	sessions, _ = store.ListSessions("alice", sessions[0].ID)
+	if len(sessions) != 2 || sessions[0].ClientIP != "10.0.0.1" || sessions[0].Current || !sessions[1].Current {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+	if err := store.RevokeSession(sessions[0].ID, "bob"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("other users must not revoke the session, got %v", err)
+	}
+	if err := store.RevokeSession(sessions[0].ID, "alice"); err != nil {
+		t.Fatalf("revoke session: %v", err)
+	}
+	if _, _, err := store.Validate(third); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("revoked session should be invalid, got %v", err)
+	}
+
+	if err := store.SetPassword("alice", "battery-staple"); err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+	if _, _, err := store.Validate(second); err == nil {
+		t.Fatalf("password change should revoke sessions")
+	}
+	if err := store.DeleteUser("alice"); !errors.Is(err, ErrLastUser) {
+		t.Fatalf("expected last user to be protected, got %v", err)
+	}
+
+	if _, err := store.CreateUser("bob", "correct-horse", model.RoleViewer); err != nil {
+		t.Fatalf("create bob: %v", err)
+	}
+	if _, err := store.SetRole("alice", model.RoleOperator); !errors.Is(err, ErrLastUser) {
+		t.Fatalf("expected last admin demotion to be rejected, got %v", err)
+	}
+	if _, err := store.SetRole("bob", model.RoleAdmin); err != nil {
+		t.Fatalf("promote bob: %v", err)
+	}
+	user, err = store.SetRole("alice", model.RoleOperator)
+	if err != nil || user.Role != model.RoleOperator {
+		t.Fatalf("demote alice: %+v, %v", user, err)
+	}
+
+	aliceToken, _, _ := store.Login("alice", "battery-staple", "", SessionClient{})
+	for i := 0; i < 2; i++ {
+		if _, _, err := store.Login("bob", "correct-horse", "", SessionClient{}); err != nil {
+			t.Fatalf("bob login: %v", err)
+		}
+	}
+	if revoked, err := store.LogoutAll("bob"); err != nil || revoked != 2 {
+		t.Fatalf("logout all: %d, %v", revoked, err)
+	}
+	if _, _, err := store.Validate(aliceToken); err != nil {
+		t.Fatalf("logout all must not touch other accounts: %v", err)
+	}
+	if err := store.DeleteUser("alice"); err != nil {
+		t.Fatalf("delete non-admin: %v", err)
+	}
+}
+
+func TestUserStoreTOTP(t *testing.T) {
+	store, err := NewUserStore(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatalf("new user store: %v", err)
+	}
+	if _, err := store.CreateUser("alice", "correct-horse", model.RoleAdmin); err != nil {
+		t.Fatalf("create alice: %v", err)
+	}
+	secret, uri, err := store.BeginTOTP("alice")
+	if err != nil {
+		t.Fatalf("begin totp: %v", err)
+	}
+	if !strings.HasPrefix(uri, "otpauth://totp/ngx-nova:alice?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("unexpected otpauth uri %s", uri)
+	}
+	// 确认前不要求验证码
+	if _, _, err := store.Login("alice", "correct-horse", "", SessionClient{}); err != nil {
+		t.Fatalf("login before confirm: %v", err)
+	}
+
+	key, _ := totpEncoding.DecodeString(secret)
+	now := time.Now().Unix() / totpPeriod
+	if _, err := store.ConfirmTOTP("alice", totpCode(key, now+5)); !errors.Is(err, ErrInvalidTOTP) {
+		t.Fatalf("expected wrong code to be rejected, got %v", err)
+	}
+	codes, err := store.ConfirmTOTP("alice", totpCode(key, now))
+	if err != nil || len(codes) != recoveryCodeCount {
+		t.Fatalf("confirm totp: %v, %d codes", err, len(codes))
+	}
+
+	if _, _, err := store.Login("alice", "correct-horse", "", SessionClient{}); !errors.Is(err, ErrTOTPRequired) {
+		t.Fatalf("expected totp to be required, got %v", err)
+	}
+	// 已在确认时使用过的时间步不能重放
+	if _, _, err := store.Login("alice", "correct-horse", totpCode(key, now), SessionClient{}); !errors.Is(err, ErrInvalidTOTP) {
+		t.Fatalf("expected replayed code to be rejected, got %v", err)
+	}
+	if _, _, err := store.Login("alice", "correct-horse", totpCode(key, now+1), SessionClient{}); err != nil {
+		t.Fatalf("login with next code: %v", err)
+	}
+	if _, _, err := store.Login("alice", "correct-horse", strings.ToUpper(codes[0]), SessionClient{}); err != nil {
+		t.Fatalf("login with recovery code: %v", err)
+	}
+	if _, _, err := store.Login("alice", "correct-horse", codes[0], SessionClient{}); !errors.Is(err, ErrInvalidTOTP) {
+		t.Fatalf("recovery code should be single use, got %v", err)
+	}
+
+	if err := store.DisableTOTP("alice"); err != nil {
+		t.Fatalf("disable totp: %v", err)
+	}
+	if _, _, err := store.Login("alice", "correct-horse", "", SessionClient{}); err != nil {
+		t.Fatalf("login after disable: %v", err)
+	}
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 附录 B 的 SHA1 测试向量，取后 6 位
+	key := []byte("12345678901234567890")
+	for unix, want := range map[int64]string{59: "287082", 1111111109: "081804", 2000000000: "279037"} {
+		if got := totpCode(key, unix/totpPeriod); got != want {
+			t.Fatalf("T=%d: got %s, want %s", unix, got, want)
+		}
+	}
+}
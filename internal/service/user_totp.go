@@ -0,0 +1,103 @@
+package service
+
+import (
+	"fmt"
+	"time"
+)
+
+// BeginTOTP 生成待确认的密钥，确认前不影响登录
+func (s *UserStore) BeginTOTP(username string) (secret, uri string, err error) {
+	secret, err = generateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return "", "", err
+	}
+	idx := s.findLocked(username)
+	if idx == -1 {
+		return "", "", fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	s.state.Users[idx].PendingTOTPSecret = secret
+	if err := s.saveLocked(); err != nil {
+		return "", "", err
+	}
+	return secret, totpURI(username, secret), nil
+}
+
+// ConfirmTOTP 用验证器上的验证码确认待启用的密钥，启用两步验证并返回一次性恢复码
+func (s *UserStore) ConfirmTOTP(username, code string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return nil, err
+	}
+	idx := s.findLocked(username)
+	if idx == -1 {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	user := &s.state.Users[idx]
+	if user.PendingTOTPSecret == "" {
+		return nil, fmt.Errorf("%w: 请先生成两步验证密钥", ErrInvalidUser)
+	}
+	counter, ok := verifyTOTP(user.PendingTOTPSecret, code, time.Now(), 0)
+	if !ok {
+		return nil, ErrInvalidTOTP
+	}
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = user.PendingTOTPSecret
+	user.PendingTOTPSecret = ""
+	user.TOTPEnabled = true
+	user.TOTPLastCounter = counter
+	user.RecoveryCodes = make([]string, len(codes))
+	for i, code := range codes {
+		user.RecoveryCodes[i] = hashSessionToken(code)
+	}
+	if err := s.saveLocked(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP 关闭两步验证并作废恢复码
+func (s *UserStore) DisableTOTP(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return err
+	}
+	idx := s.findLocked(username)
+	if idx == -1 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	user := &s.state.Users[idx]
+	user.TOTPSecret = ""
+	user.PendingTOTPSecret = ""
+	user.TOTPEnabled = false
+	user.TOTPLastCounter = 0
+	user.RecoveryCodes = nil
+	return s.saveLocked()
+}
+
+// checkSecondFactorLocked 校验验证码或恢复码，成功时记录已用时间步或移除恢复码，调用方负责保存
+func (s *UserStore) checkSecondFactorLocked(idx int, code string, now time.Time) bool {
+	user := &s.state.Users[idx]
+	if counter, ok := verifyTOTP(user.TOTPSecret, code, now, user.TOTPLastCounter); ok {
+		user.TOTPLastCounter = counter
+		return true
+	}
+	hash := hashSessionToken(normalizeRecoveryCode(code))
+	for i, stored := range user.RecoveryCodes {
+		if stored == hash {
+			user.RecoveryCodes = append(user.RecoveryCodes[:i], user.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
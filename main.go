@@ -1,14 +1,27 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"embed"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/fs"
+	"log"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"nginx-mgr/internal/model"
 	"nginx-mgr/internal/service"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,493 +33,2568 @@ var staticFS embed.FS
 
 func main() {
 	r := gin.Default()
+	// 仅信任本机反向代理传来的 X-Forwarded-For，避免伪造来源 IP 绕过登录限制
+	if err := r.SetTrustedProxies([]string{"127.0.0.1", "::1"}); err != nil {
+		panic(err)
+	}
 
-	nginxSvc := service.NewNginxService()
-	siteSvc := service.NewSiteService()
+	service.MigrateLegacyState()
+
+	nginxUpgrader := service.NewNginxUpgrader()
+	nginxSvc := service.NewNginxService(nginxUpgrader)
+	siteDefaultsSvc := service.NewSiteDefaultsService()
+	siteSvc := service.NewSiteService(siteDefaultsSvc)
+	upstreamSvc := service.NewUpstreamService(siteSvc)
+	botBlockSvc := service.NewBotBlockService()
 	streamSvc := service.NewStreamService()
+	sniSvc := service.NewSNIService()
 	notificationSvc := service.NewNotificationService()
 	trafficMgr := service.NewTrafficUsageManager("")
 	systemSvc := service.NewSystemService(notificationSvc, trafficMgr)
 	backupSvc := service.NewBackupService()
+	snapshotSvc := service.NewConfigSnapshotService()
+	stubStatusSvc := service.NewStubStatusService()
+	nginxConfSvc := service.NewNginxConfService()
+	globalTuningSvc := service.NewGlobalTuningService()
+	nginxProcessSvc := service.NewNginxProcessService()
+	hostInfoSvc := service.NewHostInfoService()
+	diskUsageSvc := service.NewDiskUsageService()
+	geoIPSvc := service.NewGeoIPService()
+	siteStatsSvc := service.NewSiteStatsService(geoIPSvc)
+	metricsSvc := service.NewSystemMetricsService(stubStatusSvc)
+	trafficHistorySvc := service.NewTrafficHistoryService()
+	goAccessSvc := service.NewGoAccessService()
+	logRotateSvc := service.NewLogRotateService()
+	dashboardSvc := service.NewDashboardService(siteSvc, streamSvc, systemSvc, backupSvc)
 	authPath := filepath.Join(".", "auth_token.json")
 	authMgr, err := service.NewAuthManager(authPath)
 	if err != nil {
 		panic(err)
 	}
+	// 账号登录取代单一令牌，AuthManager 仅在尚未创建账号时作为迁移入口
+	userStore, err := service.NewUserStore(filepath.Join(".", "users.json"))
+	if err != nil {
+		panic(err)
+	}
+	loginLimiter := service.NewLoginLimiter()
+	auditLog := service.NewAuditLog("")
+	panelAccessSvc := service.NewPanelAccessService()
+	panelTLSSvc := service.NewPanelTLSService()
+	oidcSvc := service.NewOIDCService()
+	readOnlySvc := service.NewReadOnlyService()
+	r.Use(panelAccessMiddleware(panelAccessSvc))
 
 	notifier := service.NewNotificationDispatcher(notificationSvc, trafficMgr)
+	notifier.SiteStats = siteStatsSvc
 	go notifier.Start(context.Background())
 
-	r.POST("/api/v1/auth/login", func(c *gin.Context) {
-		var req struct {
-			Token string `json:"token"`
-		}
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	healthChecker := service.NewUpstreamHealthChecker(siteSvc, systemSvc)
+	go healthChecker.Start(context.Background())
+
+	uptimeMonitor := service.NewUptimeMonitor(siteSvc)
+	uptimeMonitor.Notifier = notifier
+	go uptimeMonitor.Start(context.Background())
+
+	abuseGuard := service.NewAbuseGuard()
+	go abuseGuard.Start(context.Background())
+
+	logShipper := service.NewLogShipper()
+	go logShipper.Start(context.Background())
+
+	certMonitor := service.NewCertMonitor()
+	certMonitor.Notifier = notifier
+	go certMonitor.Start(context.Background())
+
+	// 启动时按当前站点与转发规则同步一次防火墙端口，未开启联动时不做改动
+	firewallSvc := service.NewFirewallService(siteSvc, streamSvc, sniSvc)
+	fail2banSvc := service.NewFail2banService(botBlockSvc)
+	go func() {
+		if err := firewallSvc.Sync(); err != nil {
+			log.Printf("[firewall] %v", err)
+		}
+	}()
+
+	backupScheduler := service.NewBackupScheduler(backupSvc, notifier)
+	go backupScheduler.Start(context.Background())
+
+	go siteStatsSvc.Start(context.Background())
+	go metricsSvc.Start(context.Background())
+	go trafficHistorySvc.Start(context.Background())
+
+	r.POST("/api/v1/auth/login", auditMiddleware(auditLog), loginHandler(authMgr, userStore, loginLimiter))
+
+	// OIDC 单点登录：登录页据此决定是否显示单点登录按钮
+	r.GET("/api/v1/auth/oidc", func(c *gin.Context) {
+		settings, err := oidcSvc.Get()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		token := strings.TrimSpace(req.Token)
-		if token == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "登录令牌不能为空"})
+		c.JSON(http.StatusOK, gin.H{"enabled": settings.Enabled, "display_name": settings.DisplayName})
+	})
+
+	r.GET("/api/v1/auth/oidc/login", func(c *gin.Context) {
+		authURL, err := oidcSvc.AuthCodeURL(c.Request.Context(), oidcCallbackURL(c))
+		if err != nil {
+			log.Printf("[oidc] 发起单点登录失败: %v", err)
+			redirectOIDCResult(c, url.Values{"sso_error": {err.Error()}})
 			return
 		}
+		c.Redirect(http.StatusFound, authURL)
+	})
 
-		expireAt, created, err := authMgr.Login(token)
+	// 提供方回调：校验通过后签发面板会话并写入 Cookie，失败原因经 URL 片段交给前端
+	r.GET("/api/v1/auth/oidc/callback", func(c *gin.Context) {
+		if errCode := c.Query("error"); errCode != "" {
+			redirectOIDCResult(c, url.Values{"sso_error": {strings.TrimSpace(errCode + " " + c.Query("error_description"))}})
+			return
+		}
+		identity, err := oidcSvc.Exchange(c.Request.Context(), c.Query("state"), c.Query("code"))
 		if err != nil {
-			switch {
-			case errors.Is(err, service.ErrTokenMismatch):
-				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-			default:
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			}
+			log.Printf("[oidc] 单点登录失败 (%s): %v", c.ClientIP(), err)
+			redirectOIDCResult(c, url.Values{"sso_error": {err.Error()}})
 			return
 		}
-
-		msg := "登录成功"
-		if created {
-			msg = "登录令牌已创建并启用"
+		client := service.SessionClient{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+		token, expireAt, err := userStore.LoginExternal("oidc", identity.Username, identity.Role, !authMgr.IsSet(), client)
+		if err != nil {
+			log.Printf("[oidc] 单点登录失败 (%s): %v", c.ClientIP(), err)
+			redirectOIDCResult(c, url.Values{"sso_error": {err.Error()}})
+			return
 		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"message":    msg,
-			"expires_at": expireAt.Format(time.RFC3339),
-			"new_token":  created,
-		})
+		setSessionCookies(c, token, expireAt)
+		c.Redirect(http.StatusFound, "/ui/")
 	})
 
 	apiV1 := r.Group("/api/v1")
-	apiV1.Use(authMiddleware(authMgr))
+	apiV1.Use(authMiddleware(authMgr, userStore))
+	apiV1.Use(auditMiddleware(auditLog))
+	apiV1.Use(roleMiddleware())
+	apiV1.Use(readOnlyMiddleware(readOnlySvc))
+	apiV1.Use(configSnapshotMiddleware(snapshotSvc))
+	apiV1.Use(firewallSyncMiddleware(firewallSvc))
 
-	// 1. 安装接口
-	apiV1.POST("/install", func(c *gin.Context) {
-		if nginxSvc.InstallStatus.IsRunning {
-			c.JSON(http.StatusConflict, gin.H{"error": "安装任务正在运行中"})
+	apiV1.GET("/audit", func(c *gin.Context) {
+		query := model.AuditQuery{
+			User:   c.Query("user"),
+			Method: c.Query("method"),
+			Path:   c.Query("path"),
+			Failed: c.Query("failed") == "true",
+		}
+		for key, target := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+			if value := c.Query(key); value != "" {
+				parsed, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": key + " 需为 RFC3339 时间格式"})
+					return
+				}
+				*target = parsed
+			}
+		}
+		if value := c.Query("limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit 必须是整数"})
+				return
+			}
+			query.Limit = limit
+		}
+		entries, err := auditLog.Query(query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		go nginxSvc.FullInstall(context.Background())
-		c.JSON(http.StatusAccepted, gin.H{"message": "安装任务已启动"})
+		c.JSON(http.StatusOK, entries)
 	})
 
-	apiV1.GET("/install/logs", func(c *gin.Context) {
-		c.JSON(http.StatusOK, nginxSvc.InstallStatus)
+	apiV1.GET("/auth/me", func(c *gin.Context) {
+		resp := gin.H{"username": "", "role": c.GetString("role")}
+		if user, ok := c.Get("user"); ok {
+			resp["username"] = user.(model.User).Username
+		}
+		if expireAt, ok := c.Get("expires_at"); ok {
+			resp["expires_at"] = expireAt.(time.Time).Format(time.RFC3339)
+		}
+		c.JSON(http.StatusOK, resp)
 	})
 
-	// 2. 站点管理
-	apiV1.GET("/sites", func(c *gin.Context) {
-		sites, err := siteSvc.ListSites()
+	// 在服务端注销当前会话；?all=true 时注销该账号的全部会话（包括其他设备）
+	apiV1.POST("/auth/logout", logoutHandler(authMgr, userStore))
+
+	// 两步验证仅对账号会话可用，旧的单一令牌没有对应账号
+	apiV1.POST("/auth/totp/enroll", func(c *gin.Context) {
+		user, ok := c.Get("user")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请先创建账号并使用账号登录"})
+			return
+		}
+		secret, uri, err := userStore.BeginTOTP(user.(model.User).Username)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, sites)
+		c.JSON(http.StatusOK, gin.H{"secret": secret, "otpauth_uri": uri})
 	})
 
-	apiV1.GET("/sites/details", func(c *gin.Context) {
-		configs, err := siteSvc.ListSiteConfigs()
+	apiV1.POST("/auth/totp/confirm", func(c *gin.Context) {
+		user, ok := c.Get("user")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请先创建账号并使用账号登录"})
+			return
+		}
+		var req struct {
+			Code string `json:"code"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		codes, err := userStore.ConfirmTOTP(user.(model.User).Username, req.Code)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, configs)
+		c.JSON(http.StatusOK, gin.H{"message": "两步验证已启用，请妥善保存恢复码", "recovery_codes": codes})
 	})
 
-	apiV1.GET("/sites/:domain", func(c *gin.Context) {
-		domain := c.Param("domain")
-		config, err := siteSvc.GetSite(domain)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	apiV1.POST("/auth/totp/disable", func(c *gin.Context) {
+		user, ok := c.Get("user")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请先创建账号并使用账号登录"})
 			return
 		}
-		c.JSON(http.StatusOK, config)
+		var req struct {
+			Password string `json:"password"`
+			Code     string `json:"code"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// 关闭前重新校验密码与验证码，防止会话被盗用后直接关闭两步验证
+		username := user.(model.User).Username
+		if err := userStore.CheckCredentials(username, req.Password, req.Code); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err := userStore.DisableTOTP(username); err != nil {
+			c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "两步验证已关闭"})
 	})
 
-	apiV1.GET("/sites/:domain/raw", func(c *gin.Context) {
-		domain := c.Param("domain")
-		content, err := siteSvc.ReadSiteRaw(domain)
+	// 普通账号只能查看和注销自己的会话，管理员可通过 all=true 查看全部账号
+	apiV1.GET("/auth/sessions", func(c *gin.Context) {
+		user, ok := c.Get("user")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "旧令牌模式不支持会话管理，请先创建账号"})
+			return
+		}
+		username := user.(model.User).Username
+		if c.Query("all") == "true" && c.GetString("role") == model.RoleAdmin {
+			username = ""
+		}
+		sessions, err := userStore.ListSessions(username, c.GetString("session_id"))
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"content": content})
+		c.JSON(http.StatusOK, sessions)
 	})
 
-	apiV1.POST("/sites", func(c *gin.Context) {
-		var config model.SiteConfig
-		if err := c.ShouldBindJSON(&config); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	apiV1.DELETE("/auth/sessions/:id", func(c *gin.Context) {
+		user, ok := c.Get("user")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "旧令牌模式不支持会话管理，请先创建账号"})
 			return
 		}
-		if err := siteSvc.CreateSite(config); err != nil {
+		owner := user.(model.User).Username
+		if c.GetString("role") == model.RoleAdmin {
+			owner = ""
+		}
+		if err := userStore.RevokeSession(c.Param("id"), owner); err != nil {
+			if errors.Is(err, service.ErrSessionNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		if err := systemSvc.Reload(); err != nil {
-			_ = siteSvc.DeleteSite(config.Domain)
-			_ = systemSvc.Reload()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+		c.JSON(http.StatusOK, gin.H{"message": "会话已注销"})
+	})
+
+	apiV1.GET("/users", func(c *gin.Context) {
+		users, err := userStore.ListUsers()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusCreated, gin.H{"message": "站点创建成功"})
+		c.JSON(http.StatusOK, users)
 	})
 
-	apiV1.PUT("/sites/:domain", func(c *gin.Context) {
-		var config model.SiteConfig
-		if err := c.ShouldBindJSON(&config); err != nil {
+	apiV1.POST("/users", func(c *gin.Context) {
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Role     string `json:"role"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		domain := c.Param("domain")
-		if config.Domain == "" {
-			config.Domain = domain
-		} else if config.Domain != domain {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "域名与请求路径不匹配"})
-			return
+		if req.Role == "" {
+			req.Role = model.RoleViewer
 		}
-		prevContent, err := siteSvc.ReadSiteRaw(domain)
+		user, err := userStore.CreateUser(strings.TrimSpace(req.Username), req.Password, req.Role)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		if err := siteSvc.CreateSite(config); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusCreated, user)
+	})
+
+	apiV1.PUT("/users/:username/password", func(c *gin.Context) {
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := systemSvc.Reload(); err != nil {
-			_ = siteSvc.WriteSiteRaw(domain, prevContent)
-			_ = systemSvc.Reload()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+		if err := userStore.SetPassword(c.Param("username"), req.Password); err != nil {
+			c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "站点更新成功"})
+		c.JSON(http.StatusOK, gin.H{"message": "密码已更新，该账号的会话已全部注销"})
 	})
 
-	apiV1.PUT("/sites/:domain/raw", func(c *gin.Context) {
-		domain := c.Param("domain")
+	apiV1.PUT("/users/:username/role", func(c *gin.Context) {
 		var req struct {
-			Content string `json:"content"`
+			Role string `json:"role"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		prevContent, err := siteSvc.ReadSiteRaw(domain)
+		user, err := userStore.SetRole(c.Param("username"), req.Role)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		if err := siteSvc.WriteSiteRaw(domain, req.Content); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusOK, user)
+	})
+
+	// 管理员为丢失验证器的账号重置两步验证
+	apiV1.DELETE("/users/:username/totp", func(c *gin.Context) {
+		if err := userStore.DisableTOTP(c.Param("username")); err != nil {
+			c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		if err := systemSvc.Reload(); err != nil {
-			_ = siteSvc.WriteSiteRaw(domain, prevContent)
-			_ = systemSvc.Reload()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+		c.JSON(http.StatusOK, gin.H{"message": "两步验证已重置"})
+	})
+
+	apiV1.DELETE("/users/:username", func(c *gin.Context) {
+		if err := userStore.DeleteUser(c.Param("username")); err != nil {
+			c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "配置已更新并重载"})
+		c.JSON(http.StatusOK, gin.H{"message": "账号已删除"})
 	})
 
-	apiV1.DELETE("/sites/:domain", func(c *gin.Context) {
-		domain := c.Param("domain")
-		prevContent, err := siteSvc.ReadSiteRaw(domain)
+	// 1. 安装接口
+	apiV1.POST("/install", func(c *gin.Context) {
+		if nginxSvc.InstallStatus.IsRunning {
+			c.JSON(http.StatusConflict, gin.H{"error": "安装任务正在运行中"})
+			return
+		}
+		// 请求体可省略，默认编译安装面板内置的版本
+		var req model.InstallRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req, err := nginxSvc.PrepareInstall(req)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := siteSvc.DeleteSite(domain); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		go nginxSvc.FullInstall(context.Background(), req)
+		c.JSON(http.StatusAccepted, gin.H{"message": "安装任务已启动"})
+	})
+
+	apiV1.GET("/install/logs", func(c *gin.Context) {
+		c.JSON(http.StatusOK, nginxSvc.InstallStatus)
+	})
+
+	// Nginx 升级：按当前编译参数编译目标版本并替换二进制，失败时恢复原二进制；进度通过 GET 查询
+	apiV1.POST("/system/upgrade", func(c *gin.Context) {
+		var req struct {
+			Version string   `json:"version"`
+			Mode    string   `json:"mode"`
+			Modules []string `json:"modules"` // 省略时沿用上次编译的模块
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := systemSvc.Reload(); err != nil {
-			if restoreErr := siteSvc.RestoreSiteRaw(domain, prevContent); restoreErr == nil {
-				_ = systemSvc.Reload()
+		if err := nginxUpgrader.Start(req.Version, req.Mode, req.Modules); err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidNginxUpgrade):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, service.ErrNginxUpgradeBusy):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "站点已删除"})
+		c.JSON(http.StatusAccepted, gin.H{"message": "升级任务已启动"})
 	})
 
-	// 3. 端口转发管理
-	apiV1.GET("/streams", func(c *gin.Context) {
-		streams, err := streamSvc.ListStreams()
+	apiV1.GET("/system/upgrade", func(c *gin.Context) {
+		c.JSON(http.StatusOK, nginxUpgrader.Status())
+	})
+
+	// 上次通过面板编译使用的版本与动态模块，升级时沿用；从未编译过时返回 null
+	apiV1.GET("/system/build-profile", func(c *gin.Context) {
+		profile, err := nginxUpgrader.Profile()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, streams)
+		c.JSON(http.StatusOK, profile)
 	})
 
-	apiV1.GET("/streams/details", func(c *gin.Context) {
-		configs, err := streamSvc.ListStreamConfigs()
+	// 2. 站点管理
+	apiV1.GET("/sites", func(c *gin.Context) {
+		sites, err := siteSvc.ListSites()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, configs)
+		c.JSON(http.StatusOK, sites)
 	})
 
-	apiV1.GET("/streams/:name", func(c *gin.Context) {
-		name := c.Param("name")
-		config, err := streamSvc.GetStream(name)
+	apiV1.GET("/sites/details", func(c *gin.Context) {
+		configs, err := siteSvc.ListSiteConfigs()
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, config)
+		c.JSON(http.StatusOK, configs)
 	})
 
-	apiV1.GET("/streams/:name/raw", func(c *gin.Context) {
-		name := c.Param("name")
-		content, err := streamSvc.ReadStreamRaw(name)
+	apiV1.GET("/sites/:domain", func(c *gin.Context) {
+		domain := c.Param("domain")
+		config, err := siteSvc.GetSite(domain)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"content": content})
+		c.JSON(http.StatusOK, config)
 	})
 
-	apiV1.POST("/streams", func(c *gin.Context) {
-		var config model.StreamConfig
-		if err := c.ShouldBindJSON(&config); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// 站点访问统计：granularity 为 hour 或 day，from/to 为 Unix 秒，省略时取最近 24 小时或 30 天
+	apiV1.GET("/sites/:domain/stats", func(c *gin.Context) {
+		domain := c.Param("domain")
+		if _, err := siteSvc.ReadSiteRaw(domain); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
-		if err := streamSvc.CreateStream(config); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		from, to, ok := queryUnixRange(c)
+		if !ok {
 			return
 		}
-		if err := systemSvc.Reload(); err != nil {
-			_ = streamSvc.DeleteStream(config.Name)
-			_ = systemSvc.Reload()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+		stats, err := siteStatsSvc.Stats(domain, c.Query("granularity"), from, to, time.Now())
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidStatsRange) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusCreated, gin.H{"message": "转发规则创建成功"})
+		c.JSON(http.StatusOK, stats)
 	})
 
-	apiV1.PUT("/streams/:name", func(c *gin.Context) {
-		name := c.Param("name")
-		backup, err := streamSvc.GetStream(name)
-		if err != nil {
+	// 站点访问分析：按 IP、URI、状态码与 UA 的请求排行，from/to 为 Unix 秒，省略时取最近 24 小时，limit 默认 10
+	apiV1.GET("/sites/:domain/analytics", func(c *gin.Context) {
+		domain := c.Param("domain")
+		if _, err := siteSvc.ReadSiteRaw(domain); err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
-		var config model.StreamConfig
-		if err := c.ShouldBindJSON(&config); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		from, to, ok := queryUnixRange(c)
+		if !ok {
 			return
 		}
-		if config.Name == "" {
-			config.Name = name
-		} else if config.Name != name {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "名称与请求路径不匹配"})
+		limit := 0
+		if raw := c.Query("limit"); raw != "" {
+			value, err := strconv.Atoi(raw)
+			if err != nil || value <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit 需为正整数"})
+				return
+			}
+			limit = value
+		}
+		analytics, err := siteStatsSvc.Analytics(domain, from, to, time.Now(), limit)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidStatsRange) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		if err := streamSvc.CreateStream(config); err != nil {
+		c.JSON(http.StatusOK, analytics)
+	})
+
+	// 错误日志归类：按级别、消息模式与后端合并重复的错误，level 为最低级别（如 error 同时包含 crit）
+	apiV1.GET("/sites/:domain/errors", func(c *gin.Context) {
+		domain := c.Param("domain")
+		if _, err := siteSvc.ReadSiteRaw(domain); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		from, to, ok := queryUnixRange(c)
+		if !ok {
+			return
+		}
+		limit := 0
+		if raw := c.Query("limit"); raw != "" {
+			value, err := strconv.Atoi(raw)
+			if err != nil || value <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit 需为正整数"})
+				return
+			}
+			limit = value
+		}
+		summary, err := siteSvc.SummarizeErrors(domain, from, to, time.Now(), c.Query("level"), limit)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidStatsRange) || errors.Is(err, service.ErrInvalidErrorLevel) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		if err := systemSvc.Reload(); err != nil {
-			_ = streamSvc.CreateStream(*backup)
-			_ = systemSvc.Reload()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+		c.JSON(http.StatusOK, summary)
+	})
+
+	// GoAccess 报告：POST 生成（缺少 goaccess 时自动安装），GET 返回上一次生成的 HTML
+	apiV1.POST("/sites/:domain/goaccess", func(c *gin.Context) {
+		domain := c.Param("domain")
+		if _, err := siteSvc.ReadSiteRaw(domain); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "转发规则已更新"})
+		report, err := goAccessSvc.Generate(domain)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrGoAccessBusy):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, service.ErrGoAccessNoLogs):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, report)
 	})
 
-	apiV1.DELETE("/streams/:name", func(c *gin.Context) {
-		name := c.Param("name")
-		backup, err := streamSvc.GetStream(name)
+	apiV1.GET("/sites/:domain/goaccess", func(c *gin.Context) {
+		path, err := goAccessSvc.ReportPath(c.Param("domain"))
 		if err != nil {
+			if errors.Is(err, service.ErrGoAccessNoReport) || errors.Is(err, os.ErrNotExist) {
+				c.JSON(http.StatusNotFound, gin.H{"error": service.ErrGoAccessNoReport.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.File(path)
+	})
+
+	// 实时跟踪站点日志（SSE）：kind 为 access/error，status 为逗号分隔的 2xx~5xx（只作用于访问日志），keyword 为关键字
+	apiV1.GET("/sites/:domain/logs/stream", func(c *gin.Context) {
+		domain := c.Param("domain")
+		if _, err := siteSvc.ReadSiteRaw(domain); err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
-		if err := streamSvc.DeleteStream(name); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		filter, err := service.ParseSiteLogFilter(c.Query("kind"), c.Query("status"), c.Query("keyword"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := systemSvc.Reload(); err != nil {
-			_ = streamSvc.CreateStream(*backup)
-			_ = systemSvc.Reload()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+		tail, err := siteSvc.TailLogs(domain, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "转发规则已删除"})
+		defer tail.Close()
+
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		lastSent := time.Now()
+		c.SSEvent("ready", gin.H{"domain": domain})
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case <-ticker.C:
+			}
+			lines := tail.Poll()
+			for _, line := range lines {
+				c.SSEvent("log", line)
+			}
+			// 定期发送心跳，避免空闲连接被中间代理断开
+			if len(lines) > 0 {
+				lastSent = time.Now()
+			} else if time.Since(lastSent) >= 15*time.Second {
+				c.SSEvent("ping", time.Now().Unix())
+				lastSent = time.Now()
+			}
+			return true
+		})
 	})
 
-	apiV1.PUT("/streams/:name/raw", func(c *gin.Context) {
-		name := c.Param("name")
-		prevContent, err := streamSvc.ReadStreamRaw(name)
+	apiV1.GET("/sites/:domain/raw", func(c *gin.Context) {
+		domain := c.Param("domain")
+		content, err := siteSvc.ReadSiteRaw(domain)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
-		var req struct {
-			Content string `json:"content"`
-		}
-		if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"content": content})
+	})
+
+	apiV1.POST("/sites", func(c *gin.Context) {
+		var config model.SiteConfig
+		if err := c.ShouldBindJSON(&config); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := streamSvc.WriteStreamRaw(name, req.Content); err != nil {
+		defer siteSvc.LockSite(config.Domain)()
+		if err := siteSvc.CreateSite(config); err != nil {
+			if errors.Is(err, service.ErrInvalidSiteOption) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		if err := systemSvc.Reload(); err != nil {
-			_ = streamSvc.WriteStreamRaw(name, prevContent)
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = siteSvc.DeleteSite(config.Domain)
 			_ = systemSvc.Reload()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "转发配置已更新"})
+		c.JSON(http.StatusCreated, gin.H{"message": "站点创建成功"})
 	})
 
-	// 4. 系统运维
-	apiV1.POST("/system/reload", func(c *gin.Context) {
-		if err := systemSvc.Reload(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	apiV1.PUT("/sites/:domain", func(c *gin.Context) {
+		var config model.SiteConfig
+		if err := c.ShouldBindJSON(&config); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "Nginx 已重载"})
-	})
-
-	apiV1.POST("/system/backup", func(c *gin.Context) {
-		path, err := systemSvc.Backup()
+		domain := c.Param("domain")
+		if config.Domain == "" {
+			config.Domain = domain
+		} else if config.Domain != domain {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "域名与请求路径不匹配"})
+			return
+		}
+		defer siteSvc.LockSite(domain)()
+		prevContent, err := siteSvc.ReadSiteRaw(domain)
 		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if c.Query("force") != "true" {
+			dropped, err := siteSvc.DroppedDirectives(domain, config)
+			if err != nil {
+				if errors.Is(err, service.ErrInvalidSiteOption) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if len(dropped) > 0 {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":              "现有配置包含手工添加的指令，结构化更新会将其移除；确认覆盖请附加 ?force=true",
+					"dropped_directives": dropped,
+				})
+				return
+			}
+		}
+		if err := siteSvc.CreateSite(config); err != nil {
+			if errors.Is(err, service.ErrInvalidSiteOption) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "备份成功", "path": path})
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = siteSvc.WriteSiteRaw(domain, prevContent)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "站点更新成功"})
 	})
 
-	apiV1.POST("/system/restore", func(c *gin.Context) {
+	apiV1.PUT("/sites/:domain/raw", func(c *gin.Context) {
+		domain := c.Param("domain")
 		var req struct {
-			Path string `json:"path"`
+			Content string `json:"content"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := systemSvc.Restore(req.Path); err != nil {
+		defer siteSvc.LockSite(domain)()
+		prevContent, err := siteSvc.ReadSiteRaw(domain)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err := siteSvc.WriteSiteRaw(domain, req.Content); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "恢复成功"})
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = siteSvc.WriteSiteRaw(domain, prevContent)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "配置已更新并重载"})
 	})
 
-	apiV1.POST("/system/uninstall", func(c *gin.Context) {
-		if err := systemSvc.Uninstall(); err != nil {
+	apiV1.DELETE("/sites/:domain", func(c *gin.Context) {
+		domain := c.Param("domain")
+		defer siteSvc.LockSite(domain)()
+		prevContent, err := siteSvc.ReadSiteRaw(domain)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err := siteSvc.DeleteSite(domain); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "卸载成功"})
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			if restoreErr := siteSvc.RestoreSiteRaw(domain, prevContent); restoreErr == nil {
+				_ = systemSvc.Reload()
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "站点已删除"})
 	})
 
-	apiV1.GET("/system/status", func(c *gin.Context) {
-		status, _ := systemSvc.GetStatus()
-		c.JSON(http.StatusOK, status)
+	apiV1.GET("/sites/:domain/files", func(c *gin.Context) {
+		files, err := siteSvc.ListSiteFiles(c.Param("domain"), c.Query("path"))
+		if err != nil {
+			c.JSON(siteFileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, files)
 	})
 
-	apiV1.GET("/system/site-logs", func(c *gin.Context) {
-		logs, err := siteSvc.CollectTodayLogs(200)
+	apiV1.GET("/sites/:domain/files/download", func(c *gin.Context) {
+		target, err := siteSvc.OpenSiteFile(c.Param("domain"), c.Query("path"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(siteFileErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, logs)
+		c.FileAttachment(target, filepath.Base(target))
 	})
 
-	// 5. 通知设置
-	apiV1.GET("/settings/notifications", func(c *gin.Context) {
-		settings, err := notificationSvc.Get()
+	apiV1.POST("/sites/:domain/files", func(c *gin.Context) {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的文件"})
+			return
+		}
+		src, err := header.Open()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, settings)
+		defer src.Close()
+		saved, err := siteSvc.SaveSiteFile(c.Param("domain"), c.Query("path"), header.Filename, src)
+		if err != nil {
+			c.JSON(siteFileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "文件已上传", "path": saved})
 	})
 
-	apiV1.PUT("/settings/notifications", func(c *gin.Context) {
-		var req model.NotificationSettings
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	apiV1.DELETE("/sites/:domain/files", func(c *gin.Context) {
+		if err := siteSvc.DeleteSiteFile(c.Param("domain"), c.Query("path")); err != nil {
+			c.JSON(siteFileErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		saved, err := notificationSvc.Save(req)
+		c.JSON(http.StatusOK, gin.H{"message": "文件已删除"})
+	})
+
+	// 3. 端口转发管理
+	apiV1.GET("/streams", func(c *gin.Context) {
+		streams, err := streamSvc.ListStreams()
 		if err != nil {
-			if errors.Is(err, service.ErrInvalidExpiryDateFormat) {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
-			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, saved)
+		c.JSON(http.StatusOK, streams)
 	})
 
-	// 6. 备份与恢复
-	apiV1.GET("/backup/status", func(c *gin.Context) {
-		status, err := backupSvc.Status()
+	apiV1.GET("/streams/details", func(c *gin.Context) {
+		configs, err := streamSvc.ListStreamConfigs()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, status)
+		c.JSON(http.StatusOK, configs)
 	})
 
-	apiV1.POST("/backup/setup", func(c *gin.Context) {
-		var req service.R2SetupRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		nextCheck, firstBackup, err := backupSvc.SetupR2(req)
+	apiV1.GET("/streams/:name", func(c *gin.Context) {
+		name := c.Param("name")
+		config, err := streamSvc.GetStream(name)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
-		payload := gin.H{
-			"message":      "Cloudflare R2 配置成功",
-			"first_backup": firstBackup,
-		}
-		if !nextCheck.IsZero() {
-			payload["next_check_at"] = nextCheck.Format(time.RFC3339)
-		}
-		c.JSON(http.StatusOK, payload)
+		c.JSON(http.StatusOK, config)
 	})
 
-	apiV1.POST("/backup/run", func(c *gin.Context) {
-		if err := backupSvc.RunBackup(); err != nil {
+	apiV1.GET("/streams/:name/stats", func(c *gin.Context) {
+		stats, err := streamSvc.Stats(c.Param("name"), time.Now())
+		if err != nil {
+			if os.IsNotExist(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "转发规则不存在"})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "备份任务已执行"})
+		c.JSON(http.StatusOK, stats)
 	})
 
-	apiV1.POST("/backup/test", func(c *gin.Context) {
-		if err := backupSvc.TestConnection(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	apiV1.GET("/streams/:name/raw", func(c *gin.Context) {
+		name := c.Param("name")
+		content, err := streamSvc.ReadStreamRaw(name)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "与 Cloudflare R2 连接正常"})
+		c.JSON(http.StatusOK, gin.H{"content": content})
 	})
 
-	apiV1.POST("/backup/restore", func(c *gin.Context) {
-		var req struct {
-			RemotePath string `json:"remote_path"`
-		}
-		if err := c.ShouldBindJSON(&req); err != nil {
+	apiV1.POST("/streams", func(c *gin.Context) {
+		var config model.StreamConfig
+		if err := c.ShouldBindJSON(&config); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := backupSvc.RestoreLatest(req.RemotePath); err != nil {
+		if err := streamSvc.CreateStream(config); err != nil {
+			if errors.Is(err, service.ErrInvalidStream) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, service.ErrStreamPortConflict) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "恢复成功"})
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = streamSvc.DeleteStream(config.Name)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "转发规则创建成功"})
+	})
+
+	apiV1.POST("/streams/import", func(c *gin.Context) {
+		data, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		configs, err := service.ParseStreamImport(data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		created, err := streamSvc.ImportStreams(configs)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidStream) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, service.ErrStreamPortConflict) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// 全部写入后只测试并重载一次
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			for _, name := range created {
+				_ = streamSvc.DeleteStream(name)
+			}
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "转发规则导入成功", "created": created})
+	})
+
+	apiV1.PUT("/streams/:name", func(c *gin.Context) {
+		name := c.Param("name")
+		prevContent, err := streamSvc.ReadStreamRaw(name)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		prevEnabled := streamSvc.IsEnabled(name)
+		var config model.StreamConfig
+		if err := c.ShouldBindJSON(&config); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if config.Name == "" {
+			config.Name = name
+		} else if config.Name != name {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "名称与请求路径不匹配"})
+			return
+		}
+		if err := streamSvc.CreateStream(config); err != nil {
+			if errors.Is(err, service.ErrInvalidStream) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, service.ErrStreamPortConflict) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			// 原端口仍由 nginx 持有，按原始内容回滚以绕过端口冲突检查
+			_ = streamSvc.RestoreStreamRaw(name, prevContent, prevEnabled)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "转发规则已更新"})
+	})
+
+	apiV1.DELETE("/streams/:name", func(c *gin.Context) {
+		name := c.Param("name")
+		prevContent, err := streamSvc.ReadStreamRaw(name)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		prevEnabled := streamSvc.IsEnabled(name)
+		if err := streamSvc.DeleteStream(name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = streamSvc.RestoreStreamRaw(name, prevContent, prevEnabled)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "转发规则已删除"})
+	})
+
+	apiV1.POST("/streams/:name/enable", func(c *gin.Context) {
+		name := c.Param("name")
+		if err := streamSvc.EnableStream(name); err != nil {
+			if errors.Is(err, service.ErrStreamPortConflict) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			if os.IsNotExist(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = streamSvc.DisableStream(name)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "转发规则已启用"})
+	})
+
+	apiV1.POST("/streams/:name/disable", func(c *gin.Context) {
+		name := c.Param("name")
+		prevContent, err := streamSvc.ReadStreamRaw(name)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		prevEnabled := streamSvc.IsEnabled(name)
+		if err := streamSvc.DisableStream(name); err != nil {
+			if os.IsNotExist(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			// 端口仍由 nginx 持有，直接恢复软链接而不经过端口冲突检查
+			_ = streamSvc.RestoreStreamRaw(name, prevContent, prevEnabled)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "转发规则已停用"})
+	})
+
+	apiV1.PUT("/streams/:name/raw", func(c *gin.Context) {
+		name := c.Param("name")
+		prevContent, err := streamSvc.ReadStreamRaw(name)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		prevEnabled := streamSvc.IsEnabled(name)
+		var req struct {
+			Content string `json:"content"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := streamSvc.WriteStreamRaw(name, req.Content); err != nil {
+			if errors.Is(err, service.ErrInvalidStream) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, service.ErrStreamPortConflict) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = streamSvc.RestoreStreamRaw(name, prevContent, prevEnabled)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "转发配置已更新"})
+	})
+
+	// SNI 透传路由
+	apiV1.GET("/sni-routes", func(c *gin.Context) {
+		configs, err := sniSvc.ListSNI()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, configs)
+	})
+
+	apiV1.GET("/sni-routes/:name", func(c *gin.Context) {
+		config, err := sniSvc.GetSNI(c.Param("name"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, config)
+	})
+
+	apiV1.POST("/sni-routes", func(c *gin.Context) {
+		var config model.SNIConfig
+		if err := c.ShouldBindJSON(&config); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := sniSvc.ReadSNIRaw(config.Name); err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "同名 SNI 路由已存在"})
+			return
+		}
+		if err := sniSvc.SaveSNI(config); err != nil {
+			if errors.Is(err, service.ErrInvalidSNIRoute) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, service.ErrStreamPortConflict) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = sniSvc.DeleteSNI(config.Name)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "SNI 路由创建成功"})
+	})
+
+	apiV1.PUT("/sni-routes/:name", func(c *gin.Context) {
+		name := c.Param("name")
+		var config model.SNIConfig
+		if err := c.ShouldBindJSON(&config); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if config.Name == "" {
+			config.Name = name
+		} else if config.Name != name {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "名称与请求路径不匹配"})
+			return
+		}
+		prevContent, err := sniSvc.ReadSNIRaw(name)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err := sniSvc.SaveSNI(config); err != nil {
+			if errors.Is(err, service.ErrInvalidSNIRoute) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, service.ErrStreamPortConflict) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = sniSvc.WriteSNIRaw(name, prevContent)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "SNI 路由已更新"})
+	})
+
+	apiV1.DELETE("/sni-routes/:name", func(c *gin.Context) {
+		name := c.Param("name")
+		prevContent, err := sniSvc.ReadSNIRaw(name)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err := sniSvc.DeleteSNI(name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = sniSvc.WriteSNIRaw(name, prevContent)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "SNI 路由已删除"})
+	})
+
+	// 4. 系统运维
+	apiV1.POST("/system/reload", func(c *gin.Context) {
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Nginx 已重载"})
+	})
+
+	// 仅执行 nginx -t，不重载；配置有误时同样返回 200，由 ok 与 issues 说明出错的文件和行号
+	apiV1.POST("/system/test", func(c *gin.Context) {
+		result, err := systemSvc.TestConfig()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
+	apiV1.POST("/system/backup", func(c *gin.Context) {
+		path, err := systemSvc.Backup()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "备份成功", "path": path})
+	})
+
+	apiV1.POST("/system/restore", func(c *gin.Context) {
+		var req struct {
+			Path string `json:"path"`
+			service.RestoreScope
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := systemSvc.Restore(req.Path, req.RestoreScope); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrInvalidRestoreScope) || errors.Is(err, service.ErrInvalidBackupArchive) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "恢复成功"})
+	})
+
+	// 卸载分两步：先 dry_run 预览将删除的文件、服务与软件包并取得确认码，再提交确认码执行
+	apiV1.POST("/system/uninstall", func(c *gin.Context) {
+		var req struct {
+			DryRun       bool   `json:"dry_run"`
+			ConfirmToken string `json:"confirm_token"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.DryRun {
+			plan, err := nginxSvc.PreviewUninstall()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, plan)
+			return
+		}
+		plan, err := nginxSvc.Uninstall(req.ConfirmToken)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrUninstallNotConfirmed):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, service.ErrUninstallPlanChanged):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "plan": plan})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "plan": plan})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "卸载成功", "plan": plan})
+	})
+
+	apiV1.GET("/system/status", func(c *gin.Context) {
+		status, _ := systemSvc.GetStatus()
+		if stub, err := stubStatusSvc.Fetch(); err == nil {
+			status["stub_status"] = stub
+		}
+		c.JSON(http.StatusOK, status)
+	})
+
+	// 主机信息：系统、内核、架构、运行时长、CPU、内存与虚拟化类型
+	apiV1.GET("/system/info", func(c *gin.Context) {
+		c.JSON(http.StatusOK, hostInfoSvc.Info(time.Now()))
+	})
+
+	// 根目录、nginx 日志、网站根目录、本地备份与缓存目录的磁盘占用，以及最大的日志文件
+	apiV1.GET("/system/disk", func(c *gin.Context) {
+		c.JSON(http.StatusOK, diskUsageSvc.Usage())
+	})
+
+	// nginx 主进程与各工作进程的 CPU、内存、运行时长与连接数，采样约 0.5 秒
+	apiV1.GET("/system/processes", func(c *gin.Context) {
+		processes, err := nginxProcessSvc.Processes()
+		if errors.Is(err, service.ErrNginxNotRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, processes)
+	})
+
+	// nginx -T 输出的完整配置，format=text 时直接返回原始文本
+	apiV1.GET("/system/config-dump", func(c *gin.Context) {
+		dump, err := systemSvc.ConfigDump()
+		if errors.Is(err, service.ErrNginxConfigInvalid) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if c.Query("format") == "text" {
+			c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(dump.Raw))
+			return
+		}
+		c.JSON(http.StatusOK, dump)
+	})
+
+	// 全局配置：nginx.conf 与 conf.d/*.conf，path 为相对 /etc/nginx 的路径
+	apiV1.GET("/nginx/conf", func(c *gin.Context) {
+		entries, err := nginxConfSvc.List()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, entries)
+	})
+
+	apiV1.GET("/nginx/conf/file", func(c *gin.Context) {
+		content, err := nginxConfSvc.Read(c.Query("path"))
+		if errors.Is(err, service.ErrInvalidConfPath) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"path": c.Query("path"), "content": content})
+	})
+
+	// 写入后测试并重载，失败时写回原内容（新建的文件则删除）并再次重载
+	apiV1.PUT("/nginx/conf/file", func(c *gin.Context) {
+		var req struct {
+			Path    string `json:"path"`
+			Content string `json:"content"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		prevContent, existed, err := nginxConfSvc.Write(req.Path, req.Content)
+		if errors.Is(err, service.ErrInvalidConfPath) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = nginxConfSvc.Restore(req.Path, prevContent, existed)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "配置已更新并重载"})
+	})
+
+	apiV1.DELETE("/nginx/conf/file", func(c *gin.Context) {
+		path := c.Query("path")
+		prevContent, err := nginxConfSvc.Delete(path)
+		if errors.Is(err, service.ErrInvalidConfPath) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = nginxConfSvc.Restore(path, prevContent, true)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "配置已删除并重载"})
+	})
+
+	// 全局参数：worker、长连接、server_names_hash 与 gzip，尚未保存过时返回 nginx.conf 中的当前值
+	apiV1.GET("/settings/global-tuning", func(c *gin.Context) {
+		status, err := globalTuningSvc.Status()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	})
+
+	apiV1.PUT("/settings/global-tuning", func(c *gin.Context) {
+		var req model.GlobalTuning
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := globalTuningSvc.Save(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidGlobalTuning) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	})
+
+	// 仪表盘首页汇总：站点与转发数量、Nginx 状态、证书到期、周期流量、近期错误与备份状态
+	apiV1.GET("/dashboard", func(c *gin.Context) {
+		c.JSON(http.StatusOK, dashboardSvc.Summary(time.Now()))
+	})
+
+	// 当前流量周期按站点拆分的用量，站点流量来自访问日志的 $body_bytes_sent
+	apiV1.GET("/system/traffic/sites", func(c *gin.Context) {
+		cycle, err := systemSvc.TrafficCycle()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		breakdown, err := siteStatsSvc.TrafficBreakdown(cycle, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, breakdown)
+	})
+
+	// 各网卡按天与按月的收发流量，interface 指定网卡，days 限制返回的天数
+	apiV1.GET("/system/traffic/history", func(c *gin.Context) {
+		days, _ := strconv.Atoi(c.Query("days"))
+		history, err := trafficHistorySvc.History(c.Query("interface"), days)
+		if errors.Is(err, os.ErrNotExist) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "网卡不存在"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, history)
+	})
+
+	// 系统负载历史：range 为 30m、24h、7d 形式，默认 24h，最多保留 7 天
+	apiV1.GET("/system/metrics", func(c *gin.Context) {
+		metrics, err := metricsSvc.Query(c.Query("range"), time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, metrics)
+	})
+
+	apiV1.GET("/system/stub-status", func(c *gin.Context) {
+		stub, err := stubStatusSvc.Fetch()
+		if err != nil {
+			if errors.Is(err, service.ErrStubStatusDisabled) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, stub)
+	})
+
+	// 配置本机 stub_status 状态页，安装 Nginx 时会自动执行
+	apiV1.POST("/system/stub-status", func(c *gin.Context) {
+		prev, err := stubStatusSvc.Enable()
+		if err != nil {
+			if errors.Is(err, service.ErrStubStatusUnsupported) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = stubStatusSvc.RestoreConf(prev)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "stub_status 已启用", "url": stubStatusSvc.URL})
+	})
+
+	apiV1.GET("/system/geoip", func(c *gin.Context) {
+		c.JSON(http.StatusOK, geoIPSvc.Status())
+	})
+
+	// 上传 GeoLite2/GeoIP2 的 .mmdb 数据库，用于访问统计的国家与地区归属
+	apiV1.POST("/system/geoip", func(c *gin.Context) {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的 .mmdb 文件"})
+			return
+		}
+		src, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer src.Close()
+		if err := geoIPSvc.Install(src); err != nil {
+			if errors.Is(err, service.ErrInvalidGeoIPDB) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "GeoIP 数据库已更新", "status": geoIPSvc.Status()})
+	})
+
+	apiV1.GET("/system/site-logs", func(c *gin.Context) {
+		logs, err := siteSvc.CollectTodayLogs(200)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, logs)
+	})
+
+	// 5. 通知设置
+	apiV1.GET("/settings/notifications", func(c *gin.Context) {
+		settings, err := notificationSvc.Get()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, service.RedactNotificationSettings(settings))
+	})
+
+	apiV1.PUT("/settings/notifications", func(c *gin.Context) {
+		var req model.NotificationSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := notificationSvc.Save(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidExpiryDateFormat) || errors.Is(err, service.ErrInvalidNotificationSettings) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, service.RedactNotificationSettings(saved))
+	})
+
+	// 发送测试通知。可附带表单中尚未保存的配置，省略时使用已保存的配置
+	apiV1.POST("/settings/notifications/test", func(c *gin.Context) {
+		var req struct {
+			Channel  string                      `json:"channel"`
+			Settings *model.NotificationSettings `json:"settings"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var settings model.NotificationSettings
+		var err error
+		if req.Settings != nil {
+			settings, err = notificationSvc.Normalize(*req.Settings)
+		} else {
+			settings, err = notificationSvc.Get()
+		}
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidExpiryDateFormat) || errors.Is(err, service.ErrInvalidNotificationSettings) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		result, err := notifier.SendTest(req.Channel, settings)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
+	// 通知发送记录，最新的在前，可按事件类型过滤
+	apiV1.GET("/notifications/history", func(c *gin.Context) {
+		limit := 100
+		if value := c.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit 必须是整数"})
+				return
+			}
+			limit = parsed
+		}
+		records, err := notificationSvc.History(c.Query("event"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, records)
+	})
+
+	apiV1.GET("/settings/site-defaults", func(c *gin.Context) {
+		defaults, err := siteDefaultsSvc.Get()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, defaults)
+	})
+
+	apiV1.PUT("/settings/site-defaults", func(c *gin.Context) {
+		var req model.SiteDefaults
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := siteDefaultsSvc.Save(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidSiteOption) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	})
+
+	apiV1.GET("/settings/bot-block", func(c *gin.Context) {
+		settings, err := botBlockSvc.Get()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	})
+
+	apiV1.PUT("/settings/bot-block", func(c *gin.Context) {
+		var req model.BotBlockSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, prevMap, err := botBlockSvc.Save(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidSiteOption) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = botBlockSvc.RestoreMap(prevMap)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		if err := fail2banSvc.RefreshBotFilter(); err != nil {
+			log.Printf("[fail2ban] 更新 UA 过滤器失败: %v", err)
+		}
+		c.JSON(http.StatusOK, saved)
+	})
+
+	// 6. 备份与恢复
+	apiV1.GET("/backup/status", func(c *gin.Context) {
+		status, err := backupSvc.Status()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	})
+
+	apiV1.POST("/backup/setup", func(c *gin.Context) {
+		var req service.BackupSetupRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		nextCheck, firstBackup, err := backupSvc.Setup(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidBackupSettings) || errors.Is(err, service.ErrRcloneRemoteNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		payload := gin.H{
+			"message":      "备份存储配置成功",
+			"first_backup": firstBackup,
+		}
+		if !nextCheck.IsZero() {
+			payload["next_check_at"] = nextCheck.Format(time.RFC3339)
+		}
+		c.JSON(http.StatusOK, payload)
+	})
+
+	apiV1.POST("/backup/run", func(c *gin.Context) {
+		job, err := backupSvc.StartBackup()
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrBackupRunning) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "备份任务已启动", "job": job})
+	})
+
+	apiV1.GET("/backup/jobs", func(c *gin.Context) {
+		c.JSON(http.StatusOK, backupSvc.Jobs())
+	})
+
+	apiV1.GET("/backup/jobs/:id", func(c *gin.Context) {
+		job, err := backupSvc.Job(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	})
+
+	apiV1.POST("/backup/test", func(c *gin.Context) {
+		if err := backupSvc.TestConnection(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "与备份存储连接正常"})
+	})
+
+	apiV1.GET("/backup/remotes", func(c *gin.Context) {
+		remotes, err := backupSvc.ListRemotes()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"remotes": remotes})
+	})
+
+	apiV1.PUT("/backup/remotes/:name", func(c *gin.Context) {
+		var req model.RcloneRemote
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Name = c.Param("name")
+		remote, err := backupSvc.SaveRemote(req)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrInvalidBackupSettings) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "rclone remote 已保存", "remote": remote})
+	})
+
+	apiV1.DELETE("/backup/remotes/:name", func(c *gin.Context) {
+		if err := backupSvc.DeleteRemote(c.Param("name")); err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, service.ErrRcloneRemoteNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, service.ErrInvalidBackupSettings):
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "rclone remote 已删除"})
+	})
+
+	apiV1.POST("/backup/remotes/:name/test", func(c *gin.Context) {
+		if err := backupSvc.TestRemote(c.Param("name")); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrRcloneRemoteNotFound) {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "与 rclone remote 连接正常"})
+	})
+
+	apiV1.GET("/backup/list", func(c *gin.Context) {
+		archives, err := backupSvc.ListArchives(c.Query("remote_path"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"archives": archives})
+	})
+
+	apiV1.PUT("/backup/paths", func(c *gin.Context) {
+		var req service.BackupPathsSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := backupSvc.SaveBackupPaths(req)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrInvalidBackupSettings) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "备份目录已保存", "paths": saved})
+	})
+
+	apiV1.POST("/backup/upload-restore", func(c *gin.Context) {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的备份文件"})
+			return
+		}
+		src, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer src.Close()
+		scope := service.RestoreScope{Scope: c.PostForm("scope"), Domain: c.PostForm("domain")}
+		if err := systemSvc.RestoreUpload(header.Filename, src, scope); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrInvalidBackupArchive) || errors.Is(err, service.ErrInvalidRestoreScope) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "恢复成功"})
+	})
+
+	apiV1.GET("/backup/download/:name", func(c *gin.Context) {
+		reader, archive, err := backupSvc.OpenArchive(c.Request.Context(), c.Query("remote_path"), c.Param("name"))
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrBackupArchiveNotFound) {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		defer reader.Close()
+		c.DataFromReader(http.StatusOK, archive.Size, "application/gzip", reader, map[string]string{
+			"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": archive.Name}),
+		})
+	})
+
+	apiV1.POST("/backup/verify", func(c *gin.Context) {
+		var req struct {
+			Path       string `json:"path"` // 本地备份文件或目录，为空时校验远程备份
+			RemotePath string `json:"remote_path"`
+			Archive    string `json:"archive"` // 留空时校验最新的备份
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var (
+			result service.BackupVerifyResult
+			err    error
+		)
+		if strings.TrimSpace(req.Path) != "" {
+			result, err = systemSvc.VerifyBackup(req.Path)
+		} else {
+			result, err = backupSvc.Verify(req.RemotePath, req.Archive)
+		}
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrBackupArchiveNotFound) {
+				status = http.StatusNotFound
+			} else if errors.Is(err, service.ErrInvalidBackupArchive) {
+				status = http.StatusUnprocessableEntity
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		message := "校验通过"
+		if !result.Valid {
+			message = "校验未通过"
+		} else if !result.HasManifest {
+			message = "备份可以读取，但没有文件清单，无法比对校验和"
+		}
+		c.JSON(http.StatusOK, gin.H{"message": message, "result": result})
+	})
+
+	apiV1.GET("/backup/snapshots", func(c *gin.Context) {
+		snapshots, err := snapshotSvc.List()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, snapshots)
+	})
+
+	apiV1.POST("/backup/snapshots/:id/restore", func(c *gin.Context) {
+		username := ""
+		if user, ok := c.Get("user"); ok {
+			username = user.(model.User).Username
+		}
+		current, err := snapshotSvc.Restore(c.Param("id"), username)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrConfigSnapshotNotFound) {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "已恢复到所选快照", "previous": current})
+	})
+
+	apiV1.POST("/backup/restore-preview", func(c *gin.Context) {
+		var req struct {
+			Path       string `json:"path"` // 本地备份文件或目录，为空时预览远程备份
+			RemotePath string `json:"remote_path"`
+			Archive    string `json:"archive"` // 留空时使用最新的备份
+			service.RestoreScope
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var (
+			preview service.RestorePreview
+			err     error
+		)
+		if strings.TrimSpace(req.Path) != "" {
+			preview, err = systemSvc.PreviewRestore(req.Path, req.RestoreScope)
+		} else {
+			preview, err = backupSvc.PreviewRestore(req.RemotePath, req.Archive, req.RestoreScope)
+		}
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrBackupArchiveNotFound) {
+				status = http.StatusNotFound
+			} else if errors.Is(err, service.ErrInvalidRestoreScope) || errors.Is(err, service.ErrInvalidBackupArchive) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, preview)
+	})
+
+	apiV1.POST("/backup/restore", func(c *gin.Context) {
+		var req struct {
+			RemotePath string `json:"remote_path"`
+			Archive    string `json:"archive"` // 留空时恢复最新的备份
+			service.RestoreScope
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := backupSvc.Restore(req.RemotePath, req.Archive, req.RestoreScope); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrBackupArchiveNotFound) {
+				status = http.StatusNotFound
+			} else if errors.Is(err, service.ErrInvalidRestoreScope) || errors.Is(err, service.ErrInvalidBackupArchive) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "恢复成功"})
+	})
+
+	// 7. 共享 upstream 与健康检查
+	apiV1.GET("/upstreams/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, healthChecker.Results())
+	})
+
+	apiV1.GET("/upstreams", func(c *gin.Context) {
+		configs, err := upstreamSvc.ListUpstreams()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, configs)
+	})
+
+	apiV1.GET("/upstreams/:name", func(c *gin.Context) {
+		config, err := upstreamSvc.GetUpstream(c.Param("name"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		users, _ := upstreamSvc.Users(config.Name)
+		c.JSON(http.StatusOK, gin.H{"upstream": config, "used_by": users})
+	})
+
+	apiV1.POST("/upstreams", func(c *gin.Context) {
+		var config model.UpstreamConfig
+		if err := c.ShouldBindJSON(&config); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := upstreamSvc.ReadUpstreamRaw(config.Name); err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "同名 upstream 已存在"})
+			return
+		}
+		if err := upstreamSvc.SaveUpstream(config); err != nil {
+			if errors.Is(err, service.ErrInvalidUpstream) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = upstreamSvc.DeleteUpstream(config.Name)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "upstream 创建成功"})
+	})
+
+	apiV1.PUT("/upstreams/:name", func(c *gin.Context) {
+		name := c.Param("name")
+		var config model.UpstreamConfig
+		if err := c.ShouldBindJSON(&config); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if config.Name == "" {
+			config.Name = name
+		} else if config.Name != name {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "名称与请求路径不匹配"})
+			return
+		}
+		prevContent, err := upstreamSvc.ReadUpstreamRaw(name)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err := upstreamSvc.SaveUpstream(config); err != nil {
+			if errors.Is(err, service.ErrInvalidUpstream) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = upstreamSvc.WriteUpstreamRaw(name, prevContent)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "upstream 已更新"})
+	})
+
+	apiV1.DELETE("/upstreams/:name", func(c *gin.Context) {
+		name := c.Param("name")
+		prevContent, err := upstreamSvc.ReadUpstreamRaw(name)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err := upstreamSvc.DeleteUpstream(name); err != nil {
+			if errors.Is(err, service.ErrUpstreamInUse) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := recordReload(c, systemSvc.Reload()); err != nil {
+			_ = upstreamSvc.WriteUpstreamRaw(name, prevContent)
+			_ = systemSvc.Reload()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rolled_back": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "upstream 已删除"})
+	})
+
+	apiV1.GET("/settings/health-check", func(c *gin.Context) {
+		settings, err := healthChecker.GetSettings()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	})
+
+	apiV1.PUT("/settings/health-check", func(c *gin.Context) {
+		var req model.HealthCheckSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := healthChecker.SaveSettings(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidHealthCheckSettings) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	})
+
+	// 站点可用性监测
+	apiV1.GET("/uptime", func(c *gin.Context) {
+		statuses, err := uptimeMonitor.Status(time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, statuses)
+	})
+
+	apiV1.GET("/settings/uptime", func(c *gin.Context) {
+		settings, err := uptimeMonitor.GetSettings()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	})
+
+	apiV1.PUT("/settings/uptime", func(c *gin.Context) {
+		var req model.UptimeSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := uptimeMonitor.SaveSettings(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidUptimeSettings) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	})
+
+	// 防火墙联动：按启用的站点与转发规则放行或关闭端口
+	apiV1.GET("/firewall", func(c *gin.Context) {
+		status, err := firewallSvc.Status()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	})
+
+	apiV1.POST("/firewall/sync", func(c *gin.Context) {
+		if err := firewallSvc.Sync(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "防火墙端口已同步"})
+	})
+
+	apiV1.GET("/settings/firewall", func(c *gin.Context) {
+		settings, err := firewallSvc.GetSettings()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	})
+
+	apiV1.PUT("/settings/firewall", func(c *gin.Context) {
+		var req model.FirewallSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := firewallSvc.SaveSettings(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidFirewallSettings) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	})
+
+	// 异常 IP 自动封禁
+	apiV1.GET("/settings/abuse", func(c *gin.Context) {
+		settings, err := abuseGuard.GetSettings()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	})
+
+	apiV1.PUT("/settings/abuse", func(c *gin.Context) {
+		var req model.AbuseSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := abuseGuard.SaveSettings(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidAbuseSettings) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	})
+
+	apiV1.GET("/abuse/bans", func(c *gin.Context) {
+		bans, err := abuseGuard.Bans()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, bans)
+	})
+
+	apiV1.POST("/abuse/bans", func(c *gin.Context) {
+		var req struct {
+			IP      string `json:"ip"`
+			Minutes int    `json:"minutes"`
+			Reason  string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ban, err := abuseGuard.Ban(req.IP, req.Minutes, req.Reason)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidAbuseSettings) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, ban)
+	})
+
+	apiV1.DELETE("/abuse/bans/:ip", func(c *gin.Context) {
+		if err := abuseGuard.Unban(c.Param("ip")); err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidAbuseSettings):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, service.ErrBanNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "已解除封禁"})
+	})
+
+	// fail2ban：面板维护的 nginx jail 与当前封禁
+	apiV1.GET("/fail2ban", func(c *gin.Context) {
+		status, err := fail2banSvc.Status()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	})
+
+	apiV1.PUT("/settings/fail2ban", func(c *gin.Context) {
+		var req model.Fail2banSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := fail2banSvc.Save(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidFail2banSettings) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	})
+
+	apiV1.DELETE("/fail2ban/jails/:jail/bans/:ip", func(c *gin.Context) {
+		if err := fail2banSvc.Unban(c.Param("jail"), c.Param("ip")); err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidFail2banSettings):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, service.ErrFail2banJailNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "已解除封禁"})
+	})
+
+	// 站点日志轮转
+	apiV1.GET("/settings/logrotate", func(c *gin.Context) {
+		status, err := logRotateSvc.Status()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	})
+
+	apiV1.PUT("/settings/logrotate", func(c *gin.Context) {
+		var req model.LogRotateSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := logRotateSvc.Save(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidLogRotateSettings) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	})
+
+	apiV1.POST("/logs/rotate", func(c *gin.Context) {
+		if err := logRotateSvc.RotateNow(); err != nil {
+			if errors.Is(err, service.ErrInvalidLogRotateSettings) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "日志已轮转"})
+	})
+
+	// 站点日志转发到远程 syslog 或 Loki
+	apiV1.GET("/settings/log-shipping", func(c *gin.Context) {
+		status, err := logShipper.Status()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	})
+
+	apiV1.PUT("/settings/log-shipping", func(c *gin.Context) {
+		var req model.LogShippingSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := logShipper.Save(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidLogShippingSettings) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	})
+
+	// 按已保存的配置发送一条测试日志
+	apiV1.POST("/settings/log-shipping/test", func(c *gin.Context) {
+		if err := logShipper.Test(); err != nil {
+			if errors.Is(err, service.ErrInvalidLogShippingSettings) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "测试日志已发送"})
+	})
+
+	// 外部域名证书监测
+	apiV1.GET("/cert-monitor", func(c *gin.Context) {
+		status, err := certMonitor.Status()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	})
+
+	// 立即检查所有登记的主机，只刷新结果不发送告警
+	apiV1.POST("/cert-monitor/check", func(c *gin.Context) {
+		settings, err := certMonitor.GetSettings()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, certMonitor.RunChecks(settings, time.Now(), false))
+	})
+
+	apiV1.GET("/settings/cert-monitor", func(c *gin.Context) {
+		settings, err := certMonitor.GetSettings()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	})
+
+	apiV1.PUT("/settings/cert-monitor", func(c *gin.Context) {
+		var req model.CertMonitorSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := certMonitor.SaveSettings(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidCertMonitorSettings) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	})
+
+	apiV1.GET("/settings/panel-access", func(c *gin.Context) {
+		settings, err := panelAccessSvc.Get()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	})
+
+	apiV1.PUT("/settings/panel-access", func(c *gin.Context) {
+		var req model.PanelAccessSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := panelAccessSvc.Save(req, net.ParseIP(c.ClientIP()))
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidPanelAccess) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	})
+
+	apiV1.GET("/settings/panel-tls", func(c *gin.Context) {
+		settings, err := panelTLSSvc.Get()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	})
+
+	apiV1.PUT("/settings/panel-tls", func(c *gin.Context) {
+		var req model.PanelTLSSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := panelTLSSvc.Save(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidPanelTLS) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"settings": saved, "message": "已保存，重启面板后生效"})
+	})
+
+	apiV1.GET("/settings/read-only", func(c *gin.Context) {
+		settings, err := readOnlySvc.Get()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	})
+
+	apiV1.PUT("/settings/read-only", func(c *gin.Context) {
+		var req struct {
+			Enabled bool   `json:"enabled"`
+			Reason  string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		by := "token"
+		if user, ok := c.Get("user"); ok {
+			by = user.(model.User).Username
+		}
+		saved, err := readOnlySvc.Save(req.Enabled, req.Reason, by)
+		if err != nil {
+			if errors.Is(err, service.ErrReadOnlyForced) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	})
+
+	apiV1.GET("/settings/oidc", func(c *gin.Context) {
+		settings, err := oidcSvc.Get()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	})
+
+	apiV1.PUT("/settings/oidc", func(c *gin.Context) {
+		var req model.OIDCSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := oidcSvc.Save(req)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidOIDC) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
 	})
 
 	// 5. 静态资源服务
@@ -518,23 +2606,356 @@ func main() {
 		c.Redirect(http.StatusMovedPermanently, "/ui/")
 	})
 
-	r.Run("0.0.0.0:8083")
+	// 配置了面板 HTTPS 时改用 TLS 监听；证书无法加载则退出，避免以明文意外暴露
+	tlsConfig, err := panelTLSSvc.TLSConfig()
+	if err != nil {
+		panic(err)
+	}
+	if tlsConfig == nil {
+		r.Run("0.0.0.0:8083")
+		return
+	}
+	server := &http.Server{
+		Addr:      "0.0.0.0:8083",
+		Handler:   r,
+		TLSConfig: tlsConfig,
+	}
+	if err := server.ListenAndServeTLS("", ""); err != nil {
+		panic(err)
+	}
+}
+
+func siteFileErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidSitePath):
+		return http.StatusBadRequest
+	case errors.Is(err, os.ErrNotExist):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// queryUnixRange 读取 from/to 查询参数（Unix 秒），格式错误时直接写入 400 响应
+func queryUnixRange(c *gin.Context) (from, to time.Time, ok bool) {
+	for _, param := range []struct {
+		name   string
+		target *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || value <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param.name + " 需为 Unix 时间戳"})
+			return time.Time{}, time.Time{}, false
+		}
+		*param.target = time.Unix(value, 0)
+	}
+	return from, to, true
+}
+
+func abortLoginLocked(c *gin.Context, until time.Time) {
+	retryAfter := int(time.Until(until).Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":        fmt.Sprintf("登录失败次数过多，请在 %d 秒后重试", retryAfter),
+		"locked":       true,
+		"locked_until": until.Format(time.RFC3339),
+		"retry_after":  retryAfter,
+	})
+}
+
+// oidcCallbackURL 按当前请求地址生成回调地址，配置中指定了 redirect_url 时不使用
+func oidcCallbackURL(c *gin.Context) string {
+	scheme := "http"
+	if requestIsHTTPS(c) {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/api/v1/auth/oidc/callback"
+}
+
+func redirectOIDCResult(c *gin.Context, values url.Values) {
+	c.Redirect(http.StatusFound, "/ui/#"+values.Encode())
+}
+
+func userErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidUser), errors.Is(err, service.ErrInvalidTOTP):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrUserExists), errors.Is(err, service.ErrLastUser):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// 浏览器会话模式：会话令牌保存在 HttpOnly Cookie 中，脚本无法读取；
+// 写操作需在请求头中回传可读 Cookie 里的 CSRF 令牌（双重提交）。API 自动化仍使用 Bearer 令牌。
+const (
+	sessionCookieName = "ngx_session"
+	csrfCookieName    = "ngx_csrf"
+	csrfHeaderName    = "X-CSRF-Token"
+)
+
+// csrfToken 由会话令牌派生，无需在服务端另行保存；不知道会话令牌就无法计算
+func csrfToken(sessionToken string) string {
+	sum := sha256.Sum256([]byte("csrf:" + sessionToken))
+	return hex.EncodeToString(sum[:16])
+}
+
+func requestIsHTTPS(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
 }
 
-func authMiddleware(authMgr *service.AuthManager) gin.HandlerFunc {
+func setSessionCookies(c *gin.Context, token string, expiresAt time.Time) string {
+	maxAge := int(time.Until(expiresAt).Seconds())
+	csrf := csrfToken(token)
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(sessionCookieName, token, maxAge, "/", "", requestIsHTTPS(c), true)
+	c.SetCookie(csrfCookieName, csrf, maxAge, "/", "", requestIsHTTPS(c), false)
+	return csrf
+}
+
+func clearSessionCookies(c *gin.Context) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(sessionCookieName, "", -1, "/", "", requestIsHTTPS(c), true)
+	c.SetCookie(csrfCookieName, "", -1, "/", "", requestIsHTTPS(c), false)
+}
+
+// loginHandler 账号密码或旧的单一令牌登录；session_mode 为 cookie 时会话写入 Cookie
+func loginHandler(authMgr *service.AuthManager, userStore *service.UserStore, loginLimiter *service.LoginLimiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		header := strings.TrimSpace(c.GetHeader("Authorization"))
-		if header == "" || !strings.HasPrefix(header, "Bearer ") {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			OTP      string `json:"otp"` // 两步验证码或恢复码
+			Token    string `json:"token"`
+			// cookie：会话令牌写入 HttpOnly Cookie 而不在响应中返回，供内置界面使用
+			SessionMode string `json:"session_mode"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ip := c.ClientIP()
+		if until := loginLimiter.LockedUntil(ip); !until.IsZero() {
+			abortLoginLocked(c, until)
+			return
+		}
+		// 凭据错误时记录失败次数，达到阈值后返回锁定信息
+		loginFailed := func(err error) {
+			remaining, until := loginLimiter.Fail(ip)
+			if !until.IsZero() {
+				abortLoginLocked(c, until)
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "remaining_attempts": remaining})
+		}
+		hasUsers, err := userStore.HasUsers()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		username := strings.TrimSpace(req.Username)
+		if username != "" {
+			if req.Password == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "密码不能为空"})
+				return
+			}
+			// 全新安装且未设置过令牌时，首次登录即创建管理员账号
+			created := false
+			if !hasUsers && !authMgr.IsSet() {
+				if _, err := userStore.CreateUser(username, req.Password, model.RoleAdmin); err != nil {
+					if errors.Is(err, service.ErrInvalidUser) {
+						c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+						return
+					}
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				created = true
+			}
+			client := service.SessionClient{IP: ip, UserAgent: c.Request.UserAgent()}
+			token, expireAt, err := userStore.Login(username, req.Password, req.OTP, client)
+			if err != nil {
+				switch {
+				case errors.Is(err, service.ErrTOTPRequired):
+					c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "totp_required": true})
+					return
+				case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrInvalidTOTP):
+					loginFailed(err)
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			loginLimiter.Succeed(ip)
+			user, _, err := userStore.Validate(token)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			msg := "登录成功"
+			if created {
+				msg = "管理员账号已创建并登录"
+			}
+			resp := gin.H{
+				"message":     msg,
+				"username":    user.Username,
+				"role":        user.Role,
+				"expires_at":  expireAt.Format(time.RFC3339),
+				"new_account": created,
+			}
+			if req.SessionMode == "cookie" {
+				resp["csrf_token"] = setSessionCookies(c, token, expireAt)
+			} else {
+				resp["token"] = token
+			}
+			c.JSON(http.StatusOK, resp)
+			return
+		}
+
+		hasAdmin, err := userStore.HasAdmin()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if hasAdmin {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "已启用账号登录，请使用用户名和密码"})
+			return
+		}
+		token := strings.TrimSpace(req.Token)
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "登录令牌不能为空"})
+			return
+		}
+
+		expireAt, created, err := authMgr.Login(token)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrTokenMismatch):
+				loginFailed(err)
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		loginLimiter.Succeed(ip)
+
+		msg := "登录成功"
+		if created {
+			msg = "登录令牌已创建并启用"
+		}
+
+		resp := gin.H{
+			"message":    msg,
+			"expires_at": expireAt.Format(time.RFC3339),
+			"new_token":  created,
+		}
+		if req.SessionMode == "cookie" {
+			resp["csrf_token"] = setSessionCookies(c, token, expireAt)
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// logoutHandler 注销当前会话并清除浏览器中的会话 Cookie
+func logoutHandler(authMgr *service.AuthManager, userStore *service.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clearSessionCookies(c)
+		user, ok := c.Get("user")
+		if !ok {
+			// 旧的单一令牌只有一个会话，注销后需重新登录
+			if err := authMgr.Revoke(); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "已退出登录", "revoked": 1})
+			return
+		}
+		if c.Query("all") == "true" {
+			revoked, err := userStore.LogoutAll(user.(model.User).Username)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "已退出全部会话", "revoked": revoked})
 			return
 		}
+		if err := userStore.Logout(c.GetString("session_token")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "已退出登录", "revoked": 1})
+	}
+}
 
-		token := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+func authMiddleware(authMgr *service.AuthManager, userStore *service.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var token string
+		viaCookie := false
+		if header := strings.TrimSpace(c.GetHeader("Authorization")); header != "" {
+			if !strings.HasPrefix(header, "Bearer ") {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+				return
+			}
+			token = strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+		} else if cookie, err := c.Cookie(sessionCookieName); err == nil {
+			token = strings.TrimSpace(cookie)
+			viaCookie = true
+		}
 		if token == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
 			return
 		}
 
+		reject := func(resp gin.H) {
+			// Cookie 中的会话已失效时一并清除，避免浏览器反复携带
+			if viaCookie {
+				clearSessionCookies(c)
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, resp)
+		}
+		next := func() {
+			method := c.Request.Method
+			if viaCookie && method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions &&
+				subtle.ConstantTimeCompare([]byte(c.GetHeader(csrfHeaderName)), []byte(csrfToken(token))) != 1 {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "CSRF 校验失败，请刷新页面后重试"})
+				return
+			}
+			c.Next()
+		}
+
+		user, session, err := userStore.Validate(token)
+		if err == nil {
+			c.Set("user", user)
+			c.Set("role", user.Role)
+			c.Set("expires_at", session.ExpiresAt)
+			c.Set("session_id", session.ID)
+			c.Set("session_token", token)
+			next()
+			return
+		}
+		hasAdmin, herr := userStore.HasAdmin()
+		if herr != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": herr.Error()})
+			return
+		}
+		if hasAdmin {
+			resp := gin.H{"error": err.Error()}
+			if errors.Is(err, service.ErrTokenExpired) {
+				resp["expired"] = true
+			}
+			reject(resp)
+			return
+		}
+
+		// 尚未创建管理员账号时沿用旧的单一令牌
 		if err := authMgr.Validate(token); err != nil {
 			resp := gin.H{"error": err.Error()}
 			if errors.Is(err, service.ErrTokenExpired) {
@@ -543,9 +2964,290 @@ func authMiddleware(authMgr *service.AuthManager) gin.HandlerFunc {
 			if errors.Is(err, service.ErrTokenNotSet) {
 				resp["not_set"] = true
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, resp)
+			reject(resp)
+			return
+		}
+		// 旧的单一令牌持有者即安装者，视为管理员
+		c.Set("role", model.RoleAdmin)
+		c.Set("expires_at", authMgr.ExpiresAt())
+		next()
+	}
+}
+
+// panelAccessMiddleware 按来源 IP 白名单限制整个面板（含登录与静态页面）
+func panelAccessMiddleware(panelAccessSvc *service.PanelAccessService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, err := panelAccessSvc.Allowed(net.ParseIP(c.ClientIP()))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "来源 IP 不在面板访问白名单中"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// auditResponseWriter 截留响应体开头部分，用于提取错误信息与回滚结果
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	if w.body.Len() < 4096 {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// recordReload 记录本次请求中第一次重载的结果，回滚时的重载不覆盖
+func recordReload(c *gin.Context, err error) error {
+	if _, ok := c.Get("audit_reload"); !ok {
+		outcome := "ok"
+		if err != nil {
+			outcome = "failed"
+		}
+		c.Set("audit_reload", outcome)
+	}
+	return err
+}
+
+// auditMiddleware 记录所有写操作：操作者、接口、脱敏后的请求体、结果与重载情况
+func auditMiddleware(auditLog *service.AuditLog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		var payload string
+		// 上传文件体积可能很大，只记录类型与长度
+		if c.ContentType() == "multipart/form-data" {
+			payload = fmt.Sprintf("<multipart/form-data, %d bytes>", c.Request.ContentLength)
+		} else if c.Request.Body != nil {
+			body, err := io.ReadAll(c.Request.Body)
+			if err == nil {
+				c.Request.Body = io.NopCloser(bytes.NewReader(body))
+				payload = service.AuditPayloadSummary(c.ContentType(), body)
+			}
+		}
+		writer := &auditResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		entry := model.AuditEntry{
+			Time:       start,
+			Role:       c.GetString("role"),
+			ClientIP:   c.ClientIP(),
+			Method:     method,
+			Path:       c.Request.URL.Path,
+			Route:      c.FullPath(),
+			Payload:    payload,
+			Status:     writer.Status(),
+			Reload:     c.GetString("audit_reload"),
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if user, ok := c.Get("user"); ok {
+			entry.User = user.(model.User).Username
+		} else if entry.Role != "" {
+			entry.User = "token"
+		}
+		var resp struct {
+			Error      string `json:"error"`
+			RolledBack bool   `json:"rolled_back"`
+		}
+		if json.Unmarshal(writer.body.Bytes(), &resp) == nil {
+			entry.Error = resp.Error
+			entry.RolledBack = resp.RolledBack
+		}
+		if err := auditLog.Append(entry); err != nil {
+			log.Printf("[audit] 写入审计日志失败: %v", err)
+		}
+	}
+}
+
+// snapshotRoutes 修改站点、转发规则、SNI 分流、共享上游与全局配置的接口，执行前为 Nginx 配置目录生成快照
+var snapshotRoutes = map[string]bool{
+	"POST /api/v1/sites":                 true,
+	"PUT /api/v1/sites/:domain":          true,
+	"PUT /api/v1/sites/:domain/raw":      true,
+	"DELETE /api/v1/sites/:domain":       true,
+	"POST /api/v1/streams":               true,
+	"POST /api/v1/streams/import":        true,
+	"PUT /api/v1/streams/:name":          true,
+	"DELETE /api/v1/streams/:name":       true,
+	"POST /api/v1/streams/:name/enable":  true,
+	"POST /api/v1/streams/:name/disable": true,
+	"PUT /api/v1/streams/:name/raw":      true,
+	"POST /api/v1/sni-routes":            true,
+	"PUT /api/v1/sni-routes/:name":       true,
+	"DELETE /api/v1/sni-routes/:name":    true,
+	"POST /api/v1/upstreams":             true,
+	"PUT /api/v1/upstreams/:name":        true,
+	"DELETE /api/v1/upstreams/:name":     true,
+	"PUT /api/v1/nginx/conf/file":        true,
+	"DELETE /api/v1/nginx/conf/file":     true,
+	"PUT /api/v1/settings/global-tuning": true,
+}
+
+// configSnapshotMiddleware 请求失败时配置未改动或已回滚，丢弃对应快照以免挤占保留数量
+func configSnapshotMiddleware(snapshotSvc *service.ConfigSnapshotService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !snapshotRoutes[c.Request.Method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+		username := ""
+		if user, ok := c.Get("user"); ok {
+			username = user.(model.User).Username
+		}
+		snapshot, err := snapshotSvc.Take(c.Request.Method+" "+c.Request.URL.Path, username)
+		if err != nil {
+			log.Printf("[snapshot] %v", err)
+			c.Next()
 			return
 		}
 		c.Next()
+		if c.Writer.Status() >= http.StatusBadRequest {
+			if err := snapshotSvc.Discard(snapshot.ID); err != nil {
+				log.Printf("[snapshot] 删除快照 %s 失败: %v", snapshot.ID, err)
+			}
+		}
+	}
+}
+
+// firewallSyncRoutes 可能改变站点、转发规则或 SNI 分流监听端口的接口，包括直接编辑配置文件与各类恢复
+var firewallSyncRoutes = map[string]bool{
+	"POST /api/v1/sites":                        true,
+	"PUT /api/v1/sites/:domain":                 true,
+	"PUT /api/v1/sites/:domain/raw":             true,
+	"DELETE /api/v1/sites/:domain":              true,
+	"POST /api/v1/streams":                      true,
+	"POST /api/v1/streams/import":               true,
+	"PUT /api/v1/streams/:name":                 true,
+	"DELETE /api/v1/streams/:name":              true,
+	"POST /api/v1/streams/:name/enable":         true,
+	"POST /api/v1/streams/:name/disable":        true,
+	"PUT /api/v1/streams/:name/raw":             true,
+	"POST /api/v1/sni-routes":                   true,
+	"PUT /api/v1/sni-routes/:name":              true,
+	"DELETE /api/v1/sni-routes/:name":           true,
+	"PUT /api/v1/nginx/conf/file":               true,
+	"DELETE /api/v1/nginx/conf/file":            true,
+	"POST /api/v1/system/restore":               true,
+	"POST /api/v1/backup/restore":               true,
+	"POST /api/v1/backup/upload-restore":        true,
+	"POST /api/v1/backup/snapshots/:id/restore": true,
+}
+
+// firewallSyncMiddleware firewallSyncRoutes 中的接口成功后在后台同步防火墙端口，失败记录在防火墙状态中
+func firewallSyncMiddleware(firewallSvc *service.FirewallService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if !firewallSyncRoutes[c.Request.Method+" "+c.FullPath()] || c.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+		go func() {
+			if err := firewallSvc.Sync(); err != nil {
+				log.Printf("[firewall] %v", err)
+			}
+		}()
+	}
+}
+
+// adminOnlyRoutes operator 不能调用的接口：安装、卸载、恢复、下载备份与账号管理。
+// 备份归档包含证书私钥与面板凭据，本地与远端（remote_path）下载共用同一接口
+var adminOnlyRoutes = map[string]bool{
+	"GET /api/v1/backup/download/:name":         true,
+	"POST /api/v1/install":                      true,
+	"POST /api/v1/system/upgrade":               true,
+	"POST /api/v1/system/restore":               true,
+	"POST /api/v1/system/uninstall":             true,
+	"POST /api/v1/backup/setup":                 true,
+	"POST /api/v1/backup/restore":               true,
+	"POST /api/v1/backup/upload-restore":        true,
+	"PUT /api/v1/backup/paths":                  true,
+	"PUT /api/v1/backup/remotes/:name":          true,
+	"POST /api/v1/backup/snapshots/:id/restore": true,
+	"DELETE /api/v1/backup/remotes/:name":       true,
+	"POST /api/v1/users":                        true,
+	"PUT /api/v1/users/:username/password":      true,
+	"PUT /api/v1/users/:username/role":          true,
+	"DELETE /api/v1/users/:username":            true,
+	"DELETE /api/v1/users/:username/totp":       true,
+	"PUT /api/v1/settings/panel-access":         true,
+	"PUT /api/v1/settings/panel-tls":            true,
+	"PUT /api/v1/settings/oidc":                 true,
+	"PUT /api/v1/settings/read-only":            true,
+	"PUT /api/v1/settings/firewall":             true,
+}
+
+// selfServiceRoutes 只作用于当前账号自身的接口，任何角色都可调用
+var selfServiceRoutes = map[string]bool{
+	"POST /api/v1/auth/logout":         true,
+	"POST /api/v1/auth/totp/enroll":    true,
+	"POST /api/v1/auth/totp/confirm":   true,
+	"POST /api/v1/auth/totp/disable":   true,
+	"DELETE /api/v1/auth/sessions/:id": true,
+}
+
+// readOnlyExemptRoutes 只读模式下仍允许的写操作：退出登录、注销会话与关闭只读模式本身
+var readOnlyExemptRoutes = map[string]bool{
+	"POST /api/v1/auth/logout":         true,
+	"DELETE /api/v1/auth/sessions/:id": true,
+	"PUT /api/v1/settings/read-only":   true,
+}
+
+// readOnlyMiddleware 面板处于只读模式时以 423 拒绝所有写操作
+func readOnlyMiddleware(readOnlySvc *service.ReadOnlyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if method == http.MethodGet || method == http.MethodHead || readOnlyExemptRoutes[method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+		settings, err := readOnlySvc.Get()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !settings.Enabled {
+			c.Next()
+			return
+		}
+		msg := "面板处于只读模式，暂不允许修改"
+		if settings.Reason != "" {
+			msg += "：" + settings.Reason
+		}
+		c.AbortWithStatusJSON(http.StatusLocked, gin.H{"error": msg, "read_only": true})
+	}
+}
+
+// roleMiddleware 按角色限制写操作：viewer 只能读取，operator 不能调用 adminOnlyRoutes；
+// adminOnlyRoutes 中的读取接口同样只允许 admin
+func roleMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		readOnly := (method == http.MethodGet || method == http.MethodHead) && !adminOnlyRoutes[method+" "+c.FullPath()]
+		if readOnly || selfServiceRoutes[method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+		switch c.GetString("role") {
+		case model.RoleAdmin:
+			c.Next()
+			return
+		case model.RoleOperator:
+			if !adminOnlyRoutes[method+" "+c.FullPath()] {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "当前账号无权执行此操作"})
 	}
 }
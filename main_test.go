@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nginx-mgr/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newAuthTestRouter 挂载登录、退出与一个写接口，会话保存在临时目录
+func newAuthTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	authMgr, err := service.NewAuthManager(filepath.Join(dir, "auth_token.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	userStore, err := service.NewUserStore(filepath.Join(dir, "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.POST("/api/v1/auth/login", loginHandler(authMgr, userStore, service.NewLoginLimiter()))
+	apiV1 := r.Group("/api/v1")
+	apiV1.Use(authMiddleware(authMgr, userStore))
+	apiV1.POST("/auth/logout", logoutHandler(authMgr, userStore))
+	apiV1.PUT("/sites/:domain", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	})
+	return r
+}
+
+func serve(r *gin.Engine, method, path, body string, setup func(*http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if setup != nil {
+		setup(req)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func responseCookies(w *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return cookies
+}
+
+func TestCookieSessionCSRF(t *testing.T) {
+	r := newAuthTestRouter(t)
+
+	// Cookie 模式登录：会话与 CSRF Cookie 同时写入，响应中不返回会话令牌
+	w := serve(r, http.MethodPost, "/api/v1/auth/login", `{"username":"admin","password":"correct-horse","session_mode":"cookie"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: %d %s", w.Code, w.Body)
+	}
+	var resp map[string]any
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	cookies := responseCookies(w)
+	session, csrf := cookies[sessionCookieName], cookies[csrfCookieName]
+	if session == nil || csrf == nil {
+		t.Fatalf("both cookies should be set: %v", w.Header()["Set-Cookie"])
+	}
+	if !session.HttpOnly || csrf.HttpOnly || session.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("unexpected cookie flags: %+v %+v", session, csrf)
+	}
+	if _, ok := resp["token"]; ok || resp["csrf_token"] != csrf.Value || csrf.Value != csrfToken(session.Value) {
+		t.Fatalf("unexpected login response: %v", resp)
+	}
+
+	withCookies := func(header string) func(*http.Request) {
+		return func(req *http.Request) {
+			req.AddCookie(session)
+			req.AddCookie(csrf)
+			if header != "" {
+				req.Header.Set(csrfHeaderName, header)
+			}
+		}
+	}
+	for name, header := range map[string]string{"missing": "", "mismatched": strings.Repeat("0", len(csrf.Value))} {
+		if w := serve(r, http.MethodPut, "/api/v1/sites/a.com", `{}`, withCookies(header)); w.Code != http.StatusForbidden {
+			t.Fatalf("%s CSRF token: expected 403, got %d", name, w.Code)
+		}
+	}
+	if w := serve(r, http.MethodPut, "/api/v1/sites/a.com", `{}`, withCookies(csrf.Value)); w.Code != http.StatusOK {
+		t.Fatalf("matching CSRF token: expected 200, got %d %s", w.Code, w.Body)
+	}
+
+	// Bearer 令牌不经过浏览器，不校验 CSRF
+	w = serve(r, http.MethodPost, "/api/v1/auth/login", `{"username":"admin","password":"correct-horse"}`, nil)
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	token, _ := resp["token"].(string)
+	if token == "" || len(responseCookies(w)) != 0 {
+		t.Fatalf("token login should return the token without cookies: %s", w.Body)
+	}
+	bearer := func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+	if w := serve(r, http.MethodPut, "/api/v1/sites/a.com", `{}`, bearer); w.Code != http.StatusOK {
+		t.Fatalf("bearer request should skip CSRF, got %d %s", w.Code, w.Body)
+	}
+
+	// 退出登录清除两个 Cookie，原会话随即失效
+	w = serve(r, http.MethodPost, "/api/v1/auth/logout", ``, withCookies(csrf.Value))
+	if w.Code != http.StatusOK {
+		t.Fatalf("logout: %d %s", w.Code, w.Body)
+	}
+	cookies = responseCookies(w)
+	for _, name := range []string{sessionCookieName, csrfCookieName} {
+		if cookie := cookies[name]; cookie == nil || cookie.Value != "" || cookie.MaxAge >= 0 {
+			t.Fatalf("%s should be cleared: %v", name, w.Header()["Set-Cookie"])
+		}
+	}
+	if w := serve(r, http.MethodPut, "/api/v1/sites/a.com", `{}`, withCookies(csrf.Value)); w.Code != http.StatusUnauthorized {
+		t.Fatalf("logged out session should be rejected, got %d", w.Code)
+	}
+	if w := serve(r, http.MethodPut, "/api/v1/sites/a.com", `{}`, bearer); w.Code != http.StatusOK {
+		t.Fatalf("other sessions should survive logout, got %d", w.Code)
+	}
+}